@@ -0,0 +1,326 @@
+package proxyd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	AbuseActionBan       = "ban"
+	AbuseActionRateLimit = "rate_limit"
+
+	AbuseReasonErrors    = "errors"
+	AbuseReasonMalformed = "malformed"
+	AbuseReasonMethods   = "methods"
+	AbuseReasonManual    = "manual"
+
+	abuseClientIPPrefix  = "ip:"
+	abuseClientKeyPrefix = "key:"
+
+	defaultAbuseWindow      = time.Minute
+	defaultAbuseMinRequests = 50
+	defaultAbuseBanDuration = 10 * time.Minute
+
+	// maxAbuseClients bounds the clients tracked within a window.
+	maxAbuseClients = 100_000
+)
+
+var ErrClientBanned = &RPCErr{
+	Code:          JSONRPCErrorInternal - 33,
+	Message:       "client temporarily banned",
+	HTTPErrorCode: 403,
+}
+
+var ErrAbuseBanNotFound = errors.New("ban not found")
+
+// AbuseBan is a penalty applied to a client, an IP as ip:<ip> or an auth
+// key as key:<alias>.
+type AbuseBan struct {
+	Client string    `json:"client"`
+	Action string    `json:"action"`
+	Reason string    `json:"reason"`
+	Until  time.Time `json:"until"`
+}
+
+// abuseStats are the requests of a client within the current window.
+type abuseStats struct {
+	start     time.Time
+	requests  int
+	errors    int
+	malformed int
+	methods   map[string]bool
+}
+
+// AbuseDetector tracks the error rate, malformed request rate and method
+// diversity of the requests of each client IP and auth key, and bans or
+// rate limits the clients exceeding the thresholds for a while. Clients are
+// tracked and banned by each instance.
+type AbuseDetector struct {
+	window           time.Duration
+	minRequests      int
+	maxErrorRate     float64
+	maxMalformedRate float64
+	maxMethods       int
+	action           string
+	banDuration      time.Duration
+	penaltyLim       FrontendRateLimiter
+	exemptNets       []*net.IPNet
+	exemptKeys       map[string]bool
+
+	mtx   sync.Mutex
+	stats map[string]*abuseStats
+	bans  map[string]*AbuseBan
+}
+
+func NewAbuseDetector(config AbuseConfig, limiterFactory limiterFactoryFunc) (*AbuseDetector, error) {
+	if !config.Enabled {
+		return nil, nil
+	}
+	if config.MaxErrorRate < 0 || config.MaxErrorRate > 1 || config.MaxMalformedRate < 0 || config.MaxMalformedRate > 1 {
+		return nil, errors.New("abuse rates must be between 0 and 1")
+	}
+	if config.MaxErrorRate == 0 && config.MaxMalformedRate == 0 && config.MaxDistinctMethods == 0 {
+		return nil, errors.New("abuse requires max_error_rate, max_malformed_rate or max_distinct_methods")
+	}
+	d := &AbuseDetector{
+		window:           defaultAbuseWindow,
+		minRequests:      defaultAbuseMinRequests,
+		maxErrorRate:     config.MaxErrorRate,
+		maxMalformedRate: config.MaxMalformedRate,
+		maxMethods:       config.MaxDistinctMethods,
+		action:           config.Action,
+		banDuration:      defaultAbuseBanDuration,
+		exemptKeys:       make(map[string]bool, len(config.ExemptKeys)),
+		stats:            make(map[string]*abuseStats),
+		bans:             make(map[string]*AbuseBan),
+	}
+	if config.Window != 0 {
+		d.window = time.Duration(config.Window)
+	}
+	if config.MinRequests != 0 {
+		d.minRequests = config.MinRequests
+	}
+	if config.BanDuration != 0 {
+		d.banDuration = time.Duration(config.BanDuration)
+	}
+	switch d.action {
+	case "":
+		d.action = AbuseActionBan
+	case AbuseActionBan:
+	case AbuseActionRateLimit:
+	default:
+		return nil, fmt.Errorf("invalid abuse action %s", config.Action)
+	}
+	// the rate limit of penalized clients also applies to those banned by
+	// admins with the rate_limit action
+	rateLimit := config.RateLimit
+	if rateLimit == 0 {
+		rateLimit = 1
+	}
+	d.penaltyLim = limiterFactory(time.Second, rateLimit, "abuse")
+	nets, err := parseCIDRs(config.ExemptCIDRs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid abuse exempt CIDRs: %w", err)
+	}
+	d.exemptNets = nets
+	for _, alias := range config.ExemptKeys {
+		d.exemptKeys[alias] = true
+	}
+	return d, nil
+}
+
+// clients returns the tracked clients of ctx.
+func (d *AbuseDetector) clients(ctx context.Context) []string {
+	var clients []string
+	if xff := GetXForwardedFor(ctx); xff != "" {
+		if ip := GetClientIP(ctx); ip == nil || !containsIP(d.exemptNets, ip) {
+			clients = append(clients, abuseClientIPPrefix+xff)
+		}
+	}
+	if alias, ok := ctx.Value(ContextKeyAuth).(string); ok && !d.exemptKeys[alias] {
+		clients = append(clients, abuseClientKeyPrefix+alias)
+	}
+	return clients
+}
+
+// Check returns the error refusing the request of ctx if its client IP or
+// auth key is penalized.
+func (d *AbuseDetector) Check(ctx context.Context) error {
+	if d == nil {
+		return nil
+	}
+	for _, client := range d.clients(ctx) {
+		ban := d.ban(client)
+		if ban == nil {
+			continue
+		}
+		if ban.Action == AbuseActionBan {
+			RecordAbuseRejection(ban.Action)
+			return ErrClientBanned
+		}
+		ok, err := d.penaltyLim.Take(ctx, client)
+		if err != nil {
+			log.Error("error taking from abuse limiter", "err", err, "req_id", GetReqID(ctx))
+			return ErrInternal
+		}
+		if !ok {
+			RecordAbuseRejection(ban.Action)
+			return ErrOverRateLimit
+		}
+	}
+	return nil
+}
+
+// ban returns the ongoing ban of client, if any.
+func (d *AbuseDetector) ban(client string) *AbuseBan {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	ban := d.bans[client]
+	if ban != nil && !time.Now().Before(ban.Until) {
+		delete(d.bans, client)
+		RecordAbuseActiveBans(len(d.bans))
+		return nil
+	}
+	return ban
+}
+
+// Observe tracks the requests of ctx for methods and their responses. The
+// methods of malformed requests are empty.
+func (d *AbuseDetector) Observe(ctx context.Context, methods []string, responses []*RPCRes) {
+	if d == nil {
+		return
+	}
+	clients := d.clients(ctx)
+	if len(clients) == 0 {
+		return
+	}
+	var errs, malformed int
+	for i, method := range methods {
+		if method == "" {
+			malformed++
+		} else if responses[i] != nil && responses[i].IsError() {
+			errs++
+		}
+	}
+
+	now := time.Now()
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	for _, client := range clients {
+		if _, banned := d.bans[client]; banned {
+			continue
+		}
+		stats := d.stats[client]
+		if stats == nil || now.Sub(stats.start) >= d.window {
+			if len(d.stats) >= maxAbuseClients {
+				d.stats = make(map[string]*abuseStats)
+			}
+			stats = &abuseStats{start: now, methods: make(map[string]bool)}
+			d.stats[client] = stats
+		}
+		stats.requests += len(methods)
+		stats.errors += errs
+		stats.malformed += malformed
+		// the methods tracked are bounded by the threshold
+		for _, method := range methods {
+			if method != "" && d.maxMethods > 0 && len(stats.methods) <= d.maxMethods {
+				stats.methods[method] = true
+			}
+		}
+		if reason := d.violation(stats); reason != "" {
+			delete(d.stats, client)
+			d.penalize(client, d.action, reason, now.Add(d.banDuration))
+		}
+	}
+}
+
+// violation returns the threshold stats exceed, if any.
+func (d *AbuseDetector) violation(stats *abuseStats) string {
+	if d.maxMethods > 0 && len(stats.methods) > d.maxMethods {
+		return AbuseReasonMethods
+	}
+	if stats.requests < d.minRequests {
+		return ""
+	}
+	if d.maxMalformedRate > 0 && float64(stats.malformed)/float64(stats.requests) > d.maxMalformedRate {
+		return AbuseReasonMalformed
+	}
+	if d.maxErrorRate > 0 && float64(stats.errors)/float64(stats.requests) > d.maxErrorRate {
+		return AbuseReasonErrors
+	}
+	return ""
+}
+
+// penalize applies action to client until then. The caller holds mtx.
+func (d *AbuseDetector) penalize(client, action, reason string, until time.Time) *AbuseBan {
+	ban := &AbuseBan{
+		Client: client,
+		Action: action,
+		Reason: reason,
+		Until:  until,
+	}
+	d.bans[client] = ban
+	log.Warn("penalized abusive client", "client", client, "action", action, "reason", reason, "until", until)
+	kind, _, _ := strings.Cut(client, ":")
+	RecordAbuseBan(kind, action, reason)
+	RecordAuditEvent(AuditEventClientBan, "client", client, "action", action, "reason", reason, "until", until.UTC().Format(time.RFC3339))
+	RecordAbuseActiveBans(len(d.bans))
+	return ban
+}
+
+// Bans returns the ongoing bans, by client.
+func (d *AbuseDetector) Bans() []*AbuseBan {
+	now := time.Now()
+	d.mtx.Lock()
+	bans := make([]*AbuseBan, 0, len(d.bans))
+	for _, ban := range d.bans {
+		if now.Before(ban.Until) {
+			bans = append(bans, ban)
+		}
+	}
+	d.mtx.Unlock()
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].Client < bans[j].Client
+	})
+	return bans
+}
+
+// Ban applies action to client for duration.
+func (d *AbuseDetector) Ban(client, action string, duration time.Duration) (*AbuseBan, error) {
+	if !strings.HasPrefix(client, abuseClientIPPrefix) && !strings.HasPrefix(client, abuseClientKeyPrefix) {
+		return nil, fmt.Errorf("client must be ip:<ip> or key:<alias>")
+	}
+	switch action {
+	case "":
+		action = AbuseActionBan
+	case AbuseActionBan, AbuseActionRateLimit:
+	default:
+		return nil, fmt.Errorf("invalid action %s", action)
+	}
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	delete(d.stats, client)
+	return d.penalize(client, action, AbuseReasonManual, time.Now().Add(duration)), nil
+}
+
+// Unban lifts the ban of client, and resets its requests.
+func (d *AbuseDetector) Unban(client string) error {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	if _, ok := d.bans[client]; !ok {
+		return ErrAbuseBanNotFound
+	}
+	delete(d.bans, client)
+	delete(d.stats, client)
+	RecordAbuseActiveBans(len(d.bans))
+	RecordAuditEvent(AuditEventClientUnban, "client", client)
+	return nil
+}
@@ -0,0 +1,285 @@
+package proxyd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const ContextKeyAccessLog = "access_log"
+
+// accessLogFields are the fields of access log lines, which can be redacted.
+var accessLogFields = map[string]bool{
+	"req_id":     true,
+	"method":     true,
+	"methods":    true,
+	"batch_size": true,
+	"auth":       true,
+	"client_ip":  true,
+	"user_agent": true,
+	"origin":     true,
+	"backend":    true,
+	"cache":      true,
+	"latency_ms": true,
+	"status":     true,
+	"error_code": true,
+}
+
+// AccessLog writes a JSON line per HTTP RPC request, with its outcome.
+// Requests answered successfully are sampled, others are always logged.
+type AccessLog struct {
+	sampleRate float64
+	redact     map[string]bool
+
+	mtx sync.Mutex
+	w   io.Writer
+
+	exporters []*accessLogExporter
+}
+
+func NewAccessLog(config AccessLogConfig) (*AccessLog, error) {
+	if !config.Enabled {
+		return nil, nil
+	}
+	sampleRate := 1.0
+	if config.SampleRate != 0 {
+		sampleRate = config.SampleRate
+	}
+	if sampleRate < 0 || sampleRate > 1 {
+		return nil, fmt.Errorf("access_log.sample_rate must be between 0 and 1")
+	}
+	redact := make(map[string]bool, len(config.RedactFields))
+	for _, field := range config.RedactFields {
+		if !accessLogFields[field] {
+			return nil, fmt.Errorf("unknown access log field %s", field)
+		}
+		redact[field] = true
+	}
+	a := &AccessLog{
+		sampleRate: sampleRate,
+		redact:     redact,
+	}
+	names := make(map[string]bool, len(config.Sinks))
+	for _, sinkConfig := range config.Sinks {
+		exporter, err := newAccessLogExporter(sinkConfig)
+		if err != nil {
+			a.Close()
+			return nil, err
+		}
+		a.exporters = append(a.exporters, exporter)
+		exporter.start()
+		if names[exporter.name] {
+			a.Close()
+			return nil, fmt.Errorf("duplicate access log sink name %s", exporter.name)
+		}
+		names[exporter.name] = true
+	}
+	if config.File != "" {
+		file, err := os.OpenFile(config.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			a.Close()
+			return nil, fmt.Errorf("error opening access log: %w", err)
+		}
+		a.w = file
+	} else if len(a.exporters) == 0 {
+		a.w = os.Stdout
+	}
+	return a, nil
+}
+
+// Close writes the lines buffered by the sinks.
+func (a *AccessLog) Close() {
+	for _, exporter := range a.exporters {
+		exporter.close()
+	}
+}
+
+// accessLogEntry is the outcome of a request, filled in as it's handled.
+type accessLogEntry struct {
+	mtx       sync.Mutex
+	clientIP  string
+	methods   []string
+	backend   string
+	errorCode int
+}
+
+func getAccessLogEntry(ctx context.Context) *accessLogEntry {
+	entry, _ := ctx.Value(ContextKeyAccessLog).(*accessLogEntry)
+	return entry
+}
+
+// setAccessLogClientIP records the client IP of the request of ctx, known
+// ahead of authentication.
+func setAccessLogClientIP(ctx context.Context, xff string) {
+	if entry := getAccessLogEntry(ctx); entry != nil {
+		entry.mtx.Lock()
+		entry.clientIP = stripXFF(xff)
+		entry.mtx.Unlock()
+	}
+}
+
+// setAccessLogMethods records the methods of the requests of ctx.
+func setAccessLogMethods(ctx context.Context, methods []string) {
+	if entry := getAccessLogEntry(ctx); entry != nil {
+		entry.mtx.Lock()
+		entry.methods = methods
+		entry.mtx.Unlock()
+	}
+}
+
+// setAccessLogBackend records the backends serving the requests of ctx.
+func setAccessLogBackend(ctx context.Context, backend string) {
+	if entry := getAccessLogEntry(ctx); entry != nil {
+		entry.mtx.Lock()
+		entry.backend = backend
+		entry.mtx.Unlock()
+	}
+}
+
+// setAccessLogError records the error code answered to the requests of ctx,
+// the first one of batches.
+func setAccessLogError(ctx context.Context, res []*RPCRes) {
+	entry := getAccessLogEntry(ctx)
+	if entry == nil {
+		return
+	}
+	entry.mtx.Lock()
+	defer entry.mtx.Unlock()
+	for _, r := range res {
+		if r != nil && r.IsError() && entry.errorCode == 0 {
+			entry.errorCode = r.Error.Code
+		}
+	}
+}
+
+// begin returns w and r recording the outcome of the request, and the func
+// logging it once handled. ctx is the context of the request, if it got
+// past authentication.
+func (a *AccessLog) begin(w http.ResponseWriter, r *http.Request) (http.ResponseWriter, *http.Request, func(ctx context.Context)) {
+	start := time.Now()
+	entry := new(accessLogEntry)
+	sw := &accessLogWriter{ResponseWriter: w, status: http.StatusOK}
+	r = r.WithContext(context.WithValue(r.Context(), ContextKeyAccessLog, entry)) // nolint:staticcheck
+	return sw, r, func(ctx context.Context) {
+		a.log(ctx, r, sw, entry, time.Since(start))
+	}
+}
+
+func (a *AccessLog) log(ctx context.Context, r *http.Request, sw *accessLogWriter, entry *accessLogEntry, latency time.Duration) {
+	entry.mtx.Lock()
+	defer entry.mtx.Unlock()
+	failed := sw.status >= 400 || entry.errorCode != 0
+	if !failed && a.sampleRate < 1 && rand.Float64() >= a.sampleRate {
+		return
+	}
+
+	line := map[string]interface{}{
+		"time":       time.Now().UTC().Format(time.RFC3339Nano),
+		"user_agent": r.Header.Get("User-Agent"),
+		"origin":     r.Header.Get("Origin"),
+		"client_ip":  entry.clientIP,
+		"backend":    entry.backend,
+		"latency_ms": float64(latency.Microseconds()) / 1000,
+		"status":     sw.status,
+	}
+	if ctx != nil {
+		line["req_id"] = GetReqID(ctx)
+		line["auth"] = GetAuthCtx(ctx)
+	}
+	switch len(entry.methods) {
+	case 0:
+	case 1:
+		line["method"] = entry.methods[0]
+	default:
+		line["method"] = "batch"
+		line["methods"] = entry.methods
+		line["batch_size"] = len(entry.methods)
+	}
+	switch sw.Header().Get(cacheStatusHdr) {
+	case "HIT":
+		line["cache"] = "hit"
+	case "MISS":
+		line["cache"] = "miss"
+	}
+	if entry.errorCode != 0 {
+		line["error_code"] = entry.errorCode
+	}
+	for field, value := range line {
+		if s, ok := value.(string); ok && s == "" {
+			delete(line, field)
+		} else if a.redact[field] {
+			line[field] = redactAccessLogValue(value)
+		}
+	}
+
+	b, err := json.Marshal(line)
+	if err != nil {
+		log.Error("error encoding access log line", "err", err)
+		return
+	}
+	for _, exporter := range a.exporters {
+		exporter.enqueue(b)
+	}
+	if a.w == nil {
+		return
+	}
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	if _, err := a.w.Write(append(b, '\n')); err != nil {
+		log.Error("error writing access log", "err", err)
+	}
+}
+
+// redactAccessLogValue replaces value by a short hash of it, so that lines
+// can still be grouped by the field.
+func redactAccessLogValue(value interface{}) string {
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+	case []string:
+		s = strings.Join(v, ",")
+	default:
+		s = fmt.Sprint(v)
+	}
+	sum := sha256.Sum256([]byte(s))
+	return "redacted:" + hex.EncodeToString(sum[:6])
+}
+
+// accessLogWriter records the status of the response.
+type accessLogWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *accessLogWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *accessLogWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush lets the keepalive writer flush through the access log.
+func (w *accessLogWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
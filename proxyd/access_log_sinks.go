@@ -0,0 +1,357 @@
+package proxyd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	defaultAccessLogSinkBatchSize     = 500
+	defaultAccessLogSinkFlushInterval = time.Second
+	defaultAccessLogSinkBufferSize    = 10_000
+	defaultAccessLogSinkMaxRetries    = 3
+	defaultAccessLogFileMaxSizeMB     = 100
+	defaultAccessLogFileMaxBackups    = 5
+	accessLogSinkTimeout              = 10 * time.Second
+	accessLogSinkMaxBackoff           = 5 * time.Second
+)
+
+// accessLogSink writes batches of access log lines, JSON objects without a
+// trailing newline. Sinks are only used by the goroutine of their exporter,
+// and mustn't retain lines after write returns.
+type accessLogSink interface {
+	write(ctx context.Context, lines [][]byte) error
+	close() error
+}
+
+// accessLogExporter buffers the lines of a sink, and writes them in batches in
+// the background. Failed batches are retried with a backoff, during which
+// the buffer fills up and lines are dropped, or requests held up.
+type accessLogExporter struct {
+	name          string
+	sink          accessLogSink
+	batchSize     int
+	flushInterval time.Duration
+	maxRetries    int
+	block         bool
+
+	lines    chan []byte
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func newAccessLogExporter(config AccessLogSinkConfig) (*accessLogExporter, error) {
+	name := config.Name
+	if name == "" {
+		name = config.Type
+	}
+	var block bool
+	switch config.OnFull {
+	case "", "drop":
+	case "block":
+		block = true
+	default:
+		return nil, fmt.Errorf("access log sink %s: on_full must be drop or block", name)
+	}
+
+	var sink accessLogSink
+	var err error
+	switch config.Type {
+	case "kafka":
+		sink, err = newKafkaSink(config)
+	case "file":
+		sink, err = newRotatingFileSink(config)
+	case "http":
+		sink, err = newHTTPBulkSink(config)
+	default:
+		return nil, fmt.Errorf("unknown access log sink type %q", config.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	e := &accessLogExporter{
+		name:          name,
+		sink:          sink,
+		batchSize:     defaultAccessLogSinkBatchSize,
+		flushInterval: defaultAccessLogSinkFlushInterval,
+		maxRetries:    defaultAccessLogSinkMaxRetries,
+		block:         block,
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	if config.BatchSize != 0 {
+		e.batchSize = config.BatchSize
+	}
+	if config.FlushInterval != 0 {
+		e.flushInterval = time.Duration(config.FlushInterval)
+	}
+	if config.MaxRetries != 0 {
+		e.maxRetries = config.MaxRetries
+	}
+	bufferSize := defaultAccessLogSinkBufferSize
+	if config.BufferSize != 0 {
+		bufferSize = config.BufferSize
+	}
+	e.lines = make(chan []byte, bufferSize)
+	return e, nil
+}
+
+func (e *accessLogExporter) start() {
+	go e.run()
+}
+
+// close writes the buffered lines, and closes the sink.
+func (e *accessLogExporter) close() {
+	e.stopOnce.Do(func() {
+		close(e.stop)
+		<-e.done
+	})
+}
+
+// enqueue buffers line, waiting for room if the exporter blocks.
+func (e *accessLogExporter) enqueue(line []byte) {
+	if e.block {
+		select {
+		case e.lines <- line:
+		case <-e.stop:
+			RecordAccessLogSinkLines(e.name, "dropped", 1)
+		}
+		return
+	}
+	select {
+	case e.lines <- line:
+	default:
+		RecordAccessLogSinkLines(e.name, "dropped", 1)
+	}
+}
+
+func (e *accessLogExporter) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(e.flushInterval)
+	defer ticker.Stop()
+	batch := make([][]byte, 0, e.batchSize)
+	add := func(line []byte) {
+		if batch = append(batch, line); len(batch) >= e.batchSize {
+			e.flush(batch)
+			batch = batch[:0]
+		}
+	}
+	for {
+		select {
+		case line := <-e.lines:
+			add(line)
+		case <-ticker.C:
+			if len(batch) > 0 {
+				e.flush(batch)
+				batch = batch[:0]
+			}
+		case <-e.stop:
+			for len(e.lines) > 0 {
+				add(<-e.lines)
+			}
+			if len(batch) > 0 {
+				e.flush(batch)
+			}
+			if err := e.sink.close(); err != nil {
+				log.Error("error closing access log sink", "sink", e.name, "err", err)
+			}
+			RecordAccessLogSinkBuffered(e.name, 0)
+			return
+		}
+		RecordAccessLogSinkBuffered(e.name, len(e.lines))
+	}
+}
+
+// flush writes batch to the sink, retrying failed attempts. Lines of partly
+// written batches may be written twice.
+func (e *accessLogExporter) flush(batch [][]byte) {
+	var err error
+	backoff := 250 * time.Millisecond
+	for attempt := 0; attempt <= e.maxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			if backoff *= 2; backoff > accessLogSinkMaxBackoff {
+				backoff = accessLogSinkMaxBackoff
+			}
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), accessLogSinkTimeout)
+		err = e.sink.write(ctx, batch)
+		cancel()
+		if err == nil {
+			RecordAccessLogSinkLines(e.name, "written", len(batch))
+			return
+		}
+		log.Warn("error writing access log lines", "sink", e.name, "attempt", attempt+1, "err", err)
+	}
+	log.Error("dropping access log lines", "sink", e.name, "lines", len(batch), "err", err)
+	RecordAccessLogSinkLines(e.name, "failed", len(batch))
+}
+
+// rotatingFileSink appends lines to a file, which is rotated to numbered
+// backups once it exceeds its max size.
+type rotatingFileSink struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	file *os.File
+	size int64
+}
+
+func newRotatingFileSink(config AccessLogSinkConfig) (*rotatingFileSink, error) {
+	if config.Path == "" {
+		return nil, errors.New("file access log sinks require a path")
+	}
+	s := &rotatingFileSink{
+		path:       config.Path,
+		maxSize:    defaultAccessLogFileMaxSizeMB << 20,
+		maxBackups: defaultAccessLogFileMaxBackups,
+	}
+	if config.MaxSizeMB != 0 {
+		s.maxSize = int64(config.MaxSizeMB) << 20
+	}
+	if config.MaxBackups != 0 {
+		s.maxBackups = config.MaxBackups
+	}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *rotatingFileSink) open() error {
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("error opening access log file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	s.file, s.size = file, info.Size()
+	return nil
+}
+
+func (s *rotatingFileSink) write(_ context.Context, lines [][]byte) error {
+	if s.file == nil {
+		// a previous rotation failed
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+	var buf bytes.Buffer
+	for _, line := range lines {
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	if s.size > 0 && s.size+int64(buf.Len()) > s.maxSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := s.file.Write(buf.Bytes())
+	s.size += int64(n)
+	return err
+}
+
+// rotate shifts path.1... to path.2..., dropping the oldest backup, moves the
+// file to path.1 and opens a new one.
+func (s *rotatingFileSink) rotate() error {
+	err := s.file.Close()
+	s.file = nil
+	if err != nil {
+		return err
+	}
+	backup := func(i int) string {
+		return fmt.Sprintf("%s.%d", s.path, i)
+	}
+	if err := os.Remove(backup(s.maxBackups)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for i := s.maxBackups - 1; i >= 1; i-- {
+		if err := os.Rename(backup(i), backup(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(s.path, backup(1)); err != nil {
+		return err
+	}
+	return s.open()
+}
+
+func (s *rotatingFileSink) close() error {
+	if s.file == nil {
+		return nil
+	}
+	return s.file.Close()
+}
+
+// httpBulkSink posts batches of lines as newline delimited JSON.
+type httpBulkSink struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func newHTTPBulkSink(config AccessLogSinkConfig) (*httpBulkSink, error) {
+	if config.URL == "" {
+		return nil, errors.New("http access log sinks require a url")
+	}
+	url, err := ReadFromEnvOrConfig(config.URL)
+	if err != nil {
+		return nil, err
+	}
+	s := &httpBulkSink{
+		url:     url,
+		headers: make(map[string]string, len(config.Headers)),
+		client:  &http.Client{Timeout: accessLogSinkTimeout},
+	}
+	for name, value := range config.Headers {
+		value, err := ReadFromEnvOrConfig(value)
+		if err != nil {
+			return nil, err
+		}
+		s.headers[name] = value
+	}
+	return s, nil
+}
+
+func (s *httpBulkSink) write(ctx context.Context, lines [][]byte) error {
+	var body bytes.Buffer
+	for _, line := range lines {
+		body.Write(line)
+		body.WriteByte('\n')
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", s.url, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	for name, value := range s.headers {
+		req.Header.Set(name, value)
+	}
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status code %d", res.StatusCode)
+	}
+	return nil
+}
+
+func (s *httpBulkSink) close() error {
+	return nil
+}
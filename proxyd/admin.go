@@ -0,0 +1,633 @@
+package proxyd
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/gorilla/mux"
+)
+
+const (
+	maxAdminBodySize = 1024 * 1024
+	defaultAdminHost = "127.0.0.1"
+)
+
+// AdminListenAndServe serves the admin API, used by operators to inspect and
+// manage the running proxyd. Requests must carry token as a bearer token. The
+// API only listens on localhost if host is empty.
+func (s *Server) AdminListenAndServe(host string, port int, token string) error {
+	if token == "" {
+		return errors.New("the admin server requires a token")
+	}
+	if host == "" {
+		host = defaultAdminHost
+	}
+	s.srvMu.Lock()
+	hdlr := mux.NewRouter()
+	hdlr.HandleFunc("/traffic_profile", s.HandleTrafficProfile).Methods("GET")
+	hdlr.HandleFunc("/config/lint", s.HandleConfigLint).Methods("POST")
+	hdlr.HandleFunc("/method_mappings/suggestions", s.HandleMethodMappingSuggestions).Methods("GET")
+	hdlr.HandleFunc("/cache/purge", s.HandleCachePurge).Methods("POST")
+	hdlr.HandleFunc("/cache/inspect", s.HandleCacheInspect).Methods("POST")
+	hdlr.HandleFunc("/cache/stats", s.HandleCacheStats).Methods("GET")
+	hdlr.HandleFunc("/gameday/outages", s.HandleListOutages).Methods("GET")
+	hdlr.HandleFunc("/gameday/outages", s.HandleSimulateOutage).Methods("POST")
+	hdlr.HandleFunc("/gameday/outages", s.HandleEndOutages).Methods("DELETE")
+	hdlr.HandleFunc("/api_keys", s.HandleListAPIKeys).Methods("GET")
+	hdlr.HandleFunc("/api_keys", s.HandleCreateAPIKey).Methods("POST")
+	hdlr.HandleFunc("/api_keys/{id}", s.HandleGetAPIKey).Methods("GET")
+	hdlr.HandleFunc("/api_keys/{id}", s.HandleRevokeAPIKey).Methods("DELETE")
+	hdlr.HandleFunc("/api_keys/{id}/expire", s.HandleExpireAPIKey).Methods("POST")
+	hdlr.HandleFunc("/api_keys/{id}/rotate", s.HandleRotateAPIKey).Methods("POST")
+	hdlr.HandleFunc("/abuse/bans", s.HandleListAbuseBans).Methods("GET")
+	hdlr.HandleFunc("/abuse/bans", s.HandleAbuseBan).Methods("POST")
+	hdlr.HandleFunc("/abuse/bans/{client}", s.HandleAbuseUnban).Methods("DELETE")
+	hdlr.HandleFunc("/auth_keys/{alias}/usage", s.HandleAuthKeyUsage).Methods("GET")
+	addr := fmt.Sprintf("%s:%d", host, port)
+	s.adminServer = &http.Server{
+		Handler: adminAuthHdlr(token, hdlr),
+		Addr:    addr,
+	}
+	log.Info("starting admin server", "addr", addr)
+	s.srvMu.Unlock()
+	return s.adminServer.ListenAndServe()
+}
+
+func adminAuthHdlr(token string, h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		expected := []byte("Bearer " + token)
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			RecordAuditEvent(AuditEventAuthFailure, "reason", "admin_token", "remote_addr", r.RemoteAddr, "path", r.URL.Path)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.Method == "GET" || r.Method == "HEAD" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		sw := &adminStatusWriter{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(sw, r)
+		RecordAuditEvent(AuditEventAdminAction,
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", strconv.Itoa(sw.status),
+			"remote_addr", r.RemoteAddr)
+	}
+}
+
+// adminStatusWriter records the status of the responses to the admin
+// actions audited.
+type adminStatusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *adminStatusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// HandleTrafficProfile responds with the recent traffic profile recorded by
+// metering.
+func (s *Server) HandleTrafficProfile(w http.ResponseWriter, r *http.Request) {
+	if s.trafficRecorder == nil {
+		http.Error(w, "metering is not enabled", http.StatusNotFound)
+		return
+	}
+	writeAdminJSON(w, s.trafficRecorder.Profile())
+}
+
+// HandleConfigLint lints the proposed TOML config in the request body against
+// the running config and the recent traffic profile.
+func (s *Server) HandleConfigLint(w http.ResponseWriter, r *http.Request) {
+	if s.trafficRecorder == nil {
+		http.Error(w, "metering is not enabled", http.StatusNotFound)
+		return
+	}
+
+	body, err := io.ReadAll(LimitReader(r.Body, maxAdminBodySize))
+	if err != nil {
+		http.Error(w, "error reading config", http.StatusBadRequest)
+		return
+	}
+	proposed := new(Config)
+	if _, err := toml.Decode(string(body), proposed); err != nil {
+		http.Error(w, fmt.Sprintf("error parsing config: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	routing := s.routing.Load()
+	current := &Config{
+		RPCMethodMappings: routing.rpcMethodMappings,
+		RateLimit:         routing.rateLimitConfig,
+	}
+	report, err := LintConfig(current, proposed, s.trafficRecorder.Profile())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error linting config: %s", err), http.StatusBadRequest)
+		return
+	}
+	writeAdminJSON(w, report)
+}
+
+// HandleMethodMappingSuggestions responds with suggested mappings for the
+// unmapped methods requested in the recent traffic profile. Methods with fewer
+// than the min_requests query parameter estimated requests are omitted.
+func (s *Server) HandleMethodMappingSuggestions(w http.ResponseWriter, r *http.Request) {
+	if s.trafficRecorder == nil {
+		http.Error(w, "metering is not enabled", http.StatusNotFound)
+		return
+	}
+
+	var minRequests float64
+	if v := r.URL.Query().Get("min_requests"); v != "" {
+		var err error
+		if minRequests, err = strconv.ParseFloat(v, 64); err != nil {
+			http.Error(w, "invalid min_requests", http.StatusBadRequest)
+			return
+		}
+	}
+	routing := s.routing.Load()
+	writeAdminJSON(w, SuggestMethodMappings(routing.rpcMethodMappings, s.trafficRecorder.Profile(), minRequests))
+}
+
+// AdminCachePurgeRequest selects the cached responses to purge: those of a
+// single request, of all requests of a method, or all of them if neither is
+// set.
+type AdminCachePurgeRequest struct {
+	Method  string  `json:"method"`
+	Request *RPCReq `json:"request"`
+}
+
+type AdminCachePurgeResponse struct {
+	Purged int `json:"purged"`
+}
+
+// HandleCachePurge purges the RPC cache as selected by the request body.
+func (s *Server) HandleCachePurge(w http.ResponseWriter, r *http.Request) {
+	if !s.cacheEnabled() {
+		http.Error(w, "cache is not enabled", http.StatusNotFound)
+		return
+	}
+
+	body, err := io.ReadAll(LimitReader(r.Body, maxAdminBodySize))
+	if err != nil {
+		http.Error(w, "error reading request", http.StatusBadRequest)
+		return
+	}
+	purge := new(AdminCachePurgeRequest)
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, purge); err != nil {
+			http.Error(w, fmt.Sprintf("error parsing request: %s", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var purged int
+	if purge.Request != nil {
+		compactParams(purge.Request)
+		var deleted bool
+		deleted, err = s.cache.DeleteRPC(r.Context(), purge.Request)
+		if deleted {
+			purged = 1
+		}
+	} else {
+		purged, err = s.cache.PurgeRPC(r.Context(), purge.Method)
+	}
+	if errors.Is(err, ErrMethodNotCached) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if errors.Is(err, ErrCachePurgeNotSupported) {
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+		return
+	} else if err != nil {
+		log.Error("error purging cache", "method", purge.Method, "purged", purged, "err", err)
+		http.Error(w, fmt.Sprintf("error purging cache: %s", err), http.StatusInternalServerError)
+		return
+	}
+	log.Info("purged cache", "method", purge.Method, "single", purge.Request != nil, "purged", purged)
+	writeAdminJSON(w, &AdminCachePurgeResponse{Purged: purged})
+}
+
+// HandleCacheInspect responds with whether the JSON-RPC request in the request
+// body would be served from the cache, without recording the lookup.
+func (s *Server) HandleCacheInspect(w http.ResponseWriter, r *http.Request) {
+	if !s.cacheEnabled() {
+		http.Error(w, "cache is not enabled", http.StatusNotFound)
+		return
+	}
+
+	body, err := io.ReadAll(LimitReader(r.Body, maxAdminBodySize))
+	if err != nil {
+		http.Error(w, "error reading request", http.StatusBadRequest)
+		return
+	}
+	req, err := ParseRPCReq(body)
+	if err != nil {
+		http.Error(w, "error parsing request", http.StatusBadRequest)
+		return
+	}
+	compactParams(req)
+	inspection, err := s.cache.InspectRPC(r.Context(), req)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error reading cache: %s", err), http.StatusInternalServerError)
+		return
+	}
+	writeAdminJSON(w, inspection)
+}
+
+// HandleCacheStats responds with the hits and misses of each cached method,
+// and the size of in-memory caches.
+func (s *Server) HandleCacheStats(w http.ResponseWriter, r *http.Request) {
+	if !s.cacheEnabled() {
+		http.Error(w, "cache is not enabled", http.StatusNotFound)
+		return
+	}
+	writeAdminJSON(w, s.cache.Stats())
+}
+
+// maxSimulatedOutage bounds simulated outages, so that a forgotten game day
+// doesn't take backends out of service indefinitely.
+const maxSimulatedOutage = time.Hour
+
+// AdminOutageRequest selects the backends of a simulated outage: a single
+// backend, or all backends of a group. Duration is a Go duration string.
+type AdminOutageRequest struct {
+	Backend  string `json:"backend"`
+	Group    string `json:"group"`
+	Duration string `json:"duration"`
+}
+
+type AdminOutage struct {
+	Backend string    `json:"backend"`
+	Until   time.Time `json:"until"`
+}
+
+// HandleListOutages responds with the ongoing simulated outages.
+func (s *Server) HandleListOutages(w http.ResponseWriter, r *http.Request) {
+	writeAdminJSON(w, s.simulatedOutages())
+}
+
+// HandleSimulateOutage makes the selected backends reject traffic as if they
+// were offline for the requested duration, so that operators can rehearse
+// failovers with real traffic. Health probes still run. It responds with the
+// ongoing simulated outages.
+func (s *Server) HandleSimulateOutage(w http.ResponseWriter, r *http.Request) {
+	req, backends, ok := s.readOutageRequest(w, r)
+	if !ok {
+		return
+	}
+	if len(backends) == 0 {
+		http.Error(w, "backend or group is required", http.StatusBadRequest)
+		return
+	}
+	duration, err := time.ParseDuration(req.Duration)
+	if err != nil || duration <= 0 || duration > maxSimulatedOutage {
+		http.Error(w, fmt.Sprintf("duration must be positive and at most %s", maxSimulatedOutage), http.StatusBadRequest)
+		return
+	}
+
+	until := time.Now().Add(duration)
+	for _, back := range backends {
+		back.SimulateOutage(until)
+		log.Warn("simulating backend outage", "name", back.Name, "until", until)
+	}
+	writeAdminJSON(w, s.simulatedOutages())
+}
+
+// HandleEndOutages ends the simulated outages of the selected backends, or all
+// of them given an empty body. It responds with the ongoing simulated outages.
+func (s *Server) HandleEndOutages(w http.ResponseWriter, r *http.Request) {
+	_, backends, ok := s.readOutageRequest(w, r)
+	if !ok {
+		return
+	}
+	if len(backends) == 0 {
+		backends = s.allBackends()
+	}
+	for _, back := range backends {
+		if back.InSimulatedOutage() {
+			back.SimulateOutage(time.Time{})
+			log.Warn("ended simulated backend outage", "name", back.Name)
+		}
+	}
+	writeAdminJSON(w, s.simulatedOutages())
+}
+
+func (s *Server) readOutageRequest(w http.ResponseWriter, r *http.Request) (*AdminOutageRequest, []*Backend, bool) {
+	body, err := io.ReadAll(LimitReader(r.Body, maxAdminBodySize))
+	if err != nil {
+		http.Error(w, "error reading request", http.StatusBadRequest)
+		return nil, nil, false
+	}
+	req := new(AdminOutageRequest)
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, req); err != nil {
+			http.Error(w, fmt.Sprintf("error parsing request: %s", err), http.StatusBadRequest)
+			return nil, nil, false
+		}
+	}
+
+	var backends []*Backend
+	switch {
+	case req.Backend != "" && req.Group != "":
+		http.Error(w, "only one of backend and group can be set", http.StatusBadRequest)
+		return nil, nil, false
+	case req.Backend != "":
+		for _, back := range s.allBackends() {
+			if back.Name == req.Backend {
+				backends = append(backends, back)
+			}
+		}
+		if len(backends) == 0 {
+			http.Error(w, fmt.Sprintf("unknown backend %s", req.Backend), http.StatusNotFound)
+			return nil, nil, false
+		}
+	case req.Group != "":
+		bg := s.BackendGroups[req.Group]
+		if bg == nil {
+			http.Error(w, fmt.Sprintf("unknown backend group %s", req.Group), http.StatusNotFound)
+			return nil, nil, false
+		}
+		backends = bg.Backends
+	}
+	return req, backends, true
+}
+
+// allBackends returns the backends of all groups, sorted by name.
+func (s *Server) allBackends() []*Backend {
+	seen := make(map[*Backend]bool)
+	var backends []*Backend
+	for _, bg := range s.BackendGroups {
+		for _, back := range bg.Backends {
+			if !seen[back] {
+				seen[back] = true
+				backends = append(backends, back)
+			}
+		}
+	}
+	sort.Slice(backends, func(i, j int) bool {
+		return backends[i].Name < backends[j].Name
+	})
+	return backends
+}
+
+func (s *Server) simulatedOutages() []*AdminOutage {
+	outages := make([]*AdminOutage, 0)
+	for _, back := range s.allBackends() {
+		if until := back.SimulatedOutageUntil(); !until.IsZero() {
+			outages = append(outages, &AdminOutage{Backend: back.Name, Until: until})
+		}
+	}
+	return outages
+}
+
+// AdminAPIKeyRequest creates, expires or rotates an API key. ExpiresAt and
+// TTL, a Go duration string, set when the key expires; neither being set
+// means it never does. Grace, a Go duration string, is how long the replaced
+// secret of a rotated key remains valid.
+type AdminAPIKeyRequest struct {
+	Alias     string     `json:"alias"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	TTL       string     `json:"ttl"`
+	Grace     string     `json:"grace"`
+}
+
+// AdminAPIKeyResponse is an API key, with its secret once created or rotated.
+type AdminAPIKeyResponse struct {
+	*APIKey
+	Secret string `json:"secret,omitempty"`
+}
+
+// HandleListAPIKeys responds with the API keys, without their secrets.
+func (s *Server) HandleListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	if s.apiKeys == nil {
+		http.Error(w, "api keys are not enabled", http.StatusNotFound)
+		return
+	}
+	keys, err := s.apiKeys.List(r.Context())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error listing api keys: %s", err), http.StatusInternalServerError)
+		return
+	}
+	writeAdminJSON(w, keys)
+}
+
+// HandleGetAPIKey responds with the API key of the id path variable.
+func (s *Server) HandleGetAPIKey(w http.ResponseWriter, r *http.Request) {
+	if s.apiKeys == nil {
+		http.Error(w, "api keys are not enabled", http.StatusNotFound)
+		return
+	}
+	key, err := s.apiKeys.Get(r.Context(), mux.Vars(r)["id"])
+	s.writeAPIKeyResponse(w, r, "", key, "", err)
+}
+
+// HandleCreateAPIKey creates an API key for the alias of the request, and
+// responds with it and its secret.
+func (s *Server) HandleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	req, expiresAt, ok := s.readAPIKeyRequest(w, r)
+	if !ok {
+		return
+	}
+	if req.Alias == "" {
+		http.Error(w, "alias is required", http.StatusBadRequest)
+		return
+	}
+	key, secret, err := s.apiKeys.Create(r.Context(), req.Alias, expiresAt)
+	s.writeAPIKeyResponse(w, r, "create", key, secret, err)
+}
+
+// HandleRevokeAPIKey revokes the API key of the id path variable.
+func (s *Server) HandleRevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	if s.apiKeys == nil {
+		http.Error(w, "api keys are not enabled", http.StatusNotFound)
+		return
+	}
+	key, err := s.apiKeys.Revoke(r.Context(), mux.Vars(r)["id"])
+	s.writeAPIKeyResponse(w, r, "revoke", key, "", err)
+}
+
+// HandleExpireAPIKey sets when the API key of the id path variable expires.
+func (s *Server) HandleExpireAPIKey(w http.ResponseWriter, r *http.Request) {
+	_, expiresAt, ok := s.readAPIKeyRequest(w, r)
+	if !ok {
+		return
+	}
+	key, err := s.apiKeys.Expire(r.Context(), mux.Vars(r)["id"], expiresAt)
+	s.writeAPIKeyResponse(w, r, "expire", key, "", err)
+}
+
+// HandleRotateAPIKey replaces the secret of the API key of the id path
+// variable, and responds with the key and its new secret. The replaced
+// secret remains valid for the grace of the request.
+func (s *Server) HandleRotateAPIKey(w http.ResponseWriter, r *http.Request) {
+	req, _, ok := s.readAPIKeyRequest(w, r)
+	if !ok {
+		return
+	}
+	var grace time.Duration
+	if req.Grace != "" {
+		var err error
+		if grace, err = time.ParseDuration(req.Grace); err != nil || grace < 0 {
+			http.Error(w, "invalid grace", http.StatusBadRequest)
+			return
+		}
+	}
+	key, secret, err := s.apiKeys.Rotate(r.Context(), mux.Vars(r)["id"], grace)
+	s.writeAPIKeyResponse(w, r, "rotate", key, secret, err)
+}
+
+func (s *Server) readAPIKeyRequest(w http.ResponseWriter, r *http.Request) (*AdminAPIKeyRequest, *time.Time, bool) {
+	if s.apiKeys == nil {
+		http.Error(w, "api keys are not enabled", http.StatusNotFound)
+		return nil, nil, false
+	}
+	body, err := io.ReadAll(LimitReader(r.Body, maxAdminBodySize))
+	if err != nil {
+		http.Error(w, "error reading request", http.StatusBadRequest)
+		return nil, nil, false
+	}
+	req := new(AdminAPIKeyRequest)
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, req); err != nil {
+			http.Error(w, fmt.Sprintf("error parsing request: %s", err), http.StatusBadRequest)
+			return nil, nil, false
+		}
+	}
+
+	expiresAt := req.ExpiresAt
+	if req.TTL != "" {
+		if expiresAt != nil {
+			http.Error(w, "only one of expires_at and ttl can be set", http.StatusBadRequest)
+			return nil, nil, false
+		}
+		ttl, err := time.ParseDuration(req.TTL)
+		if err != nil || ttl <= 0 {
+			http.Error(w, "invalid ttl", http.StatusBadRequest)
+			return nil, nil, false
+		}
+		at := time.Now().Add(ttl).UTC()
+		expiresAt = &at
+	}
+	return req, expiresAt, true
+}
+
+// writeAPIKeyResponse responds with key and its secret, if set, or with err.
+// Changes made by action, if set, are logged for auditing.
+func (s *Server) writeAPIKeyResponse(w http.ResponseWriter, r *http.Request, action string, key *APIKey, secret string, err error) {
+	if errors.Is(err, ErrAPIKeyNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if errors.Is(err, ErrAPIKeyRevoked) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Error("error managing api key", "action", action, "id", mux.Vars(r)["id"], "err", err)
+		http.Error(w, fmt.Sprintf("error managing api key: %s", err), http.StatusInternalServerError)
+		return
+	}
+	if action != "" {
+		log.Info("api key changed",
+			"action", action,
+			"id", key.ID,
+			"alias", key.Alias,
+			"expires_at", key.ExpiresAt,
+			"previous_valid_until", key.PreviousValidUntil,
+			"admin_addr", r.RemoteAddr)
+	}
+	writeAdminJSON(w, &AdminAPIKeyResponse{APIKey: key, Secret: secret})
+}
+
+// compactParams strips insignificant whitespace from the params of req, as
+// cache keys are derived from params as sent by clients, which rarely indent.
+func compactParams(req *RPCReq) {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, req.Params); err == nil {
+		req.Params = buf.Bytes()
+	}
+}
+
+func (s *Server) cacheEnabled() bool {
+	_, noop := s.cache.(*NoopRPCCache)
+	return !noop
+}
+
+// AdminAbuseBanRequest bans a client, ip:<ip> or key:<alias>, for Duration.
+type AdminAbuseBanRequest struct {
+	Client string `json:"client"`
+	// Action is ban, the default, or rate_limit.
+	Action   string `json:"action"`
+	Duration string `json:"duration"`
+}
+
+// HandleListAbuseBans responds with the ongoing bans of abusive clients.
+func (s *Server) HandleListAbuseBans(w http.ResponseWriter, r *http.Request) {
+	if s.abuse == nil {
+		http.Error(w, "abuse detection is not enabled", http.StatusNotFound)
+		return
+	}
+	writeAdminJSON(w, s.abuse.Bans())
+}
+
+// HandleAbuseBan bans the client of the request, and responds with the ban.
+func (s *Server) HandleAbuseBan(w http.ResponseWriter, r *http.Request) {
+	if s.abuse == nil {
+		http.Error(w, "abuse detection is not enabled", http.StatusNotFound)
+		return
+	}
+	body, err := io.ReadAll(LimitReader(r.Body, maxAdminBodySize))
+	if err != nil {
+		http.Error(w, "error reading request", http.StatusBadRequest)
+		return
+	}
+	req := new(AdminAbuseBanRequest)
+	if err := json.Unmarshal(body, req); err != nil {
+		http.Error(w, fmt.Sprintf("error parsing request: %s", err), http.StatusBadRequest)
+		return
+	}
+	duration, err := time.ParseDuration(req.Duration)
+	if err != nil || duration <= 0 {
+		http.Error(w, "duration must be positive", http.StatusBadRequest)
+		return
+	}
+	ban, err := s.abuse.Ban(req.Client, req.Action, duration)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Warn("client banned by admin", "client", ban.Client, "action", ban.Action, "until", ban.Until, "admin_addr", r.RemoteAddr)
+	writeAdminJSON(w, ban)
+}
+
+// HandleAbuseUnban lifts the ban of the client path variable, whether
+// applied automatically or by an admin.
+func (s *Server) HandleAbuseUnban(w http.ResponseWriter, r *http.Request) {
+	if s.abuse == nil {
+		http.Error(w, "abuse detection is not enabled", http.StatusNotFound)
+		return
+	}
+	client := mux.Vars(r)["client"]
+	if err := s.abuse.Unban(client); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	log.Warn("client unbanned by admin", "client", client, "admin_addr", r.RemoteAddr)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeAdminJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("content-type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Error("error writing admin response", "err", err)
+	}
+}
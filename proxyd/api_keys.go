@@ -0,0 +1,326 @@
+package proxyd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultAPIKeyCacheTTL = 10 * time.Second
+
+	// maxAPIKeyCacheEntries bounds the lookups cached by an instance, which
+	// include those of invalid secrets.
+	maxAPIKeyCacheEntries = 100_000
+)
+
+var (
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	ErrAPIKeyRevoked  = errors.New("api key is revoked")
+)
+
+// APIKey is an auth key managed at runtime through the admin API. Its secret
+// is only returned once, when created or rotated.
+type APIKey struct {
+	ID        string     `json:"id"`
+	Alias     string     `json:"alias"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	RotatedAt *time.Time `json:"rotated_at,omitempty"`
+	// PreviousValidUntil is the end of the window during which the secret
+	// replaced by the last rotation remains valid.
+	PreviousValidUntil *time.Time `json:"previous_valid_until,omitempty"`
+}
+
+// apiKeyRecord is an APIKey as stored, with the hashes of its secrets.
+type apiKeyRecord struct {
+	APIKey
+	SecretHash         string `json:"secret_hash"`
+	PreviousSecretHash string `json:"previous_secret_hash,omitempty"`
+}
+
+// aliasFor returns the alias authenticated by the secret hashing to hash at
+// now, if any.
+func (k *apiKeyRecord) aliasFor(hash string, now time.Time) (string, time.Time, bool) {
+	validUntil := time.Time{}
+	if k.RevokedAt != nil {
+		return "", validUntil, false
+	}
+	if k.ExpiresAt != nil {
+		if !now.Before(*k.ExpiresAt) {
+			return "", validUntil, false
+		}
+		validUntil = *k.ExpiresAt
+	}
+	switch {
+	case hash == k.SecretHash:
+		return k.Alias, validUntil, true
+	case hash == k.PreviousSecretHash && k.PreviousValidUntil != nil && now.Before(*k.PreviousValidUntil):
+		if validUntil.IsZero() || k.PreviousValidUntil.Before(validUntil) {
+			validUntil = *k.PreviousValidUntil
+		}
+		return k.Alias, validUntil, true
+	}
+	return "", validUntil, false
+}
+
+type apiKeyLookup struct {
+	alias string
+	until time.Time
+}
+
+// APIKeyStore keeps the auth keys managed at runtime in Redis, shared by
+// proxyd instances. Secrets are stored hashed. Lookups are cached for
+// cacheTTL, so changes made through other instances apply within it.
+type APIKeyStore struct {
+	r         redis.UniversalClient
+	namespace string
+	cacheTTL  time.Duration
+
+	mtx   sync.Mutex
+	cache map[string]apiKeyLookup
+}
+
+func NewAPIKeyStore(r redis.UniversalClient, namespace string, config APIKeysConfig) *APIKeyStore {
+	cacheTTL := defaultAPIKeyCacheTTL
+	if config.CacheTTL != 0 {
+		cacheTTL = time.Duration(config.CacheTTL)
+	}
+	return &APIKeyStore{
+		r:         r,
+		namespace: namespace,
+		cacheTTL:  cacheTTL,
+		cache:     make(map[string]apiKeyLookup),
+	}
+}
+
+func (s *APIKeyStore) key(name string) string {
+	if s.namespace != "" {
+		return s.namespace + ":" + name
+	}
+	return name
+}
+
+func (s *APIKeyStore) keysKey() string {
+	return s.key("api_keys")
+}
+
+func (s *APIKeyStore) secretsKey() string {
+	return s.key("api_key_secrets")
+}
+
+func hashAPIKeySecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Lookup returns the alias secret authenticates, or an empty alias if it
+// doesn't authenticate any.
+func (s *APIKeyStore) Lookup(ctx context.Context, secret string) (string, error) {
+	hash := hashAPIKeySecret(secret)
+	now := time.Now()
+	s.mtx.Lock()
+	cached, ok := s.cache[hash]
+	s.mtx.Unlock()
+	if ok && now.Before(cached.until) {
+		return cached.alias, nil
+	}
+
+	alias := ""
+	until := now.Add(s.cacheTTL)
+	record, err := s.recordBySecret(ctx, hash)
+	if err != nil && !errors.Is(err, ErrAPIKeyNotFound) {
+		return "", err
+	}
+	if record != nil {
+		var validUntil time.Time
+		var valid bool
+		if alias, validUntil, valid = record.aliasFor(hash, now); valid && !validUntil.IsZero() && validUntil.Before(until) {
+			until = validUntil
+		}
+	}
+
+	s.mtx.Lock()
+	if len(s.cache) >= maxAPIKeyCacheEntries {
+		s.cache = make(map[string]apiKeyLookup)
+	}
+	s.cache[hash] = apiKeyLookup{alias: alias, until: until}
+	s.mtx.Unlock()
+	return alias, nil
+}
+
+func (s *APIKeyStore) recordBySecret(ctx context.Context, hash string) (*apiKeyRecord, error) {
+	id, err := s.r.HGet(ctx, s.secretsKey(), hash).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrAPIKeyNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return s.record(ctx, id)
+}
+
+func (s *APIKeyStore) record(ctx context.Context, id string) (*apiKeyRecord, error) {
+	data, err := s.r.HGet(ctx, s.keysKey(), id).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrAPIKeyNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	record := new(apiKeyRecord)
+	if err := json.Unmarshal([]byte(data), record); err != nil {
+		return nil, fmt.Errorf("invalid api key %s: %w", id, err)
+	}
+	return record, nil
+}
+
+// save stores record, along with the secret hashing to newHash if set, and
+// drops the secrets hashing to dropped.
+func (s *APIKeyStore) save(ctx context.Context, record *apiKeyRecord, newHash string, dropped ...string) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = s.r.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, s.keysKey(), record.ID, data)
+		if newHash != "" {
+			pipe.HSet(ctx, s.secretsKey(), newHash, record.ID)
+		}
+		if len(dropped) > 0 {
+			pipe.HDel(ctx, s.secretsKey(), dropped...)
+		}
+		return nil
+	})
+	s.flushCache()
+	return err
+}
+
+// flushCache drops the cached lookups, so that changes made through this
+// instance apply immediately.
+func (s *APIKeyStore) flushCache() {
+	s.mtx.Lock()
+	s.cache = make(map[string]apiKeyLookup)
+	s.mtx.Unlock()
+}
+
+// Create creates a key for alias, expiring at expiresAt if set, and returns
+// it with its secret.
+func (s *APIKeyStore) Create(ctx context.Context, alias string, expiresAt *time.Time) (*APIKey, string, error) {
+	secret := randStr(32)
+	record := &apiKeyRecord{
+		APIKey: APIKey{
+			ID:        randStr(8),
+			Alias:     alias,
+			CreatedAt: time.Now().UTC(),
+			ExpiresAt: expiresAt,
+		},
+		SecretHash: hashAPIKeySecret(secret),
+	}
+	if err := s.save(ctx, record, record.SecretHash); err != nil {
+		return nil, "", err
+	}
+	return &record.APIKey, secret, nil
+}
+
+// Get returns the key with id.
+func (s *APIKeyStore) Get(ctx context.Context, id string) (*APIKey, error) {
+	record, err := s.record(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return &record.APIKey, nil
+}
+
+// List returns all keys, revoked and expired ones included, by creation
+// time.
+func (s *APIKeyStore) List(ctx context.Context) ([]*APIKey, error) {
+	all, err := s.r.HGetAll(ctx, s.keysKey()).Result()
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]*APIKey, 0, len(all))
+	for id, data := range all {
+		record := new(apiKeyRecord)
+		if err := json.Unmarshal([]byte(data), record); err != nil {
+			return nil, fmt.Errorf("invalid api key %s: %w", id, err)
+		}
+		keys = append(keys, &record.APIKey)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+	return keys, nil
+}
+
+// Revoke revokes the key with id, and both of its secrets.
+func (s *APIKeyStore) Revoke(ctx context.Context, id string) (*APIKey, error) {
+	record, err := s.record(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if record.RevokedAt == nil {
+		now := time.Now().UTC()
+		record.RevokedAt = &now
+	}
+	if err := s.save(ctx, record, ""); err != nil {
+		return nil, err
+	}
+	return &record.APIKey, nil
+}
+
+// Expire sets the expiry of the key with id, or removes it if expiresAt is
+// nil.
+func (s *APIKeyStore) Expire(ctx context.Context, id string, expiresAt *time.Time) (*APIKey, error) {
+	record, err := s.record(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	record.ExpiresAt = expiresAt
+	if err := s.save(ctx, record, ""); err != nil {
+		return nil, err
+	}
+	return &record.APIKey, nil
+}
+
+// Rotate replaces the secret of the key with id, and returns the key with
+// its new secret. The replaced secret remains valid for grace, so that
+// clients can switch to the new one.
+func (s *APIKeyStore) Rotate(ctx context.Context, id string, grace time.Duration) (*APIKey, string, error) {
+	record, err := s.record(ctx, id)
+	if err != nil {
+		return nil, "", err
+	}
+	if record.RevokedAt != nil {
+		return nil, "", ErrAPIKeyRevoked
+	}
+	secret := randStr(32)
+	// a secret still valid from an earlier rotation is dropped
+	var dropped []string
+	if record.PreviousSecretHash != "" {
+		dropped = append(dropped, record.PreviousSecretHash)
+	}
+	now := time.Now().UTC()
+	record.PreviousSecretHash = ""
+	record.PreviousValidUntil = nil
+	if grace > 0 {
+		validUntil := now.Add(grace)
+		record.PreviousSecretHash = record.SecretHash
+		record.PreviousValidUntil = &validUntil
+	} else {
+		dropped = append(dropped, record.SecretHash)
+	}
+	record.SecretHash = hashAPIKeySecret(secret)
+	record.RotatedAt = &now
+	if err := s.save(ctx, record, record.SecretHash, dropped...); err != nil {
+		return nil, "", err
+	}
+	return &record.APIKey, secret, nil
+}
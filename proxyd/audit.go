@@ -0,0 +1,253 @@
+package proxyd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	AuditEventAuthFailure  = "auth_failure"
+	AuditEventClientBan    = "client_ban"
+	AuditEventClientUnban  = "client_unban"
+	AuditEventBackendBan   = "backend_ban"
+	AuditEventBackendUnban = "backend_unban"
+	AuditEventConfigReload = "config_reload"
+	AuditEventAdminAction  = "admin_action"
+
+	defaultAuditFlushInterval = time.Second
+	defaultAuditBatchSize     = 100
+	defaultAuditBufferSize    = 10_000
+	auditWebhookTimeout       = 10 * time.Second
+	auditWebhookAttempts      = 3
+)
+
+// auditLog receives the audit events recorded by RecordAuditEvent, if set.
+var auditLog atomic.Pointer[AuditLog]
+
+// AuditEvent is an administrative or policy relevant event, written to the
+// audit log as a JSON line.
+type AuditEvent struct {
+	Time   time.Time         `json:"time"`
+	Event  string            `json:"event"`
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// RecordAuditEvent records event to the audit log, if enabled, with fields
+// given as key value pairs.
+func RecordAuditEvent(event string, kv ...string) {
+	a := auditLog.Load()
+	if a == nil {
+		return
+	}
+	e := &AuditEvent{
+		Time:   time.Now().UTC(),
+		Event:  event,
+		Fields: make(map[string]string, len(kv)/2),
+	}
+	for i := 0; i+1 < len(kv); i += 2 {
+		if kv[i+1] != "" {
+			e.Fields[kv[i]] = kv[i+1]
+		}
+	}
+	a.Record(e)
+}
+
+// AuditLog appends audit events to a file and posts them in batches to a
+// webhook. Events are written in the background; those recorded while the
+// buffer is full are dropped rather than holding up requests.
+type AuditLog struct {
+	file           *os.File
+	webhookURL     string
+	webhookHeaders map[string]string
+	client         *http.Client
+	flushInterval  time.Duration
+	batchSize      int
+
+	events   chan *AuditEvent
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func NewAuditLog(config AuditLogConfig) (*AuditLog, error) {
+	if !config.Enabled {
+		return nil, nil
+	}
+	if config.File == "" && config.WebhookURL == "" {
+		return nil, errors.New("audit_log requires a file or a webhook_url")
+	}
+	a := &AuditLog{
+		client:         &http.Client{Timeout: auditWebhookTimeout},
+		webhookHeaders: make(map[string]string, len(config.WebhookHeaders)),
+		flushInterval:  defaultAuditFlushInterval,
+		batchSize:      defaultAuditBatchSize,
+		stop:           make(chan struct{}),
+		done:           make(chan struct{}),
+	}
+	if config.FlushInterval != 0 {
+		a.flushInterval = time.Duration(config.FlushInterval)
+	}
+	if config.BatchSize != 0 {
+		a.batchSize = config.BatchSize
+	}
+	bufferSize := defaultAuditBufferSize
+	if config.BufferSize != 0 {
+		bufferSize = config.BufferSize
+	}
+	a.events = make(chan *AuditEvent, bufferSize)
+	if config.WebhookURL != "" {
+		url, err := ReadFromEnvOrConfig(config.WebhookURL)
+		if err != nil {
+			return nil, err
+		}
+		a.webhookURL = url
+		for name, value := range config.WebhookHeaders {
+			value, err := ReadFromEnvOrConfig(value)
+			if err != nil {
+				return nil, err
+			}
+			a.webhookHeaders[name] = value
+		}
+	}
+	if config.File != "" {
+		file, err := os.OpenFile(config.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("error opening audit log: %w", err)
+		}
+		a.file = file
+	}
+	return a, nil
+}
+
+// Start writes the recorded events until Stop.
+func (a *AuditLog) Start() {
+	auditLog.Store(a)
+	go a.run()
+}
+
+// Stop writes the pending events, and closes the file.
+func (a *AuditLog) Stop() {
+	a.stopOnce.Do(func() {
+		auditLog.CompareAndSwap(a, nil)
+		close(a.stop)
+		<-a.done
+	})
+}
+
+func (a *AuditLog) Record(e *AuditEvent) {
+	select {
+	case a.events <- e:
+		RecordAuditEventRecorded(e.Event, "queued")
+	default:
+		RecordAuditEventRecorded(e.Event, "dropped")
+	}
+}
+
+func (a *AuditLog) run() {
+	defer close(a.done)
+	ticker := time.NewTicker(a.flushInterval)
+	defer ticker.Stop()
+	var batch []*AuditEvent
+	add := func(e *AuditEvent) {
+		a.writeFile(e)
+		if a.webhookURL == "" {
+			return
+		}
+		if batch = append(batch, e); len(batch) >= a.batchSize {
+			a.post(batch)
+			batch = nil
+		}
+	}
+	for {
+		select {
+		case e := <-a.events:
+			add(e)
+		case <-ticker.C:
+			if len(batch) > 0 {
+				a.post(batch)
+				batch = nil
+			}
+		case <-a.stop:
+			for len(a.events) > 0 {
+				add(<-a.events)
+			}
+			if len(batch) > 0 {
+				a.post(batch)
+			}
+			if a.file != nil {
+				if err := a.file.Close(); err != nil {
+					log.Error("error closing audit log", "err", err)
+				}
+			}
+			return
+		}
+	}
+}
+
+func (a *AuditLog) writeFile(e *AuditEvent) {
+	if a.file == nil {
+		return
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		log.Error("error encoding audit event", "err", err)
+		return
+	}
+	if _, err := a.file.Write(append(line, '\n')); err != nil {
+		log.Error("error writing audit log", "err", err)
+		RecordAuditDeliveryError("file")
+	}
+}
+
+// post sends batch to the webhook as a JSON array, retrying failed attempts.
+func (a *AuditLog) post(batch []*AuditEvent) {
+	body, err := json.Marshal(batch)
+	if err != nil {
+		log.Error("error encoding audit events", "err", err)
+		return
+	}
+	for attempt := 1; ; attempt++ {
+		err = a.postOnce(body)
+		if err == nil {
+			return
+		}
+		if attempt == auditWebhookAttempts {
+			break
+		}
+		time.Sleep(time.Duration(attempt) * 500 * time.Millisecond)
+	}
+	log.Error("error posting audit events", "events", len(batch), "err", err)
+	RecordAuditDeliveryError("webhook")
+}
+
+func (a *AuditLog) postOnce(body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), auditWebhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", a.webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range a.webhookHeaders {
+		req.Header.Set(name, value)
+	}
+	res, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status code %d", res.StatusCode)
+	}
+	return nil
+}
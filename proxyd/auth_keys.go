@@ -0,0 +1,250 @@
+package proxyd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// authKeySustainedWindow is the window over which the rate limit of an auth
+// key is enforced when its burst is higher.
+const authKeySustainedWindow = 10 * time.Second
+
+// authKeyPolicy is the compiled AuthKeyConfig of an auth key alias.
+type authKeyPolicy struct {
+	allowedOrigins     []*regexp.Regexp
+	allowMissingOrigin bool
+	allowedNets        []*net.IPNet
+	allowCacheControl  bool
+	bypassCache        bool
+	rateLim            FrontendRateLimiter
+	maxBatchSize       int
+	allowedMethods     *methodPatterns
+	deniedMethods      *methodPatterns
+	allowEngineAPI     bool
+	quotas             []quota
+}
+
+func newAuthKeyPolicies(configs map[string]*AuthKeyConfig, limiterFactory limiterFactoryFunc) (map[string]*authKeyPolicy, error) {
+	policies := make(map[string]*authKeyPolicy, len(configs))
+	for alias, cfg := range configs {
+		policy := &authKeyPolicy{
+			allowMissingOrigin: cfg.AllowMissingOrigin,
+			allowCacheControl:  cfg.AllowCacheControl,
+			bypassCache:        cfg.BypassCache,
+			maxBatchSize:       cfg.MaxBatchSize,
+			allowEngineAPI:     cfg.AllowEngineAPI,
+		}
+		if cfg.MaxBatchSize > MaxBatchRPCCallsHardLimit {
+			policy.maxBatchSize = MaxBatchRPCCallsHardLimit
+		}
+		if cfg.AllowedMethods != nil {
+			policy.allowedMethods = newMethodPatterns(cfg.AllowedMethods)
+		}
+		if cfg.DeniedMethods != nil {
+			policy.deniedMethods = newMethodPatterns(cfg.DeniedMethods)
+		}
+		if cfg.RateLimit < 0 || cfg.Burst < 0 {
+			return nil, fmt.Errorf("negative rate limit of auth key %s", alias)
+		}
+		if cfg.RateLimit > 0 {
+			policy.rateLim = newDryRunFrontendRateLimiter(
+				newAuthKeyRateLimiter(alias, cfg.RateLimit, cfg.Burst, limiterFactory),
+				"auth_key:"+alias,
+				cfg.RateLimitDryRun,
+			)
+		} else if cfg.Burst > 0 {
+			return nil, fmt.Errorf("burst of auth key %s requires a rate_limit", alias)
+		}
+		quotaUnit := QuotaUnitRequests
+		switch cfg.QuotaUnit {
+		case "", QuotaUnitRequests:
+		case QuotaUnitComputeUnits:
+			quotaUnit = QuotaUnitComputeUnits
+		default:
+			return nil, fmt.Errorf("quota_unit of auth key %s must be %s or %s", alias, QuotaUnitRequests, QuotaUnitComputeUnits)
+		}
+		if cfg.DailyQuota > 0 {
+			policy.quotas = append(policy.quotas, quota{QuotaPeriodDaily, quotaUnit, cfg.DailyQuota})
+		}
+		if cfg.MonthlyQuota > 0 {
+			policy.quotas = append(policy.quotas, quota{QuotaPeriodMonthly, quotaUnit, cfg.MonthlyQuota})
+		}
+		nets, err := parseCIDRs(cfg.AllowedCIDRs)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed CIDRs of auth key %s: %w", alias, err)
+		}
+		if len(nets) > 0 {
+			policy.allowedNets = nets
+		}
+		for _, origin := range cfg.AllowedOrigins {
+			pattern, err := regexp.Compile(origin)
+			if err != nil {
+				return nil, fmt.Errorf("invalid allowed origin %s of auth key %s: %w", origin, alias, err)
+			}
+			policy.allowedOrigins = append(policy.allowedOrigins, pattern)
+		}
+		policies[alias] = policy
+	}
+	return policies, nil
+}
+
+// checkOrigin returns whether r is allowed by the origin policy. If it isn't,
+// the returned reason is the header which failed the check.
+func (p *authKeyPolicy) checkOrigin(r *http.Request) (string, bool) {
+	if len(p.allowedOrigins) == 0 {
+		return "", true
+	}
+
+	if origin := r.Header.Get("Origin"); origin != "" {
+		return "origin", p.isAllowedOrigin(origin)
+	}
+	// browsers omit the origin of same-origin and some navigation requests,
+	// fall back to the origin of the referer
+	if referer := r.Header.Get("Referer"); referer != "" {
+		u, err := url.Parse(referer)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return "referer", false
+		}
+		return "referer", p.isAllowedOrigin(u.Scheme + "://" + u.Host)
+	}
+	return "missing", p.allowMissingOrigin
+}
+
+// allowsIP returns whether the key may be used from the client IP ip, which
+// must be the trusted address, not a client supplied header.
+func (p *authKeyPolicy) allowsIP(ip net.IP) bool {
+	if len(p.allowedNets) == 0 {
+		return true
+	}
+	return ip != nil && containsIP(p.allowedNets, ip)
+}
+
+func (p *authKeyPolicy) isAllowedOrigin(origin string) bool {
+	for _, pat := range p.allowedOrigins {
+		if pat.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheDirectives returns the cache directives of r made with the key.
+func (p *authKeyPolicy) cacheDirectives(r *http.Request) CacheDirectives {
+	var directives CacheDirectives
+	if p.allowCacheControl {
+		directives = ParseCacheDirectives(r.Header)
+	}
+	if p.bypassCache {
+		directives.NoCache = true
+	}
+	return directives
+}
+
+// allowsMethod returns whether the key may call method.
+func (p *authKeyPolicy) allowsMethod(method string) bool {
+	if p.deniedMethods != nil && p.deniedMethods.matches(method) {
+		return false
+	}
+	return p.allowedMethods == nil || p.allowedMethods.matches(method)
+}
+
+// wsMethodWhitelist returns the methods of whitelist the key may call, and
+// those it may not.
+func (p *authKeyPolicy) wsMethodWhitelist(whitelist *StringSet) (*StringSet, *StringSet) {
+	if p.allowedMethods == nil && p.deniedMethods == nil {
+		return whitelist, nil
+	}
+	allowed := NewStringSet()
+	denied := NewStringSet()
+	for _, method := range whitelist.Entries() {
+		if p.allowsMethod(method) {
+			allowed.Add(method)
+		} else {
+			denied.Add(method)
+		}
+	}
+	return allowed, denied
+}
+
+// methodPatterns match methods by name, or by prefix for patterns ending
+// with *, e.g. debug_*.
+type methodPatterns struct {
+	names    *StringSet
+	prefixes []string
+}
+
+func newMethodPatterns(patterns []string) *methodPatterns {
+	m := &methodPatterns{names: NewStringSet()}
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			m.prefixes = append(m.prefixes, prefix)
+		} else {
+			m.names.Add(pattern)
+		}
+	}
+	return m
+}
+
+func (m *methodPatterns) matches(method string) bool {
+	if m.names.Has(method) {
+		return true
+	}
+	for _, prefix := range m.prefixes {
+		if strings.HasPrefix(method, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// authKeyRateLimiter allows burst requests per second, and rate requests per
+// second on average over authKeySustainedWindow. Both limits are fixed
+// windows, as the other frontend rate limits.
+type authKeyRateLimiter struct {
+	burstLim     FrontendRateLimiter
+	sustainedLim FrontendRateLimiter
+}
+
+func newAuthKeyRateLimiter(alias string, rate, burst int, limiterFactory limiterFactoryFunc) FrontendRateLimiter {
+	prefix := "auth_key:" + alias
+	if burst <= rate {
+		return limiterFactory(time.Second, rate, prefix)
+	}
+	return &authKeyRateLimiter{
+		burstLim:     limiterFactory(time.Second, burst, prefix+":burst"),
+		sustainedLim: limiterFactory(authKeySustainedWindow, rate*int(authKeySustainedWindow/time.Second), prefix),
+	}
+}
+
+func (l *authKeyRateLimiter) Take(ctx context.Context, key string) (bool, error) {
+	ok, _, err := l.TakeStatus(ctx, key)
+	return ok, err
+}
+
+// TakeStatus reports the status of the limit which is exhausted first.
+func (l *authKeyRateLimiter) TakeStatus(ctx context.Context, key string) (bool, *RateLimitStatus, error) {
+	ok, burstStatus, err := takeRateLimit(ctx, l.burstLim, key)
+	if err != nil || !ok {
+		return ok, burstStatus, err
+	}
+	ok, status, err := takeRateLimit(ctx, l.sustainedLim, key)
+	if err == nil && ok && burstStatus != nil && status != nil && burstStatus.Remaining < status.Remaining {
+		status = burstStatus
+	}
+	return ok, status, err
+}
+
+// authKeyPolicy returns the policy of the auth key of ctx, if any.
+func (s *Server) authKeyPolicy(ctx context.Context) *authKeyPolicy {
+	alias, ok := ctx.Value(ContextKeyAuth).(string)
+	if !ok {
+		return nil
+	}
+	return s.authKeyPolicies[alias]
+}
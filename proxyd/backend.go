@@ -9,12 +9,14 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"math/big"
 	"math/rand"
 	"net/http"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	sw "github.com/ethereum-optimism/optimism/proxyd/pkg/avg-sliding-window"
@@ -24,7 +26,6 @@ import (
 	"github.com/gorilla/websocket"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/xaionaro-go/weightedshuffle"
-	"golang.org/x/sync/semaphore"
 )
 
 const (
@@ -63,6 +64,11 @@ var (
 		Message:       "backend is over capacity",
 		HTTPErrorCode: 429,
 	}
+	ErrServerOverloaded = &RPCErr{
+		Code:          JSONRPCErrorInternal - 25,
+		Message:       "server is overloaded",
+		HTTPErrorCode: 429,
+	}
 	ErrBackendBadResponse = &RPCErr{
 		Code:          JSONRPCErrorInternal - 13,
 		Message:       "backend returned an invalid response",
@@ -110,6 +116,12 @@ var (
 		HTTPErrorCode: 500,
 	}
 
+	ErrUpgradeRequired = &RPCErr{
+		Code:          JSONRPCErrorInternal - 22,
+		Message:       "polling limit exceeded, use a websocket subscription instead",
+		HTTPErrorCode: 426,
+	}
+
 	ErrBackendUnexpectedJSONRPC = errors.New("backend returned an unexpected JSON-RPC response")
 
 	ErrConsensusGetReceiptsCantBeBatched = errors.New("consensus_getReceipts cannot be batched")
@@ -132,6 +144,47 @@ func ErrInvalidParams(msg string) *RPCErr {
 	}
 }
 
+func ErrTooManyBlobs(have int, permitted int) *RPCErr {
+	return ErrInvalidParams(fmt.Sprintf("too many blobs in transaction: have %d, permitted %d", have, permitted))
+}
+
+func ErrBlobFeeCapTooLow(have *big.Int, min *big.Int) *RPCErr {
+	return ErrInvalidParams(fmt.Sprintf("max fee per blob gas too low: have %s, minimum %s", have, min))
+}
+
+func ErrTxChainIDNotAllowed(chainID *big.Int) *RPCErr {
+	return ErrInvalidParams(fmt.Sprintf("transaction chain id not allowed: %s", chainID))
+}
+
+func ErrTxGasLimitTooHigh(have uint64, max uint64) *RPCErr {
+	return ErrInvalidParams(fmt.Sprintf("transaction gas limit too high: have %d, maximum %d", have, max))
+}
+
+func ErrTxFeeCapTooLow(have *big.Int, min *big.Int) *RPCErr {
+	return ErrInvalidParams(fmt.Sprintf("max fee per gas too low: have %s, minimum %s", have, min))
+}
+
+// responseTooLargeGuidance tells clients how to narrow the queries of the log
+// query methods, whose responses grow with the block range.
+var responseTooLargeGuidance = map[string]string{
+	"eth_getLogs":       "query a smaller block range, or filter by address and topics",
+	"eth_getFilterLogs": "install a filter with a smaller block range, or filter by address and topics",
+}
+
+// ErrResponseTooLarge is returned to clients in place of
+// ErrBackendResponseTooLarge, with guidance for the log query methods.
+func ErrResponseTooLarge(method string) *RPCErr {
+	guidance, ok := responseTooLargeGuidance[method]
+	if !ok {
+		return ErrBackendResponseTooLarge
+	}
+	return &RPCErr{
+		Code:          ErrBackendResponseTooLarge.Code,
+		Message:       ErrBackendResponseTooLarge.Message + ", narrow your query: " + guidance,
+		HTTPErrorCode: ErrBackendResponseTooLarge.HTTPErrorCode,
+	}
+}
+
 type Backend struct {
 	Name                 string
 	rpcURL               string
@@ -144,11 +197,16 @@ type Backend struct {
 	dialer               *websocket.Dialer
 	maxRetries           int
 	maxResponseSize      int64
+	methodMaxRespSizes   map[string]int64
 	maxRPS               int
 	maxWSConns           int
+	wsConn               WSConnConfig
+	wsWriteTimeout       time.Duration
+	wsCompressionLevel   int
 	outOfServiceInterval time.Duration
 	stripTrailingXFF     bool
 	proxydIP             string
+	peer                 bool
 
 	skipPeerCountCheck bool
 	forcedCandidate    bool
@@ -157,11 +215,31 @@ type Backend struct {
 	maxLatencyThreshold         time.Duration
 	maxErrorRateThreshold       float64
 
+	healthWeights       HealthWeights
+	minHealthScore      float64
+	degradedHealthScore float64
+	blockLag            atomic.Uint64
+	maxBlockLag         atomic.Uint64
+
 	latencySlidingWindow         *sw.AvgSlidingWindow
 	networkRequestsSlidingWindow *sw.AvgSlidingWindow
 	networkErrorsSlidingWindow   *sw.AvgSlidingWindow
 
 	weight int
+
+	// simulatedOutageUntil is the unix nano time until which the backend
+	// rejects client traffic as if it were offline, see SimulateOutage.
+	simulatedOutageUntil atomic.Int64
+	// wsClients is the number of WS clients proxied to the backend.
+	wsClients atomic.Int64
+	// wsPool carries the requests of WS clients, if set.
+	wsPool *wsPool
+	// engineJWTSecret signs the tokens authenticating to the Engine API of
+	// the backend, if set.
+	engineJWTSecret []byte
+	// authMtx guards authPassword and headers, which rotate along with the
+	// secrets they're read from.
+	authMtx sync.RWMutex
 }
 
 type BackendOpt func(b *Backend)
@@ -179,6 +257,25 @@ func WithHeaders(headers map[string]string) BackendOpt {
 	}
 }
 
+// SetBasicAuthPassword replaces the basic auth password of the backend.
+func (b *Backend) SetBasicAuthPassword(password string) {
+	b.authMtx.Lock()
+	defer b.authMtx.Unlock()
+	b.authPassword = password
+}
+
+// SetHeader replaces the value of the header name sent to the backend.
+func (b *Backend) SetHeader(name, value string) {
+	b.authMtx.Lock()
+	defer b.authMtx.Unlock()
+	headers := make(map[string]string, len(b.headers))
+	for k, v := range b.headers {
+		headers[k] = v
+	}
+	headers[name] = value
+	b.headers = headers
+}
+
 func WithTimeout(timeout time.Duration) BackendOpt {
 	return func(b *Backend) {
 		b.client.Timeout = timeout
@@ -197,6 +294,14 @@ func WithMaxResponseSize(size int64) BackendOpt {
 	}
 }
 
+// WithMethodMaxResponseSizes overrides the max response size of specific
+// methods. Batches are limited by the largest size of their methods.
+func WithMethodMaxResponseSizes(sizes map[string]int64) BackendOpt {
+	return func(b *Backend) {
+		b.methodMaxRespSizes = sizes
+	}
+}
+
 func WithOutOfServiceDuration(interval time.Duration) BackendOpt {
 	return func(b *Backend) {
 		b.outOfServiceInterval = interval
@@ -215,6 +320,33 @@ func WithMaxWSConns(maxConns int) BackendOpt {
 	}
 }
 
+// WithWSConnConfig applies the heartbeat and limits of config to the WS
+// connections to the backend.
+func WithWSConnConfig(config WSConnConfig) BackendOpt {
+	return func(b *Backend) {
+		b.wsConn = config
+		b.wsWriteTimeout = config.writeTimeout()
+		b.dialer.WriteBufferSize = config.MaxFrameSize
+	}
+}
+
+// WithWSPool carries the requests of the WS clients of the backend over a pool
+// of size connections, subscriptions keeping connections of their own.
+func WithWSPool(size int) BackendOpt {
+	return func(b *Backend) {
+		b.wsPool = newWSPool(b, size)
+	}
+}
+
+// WithWSCompression negotiates permessage-deflate compression on the WS
+// connections to the backend, which compress their messages at level.
+func WithWSCompression(level int) BackendOpt {
+	return func(b *Backend) {
+		b.dialer.EnableCompression = true
+		b.wsCompressionLevel = level
+	}
+}
+
 func WithTLSConfig(tlsConfig *tls.Config) BackendOpt {
 	return func(b *Backend) {
 		if b.client.Transport == nil {
@@ -230,6 +362,18 @@ func WithStrippedTrailingXFF() BackendOpt {
 	}
 }
 
+func WithEngineJWTSecret(secret []byte) BackendOpt {
+	return func(b *Backend) {
+		b.engineJWTSecret = secret
+	}
+}
+
+func WithPeer() BackendOpt {
+	return func(b *Backend) {
+		b.peer = true
+	}
+}
+
 func WithProxydIP(ip string) BackendOpt {
 	return func(b *Backend) {
 		b.proxydIP = ip
@@ -308,7 +452,7 @@ func NewBackend(
 	name string,
 	rpcURL string,
 	wsURL string,
-	rpcSemaphore *semaphore.Weighted,
+	rpcSemaphore RPCSemaphore,
 	opts ...BackendOpt,
 ) *Backend {
 	backend := &Backend{
@@ -321,11 +465,13 @@ func NewBackend(
 			sem:         rpcSemaphore,
 			backendName: name,
 		},
-		dialer: &websocket.Dialer{},
+		dialer:         &websocket.Dialer{},
+		wsWriteTimeout: defaultWSWriteTimeout,
 
 		maxLatencyThreshold:         10 * time.Second,
 		maxDegradedLatencyThreshold: 5 * time.Second,
 		maxErrorRateThreshold:       0.5,
+		healthWeights:               defaultHealthWeights,
 
 		latencySlidingWindow:         sw.NewSlidingWindow(),
 		networkRequestsSlidingWindow: sw.NewSlidingWindow(),
@@ -348,6 +494,10 @@ func (b *Backend) Override(opts ...BackendOpt) {
 }
 
 func (b *Backend) Forward(ctx context.Context, reqs []*RPCReq, isBatch bool) ([]*RPCRes, error) {
+	if b.InSimulatedOutage() {
+		return nil, ErrBackendOffline
+	}
+
 	var lastError error
 	// <= to account for the first attempt not technically being
 	// a retry
@@ -365,7 +515,12 @@ func (b *Backend) Forward(ctx context.Context, reqs []*RPCReq, isBatch bool) ([]
 			),
 		)
 
+		start := time.Now()
 		res, err := b.doForward(ctx, reqs, isBatch)
+		if err != ErrServerOverloaded {
+			recordBackendMethodLatency(b.Name, reqs, isBatch, time.Since(start))
+			recordBackendMethodErrors(b.Name, reqs, res, err)
+		}
 		switch err {
 		case nil: // do nothing
 		case ErrBackendResponseTooLarge:
@@ -373,9 +528,15 @@ func (b *Backend) Forward(ctx context.Context, reqs []*RPCReq, isBatch bool) ([]
 				"backend response too large",
 				"name", b.Name,
 				"req_id", GetReqID(ctx),
-				"max", b.maxResponseSize,
+				"max", b.maxResponseSizeOf(reqs),
 			)
 			RecordBatchRPCError(ctx, b.Name, reqs, err)
+		case ErrServerOverloaded:
+			log.Warn(
+				"request shed by the admission queue",
+				"name", b.Name,
+				"req_id", GetReqID(ctx),
+			)
 		case ErrConsensusGetReceiptsCantBeBatched:
 			log.Warn(
 				"Received unsupported batch request for consensus_getReceipts",
@@ -423,14 +584,50 @@ func (b *Backend) Forward(ctx context.Context, reqs []*RPCReq, isBatch bool) ([]
 	return nil, wrapErr(lastError, "permanent error forwarding request")
 }
 
-func (b *Backend) ProxyWS(clientConn *websocket.Conn, methodWhitelist *StringSet) (*WSProxier, error) {
-	backendConn, _, err := b.dialer.Dial(b.wsURL, nil) // nolint:bodyclose
+// ProxyWS proxies clientConn to the backend. With subscription multiplexing,
+// the backend is dialed once the client sends a request that isn't
+// multiplexed, so that clients which only subscribe don't hold a connection.
+func (b *Backend) ProxyWS(clientConn *websocket.Conn, methodWhitelist *StringSet, mux *WSSubscriptionMux) (*WSProxier, error) {
+	if b.InSimulatedOutage() {
+		return nil, ErrBackendOffline
+	}
+
+	// backends with a pool dial the connection of a client once it subscribes
+	var backendConn *websocket.Conn
+	if mux == nil && b.wsPool == nil {
+		var err error
+		if backendConn, err = b.dialWS(); err != nil {
+			return nil, err
+		}
+	}
+	proxier := NewWSProxier(b, clientConn, backendConn, methodWhitelist)
+	proxier.mux = mux
+	b.wsClients.Add(1)
+	return proxier, nil
+}
+
+func (b *Backend) dialWS() (*websocket.Conn, error) {
+	var header http.Header
+	if b.engineJWTSecret != nil {
+		header = http.Header{"Authorization": []string{"Bearer " + engineJWT(b.engineJWTSecret, time.Now())}}
+	}
+	conn, _, err := b.dialer.Dial(b.wsURL, header) // nolint:bodyclose
 	if err != nil {
 		return nil, wrapErr(err, "error dialing backend")
 	}
-
 	activeBackendWsConnsGauge.WithLabelValues(b.Name).Inc()
-	return NewWSProxier(b, clientConn, backendConn, methodWhitelist), nil
+	if b.wsConn.MaxMessageSize > 0 {
+		conn.SetReadLimit(b.wsConn.MaxMessageSize)
+	}
+	if b.dialer.EnableCompression {
+		if err := conn.SetCompressionLevel(b.wsCompressionLevel); err != nil {
+			conn.Close()
+			activeBackendWsConnsGauge.WithLabelValues(b.Name).Dec()
+			return nil, err
+		}
+	}
+	startWSHeartbeat(conn, SourceBackend, b.wsConn, 0)
+	return conn, nil
 }
 
 // ForwardRPC makes a call directly to a backend and populate the response into `res`
@@ -538,9 +735,12 @@ func (b *Backend) doForward(ctx context.Context, rpcReqs []*RPCReq, isBatch bool
 		return nil, wrapErr(err, "error creating backend request")
 	}
 
+	b.authMtx.RLock()
 	if b.authPassword != "" {
 		httpReq.SetBasicAuth(b.authUsername, b.authPassword)
 	}
+	headers := b.headers
+	b.authMtx.RUnlock()
 
 	xForwardedFor := GetXForwardedFor(ctx)
 	if b.stripTrailingXFF {
@@ -552,12 +752,21 @@ func (b *Backend) doForward(ctx context.Context, rpcReqs []*RPCReq, isBatch bool
 	httpReq.Header.Set("content-type", "application/json")
 	httpReq.Header.Set("X-Forwarded-For", xForwardedFor)
 
-	for name, value := range b.headers {
+	for name, value := range headers {
 		httpReq.Header.Set(name, value)
 	}
+	if b.engineJWTSecret != nil {
+		httpReq.Header.Set("Authorization", "Bearer "+engineJWT(b.engineJWTSecret, time.Now()))
+	}
+	if info := GetPeeringInfo(ctx); b.peer && info != nil {
+		info.SetHeaders(httpReq.Header)
+	}
 
 	start := time.Now()
 	httpRes, err := b.client.DoLimited(httpReq)
+	if err == ErrServerOverloaded {
+		return nil, err
+	}
 	if err != nil {
 		b.networkErrorsSlidingWindow.Incr()
 		RecordBackendNetworkErrorRateSlidingWindow(b, b.ErrorRate())
@@ -580,11 +789,11 @@ func (b *Backend) doForward(ctx context.Context, rpcReqs []*RPCReq, isBatch bool
 	if httpRes.StatusCode != 200 && httpRes.StatusCode != 400 {
 		b.networkErrorsSlidingWindow.Incr()
 		RecordBackendNetworkErrorRateSlidingWindow(b, b.ErrorRate())
-		return nil, fmt.Errorf("response code %d", httpRes.StatusCode)
+		return nil, &backendHTTPStatusError{code: httpRes.StatusCode}
 	}
 
 	defer httpRes.Body.Close()
-	resB, err := io.ReadAll(LimitReader(httpRes.Body, b.maxResponseSize))
+	resB, err := io.ReadAll(LimitReader(httpRes.Body, b.maxResponseSizeOf(rpcReqs)))
 	if errors.Is(err, ErrLimitReaderOverLimit) {
 		return nil, ErrBackendResponseTooLarge
 	}
@@ -593,6 +802,7 @@ func (b *Backend) doForward(ctx context.Context, rpcReqs []*RPCReq, isBatch bool
 		RecordBackendNetworkErrorRateSlidingWindow(b, b.ErrorRate())
 		return nil, wrapErr(err, "error reading response body")
 	}
+	RecordBackendResponseSize(b.Name, metricLabelMethod, len(resB))
 
 	var rpcRes []*RPCRes
 	if isSingleElementBatch {
@@ -651,17 +861,54 @@ func (b *Backend) doForward(ctx context.Context, rpcReqs []*RPCReq, isBatch bool
 	return rpcRes, nil
 }
 
-// IsHealthy checks if the backend is able to serve traffic, based on dynamic parameters
-func (b *Backend) IsHealthy() bool {
-	errorRate := b.ErrorRate()
-	avgLatency := time.Duration(b.latencySlidingWindow.Avg())
-	if errorRate >= b.maxErrorRateThreshold {
-		return false
+// maxResponseSizeOf returns the max response size of reqs, which is the
+// largest max response size of their methods.
+func (b *Backend) maxResponseSizeOf(reqs []*RPCReq) int64 {
+	if len(b.methodMaxRespSizes) == 0 {
+		return b.maxResponseSize
+	}
+	var max int64
+	for _, req := range reqs {
+		size, ok := b.methodMaxRespSizes[req.Method]
+		if !ok {
+			size = b.maxResponseSize
+		}
+		if size > max {
+			max = size
+		}
 	}
-	if avgLatency >= b.maxLatencyThreshold {
-		return false
+	return max
+}
+
+// SimulateOutage makes the backend reject client traffic as if it were offline
+// until the given time, so that operators can rehearse failovers. Health
+// probes and consensus polling still reach the backend. A zero time ends the
+// simulated outage.
+func (b *Backend) SimulateOutage(until time.Time) {
+	if until.IsZero() {
+		b.simulatedOutageUntil.Store(0)
+		return
+	}
+	b.simulatedOutageUntil.Store(until.UnixNano())
+}
+
+// SimulatedOutageUntil returns the end of the ongoing simulated outage, or
+// the zero time if there is none.
+func (b *Backend) SimulatedOutageUntil() time.Time {
+	until := b.simulatedOutageUntil.Load()
+	if until == 0 || time.Now().UnixNano() >= until {
+		return time.Time{}
 	}
-	return true
+	return time.Unix(0, until)
+}
+
+func (b *Backend) InSimulatedOutage() bool {
+	return !b.SimulatedOutageUntil().IsZero()
+}
+
+// IsHealthy checks if the backend is able to serve traffic, based on dynamic parameters
+func (b *Backend) IsHealthy() bool {
+	return b.HealthScore().Healthy(b.minHealthScore)
 }
 
 // ErrorRate returns the instant error rate of the backend
@@ -676,8 +923,7 @@ func (b *Backend) ErrorRate() (errorRate float64) {
 
 // IsDegraded checks if the backend is serving traffic in a degraded state (i.e. used as a last resource)
 func (b *Backend) IsDegraded() bool {
-	avgLatency := time.Duration(b.latencySlidingWindow.Avg())
-	return avgLatency >= b.maxDegradedLatencyThreshold
+	return b.isDegraded(b.HealthScore())
 }
 
 func responseIsNotBatched(b []byte) bool {
@@ -708,6 +954,11 @@ type BackendGroup struct {
 	Backends        []*Backend
 	WeightedRouting bool
 	Consensus       *ConsensusPoller
+	// LagBudgets maps methods to the maximum lag of the consensus group members
+	// serving them.
+	LagBudgets map[string]uint64
+	// WSBalancer orders the backends WS clients connect to, if set.
+	WSBalancer *WSBalancer
 }
 
 func (bg *BackendGroup) Forward(ctx context.Context, rpcReqs []*RPCReq, isBatch bool) ([]*RPCRes, string, error) {
@@ -715,7 +966,7 @@ func (bg *BackendGroup) Forward(ctx context.Context, rpcReqs []*RPCReq, isBatch
 		return nil, "", nil
 	}
 
-	backends := bg.orderedBackendsForRequest()
+	backends := bg.orderedBackendsForRequest(rpcReqs)
 
 	overriddenResponses := make([]*indexedReqRes, 0)
 	rewrittenReqs := make([]*RPCReq, 0, len(rpcReqs))
@@ -776,7 +1027,8 @@ func (bg *BackendGroup) Forward(ctx context.Context, rpcReqs []*RPCReq, isBatch
 			res, err = back.Forward(ctx, rpcReqs, isBatch)
 			if errors.Is(err, ErrConsensusGetReceiptsCantBeBatched) ||
 				errors.Is(err, ErrConsensusGetReceiptsInvalidTarget) ||
-				errors.Is(err, ErrMethodNotWhitelisted) {
+				errors.Is(err, ErrMethodNotWhitelisted) ||
+				errors.Is(err, ErrServerOverloaded) {
 				return nil, "", err
 			}
 			if errors.Is(err, ErrBackendResponseTooLarge) {
@@ -829,9 +1081,18 @@ func (bg *BackendGroup) Forward(ctx context.Context, rpcReqs []*RPCReq, isBatch
 	return nil, "", ErrNoBackends
 }
 
-func (bg *BackendGroup) ProxyWS(ctx context.Context, clientConn *websocket.Conn, methodWhitelist *StringSet) (*WSProxier, error) {
-	for _, back := range bg.Backends {
-		proxier, err := back.ProxyWS(clientConn, methodWhitelist)
+// ProxyWS proxies clientConn to the first available backend. The backend of a
+// resumed session is tried first.
+func (bg *BackendGroup) ProxyWS(ctx context.Context, clientConn *websocket.Conn, methodWhitelist *StringSet, session *WSSession, mux *WSSubscriptionMux) (*WSProxier, error) {
+	backends := bg.Backends
+	if bg.WSBalancer != nil {
+		backends = bg.WSBalancer.order(ctx, backends)
+	}
+	if session != nil {
+		backends = preferBackend(backends, session.Backend())
+	}
+	for _, back := range backends {
+		proxier, err := back.ProxyWS(clientConn, methodWhitelist, mux)
 		if errors.Is(err, ErrBackendOffline) {
 			log.Warn(
 				"skipping offline backend",
@@ -860,23 +1121,43 @@ func (bg *BackendGroup) ProxyWS(ctx context.Context, clientConn *websocket.Conn,
 			)
 			continue
 		}
+		if session != nil {
+			session.setBackend(back.Name)
+			proxier.session = newWSSessionTracker(session)
+		}
+		bg.WSBalancer.bind(ctx, back)
 		return proxier, nil
 	}
 
 	return nil, ErrNoBackends
 }
 
+// preferBackend returns backends with the backend named name first.
+func preferBackend(backends []*Backend, name string) []*Backend {
+	for i, back := range backends {
+		if back.Name == name {
+			out := make([]*Backend, 0, len(backends))
+			out = append(out, back)
+			out = append(out, backends[:i]...)
+			return append(out, backends[i+1:]...)
+		}
+	}
+	return backends
+}
+
+// weightedShuffle shuffles backends by their weight scaled by their health
+// score, so that less healthy backends get less traffic.
 func weightedShuffle(backends []*Backend) {
 	weight := func(i int) float64 {
-		return float64(backends[i].weight)
+		return float64(backends[i].weight) * backends[i].HealthScore().Score
 	}
 
 	weightedshuffle.ShuffleInplace(backends, weight, nil)
 }
 
-func (bg *BackendGroup) orderedBackendsForRequest() []*Backend {
+func (bg *BackendGroup) orderedBackendsForRequest(rpcReqs []*RPCReq) []*Backend {
 	if bg.Consensus != nil {
-		return bg.loadBalancedConsensusGroup()
+		return bg.loadBalancedConsensusGroup(rpcReqs)
 	} else if bg.WeightedRouting {
 		result := make([]*Backend, len(bg.Backends))
 		copy(result, bg.Backends)
@@ -887,8 +1168,27 @@ func (bg *BackendGroup) orderedBackendsForRequest() []*Backend {
 	}
 }
 
-func (bg *BackendGroup) loadBalancedConsensusGroup() []*Backend {
-	cg := bg.Consensus.GetConsensusGroup()
+// lagBudget returns the tightest lag budget of the methods of rpcReqs, if any
+// of them has one.
+func (bg *BackendGroup) lagBudget(rpcReqs []*RPCReq) (uint64, bool) {
+	var budget uint64
+	var found bool
+	for _, req := range rpcReqs {
+		if b, ok := bg.LagBudgets[req.Method]; ok && (!found || b < budget) {
+			budget = b
+			found = true
+		}
+	}
+	return budget, found
+}
+
+func (bg *BackendGroup) loadBalancedConsensusGroup(rpcReqs []*RPCReq) []*Backend {
+	var cg []*Backend
+	if budget, ok := bg.lagBudget(rpcReqs); ok {
+		cg = bg.Consensus.GetConsensusGroupWithinLag(budget)
+	} else {
+		cg = bg.Consensus.GetConsensusGroup()
+	}
 
 	backendsHealthy := make([]*Backend, 0, len(cg))
 	backendsDegraded := make([]*Backend, 0, len(cg))
@@ -929,6 +1229,9 @@ func (bg *BackendGroup) Shutdown() {
 	if bg.Consensus != nil {
 		bg.Consensus.Shutdown()
 	}
+	for _, back := range bg.Backends {
+		back.wsPool.close()
+	}
 }
 
 func calcBackoff(i int) time.Duration {
@@ -946,6 +1249,34 @@ type WSProxier struct {
 	methodWhitelist *StringSet
 	readTimeout     time.Duration
 	writeTimeout    time.Duration
+	session         *wsSessionTracker
+	msgLimiter      *WSMessageRateLimiter
+	policy          *WSMessagePolicy
+	mux             *WSSubscriptionMux
+	muxMu           sync.Mutex
+	muxSubs         map[string]struct{}
+	muxClosed       bool
+	// failoverGroup is the group of the backends the connection fails over
+	// to, if failover is enabled.
+	failoverGroup *BackendGroup
+	clientGone    atomic.Bool
+	closed        bool
+	// gapFillers are the gap fillers of the subscriptions of the client, by
+	// ID, if gap filling is enabled.
+	gapFillers   map[string]*wsGapFiller
+	maxGapBlocks uint64
+	heartbeat    *wsHeartbeat
+	// sendQueue queues the messages to the client written by the send loop,
+	// if enabled.
+	sendQueue             chan wsOutMessage
+	sendStop              chan struct{}
+	sendDone              chan struct{}
+	dropSlowNotifications bool
+	compression           *WSCompression
+	// deniedMethods are the whitelisted methods the auth key of the client
+	// may not call.
+	deniedMethods *StringSet
+	geoip         *GeoIP
 }
 
 func NewWSProxier(backend *Backend, clientConn, backendConn *websocket.Conn, methodWhitelist *StringSet) *WSProxier {
@@ -960,19 +1291,71 @@ func NewWSProxier(backend *Backend, clientConn, backendConn *websocket.Conn, met
 }
 
 func (w *WSProxier) Proxy(ctx context.Context) error {
+	if w.session != nil {
+		if msgs := w.session.restoreRequests(nil); len(msgs) > 0 {
+			if _, err := w.connectBackend(); err != nil {
+				w.close()
+				return err
+			}
+			for _, msg := range msgs {
+				if err := w.writeBackendConn(websocket.TextMessage, msg); err != nil {
+					w.close()
+					return err
+				}
+			}
+		}
+	}
+
 	errC := make(chan error, 2)
+	if w.backendConn != nil {
+		go w.backendPump(ctx, errC)
+	}
 	go w.clientPump(ctx, errC)
-	go w.backendPump(ctx, errC)
 	err := <-errC
 	w.close()
 	return err
 }
 
+// connectBackend dials the backend if it isn't connected yet, and reports
+// whether it did. The backend pump of a new connection is left to the caller.
+func (w *WSProxier) connectBackend() (bool, error) {
+	if w.backendConnected() {
+		return false, nil
+	}
+	conn, err := w.backend.dialWS()
+	if err != nil {
+		return false, err
+	}
+	w.backendConnMu.Lock()
+	w.backendConn = conn
+	w.backendConnMu.Unlock()
+	return true, nil
+}
+
+func (w *WSProxier) backendConnected() bool {
+	w.backendConnMu.Lock()
+	defer w.backendConnMu.Unlock()
+	return w.backendConn != nil
+}
+
+// currentBackend returns the backend the connection is proxied to, which
+// changes on failover.
+func (w *WSProxier) currentBackend() *Backend {
+	w.backendConnMu.Lock()
+	defer w.backendConnMu.Unlock()
+	return w.backend
+}
+
 func (w *WSProxier) clientPump(ctx context.Context, errC chan error) {
 	for {
 		// Block until we get a message.
 		msgType, msg, err := w.clientConn.ReadMessage()
 		if err != nil {
+			w.clientGone.Store(true)
+			if !w.backendConnected() {
+				errC <- err
+				return
+			}
 			if err := w.writeBackendConn(websocket.CloseMessage, formatWSError(err)); err != nil {
 				log.Error("error writing backendConn message", "err", err)
 				errC <- err
@@ -980,11 +1363,14 @@ func (w *WSProxier) clientPump(ctx context.Context, errC chan error) {
 			}
 		}
 
-		RecordWSMessage(ctx, w.backend.Name, SourceClient)
+		RecordWSMessage(ctx, w.currentBackend().Name, SourceClient)
 
 		// Route control messages to the backend. These don't
 		// count towards the total RPC requests count.
 		if msgType != websocket.TextMessage && msgType != websocket.BinaryMessage {
+			if !w.backendConnected() {
+				continue
+			}
 			err := w.writeBackendConn(msgType, msg)
 			if err != nil {
 				errC <- err
@@ -993,12 +1379,34 @@ func (w *WSProxier) clientPump(ctx context.Context, errC chan error) {
 			continue
 		}
 
+		w.heartbeat.touch()
 		rpcRequestsTotal.Inc()
 
+		if w.msgLimiter != nil {
+			if limited, err := w.limitClientMsg(ctx, msgType, msg); err != nil {
+				errC <- err
+				return
+			} else if limited {
+				continue
+			}
+		}
+
+		if w.policy != nil && w.policy.batches && IsBatch(msg) {
+			if err := w.proxyClientBatch(ctx, errC, msgType, msg); err != nil {
+				errC <- err
+				return
+			}
+			continue
+		}
+
 		// Don't bother sending invalid requests to the backend,
 		// just handle them here.
-		req, err := w.prepareClientMsg(msg)
+		req, err := w.prepareClientMsg(ctx, msg)
 		if err != nil {
+			if w.closeForViolation(ctx, err) {
+				errC <- err
+				return
+			}
 			var id json.RawMessage
 			method := MethodUnknown
 			if req != nil {
@@ -1035,7 +1443,36 @@ func (w *WSProxier) clientPump(ctx context.Context, errC chan error) {
 			continue
 		}
 
-		RecordRPCForward(ctx, w.backend.Name, req.Method, RPCRequestSourceWS)
+		if w.mux != nil {
+			if handled, err := w.handleMuxReq(ctx, msgType, req); err != nil {
+				errC <- err
+				return
+			} else if handled {
+				continue
+			}
+		}
+
+		if pool := w.currentBackend().wsPool; pool != nil && !wsSubscriptionMethods[req.Method] {
+			if err := w.forwardPooled(ctx, pool, msgType, req); err != nil {
+				errC <- err
+				return
+			}
+			continue
+		}
+
+		if w.session != nil {
+			msg = w.session.clientReq(req, msg)
+		}
+
+		if connected, err := w.connectBackend(); err != nil {
+			log.Error("error dialing ws backend", "auth", GetAuthCtx(ctx), "req_id", GetReqID(ctx), "err", err)
+			errC <- err
+			return
+		} else if connected {
+			go w.backendPump(ctx, errC)
+		}
+
+		RecordRPCForward(ctx, w.currentBackend().Name, req.Method, RPCRequestSourceWS)
 		log.Info(
 			"forwarded WS message to backend",
 			"method", req.Method,
@@ -1045,6 +1482,12 @@ func (w *WSProxier) clientPump(ctx context.Context, errC chan error) {
 
 		err = w.writeBackendConn(msgType, msg)
 		if err != nil {
+			// the request is answered with an error once the backend pump
+			// fails over
+			if w.failoverGroup != nil {
+				log.Warn("error writing to failed ws backend", "auth", GetAuthCtx(ctx), "req_id", GetReqID(ctx), "err", err)
+				continue
+			}
 			errC <- err
 			return
 		}
@@ -1056,6 +1499,13 @@ func (w *WSProxier) backendPump(ctx context.Context, errC chan error) {
 		// Block until we get a message.
 		msgType, msg, err := w.backendConn.ReadMessage()
 		if err != nil {
+			if w.failoverGroup != nil && !w.clientGone.Load() {
+				ferr := w.failover(ctx, err)
+				if ferr == nil {
+					continue
+				}
+				log.Warn("error failing over ws backend", "auth", GetAuthCtx(ctx), "req_id", GetReqID(ctx), "err", ferr)
+			}
 			if err := w.writeClientConn(websocket.CloseMessage, formatWSError(err)); err != nil {
 				log.Error("error writing clientConn message", "err", err)
 				errC <- err
@@ -1075,6 +1525,16 @@ func (w *WSProxier) backendPump(ctx context.Context, errC chan error) {
 			continue
 		}
 
+		// batch responses are forwarded as is
+		if IsBatch(msg) {
+			w.recordBatchRes(ctx, msg)
+			if err := w.writeClientConn(msgType, msg); err != nil {
+				errC <- err
+				return
+			}
+			continue
+		}
+
 		res, err := w.parseBackendMsg(msg)
 		if err != nil {
 			var id json.RawMessage
@@ -1084,6 +1544,12 @@ func (w *WSProxier) backendPump(ctx context.Context, errC chan error) {
 			msg = mustMarshalJSON(NewRPCErrorRes(id, err))
 			log.Info("backend responded with error", "err", err)
 		} else {
+			if w.session != nil {
+				var forward bool
+				if msg, forward = w.session.backendRes(res, msg); !forward {
+					continue
+				}
+			}
 			if res.IsError() {
 				log.Info(
 					"backend responded with RPC error",
@@ -1103,6 +1569,16 @@ func (w *WSProxier) backendPump(ctx context.Context, errC chan error) {
 			}
 		}
 
+		if err == nil && w.gapFillers != nil && len(res.ID) == 0 {
+			for _, msg := range w.fillGaps(ctx, msg) {
+				if err := w.writeClientConn(msgType, msg); err != nil {
+					errC <- err
+					return
+				}
+			}
+			continue
+		}
+
 		err = w.writeClientConn(msgType, msg)
 		if err != nil {
 			errC <- err
@@ -1111,22 +1587,163 @@ func (w *WSProxier) backendPump(ctx context.Context, errC chan error) {
 	}
 }
 
+// limitClientMsg takes a message of the client from the message rate limits.
+// Limited messages are answered with an error, or close the connection if the
+// policy says so, in which case the returned error ends the proxying.
+func (w *WSProxier) limitClientMsg(ctx context.Context, msgType int, msg []byte) (bool, error) {
+	rpcErr := ErrOverRateLimit
+	limit, err := w.msgLimiter.Take(ctx)
+	if err != nil {
+		log.Error("error taking from ws message limiter", "auth", GetAuthCtx(ctx), "req_id", GetReqID(ctx), "err", err)
+		rpcErr = ErrInternal
+	} else if limit == "" {
+		return false, nil
+	} else {
+		log.Info("ws message rate limit exceeded", "limit", limit, "auth", GetAuthCtx(ctx), "req_id", GetReqID(ctx))
+		RecordWSMessageRateLimited(limit)
+		if w.msgLimiter.closeConn {
+			closeMsg := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, ErrOverRateLimit.Message)
+			if err := w.writeClientConn(websocket.CloseMessage, closeMsg); err != nil {
+				log.Error("error writing clientConn message", "err", err)
+			}
+			return true, ErrOverRateLimit
+		}
+	}
+
+	var id json.RawMessage
+	if req, err := ParseRPCReq(msg); err == nil {
+		id = req.ID
+	}
+	RecordRPCError(ctx, BackendProxyd, MethodUnknown, rpcErr)
+	return true, w.writeClientConn(msgType, mustMarshalJSON(NewRPCErrorRes(id, rpcErr)))
+}
+
 func (w *WSProxier) close() {
+	w.heartbeat.stop()
+	if w.compression != nil {
+		w.compression.release()
+	}
+	if w.sendStop != nil {
+		close(w.sendStop)
+	}
 	w.clientConn.Close()
-	w.backendConn.Close()
-	activeBackendWsConnsGauge.WithLabelValues(w.backend.Name).Dec()
+	w.backendConnMu.Lock()
+	w.closed = true
+	if w.backendConn != nil {
+		w.backendConn.Close()
+		activeBackendWsConnsGauge.WithLabelValues(w.backend.Name).Dec()
+	}
+	w.backend.wsClients.Add(-1)
+	w.backendConnMu.Unlock()
+	if w.mux != nil {
+		w.muxMu.Lock()
+		w.muxClosed = true
+		subs := w.muxSubs
+		w.muxSubs = nil
+		w.muxMu.Unlock()
+		for id := range subs {
+			w.mux.Unsubscribe(id)
+		}
+	}
+}
+
+// handleMuxReq serves the eth_subscribe requests of multiplexed subscriptions
+// and their eth_unsubscribe requests, and reports whether req was handled.
+// The returned error ends the proxying.
+func (w *WSProxier) handleMuxReq(ctx context.Context, msgType int, req *RPCReq) (bool, error) {
+	var res *RPCRes
+	switch req.Method {
+	case "eth_subscribe":
+		if !w.mux.Multiplexes(req.Params) {
+			return false, nil
+		}
+		var fallbacks []*Backend
+		if w.failoverGroup != nil {
+			fallbacks = w.failoverGroup.Backends
+		}
+		id, err := w.mux.Subscribe(w.currentBackend(), fallbacks, req.Params, func(msg []byte) error {
+			return w.writeClientConn(websocket.TextMessage, msg)
+		}, func() {
+			w.clientConn.Close()
+		})
+		if err != nil {
+			log.Warn("error subscribing to multiplexed ws subscription", "auth", GetAuthCtx(ctx), "req_id", GetReqID(ctx), "err", err)
+			var rpcErr *RPCErr
+			if !errors.As(err, &rpcErr) {
+				rpcErr = ErrBackendOffline
+			}
+			RecordRPCError(ctx, BackendProxyd, req.Method, rpcErr)
+			res = NewRPCErrorRes(req.ID, rpcErr)
+			break
+		}
+		w.muxMu.Lock()
+		closed := w.muxClosed
+		if !closed {
+			if w.muxSubs == nil {
+				w.muxSubs = make(map[string]struct{})
+			}
+			w.muxSubs[id] = struct{}{}
+		}
+		w.muxMu.Unlock()
+		if closed {
+			w.mux.Unsubscribe(id)
+			return true, nil
+		}
+		// resumed sessions restore them as regular subscriptions
+		if w.session != nil {
+			w.session.session.addSubscription(id, req.Params)
+		}
+		RecordRPCForward(ctx, BackendProxyd, req.Method, RPCRequestSourceWS)
+		res = NewRPCRes(req.ID, id)
+	case "eth_unsubscribe":
+		var params []string
+		if err := json.Unmarshal(req.Params, &params); err != nil || len(params) != 1 {
+			return false, nil
+		}
+		w.muxMu.Lock()
+		_, ok := w.muxSubs[params[0]]
+		delete(w.muxSubs, params[0])
+		w.muxMu.Unlock()
+		if !ok {
+			return false, nil
+		}
+		w.mux.Unsubscribe(params[0])
+		if w.session != nil {
+			w.session.session.removeSubscription(params[0])
+		}
+		RecordRPCForward(ctx, BackendProxyd, req.Method, RPCRequestSourceWS)
+		res = NewRPCRes(req.ID, true)
+	default:
+		return false, nil
+	}
+	return true, w.writeClientConn(msgType, mustMarshalJSON(res))
 }
 
-func (w *WSProxier) prepareClientMsg(msg []byte) (*RPCReq, error) {
+func (w *WSProxier) prepareClientMsg(ctx context.Context, msg []byte) (*RPCReq, error) {
 	req, err := ParseRPCReq(msg)
 	if err != nil {
 		return nil, err
 	}
 
 	if !w.methodWhitelist.Has(req.Method) {
+		if w.deniedMethods != nil && w.deniedMethods.Has(req.Method) {
+			RecordAuthKeyMethodDenial(GetAuthCtx(ctx), req.Method, RPCRequestSourceWS)
+		}
 		return req, ErrMethodNotWhitelisted
 	}
 
+	if w.geoip != nil {
+		if err := w.geoip.check(ctx, req.Method); err != nil {
+			return req, err
+		}
+	}
+
+	if w.policy != nil {
+		if err := w.policy.checkReq(ctx, req); err != nil {
+			return req, err
+		}
+	}
+
 	return req, nil
 }
 
@@ -1140,8 +1757,19 @@ func (w *WSProxier) parseBackendMsg(msg []byte) (*RPCRes, error) {
 }
 
 func (w *WSProxier) writeClientConn(msgType int, msg []byte) error {
+	if w.sendQueue != nil {
+		return w.queueClientMsg(msgType, msg)
+	}
+	return w.writeClientConnNow(msgType, msg)
+}
+
+func (w *WSProxier) writeClientConnNow(msgType int, msg []byte) error {
+	if msgType == websocket.TextMessage || msgType == websocket.BinaryMessage {
+		w.heartbeat.touch()
+	}
 	w.clientConnMu.Lock()
 	defer w.clientConnMu.Unlock()
+	w.compressMsg(msg)
 	if err := w.clientConn.SetWriteDeadline(time.Now().Add(w.writeTimeout)); err != nil {
 		log.Error("ws client write timeout", "err", err)
 		return err
@@ -1153,7 +1781,7 @@ func (w *WSProxier) writeClientConn(msgType int, msg []byte) error {
 func (w *WSProxier) writeBackendConn(msgType int, msg []byte) error {
 	w.backendConnMu.Lock()
 	defer w.backendConnMu.Unlock()
-	if err := w.backendConn.SetWriteDeadline(time.Now().Add(w.writeTimeout)); err != nil {
+	if err := w.backendConn.SetWriteDeadline(time.Now().Add(w.backend.wsWriteTimeout)); err != nil {
 		log.Error("ws backend write timeout", "err", err)
 		return err
 	}
@@ -1188,13 +1816,16 @@ func sleepContext(ctx context.Context, duration time.Duration) {
 
 type LimitedHTTPClient struct {
 	http.Client
-	sem         *semaphore.Weighted
+	sem         RPCSemaphore
 	backendName string
 }
 
 func (c *LimitedHTTPClient) DoLimited(req *http.Request) (*http.Response, error) {
 	if err := c.sem.Acquire(req.Context(), 1); err != nil {
 		tooManyRequestErrorsTotal.WithLabelValues(c.backendName).Inc()
+		if err == ErrServerOverloaded {
+			return nil, err
+		}
 		return nil, wrapErr(err, "too many requests")
 	}
 	defer c.sem.Release(1)
@@ -0,0 +1,185 @@
+package proxyd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultBackendMetricsMaxMethods = 100
+	backendMetricsOtherMethod       = "other"
+
+	BackendErrorClassTimeout           = "timeout"
+	BackendErrorClassNetwork           = "network"
+	BackendErrorClassHTTPStatus        = "http_status"
+	BackendErrorClassRateLimited       = "rate_limited"
+	BackendErrorClassResponseTooLarge  = "response_too_large"
+	BackendErrorClassBadResponse       = "bad_response"
+	BackendErrorClassExecutionReverted = "execution_reverted"
+	BackendErrorClassInvalidRequest    = "invalid_request"
+	BackendErrorClassMethodNotFound    = "method_not_found"
+	BackendErrorClassInternal          = "internal"
+	BackendErrorClassServerError       = "server_error"
+)
+
+// backendMetricsMethods labels the methods of the latency histograms and
+// error counters by backend and method, if enabled.
+var backendMetricsMethods atomic.Pointer[methodLabeler]
+
+// ConfigureBackendMethodMetrics enables the metrics by backend and method, or
+// disables them.
+func ConfigureBackendMethodMetrics(config BackendMethodMetricsConfig) {
+	if !config.Enabled {
+		backendMetricsMethods.Store(nil)
+		return
+	}
+	backendMetricsMethods.Store(newMethodLabeler(config))
+}
+
+// methodLabeler bounds the cardinality of method labels. Methods outside of
+// the allowlist, or once the cap is reached, are labeled "other".
+type methodLabeler struct {
+	allowed    map[string]bool
+	maxMethods int
+
+	mtx  sync.Mutex
+	seen map[string]bool
+}
+
+func newMethodLabeler(config BackendMethodMetricsConfig) *methodLabeler {
+	l := &methodLabeler{
+		maxMethods: defaultBackendMetricsMaxMethods,
+		seen:       make(map[string]bool),
+	}
+	if config.MaxMethods != 0 {
+		l.maxMethods = config.MaxMethods
+	}
+	if len(config.Methods) > 0 {
+		l.allowed = make(map[string]bool, len(config.Methods))
+		for _, method := range config.Methods {
+			l.allowed[method] = true
+		}
+	}
+	return l
+}
+
+func (l *methodLabeler) label(method string) string {
+	if l.allowed != nil && !l.allowed[method] {
+		return backendMetricsOtherMethod
+	}
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if l.seen[method] {
+		return method
+	}
+	if len(l.seen) >= l.maxMethods {
+		return backendMetricsOtherMethod
+	}
+	l.seen[method] = true
+	return method
+}
+
+// backendHTTPStatusError is returned by backends answering with an
+// unexpected HTTP status code.
+type backendHTTPStatusError struct {
+	code int
+}
+
+func (e *backendHTTPStatusError) Error() string {
+	return fmt.Sprintf("response code %d", e.code)
+}
+
+// backendErrorClass classifies the errors of backend requests, and the RPC
+// errors they answered with.
+func backendErrorClass(err error) string {
+	var httpErr *backendHTTPStatusError
+	var netErr net.Error
+	var rpcErr *RPCErr
+	switch {
+	case errors.Is(err, context.DeadlineExceeded),
+		errors.As(err, &netErr) && netErr.Timeout():
+		return BackendErrorClassTimeout
+	case errors.Is(err, ErrBackendResponseTooLarge):
+		return BackendErrorClassResponseTooLarge
+	case errors.Is(err, ErrBackendBadResponse),
+		errors.Is(err, ErrBackendUnexpectedJSONRPC):
+		return BackendErrorClassBadResponse
+	case errors.Is(err, ErrConsensusGetReceiptsCantBeBatched),
+		errors.Is(err, ErrConsensusGetReceiptsInvalidTarget):
+		return BackendErrorClassInvalidRequest
+	case errors.As(err, &httpErr):
+		if httpErr.code == 429 {
+			return BackendErrorClassRateLimited
+		}
+		return BackendErrorClassHTTPStatus
+	case errors.As(err, &rpcErr):
+		return rpcErrorClass(rpcErr)
+	default:
+		return BackendErrorClassNetwork
+	}
+}
+
+func rpcErrorClass(rpcErr *RPCErr) string {
+	switch rpcErr.Code {
+	case 3:
+		return BackendErrorClassExecutionReverted
+	case -32700, -32600, -32602:
+		return BackendErrorClassInvalidRequest
+	case -32601:
+		return BackendErrorClassMethodNotFound
+	case -32005, 429:
+		return BackendErrorClassRateLimited
+	case -32603:
+		return BackendErrorClassInternal
+	}
+	msg := strings.ToLower(rpcErr.Message)
+	switch {
+	case strings.Contains(msg, "execution reverted"):
+		return BackendErrorClassExecutionReverted
+	case strings.Contains(msg, "rate limit"):
+		return BackendErrorClassRateLimited
+	default:
+		return BackendErrorClassServerError
+	}
+}
+
+// recordBackendMethodLatency observes the latency of a request to a backend,
+// of batches labeled "<batch>".
+func recordBackendMethodLatency(backendName string, reqs []*RPCReq, isBatch bool, latency time.Duration) {
+	labeler := backendMetricsMethods.Load()
+	if labeler == nil {
+		return
+	}
+	method := "<batch>"
+	if !isBatch {
+		method = labeler.label(reqs[0].Method)
+	}
+	RecordBackendMethodLatency(backendName, method, latency)
+}
+
+// recordBackendMethodErrors counts err for each request to a backend, or the
+// RPC errors of res.
+func recordBackendMethodErrors(backendName string, reqs []*RPCReq, res []*RPCRes, err error) {
+	labeler := backendMetricsMethods.Load()
+	if labeler == nil {
+		return
+	}
+	if err != nil {
+		class := backendErrorClass(err)
+		for _, req := range reqs {
+			RecordBackendMethodError(backendName, labeler.label(req.Method), class)
+		}
+		return
+	}
+	for i, r := range res {
+		if i < len(reqs) && r.IsError() {
+			RecordBackendMethodError(backendName, labeler.label(reqs[i].Method), rpcErrorClass(r.Error))
+		}
+	}
+}
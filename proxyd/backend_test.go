@@ -19,3 +19,24 @@ func TestStripXFF(t *testing.T) {
 		assert.Equal(t, test.out, actual)
 	}
 }
+
+func TestPreferBackend(t *testing.T) {
+	a, b, c := &Backend{Name: "a"}, &Backend{Name: "b"}, &Backend{Name: "c"}
+	backends := []*Backend{a, b, c}
+	assert.Equal(t, []*Backend{c, a, b}, preferBackend(backends, "c"))
+	assert.Equal(t, []*Backend{a, b, c}, preferBackend(backends, "a"))
+	assert.Equal(t, []*Backend{a, b, c}, preferBackend(backends, "d"))
+	assert.Equal(t, []*Backend{a, b, c}, backends)
+}
+
+func TestMaxResponseSizeOf(t *testing.T) {
+	b := &Backend{maxResponseSize: 100}
+	logs, chainID := &RPCReq{Method: "eth_getLogs"}, &RPCReq{Method: "eth_chainId"}
+	assert.Equal(t, int64(100), b.maxResponseSizeOf([]*RPCReq{logs}))
+
+	WithMethodMaxResponseSizes(map[string]int64{"eth_getLogs": 1000, "eth_chainId": 10})(b)
+	assert.Equal(t, int64(1000), b.maxResponseSizeOf([]*RPCReq{logs}))
+	assert.Equal(t, int64(10), b.maxResponseSizeOf([]*RPCReq{chainID}))
+	assert.Equal(t, int64(1000), b.maxResponseSizeOf([]*RPCReq{chainID, logs}))
+	assert.Equal(t, int64(100), b.maxResponseSizeOf([]*RPCReq{chainID, {Method: "eth_call"}}))
+}
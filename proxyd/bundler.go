@@ -0,0 +1,170 @@
+package proxyd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// bundlerMethods are the ERC-4337 methods routed to the bundler backend group.
+var bundlerMethods = map[string]bool{
+	"eth_sendUserOperation":        true,
+	"eth_estimateUserOperationGas": true,
+	"eth_getUserOperationReceipt":  true,
+	"eth_getUserOperationByHash":   true,
+	"eth_supportedEntryPoints":     true,
+}
+
+// UserOperation holds the fields of an ERC-4337 user operation of both the
+// v0.6 and v0.7 entry points.
+type UserOperation struct {
+	Sender               *common.Address `json:"sender"`
+	Nonce                *hexutil.Big    `json:"nonce"`
+	CallData             *hexutil.Bytes  `json:"callData"`
+	Signature            *hexutil.Bytes  `json:"signature"`
+	CallGasLimit         *hexutil.Big    `json:"callGasLimit"`
+	VerificationGasLimit *hexutil.Big    `json:"verificationGasLimit"`
+	PreVerificationGas   *hexutil.Big    `json:"preVerificationGas"`
+	MaxFeePerGas         *hexutil.Big    `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas *hexutil.Big    `json:"maxPriorityFeePerGas"`
+
+	// v0.6
+	InitCode         *hexutil.Bytes `json:"initCode"`
+	PaymasterAndData *hexutil.Bytes `json:"paymasterAndData"`
+
+	// v0.7
+	Factory                       *common.Address `json:"factory"`
+	FactoryData                   *hexutil.Bytes  `json:"factoryData"`
+	Paymaster                     *common.Address `json:"paymaster"`
+	PaymasterVerificationGasLimit *hexutil.Big    `json:"paymasterVerificationGasLimit"`
+	PaymasterPostOpGasLimit       *hexutil.Big    `json:"paymasterPostOpGasLimit"`
+	PaymasterData                 *hexutil.Bytes  `json:"paymasterData"`
+}
+
+// BundlerRouter routes the ERC-4337 methods to the bundler backend group,
+// regardless of the method mappings, and validates the user operations sent
+// to it.
+type BundlerRouter struct {
+	group       string
+	entryPoints map[common.Address]bool
+}
+
+func NewBundlerRouter(config BundlerConfig) (*BundlerRouter, error) {
+	entryPoints := make(map[common.Address]bool, len(config.EntryPoints))
+	for _, addr := range config.EntryPoints {
+		if !common.IsHexAddress(addr) {
+			return nil, fmt.Errorf("invalid bundler entry point %s", addr)
+		}
+		entryPoints[common.HexToAddress(addr)] = true
+	}
+	return &BundlerRouter{
+		group:       config.BackendGroup,
+		entryPoints: entryPoints,
+	}, nil
+}
+
+// Handles returns whether method is routed to the bundler.
+func (r *BundlerRouter) Handles(method string) bool {
+	return bundlerMethods[method]
+}
+
+// Group returns the backend group of the bundler.
+func (r *BundlerRouter) Group() string {
+	return r.group
+}
+
+// Validate checks the params of a bundler method request.
+func (r *BundlerRouter) Validate(req *RPCReq) *RPCErr {
+	var params []json.RawMessage
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return ErrInvalidParams("invalid params")
+	}
+
+	switch req.Method {
+	case "eth_sendUserOperation":
+		if len(params) != 2 {
+			return ErrInvalidParams(fmt.Sprintf("expected 2 params, got %d", len(params)))
+		}
+		return r.validateUserOperation(params[0], params[1], true)
+	case "eth_estimateUserOperationGas":
+		// the third param is an optional state override
+		if len(params) != 2 && len(params) != 3 {
+			return ErrInvalidParams(fmt.Sprintf("expected 2 or 3 params, got %d", len(params)))
+		}
+		return r.validateUserOperation(params[0], params[1], false)
+	case "eth_getUserOperationReceipt", "eth_getUserOperationByHash":
+		if len(params) != 1 {
+			return ErrInvalidParams(fmt.Sprintf("expected 1 param, got %d", len(params)))
+		}
+		var hash common.Hash
+		if err := json.Unmarshal(params[0], &hash); err != nil {
+			return ErrInvalidParams("invalid user operation hash")
+		}
+	}
+	return nil
+}
+
+// validateUserOperation checks the shape of a user operation sent to
+// entryPoint. Gas and fee fields are only required for operations to be
+// bundled, as they are estimated otherwise.
+func (r *BundlerRouter) validateUserOperation(rawOp json.RawMessage, rawEntryPoint json.RawMessage, bundled bool) *RPCErr {
+	var entryPoint common.Address
+	if err := json.Unmarshal(rawEntryPoint, &entryPoint); err != nil {
+		return ErrInvalidParams("invalid entry point")
+	}
+	if len(r.entryPoints) > 0 && !r.entryPoints[entryPoint] {
+		return ErrInvalidParams(fmt.Sprintf("unsupported entry point %s", entryPoint.Hex()))
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(rawOp))
+	dec.DisallowUnknownFields()
+	var op UserOperation
+	if err := dec.Decode(&op); err != nil {
+		return ErrInvalidParams(fmt.Sprintf("invalid user operation: %s", err))
+	}
+
+	var missing []string
+	if op.Sender == nil {
+		missing = append(missing, "sender")
+	}
+	if op.Nonce == nil {
+		missing = append(missing, "nonce")
+	}
+	if op.CallData == nil {
+		missing = append(missing, "callData")
+	}
+	if bundled {
+		if op.Signature == nil {
+			missing = append(missing, "signature")
+		}
+		if op.CallGasLimit == nil {
+			missing = append(missing, "callGasLimit")
+		}
+		if op.VerificationGasLimit == nil {
+			missing = append(missing, "verificationGasLimit")
+		}
+		if op.PreVerificationGas == nil {
+			missing = append(missing, "preVerificationGas")
+		}
+		if op.MaxFeePerGas == nil {
+			missing = append(missing, "maxFeePerGas")
+		}
+		if op.MaxPriorityFeePerGas == nil {
+			missing = append(missing, "maxPriorityFeePerGas")
+		}
+	}
+	if len(missing) > 0 {
+		return ErrInvalidParams(fmt.Sprintf("user operation missing fields: %s", strings.Join(missing, ", ")))
+	}
+
+	// v0.6 and v0.7 operations can't be mixed
+	if (op.InitCode != nil || op.PaymasterAndData != nil) &&
+		(op.Factory != nil || op.FactoryData != nil || op.Paymaster != nil || op.PaymasterData != nil) {
+		return ErrInvalidParams("user operation mixes v0.6 and v0.7 fields")
+	}
+	return nil
+}
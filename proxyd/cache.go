@@ -3,54 +3,178 @@ package proxyd
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/redis/go-redis/v9"
 
-	"github.com/golang/snappy"
 	lru "github.com/hashicorp/golang-lru"
 )
 
 type Cache interface {
 	Get(ctx context.Context, key string) (string, error)
 	Put(ctx context.Context, key string, value string) error
+	// PutWithTTL sets key with its own ttl. A zero ttl doesn't expire.
+	PutWithTTL(ctx context.Context, key string, value string, ttl time.Duration) error
+	// Delete removes key, and returns whether it was set.
+	Delete(ctx context.Context, key string) (bool, error)
+	// Purge removes all keys starting with prefix, and returns how many were
+	// removed.
+	Purge(ctx context.Context, prefix string) (int, error)
 }
 
+// ttlGetter is implemented by the caches that can return the remaining TTL of
+// their keys along with their values.
+type ttlGetter interface {
+	// GetWithTTL returns the value of key and its remaining ttl, which is zero
+	// if key doesn't expire.
+	GetWithTTL(ctx context.Context, key string) (string, time.Duration, error)
+}
+
+var (
+	ErrCachePurgeNotSupported = errors.New("cache backend does not support purging")
+	ErrMethodNotCached        = errors.New("method is not cached")
+)
+
 const (
 	// assuming an average RPCRes size of 3 KB
-	memoryCacheLimit = 4096
+	memoryCacheLimit           = 4096
+	defaultMemoryCacheMaxBytes = 64 * 1024 * 1024
 )
 
+// cache is an in-memory LRU bounded both by its number of entries and by the
+// total size of its keys and values.
 type cache struct {
-	lru *lru.Cache
+	lru      *lru.Cache
+	mtx      sync.Mutex
+	maxBytes int64
+	bytes    atomic.Int64
 }
 
-func newMemoryCache() *cache {
-	rep, _ := lru.New(memoryCacheLimit)
-	return &cache{rep}
+type memoryCacheEntry struct {
+	value     string
+	expiresAt time.Time
+}
+
+func newMemoryCache(maxEntries int, maxBytes int64) *cache {
+	if maxEntries <= 0 {
+		maxEntries = memoryCacheLimit
+	}
+	if maxBytes <= 0 {
+		maxBytes = defaultMemoryCacheMaxBytes
+	}
+	c := &cache{maxBytes: maxBytes}
+	c.lru, _ = lru.NewWithEvict(maxEntries, func(key, value interface{}) {
+		size := memoryCacheEntrySize(key.(string), value.(*memoryCacheEntry).value)
+		c.bytes.Add(-size)
+		memoryCacheSizeBytes.Sub(float64(size))
+	})
+	return c
+}
+
+func memoryCacheEntrySize(key string, value string) int64 {
+	return int64(len(key) + len(value))
 }
 
 func (c *cache) Get(ctx context.Context, key string) (string, error) {
+	val, _, err := c.GetWithTTL(ctx, key)
+	return val, err
+}
+
+func (c *cache) GetWithTTL(ctx context.Context, key string) (string, time.Duration, error) {
 	if val, ok := c.lru.Get(key); ok {
-		return val.(string), nil
+		entry := val.(*memoryCacheEntry)
+		if entry.expiresAt.IsZero() {
+			return entry.value, 0, nil
+		}
+		ttl := time.Until(entry.expiresAt)
+		if ttl <= 0 {
+			if c.lru.Remove(key) {
+				RecordMemoryCacheEviction("expired")
+			}
+			markCacheLookupStale(ctx)
+			return "", 0, nil
+		}
+		return entry.value, ttl, nil
 	}
-	return "", nil
+	return "", 0, nil
 }
 
 func (c *cache) Put(ctx context.Context, key string, value string) error {
-	c.lru.Add(key, value)
+	c.add(key, &memoryCacheEntry{value: value})
+	return nil
+}
+
+func (c *cache) PutWithTTL(ctx context.Context, key string, value string, ttl time.Duration) error {
+	entry := &memoryCacheEntry{value: value}
+	if ttl > 0 {
+		entry.expiresAt = time.Now().Add(ttl)
+	}
+	c.add(key, entry)
 	return nil
 }
 
+func (c *cache) Delete(ctx context.Context, key string) (bool, error) {
+	return c.lru.Remove(key), nil
+}
+
+func (c *cache) Purge(ctx context.Context, prefix string) (int, error) {
+	return purgeLRU(c.lru, prefix), nil
+}
+
+// Size returns the number of entries of the cache and their size in bytes.
+func (c *cache) Size() (int, int64) {
+	return c.lru.Len(), c.bytes.Load()
+}
+
+func purgeLRU(l *lru.Cache, prefix string) int {
+	var n int
+	for _, key := range l.Keys() {
+		if strings.HasPrefix(key.(string), prefix) && l.Remove(key) {
+			n++
+		}
+	}
+	return n
+}
+
+func (c *cache) add(key string, entry *memoryCacheEntry) {
+	size := memoryCacheEntrySize(key, entry.value)
+	if size > c.maxBytes {
+		return
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	// replaced entries are not passed to the eviction callback, account for
+	// them explicitly
+	c.lru.Remove(key)
+	c.bytes.Add(size)
+	memoryCacheSizeBytes.Add(float64(size))
+	if c.lru.Add(key, entry) {
+		RecordMemoryCacheEviction("max_entries")
+	}
+	for c.bytes.Load() > c.maxBytes {
+		if _, _, ok := c.lru.RemoveOldest(); !ok {
+			break
+		}
+		RecordMemoryCacheEviction("max_bytes")
+	}
+}
+
 type redisCache struct {
-	rdb    *redis.Client
+	rdb    redis.UniversalClient
 	prefix string
 	ttl    time.Duration
 }
 
-func newRedisCache(rdb *redis.Client, prefix string, ttl time.Duration) *redisCache {
+func newRedisCache(rdb redis.UniversalClient, prefix string, ttl time.Duration) *redisCache {
 	return &redisCache{rdb, prefix, ttl}
 }
 
@@ -66,7 +190,8 @@ func (c *redisCache) Get(ctx context.Context, key string) (string, error) {
 	val, err := c.rdb.Get(ctx, c.namespaced(key)).Result()
 	redisCacheDurationSumm.WithLabelValues("GET").Observe(float64(time.Since(start).Milliseconds()))
 
-	if err == redis.Nil {
+	// the cache is disabled while redis is unavailable
+	if err == redis.Nil || errors.Is(err, ErrRedisUnavailable) {
 		return "", nil
 	} else if err != nil {
 		RecordRedisError("CacheGet")
@@ -75,23 +200,130 @@ func (c *redisCache) Get(ctx context.Context, key string) (string, error) {
 	return val, nil
 }
 
+func (c *redisCache) GetWithTTL(ctx context.Context, key string) (string, time.Duration, error) {
+	start := time.Now()
+	var get *redis.StringCmd
+	var pttl *redis.DurationCmd
+	_, err := c.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		get = pipe.Get(ctx, c.namespaced(key))
+		pttl = pipe.PTTL(ctx, c.namespaced(key))
+		return nil
+	})
+	redisCacheDurationSumm.WithLabelValues("GET").Observe(float64(time.Since(start).Milliseconds()))
+
+	if err == redis.Nil || errors.Is(err, ErrRedisUnavailable) {
+		return "", 0, nil
+	} else if err != nil {
+		RecordRedisError("CacheGet")
+		return "", 0, err
+	}
+	// PTTL is negative for keys without a TTL
+	ttl := pttl.Val()
+	if ttl < 0 {
+		ttl = 0
+	}
+	return get.Val(), ttl, nil
+}
+
 func (c *redisCache) Put(ctx context.Context, key string, value string) error {
+	return c.PutWithTTL(ctx, key, value, c.ttl)
+}
+
+func (c *redisCache) PutWithTTL(ctx context.Context, key string, value string, ttl time.Duration) error {
 	start := time.Now()
-	err := c.rdb.SetEx(ctx, c.namespaced(key), value, c.ttl).Err()
+	// unlike SETEX, SET supports millisecond precision
+	err := c.rdb.Set(ctx, c.namespaced(key), value, ttl).Err()
 	redisCacheDurationSumm.WithLabelValues("SETEX").Observe(float64(time.Since(start).Milliseconds()))
 
+	if errors.Is(err, ErrRedisUnavailable) {
+		return nil
+	}
 	if err != nil {
 		RecordRedisError("CacheSet")
 	}
 	return err
 }
 
+func (c *redisCache) Delete(ctx context.Context, key string) (bool, error) {
+	start := time.Now()
+	n, err := c.rdb.Del(ctx, c.namespaced(key)).Result()
+	redisCacheDurationSumm.WithLabelValues("DEL").Observe(float64(time.Since(start).Milliseconds()))
+
+	if err != nil {
+		RecordRedisError("CacheDelete")
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// Purge scans for the keys starting with prefix and deletes them in batches.
+// In a Redis Cluster every master is scanned. Keys set while purging may not
+// be removed.
+func (c *redisCache) Purge(ctx context.Context, prefix string) (int, error) {
+	start := time.Now()
+	defer func() {
+		redisCacheDurationSumm.WithLabelValues("PURGE").Observe(float64(time.Since(start).Milliseconds()))
+	}()
+
+	match := redisGlobEscaper.Replace(c.namespaced(prefix)) + "*"
+	cluster, ok := c.rdb.(*redis.ClusterClient)
+	if !ok {
+		return c.purgeNode(ctx, c.rdb, match)
+	}
+	var n atomic.Int64
+	err := cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+		deleted, err := c.purgeNode(ctx, node, match)
+		n.Add(int64(deleted))
+		return err
+	})
+	return int(n.Load()), err
+}
+
+// purgeNode deletes the keys of node matching match. The keys of a batch are
+// deleted one per command, since in a Redis Cluster they may belong to
+// different hash slots.
+func (c *redisCache) purgeNode(ctx context.Context, node redis.Cmdable, match string) (int, error) {
+	var cursor uint64
+	var n int
+	for {
+		keys, next, err := node.Scan(ctx, cursor, match, redisPurgeBatchSize).Result()
+		if err != nil {
+			RecordRedisError("CachePurge")
+			return n, err
+		}
+		if len(keys) > 0 {
+			cmds, err := node.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+				for _, key := range keys {
+					pipe.Del(ctx, key)
+				}
+				return nil
+			})
+			if err != nil {
+				RecordRedisError("CachePurge")
+				return n, err
+			}
+			for _, cmd := range cmds {
+				n += int(cmd.(*redis.IntCmd).Val())
+			}
+		}
+		if next == 0 {
+			return n, nil
+		}
+		cursor = next
+	}
+}
+
+const redisPurgeBatchSize = 1000
+
+var redisGlobEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
+
 type cacheWithCompression struct {
 	cache Cache
+	codec CacheCodec
 }
 
-func newCacheWithCompression(cache Cache) *cacheWithCompression {
-	return &cacheWithCompression{cache}
+func newCacheWithCompression(cache Cache, codec CacheCodec) *cacheWithCompression {
+	return &cacheWithCompression{cache: cache, codec: codec}
 }
 
 func (c *cacheWithCompression) Get(ctx context.Context, key string) (string, error) {
@@ -102,29 +334,225 @@ func (c *cacheWithCompression) Get(ctx context.Context, key string) (string, err
 	if encodedVal == "" {
 		return "", nil
 	}
-	val, err := snappy.Decode(nil, []byte(encodedVal))
+	val, err := c.codec.Decode([]byte(encodedVal))
 	if err != nil {
-		return "", err
+		// values cached with another codec are treated as misses
+		log.Debug("error decoding cached value", "key", key, "err", err)
+		return "", nil
 	}
 	return string(val), nil
 }
 
+// GetWithTTL returns a zero ttl if the underlying cache doesn't report TTLs.
+func (c *cacheWithCompression) GetWithTTL(ctx context.Context, key string) (string, time.Duration, error) {
+	tc, ok := c.cache.(ttlGetter)
+	if !ok {
+		val, err := c.Get(ctx, key)
+		return val, 0, err
+	}
+	encodedVal, ttl, err := tc.GetWithTTL(ctx, key)
+	if err != nil {
+		return "", 0, err
+	}
+	if encodedVal == "" {
+		return "", 0, nil
+	}
+	val, err := c.codec.Decode([]byte(encodedVal))
+	if err != nil {
+		log.Debug("error decoding cached value", "key", key, "err", err)
+		return "", 0, nil
+	}
+	return string(val), ttl, nil
+}
+
 func (c *cacheWithCompression) Put(ctx context.Context, key string, value string) error {
-	encodedVal := snappy.Encode(nil, []byte(value))
+	encodedVal := c.codec.Encode([]byte(value))
 	return c.cache.Put(ctx, key, string(encodedVal))
 }
 
+func (c *cacheWithCompression) PutWithTTL(ctx context.Context, key string, value string, ttl time.Duration) error {
+	encodedVal := c.codec.Encode([]byte(value))
+	return c.cache.PutWithTTL(ctx, key, string(encodedVal), ttl)
+}
+
+func (c *cacheWithCompression) Delete(ctx context.Context, key string) (bool, error) {
+	return c.cache.Delete(ctx, key)
+}
+
+func (c *cacheWithCompression) Purge(ctx context.Context, prefix string) (int, error) {
+	return c.cache.Purge(ctx, prefix)
+}
+
+// tieredCache serves hot keys from a size-bounded in-process LRU in front of a
+// remote cache. Local entries expire after a short TTL, or earlier if their
+// remote entry does, or as soon as a new block is observed if a block number
+// function is given.
+type tieredCache struct {
+	local         *lru.Cache
+	remote        Cache
+	ttl           time.Duration
+	getBlockNumFn GetBlockNumFn
+}
+
+type tieredCacheEntry struct {
+	value     string
+	expiresAt time.Time
+	blockNum  uint64
+}
+
+func newTieredCache(remote Cache, size int, ttl time.Duration, getBlockNumFn GetBlockNumFn) *tieredCache {
+	local, _ := lru.New(size)
+	return &tieredCache{
+		local:         local,
+		remote:        remote,
+		ttl:           ttl,
+		getBlockNumFn: getBlockNumFn,
+	}
+}
+
+func (c *tieredCache) blockNum(ctx context.Context) uint64 {
+	if c.getBlockNumFn == nil {
+		return 0
+	}
+	blockNum, err := c.getBlockNumFn(ctx)
+	if err != nil {
+		return 0
+	}
+	return blockNum
+}
+
+func (c *tieredCache) Get(ctx context.Context, key string) (string, error) {
+	blockNum := c.blockNum(ctx)
+	if val, ok := c.local.Get(key); ok {
+		entry := val.(*tieredCacheEntry)
+		if time.Now().Before(entry.expiresAt) && entry.blockNum >= blockNum {
+			localCacheRequestsTotal.WithLabelValues("hit").Inc()
+			return entry.value, nil
+		}
+		c.local.Remove(key)
+		markCacheLookupStale(ctx)
+	}
+	localCacheRequestsTotal.WithLabelValues("miss").Inc()
+
+	var val string
+	var ttl time.Duration
+	var err error
+	if remote, ok := c.remote.(ttlGetter); ok {
+		val, ttl, err = remote.GetWithTTL(ctx, key)
+	} else {
+		val, err = c.remote.Get(ctx, key)
+	}
+	if err != nil || val == "" {
+		return val, err
+	}
+	c.putLocal(key, val, ttl, blockNum)
+	return val, nil
+}
+
+func (c *tieredCache) Put(ctx context.Context, key string, value string) error {
+	c.putLocal(key, value, c.ttl, c.blockNum(ctx))
+	return c.remote.Put(ctx, key, value)
+}
+
+func (c *tieredCache) PutWithTTL(ctx context.Context, key string, value string, ttl time.Duration) error {
+	c.putLocal(key, value, ttl, c.blockNum(ctx))
+	return c.remote.PutWithTTL(ctx, key, value, ttl)
+}
+
+func (c *tieredCache) Delete(ctx context.Context, key string) (bool, error) {
+	c.local.Remove(key)
+	return c.remote.Delete(ctx, key)
+}
+
+func (c *tieredCache) Purge(ctx context.Context, prefix string) (int, error) {
+	purgeLRU(c.local, prefix)
+	return c.remote.Purge(ctx, prefix)
+}
+
+// putLocal caches value locally for ttl, bounded by the local TTL. A zero ttl
+// doesn't expire, so the local TTL applies.
+func (c *tieredCache) putLocal(key string, value string, ttl time.Duration, blockNum uint64) {
+	if ttl <= 0 || ttl > c.ttl {
+		ttl = c.ttl
+	}
+	c.local.Add(key, &tieredCacheEntry{
+		value:     value,
+		expiresAt: time.Now().Add(ttl),
+		blockNum:  blockNum,
+	})
+}
+
 type RPCCache interface {
 	GetRPC(ctx context.Context, req *RPCReq) (*RPCRes, error)
 	PutRPC(ctx context.Context, req *RPCReq, res *RPCRes) error
+	// InspectRPC looks up the cached response of req without recording the
+	// lookup.
+	InspectRPC(ctx context.Context, req *RPCReq) (*RPCCacheInspection, error)
+	// DeleteRPC removes the cached response of req.
+	DeleteRPC(ctx context.Context, req *RPCReq) (bool, error)
+	// PurgeRPC removes the cached responses of method, or of all methods if
+	// method is empty.
+	PurgeRPC(ctx context.Context, method string) (int, error)
+	Stats() *RPCCacheStats
+}
+
+// RPCCacheInspection describes how a request is cached.
+type RPCCacheInspection struct {
+	Method    string      `json:"method"`
+	Cacheable bool        `json:"cacheable"`
+	Key       string      `json:"key,omitempty"`
+	Hit       bool        `json:"hit"`
+	Result    interface{} `json:"result,omitempty"`
+}
+
+// RPCCacheStats are the lookups of each cached method since startup, and the
+// size of the in-memory caches, if any.
+type RPCCacheStats struct {
+	Methods   map[string]*RPCCacheMethodStats `json:"methods"`
+	Entries   *int                            `json:"entries,omitempty"`
+	SizeBytes *int64                          `json:"size_bytes,omitempty"`
+}
+
+type RPCCacheMethodStats struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+	// Stale are the lookups finding an expired entry, which are not misses.
+	Stale  uint64 `json:"stale"`
+	Errors uint64 `json:"errors"`
+	// SavedBytes is the size of the cached results served.
+	SavedBytes uint64 `json:"saved_bytes"`
+}
+
+type rpcCacheCounters struct {
+	hits       atomic.Uint64
+	misses     atomic.Uint64
+	stale      atomic.Uint64
+	errors     atomic.Uint64
+	savedBytes atomic.Uint64
 }
 
 type rpcCache struct {
 	cache    Cache
 	handlers map[string]RPCMethodHandler
+	counters map[string]*rpcCacheCounters
+}
+
+// GetBlockNumFn returns a block number tracked by a last value cache.
+type GetBlockNumFn func(ctx context.Context) (uint64, error)
+
+// rpcCacheOptions holds the cache policies of an rpcCache and the block
+// numbers they are evaluated against. Unset block number functions disable the
+// policies relying on them.
+type rpcCacheOptions struct {
+	methods                map[string]*CacheMethodConfig
+	getLatestBlockNumFn    GetBlockNumFn
+	getSafeBlockNumFn      GetBlockNumFn
+	getFinalizedBlockNumFn GetBlockNumFn
+	autoConfirmations      *AutoConfirmations
+	extraHandlers          map[string]RPCMethodHandler
 }
 
-func newRPCCache(cache Cache) RPCCache {
+func newRPCCache(cache Cache, opts rpcCacheOptions) RPCCache {
 	staticHandler := &StaticMethodHandler{cache: cache}
 	debugGetRawReceiptsHandler := &StaticMethodHandler{cache: cache,
 		filterGet: func(req *RPCReq) bool {
@@ -159,9 +587,20 @@ func newRPCCache(cache Cache) RPCCache {
 		"eth_getUncleByBlockHashAndIndex":       staticHandler,
 		"debug_getRawReceipts":                  debugGetRawReceiptsHandler,
 	}
+	for method, handler := range opts.extraHandlers {
+		handlers[method] = handler
+	}
+	for method, cfg := range opts.methods {
+		handlers[method] = newMethodPolicyHandler(cache, method, cfg, opts)
+	}
+	counters := make(map[string]*rpcCacheCounters, len(handlers))
+	for method := range handlers {
+		counters[method] = new(rpcCacheCounters)
+	}
 	return &rpcCache{
 		cache:    cache,
 		handlers: handlers,
+		counters: counters,
 	}
 }
 
@@ -170,15 +609,35 @@ func (c *rpcCache) GetRPC(ctx context.Context, req *RPCReq) (*RPCRes, error) {
 	if handler == nil {
 		return nil, nil
 	}
+	// the caller may look up the outcome
+	lookup := getCacheLookup(ctx)
+	if lookup == nil {
+		ctx, lookup = withCacheLookup(ctx)
+	}
+	counters := c.counters[req.Method]
 	res, err := handler.GetRPCMethod(ctx, req)
 	if err != nil {
+		counters.errors.Add(1)
 		RecordCacheError(req.Method)
 		return nil, err
 	}
-	if res == nil {
-		RecordCacheMiss(req.Method)
-	} else {
+	switch lookup.result(res) {
+	case CacheResultHit:
+		// synthesized results don't come from a cached value
+		bytes := lookup.bytes
+		if bytes == 0 {
+			bytes = len(mustMarshalJSON(res.Result))
+		}
+		counters.hits.Add(1)
+		counters.savedBytes.Add(uint64(bytes))
 		RecordCacheHit(req.Method)
+		RecordCacheSavedBytes(req.Method, bytes)
+	case CacheResultStale:
+		counters.stale.Add(1)
+		RecordCacheStale(req.Method)
+	default:
+		counters.misses.Add(1)
+		RecordCacheMiss(req.Method)
 	}
 	return res, nil
 }
@@ -190,3 +649,99 @@ func (c *rpcCache) PutRPC(ctx context.Context, req *RPCReq, res *RPCRes) error {
 	}
 	return handler.PutRPCMethod(ctx, req, res)
 }
+
+func (c *rpcCache) InspectRPC(ctx context.Context, req *RPCReq) (*RPCCacheInspection, error) {
+	inspection := &RPCCacheInspection{Method: req.Method}
+	handler := c.handlers[req.Method]
+	if handler == nil {
+		return inspection, nil
+	}
+	inspection.Key, inspection.Cacheable = handler.CacheKey(req)
+	if !inspection.Cacheable {
+		return inspection, nil
+	}
+	res, err := handler.GetRPCMethod(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if res != nil {
+		inspection.Hit = true
+		inspection.Result = res.Result
+	}
+	return inspection, nil
+}
+
+func (c *rpcCache) DeleteRPC(ctx context.Context, req *RPCReq) (bool, error) {
+	handler := c.handlers[req.Method]
+	if handler == nil {
+		return false, nil
+	}
+	return handler.DeleteRPCMethod(ctx, req)
+}
+
+func (c *rpcCache) PurgeRPC(ctx context.Context, method string) (int, error) {
+	if method != "" {
+		handler := c.handlers[method]
+		if handler == nil {
+			return 0, fmt.Errorf("%w: %s", ErrMethodNotCached, method)
+		}
+		return handler.PurgeRPCMethod(ctx, method)
+	}
+
+	var n int
+	for method, handler := range c.handlers {
+		purged, err := handler.PurgeRPCMethod(ctx, method)
+		n += purged
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func (c *rpcCache) Stats() *RPCCacheStats {
+	stats := &RPCCacheStats{
+		Methods: make(map[string]*RPCCacheMethodStats, len(c.counters)),
+	}
+	for method, counters := range c.counters {
+		stats.Methods[method] = &RPCCacheMethodStats{
+			Hits:       counters.hits.Load(),
+			Misses:     counters.misses.Load(),
+			Stale:      counters.stale.Load(),
+			Errors:     counters.errors.Load(),
+			SavedBytes: counters.savedBytes.Load(),
+		}
+	}
+
+	// caches may be shared between handlers
+	seen := make(map[*cache]bool)
+	var entries int
+	var size int64
+	for _, handler := range c.handlers {
+		mc := memoryCacheOf(handler.Cache())
+		if mc == nil || seen[mc] {
+			continue
+		}
+		seen[mc] = true
+		n, b := mc.Size()
+		entries += n
+		size += b
+	}
+	if len(seen) > 0 {
+		stats.Entries = &entries
+		stats.SizeBytes = &size
+	}
+	return stats
+}
+
+// memoryCacheOf returns the in-memory cache backing c, if any.
+func memoryCacheOf(c Cache) *cache {
+	switch c := c.(type) {
+	case *cache:
+		return c
+	case *cacheWithCompression:
+		return memoryCacheOf(c.cache)
+	default:
+		return nil
+	}
+}
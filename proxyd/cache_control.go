@@ -0,0 +1,99 @@
+package proxyd
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+const (
+	// CacheControlHeader carries the cache directives of a request, for auth
+	// keys allowed to send them: "no-cache" doesn't serve the request from the
+	// cache, "no-store" doesn't cache its response.
+	CacheControlHeader = "X-Proxyd-Cache-Control"
+
+	// CacheDebugHeader tells clients whether their request was served from
+	// the cache, if enabled. Batches are hits if any of their requests is.
+	CacheDebugHeader = "X-Proxyd-Cache"
+
+	CacheResultHit   = "HIT"
+	CacheResultMiss  = "MISS"
+	CacheResultStale = "STALE"
+
+	ContextKeyCacheDirectives = "cache_directives"
+	ContextKeyCacheLookup     = "cache_lookup"
+)
+
+// CacheDirectives control how the RPC cache is used for a request.
+type CacheDirectives struct {
+	NoCache bool
+	NoStore bool
+}
+
+// ParseCacheDirectives parses the comma separated directives of h. Unknown
+// directives are ignored.
+func ParseCacheDirectives(h http.Header) CacheDirectives {
+	var directives CacheDirectives
+	for _, value := range h.Values(CacheControlHeader) {
+		for _, directive := range strings.Split(value, ",") {
+			switch strings.ToLower(strings.TrimSpace(directive)) {
+			case "no-cache":
+				directives.NoCache = true
+			case "no-store":
+				directives.NoStore = true
+			}
+		}
+	}
+	return directives
+}
+
+func GetCacheDirectives(ctx context.Context) CacheDirectives {
+	directives, _ := ctx.Value(ContextKeyCacheDirectives).(CacheDirectives)
+	return directives
+}
+
+// cacheLookup is the outcome of a lookup in the RPC cache. In-process caches
+// flag the expired entries they find, which Redis can't tell apart from
+// missing ones, and handlers report the size of the values they serve.
+type cacheLookup struct {
+	stale bool
+	bytes int
+}
+
+func withCacheLookup(ctx context.Context) (context.Context, *cacheLookup) {
+	lookup := new(cacheLookup)
+	return context.WithValue(ctx, ContextKeyCacheLookup, lookup), lookup // nolint:staticcheck
+}
+
+func getCacheLookup(ctx context.Context) *cacheLookup {
+	lookup, _ := ctx.Value(ContextKeyCacheLookup).(*cacheLookup)
+	return lookup
+}
+
+// markCacheLookupStale flags the lookup of ctx, if any, as having found an
+// expired entry.
+func markCacheLookupStale(ctx context.Context) {
+	if lookup := getCacheLookup(ctx); lookup != nil {
+		lookup.stale = true
+	}
+}
+
+// setCacheLookupBytes records the size of the value served by the lookup of
+// ctx, if any.
+func setCacheLookupBytes(ctx context.Context, n int) {
+	if lookup := getCacheLookup(ctx); lookup != nil {
+		lookup.bytes = n
+	}
+}
+
+// result returns the header value of the lookup of res.
+func (l *cacheLookup) result(res *RPCRes) string {
+	switch {
+	case res != nil:
+		return CacheResultHit
+	case l.stale:
+		return CacheResultStale
+	default:
+		return CacheResultMiss
+	}
+}
@@ -2,8 +2,11 @@ package proxyd
 
 import (
 	"context"
+	"encoding/json"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -11,7 +14,7 @@ import (
 func TestRPCCacheImmutableRPCs(t *testing.T) {
 	ctx := context.Background()
 
-	cache := newRPCCache(newMemoryCache())
+	cache := newRPCCache(newMemoryCache(0, 0), rpcCacheOptions{})
 	ID := []byte(strconv.Itoa(1))
 
 	rpcs := []struct {
@@ -132,7 +135,7 @@ func TestRPCCacheImmutableRPCs(t *testing.T) {
 func TestRPCCacheUnsupportedMethod(t *testing.T) {
 	ctx := context.Background()
 
-	cache := newRPCCache(newMemoryCache())
+	cache := newRPCCache(newMemoryCache(0, 0), rpcCacheOptions{})
 	ID := []byte(strconv.Itoa(1))
 
 	rpcs := []struct {
@@ -211,3 +214,554 @@ func TestRPCCacheUnsupportedMethod(t *testing.T) {
 	}
 
 }
+
+func TestRPCCacheMethodPolicies(t *testing.T) {
+	ctx := context.Background()
+
+	var latest, safe, finalized uint64 = 100, 95, 90
+	getLatest := func(ctx context.Context) (uint64, error) { return latest, nil }
+	getSafe := func(ctx context.Context) (uint64, error) { return safe, nil }
+	getFinalized := func(ctx context.Context) (uint64, error) { return finalized, nil }
+	autoConfirmations := NewAutoConfirmations("main", 0, time.Hour)
+	methods := map[string]*CacheMethodConfig{
+		"eth_call": {
+			TTL:         TOMLDuration(50 * time.Millisecond),
+			PinnedBlock: true,
+		},
+		"eth_getBalance": {
+			MinConfirmations: 10,
+		},
+		"eth_getTransactionReceipt": {
+			Finalized: true,
+		},
+		"eth_getCode": {
+			MaxSizeBytes: 8,
+		},
+		"eth_getStorageAt": {
+			AutoConfirmations: true,
+		},
+		"eth_getTransactionByHash": {
+			NegativeTTL: TOMLDuration(50 * time.Millisecond),
+		},
+		"eth_getBlockTransactionCountByNumber": {
+			Safe: true,
+		},
+		"eth_getProof": {
+			MinConfirmations: 20,
+		},
+		"eth_getBlockByNumber": {
+			TTL:               TOMLDuration(50 * time.Millisecond),
+			FinalizedNoExpiry: true,
+		},
+	}
+	cache := newRPCCache(newMemoryCache(0, 0), rpcCacheOptions{
+		methods:                methods,
+		getLatestBlockNumFn:    getLatest,
+		getSafeBlockNumFn:      getSafe,
+		getFinalizedBlockNumFn: getFinalized,
+		autoConfirmations:      autoConfirmations,
+	})
+	ID := []byte(strconv.Itoa(1))
+
+	req := func(method string, params ...interface{}) *RPCReq {
+		return &RPCReq{
+			JSONRPC: "2.0",
+			Method:  method,
+			Params:  mustMarshalJSON(params),
+			ID:      ID,
+		}
+	}
+	res := func(result interface{}) *RPCRes {
+		return &RPCRes{
+			JSONRPC: "2.0",
+			Result:  result,
+			ID:      ID,
+		}
+	}
+	requireCached := func(t *testing.T, req *RPCReq, res *RPCRes, cached bool) {
+		require.NoError(t, cache.PutRPC(ctx, req, res))
+		cachedRes, err := cache.GetRPC(ctx, req)
+		require.NoError(t, err)
+		if cached {
+			require.Equal(t, res, cachedRes)
+		} else {
+			require.Nil(t, cachedRes)
+		}
+	}
+
+	t.Run("pinned block with ttl", func(t *testing.T) {
+		pinned := req("eth_call", map[string]string{"to": "0x1"}, "0x10")
+		requireCached(t, pinned, res("0x01"), true)
+		time.Sleep(100 * time.Millisecond)
+		cachedRes, err := cache.GetRPC(ctx, pinned)
+		require.NoError(t, err)
+		require.Nil(t, cachedRes)
+
+		requireCached(t, req("eth_call", map[string]string{"to": "0x1"}, "latest"), res("0x01"), false)
+	})
+
+	t.Run("min confirmations", func(t *testing.T) {
+		requireCached(t, req("eth_getBalance", "0x1", "0x5a"), res("0x01"), true)
+		requireCached(t, req("eth_getBalance", "0x1", "0x5b"), res("0x01"), false)
+		requireCached(t, req("eth_getBalance", "0x1", "latest"), res("0x01"), false)
+	})
+
+	t.Run("finalized", func(t *testing.T) {
+		requireCached(t, req("eth_getTransactionReceipt", "0xabc"), res(map[string]interface{}{"blockNumber": "0x5a"}), true)
+		requireCached(t, req("eth_getTransactionReceipt", "0xdef"), res(map[string]interface{}{"blockNumber": "0x5b"}), false)
+	})
+
+	t.Run("safe", func(t *testing.T) {
+		requireCached(t, req("eth_getBlockTransactionCountByNumber", "0x5f"), res("0x01"), true)
+		requireCached(t, req("eth_getBlockTransactionCountByNumber", "0x60"), res("0x01"), false)
+	})
+
+	t.Run("finalized blocks are confirmed", func(t *testing.T) {
+		requireCached(t, req("eth_getProof", "0x1", []string{}, "0x5a"), res("0x01"), true)
+		requireCached(t, req("eth_getProof", "0x1", []string{}, "0x5b"), res("0x01"), false)
+	})
+
+	t.Run("finalized no expiry", func(t *testing.T) {
+		finalizedBlock := req("eth_getBlockByNumber", "0x5a", false)
+		recentBlock := req("eth_getBlockByNumber", "0x5b", false)
+		requireCached(t, finalizedBlock, res(map[string]interface{}{"number": "0x5a"}), true)
+		requireCached(t, recentBlock, res(map[string]interface{}{"number": "0x5b"}), true)
+		time.Sleep(100 * time.Millisecond)
+		cachedRes, err := cache.GetRPC(ctx, finalizedBlock)
+		require.NoError(t, err)
+		require.NotNil(t, cachedRes)
+		cachedRes, err = cache.GetRPC(ctx, recentBlock)
+		require.NoError(t, err)
+		require.Nil(t, cachedRes)
+	})
+
+	t.Run("auto confirmations", func(t *testing.T) {
+		requireCached(t, req("eth_getStorageAt", "0x1", "0x0", "0x63"), res("0x01"), true)
+
+		// reorgs deepen the required confirmations
+		autoConfirmations.ObserveReorg(5)
+		require.Equal(t, uint64(6), autoConfirmations.Confirmations())
+		requireCached(t, req("eth_getStorageAt", "0x1", "0x0", "0x5e"), res("0x01"), true)
+		requireCached(t, req("eth_getStorageAt", "0x1", "0x0", "0x5f"), res("0x01"), false)
+
+		// bounded by the distance to the safe block
+		autoConfirmations.ObserveConsensus(100, 97, 90)
+		require.Equal(t, uint64(3), autoConfirmations.Confirmations())
+		requireCached(t, req("eth_getStorageAt", "0x1", "0x0", "0x61"), res("0x01"), true)
+	})
+
+	t.Run("negative ttl", func(t *testing.T) {
+		pending := req("eth_getTransactionByHash", "0xabc")
+		requireCached(t, pending, res(nil), true)
+		time.Sleep(100 * time.Millisecond)
+		cachedRes, err := cache.GetRPC(ctx, pending)
+		require.NoError(t, err)
+		require.Nil(t, cachedRes)
+
+		// null results of policies without negative ttl are not cached
+		requireCached(t, req("eth_getTransactionReceipt", "0x123"), res(nil), false)
+	})
+
+	t.Run("max size", func(t *testing.T) {
+		requireCached(t, req("eth_getCode", "0x1", "latest"), res("0x01"), true)
+		requireCached(t, req("eth_getCode", "0x2", "latest"), res("0x0102030405"), false)
+	})
+}
+
+func TestRPCCacheEthCall(t *testing.T) {
+	ctx := context.Background()
+
+	var latest uint64 = 100
+	getLatest := func(ctx context.Context) (uint64, error) { return latest, nil }
+	handler := newEthCallHandler(newMemoryCache(0, 0), EthCallCacheConfig{
+		Enabled:          true,
+		MinConfirmations: 10,
+		MaxEntryBytes:    16,
+	}, getLatest)
+	cache := newRPCCache(newMemoryCache(0, 0), rpcCacheOptions{extraHandlers: map[string]RPCMethodHandler{"eth_call": handler}})
+	ID := []byte(strconv.Itoa(1))
+
+	req := func(params string) *RPCReq {
+		return &RPCReq{
+			JSONRPC: "2.0",
+			Method:  "eth_call",
+			Params:  json.RawMessage(params),
+			ID:      ID,
+		}
+	}
+	res := &RPCRes{
+		JSONRPC: "2.0",
+		Result:  "0x01",
+		ID:      ID,
+	}
+	get := func(t *testing.T, req *RPCReq) *RPCRes {
+		cachedRes, err := cache.GetRPC(ctx, req)
+		require.NoError(t, err)
+		return cachedRes
+	}
+
+	t.Run("keyed by normalized call and block", func(t *testing.T) {
+		require.NoError(t, cache.PutRPC(ctx, req(`[{"to":"0xAB","data":"0x01"},"0x5a"]`), res))
+		require.Equal(t, res, get(t, req(`[{"data":"0x01", "to":"0xab"},"0x5a"]`)))
+		require.Equal(t, res, get(t, req(`[{"to":"0xab","data":"0x01"},{"blockNumber":"0x5a"}]`)))
+		require.Nil(t, get(t, req(`[{"to":"0xab","data":"0x02"},"0x5a"]`)))
+		require.Nil(t, get(t, req(`[{"to":"0xab","data":"0x01"},"0x59"]`)))
+	})
+
+	t.Run("block hash", func(t *testing.T) {
+		hash := "0x" + strings.Repeat("ab", 32)
+		require.NoError(t, cache.PutRPC(ctx, req(`[{"to":"0xab"},"`+hash+`"]`), res))
+		require.Equal(t, res, get(t, req(`[{"to":"0xab"},{"blockHash":"`+hash+`"}]`)))
+	})
+
+	t.Run("min confirmations", func(t *testing.T) {
+		require.NoError(t, cache.PutRPC(ctx, req(`[{"to":"0xab"},"0x5b"]`), res))
+		require.Nil(t, get(t, req(`[{"to":"0xab"},"0x5b"]`)))
+	})
+
+	t.Run("block tags and state overrides", func(t *testing.T) {
+		for _, params := range []string{
+			`[{"to":"0xab"},"latest"]`,
+			`[{"to":"0xab"}]`,
+			`[{"to":"0xab"},"0x1",{"0xab":{"balance":"0x1"}}]`,
+		} {
+			require.NoError(t, cache.PutRPC(ctx, req(params), res))
+			require.Nil(t, get(t, req(params)))
+		}
+	})
+
+	t.Run("max entry size", func(t *testing.T) {
+		large := &RPCRes{JSONRPC: "2.0", Result: "0x0102030405060708", ID: ID}
+		require.NoError(t, cache.PutRPC(ctx, req(`[{"to":"0xcd"},"0x1"]`), large))
+		require.Nil(t, get(t, req(`[{"to":"0xcd"},"0x1"]`)))
+	})
+}
+
+func TestRPCCacheEthGetLogs(t *testing.T) {
+	ctx := context.Background()
+
+	var latest, finalized uint64 = 100, 90
+	getLatest := func(ctx context.Context) (uint64, error) { return latest, nil }
+	getFinalized := func(ctx context.Context) (uint64, error) { return finalized, nil }
+	handler := newEthGetLogsHandler(newMemoryCache(0, 0), EthGetLogsCacheConfig{
+		Enabled:       true,
+		MaxEntryBytes: 64,
+	}, getLatest, getFinalized)
+	cache := newRPCCache(newMemoryCache(0, 0), rpcCacheOptions{extraHandlers: map[string]RPCMethodHandler{"eth_getLogs": handler}})
+	ID := []byte(strconv.Itoa(1))
+
+	req := func(filter string) *RPCReq {
+		return &RPCReq{
+			JSONRPC: "2.0",
+			Method:  "eth_getLogs",
+			Params:  json.RawMessage("[" + filter + "]"),
+			ID:      ID,
+		}
+	}
+	res := &RPCRes{
+		JSONRPC: "2.0",
+		Result:  []interface{}{"log"},
+		ID:      ID,
+	}
+	get := func(t *testing.T, req *RPCReq) *RPCRes {
+		cachedRes, err := cache.GetRPC(ctx, req)
+		require.NoError(t, err)
+		return cachedRes
+	}
+
+	t.Run("normalized keys", func(t *testing.T) {
+		require.NoError(t, cache.PutRPC(ctx, req(`{"fromBlock":"0x10","toBlock":"0x20","address":["0xB","0xa"],"topics":[["0x2","0x1"],null]}`), res))
+		require.Equal(t, res, get(t, req(`{"toBlock":"0x20","fromBlock":"0x10","address":["0xa","0xb"],"topics":[["0x1","0x2"]]}`)))
+		require.Nil(t, get(t, req(`{"fromBlock":"0x10","toBlock":"0x21","address":["0xa","0xb"],"topics":[["0x1","0x2"]]}`)))
+		require.Nil(t, get(t, req(`{"fromBlock":"0x10","toBlock":"0x20","address":["0xa","0xb"],"topics":[null,["0x1","0x2"]]}`)))
+	})
+
+	t.Run("single address", func(t *testing.T) {
+		require.NoError(t, cache.PutRPC(ctx, req(`{"fromBlock":"0x10","toBlock":"0x20","address":"0xC"}`), res))
+		require.Equal(t, res, get(t, req(`{"fromBlock":"0x10","toBlock":"0x20","address":["0xc"]}`)))
+	})
+
+	t.Run("unfinalized ranges", func(t *testing.T) {
+		require.NoError(t, cache.PutRPC(ctx, req(`{"fromBlock":"0x10","toBlock":"0x5b"}`), res))
+		require.Nil(t, get(t, req(`{"fromBlock":"0x10","toBlock":"0x5b"}`)))
+	})
+
+	t.Run("block tags and hashes", func(t *testing.T) {
+		for _, filter := range []string{
+			`{"fromBlock":"0x10","toBlock":"latest"}`,
+			`{"fromBlock":"0x10"}`,
+			`{"blockHash":"0x` + strings.Repeat("ab", 32) + `"}`,
+		} {
+			require.NoError(t, cache.PutRPC(ctx, req(filter), res))
+			require.Nil(t, get(t, req(filter)))
+		}
+	})
+
+	t.Run("max entry size", func(t *testing.T) {
+		large := &RPCRes{JSONRPC: "2.0", Result: []interface{}{strings.Repeat("a", 64)}, ID: ID}
+		require.NoError(t, cache.PutRPC(ctx, req(`{"fromBlock":"0x1","toBlock":"0x2"}`), large))
+		require.Nil(t, get(t, req(`{"fromBlock":"0x1","toBlock":"0x2"}`)))
+	})
+}
+
+func TestRPCCacheEthFeeHistory(t *testing.T) {
+	ctx := context.Background()
+
+	var latest uint64 = 100
+	getLatest := func(ctx context.Context) (uint64, error) { return latest, nil }
+	window := newLVC(nil, newMemoryCache(0, 0), "lvc:fee_history", nil)
+	handler := newEthFeeHistoryHandler(newMemoryCache(0, 0), EthFeeHistoryCacheConfig{
+		Enabled:               true,
+		SynthesizeBlocks:      3,
+		SynthesizePercentiles: []float64{25, 50, 75},
+	}, getLatest, window)
+	cache := newRPCCache(newMemoryCache(0, 0), rpcCacheOptions{extraHandlers: map[string]RPCMethodHandler{"eth_feeHistory": handler}})
+	ID := []byte(strconv.Itoa(1))
+
+	req := func(params string) *RPCReq {
+		return &RPCReq{
+			JSONRPC: "2.0",
+			Method:  "eth_feeHistory",
+			Params:  json.RawMessage(params),
+			ID:      ID,
+		}
+	}
+	history := func(oldest string) *RPCRes {
+		return &RPCRes{
+			JSONRPC: "2.0",
+			Result: map[string]interface{}{
+				"oldestBlock":   oldest,
+				"baseFeePerGas": []interface{}{"0x1", "0x2", "0x3"},
+				"gasUsedRatio":  []interface{}{0.5, 0.25},
+				"reward":        []interface{}{[]interface{}{"0x1"}, []interface{}{"0x2"}},
+			},
+			ID: ID,
+		}
+	}
+	get := func(t *testing.T, req *RPCReq) *RPCRes {
+		cachedRes, err := cache.GetRPC(ctx, req)
+		require.NoError(t, err)
+		return cachedRes
+	}
+
+	t.Run("normalized keys", func(t *testing.T) {
+		require.NoError(t, cache.PutRPC(ctx, req(`["0x2","0x50",[50]]`), history("0x4f")))
+		require.Equal(t, history("0x4f"), get(t, req(`[2,"0x50",[50.0]]`)))
+		require.Nil(t, get(t, req(`["0x2","0x50",[25]]`)))
+		require.Nil(t, get(t, req(`["0x3","0x50",[50]]`)))
+	})
+
+	t.Run("latest is invalidated by new blocks", func(t *testing.T) {
+		require.NoError(t, cache.PutRPC(ctx, req(`["0x2","latest",[50]]`), history("0x63")))
+		require.Equal(t, history("0x63"), get(t, req(`["0x2","latest",[50]]`)))
+		require.Equal(t, history("0x63"), get(t, req(`["0x2","0x64",[50]]`)))
+
+		latest = 101
+		defer func() { latest = 100 }()
+		require.Nil(t, get(t, req(`["0x2","latest",[50]]`)))
+	})
+
+	t.Run("lagging backends", func(t *testing.T) {
+		require.NoError(t, cache.PutRPC(ctx, req(`["0x2","latest",[10]]`), history("0x62")))
+		require.Nil(t, get(t, req(`["0x2","latest",[10]]`)))
+	})
+
+	t.Run("future and tagged blocks", func(t *testing.T) {
+		for _, params := range []string{`["0x2","0x65",[50]]`, `["0x2","pending",[50]]`, `["0x2","finalized",[50]]`} {
+			require.NoError(t, cache.PutRPC(ctx, req(params), history("0x64")))
+			require.Nil(t, get(t, req(params)))
+		}
+	})
+
+	t.Run("synthesized from the window", func(t *testing.T) {
+		value := `{"oldestBlock":"0x62","baseFeePerGas":["0x1","0x2","0x3","0x4"],"gasUsedRatio":[0.1,0.2,0.3],"reward":[["0x1","0x2","0x3"],["0x4","0x5","0x6"],["0x7","0x8","0x9"]]}`
+		window.last.Store(&value)
+
+		res := get(t, req(`["0x2","latest",[25,75]]`))
+		require.NotNil(t, res)
+		require.Equal(t, `{"baseFeePerGas":["0x2","0x3","0x4"],"gasUsedRatio":[0.2,0.3],"oldestBlock":"0x63","reward":[["0x4","0x6"],["0x7","0x9"]]}`, string(mustMarshalJSON(res.Result)))
+
+		res = get(t, req(`["0x1","latest"]`))
+		require.NotNil(t, res)
+		require.Equal(t, `{"baseFeePerGas":["0x3","0x4"],"gasUsedRatio":[0.3],"oldestBlock":"0x64"}`, string(mustMarshalJSON(res.Result)))
+
+		// more blocks, other percentiles and stale windows are forwarded
+		require.Nil(t, get(t, req(`["0x4","latest",[25]]`)))
+		require.Nil(t, get(t, req(`["0x2","latest",[30]]`)))
+		require.Nil(t, get(t, req(`["0x2","latest",[75,25]]`)))
+		latest = 101
+		defer func() { latest = 100 }()
+		require.Nil(t, get(t, req(`["0x2","latest",[25]]`)))
+	})
+}
+
+type countingCache struct {
+	Cache
+	gets int
+}
+
+func (c *countingCache) Get(ctx context.Context, key string) (string, error) {
+	c.gets++
+	return c.Cache.Get(ctx, key)
+}
+
+func TestTieredCache(t *testing.T) {
+	ctx := context.Background()
+
+	var blockNum uint64 = 1
+	remote := &countingCache{Cache: newMemoryCache(0, 0)}
+	cache := newTieredCache(remote, 10, 50*time.Millisecond, func(ctx context.Context) (uint64, error) {
+		return blockNum, nil
+	})
+
+	requireGet := func(t *testing.T, key string, expected string, remoteGets int) {
+		val, err := cache.Get(ctx, key)
+		require.NoError(t, err)
+		require.Equal(t, expected, val)
+		require.Equal(t, remoteGets, remote.gets)
+	}
+
+	t.Run("hot keys are served locally", func(t *testing.T) {
+		require.NoError(t, remote.Put(ctx, "foo", "bar"))
+		requireGet(t, "foo", "bar", 1)
+		requireGet(t, "foo", "bar", 1)
+	})
+
+	t.Run("local entries expire", func(t *testing.T) {
+		time.Sleep(100 * time.Millisecond)
+		requireGet(t, "foo", "bar", 2)
+		requireGet(t, "foo", "bar", 2)
+	})
+
+	t.Run("local entries are invalidated by new blocks", func(t *testing.T) {
+		blockNum++
+		requireGet(t, "foo", "bar", 3)
+		requireGet(t, "foo", "bar", 3)
+	})
+
+	t.Run("puts are written through", func(t *testing.T) {
+		require.NoError(t, cache.Put(ctx, "baz", "qux"))
+		requireGet(t, "baz", "qux", 3)
+		val, err := remote.Get(ctx, "baz")
+		require.NoError(t, err)
+		require.Equal(t, "qux", val)
+	})
+
+	t.Run("misses are not cached locally", func(t *testing.T) {
+		remote.gets = 0
+		requireGet(t, "missing", "", 1)
+		requireGet(t, "missing", "", 2)
+	})
+
+	t.Run("local entries expire with their remote entry", func(t *testing.T) {
+		remote := newMemoryCache(0, 0)
+		cache := newTieredCache(remote, 10, time.Minute, nil)
+		require.NoError(t, remote.PutWithTTL(ctx, "short", "lived", 50*time.Millisecond))
+		val, err := cache.Get(ctx, "short")
+		require.NoError(t, err)
+		require.Equal(t, "lived", val)
+
+		time.Sleep(100 * time.Millisecond)
+		val, err = cache.Get(ctx, "short")
+		require.NoError(t, err)
+		require.Empty(t, val)
+	})
+}
+
+func TestMemoryCacheBounds(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("max entries", func(t *testing.T) {
+		cache := newMemoryCache(2, 0)
+		require.NoError(t, cache.Put(ctx, "a", "1"))
+		require.NoError(t, cache.Put(ctx, "b", "2"))
+		require.NoError(t, cache.Put(ctx, "c", "3"))
+
+		val, err := cache.Get(ctx, "a")
+		require.NoError(t, err)
+		require.Empty(t, val)
+		val, err = cache.Get(ctx, "c")
+		require.NoError(t, err)
+		require.Equal(t, "3", val)
+	})
+
+	t.Run("max bytes", func(t *testing.T) {
+		cache := newMemoryCache(0, 10)
+		require.NoError(t, cache.Put(ctx, "a", "1234"))
+		require.NoError(t, cache.Put(ctx, "b", "1234"))
+		require.Equal(t, int64(10), cache.bytes.Load())
+
+		// evicts the least recently used entry to make room
+		require.NoError(t, cache.Put(ctx, "c", "1234"))
+		require.Equal(t, int64(10), cache.bytes.Load())
+		val, err := cache.Get(ctx, "a")
+		require.NoError(t, err)
+		require.Empty(t, val)
+
+		// replacing an entry accounts for the previous value
+		require.NoError(t, cache.Put(ctx, "c", "12"))
+		require.Equal(t, int64(8), cache.bytes.Load())
+
+		// entries larger than the cache are not stored
+		require.NoError(t, cache.Put(ctx, "d", "12345678901"))
+		val, err = cache.Get(ctx, "d")
+		require.NoError(t, err)
+		require.Empty(t, val)
+	})
+}
+
+func TestRPCCacheAdmin(t *testing.T) {
+	ctx := context.Background()
+	mc := newMemoryCache(0, 0)
+	cache := newRPCCache(newCacheWithCompression(mc, snappyCodec{}), rpcCacheOptions{})
+
+	chainIdReq := &RPCReq{JSONRPC: "2.0", Method: "eth_chainId", Params: []byte("null"), ID: []byte("1")}
+	blockReq := &RPCReq{
+		JSONRPC: "2.0",
+		Method:  "eth_getBlockByHash",
+		Params:  mustMarshalJSON([]interface{}{"0xc6ef2fc5426d6ad6fd9e2a26abeab0aa2411b7ab17f30a99d3cb96aed1d1055b", false}),
+		ID:      []byte("1"),
+	}
+	require.NoError(t, cache.PutRPC(ctx, chainIdReq, &RPCRes{JSONRPC: "2.0", Result: "0x1", ID: []byte("1")}))
+	require.NoError(t, cache.PutRPC(ctx, blockReq, &RPCRes{JSONRPC: "2.0", Result: "block", ID: []byte("1")}))
+	// last values share the cache and must not be purged
+	require.NoError(t, mc.Put(ctx, "lvc:latest", "0x1"))
+
+	inspection, err := cache.InspectRPC(ctx, blockReq)
+	require.NoError(t, err)
+	require.Equal(t, &RPCCacheInspection{
+		Method:    "eth_getBlockByHash",
+		Cacheable: true,
+		Key:       inspection.Key,
+		Hit:       true,
+		Result:    "block",
+	}, inspection)
+
+	inspection, err = cache.InspectRPC(ctx, &RPCReq{Method: "eth_blockNumber"})
+	require.NoError(t, err)
+	require.False(t, inspection.Cacheable)
+
+	_, err = cache.GetRPC(ctx, chainIdReq)
+	require.NoError(t, err)
+	_, err = cache.GetRPC(ctx, &RPCReq{Method: "net_version"})
+	require.NoError(t, err)
+	stats := cache.Stats()
+	require.Equal(t, &RPCCacheMethodStats{Hits: 1, SavedBytes: 5}, stats.Methods["eth_chainId"])
+	require.Equal(t, &RPCCacheMethodStats{Misses: 1}, stats.Methods["net_version"])
+	require.Equal(t, 3, *stats.Entries)
+	require.Greater(t, *stats.SizeBytes, int64(0))
+
+	deleted, err := cache.DeleteRPC(ctx, blockReq)
+	require.NoError(t, err)
+	require.True(t, deleted)
+	res, err := cache.GetRPC(ctx, blockReq)
+	require.NoError(t, err)
+	require.Nil(t, res)
+
+	_, err = cache.PurgeRPC(ctx, "eth_blockNumber")
+	require.ErrorIs(t, err, ErrMethodNotCached)
+	purged, err := cache.PurgeRPC(ctx, "")
+	require.NoError(t, err)
+	require.Equal(t, 1, purged)
+	require.Equal(t, 1, *cache.Stats().Entries)
+}
@@ -0,0 +1,92 @@
+package proxyd
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+const (
+	// ClientCertAuthComplement authenticates requests by client certificate or
+	// by the secret in their URL.
+	ClientCertAuthComplement = "complement"
+	// ClientCertAuthReplace authenticates requests by client certificate only.
+	ClientCertAuthReplace = "replace"
+)
+
+// clientCertAuth maps the verified client certificates of requests to auth
+// aliases, by their subject common name or subject alternative names.
+type clientCertAuth struct {
+	aliases map[string]string
+	replace bool
+}
+
+func newClientCertAuth(config ClientCertAuthConfig) (*clientCertAuth, error) {
+	switch config.Mode {
+	case "", ClientCertAuthComplement, ClientCertAuthReplace:
+	default:
+		return nil, fmt.Errorf("invalid server.tls.client_auth.mode %s", config.Mode)
+	}
+	if config.CAFile == "" {
+		if len(config.Aliases) > 0 || config.Required {
+			return nil, errors.New("server.tls.client_auth requires ca_file")
+		}
+		return nil, nil
+	}
+	return &clientCertAuth{
+		aliases: config.Aliases,
+		replace: config.Mode == ClientCertAuthReplace,
+	}, nil
+}
+
+// configureClientAuth verifies the client certificates of tlsConfig against
+// the CAs of config, if any.
+func configureClientAuth(tlsConfig *tls.Config, config ClientCertAuthConfig) error {
+	if config.CAFile == "" {
+		return nil
+	}
+	pem, err := os.ReadFile(config.CAFile)
+	if err != nil {
+		return fmt.Errorf("error reading client CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return errors.New("no certificates in client CA file")
+	}
+	tlsConfig.ClientCAs = pool
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	if config.Required {
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return nil
+}
+
+// alias returns the alias the client certificate of r maps to, if any.
+func (a *clientCertAuth) alias(r *http.Request) (string, bool) {
+	if a == nil || r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return "", false
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+	names := make([]string, 0, len(cert.URIs)+len(cert.DNSNames)+len(cert.EmailAddresses)+1)
+	for _, uri := range cert.URIs {
+		names = append(names, uri.String())
+	}
+	names = append(names, cert.DNSNames...)
+	names = append(names, cert.EmailAddresses...)
+	names = append(names, cert.Subject.CommonName)
+	for _, name := range names {
+		if alias, ok := a.aliases[name]; ok && name != "" {
+			return alias, true
+		}
+	}
+	return "", false
+}
+
+// replacesSecrets reports whether requests are authenticated by client
+// certificate only.
+func (a *clientCertAuth) replacesSecrets() bool {
+	return a != nil && a.replace
+}
@@ -0,0 +1,72 @@
+package proxyd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// clientIPResolver determines the IP of the client of a request. Clients
+// can set any header, so the forwarded-for header is only honored on
+// requests from trusted reverse proxies, and its entries are only trusted up
+// to the right-most one that isn't a trusted proxy, which is the client
+// appended by the outermost trusted proxy.
+type clientIPResolver struct {
+	header         string
+	trustedProxies []*net.IPNet
+	// proxyProtocol is set if the remote addresses of connections are the
+	// client addresses read from PROXY protocol headers.
+	proxyProtocol bool
+}
+
+func newClientIPResolver(header string, trustedProxyCIDRs []string, proxyProtocol bool) (*clientIPResolver, error) {
+	nets, err := parseCIDRs(trustedProxyCIDRs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trusted proxy CIDRs: %w", err)
+	}
+	return &clientIPResolver{
+		header:         header,
+		trustedProxies: nets,
+		proxyProtocol:  proxyProtocol,
+	}, nil
+}
+
+func (c *clientIPResolver) isTrusted(ip string) bool {
+	parsed := net.ParseIP(ip)
+	return parsed != nil && containsIP(c.trustedProxies, parsed)
+}
+
+// resolve returns the client IP of r.
+func (c *clientIPResolver) resolve(r *http.Request) string {
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		ip = host
+	}
+	if c.proxyProtocol || !c.isTrusted(ip) {
+		return ip
+	}
+
+	var entries []string
+	for _, value := range r.Header.Values(c.header) {
+		entries = append(entries, strings.Split(value, ",")...)
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := strings.TrimSpace(entries[i])
+		if net.ParseIP(entry) == nil {
+			// the entries left of a malformed one can't be trusted
+			break
+		}
+		ip = entry
+		if !c.isTrusted(entry) {
+			break
+		}
+	}
+	return ip
+}
+
+// GetClientIP returns the client IP of the request of ctx, if known.
+func GetClientIP(ctx context.Context) net.IP {
+	return net.ParseIP(GetXForwardedFor(ctx))
+}
@@ -0,0 +1,46 @@
+package proxyd
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientIPResolver(t *testing.T) {
+	resolver, err := newClientIPResolver("X-Forwarded-For", []string{"10.0.0.0/8"}, false)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        []string
+		ip         string
+	}{
+		{"no header", "203.0.113.1:1234", nil, "203.0.113.1"},
+		{"untrusted peer", "203.0.113.1:1234", []string{"198.51.100.1"}, "203.0.113.1"},
+		{"trusted peer", "10.0.0.1:1234", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"trusted peer without header", "10.0.0.1:1234", nil, "10.0.0.1"},
+		{"forged first entry", "10.0.0.1:1234", []string{"192.0.2.1, 198.51.100.1"}, "198.51.100.1"},
+		{"chained trusted proxies", "10.0.0.1:1234", []string{"192.0.2.1, 198.51.100.1, 10.0.0.2"}, "198.51.100.1"},
+		{"repeated headers", "10.0.0.1:1234", []string{"192.0.2.1", "198.51.100.1, 10.0.0.2"}, "198.51.100.1"},
+		{"only trusted proxies", "10.0.0.1:1234", []string{"10.0.0.3, 10.0.0.2"}, "10.0.0.3"},
+		{"malformed entry", "10.0.0.1:1234", []string{"192.0.2.1, bogus, 10.0.0.2"}, "10.0.0.2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &http.Request{RemoteAddr: tt.remoteAddr, Header: http.Header{}}
+			for _, value := range tt.xff {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			require.Equal(t, tt.ip, resolver.resolve(r))
+		})
+	}
+
+	t.Run("proxy protocol", func(t *testing.T) {
+		resolver, err := newClientIPResolver("X-Forwarded-For", []string{"10.0.0.0/8"}, true)
+		require.NoError(t, err)
+		r := &http.Request{RemoteAddr: "10.0.0.1:1234", Header: http.Header{"X-Forwarded-For": {"198.51.100.1"}}}
+		require.Equal(t, "10.0.0.1", resolver.resolve(r))
+	})
+}
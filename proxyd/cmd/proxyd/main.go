@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"net"
 	"net/http"
@@ -10,6 +12,7 @@ import (
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	"golang.org/x/exp/slog"
@@ -26,6 +29,10 @@ var (
 )
 
 func main() {
+	if len(os.Args) == 3 && os.Args[1] == "selftest" {
+		os.Exit(selfTest(os.Args[2]))
+	}
+
 	// Set up logger with a default INFO level in case we fail to parse flags.
 	// Otherwise the final critical log won't show what the parsing error was.
 	slog.SetDefault(slog.New(slog.NewJSONHandler(
@@ -53,6 +60,8 @@ func main() {
 	slog.SetDefault(slog.New(slog.NewJSONHandler(
 		os.Stdout, &slog.HandlerOptions{Level: logLevel})))
 
+	proxyd.ConfigureRuntime(config.Server)
+
 	if config.Server.EnablePprof {
 		log.Info("starting pprof", "addr", "0.0.0.0", "port", "6060")
 		pprofSrv := StartPProf("0.0.0.0", 6060)
@@ -64,11 +73,21 @@ func main() {
 		}()
 	}
 
-	_, shutdown, err := proxyd.Start(config)
+	srv, shutdown, err := proxyd.Start(config)
 	if err != nil {
 		log.Crit("error starting proxyd", "err", err)
 	}
 
+	if config.HotReload.Enabled {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go func() {
+			for range hup {
+				reloadConfig(srv, os.Args[1])
+			}
+		}()
+	}
+
 	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
 	recvSig := <-sig
@@ -76,6 +95,46 @@ func main() {
 	shutdown()
 }
 
+// selfTest runs the self-test of the config at path, and prints its report on
+// stdout. Logs are written to stderr so that the report can be piped.
+func selfTest(path string) int {
+	slog.SetDefault(slog.New(slog.NewJSONHandler(
+		os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn})))
+
+	config := new(proxyd.Config)
+	if _, err := toml.DecodeFile(path, config); err != nil {
+		log.Error("error reading config file", "err", err)
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	report := proxyd.SelfTest(ctx, config)
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		log.Error("error writing self-test report", "err", err)
+		return 2
+	}
+	if !report.Passed {
+		return 1
+	}
+	return 0
+}
+
+func reloadConfig(srv *proxyd.Server, path string) {
+	log.Info("reloading config", "path", path)
+	config := new(proxyd.Config)
+	if _, err := toml.DecodeFile(path, config); err != nil {
+		log.Error("error reading config file", "err", err)
+		return
+	}
+	if err := srv.ReloadConfig(config); err != nil {
+		log.Error("error reloading config", "err", err)
+	}
+}
+
 // LevelFromString returns the appropriate Level from a string name.
 // Useful for parsing command line args and configuration files.
 // It also converts strings to lowercase.
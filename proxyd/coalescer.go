@@ -0,0 +1,153 @@
+package proxyd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// coalescableMethods are the read-only methods that may be coalesced. Other
+// methods, e.g. the ones sending transactions or installing filters, are
+// expected to reach the backend on every call.
+var coalescableMethods = map[string]bool{
+	"eth_blockNumber":                         true,
+	"eth_chainId":                             true,
+	"net_version":                             true,
+	"eth_syncing":                             true,
+	"eth_gasPrice":                            true,
+	"eth_maxPriorityFeePerGas":                true,
+	"eth_blobBaseFee":                         true,
+	"eth_feeHistory":                          true,
+	"eth_getBalance":                          true,
+	"eth_getCode":                             true,
+	"eth_getStorageAt":                        true,
+	"eth_getTransactionCount":                 true,
+	"eth_getProof":                            true,
+	"eth_call":                                true,
+	"eth_estimateGas":                         true,
+	"eth_getBlockByNumber":                    true,
+	"eth_getBlockByHash":                      true,
+	"eth_getBlockReceipts":                    true,
+	"eth_getBlockTransactionCountByNumber":    true,
+	"eth_getBlockTransactionCountByHash":      true,
+	"eth_getTransactionByHash":                true,
+	"eth_getTransactionReceipt":               true,
+	"eth_getTransactionByBlockNumberAndIndex": true,
+	"eth_getTransactionByBlockHashAndIndex":   true,
+	"eth_getUncleCountByBlockNumber":          true,
+	"eth_getUncleCountByBlockHash":            true,
+	"eth_getUncleByBlockNumberAndIndex":       true,
+	"eth_getUncleByBlockHashAndIndex":         true,
+	"eth_getLogs":                             true,
+	"debug_getRawReceipts":                    true,
+}
+
+type coalescedResult struct {
+	res *RPCRes
+	// result is the marshaled result of res, unmarshaled for each waiter so
+	// that they can modify their response.
+	result   []byte
+	servedBy string
+}
+
+// RequestCoalescer collapses identical in-flight read requests into a single
+// upstream call. All waiters share the response of the call, each with its
+// own request ID. The call is forwarded with the context of the request that
+// triggered it, so coalesced requests take the X-Forwarded-For and auth key of
+// that request upstream. Requests of different priority classes are never
+// coalesced, since the class decides how the call is scheduled.
+type RequestCoalescer struct {
+	methods map[string]bool
+	timeout time.Duration
+	group   singleflight.Group
+}
+
+// NewRequestCoalescer coalesces methods, which must be read-only, or all the
+// read-only methods if methods is empty.
+func NewRequestCoalescer(methods []string, timeout time.Duration) (*RequestCoalescer, error) {
+	m := coalescableMethods
+	if len(methods) > 0 {
+		m = make(map[string]bool, len(methods))
+		for _, method := range methods {
+			if !coalescableMethods[method] {
+				return nil, fmt.Errorf("method %s can't be coalesced", method)
+			}
+			m[method] = true
+		}
+	}
+	return &RequestCoalescer{
+		methods: m,
+		timeout: timeout,
+	}, nil
+}
+
+func (c *RequestCoalescer) Coalescable(method string) bool {
+	return c.methods[method]
+}
+
+// Do forwards req through fn, unless an identical request is already in flight
+// in which case it waits for and shares that request's response, until ctx is
+// done. The block number is part of the key so that block tag dependent
+// requests issued across a head change are not merged.
+func (c *RequestCoalescer) Do(
+	ctx context.Context,
+	group string,
+	block uint64,
+	req *RPCReq,
+	fn func(ctx context.Context) (*RPCRes, string, error),
+) (*RPCRes, string, error) {
+	key := coalescerKey(group, GetPriorityClass(ctx), block, req)
+	var leader bool
+	ch := c.group.DoChan(key, func() (interface{}, error) {
+		leader = true
+		// The upstream call must not be cancelled when the client that happened
+		// to trigger it goes away, since other waiters may depend on it.
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.timeout)
+		defer cancel()
+		res, servedBy, err := fn(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return &coalescedResult{res: res, result: mustMarshalJSON(res.Result), servedBy: servedBy}, nil
+	})
+	var r singleflight.Result
+	select {
+	case r = <-ch:
+	case <-ctx.Done():
+		return nil, "", ctx.Err()
+	}
+	if !leader {
+		RecordCoalescedRequest(ctx, req.Method)
+	}
+	if r.Err != nil {
+		return nil, "", r.Err
+	}
+
+	result := r.Val.(*coalescedResult)
+	res := *result.res
+	res.ID = req.ID
+	if leader {
+		return &res, result.servedBy, nil
+	}
+	// waiters get their own copy of the response
+	res.Result = nil
+	if err := json.Unmarshal(result.result, &res.Result); err != nil {
+		return nil, "", err
+	}
+	if res.Error != nil {
+		rpcErr := *res.Error
+		res.Error = &rpcErr
+	}
+	return &res, result.servedBy, nil
+}
+
+func coalescerKey(group string, priorityClass string, block uint64, req *RPCReq) string {
+	h := sha256.Sum256(req.Params)
+	return group + ":" + priorityClass + ":" + req.Method + ":" + strconv.FormatUint(block, 10) + ":" + hex.EncodeToString(h[:])
+}
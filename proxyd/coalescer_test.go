@@ -0,0 +1,96 @@
+package proxyd
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestCoalescerMethods(t *testing.T) {
+	c, err := NewRequestCoalescer(nil, time.Second)
+	require.NoError(t, err)
+	require.True(t, c.Coalescable("eth_getBlockByNumber"))
+	for _, method := range []string{"eth_sendRawTransaction", ConditionalTxMethod, PrivateTxMethod, "eth_sendUserOperation", "engine_newPayloadV3", "eth_newFilter"} {
+		require.False(t, c.Coalescable(method), method)
+	}
+
+	_, err = NewRequestCoalescer([]string{"eth_getBlockByNumber", ConditionalTxMethod}, time.Second)
+	require.Error(t, err)
+}
+
+func TestRequestCoalescerCopiesResponses(t *testing.T) {
+	c, err := NewRequestCoalescer(nil, time.Second)
+	require.NoError(t, err)
+
+	release := make(chan struct{})
+	fn := func(ctx context.Context) (*RPCRes, string, error) {
+		<-release
+		return &RPCRes{JSONRPC: "2.0", Result: map[string]interface{}{"number": "0x1"}}, "backend", nil
+	}
+	const n = 5
+	results := make([]*RPCRes, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			req := &RPCReq{Method: "eth_getBlockByNumber", Params: []byte(`["latest",false]`), ID: []byte{byte('0' + i)}}
+			res, _, err := c.Do(context.Background(), "main", 1, req, fn)
+			require.NoError(t, err)
+			results[i] = res
+		}(i)
+	}
+	// let the waiters join the in-flight call
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	results[0].Result.(map[string]interface{})["number"] = "0x2"
+	for i := 1; i < n; i++ {
+		require.Equal(t, string([]byte{byte('0' + i)}), string(results[i].ID))
+		require.Equal(t, map[string]interface{}{"number": "0x1"}, results[i].Result)
+	}
+}
+
+func TestRequestCoalescerWaiterContext(t *testing.T) {
+	c, err := NewRequestCoalescer(nil, time.Second)
+	require.NoError(t, err)
+
+	release := make(chan struct{})
+	var calls atomic.Int32
+	fn := func(ctx context.Context) (*RPCRes, string, error) {
+		calls.Add(1)
+		<-release
+		return &RPCRes{JSONRPC: "2.0", Result: "0x1"}, "backend", nil
+	}
+	req := &RPCReq{Method: "eth_blockNumber", Params: []byte(`[]`), ID: []byte("1")}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		res, _, err := c.Do(context.Background(), "main", 1, req, fn)
+		require.NoError(t, err)
+		require.Equal(t, "0x1", res.Result)
+	}()
+	require.Eventually(t, func() bool { return calls.Load() == 1 }, time.Second, 5*time.Millisecond)
+
+	// waiters give up when their own context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, _, err = c.Do(ctx, "main", 1, req, fn)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// requests of other priority classes are not coalesced
+	ctx = context.WithValue(context.Background(), ContextKeyPriorityClass, "low") // nolint:staticcheck
+	go func() {
+		_, _, _ = c.Do(ctx, "main", 1, req, fn)
+	}()
+	require.Eventually(t, func() bool { return calls.Load() == 2 }, time.Second, 5*time.Millisecond)
+
+	close(release)
+	<-done
+}
@@ -0,0 +1,197 @@
+package proxyd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/dict"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	defaultZstdTrainSamples      = 1000
+	defaultZstdMaxDictionarySize = 112 * 1024
+)
+
+// CacheCodec compresses cached values.
+type CacheCodec interface {
+	Encode(src []byte) []byte
+	Decode(src []byte) ([]byte, error)
+}
+
+// NewCacheCodec returns the codec configured by cfg, snappy by default.
+func NewCacheCodec(cfg CacheCompressionConfig) (CacheCodec, error) {
+	switch cfg.Codec {
+	case "", "snappy":
+		return snappyCodec{}, nil
+	case "none":
+		return noneCodec{}, nil
+	case "zstd":
+		return newZstdCodec(cfg)
+	default:
+		return nil, fmt.Errorf("unknown cache compression codec %s", cfg.Codec)
+	}
+}
+
+type snappyCodec struct{}
+
+func (snappyCodec) Encode(src []byte) []byte {
+	return snappy.Encode(nil, src)
+}
+
+func (snappyCodec) Decode(src []byte) ([]byte, error) {
+	return snappy.Decode(nil, src)
+}
+
+type noneCodec struct{}
+
+func (noneCodec) Encode(src []byte) []byte {
+	return src
+}
+
+func (noneCodec) Decode(src []byte) ([]byte, error) {
+	return src, nil
+}
+
+type zstdCoders struct {
+	enc *zstd.Encoder
+	dec *zstd.Decoder
+}
+
+// zstdCodec compresses values with zstd, optionally with a dictionary. If the
+// dictionary file does not exist and training is enabled, the dictionary is
+// trained from the first values encoded, then saved to the file and used from
+// then on. Values encoded before remain decodable.
+type zstdCodec struct {
+	level  zstd.EncoderLevel
+	coders atomic.Pointer[zstdCoders]
+
+	dictFile    string
+	maxDictSize int
+	numSamples  int
+	training    atomic.Bool
+	samplesMtx  sync.Mutex
+	samples     [][]byte
+}
+
+func newZstdCodec(cfg CacheCompressionConfig) (*zstdCodec, error) {
+	level := zstd.SpeedDefault
+	if cfg.Level != "" {
+		ok, l := zstd.EncoderLevelFromString(cfg.Level)
+		if !ok {
+			return nil, fmt.Errorf("unknown zstd level %s", cfg.Level)
+		}
+		level = l
+	}
+	c := &zstdCodec{
+		level:       level,
+		dictFile:    cfg.DictionaryFile,
+		maxDictSize: cfg.MaxDictionaryBytes,
+		numSamples:  cfg.TrainSamples,
+	}
+	if c.maxDictSize == 0 {
+		c.maxDictSize = defaultZstdMaxDictionarySize
+	}
+	if c.numSamples == 0 {
+		c.numSamples = defaultZstdTrainSamples
+	}
+
+	var dictionary []byte
+	if cfg.DictionaryFile != "" {
+		var err error
+		dictionary, err = os.ReadFile(cfg.DictionaryFile)
+		if errors.Is(err, os.ErrNotExist) && cfg.TrainDictionary {
+			log.Info("training zstd cache dictionary", "file", cfg.DictionaryFile, "samples", c.numSamples)
+			c.training.Store(true)
+		} else if err != nil {
+			return nil, wrapErr(err, "error reading zstd dictionary")
+		}
+	} else if cfg.TrainDictionary {
+		return nil, errors.New("training a zstd dictionary requires dictionary_file to be set")
+	}
+
+	coders, err := newZstdCoders(level, dictionary)
+	if err != nil {
+		return nil, err
+	}
+	c.coders.Store(coders)
+	return c, nil
+}
+
+func newZstdCoders(level zstd.EncoderLevel, dictionary []byte) (*zstdCoders, error) {
+	eopts := []zstd.EOption{zstd.WithEncoderLevel(level)}
+	var dopts []zstd.DOption
+	if dictionary != nil {
+		eopts = append(eopts, zstd.WithEncoderDict(dictionary))
+		dopts = append(dopts, zstd.WithDecoderDicts(dictionary))
+	}
+	enc, err := zstd.NewWriter(nil, eopts...)
+	if err != nil {
+		return nil, wrapErr(err, "error creating zstd encoder")
+	}
+	dec, err := zstd.NewReader(nil, dopts...)
+	if err != nil {
+		return nil, wrapErr(err, "error creating zstd decoder")
+	}
+	return &zstdCoders{enc: enc, dec: dec}, nil
+}
+
+func (c *zstdCodec) Encode(src []byte) []byte {
+	if c.training.Load() {
+		c.sample(src)
+	}
+	return c.coders.Load().enc.EncodeAll(src, nil)
+}
+
+func (c *zstdCodec) Decode(src []byte) ([]byte, error) {
+	return c.coders.Load().dec.DecodeAll(src, nil)
+}
+
+func (c *zstdCodec) sample(src []byte) {
+	c.samplesMtx.Lock()
+	defer c.samplesMtx.Unlock()
+	if len(c.samples) >= c.numSamples {
+		return
+	}
+	c.samples = append(c.samples, append([]byte(nil), src...))
+	if len(c.samples) == c.numSamples {
+		go c.train(c.samples)
+	}
+}
+
+// train builds a dictionary from samples and switches to it. Failures are
+// logged, and compression continues without a dictionary.
+func (c *zstdCodec) train(samples [][]byte) {
+	defer func() {
+		c.training.Store(false)
+		c.samplesMtx.Lock()
+		c.samples = nil
+		c.samplesMtx.Unlock()
+	}()
+
+	dictionary, err := dict.BuildZstdDict(samples, dict.Options{
+		MaxDictSize: c.maxDictSize,
+		HashBytes:   6,
+		ZstdLevel:   c.level,
+	})
+	if err != nil {
+		log.Error("error training zstd cache dictionary", "err", err)
+		return
+	}
+	coders, err := newZstdCoders(c.level, dictionary)
+	if err != nil {
+		log.Error("error loading trained zstd cache dictionary", "err", err)
+		return
+	}
+	if err := os.WriteFile(c.dictFile, dictionary, 0o644); err != nil {
+		log.Error("error saving trained zstd cache dictionary", "file", c.dictFile, "err", err)
+		return
+	}
+	c.coders.Store(coders)
+	log.Info("trained zstd cache dictionary", "file", c.dictFile, "size", len(dictionary))
+}
@@ -0,0 +1,92 @@
+package proxyd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testBlockResult(i int) string {
+	return fmt.Sprintf(`{"number":"0x%x","hash":"0x%064x","parentHash":"0x%064x","miner":"0x4200000000000000000000000000000000000011","gasLimit":"0x1c9c380","gasUsed":"0x%x","transactions":[]}`, i, i*7919, i*7907, i*21000)
+}
+
+func TestCacheCodecs(t *testing.T) {
+	value := []byte(testBlockResult(1))
+	for _, name := range []string{"", "snappy", "none", "zstd"} {
+		t.Run(name, func(t *testing.T) {
+			codec, err := NewCacheCodec(CacheCompressionConfig{Codec: name})
+			require.NoError(t, err)
+			decoded, err := codec.Decode(codec.Encode(value))
+			require.NoError(t, err)
+			require.Equal(t, value, decoded)
+		})
+	}
+
+	_, err := NewCacheCodec(CacheCompressionConfig{Codec: "lz4"})
+	require.Error(t, err)
+	_, err = NewCacheCodec(CacheCompressionConfig{Codec: "zstd", Level: "extreme"})
+	require.Error(t, err)
+	_, err = NewCacheCodec(CacheCompressionConfig{Codec: "zstd", TrainDictionary: true})
+	require.Error(t, err)
+	_, err = NewCacheCodec(CacheCompressionConfig{Codec: "zstd", DictionaryFile: filepath.Join(t.TempDir(), "missing")})
+	require.Error(t, err)
+}
+
+func TestZstdCodecTrainDictionary(t *testing.T) {
+	dictFile := filepath.Join(t.TempDir(), "cache.dict")
+	codec, err := NewCacheCodec(CacheCompressionConfig{
+		Codec:           "zstd",
+		DictionaryFile:  dictFile,
+		TrainDictionary: true,
+		TrainSamples:    200,
+	})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	cache := newCacheWithCompression(newMemoryCache(0, 0), codec)
+	require.NoError(t, cache.Put(ctx, "before", testBlockResult(0)))
+	for i := 1; i <= 200; i++ {
+		require.NoError(t, cache.Put(ctx, fmt.Sprintf("sample:%d", i), testBlockResult(i)))
+	}
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(dictFile)
+		return err == nil && !codec.(*zstdCodec).training.Load()
+	}, 10*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, cache.Put(ctx, "after", testBlockResult(1000)))
+	val, err := cache.Get(ctx, "after")
+	require.NoError(t, err)
+	require.Equal(t, testBlockResult(1000), val)
+	val, err = cache.Get(ctx, "before")
+	require.NoError(t, err)
+	require.Equal(t, testBlockResult(0), val)
+
+	// a restarted proxyd loads the trained dictionary
+	loaded, err := NewCacheCodec(CacheCompressionConfig{
+		Codec:           "zstd",
+		DictionaryFile:  dictFile,
+		TrainDictionary: true,
+	})
+	require.NoError(t, err)
+	require.False(t, loaded.(*zstdCodec).training.Load())
+	decoded, err := loaded.Decode(codec.Encode([]byte(testBlockResult(1001))))
+	require.NoError(t, err)
+	require.Equal(t, testBlockResult(1001), string(decoded))
+}
+
+func TestCacheWithCompressionCodecChange(t *testing.T) {
+	ctx := context.Background()
+	mc := newMemoryCache(0, 0)
+	zstdCodec, err := NewCacheCodec(CacheCompressionConfig{Codec: "zstd"})
+	require.NoError(t, err)
+
+	require.NoError(t, newCacheWithCompression(mc, snappyCodec{}).Put(ctx, "foo", testBlockResult(1)))
+	val, err := newCacheWithCompression(mc, zstdCodec).Get(ctx, "foo")
+	require.NoError(t, err)
+	require.Empty(t, val)
+}
@@ -0,0 +1,53 @@
+package proxyd
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// computeUnits prices RPC calls in compute units.
+type computeUnits struct {
+	defaultCost int
+	methods     map[string]int
+}
+
+func newComputeUnits(config ComputeUnitsConfig) (*computeUnits, error) {
+	c := &computeUnits{
+		defaultCost: 1,
+		methods:     config.Methods,
+	}
+	if config.Default < 0 {
+		return nil, fmt.Errorf("compute_units.default must not be negative")
+	}
+	if config.Default != 0 {
+		c.defaultCost = config.Default
+	}
+	for method, cost := range config.Methods {
+		if cost < 0 {
+			return nil, fmt.Errorf("compute units of %s must not be negative", method)
+		}
+	}
+	return c, nil
+}
+
+// cost returns the compute units of the calls of reqs. Calls which can't be
+// parsed cost the default.
+func (c *computeUnits) cost(reqs []json.RawMessage) int {
+	if len(c.methods) == 0 {
+		return c.defaultCost * len(reqs)
+	}
+	var total int
+	for _, raw := range reqs {
+		var req struct {
+			Method string `json:"method"`
+		}
+		cost := c.defaultCost
+		if err := json.Unmarshal(raw, &req); err == nil {
+			if methodCost, ok := c.methods[req.Method]; ok {
+				cost = methodCost
+			}
+		}
+		total += cost
+	}
+	return total
+}
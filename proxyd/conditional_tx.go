@@ -0,0 +1,143 @@
+package proxyd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+const (
+	ConditionalTxMethod = "eth_sendRawTransactionConditional"
+
+	ConditionalTxOutcomeAccepted    = "accepted"
+	ConditionalTxReasonInvalid      = "invalid"
+	ConditionalTxReasonUnauthorized = "unauthorized"
+
+	// defaultConditionalTxMaxCost is the maximum number of known accounts and
+	// storage slots of a conditional transaction accepted by op-geth.
+	defaultConditionalTxMaxCost = 1000
+)
+
+var ErrConditionalTxNotAllowed = &RPCErr{
+	Code:          JSONRPCErrorInternal - 27,
+	Message:       "conditional transactions not allowed",
+	HTTPErrorCode: 403,
+}
+
+// ConditionalTxOptions are the conditions of a conditional transaction, as
+// accepted by OP Stack sequencers.
+type ConditionalTxOptions struct {
+	KnownAccounts  map[common.Address]json.RawMessage `json:"knownAccounts"`
+	BlockNumberMin *hexutil.Big                       `json:"blockNumberMin,omitempty"`
+	BlockNumberMax *hexutil.Big                       `json:"blockNumberMax,omitempty"`
+	TimestampMin   *hexutil.Uint64                    `json:"timestampMin,omitempty"`
+	TimestampMax   *hexutil.Uint64                    `json:"timestampMax,omitempty"`
+}
+
+// ConditionalTxRouter validates eth_sendRawTransactionConditional requests and
+// routes them to the sequencer backend group, regardless of the method
+// mappings. Only permitted auth keys may send conditional transactions.
+type ConditionalTxRouter struct {
+	group                string
+	authKeys             map[string]bool
+	allowUnauthenticated bool
+	maxCost              int
+}
+
+func NewConditionalTxRouter(config ConditionalTxConfig) *ConditionalTxRouter {
+	maxCost := defaultConditionalTxMaxCost
+	if config.MaxCost != 0 {
+		maxCost = config.MaxCost
+	}
+	authKeys := make(map[string]bool, len(config.AuthKeys))
+	for _, alias := range config.AuthKeys {
+		authKeys[alias] = true
+	}
+	return &ConditionalTxRouter{
+		group:                config.BackendGroup,
+		authKeys:             authKeys,
+		allowUnauthenticated: config.AllowUnauthenticated,
+		maxCost:              maxCost,
+	}
+}
+
+// Group returns the backend group conditional transactions are routed to.
+func (r *ConditionalTxRouter) Group() string {
+	return r.group
+}
+
+// Allowed returns whether the auth key of ctx may send conditional
+// transactions. Without configured auth keys, any auth key may.
+func (r *ConditionalTxRouter) Allowed(ctx context.Context) bool {
+	alias, ok := ctx.Value(ContextKeyAuth).(string)
+	if !ok || alias == "" {
+		return r.allowUnauthenticated
+	}
+	return len(r.authKeys) == 0 || r.authKeys[alias]
+}
+
+// Validate checks the shape of the params of a conditional transaction
+// request, and returns the request of its raw transaction alone so that it
+// goes through the checks of eth_sendRawTransaction.
+func (r *ConditionalTxRouter) Validate(req *RPCReq) (*RPCReq, *RPCErr) {
+	var params []json.RawMessage
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return nil, ErrInvalidParams("invalid conditional transaction params")
+	}
+	if len(params) != 2 {
+		return nil, ErrInvalidParams(fmt.Sprintf("expected 2 params, got %d", len(params)))
+	}
+	var rawTx string
+	if err := json.Unmarshal(params[0], &rawTx); err != nil {
+		return nil, ErrInvalidParams("invalid raw transaction")
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(params[1]))
+	dec.DisallowUnknownFields()
+	var opts ConditionalTxOptions
+	if err := dec.Decode(&opts); err != nil {
+		return nil, ErrInvalidParams(fmt.Sprintf("invalid conditional options: %s", err))
+	}
+	if err := r.validateOptions(&opts); err != nil {
+		return nil, err
+	}
+
+	return &RPCReq{
+		JSONRPC: req.JSONRPC,
+		Method:  "eth_sendRawTransaction",
+		Params:  mustMarshalJSON([]string{rawTx}),
+		ID:      req.ID,
+	}, nil
+}
+
+func (r *ConditionalTxRouter) validateOptions(opts *ConditionalTxOptions) *RPCErr {
+	if opts.BlockNumberMin != nil && opts.BlockNumberMax != nil && opts.BlockNumberMin.ToInt().Cmp(opts.BlockNumberMax.ToInt()) > 0 {
+		return ErrInvalidParams("blockNumberMin is greater than blockNumberMax")
+	}
+	if opts.TimestampMin != nil && opts.TimestampMax != nil && *opts.TimestampMin > *opts.TimestampMax {
+		return ErrInvalidParams("timestampMin is greater than timestampMax")
+	}
+
+	cost := 0
+	for addr, raw := range opts.KnownAccounts {
+		// the storage root of the account, or the values of some of its slots
+		var root common.Hash
+		if err := json.Unmarshal(raw, &root); err == nil {
+			cost++
+			continue
+		}
+		var slots map[common.Hash]common.Hash
+		if err := json.Unmarshal(raw, &slots); err != nil {
+			return ErrInvalidParams(fmt.Sprintf("invalid known account %s", addr.Hex()))
+		}
+		cost += len(slots)
+	}
+	if cost > r.maxCost {
+		return ErrInvalidParams(fmt.Sprintf("conditional cost too high: have %d, maximum %d", cost, r.maxCost))
+	}
+	return nil
+}
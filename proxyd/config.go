@@ -4,10 +4,295 @@ import (
 	"fmt"
 	"math/big"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 )
 
+// ProxyProtocolConfig reads the PROXY protocol v1 and v2 headers sent by L4
+// load balancers ahead of the connections they forward.
+type ProxyProtocolConfig struct {
+	Enabled bool `toml:"enabled"`
+	// TrustedCIDRs are the networks of the load balancers. Only the headers of
+	// their connections are read, others are served as is.
+	TrustedCIDRs []string `toml:"trusted_cidrs"`
+	// HeaderTimeout bounds the wait for the header, default 5s.
+	HeaderTimeout TOMLDuration `toml:"header_timeout"`
+}
+
+// ServerTLSConfig terminates TLS on the RPC and WS servers, with a
+// certificate read from files or obtained through ACME.
+type ServerTLSConfig struct {
+	// CertFile and KeyFile are the paths of the PEM encoded certificate and
+	// key, or vault:// or awssm:// secrets holding them.
+	CertFile string `toml:"cert_file"`
+	KeyFile  string `toml:"key_file"`
+	// ReloadInterval is how often the files are checked for a renewed
+	// certificate, default 1m.
+	ReloadInterval TOMLDuration         `toml:"reload_interval"`
+	ACME           ACMEConfig           `toml:"acme"`
+	ClientAuth     ClientCertAuthConfig `toml:"client_auth"`
+}
+
+// ClientCertAuthConfig verifies the certificates of clients, mapping them to
+// auth aliases by their subject common name or subject alternative names.
+type ClientCertAuthConfig struct {
+	// CAFile holds the CAs client certificates are verified against.
+	CAFile string `toml:"ca_file"`
+	// Required rejects TLS handshakes without a valid client certificate.
+	Required bool `toml:"required"`
+	// Mode is complement, the default, to authenticate requests by client
+	// certificate or by the secret in their URL, or replace to authenticate
+	// them by client certificate only.
+	Mode string `toml:"mode"`
+	// Aliases map the common names, DNS names, email addresses or URIs of
+	// client certificates to auth aliases.
+	Aliases map[string]string `toml:"aliases"`
+}
+
+// JWTAuthConfig authenticates requests by the JWT bearer token of their
+// Authorization header, mapping one of its claims to an auth alias, whose
+// auth_keys limits and method permissions then apply.
+type JWTAuthConfig struct {
+	Enabled bool `toml:"enabled"`
+	// HS256Secret verifies HS256 tokens. It can be read from the environment.
+	HS256Secret string `toml:"hs256_secret"`
+	// JWKSURL serves the keys verifying RS256 and ES256 tokens. It can be
+	// read from the environment.
+	JWKSURL string `toml:"jwks_url"`
+	// JWKSRefreshInterval is how long the keys are cached, default 5m. They
+	// are fetched sooner for tokens signed with unknown keys.
+	JWKSRefreshInterval TOMLDuration `toml:"jwks_refresh_interval"`
+	// Issuer and Audience, if set, must match the iss and aud claims.
+	Issuer   string `toml:"issuer"`
+	Audience string `toml:"audience"`
+	// Leeway tolerates clock skew in the exp and nbf claims.
+	Leeway TOMLDuration `toml:"leeway"`
+	// AliasClaim names the claim holding the alias, default sub.
+	AliasClaim string `toml:"alias_claim"`
+	// Aliases map the values of the alias claim to auth aliases. Without
+	// them, the claim must hold an alias of auth_keys.
+	Aliases map[string]string `toml:"aliases"`
+	// Required rejects requests without a valid token, unless authenticated
+	// by client certificate.
+	Required bool `toml:"required"`
+}
+
+// CORSConfig lets browsers call the RPC server from other origins.
+type CORSConfig struct {
+	// AllowedOrigins are the origins allowed to call the server, or patterns
+	// with a single * wildcard. Any origin is allowed if empty. Auth keys with
+	// allowed_origins further restrict their origins.
+	AllowedOrigins []string `toml:"allowed_origins"`
+	// AllowedMethods default to GET and POST.
+	AllowedMethods []string `toml:"allowed_methods"`
+	// AllowedHeaders are the request headers browsers may send, default
+	// Accept, Content-Type and X-Requested-With.
+	AllowedHeaders []string `toml:"allowed_headers"`
+	// ExposedHeaders are exposed in addition to the rate limit headers.
+	ExposedHeaders   []string `toml:"exposed_headers"`
+	AllowCredentials bool     `toml:"allow_credentials"`
+	// MaxAge is how long browsers may cache preflight responses.
+	MaxAge TOMLDuration `toml:"max_age"`
+}
+
+// GeoIPConfig blocks or rate limits requests by the country and autonomous
+// system of their client IP, looked up in MaxMind DB files.
+type GeoIPConfig struct {
+	// CountryDatabase is the path of a country database, e.g.
+	// GeoLite2-Country.mmdb or GeoLite2-City.mmdb.
+	CountryDatabase string `toml:"country_database"`
+	// ASNDatabase is the path of an autonomous system database, e.g.
+	// GeoLite2-ASN.mmdb.
+	ASNDatabase string `toml:"asn_database"`
+	// Rules apply in order, the first matching a request decides it.
+	Rules []GeoIPRuleConfig `toml:"rules"`
+}
+
+type GeoIPRuleConfig struct {
+	// Countries are ISO 3166-1 alpha-2 codes, e.g. KP.
+	Countries []string `toml:"countries"`
+	ASNs      []uint64 `toml:"asns"`
+	// Methods restrict the rule to these methods. Patterns ending with *
+	// match methods by prefix. The rule applies to all methods if empty.
+	Methods []string `toml:"methods"`
+	// Action is block, or rate_limit to allow RateLimit requests per second
+	// per client IP.
+	Action    string `toml:"action"`
+	RateLimit int    `toml:"rate_limit"`
+}
+
+// AbuseConfig bans or rate limits the client IPs and auth keys whose
+// requests within a window exceed the thresholds.
+type AbuseConfig struct {
+	Enabled bool `toml:"enabled"`
+	// Window is the period requests are tracked over, default 1m.
+	Window TOMLDuration `toml:"window"`
+	// MinRequests is the number of requests of a client within the window
+	// before its rates are checked, default 50.
+	MinRequests int `toml:"min_requests"`
+	// MaxErrorRate is the share of requests answered with an error allowed.
+	MaxErrorRate float64 `toml:"max_error_rate"`
+	// MaxMalformedRate is the share of requests which can't be parsed
+	// allowed.
+	MaxMalformedRate float64 `toml:"max_malformed_rate"`
+	// MaxDistinctMethods is the number of distinct methods allowed, as
+	// called by scanners.
+	MaxDistinctMethods int `toml:"max_distinct_methods"`
+	// Action is ban, or rate_limit to allow RateLimit requests per second.
+	Action    string `toml:"action"`
+	RateLimit int    `toml:"rate_limit"`
+	// BanDuration is how long clients are penalized, default 10m.
+	BanDuration TOMLDuration `toml:"ban_duration"`
+	ExemptCIDRs []string     `toml:"exempt_cidrs"`
+	ExemptKeys  []string     `toml:"exempt_keys"`
+}
+
+// SecretsConfig configures the resolution of the vault:// and awssm:// values
+// of backend credentials and headers, Redis URLs and passwords, auth secrets
+// and TLS keys. Secrets are refreshed in the background, and rotated ones
+// apply without a restart.
+type SecretsConfig struct {
+	// RefreshInterval is how often secrets are refetched, default 5m.
+	RefreshInterval TOMLDuration            `toml:"refresh_interval"`
+	Vault           VaultConfig             `toml:"vault"`
+	AWS             AWSSecretsManagerConfig `toml:"aws"`
+}
+
+// VaultConfig defaults to the VAULT_ADDR, VAULT_TOKEN and VAULT_NAMESPACE
+// env vars.
+type VaultConfig struct {
+	Address   string `toml:"address"`
+	Token     string `toml:"token"`
+	Namespace string `toml:"namespace"`
+}
+
+// AWSSecretsManagerConfig defaults to the region of the AWS_REGION env var or
+// the shared config. Credentials are resolved by the default chain of the AWS
+// SDK: env vars, shared files, web identity tokens and container or instance
+// roles.
+type AWSSecretsManagerConfig struct {
+	Region string `toml:"region"`
+	// Endpoint overrides the regional endpoint, e.g. for a VPC endpoint.
+	Endpoint string `toml:"endpoint"`
+}
+
+// AccessLogConfig writes a JSON line per HTTP RPC request with its method,
+// auth alias, client IP, backend, cache status, latency, status and error
+// code, separately from the request log.
+type AccessLogConfig struct {
+	Enabled bool `toml:"enabled"`
+	// File is appended the lines, which are written to stdout by default.
+	File string `toml:"file"`
+	// SampleRate is the share of successful requests logged, default 1.
+	// Requests answered with an error are always logged.
+	SampleRate float64 `toml:"sample_rate"`
+	// RedactFields are replaced by a hash of their value, e.g. client_ip.
+	RedactFields []string `toml:"redact_fields"`
+	// Sinks export the lines in batches, e.g. to billing and analytics
+	// pipelines. Lines aren't written to stdout when sinks are configured,
+	// unless File is also set.
+	Sinks []AccessLogSinkConfig `toml:"sinks"`
+}
+
+// AccessLogSinkConfig exports access log lines in batches to Kafka, a file
+// rotated by size or an HTTP bulk endpoint. Lines are buffered, and either
+// dropped or held up requests while the buffer is full.
+type AccessLogSinkConfig struct {
+	// Name labels the metrics of the sink, default its type.
+	Name string `toml:"name"`
+	// Type is kafka, file or http.
+	Type string `toml:"type"`
+
+	// Brokers and Topic of the kafka sink. Lines are produced without keys,
+	// spread across the partitions of Topic.
+	Brokers []string `toml:"brokers"`
+	Topic   string   `toml:"topic"`
+	// Acks is leader, the default, or all, which also enables idempotent
+	// writes.
+	Acks string `toml:"acks"`
+	// Compression of the produced batches, none, gzip, snappy, lz4 or zstd.
+	Compression string `toml:"compression"`
+	TLS         bool   `toml:"tls"`
+	// SASLMechanism is plain, scram-sha-256 or scram-sha-512, authenticating
+	// with SASLUsername and SASLPassword.
+	SASLMechanism string `toml:"sasl_mechanism"`
+	SASLUsername  string `toml:"sasl_username"`
+	SASLPassword  string `toml:"sasl_password"`
+
+	// Path of the file sink, rotated to Path.1, Path.2... once it exceeds
+	// MaxSizeMB, default 100. MaxBackups rotated files are kept, default 5.
+	Path       string `toml:"path"`
+	MaxSizeMB  int    `toml:"max_size_mb"`
+	MaxBackups int    `toml:"max_backups"`
+
+	// URL of the http sink, posted batches as newline delimited JSON.
+	URL     string            `toml:"url"`
+	Headers map[string]string `toml:"headers"`
+
+	// BatchSize is the most lines written at once, default 500.
+	BatchSize int `toml:"batch_size"`
+	// FlushInterval is the longest lines wait for a batch, default 1s.
+	FlushInterval TOMLDuration `toml:"flush_interval"`
+	// BufferSize is the most lines waiting to be written, default 10000.
+	BufferSize int `toml:"buffer_size"`
+	// OnFull is drop, the default, dropping lines while the buffer is full,
+	// or block, holding up requests until there's room.
+	OnFull string `toml:"on_full"`
+	// MaxRetries of failed batches before they're dropped, default 3.
+	MaxRetries int `toml:"max_retries"`
+}
+
+// AuditLogConfig records auth failures, client and backend bans, config
+// reloads and admin API actions, separately from the request log.
+type AuditLogConfig struct {
+	Enabled bool `toml:"enabled"`
+	// File is appended the events as JSON lines.
+	File string `toml:"file"`
+	// WebhookURL is posted batches of events as JSON arrays.
+	WebhookURL     string            `toml:"webhook_url"`
+	WebhookHeaders map[string]string `toml:"webhook_headers"`
+	// FlushInterval and BatchSize bound the time and number of events
+	// batched for the webhook, default 1s and 100.
+	FlushInterval TOMLDuration `toml:"flush_interval"`
+	BatchSize     int          `toml:"batch_size"`
+	// BufferSize bounds the events pending, default 10000. Events recorded
+	// while it's full are dropped.
+	BufferSize int `toml:"buffer_size"`
+}
+
+// ComputeUnitsConfig prices RPC calls in compute units, which are counted by
+// auth key and against the quotas of keys with quota_unit = "compute_units".
+type ComputeUnitsConfig struct {
+	// Default is the cost of methods without one, default 1.
+	Default int `toml:"default"`
+	// Methods are the costs of methods by name.
+	Methods map[string]int `toml:"methods"`
+}
+
+// APIKeysConfig manages auth keys at runtime through the admin API, in Redis,
+// alongside those of [authentication].
+type APIKeysConfig struct {
+	Enabled bool `toml:"enabled"`
+	// CacheTTL is how long instances cache the lookups of secrets, default
+	// 10s. Changes made through other instances apply within it.
+	CacheTTL TOMLDuration `toml:"cache_ttl"`
+}
+
+// ACMEConfig obtains and renews the certificate of the RPC and WS servers
+// from an ACME CA, Let's Encrypt by default, validating the domains with the
+// tls-alpn-01 challenge. The servers must be reachable on port 443.
+type ACMEConfig struct {
+	Enabled bool     `toml:"enabled"`
+	Domains []string `toml:"domains"`
+	Email   string   `toml:"email"`
+	// CacheDir is where certificates and the account key are kept, default
+	// acme-cache.
+	CacheDir string `toml:"cache_dir"`
+	// DirectoryURL is the directory of the CA, default Let's Encrypt.
+	DirectoryURL string `toml:"directory_url"`
+}
+
 type ServerConfig struct {
 	RPCHost           string `toml:"rpc_host"`
 	RPCPort           int    `toml:"rpc_port"`
@@ -16,6 +301,21 @@ type ServerConfig struct {
 	MaxBodySizeBytes  int64  `toml:"max_body_size_bytes"`
 	MaxConcurrentRPCs int64  `toml:"max_concurrent_rpcs"`
 	LogLevel          string `toml:"log_level"`
+	// EnableLoadShedding rejects requests waiting for one of the
+	// MaxConcurrentRPCs slots with a 429 if their projected wait exceeds their
+	// deadline, or if MaxQueuedRPCs requests are already waiting.
+	EnableLoadShedding bool  `toml:"enable_load_shedding"`
+	MaxQueuedRPCs      int64 `toml:"max_queued_rpcs"`
+
+	// TLS serves the RPC and WS servers over TLS.
+	TLS ServerTLSConfig `toml:"tls"`
+	// ProxyProtocol reads the client addresses of the RPC and WS servers
+	// from the PROXY protocol headers of load balancers.
+	ProxyProtocol ProxyProtocolConfig `toml:"proxy_protocol"`
+	// TrustedProxyCIDRs are the networks of the reverse proxies whose
+	// X-Forwarded-For headers, or rate_limit.ip_header_override, are honored.
+	// Ignored with ProxyProtocol.
+	TrustedProxyCIDRs []string `toml:"trusted_proxy_cidrs"`
 
 	// TimeoutSeconds specifies the maximum time spent serving an HTTP request. Note that isn't used for websocket connections
 	TimeoutSeconds int `toml:"timeout_seconds"`
@@ -26,22 +326,366 @@ type ServerConfig struct {
 	MaxRequestBodyLogLen  int  `toml:"max_request_body_log_len"`
 	EnablePprof           bool `toml:"enable_pprof"`
 	EnableXServedByHeader bool `toml:"enable_served_by_header"`
+	// EnableRPCDiscover serves an OpenRPC document of the mapped methods via
+	// rpc_discover.
+	EnableRPCDiscover bool `toml:"enable_rpc_discover"`
+	// KeepaliveInterval is how often a space is written to clients while
+	// requests of KeepaliveMethods are served, so that proxies and clients
+	// with idle timeouts don't close the connection of slow requests. Once
+	// the first space is written the response status is always 200.
+	KeepaliveInterval TOMLDuration `toml:"keepalive_interval"`
+	KeepaliveMethods  []string     `toml:"keepalive_methods"`
+
+	// GOMAXPROCS overrides the number of OS threads executing Go code. Defaults to
+	// the CPU quota of the container, if any.
+	GOMAXPROCS int `toml:"gomaxprocs"`
+	// GCPercent sets the garbage collection target percentage, like GOGC. A
+	// negative value disables the garbage collector.
+	GCPercent int `toml:"gc_percent"`
+	// MemoryLimitBytes sets the soft memory limit of the runtime, like GOMEMLIMIT.
+	// Defaults to MemoryLimitRatio of the memory limit of the container, if any.
+	MemoryLimitBytes int64 `toml:"memory_limit_bytes"`
+	// MemoryLimitRatio is the share of the container memory limit used as the
+	// default soft memory limit.
+	MemoryLimitRatio float64 `toml:"memory_limit_ratio"`
 }
 
 type CacheConfig struct {
-	Enabled bool         `toml:"enabled"`
-	TTL     TOMLDuration `toml:"ttl"`
+	Enabled bool `toml:"enabled"`
+	// Backend selects where responses are cached: "redis", "memcached" or
+	// "memory". Defaults to Redis if it is configured, memory otherwise.
+	Backend         string                        `toml:"backend"`
+	TTL             TOMLDuration                  `toml:"ttl"`
+	BlockSyncRPCURL string                        `toml:"block_sync_rpc_url"`
+	Methods         map[string]*CacheMethodConfig `toml:"methods"`
+	// LocalSize enables an in-process LRU of this many entries in front of Redis.
+	LocalSize int `toml:"local_size"`
+	// LocalTTL bounds how long entries are served from the in-process LRU.
+	LocalTTL TOMLDuration `toml:"local_ttl"`
+	// MemoryMaxEntries bounds the number of entries of the in-memory cache
+	// used when Redis is not configured.
+	MemoryMaxEntries int `toml:"memory_max_entries"`
+	// MemoryMaxBytes bounds the total size of the in-memory cache used when
+	// Redis is not configured.
+	MemoryMaxBytes int64 `toml:"memory_max_bytes"`
+	// AutoConfirmationsGroup is the consensus aware backend group whose
+	// consensus is used to derive auto confirmations.
+	AutoConfirmationsGroup string `toml:"auto_confirmations_group"`
+	// AutoConfirmationsWindow is how long observed reorgs are taken into
+	// account by auto confirmations.
+	AutoConfirmationsWindow TOMLDuration `toml:"auto_confirmations_window"`
+	// EthCall enables the caching of eth_call results at a specific block.
+	EthCall EthCallCacheConfig `toml:"eth_call"`
+	// EthGetLogs enables the caching of eth_getLogs results for block ranges
+	// that can no longer reorg.
+	EthGetLogs EthGetLogsCacheConfig `toml:"eth_get_logs"`
+	// EthFeeHistory enables the caching of eth_feeHistory results, and
+	// optionally their synthesis from a window of the latest blocks.
+	EthFeeHistory EthFeeHistoryCacheConfig `toml:"eth_fee_history"`
+	// Compression selects how cached values are compressed.
+	Compression CacheCompressionConfig `toml:"compression"`
+	// ETag enables conditional requests on responses served from the cache.
+	ETag CacheETagConfig `toml:"etag"`
+	// DebugHeader sets the X-Proxyd-Cache header of responses to HIT, MISS
+	// or STALE, when the cached response had expired.
+	DebugHeader bool `toml:"debug_header"`
+	// RewriteFinalityTags rewrites the safe and finalized tags of requests to
+	// the block numbers polled from BlockSyncRPCURL, so that all backends serve
+	// the same blocks and responses are cached as pinned blocks.
+	RewriteFinalityTags bool `toml:"rewrite_finality_tags"`
+	// Warmup prefetches recent blocks into the cache on startup.
+	Warmup CacheWarmupConfig `toml:"warmup"`
+	// ServeFromLVC answers some methods with the values polled from
+	// BlockSyncRPCURL.
+	ServeFromLVC CacheLVCConfig `toml:"serve_from_lvc"`
+}
+
+// CacheLVCConfig answers eth_blockNumber, eth_gasPrice and
+// eth_maxPriorityFeePerGas from the last-value caches polling
+// block_sync_rpc_url, instead of forwarding them.
+type CacheLVCConfig struct {
+	Enabled bool `toml:"enabled"`
+	// Methods are the methods answered, default all of them.
+	Methods []string `toml:"methods"`
+	// MaxStaleness is the age over which polled values are not served,
+	// default 5s.
+	MaxStaleness TOMLDuration `toml:"max_staleness"`
+}
+
+// CacheWarmupConfig configures the prefetching of recent data into the cache
+// before the RPC server starts accepting traffic.
+type CacheWarmupConfig struct {
+	Enabled bool `toml:"enabled"`
+	// Blocks is the number of latest blocks prefetched, default 16.
+	Blocks int `toml:"blocks"`
+	// Receipts prefetches the receipts of the transactions of these blocks.
+	Receipts bool `toml:"receipts"`
+	// GasPrice prefetches eth_gasPrice.
+	GasPrice bool `toml:"gas_price"`
+	// Timeout bounds the warm-up, default 30s.
+	Timeout TOMLDuration `toml:"timeout"`
+}
+
+// CacheETagConfig configures the ETag set on responses served from the cache.
+// Clients presenting a matching If-None-Match get a 304 without a body.
+type CacheETagConfig struct {
+	Enabled bool `toml:"enabled"`
+	// MinBytes is the size under which responses get no ETag, default 4096.
+	MinBytes int `toml:"min_bytes"`
+}
+
+// CacheCompressionConfig configures the compression of cached values.
+type CacheCompressionConfig struct {
+	// Codec is "snappy", "zstd" or "none". Defaults to snappy.
+	Codec string `toml:"codec"`
+	// Level is the zstd encoder level: "fastest", "default", "better" or
+	// "best".
+	Level string `toml:"level"`
+	// DictionaryFile is a zstd dictionary used to compress cached values.
+	DictionaryFile string `toml:"dictionary_file"`
+	// TrainDictionary trains the dictionary from the first cached values if
+	// DictionaryFile does not exist, and saves it there.
+	TrainDictionary bool `toml:"train_dictionary"`
+	// TrainSamples is the number of values the dictionary is trained from.
+	TrainSamples int `toml:"train_samples"`
+	// MaxDictionaryBytes bounds the size of the trained dictionary.
+	MaxDictionaryBytes int `toml:"max_dictionary_bytes"`
+}
+
+// EthCallCacheConfig configures the caching of eth_call results at a specific
+// block.
+type EthCallCacheConfig struct {
+	Enabled bool `toml:"enabled"`
+	// TTL overrides the default cache TTL for eth_call results.
+	TTL TOMLDuration `toml:"ttl"`
+	// MinConfirmations only caches calls made at a block number once the
+	// block has at least this many confirmations.
+	MinConfirmations int `toml:"min_confirmations"`
+	// MaxEntryBytes does not cache results larger than this.
+	MaxEntryBytes int `toml:"max_entry_bytes"`
+	// MaxBytes caches results in a dedicated in-memory cache of this size,
+	// rather than in the shared cache.
+	MaxBytes int64 `toml:"max_bytes"`
+	// MaxEntries bounds the number of entries of the dedicated cache.
+	MaxEntries int `toml:"max_entries"`
+}
+
+// EthGetLogsCacheConfig configures the caching of eth_getLogs results for
+// block ranges that can no longer reorg.
+type EthGetLogsCacheConfig struct {
+	Enabled bool `toml:"enabled"`
+	// TTL overrides the default cache TTL for eth_getLogs results.
+	TTL TOMLDuration `toml:"ttl"`
+	// MinConfirmations caches ranges once their last block has at least this
+	// many confirmations, rather than once it is finalized.
+	MinConfirmations int `toml:"min_confirmations"`
+	// MaxEntryBytes does not cache results larger than this.
+	MaxEntryBytes int `toml:"max_entry_bytes"`
+}
+
+// EthFeeHistoryCacheConfig configures the caching of eth_feeHistory results.
+type EthFeeHistoryCacheConfig struct {
+	Enabled bool `toml:"enabled"`
+	// TTL overrides the default cache TTL for eth_feeHistory results.
+	TTL TOMLDuration `toml:"ttl"`
+	// SynthesizeBlocks polls the fee history of this many latest blocks, and
+	// answers requests for at most as many latest blocks from it. Disabled if
+	// zero.
+	SynthesizeBlocks int `toml:"synthesize_blocks"`
+	// SynthesizePercentiles are the reward percentiles polled. Requests for
+	// other percentiles are not synthesized.
+	SynthesizePercentiles []float64 `toml:"synthesize_percentiles"`
+}
+
+// CacheMethodConfig configures the caching policy of a single method.
+// Responses are only cached if they satisfy all the configured requirements.
+type CacheMethodConfig struct {
+	// TTL overrides the default cache TTL for this method.
+	TTL TOMLDuration `toml:"ttl"`
+	// PinnedBlock only caches requests made at a specific block number or hash
+	// rather than at a block tag.
+	PinnedBlock bool `toml:"pinned_block"`
+	// MinConfirmations only caches responses for blocks with at least this
+	// many confirmations.
+	MinConfirmations int `toml:"min_confirmations"`
+	// AutoConfirmations only caches responses for blocks with at least the
+	// number of confirmations derived from the consensus of
+	// auto_confirmations_group. MinConfirmations, if set, is a lower bound.
+	AutoConfirmations bool `toml:"auto_confirmations"`
+	// Safe only caches responses for safe blocks.
+	Safe bool `toml:"safe"`
+	// Finalized only caches responses for finalized blocks.
+	Finalized bool `toml:"finalized"`
+	// FinalizedNoExpiry caches responses for finalized blocks without expiry,
+	// as they can't change anymore.
+	FinalizedNoExpiry bool `toml:"finalized_no_expiry"`
+	// MaxSizeBytes does not cache responses larger than this.
+	MaxSizeBytes int `toml:"max_size_bytes"`
+	// NegativeTTL caches null results, such as receipts of pending
+	// transactions, for this long. The other requirements don't apply to them.
+	NegativeTTL TOMLDuration `toml:"negative_ttl"`
 }
 
 type RedisConfig struct {
-	URL       string `toml:"url"`
+	URL string `toml:"url"`
+	// Cluster connects to a Redis Cluster, URL being one of its seed nodes.
+	// More seed nodes can be set with addr query parameters.
+	Cluster bool `toml:"cluster"`
+	// Sentinel discovers the master through Redis Sentinel.
+	Sentinel RedisSentinelConfig `toml:"sentinel"`
+	// Namespace overrides the key namespace of Redis keys.
 	Namespace string `toml:"namespace"`
+
+	// Username and Password authenticate with Redis ACLs, overriding the
+	// credentials of the URL. The password can be read from the environment.
+	Username string `toml:"username"`
+	Password string `toml:"password"`
+	// Database overrides the database index of the URL. Not supported in
+	// cluster mode.
+	Database     int            `toml:"database"`
+	PoolSize     int            `toml:"pool_size"`
+	ReadTimeout  TOMLDuration   `toml:"read_timeout"`
+	WriteTimeout TOMLDuration   `toml:"write_timeout"`
+	TLS          RedisTLSConfig `toml:"tls"`
+	// CircuitBreaker stops sending commands to Redis while it is unavailable.
+	// Meanwhile the cache is disabled, and rate limiters apply the
+	// redis_failure_mode of the rate limit config.
+	CircuitBreaker RedisCircuitBreakerConfig `toml:"circuit_breaker"`
+}
+
+// RedisCircuitBreakerConfig opens the circuit breaker after Threshold
+// consecutive failures, for Cooldown.
+type RedisCircuitBreakerConfig struct {
+	Threshold int          `toml:"threshold"`
+	Cooldown  TOMLDuration `toml:"cooldown"`
+}
+
+// RedisTLSConfig enables TLS to Redis, verifying the server with CAFile
+// instead of the system roots, and authenticating with a client certificate.
+type RedisTLSConfig struct {
+	Enabled        bool   `toml:"enabled"`
+	CAFile         string `toml:"ca_file"`
+	ClientCertFile string `toml:"client_cert_file"`
+	ClientKeyFile  string `toml:"client_key_file"`
+}
+
+// ResponseProjectionConfig configures the projection of the results of a
+// method. Nested fields are separated by dots, and fields of arrays apply to
+// each of their elements.
+type ResponseProjectionConfig struct {
+	// StripFields are removed from results.
+	StripFields []string `toml:"strip_fields"`
+	// CollapseFields replace the objects of a field by one of their fields,
+	// e.g. transactions = "hash" only returns the hashes of transactions.
+	CollapseFields map[string]string `toml:"collapse_fields"`
+}
+
+// ResponseTransformConfig configures a step of the transformation of the
+// results of a method. Nested fields are separated by dots, and fields of
+// arrays apply to each of their elements.
+type ResponseTransformConfig struct {
+	// Op is "strip", removing Fields, "keep", removing the fields of the
+	// objects at Path but Fields, "rename", renaming Field to To, "default",
+	// setting missing or null Field to Value, or "strip_nulls", removing the
+	// null fields of the objects at Path.
+	Op     string   `toml:"op"`
+	Fields []string `toml:"fields"`
+	// Path is empty for the result itself.
+	Path  string      `toml:"path"`
+	Field string      `toml:"field"`
+	To    string      `toml:"to"`
+	Value interface{} `toml:"value"`
+}
+
+// RedisSentinelConfig configures the sentinels monitoring the Redis master.
+type RedisSentinelConfig struct {
+	MasterName string   `toml:"master_name"`
+	Addrs      []string `toml:"addrs"`
+	// Username and Password authenticate to the sentinels. The password can
+	// be read from the environment.
+	Username string `toml:"username"`
+	Password string `toml:"password"`
+}
+
+// AuthKeyConfig configures the requests accepted for an auth key alias.
+type AuthKeyConfig struct {
+	// AllowedOrigins are patterns of the origins allowed to use the key. The
+	// origin of the Referer header is checked if no Origin header is sent.
+	AllowedOrigins []string `toml:"allowed_origins"`
+	// AllowMissingOrigin accepts requests with neither an Origin nor a
+	// Referer header, as sent by non-browser clients.
+	AllowMissingOrigin bool `toml:"allow_missing_origin"`
+	// AllowedCIDRs are the networks of the client IPs allowed to use the key.
+	// Any IP is allowed if empty.
+	AllowedCIDRs []string `toml:"allowed_cidrs"`
+	// AllowCacheControl honors the cache directives of the
+	// X-Proxyd-Cache-Control header of requests made with the key.
+	AllowCacheControl bool `toml:"allow_cache_control"`
+	// BypassCache never serves requests made with the key from the cache.
+	BypassCache bool `toml:"bypass_cache"`
+	// RateLimit is the number of requests per second allowed for the key,
+	// replacing the base rate limit for its requests.
+	RateLimit int `toml:"rate_limit"`
+	// Burst is the number of requests allowed for the key within a second,
+	// above RateLimit. Defaults to RateLimit.
+	Burst int `toml:"burst"`
+	// RateLimitDryRun only records the requests RateLimit would reject.
+	RateLimitDryRun bool `toml:"rate_limit_dry_run"`
+	// MaxBatchSize overrides server.max_batch_size for the key.
+	MaxBatchSize int `toml:"max_batch_size"`
+	// AllowedMethods restricts the key to these methods, among the mapped
+	// ones. Patterns ending with * match methods by prefix, e.g. debug_*.
+	AllowedMethods []string `toml:"allowed_methods"`
+	// DeniedMethods are patterns of the methods the key may not call, even if
+	// allowed by AllowedMethods.
+	DeniedMethods []string `toml:"denied_methods"`
+	// DailyQuota and MonthlyQuota are the number of RPC calls allowed for
+	// the key per UTC day and month. They are tracked in Redis.
+	DailyQuota   int64 `toml:"daily_quota"`
+	MonthlyQuota int64 `toml:"monthly_quota"`
+	// QuotaUnit is what the quotas count: requests, the default, or
+	// compute_units as priced by [compute_units].
+	QuotaUnit string `toml:"quota_unit"`
+	// PriorityClass is the priority class of the requests of the key, unless
+	// their method has one.
+	PriorityClass string `toml:"priority_class"`
+	// GetLogsLimits overrides the eth_getLogs limits set for the key. The
+	// splitting settings apply to all keys.
+	GetLogsLimits *GetLogsLimitsConfig `toml:"get_logs_limits"`
+	// AllowEngineAPI allows the key to call the engine_* methods, which
+	// other clients can't call even if they are mapped.
+	AllowEngineAPI bool `toml:"allow_engine_api"`
+	// GeoIPRules replace the [geoip] rules for the key, if set.
+	GeoIPRules []GeoIPRuleConfig `toml:"geoip_rules"`
+	// GeoIPExempt exempts the key from the [geoip] rules.
+	GeoIPExempt bool `toml:"geoip_exempt"`
+}
+
+type MemcachedConfig struct {
+	Servers []string `toml:"servers"`
+	// Namespace overrides the key namespace of memcached keys.
+	Namespace    string       `toml:"namespace"`
+	Timeout      TOMLDuration `toml:"timeout"`
+	MaxIdleConns int          `toml:"max_idle_conns"`
 }
 
 type MetricsConfig struct {
-	Enabled bool   `toml:"enabled"`
-	Host    string `toml:"host"`
-	Port    int    `toml:"port"`
+	Enabled        bool                       `toml:"enabled"`
+	Host           string                     `toml:"host"`
+	Port           int                        `toml:"port"`
+	BackendMethods BackendMethodMetricsConfig `toml:"backend_methods"`
+}
+
+// BackendMethodMetricsConfig enables histograms of backend latency and
+// counters of backend errors by backend, method and error class. Methods
+// outside of Methods, or beyond the first MaxMethods seen, are labeled other
+// to bound the cardinality of the metrics.
+type BackendMethodMetricsConfig struct {
+	Enabled bool `toml:"enabled"`
+	// Methods labeled individually, by default any method up to MaxMethods.
+	Methods []string `toml:"methods"`
+	// MaxMethods is the most methods labeled individually, default 100.
+	MaxMethods int `toml:"max_methods"`
 }
 
 type RateLimitConfig struct {
@@ -53,12 +697,316 @@ type RateLimitConfig struct {
 	ErrorMessage     string                              `toml:"error_message"`
 	MethodOverrides  map[string]*RateLimitMethodOverride `toml:"method_overrides"`
 	IPHeaderOverride string                              `toml:"ip_header_override"`
+	// RedisFailureMode is how Redis rate limiters behave when Redis is
+	// unavailable: "closed" rejects requests, "open" allows them, and "local"
+	// applies the limits per instance, in memory. Defaults to closed.
+	RedisFailureMode string `toml:"redis_failure_mode"`
+	// Algorithm is "fixed_window", "sliding_window" or "token_bucket".
+	// Defaults to fixed_window.
+	Algorithm string `toml:"algorithm"`
+	// ExemptCIDRs are the IP ranges exempted from rate limits, except global
+	// method overrides.
+	ExemptCIDRs []string `toml:"exempt_cidrs"`
+	// CIDROverrides replace the base rate of the IPs of their ranges.
+	CIDROverrides map[string]*RateLimitCIDROverride `toml:"cidr_overrides"`
+	// DryRun only records the requests the base rate would reject, in the
+	// rate_limit_dry_run_rejections_total metric and logs.
+	DryRun bool `toml:"dry_run"`
+}
+
+// RateLimitCIDROverride is the base rate limit of the IPs of a set of ranges.
+// Each IP is limited separately.
+type RateLimitCIDROverride struct {
+	CIDRs    []string `toml:"cidrs"`
+	BaseRate int      `toml:"base_rate"`
+	DryRun   bool     `toml:"dry_run"`
 }
 
 type RateLimitMethodOverride struct {
 	Limit    int          `toml:"limit"`
 	Interval TOMLDuration `toml:"interval"`
 	Global   bool         `toml:"global"`
+	// ByAuthKey limits authenticated requests per auth key rather than per
+	// IP, so that the clients of a key share its limit.
+	ByAuthKey bool `toml:"by_auth_key"`
+	DryRun    bool `toml:"dry_run"`
+}
+
+// UpgradeHintsConfig configures hints steering clients that heavily poll
+// methods like eth_blockNumber towards the WS subscription endpoint.
+type UpgradeHintsConfig struct {
+	Enabled         bool         `toml:"enabled"`
+	Methods         []string     `toml:"methods"`
+	Threshold       int          `toml:"threshold"`
+	RejectThreshold int          `toml:"reject_threshold"`
+	Interval        TOMLDuration `toml:"interval"`
+	WSURL           string       `toml:"ws_url"`
+	AltSvc          string       `toml:"alt_svc"`
+}
+
+// RequestCoalescingConfig configures the collapsing of identical in-flight
+// read requests into a single upstream call. Only read-only methods can be
+// coalesced, all of them if no methods are given.
+type RequestCoalescingConfig struct {
+	Enabled bool     `toml:"enabled"`
+	Methods []string `toml:"methods"`
+}
+
+// HotReloadConfig configures the reloading of method mappings and rate limits
+// on SIGHUP. A reloaded config is evaluated for evaluation_window and rolled
+// back if its error rate exceeds the previous one by more than
+// max_error_rate_increase.
+type HotReloadConfig struct {
+	Enabled              bool         `toml:"enabled"`
+	EvaluationWindow     TOMLDuration `toml:"evaluation_window"`
+	MaxErrorRateIncrease float64      `toml:"max_error_rate_increase"`
+	MinRequests          int          `toml:"min_requests"`
+}
+
+// MeteringConfig configures the sampling of served requests into a traffic
+// profile, used to evaluate config changes against recent traffic.
+type MeteringConfig struct {
+	Enabled    bool         `toml:"enabled"`
+	SampleRate float64      `toml:"sample_rate"`
+	Window     TOMLDuration `toml:"window"`
+}
+
+// PeeringConfig configures the header protocol between proxyd instances
+// forwarding requests to each other, see the peer option of backends.
+type PeeringConfig struct {
+	Enabled bool `toml:"enabled"`
+	// InstanceID identifies this instance to its peers, defaults to the
+	// hostname.
+	InstanceID string `toml:"instance_id"`
+	MaxHops    int    `toml:"max_hops"`
+	// PeerCIDRs are the addresses of peers, whose peering headers are
+	// honored.
+	PeerCIDRs []string `toml:"peer_cidrs"`
+	// SharedSecret authenticates peers, which send it in the
+	// X-Proxyd-Peer-Secret header. It is sent to peer backends.
+	SharedSecret string `toml:"shared_secret"`
+}
+
+// WSSessionsConfig configures the sessions issued to WS clients, which let
+// them resume their subscriptions and backend on reconnect.
+type WSSessionsConfig struct {
+	Enabled bool `toml:"enabled"`
+	// TTL is how long a session can be resumed after its connection closed,
+	// default 5m.
+	TTL TOMLDuration `toml:"ttl"`
+	// MaxSubscriptions bounds the subscriptions restored per session,
+	// default 32.
+	MaxSubscriptions int `toml:"max_subscriptions"`
+}
+
+// WSMultiplexConfig multiplexes the subscriptions of WS clients, so that
+// clients subscribing with the same params share a single subscription to
+// their backend.
+type WSMultiplexConfig struct {
+	Enabled bool `toml:"enabled"`
+	// Subscriptions are the subscription types multiplexed, default
+	// ["newHeads"].
+	Subscriptions []string `toml:"subscriptions"`
+	// BufferSize bounds the notifications queued per client subscription,
+	// further notifications are dropped. Default 64.
+	BufferSize int `toml:"buffer_size"`
+	// ConsensusHeads serves newHeads subscriptions from the consensus poller
+	// of the WS backend group, which must be consensus aware, instead of
+	// subscribing to backends.
+	ConsensusHeads bool `toml:"consensus_heads"`
+	// FilterLogs shares a single logs subscription without filter per
+	// backend among all logs subscriptions, whose address and topics filters
+	// are applied by proxyd.
+	FilterLogs bool `toml:"filter_logs"`
+}
+
+// WSFailoverConfig fails WS connections over to another backend of the WS
+// backend group when their backend fails, restoring their subscriptions.
+type WSFailoverConfig struct {
+	Enabled bool `toml:"enabled"`
+	// MaxSubscriptions bounds the subscriptions restored per connection,
+	// default 32. The limit of ws_sessions applies to connections with a
+	// session.
+	MaxSubscriptions int `toml:"max_subscriptions"`
+	// GapFill backfills the newHeads and logs notifications missed while
+	// subscriptions were restored, from the new backend over HTTP.
+	GapFill bool `toml:"gap_fill"`
+	// MaxGapBlocks bounds the blocks backfilled per subscription, default 32.
+	// Larger gaps are left unfilled.
+	MaxGapBlocks int `toml:"max_gap_blocks"`
+}
+
+// WSConnLimitsConfig bounds the concurrent WS connections of clients, unlike
+// max_ws_conns which bounds the connections to each backend.
+type WSConnLimitsConfig struct {
+	MaxConns      int `toml:"max_conns"`
+	MaxConnsPerIP int `toml:"max_conns_per_ip"`
+	// ErrorCode is the HTTP status of rejected upgrades, default 429.
+	ErrorCode    int    `toml:"error_code"`
+	ErrorMessage string `toml:"error_message"`
+}
+
+// WSMessageRateLimitConfig limits the RPC messages clients send over WS, per
+// connection and per auth key, or client IP for unauthenticated clients.
+type WSMessageRateLimitConfig struct {
+	ConnectionLimit int          `toml:"connection_limit"`
+	KeyLimit        int          `toml:"key_limit"`
+	Interval        TOMLDuration `toml:"interval"`
+	// Policy is "error" to answer limited messages with an error, the
+	// default, or "close" to close the connection.
+	Policy string `toml:"policy"`
+}
+
+// WSCompressionConfig negotiates permessage-deflate compression on WS
+// connections, without context takeover.
+type WSCompressionConfig struct {
+	// Enabled negotiates compression with clients.
+	Enabled bool `toml:"enabled"`
+	// Level is the flate compression level, from -2 for Huffman only to 9,
+	// default 1 for best speed.
+	Level int `toml:"level"`
+	// MinSize is the size of the smallest messages compressed, default 256.
+	MinSize int `toml:"min_size"`
+	// MaxConns bounds the client connections compressing their messages, as
+	// each holds a compressor while writing. Unlimited if 0.
+	MaxConns int `toml:"max_conns"`
+	// Backends negotiates compression with backends, at the same level.
+	Backends bool `toml:"backends"`
+}
+
+// WSPoolConfig carries the requests of WS clients to each backend over a pool
+// of shared connections, rather than a connection per client. Clients get
+// connections of their own once they subscribe.
+type WSPoolConfig struct {
+	Enabled bool `toml:"enabled"`
+	// Size is the number of connections per backend, default 4.
+	Size int `toml:"size"`
+}
+
+// WSBalancingConfig selects the backends of the WS backend group WS clients
+// connect to.
+type WSBalancingConfig struct {
+	// Strategy is ordered, the default, to connect clients to the first
+	// available backend, or least_connections to connect them to the
+	// available backend with the fewest clients.
+	Strategy string `toml:"strategy"`
+	// Sticky connects the clients of an auth key to the backend the key last
+	// connected to, if available.
+	Sticky bool `toml:"sticky"`
+	// StickyTTL is how long an auth key stays bound to its backend after it
+	// last connected, default 1h.
+	StickyTTL TOMLDuration `toml:"sticky_ttl"`
+}
+
+// SSEConfig serves the multiplexed subscriptions over HTTP, as server-sent
+// event streams, for clients which can't use WS. It requires ws_multiplex.
+type SSEConfig struct {
+	Enabled bool `toml:"enabled"`
+	// KeepaliveInterval is how often a comment is sent on idle streams,
+	// default 15s.
+	KeepaliveInterval TOMLDuration `toml:"keepalive_interval"`
+}
+
+// WSDrainConfig drains the WS connections of clients on shutdown, rather
+// than cutting them: new connections are rejected, and clients are asked to
+// disconnect and waited for up to a deadline.
+type WSDrainConfig struct {
+	Enabled bool `toml:"enabled"`
+	// Timeout is how long clients are waited for, default 30s.
+	Timeout TOMLDuration `toml:"timeout"`
+	// RetryAfter is the delay after which clients are told to reconnect, in
+	// the reason of the close frame and the shutdown notification.
+	RetryAfter TOMLDuration `toml:"retry_after"`
+	// Notify sends clients a proxyd_shutdown notification before the close
+	// frame.
+	Notify bool `toml:"notify"`
+}
+
+// WSMessagePolicyConfig applies the policies of the HTTP path to each RPC
+// message of WS clients, on top of ws_method_whitelist.
+type WSMessagePolicyConfig struct {
+	// EnforceMethodMappings rejects messages whose method isn't in
+	// rpc_method_mappings, eth_subscribe and eth_unsubscribe aside.
+	EnforceMethodMappings bool `toml:"enforce_method_mappings"`
+	// SenderRateLimits applies the sender rate limits, and the validation,
+	// policy and nonce checks of raw transactions, to eth_sendRawTransaction
+	// messages.
+	SenderRateLimits bool `toml:"sender_rate_limits"`
+	// Batches accepts batch messages up to the batch size limit of the HTTP
+	// path, which are otherwise rejected. A batch with a request violating
+	// the policies is rejected as a whole.
+	Batches bool `toml:"batches"`
+	// Policy is "error" to answer violating messages with an error, the
+	// default, or "close" to close the connection.
+	Policy string `toml:"policy"`
+}
+
+// WSConnsConfig configures the heartbeat and limits of WS connections, those
+// of clients and those to backends.
+type WSConnsConfig struct {
+	Client  WSClientConnConfig `toml:"client"`
+	Backend WSConnConfig       `toml:"backend"`
+}
+
+// WSConnConfig configures the heartbeat and limits of WS connections.
+type WSConnConfig struct {
+	// PingInterval is how often connections are pinged, 0 disables pings.
+	PingInterval TOMLDuration `toml:"ping_interval"`
+	// PongTimeout is how long pings are awaited before the connection is
+	// closed, default ping_interval.
+	PongTimeout TOMLDuration `toml:"pong_timeout"`
+	// MaxMessageSize bounds the messages read, which close the connection
+	// when exceeded. Client connections default to max_body_size_bytes,
+	// backend connections are unbounded by default.
+	MaxMessageSize int64 `toml:"max_message_size"`
+	// MaxFrameSize bounds the frames written, which larger messages are
+	// fragmented into. Default 4096.
+	MaxFrameSize int `toml:"max_frame_size"`
+	// WriteTimeout bounds writes, default 10s.
+	WriteTimeout TOMLDuration `toml:"write_timeout"`
+}
+
+// WSClientConnConfig configures the heartbeat and limits of client WS
+// connections. Backend connections are closed with the connections of their
+// clients, or once their multiplexed subscriptions have no subscribers left.
+type WSClientConnConfig struct {
+	WSConnConfig
+	// IdleTimeout closes connections without messages sent or received for
+	// as long, pings and pongs aside. 0 disables it.
+	IdleTimeout TOMLDuration `toml:"idle_timeout"`
+	// SendBufferSize queues up to as many messages to each client, rather
+	// than writing them in line, so that slow clients don't hold up their
+	// backend connections. 0 disables the queue.
+	SendBufferSize int `toml:"send_buffer_size"`
+	// SlowConsumerPolicy is what happens to clients whose queue is full:
+	// "close" closes the connection, the default, and "drop" drops
+	// subscription notifications, other messages waiting up to
+	// write_timeout for room.
+	SlowConsumerPolicy string `toml:"slow_consumer_policy"`
+}
+
+// PriorityConfig assigns requests to priority classes, which share the
+// max_concurrent_rpcs slots in proportion to their weights once they are all
+// in use.
+type PriorityConfig struct {
+	Enabled bool `toml:"enabled"`
+	// DefaultClass is the class of requests whose method and auth key have
+	// none, default "default".
+	DefaultClass string                          `toml:"default_class"`
+	Classes      map[string]*PriorityClassConfig `toml:"classes"`
+	// Methods map methods to their class.
+	Methods map[string]string `toml:"methods"`
+}
+
+type PriorityClassConfig struct {
+	Weight int `toml:"weight"`
+}
+
+// AdminConfig configures the admin API. It is disabled if no port is set.
+type AdminConfig struct {
+	Host  string `toml:"host"`
+	Port  int    `toml:"port"`
+	Token string `toml:"token"`
 }
 
 type TOMLDuration time.Duration
@@ -81,6 +1029,29 @@ type BackendOptions struct {
 	MaxDegradedLatencyThreshold TOMLDuration `toml:"max_degraded_latency_threshold"`
 	MaxLatencyThreshold         TOMLDuration `toml:"max_latency_threshold"`
 	MaxErrorRateThreshold       float64      `toml:"max_error_rate_threshold"`
+
+	// MethodMaxResponseSizeBytes overrides MaxResponseSizeBytes for specific
+	// methods.
+	MethodMaxResponseSizeBytes map[string]int64 `toml:"method_max_response_size_bytes"`
+	// HealthScore configures the health score of backends.
+	HealthScore HealthScoreConfig `toml:"health_score"`
+}
+
+// HealthScoreConfig configures the health score of backends, computed from
+// their latency, error rate and block lag relative to their thresholds. The
+// score decides whether backends are healthy, degraded or banned, and scales
+// their weight in weighted routing.
+type HealthScoreConfig struct {
+	// The weights of the signals. All default to 1 if none is set.
+	LatencyWeight   float64 `toml:"latency_weight"`
+	ErrorRateWeight float64 `toml:"error_rate_weight"`
+	BlockLagWeight  float64 `toml:"block_lag_weight"`
+	// MinScore makes backends unhealthy under this score, in addition to
+	// the latency and error rate thresholds.
+	MinScore float64 `toml:"min_score"`
+	// DegradedScore makes backends degraded under this score, in addition to
+	// the degraded latency threshold.
+	DegradedScore float64 `toml:"degraded_score"`
 }
 
 type BackendConfig struct {
@@ -96,6 +1067,14 @@ type BackendConfig struct {
 	ClientKeyFile    string            `toml:"client_key_file"`
 	StripTrailingXFF bool              `toml:"strip_trailing_xff"`
 	Headers          map[string]string `toml:"headers"`
+	// Peer marks backends that are proxyd instances, which are sent the
+	// peering headers.
+	Peer bool `toml:"peer"`
+	// EngineJWTSecret is the hex encoded secret authenticating to the Engine
+	// API of the backend, as set with --authrpc.jwtsecret. It can be read
+	// from the environment, or from EngineJWTSecretFile.
+	EngineJWTSecret     string `toml:"engine_jwt_secret"`
+	EngineJWTSecretFile string `toml:"engine_jwt_secret_file"`
 
 	Weight int `toml:"weight"`
 
@@ -119,6 +1098,9 @@ type BackendGroupConfig struct {
 	ConsensusMaxBlockLag        uint64       `toml:"consensus_max_block_lag"`
 	ConsensusMaxBlockRange      uint64       `toml:"consensus_max_block_range"`
 	ConsensusMinPeerCount       int          `toml:"consensus_min_peer_count"`
+	// ConsensusLagBudgets maps methods to the number of blocks a backend may
+	// lag behind the highest block of the consensus group to serve them.
+	ConsensusLagBudgets map[string]uint64 `toml:"consensus_lag_budgets"`
 
 	ConsensusHA                  bool         `toml:"consensus_ha"`
 	ConsensusHAHeartbeatInterval TOMLDuration `toml:"consensus_ha_heartbeat_interval"`
@@ -142,27 +1124,326 @@ type SenderRateLimitConfig struct {
 	Interval        TOMLDuration
 	Limit           int
 	AllowedChainIds []*big.Int `toml:"allowed_chain_ids"`
+	// BlobLimit additionally limits the blob transactions of each sender,
+	// across nonces, to this many per BlobInterval.
+	BlobLimit int `toml:"blob_limit"`
+	// BlobInterval defaults to Interval.
+	BlobInterval TOMLDuration `toml:"blob_interval"`
+	// Algorithm is the rate limit algorithm of the sender limits, as
+	// RateLimitConfig.Algorithm.
+	Algorithm string `toml:"algorithm"`
+	// DryRun only records the transactions the sender limits would reject.
+	DryRun bool `toml:"dry_run"`
+	// Allowlist are the senders bypassing the sender limits, e.g. relayers.
+	Allowlist []string `toml:"allowlist"`
+	// ContractLimits additionally limit the transactions of each sender to
+	// these contract addresses.
+	ContractLimits map[string]*SenderContractLimitConfig `toml:"contract_limits"`
+}
+
+// TxValidationConfig rejects eth_sendRawTransaction payloads which are
+// obviously invalid, before they are forwarded.
+type TxValidationConfig struct {
+	Enabled bool `toml:"enabled"`
+	// AllowedChainIDs rejects transactions for other chains if set, 0 allowing
+	// pre-EIP-155 transactions.
+	AllowedChainIDs []*big.Int `toml:"allowed_chain_ids"`
+	// MaxGas rejects transactions with a higher gas limit.
+	MaxGas uint64 `toml:"max_gas"`
+	// MinGasFeeCap rejects transactions with a lower max fee per gas, or gas
+	// price, in wei.
+	MinGasFeeCap *big.Int `toml:"min_gas_fee_cap"`
+	// MaxBlobsPerTx rejects transactions carrying more EIP-4844 blobs.
+	MaxBlobsPerTx int `toml:"max_blobs_per_tx"`
+	// MinBlobFeeCap rejects blob transactions with a lower max fee per blob
+	// gas, in wei.
+	MinBlobFeeCap *big.Int `toml:"min_blob_fee_cap"`
+}
+
+// TxPolicyConfig rejects raw transactions whose sender or recipient is
+// blocklisted, or whose sender is not allowlisted if an allowlist is set.
+type TxPolicyConfig struct {
+	Enabled bool `toml:"enabled"`
+	// RefreshInterval is how often the lists are reloaded, default 1m.
+	RefreshInterval TOMLDuration      `toml:"refresh_interval"`
+	Blocklist       AddressListConfig `toml:"blocklist"`
+	Allowlist       AddressListConfig `toml:"allowlist"`
+}
+
+// TxDedupConfig answers re-submissions of the same raw transaction within
+// Window with the response of the first submission, instead of forwarding it
+// again.
+type TxDedupConfig struct {
+	Enabled bool `toml:"enabled"`
+	// Window is how long responses are kept, default 30s.
+	Window TOMLDuration `toml:"window"`
+	// MaxEntries bounds the kept responses, default 100000.
+	MaxEntries int `toml:"max_entries"`
+}
+
+// TxNonceConfig rejects raw transactions whose nonce was already used, or is
+// too far ahead of the pending nonce of their sender.
+type TxNonceConfig struct {
+	Enabled bool `toml:"enabled"`
+	// RejectNonceTooLow rejects transactions whose nonce is lower than the
+	// nonce of the next transaction of their sender to be included.
+	RejectNonceTooLow bool `toml:"reject_nonce_too_low"`
+	// MaxNonceGap rejects transactions whose nonce is more than MaxNonceGap
+	// ahead of the pending nonce of their sender. 0 disables the check.
+	MaxNonceGap uint64 `toml:"max_nonce_gap"`
+	// BackendGroup is queried for the nonces of senders, default the group of
+	// eth_getTransactionCount.
+	BackendGroup string `toml:"backend_group"`
+	// TTL is how long the nonces of a sender are kept, default 1m.
+	TTL TOMLDuration `toml:"ttl"`
+	// MaxEntries bounds the senders kept in memory when Redis isn't
+	// configured.
+	MaxEntries int `toml:"max_entries"`
+}
+
+// ConditionalTxConfig handles eth_sendRawTransactionConditional requests,
+// routing them to the sequencer backend group once their conditions are
+// validated.
+type ConditionalTxConfig struct {
+	Enabled bool `toml:"enabled"`
+	// BackendGroup is the group of the sequencers, required.
+	BackendGroup string `toml:"backend_group"`
+	// AuthKeys are the auth key aliases allowed to send conditional
+	// transactions. If empty, any auth key may.
+	AuthKeys []string `toml:"auth_keys"`
+	// AllowUnauthenticated allows requests without an auth key.
+	AllowUnauthenticated bool `toml:"allow_unauthenticated"`
+	// MaxCost is the maximum number of known accounts and storage slots of
+	// the conditions, default 1000.
+	MaxCost int `toml:"max_cost"`
+}
+
+// BundlerConfig routes the ERC-4337 methods to a bundler backend group.
+type BundlerConfig struct {
+	Enabled bool `toml:"enabled"`
+	// BackendGroup is the group of the bundlers, required.
+	BackendGroup string `toml:"backend_group"`
+	// EntryPoints rejects user operations for other entry points if set.
+	EntryPoints []string `toml:"entry_points"`
+}
+
+// PrivateTxConfig relays eth_sendPrivateTransaction requests, and optionally
+// eth_sendRawTransaction requests, to a private relay such as Flashbots
+// Protect.
+type PrivateTxConfig struct {
+	Enabled bool `toml:"enabled"`
+	// URL of the relay.
+	URL string `toml:"url"`
+	// SigningKey is the hex private key signing the requests to the relay,
+	// whose address identifies proxyd. Requests are unsigned if unset.
+	SigningKey string `toml:"signing_key"`
+	// SignatureHeader is the header of the signature, default
+	// X-Flashbots-Signature.
+	SignatureHeader string `toml:"signature_header"`
+	// RelayRawTransactions also relays eth_sendRawTransaction requests.
+	RelayRawTransactions bool `toml:"relay_raw_transactions"`
+	// Fallback sends transactions to the group of eth_sendRawTransaction if
+	// the relay fails.
+	Fallback bool `toml:"fallback"`
+	// Timeout of the requests to the relay, default 5s.
+	Timeout TOMLDuration `toml:"timeout"`
+}
+
+// LocalMethodsConfig answers eth_chainId, net_version and web3_clientVersion
+// locally instead of forwarding them.
+type LocalMethodsConfig struct {
+	Enabled bool `toml:"enabled"`
+	// ChainID answers eth_chainId and net_version if set.
+	ChainID uint64 `toml:"chain_id"`
+	// ClientVersion answers web3_clientVersion if set.
+	ClientVersion string `toml:"client_version"`
+	// DisabledMethods are forwarded nonetheless.
+	DisabledMethods []string `toml:"disabled_methods"`
+}
+
+// ParamValidationConfig validates the params of requests of well-known
+// methods locally, rejecting malformed requests with -32602 errors.
+type ParamValidationConfig struct {
+	Enabled bool `toml:"enabled"`
+	// DisabledMethods are not validated.
+	DisabledMethods []string `toml:"disabled_methods"`
+}
+
+// ScriptingConfig runs a Lua script on requests, which may reject them, route
+// them to a backend group or rewrite their method and params.
+type ScriptingConfig struct {
+	Enabled bool `toml:"enabled"`
+	// File is the path of the script.
+	File string `toml:"file"`
+	// Script is the source of the script, if File isn't set.
+	Script string `toml:"script"`
+	// Timeout bounds the CPU time of each call of the script. Default 10ms.
+	Timeout TOMLDuration `toml:"timeout"`
+	// MaxCallStackSize bounds the depth of the Lua call stack. Default 64.
+	MaxCallStackSize int `toml:"max_call_stack_size"`
+	// MaxRegistrySize bounds the number of values on the Lua stack. Together
+	// with MaxCallStackSize it bounds the stack memory of the script, though
+	// not the tables it allocates. Default 65536.
+	MaxRegistrySize int `toml:"max_registry_size"`
+	// MaxParamsSize bounds the size of the params passed to the script and
+	// of the params and reject messages it returns. Requests with larger
+	// params fail the script. Default 65536.
+	MaxParamsSize int `toml:"max_params_size"`
+	// FailOpen forwards requests unchanged if the script fails or times out,
+	// rather than rejecting them.
+	FailOpen bool `toml:"fail_open"`
+}
+
+// FilterEmulationConfig serves the filter methods in proxyd, so that filters
+// can be polled through any backend.
+type FilterEmulationConfig struct {
+	Enabled bool `toml:"enabled"`
+	// TTL is how long filters are kept once polled, default 5m.
+	TTL TOMLDuration `toml:"ttl"`
+	// MaxBlocks bounds the blocks returned by a poll, older blocks being
+	// skipped. Default 256.
+	MaxBlocks uint64 `toml:"max_blocks"`
+	// MaxEntries bounds the filters kept in memory when Redis isn't
+	// configured.
+	MaxEntries int `toml:"max_entries"`
+}
+
+// GetLogsLimitsConfig bounds eth_getLogs requests. Zero limits are disabled.
+// Auth keys may override them.
+type GetLogsLimitsConfig struct {
+	// MaxBlockRange is the maximum number of blocks between fromBlock and
+	// toBlock.
+	MaxBlockRange uint64 `toml:"max_block_range"`
+	// MaxAddresses is the maximum number of addresses of a filter.
+	MaxAddresses int `toml:"max_addresses"`
+	// MaxTopics is the maximum number of topics of a filter, counting each
+	// alternative of a position.
+	MaxTopics int `toml:"max_topics"`
+	// MaxLogs is the maximum number of logs returned, larger results are
+	// replaced with an error.
+	MaxLogs int `toml:"max_logs"`
+	// SplitRanges splits ranges over MaxBlockRange into sub-ranges of at most
+	// MaxBlockRange blocks, forwarded concurrently and merged, instead of
+	// rejecting them.
+	SplitRanges bool `toml:"split_ranges"`
+	// MaxSplits is the maximum number of sub-ranges of a request, requests
+	// over it are rejected. Default 10.
+	MaxSplits int `toml:"max_splits"`
+	// SplitConcurrency is the number of sub-ranges of a request forwarded at
+	// once. Default 4.
+	SplitConcurrency int `toml:"split_concurrency"`
+}
+
+// AddressListConfig configures the sources of an address list, which are
+// merged. Files and URLs hold one address per line.
+type AddressListConfig struct {
+	Addresses []string `toml:"addresses"`
+	File      string   `toml:"file"`
+	// RedisSet is the key of a Redis set of addresses.
+	RedisSet string `toml:"redis_set"`
+	URL      string `toml:"url"`
+}
+
+// SenderContractLimitConfig limits the transactions of each sender to a
+// contract to Limit per Interval, across nonces.
+type SenderContractLimitConfig struct {
+	Limit    int          `toml:"limit"`
+	Interval TOMLDuration `toml:"interval"`
 }
 
 type Config struct {
-	WSBackendGroup        string                `toml:"ws_backend_group"`
-	Server                ServerConfig          `toml:"server"`
-	Cache                 CacheConfig           `toml:"cache"`
-	Redis                 RedisConfig           `toml:"redis"`
-	Metrics               MetricsConfig         `toml:"metrics"`
-	RateLimit             RateLimitConfig       `toml:"rate_limit"`
-	BackendOptions        BackendOptions        `toml:"backend"`
-	Backends              BackendsConfig        `toml:"backends"`
-	BatchConfig           BatchConfig           `toml:"batch"`
-	Authentication        map[string]string     `toml:"authentication"`
-	BackendGroups         BackendGroupsConfig   `toml:"backend_groups"`
-	RPCMethodMappings     map[string]string     `toml:"rpc_method_mappings"`
-	WSMethodWhitelist     []string              `toml:"ws_method_whitelist"`
-	WhitelistErrorMessage string                `toml:"whitelist_error_message"`
-	SenderRateLimit       SenderRateLimitConfig `toml:"sender_rate_limit"`
+	WSBackendGroup        string                    `toml:"ws_backend_group"`
+	Server                ServerConfig              `toml:"server"`
+	Cache                 CacheConfig               `toml:"cache"`
+	Redis                 RedisConfig               `toml:"redis"`
+	Memcached             MemcachedConfig           `toml:"memcached"`
+	Metrics               MetricsConfig             `toml:"metrics"`
+	RateLimit             RateLimitConfig           `toml:"rate_limit"`
+	BackendOptions        BackendOptions            `toml:"backend"`
+	Backends              BackendsConfig            `toml:"backends"`
+	BatchConfig           BatchConfig               `toml:"batch"`
+	Authentication        map[string]string         `toml:"authentication"`
+	AuthKeys              map[string]*AuthKeyConfig `toml:"auth_keys"`
+	JWTAuth               JWTAuthConfig             `toml:"jwt_auth"`
+	APIKeys               APIKeysConfig             `toml:"api_keys"`
+	CORS                  CORSConfig                `toml:"cors"`
+	GeoIP                 GeoIPConfig               `toml:"geoip"`
+	Abuse                 AbuseConfig               `toml:"abuse"`
+	Secrets               SecretsConfig             `toml:"secrets"`
+	AuditLog              AuditLogConfig            `toml:"audit_log"`
+	AccessLog             AccessLogConfig           `toml:"access_log"`
+	ComputeUnits          ComputeUnitsConfig        `toml:"compute_units"`
+	BackendGroups         BackendGroupsConfig       `toml:"backend_groups"`
+	RPCMethodMappings     map[string]string         `toml:"rpc_method_mappings"`
+	WSMethodWhitelist     []string                  `toml:"ws_method_whitelist"`
+	WhitelistErrorMessage string                    `toml:"whitelist_error_message"`
+	SenderRateLimit       SenderRateLimitConfig     `toml:"sender_rate_limit"`
+	TxValidation          TxValidationConfig        `toml:"tx_validation"`
+	TxPolicy              TxPolicyConfig            `toml:"tx_policy"`
+	TxDedup               TxDedupConfig             `toml:"tx_dedup"`
+	TxNonce               TxNonceConfig             `toml:"tx_nonce"`
+	ConditionalTx         ConditionalTxConfig       `toml:"conditional_tx"`
+	Bundler               BundlerConfig             `toml:"bundler"`
+	PrivateTx             PrivateTxConfig           `toml:"private_tx"`
+	LocalMethods          LocalMethodsConfig        `toml:"local_methods"`
+	GetLogsLimits         GetLogsLimitsConfig       `toml:"get_logs_limits"`
+	ParamValidation       ParamValidationConfig     `toml:"param_validation"`
+	Scripting             ScriptingConfig           `toml:"scripting"`
+	FilterEmulation       FilterEmulationConfig     `toml:"filter_emulation"`
+	UpgradeHints          UpgradeHintsConfig        `toml:"upgrade_hints"`
+	RequestCoalescing     RequestCoalescingConfig   `toml:"request_coalescing"`
+	HotReload             HotReloadConfig           `toml:"hot_reload"`
+	Metering              MeteringConfig            `toml:"metering"`
+	Admin                 AdminConfig               `toml:"admin"`
+	Peering               PeeringConfig             `toml:"peering"`
+	WSSessions            WSSessionsConfig          `toml:"ws_sessions"`
+	WSMultiplex           WSMultiplexConfig         `toml:"ws_multiplex"`
+	WSFailover            WSFailoverConfig          `toml:"ws_failover"`
+	WSConnLimits          WSConnLimitsConfig        `toml:"ws_conn_limits"`
+	WSMessageRateLimit    WSMessageRateLimitConfig  `toml:"ws_message_rate_limit"`
+	WSConns               WSConnsConfig             `toml:"ws_conns"`
+	WSMessagePolicy       WSMessagePolicyConfig     `toml:"ws_message_policy"`
+	WSDrain               WSDrainConfig             `toml:"ws_drain"`
+	WSCompression         WSCompressionConfig       `toml:"ws_compression"`
+	WSBalancing           WSBalancingConfig         `toml:"ws_balancing"`
+	WSPool                WSPoolConfig              `toml:"ws_pool"`
+	SSE                   SSEConfig                 `toml:"sse"`
+	Priority              PriorityConfig            `toml:"priority"`
+	// ChainID is the chain served by proxyd. It is the default key namespace.
+	ChainID uint64 `toml:"chain_id"`
+	// KeyNamespace prefixes the cache, LVC and rate limit keys, so that
+	// instances serving different chains can share a Redis or memcached.
+	KeyNamespace string `toml:"key_namespace"`
+	// ResponseProjections map tiers, auth key aliases or "none" for
+	// unauthenticated clients, to the projections of the results of methods.
+	ResponseProjections map[string]map[string]*ResponseProjectionConfig `toml:"response_projections"`
+	// ResponseTransforms map methods to the transformations of their results,
+	// applied in order to the responses of all clients, before projections.
+	ResponseTransforms map[string][]ResponseTransformConfig `toml:"response_transforms"`
+}
+
+// keyNamespace returns the namespace of the keys of a store shared between
+// instances: override if set, then the key namespace, then the chain ID.
+func (c *Config) keyNamespace(override string) string {
+	if override != "" {
+		return override
+	}
+	if c.KeyNamespace != "" {
+		return c.KeyNamespace
+	}
+	if c.ChainID != 0 {
+		return strconv.FormatUint(c.ChainID, 10)
+	}
+	return ""
 }
 
+// ReadFromEnvOrConfig resolves value: $NAME reads the env var NAME,
+// vault://<path>#<field> and awssm://<secret id>#<field> read a secret of
+// Vault or AWS Secrets Manager, and a leading \ escapes the others.
 func ReadFromEnvOrConfig(value string) (string, error) {
+	if isSecretRef(value) {
+		return currentSecrets().resolve(value)
+	}
 	if strings.HasPrefix(value, "$") {
 		envValue := os.Getenv(strings.TrimPrefix(value, "$"))
 		if envValue == "" {
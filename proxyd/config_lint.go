@@ -0,0 +1,138 @@
+package proxyd
+
+import (
+	"sort"
+	"time"
+)
+
+// ConfigLintReport lists how a proposed config would treat the traffic in a
+// recent traffic profile differently from the current config. Request counts
+// are estimates of the actual requests over the profile duration.
+type ConfigLintReport struct {
+	ProfileStart time.Time      `json:"profile_start"`
+	ProfileEnd   time.Time      `json:"profile_end"`
+	Unmapped     []*LintFinding `json:"unmapped"`
+	Rerouted     []*LintFinding `json:"rerouted"`
+	RateLimited  []*LintFinding `json:"rate_limited"`
+}
+
+type LintFinding struct {
+	Method   string  `json:"method"`
+	Requests float64 `json:"requests"`
+	From     string  `json:"from,omitempty"`
+	To       string  `json:"to,omitempty"`
+	Clients  int     `json:"clients,omitempty"`
+}
+
+// LintConfig evaluates the method mappings and rate limits of proposed against
+// the ones of current for the traffic in profile.
+func LintConfig(current *Config, proposed *Config, profile *TrafficProfile) (*ConfigLintReport, error) {
+	currentLims, err := newLintRateLimits(current.RateLimit)
+	if err != nil {
+		return nil, err
+	}
+	proposedLims, err := newLintRateLimits(proposed.RateLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ConfigLintReport{
+		ProfileStart: profile.Start,
+		ProfileEnd:   profile.End,
+		Unmapped:     make([]*LintFinding, 0),
+		Rerouted:     make([]*LintFinding, 0),
+		RateLimited:  make([]*LintFinding, 0),
+	}
+	if profile.SampleRate <= 0 || profile.Duration() <= 0 {
+		return report, nil
+	}
+	scale := 1 / profile.SampleRate
+	seconds := profile.Duration().Seconds()
+
+	// requests per second of each client across all methods, for the base rate limit
+	clientRates := make(map[string]float64)
+	for _, mt := range profile.Methods {
+		for remoteIP, ct := range mt.Clients {
+			clientRates[remoteIP] += float64(ct.Requests) * scale / seconds
+		}
+	}
+
+	for method, mt := range profile.Methods {
+		from := current.RPCMethodMappings[method]
+		to := proposed.RPCMethodMappings[method]
+		requests := float64(mt.Requests) * scale
+		if to == "" {
+			report.Unmapped = append(report.Unmapped, &LintFinding{
+				Method:   method,
+				Requests: requests,
+				From:     from,
+			})
+			continue
+		}
+		if from != "" && from != to {
+			report.Rerouted = append(report.Rerouted, &LintFinding{
+				Method:   method,
+				Requests: requests,
+				From:     from,
+				To:       to,
+			})
+		}
+
+		limited := &LintFinding{Method: method}
+		for remoteIP, ct := range mt.Clients {
+			methodRate := float64(ct.Requests) * scale / seconds
+			if proposedLims.limited(method, ct, methodRate, clientRates[remoteIP]) &&
+				!currentLims.limited(method, ct, methodRate, clientRates[remoteIP]) {
+				limited.Clients++
+				limited.Requests += float64(ct.Requests) * scale
+			}
+		}
+		if limited.Clients > 0 {
+			report.RateLimited = append(report.RateLimited, limited)
+		}
+	}
+
+	for _, findings := range [][]*LintFinding{report.Unmapped, report.Rerouted, report.RateLimited} {
+		sort.Slice(findings, func(i, j int) bool {
+			return findings[i].Requests > findings[j].Requests
+		})
+	}
+	return report, nil
+}
+
+type lintRateLimits struct {
+	config  RateLimitConfig
+	routing *routingConfig
+}
+
+func newLintRateLimits(config RateLimitConfig) (*lintRateLimits, error) {
+	// reuse the server's interpretation of the rate limit config
+	routing, err := newRoutingConfig(nil, config, func(time.Duration, int, string) FrontendRateLimiter {
+		return NoopFrontendRateLimiter
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &lintRateLimits{
+		config:  config,
+		routing: routing,
+	}, nil
+}
+
+// limited returns whether a client sending methodRate requests per second for
+// method, and clientRate requests per second overall, would be rate limited.
+func (l *lintRateLimits) limited(method string, ct *ClientTraffic, methodRate float64, clientRate float64) bool {
+	exempt := l.routing.isUnlimitedOrigin(ct.Origin) || l.routing.isUnlimitedUserAgent(ct.UserAgent)
+
+	if override, ok := l.config.MethodOverrides[method]; ok && (override.Global || !exempt) {
+		if methodRate*time.Duration(override.Interval).Seconds() > float64(override.Limit) {
+			return true
+		}
+	}
+	if l.config.BaseRate > 0 && !exempt {
+		if clientRate*time.Duration(l.config.BaseInterval).Seconds() > float64(l.config.BaseRate) {
+			return true
+		}
+	}
+	return false
+}
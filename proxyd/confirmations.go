@@ -0,0 +1,105 @@
+package proxyd
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+const (
+	defaultAutoConfirmationsWindow = 24 * time.Hour
+	defaultAutoConfirmationsMin    = 1
+)
+
+type observedReorg struct {
+	at    time.Time
+	depth uint64
+}
+
+// AutoConfirmations derives the number of confirmations after which responses
+// are safe to cache from the consensus of a backend group. It is the depth of
+// the deepest reorg observed over a window plus one, bounded above by the
+// distance between the latest and safe consensus blocks (or finalized, if safe
+// is not available), since blocks past those are not expected to reorg.
+type AutoConfirmations struct {
+	groupName string
+	min       uint64
+	window    time.Duration
+
+	mtx       sync.Mutex
+	reorgs    []observedReorg
+	headDepth uint64
+}
+
+func NewAutoConfirmations(groupName string, min uint64, window time.Duration) *AutoConfirmations {
+	if min == 0 {
+		min = defaultAutoConfirmationsMin
+	}
+	if window == 0 {
+		window = defaultAutoConfirmationsWindow
+	}
+	return &AutoConfirmations{
+		groupName: groupName,
+		min:       min,
+		window:    window,
+	}
+}
+
+// ObserveReorg records a reorg of depth blocks of the consensus.
+func (a *AutoConfirmations) ObserveReorg(depth uint64) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	a.reorgs = append(a.reorgs, observedReorg{at: time.Now(), depth: depth})
+	a.record()
+}
+
+// ObserveConsensus records the latest, safe and finalized consensus blocks.
+func (a *AutoConfirmations) ObserveConsensus(latest, safe, finalized hexutil.Uint64) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	switch {
+	case safe > 0 && latest >= safe:
+		a.headDepth = uint64(latest - safe)
+	case finalized > 0 && latest >= finalized:
+		a.headDepth = uint64(latest - finalized)
+	default:
+		a.headDepth = 0
+	}
+	a.record()
+}
+
+// Confirmations returns the effective number of confirmations.
+func (a *AutoConfirmations) Confirmations() uint64 {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	return a.confirmations()
+}
+
+func (a *AutoConfirmations) confirmations() uint64 {
+	cutoff := time.Now().Add(-a.window)
+	i := 0
+	for i < len(a.reorgs) && a.reorgs[i].at.Before(cutoff) {
+		i++
+	}
+	a.reorgs = a.reorgs[i:]
+
+	var deepest uint64
+	for _, r := range a.reorgs {
+		if r.depth > deepest {
+			deepest = r.depth
+		}
+	}
+	confirmations := deepest + 1
+	if a.headDepth > 0 && confirmations > a.headDepth {
+		confirmations = a.headDepth
+	}
+	if confirmations < a.min {
+		confirmations = a.min
+	}
+	return confirmations
+}
+
+func (a *AutoConfirmations) record() {
+	RecordAutoConfirmations(a.groupName, a.confirmations())
+}
@@ -19,6 +19,10 @@ const (
 
 type OnConsensusBroken func()
 
+// OnConsensusHead is called with the latest block of the consensus group
+// whenever it changes.
+type OnConsensusHead func(number hexutil.Uint64, hash string)
+
 // ConsensusPoller checks the consensus state for each member of a BackendGroup
 // resolves the highest common block for multiple nodes, and reconciles the consensus
 // in case of block hash divergence to minimize re-orgs
@@ -26,14 +30,20 @@ type ConsensusPoller struct {
 	ctx        context.Context
 	cancelFunc context.CancelFunc
 	listeners  []OnConsensusBroken
+	// headListeners are guarded by consensusGroupMux.
+	headListeners []OnConsensusHead
+	headNumber    hexutil.Uint64
+	headHash      string
 
 	backendGroup      *BackendGroup
 	backendState      map[*Backend]*backendState
 	consensusGroupMux sync.Mutex
 	consensusGroup    []*Backend
+	consensusLags     map[*Backend]uint64
 
-	tracker      ConsensusTracker
-	asyncHandler ConsensusAsyncHandler
+	tracker           ConsensusTracker
+	asyncHandler      ConsensusAsyncHandler
+	autoConfirmations *AutoConfirmations
 
 	minPeerCount       uint64
 	banPeriod          time.Duration
@@ -73,6 +83,23 @@ func (cp *ConsensusPoller) GetConsensusGroup() []*Backend {
 	return g
 }
 
+// GetConsensusGroupWithinLag returns the backend members that are agreeing in a
+// consensus, and lagging at most maxLag blocks behind the highest latest block
+// among them
+func (cp *ConsensusPoller) GetConsensusGroupWithinLag(maxLag uint64) []*Backend {
+	defer cp.consensusGroupMux.Unlock()
+	cp.consensusGroupMux.Lock()
+
+	g := make([]*Backend, 0, len(cp.consensusGroup))
+	for _, be := range cp.consensusGroup {
+		if cp.consensusLags[be] <= maxLag {
+			g = append(g, be)
+		}
+	}
+
+	return g
+}
+
 // GetLatestBlockNumber returns the `latest` agreed block number in a consensus
 func (ct *ConsensusPoller) GetLatestBlockNumber() hexutil.Uint64 {
 	return ct.tracker.GetLatestBlockNumber()
@@ -181,10 +208,28 @@ func (cp *ConsensusPoller) AddListener(listener OnConsensusBroken) {
 	cp.listeners = append(cp.listeners, listener)
 }
 
+func WithHeadListener(listener OnConsensusHead) ConsensusOpt {
+	return func(cp *ConsensusPoller) {
+		cp.AddHeadListener(listener)
+	}
+}
+
+func (cp *ConsensusPoller) AddHeadListener(listener OnConsensusHead) {
+	cp.consensusGroupMux.Lock()
+	defer cp.consensusGroupMux.Unlock()
+	cp.headListeners = append(cp.headListeners, listener)
+}
+
 func (cp *ConsensusPoller) ClearListeners() {
 	cp.listeners = []OnConsensusBroken{}
 }
 
+func WithAutoConfirmations(autoConfirmations *AutoConfirmations) ConsensusOpt {
+	return func(cp *ConsensusPoller) {
+		cp.autoConfirmations = autoConfirmations
+	}
+}
+
 func WithBanPeriod(banPeriod time.Duration) ConsensusOpt {
 	return func(cp *ConsensusPoller) {
 		cp.banPeriod = banPeriod
@@ -264,6 +309,7 @@ func (cp *ConsensusPoller) UpdateBackend(ctx context.Context, be *Backend) {
 	if !be.IsHealthy() && !be.forcedCandidate {
 		log.Warn("backend banned - not healthy", "backend", be.Name)
 		cp.Ban(be)
+		RecordAuditEvent(AuditEventBackendBan, "backend", be.Name, "group", cp.backendGroup.Name, "reason", "unhealthy")
 		return
 	}
 
@@ -337,6 +383,7 @@ func (cp *ConsensusPoller) UpdateBackend(ctx context.Context, be *Backend) {
 			"latestBlockNumber", latestBlockNumber,
 		)
 		cp.Ban(be)
+		RecordAuditEvent(AuditEventBackendBan, "backend", be.Name, "group", cp.backendGroup.Name, "reason", "unexpected_block_tags")
 	}
 }
 
@@ -369,7 +416,11 @@ func (cp *ConsensusPoller) UpdateBackendGroupConsensus(ctx context.Context) {
 	var lowestLatestBlockHash string
 	var lowestFinalizedBlock hexutil.Uint64
 	var lowestSafeBlock hexutil.Uint64
+	var highestLatestBlock hexutil.Uint64
 	for _, bs := range candidates {
+		if bs.latestBlockNumber > highestLatestBlock {
+			highestLatestBlock = bs.latestBlockNumber
+		}
 		if lowestLatestBlock == 0 || bs.latestBlockNumber < lowestLatestBlock {
 			lowestLatestBlock = bs.latestBlockNumber
 			lowestLatestBlockHash = bs.latestBlockHash
@@ -432,6 +483,10 @@ func (cp *ConsensusPoller) UpdateBackendGroupConsensus(ctx context.Context) {
 		}
 	}
 
+	if broken && cp.autoConfirmations != nil && currentConsensusBlockNumber > proposedBlock {
+		cp.autoConfirmations.ObserveReorg(uint64(currentConsensusBlockNumber - proposedBlock))
+	}
+
 	if broken {
 		// propagate event to other interested parts, such as cache invalidator
 		for _, l := range cp.listeners {
@@ -448,14 +503,20 @@ func (cp *ConsensusPoller) UpdateBackendGroupConsensus(ctx context.Context) {
 	cp.tracker.SetSafeBlockNumber(lowestSafeBlock)
 	cp.tracker.SetFinalizedBlockNumber(lowestFinalizedBlock)
 
+	if cp.autoConfirmations != nil {
+		cp.autoConfirmations.ObserveConsensus(proposedBlock, lowestSafeBlock, lowestFinalizedBlock)
+	}
+
 	// update consensus group
 	group := make([]*Backend, 0, len(candidates))
+	lags := make(map[*Backend]uint64, len(candidates))
 	consensusBackendsNames := make([]string, 0, len(candidates))
 	filteredBackendsNames := make([]string, 0, len(cp.backendGroup.Backends))
 	for _, be := range cp.backendGroup.Backends {
 		_, exist := candidates[be]
 		if exist {
 			group = append(group, be)
+			lags[be] = uint64(highestLatestBlock - candidates[be].latestBlockNumber)
 			consensusBackendsNames = append(consensusBackendsNames, be.Name)
 		} else {
 			filteredBackendsNames = append(filteredBackendsNames, be.Name)
@@ -464,8 +525,18 @@ func (cp *ConsensusPoller) UpdateBackendGroupConsensus(ctx context.Context) {
 
 	cp.consensusGroupMux.Lock()
 	cp.consensusGroup = group
+	cp.consensusLags = lags
+	var headListeners []OnConsensusHead
+	if proposedBlock > 0 && proposedBlockHash != "" && (proposedBlock != cp.headNumber || proposedBlockHash != cp.headHash) {
+		cp.headNumber, cp.headHash = proposedBlock, proposedBlockHash
+		headListeners = cp.headListeners
+	}
 	cp.consensusGroupMux.Unlock()
 
+	for _, l := range headListeners {
+		l(proposedBlock, proposedBlockHash)
+	}
+
 	RecordGroupConsensusLatestBlock(cp.backendGroup, proposedBlock)
 	RecordGroupConsensusSafeBlock(cp.backendGroup, lowestSafeBlock)
 	RecordGroupConsensusFinalizedBlock(cp.backendGroup, lowestFinalizedBlock)
@@ -511,6 +582,7 @@ func (cp *ConsensusPoller) Unban(be *Backend) {
 	defer bs.backendStateMux.Unlock()
 	bs.backendStateMux.Lock()
 	bs.bannedUntil = time.Now().Add(-10 * time.Hour)
+	RecordAuditEvent(AuditEventBackendUnban, "backend", be.Name, "group", cp.backendGroup.Name)
 }
 
 // Reset reset all backend states
@@ -668,6 +740,7 @@ func (cp *ConsensusPoller) getConsensusCandidates() map[*Backend]*backendState {
 	// find the highest common ancestor block
 	lagging := make([]*Backend, 0, len(candidates))
 	for be, bs := range candidates {
+		be.setBlockLag(uint64(highestLatestBlock-bs.latestBlockNumber), cp.maxBlockLag)
 		// check if backend is lagging behind the highest block
 		if uint64(highestLatestBlock-bs.latestBlockNumber) > cp.maxBlockLag {
 			lagging = append(lagging, be)
@@ -0,0 +1,106 @@
+package proxyd
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/rs/cors"
+)
+
+// rateLimitHeaders are exposed to browser clients, to let them throttle
+// themselves.
+var rateLimitHeaders = []string{"X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", "Retry-After"}
+
+// corsOrigins match the origins allowed to make cross-origin requests, by
+// name or by a pattern with a single * wildcard, e.g. https://*.example.com.
+type corsOrigins struct {
+	all      bool
+	names    map[string]bool
+	patterns [][2]string
+}
+
+func newCORSOrigins(origins []string) (*corsOrigins, error) {
+	o := &corsOrigins{names: make(map[string]bool)}
+	if len(origins) == 0 {
+		o.all = true
+	}
+	for _, origin := range origins {
+		origin = strings.ToLower(origin)
+		switch strings.Count(origin, "*") {
+		case 0:
+			o.names[origin] = true
+		case 1:
+			if origin == "*" {
+				o.all = true
+				continue
+			}
+			prefix, suffix, _ := strings.Cut(origin, "*")
+			o.patterns = append(o.patterns, [2]string{prefix, suffix})
+		default:
+			return nil, fmt.Errorf("cors origin %s has more than one wildcard", origin)
+		}
+	}
+	return o, nil
+}
+
+func (o *corsOrigins) allows(origin string) bool {
+	if o.all {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	if o.names[origin] {
+		return true
+	}
+	for _, p := range o.patterns {
+		if len(origin) >= len(p[0])+len(p[1]) && strings.HasPrefix(origin, p[0]) && strings.HasSuffix(origin, p[1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// newCORS returns the CORS handler of the RPC server. Origins must be allowed
+// by config and, for requests made with an auth key restricted to some
+// origins, by the key, so that browsers refuse to send requests the key
+// would be refused anyway.
+func (s *Server) newCORS(config CORSConfig) (*cors.Cors, error) {
+	origins, err := newCORSOrigins(config.AllowedOrigins)
+	if err != nil {
+		return nil, err
+	}
+	methods := config.AllowedMethods
+	if len(methods) == 0 {
+		methods = []string{http.MethodGet, http.MethodPost}
+	}
+	return cors.New(cors.Options{
+		AllowOriginRequestFunc: func(r *http.Request, origin string) bool {
+			return origins.allows(origin) && s.keyAllowsCORSOrigin(r, origin)
+		},
+		AllowedMethods:   methods,
+		AllowedHeaders:   config.AllowedHeaders,
+		ExposedHeaders:   append(append([]string{}, rateLimitHeaders...), config.ExposedHeaders...),
+		AllowCredentials: config.AllowCredentials,
+		MaxAge:           int(time.Duration(config.MaxAge) / time.Second),
+	}), nil
+}
+
+// keyAllowsCORSOrigin returns whether the auth key in the path of r, if any,
+// may be used from origin.
+func (s *Server) keyAllowsCORSOrigin(r *http.Request, origin string) bool {
+	authorization, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if authorization == "" || authorization == "subscribe" || authorization == "healthz" {
+		return true
+	}
+	alias := s.authPaths()[authorization]
+	if alias == "" && s.apiKeys != nil {
+		var err error
+		if alias, err = s.apiKeys.Lookup(r.Context(), authorization); err != nil {
+			log.Error("error looking up api key", "err", err)
+		}
+	}
+	policy := s.authKeyPolicies[alias]
+	return policy == nil || len(policy.allowedOrigins) == 0 || policy.isAllowedOrigin(origin)
+}
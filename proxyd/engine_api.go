@@ -0,0 +1,84 @@
+package proxyd
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// EngineMethodPrefix prefixes the methods of the Engine API, which only auth
+// keys with allow_engine_api may call.
+const EngineMethodPrefix = "engine_"
+
+// engineJWTHeader is the encoded header of the tokens of the Engine API.
+var engineJWTHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+func isEngineMethod(method string) bool {
+	return strings.HasPrefix(method, EngineMethodPrefix)
+}
+
+// readEngineJWTSecret returns the Engine API secret of cfg, hex encoded in
+// engine_jwt_secret or in the engine_jwt_secret_file shared with the node,
+// if any.
+func readEngineJWTSecret(cfg *BackendConfig) ([]byte, error) {
+	encoded, err := ReadFromEnvOrConfig(cfg.EngineJWTSecret)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.EngineJWTSecretFile != "" {
+		if encoded != "" {
+			return nil, errors.New("engine_jwt_secret and engine_jwt_secret_file are mutually exclusive")
+		}
+		data, err := os.ReadFile(cfg.EngineJWTSecretFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading engine JWT secret: %w", err)
+		}
+		encoded = string(data)
+	}
+	if encoded == "" {
+		return nil, nil
+	}
+	secret, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(encoded), "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid engine JWT secret: %w", err)
+	}
+	if len(secret) != 32 {
+		return nil, fmt.Errorf("engine JWT secret must be 32 bytes, got %d", len(secret))
+	}
+	return secret, nil
+}
+
+// engineJWT returns a token authenticating to the Engine API of a node with
+// secret. Nodes only accept tokens issued within the last minute, so one is
+// signed for every request.
+func engineJWT(secret []byte, now time.Time) string {
+	claims := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"iat":%d}`, now.Unix())))
+	signed := engineJWTHeader + "." + claims
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// allowsEngineAPI returns whether the key may call the methods of the Engine
+// API.
+func (p *authKeyPolicy) allowsEngineAPI() bool {
+	return p != nil && p.allowEngineAPI
+}
+
+// withoutEngineMethods returns the methods of whitelist outside of the
+// Engine API.
+func withoutEngineMethods(whitelist *StringSet) *StringSet {
+	allowed := NewStringSet()
+	for _, method := range whitelist.Entries() {
+		if !isEngineMethod(method) {
+			allowed.Add(method)
+		}
+	}
+	return allowed
+}
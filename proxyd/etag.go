@@ -0,0 +1,65 @@
+package proxyd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const defaultETagMinBytes = 4096
+
+// writeETagRes writes the cached response res with an ETag derived from its
+// body. Clients presenting the same ETag in If-None-Match get a 304 without a
+// body. Since the body includes the request IDs, only clients polling with the
+// same IDs benefit from it.
+func (s *Server) writeETagRes(ctx context.Context, w http.ResponseWriter, r *http.Request, res interface{}) {
+	body, err := json.Marshal(res)
+	if err != nil {
+		log.Error("error encoding cached rpc response", "err", err)
+		RecordRPCError(ctx, BackendProxyd, MethodUnknown, err)
+		writeRPCError(ctx, w, nil, ErrInternal)
+		return
+	}
+	body = append(body, '\n')
+
+	w.Header().Set("content-type", "application/json")
+	if len(body) >= s.etagMinBytes {
+		sum := sha256.Sum256(body)
+		etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+		w.Header().Set("ETag", etag)
+		if etagMatches(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			httpResponseCodesTotal.WithLabelValues(strconv.Itoa(http.StatusNotModified)).Inc()
+			RecordETagResponse("not_modified", len(body))
+			return
+		}
+		RecordETagResponse("modified", len(body))
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(body); err != nil {
+		log.Error("error writing rpc response", "err", err)
+		RecordRPCError(ctx, BackendProxyd, MethodUnknown, err)
+		return
+	}
+	httpResponseCodesTotal.WithLabelValues(strconv.Itoa(http.StatusOK)).Inc()
+	RecordResponsePayloadSize(ctx, len(body))
+}
+
+// etagMatches reports whether the If-None-Match header ifNoneMatch matches
+// etag, using the weak comparison.
+func etagMatches(ifNoneMatch string, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
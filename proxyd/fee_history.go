@@ -0,0 +1,272 @@
+package proxyd
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// feeHistory is the result of eth_feeHistory. Values are kept raw, so that
+// responses synthesized from a window are encoded as the backend encoded them.
+type feeHistory struct {
+	OldestBlock      hexutil.Uint64      `json:"oldestBlock"`
+	Reward           [][]json.RawMessage `json:"reward,omitempty"`
+	BaseFee          []json.RawMessage   `json:"baseFeePerGas,omitempty"`
+	GasUsedRatio     []json.RawMessage   `json:"gasUsedRatio"`
+	BlobBaseFee      []json.RawMessage   `json:"baseFeePerBlobGas,omitempty"`
+	BlobGasUsedRatio []json.RawMessage   `json:"blobGasUsedRatio,omitempty"`
+}
+
+// newest returns the number of the newest block of the history.
+func (h *feeHistory) newest() (uint64, bool) {
+	if len(h.GasUsedRatio) == 0 {
+		return 0, false
+	}
+	return uint64(h.OldestBlock) + uint64(len(h.GasUsedRatio)) - 1, true
+}
+
+// slice returns the history of the newest count blocks, with the rewards of the
+// percentiles at indexes only.
+func (h *feeHistory) slice(count int, indexes []int) (*feeHistory, bool) {
+	n := len(h.GasUsedRatio)
+	if count <= 0 || count > n || len(h.BaseFee) != n+1 || (len(indexes) > 0 && len(h.Reward) != n) {
+		return nil, false
+	}
+	start := n - count
+	res := &feeHistory{
+		OldestBlock:  h.OldestBlock + hexutil.Uint64(start),
+		BaseFee:      h.BaseFee[start:],
+		GasUsedRatio: h.GasUsedRatio[start:],
+	}
+	if len(indexes) > 0 {
+		res.Reward = make([][]json.RawMessage, count)
+		for i, rewards := range h.Reward[start:] {
+			res.Reward[i] = make([]json.RawMessage, len(indexes))
+			for j, idx := range indexes {
+				if idx >= len(rewards) {
+					return nil, false
+				}
+				res.Reward[i][j] = rewards[idx]
+			}
+		}
+	}
+	if len(h.BlobBaseFee) == n+1 && len(h.BlobGasUsedRatio) == n {
+		res.BlobBaseFee = h.BlobBaseFee[start:]
+		res.BlobGasUsedRatio = h.BlobGasUsedRatio[start:]
+	}
+	return res, true
+}
+
+type feeHistoryParams struct {
+	blockCount  uint64
+	newestBlock rpc.BlockNumber
+	percentiles []float64
+}
+
+func parseFeeHistoryParams(req *RPCReq) (*feeHistoryParams, bool) {
+	var params []json.RawMessage
+	if err := json.Unmarshal(req.Params, &params); err != nil || len(params) < 2 || len(params) > 3 {
+		return nil, false
+	}
+	var blockCount math.HexOrDecimal64
+	if err := json.Unmarshal(params[0], &blockCount); err != nil || blockCount == 0 {
+		return nil, false
+	}
+	var newestBlock rpc.BlockNumber
+	if err := json.Unmarshal(params[1], &newestBlock); err != nil {
+		return nil, false
+	}
+	var percentiles []float64
+	if len(params) == 3 {
+		if err := json.Unmarshal(params[2], &percentiles); err != nil {
+			return nil, false
+		}
+	}
+	return &feeHistoryParams{
+		blockCount:  uint64(blockCount),
+		newestBlock: newestBlock,
+		percentiles: percentiles,
+	}, true
+}
+
+func formatPercentiles(percentiles []float64) string {
+	formatted := make([]string, len(percentiles))
+	for i, p := range percentiles {
+		formatted[i] = strconv.FormatFloat(p, 'f', -1, 64)
+	}
+	return strings.Join(formatted, ",")
+}
+
+// ethFeeHistoryHandler caches eth_feeHistory results keyed by the block count,
+// the newest block and the reward percentiles. Requests for the latest block
+// are keyed by the current latest block number, so that their entries are
+// superseded as soon as a new block is seen. With a window, requests for the
+// latest block are answered from the history of the latest blocks polled from
+// block_sync_rpc_url.
+type ethFeeHistoryHandler struct {
+	*StaticMethodHandler
+	getLatestBlockNumFn GetBlockNumFn
+	window              *EthLastValueCache
+	windowPercentiles   []float64
+}
+
+func newEthFeeHistoryHandler(cache Cache, cfg EthFeeHistoryCacheConfig, getLatestBlockNumFn GetBlockNumFn, window *EthLastValueCache) *ethFeeHistoryHandler {
+	h := &ethFeeHistoryHandler{
+		getLatestBlockNumFn: getLatestBlockNumFn,
+		window:              window,
+		windowPercentiles:   cfg.SynthesizePercentiles,
+	}
+	h.StaticMethodHandler = &StaticMethodHandler{
+		cache: cache,
+		ttl:   time.Duration(cfg.TTL),
+		keyFn: func(req *RPCReq) string {
+			params, _ := parseFeeHistoryParams(req)
+			newest, _ := h.resolve(params.newestBlock)
+			return strings.Join([]string{
+				"cache",
+				req.Method,
+				hexutil.EncodeUint64(params.blockCount),
+				hexutil.EncodeUint64(newest),
+				formatPercentiles(params.percentiles),
+			}, ":")
+		},
+		filterGet: func(req *RPCReq) bool {
+			params, ok := parseFeeHistoryParams(req)
+			if !ok {
+				return false
+			}
+			_, ok = h.resolve(params.newestBlock)
+			return ok
+		},
+		filterPut: func(req *RPCReq, res *RPCRes) bool {
+			params, _ := parseFeeHistoryParams(req)
+			want, _ := h.resolve(params.newestBlock)
+			// the backend may lag behind the latest block seen
+			history, ok := decodeFeeHistory(res.Result)
+			if !ok {
+				return false
+			}
+			newest, ok := history.newest()
+			return ok && newest == want
+		},
+	}
+	return h
+}
+
+// resolve returns the number of newestBlock, if it is the latest block or a
+// block number no greater than it.
+func (h *ethFeeHistoryHandler) resolve(newestBlock rpc.BlockNumber) (uint64, bool) {
+	latest, err := h.getLatestBlockNumFn(context.Background())
+	if err != nil {
+		return 0, false
+	}
+	if newestBlock == rpc.LatestBlockNumber {
+		return latest, true
+	}
+	if newestBlock < 0 || uint64(newestBlock) > latest {
+		return 0, false
+	}
+	return uint64(newestBlock), true
+}
+
+func (h *ethFeeHistoryHandler) GetRPCMethod(ctx context.Context, req *RPCReq) (*RPCRes, error) {
+	if res := h.synthesize(ctx, req); res != nil {
+		return res, nil
+	}
+	return h.StaticMethodHandler.GetRPCMethod(ctx, req)
+}
+
+// synthesize answers req from the window, if it asks for the history of at
+// most as many latest blocks, with percentiles of the window, and the window
+// is up to date with the latest block.
+func (h *ethFeeHistoryHandler) synthesize(ctx context.Context, req *RPCReq) *RPCRes {
+	if h.window == nil {
+		return nil
+	}
+	params, ok := parseFeeHistoryParams(req)
+	if !ok || params.newestBlock != rpc.LatestBlockNumber {
+		return nil
+	}
+	indexes, ok := h.percentileIndexes(params.percentiles)
+	if !ok {
+		return nil
+	}
+
+	value, err := h.window.Read(ctx)
+	if err != nil || value == "" {
+		return nil
+	}
+	var window feeHistory
+	if err := json.Unmarshal([]byte(value), &window); err != nil {
+		return nil
+	}
+	newest, ok := window.newest()
+	if latest, err := h.getLatestBlockNumFn(ctx); !ok || err != nil || newest != latest {
+		return nil
+	}
+	if params.blockCount > uint64(len(window.GasUsedRatio)) {
+		return nil
+	}
+	history, ok := window.slice(int(params.blockCount), indexes)
+	if !ok {
+		return nil
+	}
+
+	var result interface{}
+	if err := json.Unmarshal(mustMarshalJSON(history), &result); err != nil {
+		return nil
+	}
+	return &RPCRes{
+		JSONRPC: req.JSONRPC,
+		Result:  result,
+		ID:      req.ID,
+	}
+}
+
+// percentileIndexes returns the indexes of percentiles in the percentiles of
+// the window. Percentiles must be increasing, as the backend would otherwise
+// reject them.
+func (h *ethFeeHistoryHandler) percentileIndexes(percentiles []float64) ([]int, bool) {
+	indexes := make([]int, 0, len(percentiles))
+	next := 0
+	for _, p := range percentiles {
+		for next < len(h.windowPercentiles) && h.windowPercentiles[next] < p {
+			next++
+		}
+		if next == len(h.windowPercentiles) || h.windowPercentiles[next] != p {
+			return nil, false
+		}
+		indexes = append(indexes, next)
+		next++
+	}
+	return indexes, true
+}
+
+func decodeFeeHistory(result interface{}) (*feeHistory, bool) {
+	if result == nil {
+		return nil, false
+	}
+	var history feeHistory
+	if err := json.Unmarshal(mustMarshalJSON(result), &history); err != nil {
+		return nil, false
+	}
+	return &history, true
+}
+
+func makeFeeHistoryLVC(client *ethclient.Client, cache Cache, blocks int, percentiles []float64) *EthLastValueCache {
+	return newLVC(client, cache, "lvc:fee_history", func(ctx context.Context, c *ethclient.Client) (string, error) {
+		var history json.RawMessage
+		err := c.Client().CallContext(ctx, &history, "eth_feeHistory", hexutil.Uint64(blocks), "latest", percentiles)
+		if err != nil {
+			return "", err
+		}
+		return string(history), nil
+	})
+}
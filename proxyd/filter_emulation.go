@@ -0,0 +1,289 @@
+package proxyd
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	FilterTypeLogs   = "logs"
+	FilterTypeBlocks = "blocks"
+
+	defaultFilterTTL       = 5 * time.Minute
+	defaultFilterMaxBlocks = 256
+)
+
+var ErrFilterNotFound = &RPCErr{
+	Code:          JSONRPCErrorInternal,
+	Message:       "filter not found",
+	HTTPErrorCode: 400,
+}
+
+// emulatedFilter is the state of a filter, kept between polls.
+type emulatedFilter struct {
+	Type string `json:"type"`
+	// Criteria is the logs filter of logs filters.
+	Criteria json.RawMessage `json:"criteria,omitempty"`
+	// Next is the first block of the next poll.
+	Next hexutil.Uint64 `json:"next"`
+}
+
+// FilterEmulator serves eth_newFilter, eth_newBlockFilter,
+// eth_getFilterChanges, eth_getFilterLogs and eth_uninstallFilter in proxyd,
+// rather than forwarding them to backends whose filters are local to them.
+// Filters are kept in Redis if it is configured, so that they can be polled
+// through any proxyd instance, or in memory. Polls are answered with
+// eth_blockNumber, eth_getBlockByNumber and eth_getLogs requests sent through
+// the regular request path, whose responses may be cached. Filters expire when
+// they aren't polled for the TTL, and polls are expected to be sequential.
+//
+// Unlike backends, reorgs aren't reported: logs of blocks polled already are
+// never returned as removed.
+type FilterEmulator struct {
+	cache     Cache
+	maxBlocks uint64
+	call      func(ctx context.Context, reqs []*RPCReq) ([]*RPCRes, error)
+}
+
+func NewFilterEmulator(config FilterEmulationConfig, r redis.UniversalClient, namespace string, call func(ctx context.Context, reqs []*RPCReq) ([]*RPCRes, error)) *FilterEmulator {
+	ttl := defaultFilterTTL
+	if config.TTL != 0 {
+		ttl = time.Duration(config.TTL)
+	}
+	maxBlocks := uint64(defaultFilterMaxBlocks)
+	if config.MaxBlocks != 0 {
+		maxBlocks = config.MaxBlocks
+	}
+	var cache Cache
+	if r != nil {
+		cache = newRedisCache(r, namespace, ttl)
+	} else {
+		cache = &ttlCache{cache: newMemoryCache(config.MaxEntries, 0), ttl: ttl}
+	}
+	return &FilterEmulator{
+		cache:     cache,
+		maxBlocks: maxBlocks,
+		call:      call,
+	}
+}
+
+// Handlers returns the handlers of the emulated methods.
+func (e *FilterEmulator) Handlers() map[string]MethodHandlerFunc {
+	return map[string]MethodHandlerFunc{
+		"eth_newFilter":        e.newFilter,
+		"eth_newBlockFilter":   e.newBlockFilter,
+		"eth_getFilterChanges": e.getFilterChanges,
+		"eth_getFilterLogs":    e.getFilterLogs,
+		"eth_uninstallFilter":  e.uninstallFilter,
+	}
+}
+
+func (e *FilterEmulator) newFilter(ctx context.Context, req *RPCReq) (interface{}, error) {
+	var params []json.RawMessage
+	if err := json.Unmarshal(req.Params, &params); err != nil || len(params) != 1 {
+		return nil, ErrInvalidParams("expected a filter object")
+	}
+	var criteria logsFilter
+	if err := json.Unmarshal(params[0], &criteria); err != nil {
+		return nil, ErrInvalidParams(err.Error())
+	}
+	if criteria.BlockHash != nil {
+		return nil, ErrInvalidParams("filters can't query a block hash")
+	}
+	return e.install(ctx, &emulatedFilter{Type: FilterTypeLogs, Criteria: params[0]})
+}
+
+func (e *FilterEmulator) newBlockFilter(ctx context.Context, req *RPCReq) (interface{}, error) {
+	return e.install(ctx, &emulatedFilter{Type: FilterTypeBlocks})
+}
+
+// install keeps f, which is polled from the block following the latest one.
+func (e *FilterEmulator) install(ctx context.Context, f *emulatedFilter) (interface{}, error) {
+	latest, err := e.latestBlock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	f.Next = latest + 1
+	id := newSubscriptionID()
+	if err := e.put(ctx, id, f); err != nil {
+		return nil, err
+	}
+	RecordFilterInstalled(f.Type)
+	return id, nil
+}
+
+func (e *FilterEmulator) getFilterChanges(ctx context.Context, req *RPCReq) (interface{}, error) {
+	id, f, err := e.get(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	latest, err := e.latestBlock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	from, to := uint64(f.Next), uint64(latest)
+	// blocks beyond maxBlocks behind weren't polled in time, and are skipped
+	if to >= from && to-from+1 > e.maxBlocks {
+		from = to - e.maxBlocks + 1
+	}
+
+	var changes interface{}
+	next := latest + 1
+	switch f.Type {
+	case FilterTypeBlocks:
+		var hashes []string
+		if hashes, err = e.blockHashes(ctx, from, to); err == nil && from <= to {
+			// blocks not available yet are returned by the next poll
+			next = hexutil.Uint64(from + uint64(len(hashes)))
+		}
+		changes = hashes
+	default:
+		changes, err = e.logs(ctx, f.Criteria, from, to)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if next > f.Next {
+		f.Next = next
+	}
+	if err := e.put(ctx, id, f); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+func (e *FilterEmulator) getFilterLogs(ctx context.Context, req *RPCReq) (interface{}, error) {
+	id, f, err := e.get(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if f.Type != FilterTypeLogs {
+		return nil, ErrFilterNotFound
+	}
+	res, err := e.call(ctx, []*RPCReq{newWarmupReq(0, "eth_getLogs", f.Criteria)})
+	if err != nil {
+		return nil, err
+	}
+	// polling the logs of a filter keeps it alive
+	if err := e.put(ctx, id, f); err != nil {
+		return nil, err
+	}
+	return res[0].Result, nil
+}
+
+func (e *FilterEmulator) uninstallFilter(ctx context.Context, req *RPCReq) (interface{}, error) {
+	id, err := filterID(req)
+	if err != nil {
+		return nil, err
+	}
+	return e.cache.Delete(ctx, filterCacheKey(id))
+}
+
+// blockHashes returns the hashes of the blocks from from to to.
+func (e *FilterEmulator) blockHashes(ctx context.Context, from, to uint64) ([]string, error) {
+	hashes := []string{}
+	if from > to {
+		return hashes, nil
+	}
+	reqs := make([]*RPCReq, 0, to-from+1)
+	for n := from; n <= to; n++ {
+		reqs = append(reqs, newWarmupReq(len(reqs), "eth_getBlockByNumber", hexutil.EncodeUint64(n), false))
+	}
+	res, err := e.call(ctx, reqs)
+	if err != nil {
+		return nil, err
+	}
+	for _, blockRes := range res {
+		var block gapFillBlock
+		if err := decodeWarmupResult(blockRes, &block); err != nil {
+			return nil, err
+		}
+		if block.Hash == "" {
+			// the block isn't available yet on the backend serving it
+			break
+		}
+		hashes = append(hashes, block.Hash)
+	}
+	return hashes, nil
+}
+
+// logs returns the logs matching criteria from block from to block to, within
+// the block range of criteria.
+func (e *FilterEmulator) logs(ctx context.Context, criteria json.RawMessage, from, to uint64) (interface{}, error) {
+	var c logsFilter
+	if err := json.Unmarshal(criteria, &c); err != nil {
+		return nil, err
+	}
+	if c.FromBlock != nil && *c.FromBlock >= 0 && uint64(*c.FromBlock) > from {
+		from = uint64(*c.FromBlock)
+	}
+	if c.ToBlock != nil && *c.ToBlock >= 0 && uint64(*c.ToBlock) < to {
+		to = uint64(*c.ToBlock)
+	}
+	if from > to {
+		return []interface{}{}, nil
+	}
+
+	var filter map[string]json.RawMessage
+	if err := json.Unmarshal(criteria, &filter); err != nil {
+		return nil, err
+	}
+	filter["fromBlock"] = mustMarshalJSON(hexutil.EncodeUint64(from))
+	filter["toBlock"] = mustMarshalJSON(hexutil.EncodeUint64(to))
+	res, err := e.call(ctx, []*RPCReq{newWarmupReq(0, "eth_getLogs", filter)})
+	if err != nil {
+		return nil, err
+	}
+	return res[0].Result, nil
+}
+
+func (e *FilterEmulator) latestBlock(ctx context.Context) (hexutil.Uint64, error) {
+	res, err := e.call(ctx, []*RPCReq{newWarmupReq(0, "eth_blockNumber")})
+	if err != nil {
+		return 0, err
+	}
+	var latest hexutil.Uint64
+	if err := decodeWarmupResult(res[0], &latest); err != nil {
+		return 0, err
+	}
+	return latest, nil
+}
+
+func (e *FilterEmulator) get(ctx context.Context, req *RPCReq) (string, *emulatedFilter, error) {
+	id, err := filterID(req)
+	if err != nil {
+		return "", nil, err
+	}
+	val, err := e.cache.Get(ctx, filterCacheKey(id))
+	if err != nil {
+		return "", nil, err
+	}
+	if val == "" {
+		return "", nil, ErrFilterNotFound
+	}
+	var f emulatedFilter
+	if err := json.Unmarshal([]byte(val), &f); err != nil {
+		return "", nil, err
+	}
+	return id, &f, nil
+}
+
+func (e *FilterEmulator) put(ctx context.Context, id string, f *emulatedFilter) error {
+	return e.cache.Put(ctx, filterCacheKey(id), string(mustMarshalJSON(f)))
+}
+
+func filterID(req *RPCReq) (string, error) {
+	var params []string
+	if err := json.Unmarshal(req.Params, &params); err != nil || len(params) != 1 {
+		return "", ErrInvalidParams("expected a filter ID")
+	}
+	return params[0], nil
+}
+
+func filterCacheKey(id string) string {
+	return "filter:" + id
+}
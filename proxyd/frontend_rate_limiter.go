@@ -6,6 +6,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/ethereum/go-ethereum/log"
 	"github.com/redis/go-redis/v9"
 )
 
@@ -20,6 +21,41 @@ type FrontendRateLimiter interface {
 	Take(ctx context.Context, key string) (bool, error)
 }
 
+// RateLimitStatus is the status of a rate limit key after a take, sent to
+// clients in the X-RateLimit headers.
+type RateLimitStatus struct {
+	Limit     int
+	Remaining int
+	Reset     time.Time
+}
+
+func newRateLimitStatus(max int, count int64, truncTS int64, dur time.Duration) *RateLimitStatus {
+	remaining := int64(max) - count
+	if remaining < 0 {
+		remaining = 0
+	}
+	return &RateLimitStatus{
+		Limit:     max,
+		Remaining: int(remaining),
+		Reset:     time.Unix(truncTS, 0).Add(dur),
+	}
+}
+
+// StatusFrontendRateLimiter is implemented by rate limiters which can report
+// the status of a key.
+type StatusFrontendRateLimiter interface {
+	TakeStatus(ctx context.Context, key string) (bool, *RateLimitStatus, error)
+}
+
+// takeRateLimit takes key from lim, and returns its status if lim reports it.
+func takeRateLimit(ctx context.Context, lim FrontendRateLimiter, key string) (bool, *RateLimitStatus, error) {
+	if slim, ok := lim.(StatusFrontendRateLimiter); ok {
+		return slim.TakeStatus(ctx, key)
+	}
+	ok, err := lim.Take(ctx, key)
+	return ok, nil, err
+}
+
 // limitedKeys is a wrapper around a map that stores a truncated
 // timestamp and a mutex. The map is used to keep track of rate
 // limit keys, and their used limits.
@@ -36,16 +72,12 @@ func newLimitedKeys(t int64) *limitedKeys {
 	}
 }
 
-func (l *limitedKeys) Take(key string, max int) bool {
+// Take increments the count of key and returns it.
+func (l *limitedKeys) Take(key string) int {
 	l.mtx.Lock()
 	defer l.mtx.Unlock()
-	val, ok := l.keys[key]
-	if !ok {
-		l.keys[key] = 0
-		val = 0
-	}
-	l.keys[key] = val + 1
-	return val < max
+	l.keys[key]++
+	return l.keys[key]
 }
 
 // MemoryFrontendRateLimiter is a rate limiter that stores
@@ -70,6 +102,11 @@ func NewMemoryFrontendRateLimit(dur time.Duration, max int) FrontendRateLimiter
 }
 
 func (m *MemoryFrontendRateLimiter) Take(ctx context.Context, key string) (bool, error) {
+	ok, _, err := m.TakeStatus(ctx, key)
+	return ok, err
+}
+
+func (m *MemoryFrontendRateLimiter) TakeStatus(ctx context.Context, key string) (bool, *RateLimitStatus, error) {
 	m.mtx.Lock()
 	// Create truncated timestamp
 	truncTS := truncateNow(m.dur)
@@ -85,20 +122,22 @@ func (m *MemoryFrontendRateLimiter) Take(ctx context.Context, key string) (bool,
 
 	m.mtx.Unlock()
 
-	return limiter.Take(key, m.max), nil
+	count := limiter.Take(key)
+	return count <= m.max, newRateLimitStatus(m.max, int64(count), truncTS, m.dur), nil
 }
 
 // RedisFrontendRateLimiter is a rate limiter that stores data in Redis.
 // It uses the basic rate limiter pattern described on the Redis best
 // practices website: https://redis.com/redis-best-practices/basic-rate-limiting/.
+// Each take only touches a single key, so it also works with Redis Cluster.
 type RedisFrontendRateLimiter struct {
-	r      *redis.Client
+	r      redis.UniversalClient
 	dur    time.Duration
 	max    int
 	prefix string
 }
 
-func NewRedisFrontendRateLimiter(r *redis.Client, dur time.Duration, max int, prefix string) FrontendRateLimiter {
+func NewRedisFrontendRateLimiter(r redis.UniversalClient, dur time.Duration, max int, prefix string) FrontendRateLimiter {
 	return &RedisFrontendRateLimiter{
 		r:      r,
 		dur:    dur,
@@ -108,6 +147,11 @@ func NewRedisFrontendRateLimiter(r *redis.Client, dur time.Duration, max int, pr
 }
 
 func (r *RedisFrontendRateLimiter) Take(ctx context.Context, key string) (bool, error) {
+	ok, _, err := r.TakeStatus(ctx, key)
+	return ok, err
+}
+
+func (r *RedisFrontendRateLimiter) TakeStatus(ctx context.Context, key string) (bool, *RateLimitStatus, error) {
 	var incr *redis.IntCmd
 	truncTS := truncateNow(r.dur)
 	fullKey := fmt.Sprintf("rate_limit:%s:%s:%d", r.prefix, key, truncTS)
@@ -118,10 +162,86 @@ func (r *RedisFrontendRateLimiter) Take(ctx context.Context, key string) (bool,
 	})
 	if err != nil {
 		frontendRateLimitTakeErrors.Inc()
-		return false, err
+		return false, nil, err
+	}
+
+	return incr.Val() <= int64(r.max), newRateLimitStatus(r.max, incr.Val(), truncTS, r.dur), nil
+}
+
+const (
+	RedisFailureModeClosed = "closed"
+	RedisFailureModeOpen   = "open"
+	RedisFailureModeLocal  = "local"
+)
+
+// failSafeFrontendRateLimiter applies a failure mode when its Redis rate
+// limiter errors, e.g. while Redis is unavailable.
+type failSafeFrontendRateLimiter struct {
+	lim      FrontendRateLimiter
+	mode     string
+	fallback FrontendRateLimiter
+}
+
+// newFailSafeFrontendRateLimiter wraps lim, falling back to the in-memory
+// fallback limiter in the local failure mode.
+func newFailSafeFrontendRateLimiter(lim FrontendRateLimiter, mode string, fallback FrontendRateLimiter) FrontendRateLimiter {
+	f := &failSafeFrontendRateLimiter{lim: lim, mode: mode}
+	if mode == RedisFailureModeLocal {
+		f.fallback = fallback
 	}
+	return f
+}
+
+func (f *failSafeFrontendRateLimiter) Take(ctx context.Context, key string) (bool, error) {
+	ok, _, err := f.TakeStatus(ctx, key)
+	return ok, err
+}
+
+func (f *failSafeFrontendRateLimiter) TakeStatus(ctx context.Context, key string) (bool, *RateLimitStatus, error) {
+	ok, status, err := takeRateLimit(ctx, f.lim, key)
+	if err == nil {
+		return ok, status, nil
+	}
+	switch f.mode {
+	case RedisFailureModeOpen:
+		return true, nil, nil
+	case RedisFailureModeLocal:
+		return takeRateLimit(ctx, f.fallback, key)
+	default:
+		// callers reject requests when the limiter errors
+		return false, nil, err
+	}
+}
 
-	return incr.Val()-1 < int64(r.max), nil
+// dryRunFrontendRateLimiter never limits, but records the takes its limiter
+// would have rejected, so that limits can be evaluated on production traffic
+// before being enforced. It reports no status, so that clients don't get the
+// rate limit headers of limits which aren't enforced.
+type dryRunFrontendRateLimiter struct {
+	lim  FrontendRateLimiter
+	name string
+}
+
+// newDryRunFrontendRateLimiter wraps lim in a dry run limiter named name if
+// dryRun is set.
+func newDryRunFrontendRateLimiter(lim FrontendRateLimiter, name string, dryRun bool) FrontendRateLimiter {
+	if !dryRun {
+		return lim
+	}
+	return &dryRunFrontendRateLimiter{lim: lim, name: name}
+}
+
+func (d *dryRunFrontendRateLimiter) Take(ctx context.Context, key string) (bool, error) {
+	ok, err := d.lim.Take(ctx, key)
+	if err != nil {
+		log.Warn("error taking dry run rate limit", "limit", d.name, "err", err)
+		return true, nil
+	}
+	if !ok {
+		log.Info("dry run rate limit exceeded", "limit", d.name, "key", key, "req_id", GetReqID(ctx))
+		RecordRateLimitDryRunRejection(d.name)
+	}
+	return true, nil
 }
 
 type noopFrontendRateLimiter struct{}
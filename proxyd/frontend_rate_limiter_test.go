@@ -51,3 +51,120 @@ func TestFrontendRateLimiter(t *testing.T) {
 		})
 	}
 }
+
+func TestKeyNamespace(t *testing.T) {
+	redisServer, err := miniredis.Run()
+	require.NoError(t, err)
+	defer redisServer.Close()
+
+	redisClient := redis.NewClient(&redis.Options{
+		Addr: fmt.Sprintf("127.0.0.1:%s", redisServer.Port()),
+	})
+	ctx := context.Background()
+
+	mainnet := &Config{ChainID: 10}
+	goerli := &Config{ChainID: 420, KeyNamespace: "goerli"}
+	require.Equal(t, "10", mainnet.keyNamespace(""))
+	require.Equal(t, "goerli", goerli.keyNamespace(""))
+	require.Equal(t, "proxyd", goerli.keyNamespace("proxyd"))
+	require.Equal(t, "", (&Config{}).keyNamespace(""))
+
+	rateLimitConfig := RateLimitConfig{UseRedis: true}
+	mainnetLim := newLimiterFactory(rateLimitConfig, redisClient, mainnet.keyNamespace(""))(time.Minute, 1, "main")
+	goerliLim := newLimiterFactory(rateLimitConfig, redisClient, goerli.keyNamespace(""))(time.Minute, 1, "main")
+	for _, lim := range []FrontendRateLimiter{mainnetLim, goerliLim} {
+		ok, err := lim.Take(ctx, "foo")
+		require.NoError(t, err)
+		require.True(t, ok)
+	}
+	ok, err := mainnetLim.Take(ctx, "foo")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	mainnetCache := newRedisCache(redisClient, mainnet.keyNamespace(""), time.Minute)
+	goerliCache := newRedisCache(redisClient, goerli.keyNamespace(""), time.Minute)
+	require.NoError(t, mainnetCache.Put(ctx, "lvc:block_number", "0x10"))
+	require.NoError(t, goerliCache.Put(ctx, "lvc:block_number", "0x20"))
+	val, err := mainnetCache.Get(ctx, "lvc:block_number")
+	require.NoError(t, err)
+	require.Equal(t, "0x10", val)
+	require.True(t, redisServer.Exists("10:lvc:block_number"))
+	require.True(t, redisServer.Exists("goerli:lvc:block_number"))
+}
+
+func TestFailSafeFrontendRateLimiter(t *testing.T) {
+	redisServer, err := miniredis.Run()
+	require.NoError(t, err)
+	redisClient := redis.NewClient(&redis.Options{
+		Addr:       fmt.Sprintf("127.0.0.1:%s", redisServer.Port()),
+		MaxRetries: -1,
+	})
+	redisServer.Close()
+
+	max := 2
+	ctx := context.Background()
+	newLim := func(mode string) FrontendRateLimiter {
+		lim := NewRedisFrontendRateLimiter(redisClient, time.Minute, max, "")
+		return newFailSafeFrontendRateLimiter(lim, mode, NewMemoryFrontendRateLimit(time.Minute, max))
+	}
+
+	ok, err := newLim(RedisFailureModeClosed).Take(ctx, "foo")
+	require.Error(t, err)
+	require.False(t, ok)
+
+	open := newLim(RedisFailureModeOpen)
+	for i := 0; i < 4; i++ {
+		ok, err := open.Take(ctx, "foo")
+		require.NoError(t, err)
+		require.True(t, ok)
+	}
+
+	local := newLim(RedisFailureModeLocal)
+	for i := 0; i < 4; i++ {
+		ok, err := local.Take(ctx, "foo")
+		require.NoError(t, err)
+		require.Equal(t, i < max, ok)
+	}
+}
+
+func TestAuthKeyRateLimiter(t *testing.T) {
+	factory := func(dur time.Duration, max int, prefix string) FrontendRateLimiter {
+		return NewMemoryFrontendRateLimit(dur, max)
+	}
+	ctx := context.Background()
+
+	// the burst is taken within a second, but no more than the rate over the
+	// sustained window
+	lim := newAuthKeyRateLimiter("test", 1, 3, factory)
+	taken := 0
+	for i := 0; i < 20; i++ {
+		ok, err := lim.Take(ctx, "auth:test")
+		require.NoError(t, err)
+		if ok {
+			taken++
+		}
+	}
+	require.Equal(t, 3, taken)
+
+	_, ok := newAuthKeyRateLimiter("test", 2, 0, factory).(*authKeyRateLimiter)
+	require.False(t, ok)
+}
+
+func TestDryRunFrontendRateLimiter(t *testing.T) {
+	ctx := context.Background()
+	lim := NewMemoryFrontendRateLimit(time.Minute, 1)
+	require.Equal(t, lim, newDryRunFrontendRateLimiter(lim, "main", false))
+
+	dryRun := newDryRunFrontendRateLimiter(lim, "main", true)
+	for i := 0; i < 3; i++ {
+		ok, status, err := takeRateLimit(ctx, dryRun, "foo")
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Nil(t, status)
+	}
+
+	// the underlying limit is still taken
+	ok, err := lim.Take(ctx, "foo")
+	require.NoError(t, err)
+	require.False(t, ok)
+}
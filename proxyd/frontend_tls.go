@@ -0,0 +1,182 @@
+package proxyd
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+const (
+	defaultTLSReloadInterval = time.Minute
+	defaultACMECacheDir      = "acme-cache"
+)
+
+// NewFrontendTLSConfig returns the TLS config of the RPC and WS servers, or
+// nil if they serve plaintext. Certificates are either read from files or
+// secrets, and reloaded once renewed, or obtained from an ACME CA such as
+// Let's Encrypt.
+func NewFrontendTLSConfig(config ServerTLSConfig) (*tls.Config, error) {
+	tlsConfig, err := newFrontendTLSConfig(config)
+	if err != nil || tlsConfig == nil {
+		return nil, err
+	}
+	if err := configureClientAuth(tlsConfig, config.ClientAuth); err != nil {
+		return nil, err
+	}
+	return tlsConfig, nil
+}
+
+func newFrontendTLSConfig(config ServerTLSConfig) (*tls.Config, error) {
+	if config.ACME.Enabled {
+		if config.CertFile != "" || config.KeyFile != "" {
+			return nil, errors.New("server.tls.cert_file and key_file can't be set along with server.tls.acme")
+		}
+		return newACMETLSConfig(config.ACME)
+	}
+	if config.CertFile == "" && config.KeyFile == "" {
+		if config.ClientAuth.CAFile != "" {
+			return nil, errors.New("server.tls.client_auth requires a certificate")
+		}
+		return nil, nil
+	}
+	if config.CertFile == "" || config.KeyFile == "" {
+		return nil, errors.New("server.tls requires both cert_file and key_file")
+	}
+	if isSecretRef(config.CertFile) || isSecretRef(config.KeyFile) {
+		if !isSecretRef(config.CertFile) || !isSecretRef(config.KeyFile) {
+			return nil, errors.New("server.tls cert_file and key_file must both be files or both be secrets")
+		}
+		cert, err := newSecretCertificate(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		return &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: cert.getCertificate,
+		}, nil
+	}
+	interval := defaultTLSReloadInterval
+	if config.ReloadInterval != 0 {
+		interval = time.Duration(config.ReloadInterval)
+	}
+	reloader, err := newCertReloader(config.CertFile, config.KeyFile, interval)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.getCertificate,
+	}, nil
+}
+
+func newACMETLSConfig(config ACMEConfig) (*tls.Config, error) {
+	if len(config.Domains) == 0 {
+		return nil, errors.New("server.tls.acme requires domains")
+	}
+	cacheDir := config.CacheDir
+	if cacheDir == "" {
+		cacheDir = defaultACMECacheDir
+	}
+	m := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      autocert.DirCache(cacheDir),
+		HostPolicy: autocert.HostWhitelist(config.Domains...),
+		Email:      config.Email,
+	}
+	if config.DirectoryURL != "" {
+		m.Client = &acme.Client{DirectoryURL: config.DirectoryURL}
+	}
+	// certificates are validated with the tls-alpn-01 challenge, on the
+	// listeners themselves
+	tlsConfig := m.TLSConfig()
+	tlsConfig.MinVersion = tls.VersionTLS12
+	return tlsConfig, nil
+}
+
+// certReloader serves a certificate read from files, reloading it once the
+// files change, as they do when the certificate is renewed.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	interval time.Duration
+
+	mtx       sync.Mutex
+	cert      *tls.Certificate
+	modTime   time.Time
+	lastCheck time.Time
+}
+
+func newCertReloader(certFile, keyFile string, interval time.Duration) (*certReloader, error) {
+	r := &certReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		interval: interval,
+	}
+	modTime, err := r.filesModTime()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.load(modTime); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// filesModTime returns the time the files were last modified.
+func (r *certReloader) filesModTime() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("error reading TLS certificate: %w", err)
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+func (r *certReloader) load(modTime time.Time) error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("error loading TLS certificate: %w", err)
+	}
+	r.cert = &cert
+	r.modTime = modTime
+	return nil
+}
+
+// getCertificate returns the certificate, checking the files for changes at
+// most once per interval. A certificate failing to load is retried at the
+// next check, the current one being served meanwhile.
+func (r *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	now := time.Now()
+	if now.Sub(r.lastCheck) < r.interval {
+		return r.cert, nil
+	}
+	r.lastCheck = now
+	modTime, err := r.filesModTime()
+	if err != nil {
+		log.Error("error checking TLS certificate", "err", err)
+		return r.cert, nil
+	}
+	if modTime.Equal(r.modTime) {
+		return r.cert, nil
+	}
+	if err := r.load(modTime); err != nil {
+		log.Error("error reloading TLS certificate", "err", err)
+		return r.cert, nil
+	}
+	log.Info("reloaded TLS certificate", "cert_file", r.certFile)
+	return r.cert, nil
+}
@@ -0,0 +1,246 @@
+package proxyd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/oschwald/maxminddb-golang"
+)
+
+const (
+	ContextKeyGeoLocation = "geo_location"
+
+	GeoIPActionBlock     = "block"
+	GeoIPActionRateLimit = "rate_limit"
+
+	GeoIPDecisionBlocked     = "blocked"
+	GeoIPDecisionRateLimited = "rate_limited"
+	GeoIPDecisionAllowed     = "allowed"
+
+	// geoIPUnknownCountry labels the decisions on IPs without a country.
+	geoIPUnknownCountry = "unknown"
+)
+
+var ErrGeoBlocked = &RPCErr{
+	Code:          JSONRPCErrorInternal - 32,
+	Message:       "request not allowed from your location",
+	HTTPErrorCode: 403,
+}
+
+// GeoLocation is the location of a client IP. Its fields are empty if the
+// databases don't know the IP.
+type GeoLocation struct {
+	// Country is the ISO 3166-1 alpha-2 code of the country.
+	Country string
+	// ASN is the number of the autonomous system.
+	ASN uint64
+}
+
+// geoIPRule is a compiled GeoIPRuleConfig.
+type geoIPRule struct {
+	countries map[string]bool
+	asns      map[uint64]bool
+	methods   *methodPatterns
+	lim       FrontendRateLimiter
+}
+
+func (r *geoIPRule) matches(loc *GeoLocation, method string) bool {
+	if r.methods != nil && !r.methods.matches(method) {
+		return false
+	}
+	return (loc.Country != "" && r.countries[loc.Country]) || (loc.ASN != 0 && r.asns[loc.ASN])
+}
+
+// GeoIP blocks or rate limits the requests of clients by the country and
+// autonomous system of their IP, looked up in MaxMind DB files.
+type GeoIP struct {
+	countryDB *maxminddb.Reader
+	asnDB     *maxminddb.Reader
+	rules     []*geoIPRule
+	keyRules  map[string][]*geoIPRule
+	exempt    map[string]bool
+}
+
+// NewGeoIP returns the GeoIP policy of config, or nil if no database is
+// configured. The geoip_rules of auth keys replace the rules of config for
+// their requests.
+func NewGeoIP(config GeoIPConfig, authKeys map[string]*AuthKeyConfig, limiterFactory limiterFactoryFunc) (*GeoIP, error) {
+	if config.CountryDatabase == "" && config.ASNDatabase == "" {
+		if len(config.Rules) > 0 {
+			return nil, errors.New("geoip rules require a country or asn database")
+		}
+		for alias, cfg := range authKeys {
+			if cfg.GeoIPRules != nil {
+				return nil, fmt.Errorf("geoip_rules of auth key %s require a geoip database", alias)
+			}
+		}
+		return nil, nil
+	}
+
+	g := &GeoIP{
+		keyRules: make(map[string][]*geoIPRule),
+		exempt:   make(map[string]bool),
+	}
+	var err error
+	if config.CountryDatabase != "" {
+		if g.countryDB, err = maxminddb.Open(config.CountryDatabase); err != nil {
+			return nil, fmt.Errorf("error opening geoip country database: %w", err)
+		}
+	}
+	if config.ASNDatabase != "" {
+		if g.asnDB, err = maxminddb.Open(config.ASNDatabase); err != nil {
+			return nil, fmt.Errorf("error opening geoip asn database: %w", err)
+		}
+	}
+	if g.rules, err = newGeoIPRules(config.Rules, "geoip", limiterFactory); err != nil {
+		return nil, err
+	}
+	for alias, cfg := range authKeys {
+		if cfg.GeoIPExempt {
+			g.exempt[alias] = true
+		}
+		if cfg.GeoIPRules == nil {
+			continue
+		}
+		rules, err := newGeoIPRules(cfg.GeoIPRules, "geoip:"+alias, limiterFactory)
+		if err != nil {
+			return nil, fmt.Errorf("invalid geoip_rules of auth key %s: %w", alias, err)
+		}
+		g.keyRules[alias] = rules
+	}
+	return g, nil
+}
+
+func newGeoIPRules(configs []GeoIPRuleConfig, prefix string, limiterFactory limiterFactoryFunc) ([]*geoIPRule, error) {
+	rules := make([]*geoIPRule, 0, len(configs))
+	for i, cfg := range configs {
+		if len(cfg.Countries) == 0 && len(cfg.ASNs) == 0 {
+			return nil, fmt.Errorf("geoip rule %d matches no country or asn", i)
+		}
+		rule := &geoIPRule{
+			countries: make(map[string]bool, len(cfg.Countries)),
+			asns:      make(map[uint64]bool, len(cfg.ASNs)),
+		}
+		for _, country := range cfg.Countries {
+			rule.countries[strings.ToUpper(country)] = true
+		}
+		for _, asn := range cfg.ASNs {
+			rule.asns[asn] = true
+		}
+		if len(cfg.Methods) > 0 {
+			rule.methods = newMethodPatterns(cfg.Methods)
+		}
+		switch cfg.Action {
+		case GeoIPActionBlock:
+		case GeoIPActionRateLimit:
+			if cfg.RateLimit <= 0 {
+				return nil, fmt.Errorf("geoip rule %d requires a positive rate_limit", i)
+			}
+			rule.lim = limiterFactory(time.Second, cfg.RateLimit, fmt.Sprintf("%s:%d", prefix, i))
+		default:
+			return nil, fmt.Errorf("invalid action %q of geoip rule %d", cfg.Action, i)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// geoIPCountryRecord is the subset of the records of the GeoIP2 or GeoLite2
+// Country or City databases needed to locate clients.
+type geoIPCountryRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	RegisteredCountry struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"registered_country"`
+}
+
+// geoIPASNRecord is the subset of the records of the GeoIP2 or GeoLite2 ASN
+// databases needed to locate clients.
+type geoIPASNRecord struct {
+	ASN uint64 `maxminddb:"autonomous_system_number"`
+}
+
+// Locate returns the location of ip. The country falls back to the country
+// the network is registered in.
+func (g *GeoIP) Locate(ip net.IP) *GeoLocation {
+	loc := &GeoLocation{}
+	if g.countryDB != nil {
+		var record geoIPCountryRecord
+		if err := geoIPLookup(g.countryDB, ip, &record); err != nil {
+			log.Warn("error looking up geoip country", "ip", ip, "err", err)
+		}
+		loc.Country = record.Country.ISOCode
+		if loc.Country == "" {
+			loc.Country = record.RegisteredCountry.ISOCode
+		}
+	}
+	if g.asnDB != nil {
+		var record geoIPASNRecord
+		if err := geoIPLookup(g.asnDB, ip, &record); err != nil {
+			log.Warn("error looking up geoip asn", "ip", ip, "err", err)
+		}
+		loc.ASN = record.ASN
+	}
+	return loc
+}
+
+// geoIPLookup decodes the record of ip in db into record, leaving it empty if
+// db has none.
+func geoIPLookup(db *maxminddb.Reader, ip net.IP, record interface{}) error {
+	// IPv4 databases have no records of IPv6 clients
+	if db.Metadata.IPVersion == 4 && ip.To4() == nil {
+		return nil
+	}
+	return db.Lookup(ip, record)
+}
+
+// check applies the first rule matching the location of the client of ctx
+// and method, if any.
+func (g *GeoIP) check(ctx context.Context, method string) error {
+	loc, _ := ctx.Value(ContextKeyGeoLocation).(*GeoLocation)
+	if loc == nil {
+		return nil
+	}
+	auth := GetAuthCtx(ctx)
+	if g.exempt[auth] {
+		return nil
+	}
+	rules := g.rules
+	if keyRules, ok := g.keyRules[auth]; ok {
+		rules = keyRules
+	}
+	country := loc.Country
+	if country == "" {
+		country = geoIPUnknownCountry
+	}
+	for _, rule := range rules {
+		if !rule.matches(loc, method) {
+			continue
+		}
+		if rule.lim == nil {
+			log.Info("blocked request by geoip rule", "country", country, "asn", loc.ASN, "auth", auth, "method", method, "req_id", GetReqID(ctx))
+			RecordGeoIPDecision(GeoIPDecisionBlocked, country, auth)
+			return ErrGeoBlocked
+		}
+		ok, err := rule.lim.Take(ctx, GetXForwardedFor(ctx))
+		if err != nil {
+			log.Error("error taking from geoip limiter", "err", err, "req_id", GetReqID(ctx))
+			return ErrInternal
+		}
+		if !ok {
+			log.Debug("geoip rate limit exceeded", "country", country, "asn", loc.ASN, "auth", auth, "req_id", GetReqID(ctx))
+			RecordGeoIPDecision(GeoIPDecisionRateLimited, country, auth)
+			return ErrOverRateLimit
+		}
+		RecordGeoIPDecision(GeoIPDecisionAllowed, country, auth)
+		return nil
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+package proxyd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	GetLogsLimitBlockRange = "block_range"
+	GetLogsLimitAddresses  = "addresses"
+	GetLogsLimitTopics     = "topics"
+	GetLogsLimitLogs       = "logs"
+
+	defaultGetLogsMaxSplits        = 10
+	defaultGetLogsSplitConcurrency = 4
+)
+
+func ErrTooManyLogs(max int) *RPCErr {
+	return &RPCErr{
+		Code:          JSONRPCErrorInternal - 29,
+		Message:       fmt.Sprintf("query returned more than %d logs, narrow your query: %s", max, responseTooLargeGuidance["eth_getLogs"]),
+		HTTPErrorCode: 400,
+	}
+}
+
+// getLogsLimits are the limits of the eth_getLogs requests of an auth key, or
+// of all requests. Zero limits are disabled.
+type getLogsLimits struct {
+	maxBlockRange uint64
+	maxAddresses  int
+	maxTopics     int
+	maxLogs       int
+}
+
+// override returns the limits with the limits set in cfg replaced.
+func (l getLogsLimits) override(cfg *GetLogsLimitsConfig) *getLogsLimits {
+	if cfg.MaxBlockRange > 0 {
+		l.maxBlockRange = cfg.MaxBlockRange
+	}
+	if cfg.MaxAddresses > 0 {
+		l.maxAddresses = cfg.MaxAddresses
+	}
+	if cfg.MaxTopics > 0 {
+		l.maxTopics = cfg.MaxTopics
+	}
+	if cfg.MaxLogs > 0 {
+		l.maxLogs = cfg.MaxLogs
+	}
+	return &l
+}
+
+// GetLogsLimiter bounds the eth_getLogs requests forwarded to backends and the
+// logs returned to clients, so that a single unbounded query can't take a
+// backend down. Auth keys may override the limits. Ranges over the limit are
+// optionally split into sub-ranges rather than rejected.
+type GetLogsLimiter struct {
+	limits           *getLogsLimits
+	keyLimits        map[string]*getLogsLimits
+	splitRanges      bool
+	maxSplits        int
+	splitConcurrency int
+}
+
+// NewGetLogsLimiter returns a limiter for config and the limit overrides of
+// authKeys, or nil if no limits are configured.
+func NewGetLogsLimiter(config GetLogsLimitsConfig, authKeys map[string]*AuthKeyConfig) *GetLogsLimiter {
+	limits := (getLogsLimits{}).override(&config)
+	keyLimits := make(map[string]*getLogsLimits)
+	for alias, cfg := range authKeys {
+		if cfg.GetLogsLimits != nil {
+			keyLimits[alias] = limits.override(cfg.GetLogsLimits)
+		}
+	}
+	if *limits == (getLogsLimits{}) && len(keyLimits) == 0 {
+		return nil
+	}
+	maxSplits := defaultGetLogsMaxSplits
+	if config.MaxSplits > 0 {
+		maxSplits = config.MaxSplits
+	}
+	splitConcurrency := defaultGetLogsSplitConcurrency
+	if config.SplitConcurrency > 0 {
+		splitConcurrency = config.SplitConcurrency
+	}
+	return &GetLogsLimiter{
+		limits:           limits,
+		keyLimits:        keyLimits,
+		splitRanges:      config.SplitRanges,
+		maxSplits:        maxSplits,
+		splitConcurrency: splitConcurrency,
+	}
+}
+
+func (l *GetLogsLimiter) limitsOf(ctx context.Context) *getLogsLimits {
+	if alias, ok := ctx.Value(ContextKeyAuth).(string); ok {
+		if limits := l.keyLimits[alias]; limits != nil {
+			return limits
+		}
+	}
+	return l.limits
+}
+
+// Check returns an error if the filter of an eth_getLogs request exceeds the
+// limits. Block tags are resolved with getLatest, the span of ranges ending
+// at a block tag isn't checked if the latest block is unknown. Malformed
+// filters are left to the backends to reject.
+func (l *GetLogsLimiter) Check(ctx context.Context, req *RPCReq, getLatest func() (uint64, bool)) (string, *RPCErr) {
+	limits := l.limitsOf(ctx)
+	var p []logsFilter
+	if err := json.Unmarshal(req.Params, &p); err != nil || len(p) != 1 {
+		return "", nil
+	}
+	f := p[0]
+
+	if limits.maxAddresses > 0 {
+		if addresses, ok := normalizeHexList(f.Address); ok && len(addresses) > limits.maxAddresses {
+			return GetLogsLimitAddresses, ErrInvalidParams(fmt.Sprintf("filter has %d addresses, maximum %d", len(addresses), limits.maxAddresses))
+		}
+	}
+	if limits.maxTopics > 0 {
+		var topics int
+		for _, position := range f.Topics {
+			if alternatives, ok := normalizeHexList(position); ok {
+				topics += len(alternatives)
+			}
+		}
+		if topics > limits.maxTopics {
+			return GetLogsLimitTopics, ErrInvalidParams(fmt.Sprintf("filter has %d topics, maximum %d", topics, limits.maxTopics))
+		}
+	}
+	if limits.maxBlockRange > 0 && f.BlockHash == nil {
+		from, fromOK := resolveLogsBlock(f.FromBlock, getLatest)
+		to, toOK := resolveLogsBlock(f.ToBlock, getLatest)
+		if fromOK && toOK && to > from && to-from > limits.maxBlockRange {
+			return GetLogsLimitBlockRange, ErrInvalidParams(fmt.Sprintf("block range of %d blocks, maximum %d", to-from, limits.maxBlockRange))
+		}
+	}
+	return "", nil
+}
+
+// Split returns the requests of the sub-ranges of an eth_getLogs request whose
+// range is over the limit, if ranges are split and it has at most as many
+// sub-ranges as allowed. Sub-ranges are aligned to multiples of the limit, so
+// that they are shared by the requests of overlapping ranges.
+func (l *GetLogsLimiter) Split(ctx context.Context, req *RPCReq, getLatest func() (uint64, bool)) ([]*RPCReq, bool) {
+	limits := l.limitsOf(ctx)
+	if !l.splitRanges || limits.maxBlockRange == 0 {
+		return nil, false
+	}
+	var p []map[string]json.RawMessage
+	var f []logsFilter
+	if err := json.Unmarshal(req.Params, &p); err != nil || len(p) != 1 {
+		return nil, false
+	}
+	if err := json.Unmarshal(req.Params, &f); err != nil || f[0].BlockHash != nil {
+		return nil, false
+	}
+	// the other tags resolve to an upper bound of their number only
+	for _, block := range []*rpc.BlockNumber{f[0].FromBlock, f[0].ToBlock} {
+		if block != nil && *block < 0 && *block != rpc.LatestBlockNumber && *block != rpc.EarliestBlockNumber {
+			return nil, false
+		}
+	}
+	from, fromOK := resolveLogsBlock(f[0].FromBlock, getLatest)
+	to, toOK := resolveLogsBlock(f[0].ToBlock, getLatest)
+	if !fromOK || !toOK || to < from {
+		return nil, false
+	}
+
+	size := limits.maxBlockRange
+	if (to/size)-(from/size) >= uint64(l.maxSplits) {
+		return nil, false
+	}
+	var reqs []*RPCReq
+	for start := from; start <= to; {
+		end := (start/size+1)*size - 1
+		if end > to {
+			end = to
+		}
+		filter := make(map[string]json.RawMessage, len(p[0]))
+		for k, v := range p[0] {
+			filter[k] = v
+		}
+		filter["fromBlock"] = mustMarshalJSON(hexutil.EncodeUint64(start))
+		filter["toBlock"] = mustMarshalJSON(hexutil.EncodeUint64(end))
+		reqs = append(reqs, &RPCReq{
+			JSONRPC: req.JSONRPC,
+			Method:  req.Method,
+			Params:  mustMarshalJSON([]map[string]json.RawMessage{filter}),
+			ID:      req.ID,
+		})
+		start = end + 1
+	}
+	return reqs, true
+}
+
+// SplitConcurrency returns the number of sub-ranges of a request forwarded at
+// once.
+func (l *GetLogsLimiter) SplitConcurrency() int {
+	return l.splitConcurrency
+}
+
+// CheckResult returns an error if the result of an eth_getLogs request has
+// more logs than allowed.
+func (l *GetLogsLimiter) CheckResult(ctx context.Context, res *RPCRes) *RPCErr {
+	limits := l.limitsOf(ctx)
+	if limits.maxLogs == 0 || res.Error != nil {
+		return nil
+	}
+	if logs, ok := res.Result.([]interface{}); ok && len(logs) > limits.maxLogs {
+		return ErrTooManyLogs(limits.maxLogs)
+	}
+	return nil
+}
+
+// resolveLogsBlock returns the number of a block of a filter. Missing blocks
+// default to the latest block, as do the other tags but earliest, which is
+// an upper bound of their number.
+func resolveLogsBlock(block *rpc.BlockNumber, getLatest func() (uint64, bool)) (uint64, bool) {
+	if block != nil && *block == rpc.EarliestBlockNumber {
+		return 0, true
+	}
+	if block != nil && *block >= 0 {
+		return uint64(*block), true
+	}
+	return getLatest()
+}
@@ -0,0 +1,85 @@
+package proxyd
+
+import (
+	"math"
+	"time"
+)
+
+// HealthWeights weigh the signals of the health score of a backend.
+type HealthWeights struct {
+	Latency   float64
+	ErrorRate float64
+	BlockLag  float64
+}
+
+var defaultHealthWeights = HealthWeights{Latency: 1, ErrorRate: 1, BlockLag: 1}
+
+// HealthScore is the health of a backend. Each signal is a penalty from 0 to
+// 1, its value relative to the threshold at which the backend is unhealthy.
+// Score is 1 minus the weighted average of the penalties.
+type HealthScore struct {
+	Score     float64 `json:"score"`
+	Latency   float64 `json:"latency"`
+	ErrorRate float64 `json:"error_rate"`
+	BlockLag  float64 `json:"block_lag"`
+}
+
+// HealthScore computes the health score of the backend from its average
+// latency, error rate and, for consensus aware groups, block lag.
+func (b *Backend) HealthScore() HealthScore {
+	hs := HealthScore{
+		Latency:   healthPenalty(float64(b.latencySlidingWindow.Avg()), float64(b.maxLatencyThreshold)),
+		ErrorRate: healthPenalty(b.ErrorRate(), b.maxErrorRateThreshold),
+		BlockLag:  healthPenalty(float64(b.blockLag.Load()), float64(b.maxBlockLag.Load()+1)),
+	}
+
+	w := b.healthWeights
+	total := w.Latency + w.ErrorRate + w.BlockLag
+	hs.Score = 1
+	if total > 0 {
+		hs.Score -= (w.Latency*hs.Latency + w.ErrorRate*hs.ErrorRate + w.BlockLag*hs.BlockLag) / total
+	}
+	return hs
+}
+
+// Healthy reports whether neither latency nor error rate reached their
+// threshold, and the score is at least minScore. Block lag only lowers the
+// score: lagging backends are left out of the consensus group rather than
+// banned.
+func (hs HealthScore) Healthy(minScore float64) bool {
+	return hs.Latency < 1 && hs.ErrorRate < 1 && hs.Score >= minScore
+}
+
+// setBlockLag records how many blocks the backend is behind the highest block
+// of its consensus group, out of the max lag tolerated.
+func (b *Backend) setBlockLag(lag uint64, maxLag uint64) {
+	b.blockLag.Store(lag)
+	b.maxBlockLag.Store(maxLag)
+}
+
+func healthPenalty(value float64, threshold float64) float64 {
+	if threshold <= 0 {
+		return 0
+	}
+	return math.Min(value/threshold, 1)
+}
+
+func WithHealthWeights(weights HealthWeights) BackendOpt {
+	return func(b *Backend) {
+		b.healthWeights = weights
+	}
+}
+
+// WithMinHealthScore makes the backend unhealthy under minScore, and
+// degraded under degradedScore.
+func WithMinHealthScore(minScore float64, degradedScore float64) BackendOpt {
+	return func(b *Backend) {
+		b.minHealthScore = minScore
+		b.degradedHealthScore = degradedScore
+	}
+}
+
+func (b *Backend) isDegraded(hs HealthScore) bool {
+	avgLatency := time.Duration(b.latencySlidingWindow.Avg())
+	return avgLatency >= b.maxDegradedLatencyThreshold || hs.Score < b.degradedHealthScore
+}
@@ -0,0 +1,35 @@
+package proxyd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthScore(t *testing.T) {
+	be := NewBackend("a", "", "", nil, WithProxydIP("127.0.0.1"), WithMaxLatencyThreshold(time.Second))
+	hs := be.HealthScore()
+	require.Equal(t, 1.0, hs.Score)
+	require.True(t, be.IsHealthy())
+
+	be.latencySlidingWindow.Add(float64(600 * time.Millisecond))
+	be.setBlockLag(4, 7)
+	hs = be.HealthScore()
+	require.InDelta(t, 0.6, hs.Latency, 1e-9)
+	require.InDelta(t, 0.5, hs.BlockLag, 1e-9)
+	require.InDelta(t, 1-(0.6+0.5)/3, hs.Score, 1e-9)
+	require.True(t, be.IsHealthy())
+	require.False(t, be.IsDegraded())
+
+	be.Override(WithMinHealthScore(0.7, 0.8))
+	require.False(t, be.IsHealthy())
+	require.True(t, be.IsDegraded())
+
+	be.Override(WithMinHealthScore(0, 0), WithHealthWeights(HealthWeights{ErrorRate: 1}))
+	require.Equal(t, 1.0, be.HealthScore().Score)
+
+	// reaching a threshold makes the backend unhealthy regardless of weights
+	be.latencySlidingWindow.Add(float64(2 * time.Second))
+	require.False(t, be.IsHealthy())
+}
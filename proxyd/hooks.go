@@ -0,0 +1,146 @@
+package proxyd
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// RequestHook intercepts the JSON-RPC requests of HTTP clients once they are
+// parsed, before they are routed. Hooks may modify req. A non-nil response is
+// returned to the client in place of forwarding req, e.g. an error response
+// rejecting it.
+type RequestHook func(ctx context.Context, req *RPCReq) *RPCRes
+
+// ResponseHook intercepts the response to a request of an HTTP client before
+// it is returned, whether it was forwarded, cached or answered by proxyd. It
+// returns the response to return in its place, res itself if unchanged.
+// Responses may be shared with other requests, so they must be copied rather
+// than modified.
+type ResponseHook func(ctx context.Context, req *RPCReq, res *RPCRes) *RPCRes
+
+// HTTPMiddleware wraps the handlers of the RPC and WS servers, e.g. for custom
+// authentication of clients.
+type HTTPMiddleware func(http.Handler) http.Handler
+
+// MethodHandlerFunc serves the requests of a method registered with
+// RegisterMethod. A *RPCErr error is returned to the client as is, other
+// errors are logged and returned as internal errors.
+type MethodHandlerFunc func(ctx context.Context, req *RPCReq) (interface{}, error)
+
+// StartOption extends the server started by Start, so that embedders can add
+// their own logic without forking proxyd.
+type StartOption func(*Server)
+
+// WithRequestHook adds hook to the request hooks of the server. Hooks run in
+// the order they are added, until one returns a response.
+func WithRequestHook(hook RequestHook) StartOption {
+	return func(s *Server) {
+		s.RegisterRequestHook(hook)
+	}
+}
+
+// WithResponseHook adds hook to the response hooks of the server. Hooks run in
+// the order they are added.
+func WithResponseHook(hook ResponseHook) StartOption {
+	return func(s *Server) {
+		s.RegisterResponseHook(hook)
+	}
+}
+
+// WithHTTPMiddleware adds mw to the HTTP middlewares of the server. The first
+// middleware added handles requests first.
+func WithHTTPMiddleware(mw HTTPMiddleware) StartOption {
+	return func(s *Server) {
+		s.RegisterHTTPMiddleware(mw)
+	}
+}
+
+// WithMethod registers handler as the handler of the requests of method.
+func WithMethod(method string, handler MethodHandlerFunc) StartOption {
+	return func(s *Server) {
+		s.RegisterMethod(method, handler)
+	}
+}
+
+// RegisterRequestHook adds hook to the request hooks of the server. Hooks must
+// be registered before the server serves requests.
+func (s *Server) RegisterRequestHook(hook RequestHook) {
+	s.requestHooks = append(s.requestHooks, hook)
+}
+
+// RegisterResponseHook adds hook to the response hooks of the server. Hooks
+// must be registered before the server serves requests.
+func (s *Server) RegisterResponseHook(hook ResponseHook) {
+	s.responseHooks = append(s.responseHooks, hook)
+}
+
+// RegisterHTTPMiddleware adds mw to the HTTP middlewares of the server.
+// Middlewares must be registered before the servers are started.
+func (s *Server) RegisterHTTPMiddleware(mw HTTPMiddleware) {
+	s.httpMiddlewares = append(s.httpMiddlewares, mw)
+}
+
+// RegisterMethod serves the requests of method with handler rather than
+// forwarding them, e.g. for bespoke health or aggregation methods. The requests
+// are authenticated, rate limited, logged and counted like those of other
+// methods, without having to be mapped to a backend group. Methods must be
+// registered before the server serves requests.
+func (s *Server) RegisterMethod(method string, handler MethodHandlerFunc) {
+	if s.methodHandlers == nil {
+		s.methodHandlers = make(map[string]MethodHandlerFunc)
+	}
+	s.methodHandlers[method] = handler
+}
+
+// serveMethod returns the response of handler to req.
+func (s *Server) serveMethod(ctx context.Context, handler MethodHandlerFunc, req *RPCReq) *RPCRes {
+	RecordRPCForward(ctx, BackendProxyd, req.Method, RPCRequestSourceHTTP)
+	result, err := handler(ctx, req)
+	if err != nil {
+		var rpcErr *RPCErr
+		if !errors.As(err, &rpcErr) {
+			log.Error("error serving registered method", "method", req.Method, "err", err, "req_id", GetReqID(ctx))
+			rpcErr = ErrInternal
+		}
+		RecordRPCError(ctx, BackendProxyd, req.Method, rpcErr)
+		return NewRPCErrorRes(req.ID, rpcErr)
+	}
+	return NewRPCRes(req.ID, result)
+}
+
+func (s *Server) runRequestHooks(ctx context.Context, req *RPCReq) *RPCRes {
+	for _, hook := range s.requestHooks {
+		if res := hook(ctx, req); res != nil {
+			return res
+		}
+	}
+	return nil
+}
+
+// runResponseHooks runs the response hooks on the responses of reqs. Requests
+// which couldn't be parsed are skipped.
+func (s *Server) runResponseHooks(ctx context.Context, reqs []*RPCReq, responses []*RPCRes) {
+	if len(s.responseHooks) == 0 {
+		return
+	}
+	for i, req := range reqs {
+		if req == nil || responses[i] == nil {
+			continue
+		}
+		for _, hook := range s.responseHooks {
+			responses[i] = hook(ctx, req, responses[i])
+		}
+	}
+}
+
+// withHTTPMiddlewares wraps h with the HTTP middlewares, the first registered
+// being the outermost.
+func (s *Server) withHTTPMiddlewares(h http.Handler) http.Handler {
+	for i := len(s.httpMiddlewares) - 1; i >= 0; i-- {
+		h = s.httpMiddlewares[i](h)
+	}
+	return h
+}
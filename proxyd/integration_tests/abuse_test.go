@@ -0,0 +1,146 @@
+package integration_tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAbuse(t *testing.T) {
+	goodBackend := NewMockBackend(BatchedResponseHandler(200, goodResponse))
+	defer goodBackend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+
+	config := ReadConfig("abuse")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	clientFrom := func(ip string, secret string) *ProxydHTTPClient {
+		h := make(http.Header)
+		h.Set("X-Forwarded-For", ip)
+		return NewProxydClientWithHeaders("http://127.0.0.1:8545/"+secret, h)
+	}
+	requireCode := func(t *testing.T, client *ProxydHTTPClient, code int) {
+		res, actual, err := client.SendRPC("eth_chainId", nil)
+		require.NoError(t, err)
+		require.Equal(t, code, actual)
+		if code == 403 {
+			var out proxyd.RPCRes
+			require.NoError(t, json.Unmarshal(res, &out))
+			require.Equal(t, proxyd.ErrClientBanned.Code, out.Error.Code)
+		}
+	}
+	adminReq := func(t *testing.T, method string, path string, body string) (int, []byte) {
+		req, err := http.NewRequest(method, "http://127.0.0.1:8547"+path, bytes.NewReader([]byte(body)))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer admin-token")
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		out, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res.StatusCode, out
+	}
+
+	t.Run("malformed requests ban the ip and the key", func(t *testing.T) {
+		client := clientFrom("10.0.0.1", "a_secret")
+		requireCode(t, client, 200)
+		for i := 0; i < 3; i++ {
+			_, _, err := client.SendRequest([]byte(`{"jsonrpc":"2.0","id":1}`))
+			require.NoError(t, err)
+		}
+		requireCode(t, client, 403)
+		requireCode(t, clientFrom("10.0.0.1", "b_secret"), 403)
+		requireCode(t, clientFrom("10.0.0.9", "a_secret"), 403)
+	})
+
+	t.Run("method scans ban the ip", func(t *testing.T) {
+		client := clientFrom("10.0.0.2", "internal_secret")
+		for _, method := range []string{"eth_chainId", "eth_blockNumber", "eth_gasPrice", "net_version"} {
+			_, code, err := client.SendRPC(method, nil)
+			require.NoError(t, err)
+			require.Equal(t, 200, code)
+		}
+		requireCode(t, client, 403)
+		// the key is exempt
+		requireCode(t, clientFrom("10.0.0.3", "internal_secret"), 200)
+	})
+
+	t.Run("errors ban the ip", func(t *testing.T) {
+		client := clientFrom("10.0.0.4", "internal_secret")
+		for i := 0; i < 4; i++ {
+			_, code, err := client.SendRPC("eth_unknown", nil)
+			require.NoError(t, err)
+			require.Equal(t, 403, code)
+		}
+		requireCode(t, client, 403)
+	})
+
+	t.Run("admins list and lift bans", func(t *testing.T) {
+		code, body := adminReq(t, "GET", "/abuse/bans", "")
+		require.Equal(t, 200, code)
+		var bans []*proxyd.AbuseBan
+		require.NoError(t, json.Unmarshal(body, &bans))
+		reasons := make(map[string]string)
+		for _, ban := range bans {
+			require.Equal(t, proxyd.AbuseActionBan, ban.Action)
+			reasons[ban.Client] = ban.Reason
+		}
+		require.Equal(t, map[string]string{
+			"ip:10.0.0.1": proxyd.AbuseReasonMalformed,
+			"key:a":       proxyd.AbuseReasonMalformed,
+			"ip:10.0.0.2": proxyd.AbuseReasonMethods,
+			"ip:10.0.0.4": proxyd.AbuseReasonErrors,
+		}, reasons)
+
+		code, _ = adminReq(t, "DELETE", "/abuse/bans/key:a", "")
+		require.Equal(t, 204, code)
+		requireCode(t, clientFrom("10.0.0.9", "a_secret"), 200)
+		code, _ = adminReq(t, "DELETE", "/abuse/bans/key:a", "")
+		require.Equal(t, 404, code)
+	})
+
+	t.Run("admins ban clients", func(t *testing.T) {
+		code, _ := adminReq(t, "POST", "/abuse/bans", `{"client": "key:b", "duration": "1m"}`)
+		require.Equal(t, 200, code)
+		requireCode(t, clientFrom("10.0.0.10", "b_secret"), 403)
+
+		code, _ = adminReq(t, "POST", "/abuse/bans", `{"client": "ip:10.0.0.11", "action": "rate_limit", "duration": "1m"}`)
+		require.Equal(t, 200, code)
+		codes := make(map[int]int)
+		for i := 0; i < 3; i++ {
+			_, code, err := clientFrom("10.0.0.11", "internal_secret").SendRPC("eth_chainId", nil)
+			require.NoError(t, err)
+			codes[code]++
+		}
+		require.NotZero(t, codes[429])
+
+		code, _ = adminReq(t, "POST", "/abuse/bans", `{"client": "10.0.0.12", "duration": "1m"}`)
+		require.Equal(t, 400, code)
+	})
+
+	t.Run("exempt CIDRs", func(t *testing.T) {
+		malformed := func(client *ProxydHTTPClient) {
+			for i := 0; i < 4; i++ {
+				_, _, err := client.SendRequest([]byte(`{"jsonrpc":"2.0","id":1}`))
+				require.NoError(t, err)
+			}
+		}
+		exempt := clientFrom("192.168.1.1", "internal_secret")
+		malformed(exempt)
+		requireCode(t, exempt, 200)
+
+		// an exempt IP prepended to the header doesn't exempt the client
+		forged := clientFrom("192.168.1.1, 10.0.0.13", "internal_secret")
+		malformed(forged)
+		requireCode(t, forged, 403)
+	})
+}
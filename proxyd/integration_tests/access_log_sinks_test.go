@@ -0,0 +1,117 @@
+package integration_tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+)
+
+func TestAccessLogSinks(t *testing.T) {
+	goodBackend := NewMockBackend(BatchedResponseHandler(200, goodResponse))
+	defer goodBackend.Close()
+	kafka, err := kfake.NewCluster(
+		kfake.SeedTopics(2, "proxyd-requests"),
+		kfake.EnableSASL(),
+		kfake.Superuser("SCRAM-SHA-256", "proxyd", "kafka-password"),
+	)
+	require.NoError(t, err)
+	defer kafka.Close()
+
+	var mtx sync.Mutex
+	var posts int
+	var posted []string
+	bulk := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "Bearer billing-token", r.Header.Get("Authorization"))
+		require.Equal(t, "application/x-ndjson", r.Header.Get("Content-Type"))
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		mtx.Lock()
+		defer mtx.Unlock()
+		// the first batch is retried
+		if posts++; posts == 1 {
+			w.WriteHeader(503)
+			return
+		}
+		posted = append(posted, strings.Split(strings.TrimSuffix(string(body), "\n"), "\n")...)
+	}))
+	defer bulk.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+
+	// the existing file exceeds the max size, and is rotated on the first write
+	file := filepath.Join(t.TempDir(), "access.log")
+	require.NoError(t, os.WriteFile(file, bytes.Repeat([]byte("x"), 1<<20), 0o644))
+
+	config := ReadConfig("access_log_sinks")
+	config.AccessLog.Sinks[0].Brokers = kafka.ListenAddrs()
+	config.AccessLog.Sinks[1].Path = file
+	config.AccessLog.Sinks[2].URL = bulk.URL
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+
+	client := NewProxydClient("http://127.0.0.1:8545")
+	for i := 0; i < 3; i++ {
+		_, code, err := client.SendRPC("eth_chainId", nil)
+		require.NoError(t, err)
+		require.Equal(t, 200, code)
+	}
+
+	// the buffered lines are written on shutdown
+	shutdown()
+
+	requireLines := func(lines []string) {
+		require.Len(t, lines, 3)
+		for _, line := range lines {
+			var fields map[string]interface{}
+			require.NoError(t, json.Unmarshal([]byte(line), &fields))
+			require.Equal(t, "eth_chainId", fields["method"])
+			require.Equal(t, float64(200), fields["status"])
+		}
+	}
+
+	consumer, err := kgo.NewClient(
+		kgo.SeedBrokers(kafka.ListenAddrs()...),
+		kgo.ConsumeTopics("proxyd-requests"),
+		kgo.SASL(scram.Auth{User: "proxyd", Pass: "kafka-password"}.AsSha256Mechanism()),
+	)
+	require.NoError(t, err)
+	defer consumer.Close()
+	var produced []string
+	for len(produced) < 3 {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		fetches := consumer.PollFetches(ctx)
+		cancel()
+		require.NoError(t, fetches.Err())
+		fetches.EachRecord(func(r *kgo.Record) {
+			produced = append(produced, string(r.Value))
+		})
+	}
+	requireLines(produced)
+
+	b, err := os.ReadFile(file)
+	require.NoError(t, err)
+	requireLines(strings.Split(strings.TrimSuffix(string(b), "\n"), "\n"))
+	backup, err := os.Stat(file + ".1")
+	require.NoError(t, err)
+	require.Equal(t, int64(1<<20), backup.Size())
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	require.Equal(t, 3, posts)
+	requireLines(posted)
+}
@@ -0,0 +1,87 @@
+package integration_tests
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessLog(t *testing.T) {
+	goodBackend := NewMockBackend(BatchedResponseHandler(200, goodResponse))
+	defer goodBackend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+
+	file := filepath.Join(t.TempDir(), "access.log")
+	config := ReadConfig("access_log")
+	config.AccessLog.File = file
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	h := make(http.Header)
+	h.Set("X-Forwarded-For", "203.0.113.7")
+	h.Set("User-Agent", "test-agent")
+	client := NewProxydClientWithHeaders("http://127.0.0.1:8545/client_secret", h)
+
+	_, code, err := client.SendRPC("eth_chainId", nil)
+	require.NoError(t, err)
+	require.Equal(t, 200, code)
+	_, code, err = client.SendRPC("eth_chainId", nil)
+	require.NoError(t, err)
+	require.Equal(t, 200, code)
+	_, code, err = client.SendBatchRPC(
+		NewRPCReq("1", "eth_chainId", nil),
+		NewRPCReq("2", "net_version", nil),
+	)
+	require.NoError(t, err)
+	require.Equal(t, 200, code)
+	_, _, err = client.SendRPC("eth_unknown", nil)
+	require.NoError(t, err)
+	_, code, err = NewProxydClientWithHeaders("http://127.0.0.1:8545/wrong_secret", h).SendRPC("eth_chainId", nil)
+	require.NoError(t, err)
+	require.Equal(t, 401, code)
+
+	f, err := os.Open(file)
+	require.NoError(t, err)
+	defer f.Close()
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var line map[string]interface{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+		require.NotEmpty(t, line["time"])
+		require.Contains(t, line, "latency_ms")
+		require.Regexp(t, "^redacted:[0-9a-f]{12}$", line["user_agent"])
+		require.Equal(t, "203.0.113.7", line["client_ip"])
+		delete(line, "time")
+		delete(line, "latency_ms")
+		delete(line, "req_id")
+		delete(line, "user_agent")
+		delete(line, "client_ip")
+		lines = append(lines, line)
+	}
+	require.NoError(t, scanner.Err())
+
+	require.Equal(t, []map[string]interface{}{
+		{"method": "eth_chainId", "auth": "client", "backend": "main/good", "cache": "miss", "status": float64(200)},
+		{"method": "eth_chainId", "auth": "client", "cache": "hit", "status": float64(200)},
+		{
+			"method":     "batch",
+			"methods":    []interface{}{"eth_chainId", "net_version"},
+			"batch_size": float64(2),
+			"auth":       "client",
+			"backend":    "main/good",
+			"cache":      "hit",
+			"status":     float64(200),
+		},
+		{"method": "eth_unknown", "auth": "client", "cache": "miss", "status": float64(403), "error_code": float64(proxyd.ErrMethodNotWhitelisted.Code)},
+		{"status": float64(401)},
+	}, lines)
+}
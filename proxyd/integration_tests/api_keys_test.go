@@ -0,0 +1,123 @@
+package integration_tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis"
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKeys(t *testing.T) {
+	redis, err := miniredis.Run()
+	require.NoError(t, err)
+	defer redis.Close()
+
+	goodBackend := NewMockBackend(BatchedResponseHandler(200, goodResponse))
+	defer goodBackend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+	require.NoError(t, os.Setenv("REDIS_URL", fmt.Sprintf("redis://127.0.0.1:%s", redis.Port())))
+
+	config := ReadConfig("api_keys")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	adminReq := func(t *testing.T, method string, path string, body string) (int, *proxyd.AdminAPIKeyResponse) {
+		req, err := http.NewRequest(method, "http://127.0.0.1:8547"+path, bytes.NewReader([]byte(body)))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer admin-token")
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		key := new(proxyd.AdminAPIKeyResponse)
+		if res.StatusCode == 200 {
+			require.NoError(t, json.NewDecoder(res.Body).Decode(key))
+		}
+		return res.StatusCode, key
+	}
+	call := func(t *testing.T, secret string, method string) int {
+		_, code, err := NewProxydClient("http://127.0.0.1:8545/"+secret).SendRPC(method, nil)
+		require.NoError(t, err)
+		return code
+	}
+
+	require.Equal(t, 401, call(t, "", "eth_chainId"))
+	require.Equal(t, 200, call(t, "static_secret", "eth_chainId"))
+
+	code, key := adminReq(t, "POST", "/api_keys", `{"alias": "partner", "ttl": "1h"}`)
+	require.Equal(t, 200, code)
+	require.Equal(t, "partner", key.Alias)
+	require.WithinDuration(t, time.Now().Add(time.Hour), *key.ExpiresAt, 5*time.Second)
+	id, first := key.ID, key.Secret
+	require.NotEmpty(t, first)
+
+	t.Run("keys authenticate as their alias", func(t *testing.T) {
+		require.Equal(t, 200, call(t, first, "eth_chainId"))
+		require.Equal(t, 403, call(t, first, "eth_blockNumber"))
+		require.Equal(t, 401, call(t, "unknown_secret", "eth_chainId"))
+
+		req, err := http.NewRequest("GET", "http://127.0.0.1:8547/api_keys", nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer admin-token")
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		var keys []map[string]interface{}
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&keys))
+		require.Len(t, keys, 1)
+		require.Equal(t, id, keys[0]["id"])
+		require.NotContains(t, keys[0], "secret")
+		require.NotContains(t, keys[0], "secret_hash")
+	})
+
+	t.Run("rotated secrets stay valid for the grace", func(t *testing.T) {
+		code, key := adminReq(t, "POST", "/api_keys/"+id+"/rotate", `{"grace": "1h"}`)
+		require.Equal(t, 200, code)
+		second := key.Secret
+		require.NotEqual(t, first, second)
+		require.NotNil(t, key.PreviousValidUntil)
+		require.Equal(t, 200, call(t, first, "eth_chainId"))
+		require.Equal(t, 200, call(t, second, "eth_chainId"))
+
+		code, key = adminReq(t, "POST", "/api_keys/"+id+"/rotate", "")
+		require.Equal(t, 200, code)
+		third := key.Secret
+		require.Nil(t, key.PreviousValidUntil)
+		require.Equal(t, 401, call(t, first, "eth_chainId"))
+		require.Equal(t, 401, call(t, second, "eth_chainId"))
+		require.Equal(t, 200, call(t, third, "eth_chainId"))
+		first = third
+	})
+
+	t.Run("expired keys are refused", func(t *testing.T) {
+		past := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+		code, _ := adminReq(t, "POST", "/api_keys/"+id+"/expire", `{"expires_at": "`+past+`"}`)
+		require.Equal(t, 200, code)
+		require.Equal(t, 401, call(t, first, "eth_chainId"))
+
+		code, key := adminReq(t, "POST", "/api_keys/"+id+"/expire", "")
+		require.Equal(t, 200, code)
+		require.Nil(t, key.ExpiresAt)
+		require.Equal(t, 200, call(t, first, "eth_chainId"))
+	})
+
+	t.Run("revoked keys are refused", func(t *testing.T) {
+		code, key := adminReq(t, "DELETE", "/api_keys/"+id, "")
+		require.Equal(t, 200, code)
+		require.NotNil(t, key.RevokedAt)
+		require.Equal(t, 401, call(t, first, "eth_chainId"))
+
+		code, _ = adminReq(t, "POST", "/api_keys/"+id+"/rotate", "")
+		require.Equal(t, http.StatusConflict, code)
+		code, _ = adminReq(t, "DELETE", "/api_keys/unknown", "")
+		require.Equal(t, http.StatusNotFound, code)
+	})
+}
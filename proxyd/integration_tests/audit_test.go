@@ -0,0 +1,109 @@
+package integration_tests
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditLog(t *testing.T) {
+	goodBackend := NewMockBackend(BatchedResponseHandler(200, goodResponse))
+	defer goodBackend.Close()
+
+	var mtx sync.Mutex
+	var posted []*proxyd.AuditEvent
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "Bearer audit-token", r.Header.Get("Authorization"))
+		var batch []*proxyd.AuditEvent
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&batch))
+		mtx.Lock()
+		posted = append(posted, batch...)
+		mtx.Unlock()
+	}))
+	defer webhook.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+
+	file := filepath.Join(t.TempDir(), "audit.log")
+	config := ReadConfig("audit")
+	config.AuditLog.File = file
+	config.AuditLog.WebhookURL = webhook.URL
+	srv, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+
+	adminReq := func(method, path, token, body string) int {
+		req, err := http.NewRequest(method, "http://127.0.0.1:8547"+path, bytes.NewReader([]byte(body)))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	_, code, err := NewProxydClient("http://127.0.0.1:8545/wrong_secret").SendRPC("eth_chainId", nil)
+	require.NoError(t, err)
+	require.Equal(t, 401, code)
+	_, code, err = NewProxydClient("http://127.0.0.1:8545/client_secret").SendRPC("eth_chainId", nil)
+	require.NoError(t, err)
+	require.Equal(t, 200, code)
+
+	require.Equal(t, 401, adminReq("POST", "/abuse/bans", "wrong-token", `{"client": "key:client", "duration": "1m"}`))
+	require.Equal(t, 200, adminReq("GET", "/abuse/bans", "admin-token", ""))
+	require.Equal(t, 200, adminReq("POST", "/abuse/bans", "admin-token", `{"client": "key:client", "duration": "1m"}`))
+	require.Equal(t, 204, adminReq("DELETE", "/abuse/bans/key:client", "admin-token", ""))
+	require.NoError(t, srv.ReloadConfig(config))
+
+	// the pending events are written on shutdown
+	shutdown()
+
+	f, err := os.Open(file)
+	require.NoError(t, err)
+	defer f.Close()
+	var events []*proxyd.AuditEvent
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		event := new(proxyd.AuditEvent)
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), event))
+		require.False(t, event.Time.IsZero())
+		events = append(events, event)
+	}
+	require.NoError(t, scanner.Err())
+
+	type summary struct {
+		event  string
+		fields map[string]string
+	}
+	var summaries []summary
+	for _, e := range events {
+		delete(e.Fields, "remote_ip")
+		delete(e.Fields, "remote_addr")
+		delete(e.Fields, "until")
+		summaries = append(summaries, summary{e.Event, e.Fields})
+	}
+	require.Equal(t, []summary{
+		{proxyd.AuditEventAuthFailure, map[string]string{"reason": "invalid_key"}},
+		{proxyd.AuditEventAuthFailure, map[string]string{"reason": "admin_token", "path": "/abuse/bans"}},
+		{proxyd.AuditEventClientBan, map[string]string{"client": "key:client", "action": "ban", "reason": "manual"}},
+		{proxyd.AuditEventAdminAction, map[string]string{"method": "POST", "path": "/abuse/bans", "status": "200"}},
+		{proxyd.AuditEventClientUnban, map[string]string{"client": "key:client"}},
+		{proxyd.AuditEventAdminAction, map[string]string{"method": "DELETE", "path": "/abuse/bans/key:client", "status": "204"}},
+		{proxyd.AuditEventConfigReload, map[string]string{"result": "applied"}},
+	}, summaries)
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	require.Len(t, posted, len(events))
+	for i, e := range posted {
+		require.Equal(t, events[i].Event, e.Event)
+	}
+}
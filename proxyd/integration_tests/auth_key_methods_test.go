@@ -0,0 +1,105 @@
+package integration_tests
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+// methodDenials returns the count of the denials of method to auth over
+// source.
+func methodDenials(t *testing.T, auth, method, source string) float64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != "proxyd_auth_key_method_denials_total" {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			labels := make(map[string]string)
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			if labels["auth"] == auth && labels["method"] == method && labels["source"] == source {
+				return m.GetCounter().GetValue()
+			}
+		}
+	}
+	return 0
+}
+
+func TestAuthKeyMethods(t *testing.T) {
+	goodBackend := NewMockBackend(BatchedResponseHandler(200, goodResponse))
+	defer goodBackend.Close()
+	wsBackend := NewMockWSBackend(nil, func(conn *websocket.Conn, msgType int, data []byte) {
+		req, err := proxyd.ParseRPCReq(data)
+		require.NoError(t, err)
+		_ = conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":%s,"result":"0x1"}`, req.ID)))
+	}, nil)
+	defer wsBackend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+	require.NoError(t, os.Setenv("GOOD_BACKEND_WS_URL", wsBackend.URL()))
+
+	config := ReadConfig("auth_key_methods")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	t.Run("http", func(t *testing.T) {
+		tests := []struct {
+			secret string
+			method string
+			code   int
+		}{
+			{"partner_secret", "debug_traceBlockByNumber", 200},
+			{"partner_secret", "trace_block", 200},
+			{"public_secret", "eth_chainId", 200},
+			{"public_secret", "debug_traceBlockByNumber", 403},
+			{"public_secret", "trace_block", 403},
+			{"reader_secret", "eth_chainId", 200},
+			{"reader_secret", "eth_sendRawTransaction", 403},
+			{"reader_secret", "trace_block", 403},
+		}
+		for _, tt := range tests {
+			client := NewProxydClient("http://127.0.0.1:8545/" + tt.secret)
+			_, code, err := client.SendRPC(tt.method, nil)
+			require.NoError(t, err)
+			require.Equal(t, tt.code, code, "%s %s", tt.secret, tt.method)
+		}
+		require.Equal(t, float64(1), methodDenials(t, "public", "debug_traceBlockByNumber", proxyd.RPCRequestSourceHTTP))
+		require.Equal(t, float64(1), methodDenials(t, "reader", "eth_sendRawTransaction", proxyd.RPCRequestSourceHTTP))
+	})
+
+	t.Run("ws", func(t *testing.T) {
+		call := func(t *testing.T, secret string, method string) map[string]interface{} {
+			conn, _, err := websocket.DefaultDialer.Dial("ws://127.0.0.1:8546/"+secret, nil) // nolint:bodyclose
+			require.NoError(t, err)
+			defer conn.Close()
+			require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(`{"jsonrpc":"2.0","id":1,"method":"`+method+`"}`)))
+			require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+			var res map[string]interface{}
+			require.NoError(t, conn.ReadJSON(&res))
+			return res
+		}
+
+		res := call(t, "partner_secret", "debug_traceBlockByNumber")
+		require.Equal(t, "0x1", res["result"])
+		res = call(t, "public_secret", "debug_traceBlockByNumber")
+		require.Equal(t, float64(proxyd.ErrMethodNotWhitelisted.Code), res["error"].(map[string]interface{})["code"])
+		res = call(t, "public_secret", "eth_chainId")
+		require.Equal(t, "0x1", res["result"])
+		require.Equal(t, float64(1), methodDenials(t, "public", "debug_traceBlockByNumber", proxyd.RPCRequestSourceWS))
+
+		// methods outside of the whitelist aren't denied by the key
+		res = call(t, "public_secret", "trace_block")
+		require.NotNil(t, res["error"])
+		require.Zero(t, methodDenials(t, "public", "trace_block", proxyd.RPCRequestSourceWS))
+	})
+}
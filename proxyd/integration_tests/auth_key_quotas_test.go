@@ -0,0 +1,79 @@
+package integration_tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis"
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthKeyQuotas(t *testing.T) {
+	redis, err := miniredis.Run()
+	require.NoError(t, err)
+	defer redis.Close()
+
+	hdlr := NewBatchRPCResponseRouter()
+	hdlr.SetFallbackRoute("eth_chainId", "0xa")
+	goodBackend := NewMockBackend(hdlr)
+	defer goodBackend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+	require.NoError(t, os.Setenv("REDIS_URL", fmt.Sprintf("redis://127.0.0.1:%s", redis.Port())))
+
+	config := ReadConfig("auth_key_quotas")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	basic := NewProxydClient("http://127.0.0.1:8545/basic_secret")
+	pro := NewProxydClient("http://127.0.0.1:8545/pro_secret")
+
+	// batches count each of their calls
+	_, code, err := basic.SendBatchRPC(
+		NewRPCReq("1", "eth_chainId", nil),
+		NewRPCReq("2", "eth_chainId", nil),
+	)
+	require.NoError(t, err)
+	require.Equal(t, 200, code)
+	_, code, err = basic.SendRPC("eth_chainId", nil)
+	require.NoError(t, err)
+	require.Equal(t, 200, code)
+
+	res, code, headers, err := basic.SendRPCWithHeaders("eth_chainId", nil)
+	require.NoError(t, err)
+	require.Equal(t, 429, code)
+	var rpcRes proxyd.RPCRes
+	require.NoError(t, json.Unmarshal(res, &rpcRes))
+	require.Equal(t, "daily quota exceeded", rpcRes.Error.Message)
+
+	now := time.Now().UTC()
+	reset := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	require.Equal(t, reset.Format(time.RFC3339), rpcRes.Error.Data)
+	retryAfter, err := strconv.Atoi(headers.Get("Retry-After"))
+	require.NoError(t, err)
+	require.InDelta(t, time.Until(reset).Seconds(), retryAfter, 2)
+
+	// counters expire at the end of their window
+	daily := "proxyd:quota:basic:daily:" + now.Format("2006-01-02")
+	count, err := redis.Get(daily)
+	require.NoError(t, err)
+	require.Equal(t, "4", count)
+	require.InDelta(t, time.Until(reset).Seconds(), redis.TTL(daily).Seconds(), 2)
+	monthly := "proxyd:quota:basic:monthly:" + now.Format("2006-01")
+	count, err = redis.Get(monthly)
+	require.NoError(t, err)
+	require.Equal(t, "4", count)
+
+	// keys without quotas are unaffected
+	for i := 0; i < 5; i++ {
+		_, code, err := pro.SendRPC("eth_chainId", nil)
+		require.NoError(t, err)
+		require.Equal(t, 200, code)
+	}
+}
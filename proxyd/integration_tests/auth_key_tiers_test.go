@@ -0,0 +1,83 @@
+package integration_tests
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthKeyTiers(t *testing.T) {
+	hdlr := NewBatchRPCResponseRouter()
+	hdlr.SetFallbackRoute("eth_chainId", "0xa")
+	hdlr.SetFallbackRoute("eth_blockNumber", "0x64")
+	goodBackend := NewMockBackend(hdlr)
+	defer goodBackend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+
+	config := ReadConfig("auth_key_tiers")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	basic := NewProxydClient("http://127.0.0.1:8545/basic_secret")
+	pro := NewProxydClient("http://127.0.0.1:8545/pro_secret")
+
+	requireErrCode := func(t *testing.T, code int, body []byte) {
+		var res proxyd.RPCRes
+		require.NoError(t, json.Unmarshal(body, &res))
+		require.NotNil(t, res.Error, string(body))
+		require.Equal(t, code, res.Error.Code)
+	}
+
+	t.Run("allowed methods", func(t *testing.T) {
+		res, code, err := basic.SendRPC("eth_blockNumber", nil)
+		require.NoError(t, err)
+		require.Equal(t, 403, code)
+		requireErrCode(t, proxyd.ErrMethodNotWhitelisted.Code, res)
+
+		_, code, err = pro.SendRPC("eth_blockNumber", nil)
+		require.NoError(t, err)
+		require.Equal(t, 200, code)
+	})
+
+	t.Run("max batch size", func(t *testing.T) {
+		reqs := []*proxyd.RPCReq{
+			NewRPCReq("1", "eth_chainId", nil),
+			NewRPCReq("2", "eth_chainId", nil),
+			NewRPCReq("3", "eth_chainId", nil),
+		}
+		res, code, err := basic.SendBatchRPC(reqs...)
+		require.NoError(t, err)
+		require.Equal(t, 200, code)
+		requireErrCode(t, proxyd.ErrTooManyBatchRequests.Code, res)
+
+		_, code, err = pro.SendBatchRPC(reqs...)
+		require.NoError(t, err)
+		require.Equal(t, 200, code)
+	})
+
+	t.Run("rate limit", func(t *testing.T) {
+		// start at the beginning of a rate limit window
+		time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+
+		codes := make(map[int]int)
+		for i := 0; i < 5; i++ {
+			_, code, err := basic.SendRPC("eth_chainId", nil)
+			require.NoError(t, err)
+			codes[code]++
+		}
+		require.Equal(t, 2, codes[200])
+		require.Equal(t, 3, codes[429])
+
+		for i := 0; i < 5; i++ {
+			_, code, err := pro.SendRPC("eth_chainId", nil)
+			require.NoError(t, err)
+			require.Equal(t, 200, code)
+		}
+	})
+}
@@ -0,0 +1,128 @@
+package integration_tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis"
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthKeyUsage(t *testing.T) {
+	redis, err := miniredis.Run()
+	require.NoError(t, err)
+	defer redis.Close()
+
+	goodBackend := NewMockBackend(BatchedResponseHandler(200, goodResponse))
+	defer goodBackend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+	require.NoError(t, os.Setenv("REDIS_URL", fmt.Sprintf("redis://127.0.0.1:%s", redis.Port())))
+
+	config := ReadConfig("auth_key_usage")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	getUsage := func(url, token string) (int, *proxyd.AuthKeyUsage) {
+		req, err := http.NewRequest("GET", url, nil)
+		require.NoError(t, err)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		if res.StatusCode != 200 {
+			return res.StatusCode, nil
+		}
+		usage := new(proxyd.AuthKeyUsage)
+		require.NoError(t, json.NewDecoder(res.Body).Decode(usage))
+		return res.StatusCode, usage
+	}
+
+	free := NewProxydClient("http://127.0.0.1:8545/free_secret")
+	metered := NewProxydClient("http://127.0.0.1:8545/metered_secret")
+	throttled := NewProxydClient("http://127.0.0.1:8545/throttled_secret")
+
+	for i := 0; i < 2; i++ {
+		_, code, err := free.SendRPC("eth_chainId", nil)
+		require.NoError(t, err)
+		require.Equal(t, 200, code)
+	}
+
+	// eth_call costs 10 compute units, other methods 1
+	_, code, err := metered.SendRPC("eth_call", nil)
+	require.NoError(t, err)
+	require.Equal(t, 200, code)
+	_, code, err = metered.SendBatchRPC(
+		NewRPCReq("1", "eth_call", nil),
+		NewRPCReq("2", "eth_chainId", nil),
+	)
+	require.NoError(t, err)
+	require.Equal(t, 200, code)
+	_, code, err = metered.SendRPC("eth_call", nil)
+	require.NoError(t, err)
+	require.Equal(t, 429, code)
+
+	var throttledCodes []int
+	for i := 0; i < 3; i++ {
+		_, code, err := throttled.SendRPC("eth_chainId", nil)
+		require.NoError(t, err)
+		throttledCodes = append(throttledCodes, code)
+	}
+	require.Contains(t, throttledCodes, 429)
+
+	now := time.Now().UTC()
+	code, usage := getUsage("http://127.0.0.1:8545/metered_secret/usage", "")
+	require.Equal(t, 200, code)
+	require.Equal(t, "metered", usage.Alias)
+	require.Len(t, usage.Quotas, 1)
+	require.Equal(t, proxyd.QuotaPeriodMonthly, usage.Quotas[0].Period)
+	require.Equal(t, proxyd.QuotaUnitComputeUnits, usage.Quotas[0].Unit)
+	require.Equal(t, int64(25), usage.Quotas[0].Limit)
+	// the rejected call is counted too
+	require.Equal(t, int64(31), usage.Quotas[0].Used)
+	require.Equal(t, int64(0), usage.Quotas[0].Remaining)
+	require.True(t, usage.Quotas[0].ResetsAt.Equal(time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)))
+
+	code, usage = getUsage("http://127.0.0.1:8545/free_secret/usage", "")
+	require.Equal(t, 200, code)
+	require.Equal(t, []*proxyd.QuotaUsage{{
+		Period:    proxyd.QuotaPeriodDaily,
+		Unit:      proxyd.QuotaUnitRequests,
+		Limit:     100,
+		Used:      2,
+		Remaining: 98,
+		ResetsAt:  time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC),
+	}}, usage.Quotas)
+
+	code, usage = getUsage("http://127.0.0.1:8545/throttled_secret/usage", "")
+	require.Equal(t, 200, code)
+	require.Empty(t, usage.Quotas)
+
+	code, _ = getUsage("http://127.0.0.1:8545/wrong_secret/usage", "")
+	require.Equal(t, 401, code)
+
+	code, _ = getUsage("http://127.0.0.1:8547/auth_keys/free/usage", "wrong-token")
+	require.Equal(t, 401, code)
+	code, usage = getUsage("http://127.0.0.1:8547/auth_keys/free/usage", "admin-token")
+	require.Equal(t, 200, code)
+	require.Equal(t, "free", usage.Alias)
+	require.Equal(t, int64(2), usage.Quotas[0].Used)
+
+	usageMetric := func(family string, labels map[string]string) float64 {
+		return metricValue(t, "proxyd_"+family, labels)
+	}
+	require.Equal(t, float64(2), usageMetric("auth_key_requests_total", map[string]string{"auth": "free"}))
+	require.Equal(t, float64(2), usageMetric("auth_key_compute_units_total", map[string]string{"auth": "free"}))
+	require.Equal(t, float64(3), usageMetric("auth_key_requests_total", map[string]string{"auth": "metered"}))
+	require.Equal(t, float64(21), usageMetric("auth_key_compute_units_total", map[string]string{"auth": "metered"}))
+	require.Equal(t, float64(1), usageMetric("auth_key_rejections_total", map[string]string{"auth": "metered", "reason": proxyd.AuthRejectionQuota}))
+	require.GreaterOrEqual(t, usageMetric("auth_key_rejections_total", map[string]string{"auth": "throttled", "reason": proxyd.AuthRejectionRateLimit}), float64(1))
+}
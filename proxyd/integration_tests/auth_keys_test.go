@@ -0,0 +1,118 @@
+package integration_tests
+
+import (
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthKeyAllowedOrigins(t *testing.T) {
+	goodBackend := NewMockBackend(BatchedResponseHandler(200, goodResponse))
+	defer goodBackend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+
+	config := ReadConfig("auth_keys")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	tests := []struct {
+		name    string
+		path    string
+		headers http.Header
+		code    int
+	}{
+		{"allowed origin", "frontend_secret", http.Header{"Origin": {"https://app.example.com"}}, 200},
+		{"disallowed origin", "frontend_secret", http.Header{"Origin": {"https://evil.example.com"}}, 403},
+		{"allowed referer", "frontend_secret", http.Header{"Referer": {"https://app.example.com/swap?x=1"}}, 200},
+		{"disallowed referer", "frontend_secret", http.Header{"Referer": {"https://app.example.com.evil.com/"}}, 403},
+		{"origin takes precedence", "frontend_secret", http.Header{
+			"Origin":  {"https://evil.example.com"},
+			"Referer": {"https://app.example.com/"},
+		}, 403},
+		{"missing origin", "frontend_secret", http.Header{}, 403},
+		{"unrestricted key", "backend_secret", http.Header{"Origin": {"https://evil.example.com"}}, 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewProxydClientWithHeaders("http://127.0.0.1:8545/"+tt.path, tt.headers)
+			_, code, err := client.SendRPC("eth_chainId", nil)
+			require.NoError(t, err)
+			require.Equal(t, tt.code, code)
+		})
+	}
+}
+
+func TestAuthKeyAllowedCIDRs(t *testing.T) {
+	goodBackend := NewMockBackend(BatchedResponseHandler(200, goodResponse))
+	defer goodBackend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+
+	config := ReadConfig("auth_keys")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	tests := []struct {
+		name string
+		xff  string
+		code int
+	}{
+		{"allowed IP", "10.1.2.3", 200},
+		{"allowed IPv6", "fd00::1", 200},
+		// the client is the right-most entry appended by the trusted proxy
+		{"forged first IP of the chain", "10.1.2.3, 192.168.1.1", 403},
+		{"disallowed IP", "192.168.1.1", 403},
+		{"right-most IP of the chain", "192.168.1.1, 10.1.2.3", 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewProxydClientWithHeaders("http://127.0.0.1:8545/internal_secret", http.Header{"X-Forwarded-For": {tt.xff}})
+			_, code, err := client.SendRPC("eth_chainId", nil)
+			require.NoError(t, err)
+			require.Equal(t, tt.code, code)
+		})
+	}
+
+	t.Run("ws upgrades", func(t *testing.T) {
+		_, res, err := websocket.DefaultDialer.Dial("ws://127.0.0.1:8546/internal_secret", http.Header{"X-Forwarded-For": {"192.168.1.1"}})
+		require.Error(t, err)
+		require.Equal(t, 403, res.StatusCode)
+		res.Body.Close()
+
+		_, res, err = websocket.DefaultDialer.Dial("ws://127.0.0.1:8546/frontend_secret", http.Header{"Origin": {"https://evil.example.com"}})
+		require.Error(t, err)
+		require.Equal(t, 403, res.StatusCode)
+		res.Body.Close()
+	})
+}
+
+func TestAuthKeyAllowedCIDRsForgedXFF(t *testing.T) {
+	goodBackend := NewMockBackend(BatchedResponseHandler(200, goodResponse))
+	defer goodBackend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+
+	// the header of untrusted peers is ignored, the client IP is 127.0.0.1
+	config := ReadConfig("auth_keys")
+	config.Server.TrustedProxyCIDRs = nil
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	client := NewProxydClientWithHeaders("http://127.0.0.1:8545/internal_secret", http.Header{"X-Forwarded-For": {"10.1.2.3"}})
+	_, code, err := client.SendRPC("eth_chainId", nil)
+	require.NoError(t, err)
+	require.Equal(t, 403, code)
+
+	_, res, err := websocket.DefaultDialer.Dial("ws://127.0.0.1:8546/internal_secret", http.Header{"X-Forwarded-For": {"10.1.2.3"}})
+	require.Error(t, err)
+	require.Equal(t, 403, res.StatusCode)
+	res.Body.Close()
+}
@@ -0,0 +1,97 @@
+package integration_tests
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+// metricValue returns the value of the counter of family with labels,
+// or the sample count of the histogram.
+func metricValue(t *testing.T, family string, labels map[string]string) float64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err)
+	for _, f := range families {
+		if f.GetName() != family {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			matches := 0
+			for _, l := range m.GetLabel() {
+				if labels[l.GetName()] == l.GetValue() {
+					matches++
+				}
+			}
+			if matches != len(labels) || len(m.GetLabel()) != len(labels) {
+				continue
+			}
+			if h := m.GetHistogram(); h != nil {
+				return float64(h.GetSampleCount())
+			}
+			return m.GetCounter().GetValue()
+		}
+	}
+	return 0
+}
+
+func TestBackendMethodMetrics(t *testing.T) {
+	backend := NewMockBackend(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		req, err := proxyd.ParseRPCReq(body)
+		require.NoError(t, err)
+		switch req.Method {
+		case "eth_call":
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"error":{"code":3,"message":"execution reverted"}}`, req.ID)
+		case "net_version":
+			w.WriteHeader(429)
+		default:
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"result":"0x1"}`, req.ID)
+		}
+	}))
+	defer backend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", backend.URL()))
+
+	config := ReadConfig("backend_method_metrics")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	client := NewProxydClient("http://127.0.0.1:8545")
+	for _, method := range []string{"eth_chainId", "eth_call", "net_version", "eth_blockNumber"} {
+		_, _, err := client.SendRPC(method, nil)
+		require.NoError(t, err)
+	}
+
+	latency := func(method string) float64 {
+		return metricValue(t, "proxyd_backend_method_latency_seconds", map[string]string{
+			"backend_name": "metered",
+			"method_name":  method,
+		})
+	}
+	errors := func(method, class string) float64 {
+		return metricValue(t, "proxyd_backend_method_errors_total", map[string]string{
+			"backend_name": "metered",
+			"method_name":  method,
+			"error_class":  class,
+		})
+	}
+
+	require.Equal(t, float64(1), latency("eth_chainId"))
+	require.Equal(t, float64(1), latency("eth_call"))
+	// net_version is beyond max_methods, eth_blockNumber isn't allowed
+	require.Equal(t, float64(0), latency("net_version"))
+	require.Equal(t, float64(0), latency("eth_blockNumber"))
+	require.Equal(t, float64(2), latency("other"))
+
+	require.Equal(t, float64(1), errors("eth_call", proxyd.BackendErrorClassExecutionReverted))
+	require.Equal(t, float64(1), errors("other", proxyd.BackendErrorClassRateLimited))
+	require.Equal(t, float64(0), errors("eth_chainId", proxyd.BackendErrorClassExecutionReverted))
+}
@@ -0,0 +1,89 @@
+package integration_tests
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBundler(t *testing.T) {
+	goodBackend := NewMockBackend(SingleResponseHandler(200, dummyRes))
+	defer goodBackend.Close()
+	bundlerBackend := NewMockBackend(SingleResponseHandler(200, dummyRes))
+	defer bundlerBackend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+	require.NoError(t, os.Setenv("BUNDLER_BACKEND_RPC_URL", bundlerBackend.URL()))
+
+	config := ReadConfig("bundler")
+	client := NewProxydClient("http://127.0.0.1:8545")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	const entryPoint = `"0x0000000071727De22E5E9d8BAf0edAc6f37da032"`
+	const op = `{"sender":"0x000000000000000000000000000000000000dEaD","nonce":"0x1","callData":"0x","signature":"0x01",` +
+		`"callGasLimit":"0x1","verificationGasLimit":"0x1","preVerificationGas":"0x1","maxFeePerGas":"0x1","maxPriorityFeePerGas":"0x1"}`
+	const estimateOp = `{"sender":"0x000000000000000000000000000000000000dEaD","nonce":"0x1","callData":"0x"}`
+
+	tests := []struct {
+		name   string
+		method string
+		params string
+		code   int
+		res    string
+	}{
+		{"send user operation", "eth_sendUserOperation", fmt.Sprintf(`[%s,%s]`, op, entryPoint), 200, dummyRes},
+		{"estimate user operation gas", "eth_estimateUserOperationGas", fmt.Sprintf(`[%s,%s]`, estimateOp, entryPoint), 200, dummyRes},
+		{"get user operation receipt", "eth_getUserOperationReceipt", `["0x0000000000000000000000000000000000000000000000000000000000000001"]`, 200, dummyRes},
+		{"supported entry points", "eth_supportedEntryPoints", `[]`, 200, dummyRes},
+		{
+			"missing fields",
+			"eth_sendUserOperation",
+			fmt.Sprintf(`[%s,%s]`, estimateOp, entryPoint),
+			400,
+			`{"error":{"code":-32602,"message":"user operation missing fields: signature, callGasLimit, verificationGasLimit, preVerificationGas, maxFeePerGas, maxPriorityFeePerGas"},"id":1,"jsonrpc":"2.0"}`,
+		},
+		{
+			"unknown field",
+			"eth_estimateUserOperationGas",
+			fmt.Sprintf(`[{"sender":"0x000000000000000000000000000000000000dEaD","nonce":"0x1","callData":"0x","foo":"0x"},%s]`, entryPoint),
+			400,
+			`{"error":{"code":-32602,"message":"invalid user operation: json: unknown field \"foo\""},"id":1,"jsonrpc":"2.0"}`,
+		},
+		{
+			"unsupported entry point",
+			"eth_sendUserOperation",
+			fmt.Sprintf(`[%s,"0x5FF137D4b0FDCD49DcA30c7CF57E578a026d2789"]`, op),
+			400,
+			`{"error":{"code":-32602,"message":"unsupported entry point 0x5FF137D4b0FDCD49DcA30c7CF57E578a026d2789"},"id":1,"jsonrpc":"2.0"}`,
+		},
+		{
+			"invalid hash",
+			"eth_getUserOperationReceipt",
+			`["0x01"]`,
+			400,
+			`{"error":{"code":-32602,"message":"invalid user operation hash"},"id":1,"jsonrpc":"2.0"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			goodBackend.Reset()
+			bundlerBackend.Reset()
+			res, code, err := client.SendRequest([]byte(fmt.Sprintf(`{"jsonrpc":"2.0","method":"%s","params":%s,"id":1}`, tt.method, tt.params)))
+			require.NoError(t, err)
+			require.Equal(t, tt.code, code)
+			RequireEqualJSON(t, []byte(tt.res), res)
+			require.Equal(t, 0, len(goodBackend.Requests()))
+			if code == http.StatusOK {
+				require.Equal(t, 1, len(bundlerBackend.Requests()))
+			} else {
+				require.Equal(t, 0, len(bundlerBackend.Requests()))
+			}
+		})
+	}
+}
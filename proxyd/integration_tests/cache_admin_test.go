@@ -0,0 +1,144 @@
+package integration_tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis"
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminRequiresToken(t *testing.T) {
+	config := ReadConfig("cache_admin")
+	config.Admin.Token = ""
+	_, _, err := proxyd.Start(config)
+	require.ErrorContains(t, err, "token")
+}
+
+func TestCacheAdmin(t *testing.T) {
+	redis, err := miniredis.Run()
+	require.NoError(t, err)
+	defer redis.Close()
+
+	hdlr := NewBatchRPCResponseRouter()
+	hdlr.SetRoute("eth_chainId", "999", "0x420")
+	hdlr.SetRoute("net_version", "999", "0x1234")
+	hdlr.SetRoute("eth_blockNumber", "999", "0x64")
+	hdlr.SetRoute("eth_getBlockByHash", "999", "eth_getBlockByHash")
+
+	backend := NewMockBackend(hdlr)
+	defer backend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", backend.URL()))
+	require.NoError(t, os.Setenv("REDIS_URL", fmt.Sprintf("redis://127.0.0.1:%s", redis.Port())))
+	config := ReadConfig("cache_admin")
+	client := NewProxydClient("http://127.0.0.1:8545")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	// allow time for the block number fetcher to fire
+	time.Sleep(1500 * time.Millisecond)
+
+	adminReq := func(method string, path string, body string) *http.Response {
+		req, err := http.NewRequest(method, "http://127.0.0.1:8547"+path, bytes.NewReader([]byte(body)))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer admin-token")
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return res
+	}
+	blockHash := "0xc6ef2fc5426d6ad6fd9e2a26abeab0aa2411b7ab17f30a99d3cb96aed1d1055b"
+	warm := func() {
+		for _, method := range []string{"eth_chainId", "net_version"} {
+			_, _, err := client.SendRPC(method, nil)
+			require.NoError(t, err)
+		}
+		_, _, err := client.SendRPC("eth_getBlockByHash", []interface{}{blockHash, false})
+		require.NoError(t, err)
+		backend.Reset()
+	}
+	inspect := func(body string) *proxyd.RPCCacheInspection {
+		res := adminReq("POST", "/cache/inspect", body)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		inspection := new(proxyd.RPCCacheInspection)
+		require.NoError(t, json.NewDecoder(res.Body).Decode(inspection))
+		return inspection
+	}
+	purge := func(body string) int {
+		res := adminReq("POST", "/cache/purge", body)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		purged := new(proxyd.AdminCachePurgeResponse)
+		require.NoError(t, json.NewDecoder(res.Body).Decode(purged))
+		return purged.Purged
+	}
+	getBlockReq := fmt.Sprintf(`{"jsonrpc": "2.0", "method": "eth_getBlockByHash", "params": ["%s", false], "id": 1}`, blockHash)
+
+	t.Run("inspect", func(t *testing.T) {
+		warm()
+		inspection := inspect(getBlockReq)
+		require.True(t, inspection.Cacheable)
+		require.True(t, inspection.Hit)
+		require.Equal(t, "eth_getBlockByHash", inspection.Result)
+		require.NotEmpty(t, inspection.Key)
+
+		inspection = inspect(`{"jsonrpc": "2.0", "method": "eth_blockNumber", "id": 1}`)
+		require.False(t, inspection.Cacheable)
+		require.False(t, inspection.Hit)
+
+		res := adminReq("POST", "/cache/inspect", "not json")
+		require.Equal(t, http.StatusBadRequest, res.StatusCode)
+		res.Body.Close()
+	})
+
+	t.Run("purge request", func(t *testing.T) {
+		warm()
+		require.Equal(t, 1, purge(fmt.Sprintf(`{"request": %s}`, getBlockReq)))
+		require.Equal(t, 0, purge(fmt.Sprintf(`{"request": %s}`, getBlockReq)))
+		require.False(t, inspect(getBlockReq).Hit)
+		require.True(t, inspect(`{"jsonrpc": "2.0", "method": "eth_chainId", "params": null, "id": 1}`).Hit)
+
+		_, _, err := client.SendRPC("eth_getBlockByHash", []interface{}{blockHash, false})
+		require.NoError(t, err)
+		require.Equal(t, 1, countRequests(backend, "eth_getBlockByHash"))
+	})
+
+	t.Run("purge method", func(t *testing.T) {
+		warm()
+		require.Equal(t, 1, purge(`{"method": "eth_chainId"}`))
+		require.False(t, inspect(`{"jsonrpc": "2.0", "method": "eth_chainId", "params": null, "id": 1}`).Hit)
+		require.True(t, inspect(`{"jsonrpc": "2.0", "method": "net_version", "params": null, "id": 1}`).Hit)
+
+		res := adminReq("POST", "/cache/purge", `{"method": "eth_blockNumber"}`)
+		require.Equal(t, http.StatusBadRequest, res.StatusCode)
+		res.Body.Close()
+	})
+
+	t.Run("purge all", func(t *testing.T) {
+		warm()
+		require.Equal(t, 3, purge(""))
+		require.False(t, inspect(getBlockReq).Hit)
+		require.False(t, inspect(`{"jsonrpc": "2.0", "method": "net_version", "params": null, "id": 1}`).Hit)
+		require.Empty(t, redis.Keys())
+	})
+
+	t.Run("stats", func(t *testing.T) {
+		res := adminReq("GET", "/cache/stats", "")
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		stats := new(proxyd.RPCCacheStats)
+		require.NoError(t, json.NewDecoder(res.Body).Decode(stats))
+		require.Greater(t, stats.Methods["eth_chainId"].Hits, uint64(0))
+		require.Greater(t, stats.Methods["eth_chainId"].Misses, uint64(0))
+		// sizes are only known for in-memory caches
+		require.Nil(t, stats.Entries)
+	})
+}
@@ -0,0 +1,68 @@
+package integration_tests
+
+import (
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheControl(t *testing.T) {
+	goodBackend := NewMockBackend(BatchedResponseHandler(200, goodResponse))
+	defer goodBackend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+
+	config := ReadConfig("cache_control")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	send := func(path string, directives string, method string) {
+		headers := http.Header{}
+		if directives != "" {
+			headers.Set(proxyd.CacheControlHeader, directives)
+		}
+		client := NewProxydClientWithHeaders("http://127.0.0.1:8545/"+path, headers)
+		res, code, err := client.SendRPC(method, nil)
+		require.NoError(t, err)
+		require.Equal(t, 200, code)
+		RequireEqualJSON(t, []byte(goodResponse), res)
+	}
+
+	send("user_secret", "", "eth_chainId")
+	send("user_secret", "", "eth_chainId")
+	require.Len(t, goodBackend.Requests(), 1)
+
+	t.Run("directives of keys not allowed to send them are ignored", func(t *testing.T) {
+		goodBackend.Reset()
+		send("user_secret", "no-cache", "eth_chainId")
+		require.Len(t, goodBackend.Requests(), 0)
+	})
+
+	t.Run("no-cache bypasses the cache", func(t *testing.T) {
+		goodBackend.Reset()
+		send("support_secret", "no-cache", "eth_chainId")
+		require.Len(t, goodBackend.Requests(), 1)
+		send("support_secret", "", "eth_chainId")
+		require.Len(t, goodBackend.Requests(), 1)
+	})
+
+	t.Run("bypass_cache keys bypass the cache", func(t *testing.T) {
+		goodBackend.Reset()
+		send("monitor_secret", "", "eth_chainId")
+		require.Len(t, goodBackend.Requests(), 1)
+	})
+
+	t.Run("no-store does not cache responses", func(t *testing.T) {
+		goodBackend.Reset()
+		send("support_secret", "No-Cache, no-store", "net_version")
+		require.Len(t, goodBackend.Requests(), 1)
+		send("user_secret", "", "net_version")
+		require.Len(t, goodBackend.Requests(), 2)
+		send("user_secret", "", "net_version")
+		require.Len(t, goodBackend.Requests(), 2)
+	})
+}
@@ -0,0 +1,56 @@
+package integration_tests
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheMetrics(t *testing.T) {
+	goodBackend := NewMockBackend(BatchedResponseHandler(200, goodResponse))
+	defer goodBackend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+
+	config := ReadConfig("cache_metrics")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	post := func(body string) *http.Response {
+		res, err := http.Post("http://127.0.0.1:8545", "application/json", bytes.NewReader([]byte(body)))
+		require.NoError(t, err)
+		res.Body.Close()
+		require.Equal(t, 200, res.StatusCode)
+		return res
+	}
+	requireCache := func(res *http.Response, result string, status string) {
+		require.Equal(t, result, res.Header.Get(proxyd.CacheDebugHeader))
+		require.Equal(t, status, res.Header.Get("X-Proxyd-Cache-Status"))
+	}
+
+	getCode := `{"jsonrpc":"2.0","method":"eth_getCode","params":["0x0000000000000000000000000000000000000001","0x1"],"id":999}`
+	requireCache(post(getCode), proxyd.CacheResultMiss, "MISS")
+	requireCache(post(getCode), proxyd.CacheResultHit, "HIT")
+
+	// the expired entry is found, and the request forwarded
+	time.Sleep(600 * time.Millisecond)
+	requireCache(post(getCode), proxyd.CacheResultStale, "MISS")
+
+	batch := `[` + getCode + `,{"jsonrpc":"2.0","method":"eth_blockNumber","params":[],"id":1}]`
+	requireCache(post(batch), proxyd.CacheResultHit, "HIT")
+
+	cacheMetric := func(family string) float64 {
+		return metricValue(t, "proxyd_"+family, map[string]string{"method": "eth_getCode"})
+	}
+	require.Equal(t, float64(2), cacheMetric("cache_hits_total"))
+	require.Equal(t, float64(1), cacheMetric("cache_misses_total"))
+	require.Equal(t, float64(1), cacheMetric("cache_stale_total"))
+	// the cached result is "hello"
+	require.Equal(t, float64(2*len(`"hello"`)), cacheMetric("cache_saved_bytes_total"))
+}
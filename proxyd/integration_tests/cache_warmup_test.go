@@ -0,0 +1,112 @@
+package integration_tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/stretchr/testify/require"
+)
+
+// chainHandler serves a chain of 0x10 blocks, each with one transaction.
+func chainHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		panic(err)
+	}
+	var reqs []json.RawMessage
+	if proxyd.IsBatch(body) {
+		reqs, err = proxyd.ParseBatchRPCReq(body)
+		if err != nil {
+			panic(err)
+		}
+	} else {
+		reqs = []json.RawMessage{body}
+	}
+
+	out := make([]*proxyd.RPCRes, len(reqs))
+	for i, raw := range reqs {
+		req, err := proxyd.ParseRPCReq(raw)
+		if err != nil {
+			panic(err)
+		}
+		var params []interface{}
+		_ = json.Unmarshal(req.Params, &params)
+
+		var result interface{}
+		switch req.Method {
+		case "eth_blockNumber":
+			result = "0x10"
+		case "eth_gasPrice":
+			result = "0x3b9aca00"
+		case "eth_getBlockByNumber":
+			num, _ := hexutil.DecodeUint64(params[0].(string))
+			result = testChainBlock(num)
+		case "eth_getBlockByHash":
+			var num uint64
+			_, _ = fmt.Sscanf(params[0].(string), "0x%064x", &num)
+			result = testChainBlock(num)
+		case "eth_getTransactionReceipt":
+			result = map[string]string{"transactionHash": params[0].(string), "status": "0x1"}
+		}
+		out[i] = &proxyd.RPCRes{JSONRPC: proxyd.JSONRPCVersion, Result: result, ID: req.ID}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if proxyd.IsBatch(body) {
+		_ = json.NewEncoder(w).Encode(out)
+	} else {
+		_ = json.NewEncoder(w).Encode(out[0])
+	}
+}
+
+func testChainBlock(num uint64) map[string]interface{} {
+	return map[string]interface{}{
+		"number":       hexutil.EncodeUint64(num),
+		"hash":         fmt.Sprintf("0x%064x", num),
+		"transactions": []string{fmt.Sprintf("0x%064x", num+1000)},
+	}
+}
+
+func TestCacheWarmup(t *testing.T) {
+	goodBackend := NewMockBackend(http.HandlerFunc(chainHandler))
+	defer goodBackend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+
+	config := ReadConfig("cache_warmup")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	// one request each for the block number, the blocks and gas price, and
+	// the blocks by hash and receipts
+	require.Len(t, goodBackend.Requests(), 3)
+	goodBackend.Reset()
+
+	client := NewProxydClient("http://127.0.0.1:8545")
+	send := func(method string, params ...interface{}) {
+		if params == nil {
+			params = []interface{}{}
+		}
+		_, code, err := client.SendRPC(method, params)
+		require.NoError(t, err)
+		require.Equal(t, 200, code)
+	}
+
+	for num := uint64(0xe); num <= 0x10; num++ {
+		send("eth_getBlockByNumber", hexutil.EncodeUint64(num), false)
+		send("eth_getBlockByHash", fmt.Sprintf("0x%064x", num), false)
+		send("eth_getTransactionReceipt", fmt.Sprintf("0x%064x", num+1000))
+	}
+	send("eth_gasPrice")
+	require.Len(t, goodBackend.Requests(), 0)
+
+	send("eth_getBlockByNumber", "0xd", false)
+	require.Len(t, goodBackend.Requests(), 1)
+}
@@ -0,0 +1,68 @@
+package integration_tests
+
+import (
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCIDRRateLimit(t *testing.T) {
+	goodBackend := NewMockBackend(BatchedResponseHandler(200, goodResponse))
+	defer goodBackend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+
+	config := ReadConfig("cidr_rate_limit")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	clientFrom := func(ip string) *ProxydHTTPClient {
+		h := make(http.Header)
+		h.Set("X-Forwarded-For", ip)
+		return NewProxydClientWithHeaders("http://127.0.0.1:8545", h)
+	}
+
+	// start at the beginning of a rate limit window
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+
+	t.Run("exempt CIDRs", func(t *testing.T) {
+		for _, ip := range []string{"10.1.2.3", "2001:db8::1"} {
+			_, codes := spamReqs(t, clientFrom(ip), ethChainID, 429, 5)
+			require.Equal(t, 5, codes[200], ip)
+		}
+	})
+
+	t.Run("exempt IPs prepended to the header are ignored", func(t *testing.T) {
+		_, codes := spamReqs(t, clientFrom("10.1.2.3, 198.51.100.2"), ethChainID, 429, 3)
+		require.Equal(t, 1, codes[200])
+		require.Equal(t, 2, codes[429])
+	})
+
+	t.Run("global method overrides apply to exempt CIDRs", func(t *testing.T) {
+		_, codes := spamReqs(t, clientFrom("10.1.2.3"), "eth_baz", 429, 3)
+		require.Equal(t, 1, codes[200])
+		require.Equal(t, 2, codes[429])
+	})
+
+	t.Run("CIDR override", func(t *testing.T) {
+		_, codes := spamReqs(t, clientFrom("203.0.113.7"), ethChainID, 429, 5)
+		require.Equal(t, 3, codes[200])
+		require.Equal(t, 2, codes[429])
+
+		// IPs of the range are limited separately
+		_, code, err := clientFrom("203.0.113.8").SendRPC(ethChainID, nil)
+		require.NoError(t, err)
+		require.Equal(t, 200, code)
+	})
+
+	t.Run("other IPs get the base rate", func(t *testing.T) {
+		_, codes := spamReqs(t, clientFrom("198.51.100.1"), ethChainID, 429, 3)
+		require.Equal(t, 1, codes[200])
+		require.Equal(t, 2, codes[429])
+	})
+}
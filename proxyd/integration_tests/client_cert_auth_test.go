@@ -0,0 +1,148 @@
+package integration_tests
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/stretchr/testify/require"
+)
+
+// testCA issues client certificates.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T, caFile string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCA{cert: cert, key: key}
+}
+
+func (ca *testCA) issue(t *testing.T, cn string, dnsNames ...string) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestClientCertAuth(t *testing.T) {
+	goodBackend := NewMockBackend(BatchedResponseHandler(200, goodResponse))
+	defer goodBackend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	roots := writeSelfSignedCert(t, "proxyd", certFile, keyFile)
+	caFile := filepath.Join(dir, "ca.pem")
+	ca := newTestCA(t, caFile)
+
+	indexer := ca.issue(t, "indexer", "indexer.internal")
+	unmapped := ca.issue(t, "other", "other.internal")
+	byCN := ca.issue(t, "indexer.internal")
+
+	start := func(t *testing.T, mode string) {
+		config := ReadConfig("client_cert_auth")
+		config.Server.TLS.CertFile = certFile
+		config.Server.TLS.KeyFile = keyFile
+		config.Server.TLS.ClientAuth.CAFile = caFile
+		config.Server.TLS.ClientAuth.Mode = mode
+		_, shutdown, err := proxyd.Start(config)
+		require.NoError(t, err)
+		t.Cleanup(shutdown)
+	}
+	// call calls method at path with the client certificate cert, if any,
+	// returning the status and RPC error code of the response.
+	call := func(t *testing.T, cert *tls.Certificate, path string, method string) (int, int) {
+		tlsConfig := &tls.Config{RootCAs: roots}
+		if cert != nil {
+			tlsConfig.Certificates = []tls.Certificate{*cert}
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig, DisableKeepAlives: true}}
+		res, err := client.Post("https://127.0.0.1:8545"+path, "application/json", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"`+method+`"}`))
+		require.NoError(t, err)
+		defer res.Body.Close()
+		var out struct {
+			Error *proxyd.RPCErr `json:"error"`
+		}
+		if res.StatusCode != http.StatusUnauthorized {
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&out))
+		}
+		if out.Error != nil {
+			return res.StatusCode, out.Error.Code
+		}
+		return res.StatusCode, 0
+	}
+
+	t.Run("complement", func(t *testing.T) {
+		start(t, "")
+
+		// mapped certificates authenticate as their alias
+		status, _ := call(t, &indexer, "/", "eth_chainId")
+		require.Equal(t, http.StatusOK, status)
+		_, code := call(t, &indexer, "/", "eth_blockNumber")
+		require.Equal(t, proxyd.ErrMethodNotWhitelisted.Code, code)
+		status, _ = call(t, &byCN, "/", "eth_chainId")
+		require.Equal(t, http.StatusOK, status)
+
+		// others need the secret
+		status, _ = call(t, &unmapped, "/", "eth_chainId")
+		require.Equal(t, http.StatusUnauthorized, status)
+		status, _ = call(t, nil, "/", "eth_chainId")
+		require.Equal(t, http.StatusUnauthorized, status)
+		status, code = call(t, nil, "/secret", "eth_blockNumber")
+		require.Equal(t, http.StatusOK, status)
+		require.Zero(t, code)
+	})
+
+	t.Run("replace", func(t *testing.T) {
+		start(t, proxyd.ClientCertAuthReplace)
+
+		status, _ := call(t, &indexer, "/", "eth_chainId")
+		require.Equal(t, http.StatusOK, status)
+		status, _ = call(t, nil, "/secret", "eth_chainId")
+		require.Equal(t, http.StatusUnauthorized, status)
+		status, _ = call(t, &unmapped, "/secret", "eth_chainId")
+		require.Equal(t, http.StatusUnauthorized, status)
+	})
+}
@@ -0,0 +1,135 @@
+package integration_tests
+
+import (
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConditionalTx(t *testing.T) {
+	goodBackend := NewMockBackend(SingleResponseHandler(200, dummyRes))
+	defer goodBackend.Close()
+	sequencerBackend := NewMockBackend(SingleResponseHandler(200, dummyRes))
+	defer sequencerBackend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+	require.NoError(t, os.Setenv("SEQUENCER_BACKEND_RPC_URL", sequencerBackend.URL()))
+
+	config := ReadConfig("conditional_tx")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	to := common.HexToAddress("0x1234")
+	tx, err := types.SignNewTx(key, types.LatestSignerForChainID(big.NewInt(420)), &types.DynamicFeeTx{
+		ChainID:   big.NewInt(420),
+		GasTipCap: big.NewInt(1),
+		GasFeeCap: big.NewInt(1),
+		Gas:       21000,
+		To:        &to,
+	})
+	require.NoError(t, err)
+	data, err := tx.MarshalBinary()
+	require.NoError(t, err)
+	rawTx := hexutil.Encode(data)
+
+	root := common.HexToHash("0x01").Hex()
+	slot := common.HexToHash("0x02").Hex()
+	tests := []struct {
+		name string
+		path string
+		opts string
+		code int
+		res  string
+	}{
+		{
+			"valid",
+			"partner_secret",
+			fmt.Sprintf(`{"knownAccounts":{"0x000000000000000000000000000000000000dEaD":"%s"},"blockNumberMin":"0x1","blockNumberMax":"0x2"}`, root),
+			200,
+			dummyRes,
+		},
+		{
+			"valid storage slots",
+			"partner_secret",
+			fmt.Sprintf(`{"knownAccounts":{"0x000000000000000000000000000000000000dEaD":{"%s":"%s"}},"timestampMax":"0x10"}`, slot, root),
+			200,
+			dummyRes,
+		},
+		{
+			"not allowed auth key",
+			"other_secret",
+			`{"knownAccounts":{}}`,
+			403,
+			`{"error":{"code":-32027,"message":"conditional transactions not allowed"},"id":1,"jsonrpc":"2.0"}`,
+		},
+		{
+			"no auth key",
+			"",
+			`{"knownAccounts":{}}`,
+			401,
+			"",
+		},
+		{
+			"unknown field",
+			"partner_secret",
+			`{"knownAccounts":{},"foo":1}`,
+			400,
+			`{"error":{"code":-32602,"message":"invalid conditional options: json: unknown field \"foo\""},"id":1,"jsonrpc":"2.0"}`,
+		},
+		{
+			"invalid block range",
+			"partner_secret",
+			`{"knownAccounts":{},"blockNumberMin":"0x2","blockNumberMax":"0x1"}`,
+			400,
+			`{"error":{"code":-32602,"message":"blockNumberMin is greater than blockNumberMax"},"id":1,"jsonrpc":"2.0"}`,
+		},
+		{
+			"invalid known account",
+			"partner_secret",
+			`{"knownAccounts":{"0x000000000000000000000000000000000000dEaD":"0x01"}}`,
+			400,
+			`{"error":{"code":-32602,"message":"invalid known account 0x000000000000000000000000000000000000dEaD"},"id":1,"jsonrpc":"2.0"}`,
+		},
+		{
+			"cost too high",
+			"partner_secret",
+			fmt.Sprintf(`{"knownAccounts":{"0x000000000000000000000000000000000000dEaD":{"%s":"%s","%s":"%s"},"0x0000000000000000000000000000000000001234":"%s"}}`, slot, root, root, root, root),
+			400,
+			`{"error":{"code":-32602,"message":"conditional cost too high: have 3, maximum 2"},"id":1,"jsonrpc":"2.0"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			goodBackend.Reset()
+			sequencerBackend.Reset()
+			client := NewProxydClient("http://127.0.0.1:8545/" + tt.path)
+			res, code, err := client.SendRequest([]byte(fmt.Sprintf(
+				`{"jsonrpc":"2.0","method":"eth_sendRawTransactionConditional","params":["%s",%s],"id":1}`,
+				rawTx, tt.opts,
+			)))
+			require.NoError(t, err)
+			require.Equal(t, tt.code, code)
+			if tt.res != "" {
+				RequireEqualJSON(t, []byte(tt.res), res)
+			}
+			require.Equal(t, 0, len(goodBackend.Requests()))
+			if code == http.StatusOK {
+				require.Equal(t, 1, len(sequencerBackend.Requests()))
+			} else {
+				require.Equal(t, 0, len(sequencerBackend.Requests()))
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package integration_tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/stretchr/testify/require"
+)
+
+const proposedLintConfig = `
+[rpc_method_mappings]
+eth_chainId = "main"
+eth_blockNumber = "alt"
+
+[rate_limit]
+base_rate = 1000
+base_interval = "1s"
+
+[rate_limit.method_overrides.eth_chainId]
+limit = 1
+interval = "1m"
+`
+
+func TestConfigLint(t *testing.T) {
+	goodBackend := NewMockBackend(BatchedResponseHandler(200, goodResponse))
+	defer goodBackend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+
+	config := ReadConfig("config_lint")
+	client := NewProxydClient("http://127.0.0.1:8545")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	for _, method := range []string{"eth_chainId", "eth_chainId", "eth_blockNumber", "eth_getBalance"} {
+		_, code, err := client.SendRPC(method, nil)
+		require.NoError(t, err)
+		require.Equal(t, 200, code)
+	}
+	for _, method := range []string{"eth_getCode", "eth_getCode", "debug_traceTransaction", "not a method"} {
+		_, _, err := client.SendRPC(method, nil)
+		require.NoError(t, err)
+	}
+
+	adminReq := func(method string, path string, body []byte) *http.Response {
+		req, err := http.NewRequest(method, "http://127.0.0.1:8547"+path, bytes.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer admin-token")
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return res
+	}
+
+	t.Run("requires token", func(t *testing.T) {
+		res, err := http.Get("http://127.0.0.1:8547/traffic_profile")
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	})
+
+	t.Run("traffic profile", func(t *testing.T) {
+		res := adminReq("GET", "/traffic_profile", nil)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		var profile proxyd.TrafficProfile
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&profile))
+		require.Equal(t, uint64(2), profile.Methods["eth_chainId"].Requests)
+		require.Equal(t, uint64(1), profile.Methods["eth_blockNumber"].Requests)
+		require.Equal(t, uint64(1), profile.Methods["eth_getBalance"].Requests)
+	})
+
+	t.Run("lint config", func(t *testing.T) {
+		res := adminReq("POST", "/config/lint", []byte(proposedLintConfig))
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		var report proxyd.ConfigLintReport
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&report))
+		require.Len(t, report.Unmapped, 1)
+		require.Equal(t, "eth_getBalance", report.Unmapped[0].Method)
+		require.Equal(t, "main", report.Unmapped[0].From)
+		require.Len(t, report.Rerouted, 1)
+		require.Equal(t, "eth_blockNumber", report.Rerouted[0].Method)
+		require.Equal(t, "alt", report.Rerouted[0].To)
+		require.Len(t, report.RateLimited, 1)
+		require.Equal(t, "eth_chainId", report.RateLimited[0].Method)
+		require.Equal(t, 1, report.RateLimited[0].Clients)
+	})
+
+	t.Run("method mapping suggestions", func(t *testing.T) {
+		res := adminReq("GET", "/method_mappings/suggestions", nil)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		var suggestions proxyd.MethodMappingSuggestions
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&suggestions))
+		require.Len(t, suggestions.Suggestions, 2)
+		require.Equal(t, &proxyd.MethodMappingSuggestion{
+			Method:   "eth_getCode",
+			Requests: 2,
+			Group:    "main",
+			Reason:   "namespace",
+		}, suggestions.Suggestions[0])
+		require.Equal(t, "debug_traceTransaction", suggestions.Suggestions[1].Method)
+		require.Equal(t, "default", suggestions.Suggestions[1].Reason)
+		require.Equal(t, " [rpc_method_mappings]\n+eth_getCode = \"main\"\n+debug_traceTransaction = \"main\"\n", suggestions.Diff)
+		require.Empty(t, suggestions.Unused)
+
+		res = adminReq("GET", "/method_mappings/suggestions?min_requests=2", nil)
+		defer res.Body.Close()
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&suggestions))
+		require.Len(t, suggestions.Suggestions, 1)
+	})
+
+	t.Run("invalid config", func(t *testing.T) {
+		res := adminReq("POST", "/config/lint", []byte("not toml ["))
+		defer res.Body.Close()
+		require.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+}
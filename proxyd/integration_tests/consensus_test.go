@@ -289,8 +289,8 @@ func TestConsensus(t *testing.T) {
 		useOnlyNode1()
 
 		// replace node1 handler with one that always returns 500
-		oldHandler := nodes["node1"].mockBackend.handler
-		defer func() { nodes["node1"].mockBackend.handler = oldHandler }()
+		oldHandler := nodes["node1"].mockBackend.Handler()
+		defer nodes["node1"].mockBackend.SetHandler(oldHandler)
 
 		nodes["node1"].mockBackend.SetHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(503)
@@ -606,6 +606,40 @@ func TestConsensus(t *testing.T) {
 		require.GreaterOrEqual(t, len(nodes["node2"].mockBackend.Requests()), 50, msg)
 	})
 
+	t.Run("load balancing should not hit backends lagging over the budget", func(t *testing.T) {
+		reset()
+		// node2 is 3 blocks ahead of node1, over the budget of eth_syncing
+		overrideBlock("node2", "latest", "0x104")
+		update()
+
+		// methods without a budget are served by the whole consensus group
+		require.Equal(t, 2, len(bg.Consensus.GetConsensusGroup()))
+		require.Equal(t, []*proxyd.Backend{nodes["node2"].backend}, bg.Consensus.GetConsensusGroupWithinLag(2))
+
+		nodes["node1"].mockBackend.Reset()
+		nodes["node2"].mockBackend.Reset()
+
+		for i := 0; i < 10; i++ {
+			_, statusCode, err := client.SendRPC("eth_syncing", nil)
+			require.NoError(t, err)
+			require.Equal(t, 200, statusCode)
+		}
+		require.Equal(t, 0, len(nodes["node1"].mockBackend.Requests()))
+		require.Equal(t, 10, len(nodes["node2"].mockBackend.Requests()))
+
+		// the budget of a batch is the tightest of its methods
+		nodes["node2"].mockBackend.Reset()
+		for i := 0; i < 10; i++ {
+			_, statusCode, err := client.SendBatchRPC(
+				NewRPCReq("1", "eth_getBlockByNumber", []interface{}{"0x101", false}),
+				NewRPCReq("2", "eth_syncing", nil))
+			require.NoError(t, err)
+			require.Equal(t, 200, statusCode)
+		}
+		require.Equal(t, 0, len(nodes["node1"].mockBackend.Requests()))
+		require.Equal(t, 10, len(nodes["node2"].mockBackend.Requests()))
+	})
+
 	t.Run("load balancing should not hit if node is not healthy", func(t *testing.T) {
 		reset()
 		useOnlyNode1()
@@ -636,8 +670,8 @@ func TestConsensus(t *testing.T) {
 		useOnlyNode1()
 
 		// replace node1 handler with one that adds a 500ms delay
-		oldHandler := nodes["node1"].mockBackend.handler
-		defer func() { nodes["node1"].mockBackend.handler = oldHandler }()
+		oldHandler := nodes["node1"].mockBackend.Handler()
+		defer nodes["node1"].mockBackend.SetHandler(oldHandler)
 
 		nodes["node1"].mockBackend.SetHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			time.Sleep(500 * time.Millisecond)
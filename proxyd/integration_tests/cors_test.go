@@ -0,0 +1,78 @@
+package integration_tests
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCORS(t *testing.T) {
+	goodBackend := NewMockBackend(BatchedResponseHandler(200, goodResponse))
+	defer goodBackend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+
+	config := ReadConfig("cors")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	preflight := func(t *testing.T, path string, origin string) *http.Response {
+		req, err := http.NewRequest(http.MethodOptions, "http://127.0.0.1:8545"+path, nil)
+		require.NoError(t, err)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", "POST")
+		req.Header.Set("Access-Control-Request-Headers", "content-type,authorization")
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		return res
+	}
+
+	t.Run("preflight", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			path    string
+			origin  string
+			allowed bool
+		}{
+			{"allowed origin", "/backend_secret", "https://wallet.io", true},
+			{"wildcard origin", "/backend_secret", "https://docs.example.com", true},
+			{"disallowed origin", "/backend_secret", "https://evil.io", false},
+			{"allowed by key", "/frontend_secret", "https://app.example.com", true},
+			{"disallowed by key", "/frontend_secret", "https://docs.example.com", false},
+			{"without key", "/", "https://docs.example.com", true},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				res := preflight(t, tt.path, tt.origin)
+				require.Equal(t, http.StatusNoContent, res.StatusCode)
+				if !tt.allowed {
+					require.Empty(t, res.Header.Get("Access-Control-Allow-Origin"))
+					return
+				}
+				require.Equal(t, tt.origin, res.Header.Get("Access-Control-Allow-Origin"))
+				require.Equal(t, "POST", res.Header.Get("Access-Control-Allow-Methods"))
+				require.Equal(t, "Content-Type, Authorization", res.Header.Get("Access-Control-Allow-Headers"))
+				require.Equal(t, "600", res.Header.Get("Access-Control-Max-Age"))
+			})
+		}
+	})
+
+	t.Run("request", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "http://127.0.0.1:8545/backend_secret", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"eth_chainId"}`))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Origin", "https://wallet.io")
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.Equal(t, "https://wallet.io", res.Header.Get("Access-Control-Allow-Origin"))
+		require.Contains(t, res.Header.Get("Access-Control-Expose-Headers"), "X-Ratelimit-Limit")
+	})
+}
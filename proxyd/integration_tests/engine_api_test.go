@@ -0,0 +1,84 @@
+package integration_tests
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEngineAPI(t *testing.T) {
+	nodeBackend := NewMockBackend(BatchedResponseHandler(200, goodResponse))
+	defer nodeBackend.Close()
+
+	secret := make([]byte, 32)
+	for i := range secret {
+		secret[i] = byte(i)
+	}
+	require.NoError(t, os.Setenv("NODE_BACKEND_RPC_URL", nodeBackend.URL()))
+	require.NoError(t, os.Setenv("ENGINE_JWT_SECRET", "0x"+hex.EncodeToString(secret)))
+
+	config := ReadConfig("engine_api")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	// requireEngineJWT checks that h authenticates to the Engine API with
+	// secret, as nodes do.
+	requireEngineJWT := func(t *testing.T, h http.Header) {
+		token, ok := strings.CutPrefix(h.Get("Authorization"), "Bearer ")
+		require.True(t, ok)
+		parts := strings.Split(token, ".")
+		require.Len(t, parts, 3)
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(parts[0] + "." + parts[1]))
+		require.Equal(t, base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), parts[2])
+		payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+		require.NoError(t, err)
+		var claims struct {
+			Iat int64 `json:"iat"`
+		}
+		require.NoError(t, json.Unmarshal(payload, &claims))
+		require.InDelta(t, time.Now().Unix(), claims.Iat, 5)
+	}
+
+	t.Run("authorized keys call the engine API", func(t *testing.T) {
+		nodeBackend.Reset()
+		client := NewProxydClient("http://127.0.0.1:8545/sequencer_secret")
+		res, code, err := client.SendRPC("engine_forkchoiceUpdatedV3", nil)
+		require.NoError(t, err)
+		require.Equal(t, 200, code)
+		RequireEqualJSON(t, []byte(goodResponse), res)
+
+		require.Len(t, nodeBackend.Requests(), 1)
+		requireEngineJWT(t, nodeBackend.Requests()[0].Headers)
+	})
+
+	t.Run("other keys are refused", func(t *testing.T) {
+		nodeBackend.Reset()
+		client := NewProxydClient("http://127.0.0.1:8545/user_secret")
+		res, code, err := client.SendRPC("engine_forkchoiceUpdatedV3", nil)
+		require.NoError(t, err)
+		require.Equal(t, 403, code)
+		var out proxyd.RPCRes
+		require.NoError(t, json.Unmarshal(res, &out))
+		require.Equal(t, proxyd.ErrMethodNotWhitelisted.Code, out.Error.Code)
+		require.Empty(t, nodeBackend.Requests())
+
+		// their other requests are signed too
+		_, code, err = client.SendRPC("eth_chainId", nil)
+		require.NoError(t, err)
+		require.Equal(t, 200, code)
+		require.Len(t, nodeBackend.Requests(), 1)
+		requireEngineJWT(t, nodeBackend.Requests()[0].Headers)
+	})
+}
@@ -0,0 +1,82 @@
+package integration_tests
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestETag(t *testing.T) {
+	goodBackend := NewMockBackend(BatchedResponseHandler(200, goodResponse))
+	defer goodBackend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+
+	config := ReadConfig("etag")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	post := func(body string, ifNoneMatch string) (*http.Response, []byte) {
+		req, err := http.NewRequest("POST", "http://127.0.0.1:8545", bytes.NewReader([]byte(body)))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		resBody, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res, resBody
+	}
+
+	single := `{"jsonrpc":"2.0","method":"eth_chainId","params":[],"id":999}`
+	res, _ := post(single, "")
+	require.Equal(t, 200, res.StatusCode)
+	require.Empty(t, res.Header.Get("ETag"))
+
+	res, body := post(single, "")
+	require.Equal(t, 200, res.StatusCode)
+	RequireEqualJSON(t, []byte(goodResponse), body)
+	etag := res.Header.Get("ETag")
+	require.NotEmpty(t, etag)
+
+	res, body = post(single, etag)
+	require.Equal(t, 304, res.StatusCode)
+	require.Empty(t, body)
+	require.Equal(t, etag, res.Header.Get("ETag"))
+
+	res, _ = post(single, `"stale", W/`+etag)
+	require.Equal(t, 304, res.StatusCode)
+
+	res, body = post(single, `"stale"`)
+	require.Equal(t, 200, res.StatusCode)
+	RequireEqualJSON(t, []byte(goodResponse), body)
+	require.Equal(t, etag, res.Header.Get("ETag"))
+
+	t.Run("uncacheable responses get no ETag", func(t *testing.T) {
+		res, _ := post(`{"jsonrpc":"2.0","method":"eth_blockNumber","params":[],"id":999}`, "*")
+		require.Equal(t, 200, res.StatusCode)
+		require.Empty(t, res.Header.Get("ETag"))
+	})
+
+	t.Run("batches served from the cache get an ETag", func(t *testing.T) {
+		batch := "[" + single + "," + single + "]"
+		res, _ := post(batch, "")
+		require.Equal(t, 200, res.StatusCode)
+		batchETag := res.Header.Get("ETag")
+		require.NotEmpty(t, batchETag)
+		require.NotEqual(t, etag, batchETag)
+
+		res, body := post(batch, batchETag)
+		require.Equal(t, 304, res.StatusCode)
+		require.Empty(t, body)
+	})
+}
@@ -0,0 +1,140 @@
+package integration_tests
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"github.com/alicebob/miniredis"
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/stretchr/testify/require"
+)
+
+// filterChainHandler serves the blocks of a chain whose latest block is
+// latest. Logs are answered with the filter they were queried with.
+func filterChainHandler(t *testing.T, latest *atomic.Uint64) http.HandlerFunc {
+	respond := func(req *proxyd.RPCReq) *proxyd.RPCRes {
+		res := &proxyd.RPCRes{JSONRPC: proxyd.JSONRPCVersion, ID: req.ID}
+		switch req.Method {
+		case "eth_blockNumber":
+			res.Result = hexutil.EncodeUint64(latest.Load())
+		case "eth_getBlockByNumber":
+			var params []interface{}
+			require.NoError(t, json.Unmarshal(req.Params, &params))
+			n, err := hexutil.DecodeUint64(params[0].(string))
+			require.NoError(t, err)
+			if n <= latest.Load() {
+				res.Result = map[string]string{"number": params[0].(string), "hash": "hash_" + params[0].(string)}
+			}
+		case "eth_getLogs":
+			var params []map[string]interface{}
+			require.NoError(t, json.Unmarshal(req.Params, &params))
+			res.Result = []interface{}{params[0]}
+		default:
+			t.Fatalf("unexpected method %s", req.Method)
+		}
+		return res
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		if !proxyd.IsBatch(body) {
+			req, err := proxyd.ParseRPCReq(body)
+			require.NoError(t, err)
+			require.NoError(t, json.NewEncoder(w).Encode(respond(req)))
+			return
+		}
+		var reqs []*proxyd.RPCReq
+		require.NoError(t, json.Unmarshal(body, &reqs))
+		out := make([]*proxyd.RPCRes, len(reqs))
+		for i, req := range reqs {
+			out[i] = respond(req)
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(out))
+	}
+}
+
+func TestFilterEmulation(t *testing.T) {
+	redis, err := miniredis.Run()
+	require.NoError(t, err)
+	defer redis.Close()
+
+	var latest atomic.Uint64
+	latest.Store(0x10)
+	handler := filterChainHandler(t, &latest)
+	first := NewMockBackend(handler)
+	defer first.Close()
+	second := NewMockBackend(handler)
+	defer second.Close()
+
+	require.NoError(t, os.Setenv("REDIS_URL", "redis://"+redis.Addr()))
+	require.NoError(t, os.Setenv("FIRST_BACKEND_RPC_URL", first.URL()))
+	require.NoError(t, os.Setenv("SECOND_BACKEND_RPC_URL", second.URL()))
+
+	config := ReadConfig("filter_emulation")
+	client := NewProxydClient("http://127.0.0.1:8545")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	call := func(method string, params ...interface{}) *proxyd.RPCRes {
+		if params == nil {
+			params = []interface{}{}
+		}
+		body, _, err := client.SendRPC(method, params)
+		require.NoError(t, err)
+		var res proxyd.RPCRes
+		require.NoError(t, json.Unmarshal(body, &res))
+		return &res
+	}
+
+	t.Run("block filter", func(t *testing.T) {
+		latest.Store(0x10)
+		id := call("eth_newBlockFilter").Result.(string)
+		require.True(t, redis.Exists("filter:"+id))
+
+		require.Equal(t, []interface{}{}, call("eth_getFilterChanges", id).Result)
+
+		latest.Store(0x12)
+		require.Equal(t, []interface{}{"hash_0x11", "hash_0x12"}, call("eth_getFilterChanges", id).Result)
+		require.Equal(t, []interface{}{}, call("eth_getFilterChanges", id).Result)
+
+		require.Equal(t, true, call("eth_uninstallFilter", id).Result)
+		res := call("eth_getFilterChanges", id)
+		require.NotNil(t, res.Error)
+		require.Equal(t, "filter not found", res.Error.Message)
+	})
+
+	t.Run("logs filter", func(t *testing.T) {
+		latest.Store(0x20)
+		criteria := map[string]interface{}{"address": "0x0000000000000000000000000000000000000001"}
+		id := call("eth_newFilter", criteria).Result.(string)
+
+		latest.Store(0x22)
+		changes := call("eth_getFilterChanges", id).Result.([]interface{})
+		require.Len(t, changes, 1)
+		require.Equal(t, map[string]interface{}{
+			"address":   "0x0000000000000000000000000000000000000001",
+			"fromBlock": "0x21",
+			"toBlock":   "0x22",
+		}, changes[0])
+
+		// the filter logs are queried with the criteria of the filter
+		logs := call("eth_getFilterLogs", id).Result.([]interface{})
+		require.Equal(t, criteria, logs[0])
+
+		// block filters have no logs
+		blockID := call("eth_newBlockFilter").Result.(string)
+		require.NotNil(t, call("eth_getFilterLogs", blockID).Error)
+	})
+
+	t.Run("invalid filters", func(t *testing.T) {
+		res := call("eth_newFilter", map[string]interface{}{"blockHash": "0x01"})
+		require.NotNil(t, res.Error)
+		require.NotNil(t, call("eth_getFilterChanges").Error)
+	})
+}
@@ -0,0 +1,111 @@
+package integration_tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGameDayOutages(t *testing.T) {
+	primary := NewMockBackend(BatchedResponseHandler(200, goodResponse))
+	defer primary.Close()
+	secondary := NewMockBackend(BatchedResponseHandler(200, goodResponse))
+	defer secondary.Close()
+
+	require.NoError(t, os.Setenv("PRIMARY_BACKEND_RPC_URL", primary.URL()))
+	require.NoError(t, os.Setenv("SECONDARY_BACKEND_RPC_URL", secondary.URL()))
+
+	config := ReadConfig("gameday")
+	client := NewProxydClient("http://127.0.0.1:8545")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	adminReq := func(method string, body string) (int, []*proxyd.AdminOutage) {
+		req, err := http.NewRequest(method, "http://127.0.0.1:8547/gameday/outages", bytes.NewReader([]byte(body)))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer admin-token")
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		var outages []*proxyd.AdminOutage
+		if res.StatusCode == 200 {
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&outages))
+		}
+		return res.StatusCode, outages
+	}
+	requireServedBy := func(backend *MockBackend) {
+		primary.Reset()
+		secondary.Reset()
+		_, code, err := client.SendRPC("eth_chainId", nil)
+		require.NoError(t, err)
+		require.Equal(t, 200, code)
+		require.Len(t, backend.Requests(), 1)
+	}
+
+	requireServedBy(primary)
+
+	t.Run("backend outage", func(t *testing.T) {
+		code, outages := adminReq("POST", `{"backend": "primary", "duration": "1m"}`)
+		require.Equal(t, 200, code)
+		require.Len(t, outages, 1)
+		require.Equal(t, "primary", outages[0].Backend)
+		require.WithinDuration(t, time.Now().Add(time.Minute), outages[0].Until, 5*time.Second)
+		requireServedBy(secondary)
+
+		code, outages = adminReq("GET", "")
+		require.Equal(t, 200, code)
+		require.Len(t, outages, 1)
+
+		code, outages = adminReq("DELETE", "")
+		require.Equal(t, 200, code)
+		require.Empty(t, outages)
+		requireServedBy(primary)
+	})
+
+	t.Run("group outage", func(t *testing.T) {
+		code, outages := adminReq("POST", `{"group": "main", "duration": "1m"}`)
+		require.Equal(t, 200, code)
+		require.Len(t, outages, 2)
+		_, code, err := client.SendRPC("eth_chainId", nil)
+		require.NoError(t, err)
+		require.Equal(t, 503, code)
+
+		code, outages = adminReq("DELETE", `{"backend": "secondary"}`)
+		require.Equal(t, 200, code)
+		require.Len(t, outages, 1)
+		requireServedBy(secondary)
+		adminReq("DELETE", "")
+	})
+
+	t.Run("outages expire", func(t *testing.T) {
+		code, _ := adminReq("POST", `{"backend": "primary", "duration": "200ms"}`)
+		require.Equal(t, 200, code)
+		requireServedBy(secondary)
+		time.Sleep(300 * time.Millisecond)
+		requireServedBy(primary)
+		_, outages := adminReq("GET", "")
+		require.Empty(t, outages)
+	})
+
+	t.Run("invalid requests", func(t *testing.T) {
+		code, _ := adminReq("POST", `{"backend": "primary", "duration": "2h"}`)
+		require.Equal(t, 400, code)
+		code, _ = adminReq("POST", `{"backend": "primary"}`)
+		require.Equal(t, 400, code)
+		code, _ = adminReq("POST", `{"duration": "1m"}`)
+		require.Equal(t, 400, code)
+		code, _ = adminReq("POST", `{"backend": "primary", "group": "main", "duration": "1m"}`)
+		require.Equal(t, 400, code)
+		code, _ = adminReq("POST", `{"backend": "unknown", "duration": "1m"}`)
+		require.Equal(t, 404, code)
+		code, _ = adminReq("POST", `{"group": "unknown", "duration": "1m"}`)
+		require.Equal(t, 404, code)
+	})
+}
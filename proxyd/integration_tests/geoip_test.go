@@ -0,0 +1,195 @@
+package integration_tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/gorilla/websocket"
+	"github.com/maxmind/mmdbwriter"
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+// mmdbNetwork is a network of a MaxMind DB and its record.
+type mmdbNetwork struct {
+	cidr   string
+	record mmdbtype.Map
+}
+
+// writeMMDB writes an IPv6 MaxMind DB holding networks to path.
+func writeMMDB(t *testing.T, path string, networks []mmdbNetwork) {
+	w, err := mmdbwriter.New(mmdbwriter.Options{
+		DatabaseType:            "Test",
+		IncludeReservedNetworks: true,
+	})
+	require.NoError(t, err)
+	for _, network := range networks {
+		_, ipNet, err := net.ParseCIDR(network.cidr)
+		require.NoError(t, err)
+		require.NoError(t, w.Insert(ipNet, network.record))
+	}
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	defer f.Close()
+	_, err = w.WriteTo(f)
+	require.NoError(t, err)
+}
+
+func country(code string) mmdbtype.Map {
+	return mmdbtype.Map{
+		"country": mmdbtype.Map{"iso_code": mmdbtype.String(code)},
+	}
+}
+
+// geoIPDecisions returns the count of decision on requests from country
+// made with auth.
+func geoIPDecisions(t *testing.T, decision, country, auth string) float64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != "proxyd_geoip_decisions_total" {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			labels := make(map[string]string)
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			if labels["decision"] == decision && labels["country"] == country && labels["auth"] == auth {
+				return m.GetCounter().GetValue()
+			}
+		}
+	}
+	return 0
+}
+
+func TestGeoIP(t *testing.T) {
+	goodBackend := NewMockBackend(BatchedResponseHandler(200, goodResponse))
+	defer goodBackend.Close()
+	wsBackend := NewMockWSBackend(nil, func(conn *websocket.Conn, msgType int, data []byte) {
+		req, err := proxyd.ParseRPCReq(data)
+		require.NoError(t, err)
+		_ = conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":%s,"result":"0x1"}`, req.ID)))
+	}, nil)
+	defer wsBackend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+	require.NoError(t, os.Setenv("GOOD_BACKEND_WS_URL", wsBackend.URL()))
+
+	dir := t.TempDir()
+	countryDB := filepath.Join(dir, "country.mmdb")
+	writeMMDB(t, countryDB, []mmdbNetwork{
+		{"1.1.1.0/24", country("KP")},
+		{"2.2.2.0/24", country("US")},
+		{"3.3.3.0/24", country("FR")},
+		{"2001:db8::/32", country("KP")},
+	})
+	asnDB := filepath.Join(dir, "asn.mmdb")
+	writeMMDB(t, asnDB, []mmdbNetwork{
+		{"2.2.2.0/25", mmdbtype.Map{
+			"autonomous_system_number":       mmdbtype.Uint32(64500),
+			"autonomous_system_organization": mmdbtype.String("Example"),
+		}},
+	})
+
+	config := ReadConfig("geoip")
+	config.GeoIP.CountryDatabase = countryDB
+	config.GeoIP.ASNDatabase = asnDB
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	send := func(t *testing.T, secret, ip, method string) (int, *proxyd.RPCRes) {
+		h := make(http.Header)
+		h.Set("X-Forwarded-For", ip)
+		client := NewProxydClientWithHeaders("http://127.0.0.1:8545/"+secret, h)
+		res, code, err := client.SendRPC(method, nil)
+		require.NoError(t, err)
+		out := new(proxyd.RPCRes)
+		require.NoError(t, json.Unmarshal(res, out))
+		return code, out
+	}
+
+	t.Run("blocked countries", func(t *testing.T) {
+		for _, ip := range []string{"1.1.1.1", "2001:db8::1"} {
+			code, res := send(t, "public_secret", ip, "eth_chainId")
+			require.Equal(t, 403, code, ip)
+			require.Equal(t, proxyd.ErrGeoBlocked.Code, res.Error.Code)
+		}
+		require.Equal(t, float64(2), geoIPDecisions(t, proxyd.GeoIPDecisionBlocked, "KP", "public"))
+
+		code, _ := send(t, "public_secret", "4.4.4.4", "eth_chainId")
+		require.Equal(t, 200, code)
+
+		// the client can't pick its IP by prepending an allowed one
+		code, _ = send(t, "public_secret", "4.4.4.4, 1.1.1.1", "eth_chainId")
+		require.Equal(t, 403, code)
+	})
+
+	t.Run("methods blocked for an asn", func(t *testing.T) {
+		code, _ := send(t, "public_secret", "2.2.2.1", "eth_chainId")
+		require.Equal(t, 200, code)
+		code, res := send(t, "public_secret", "2.2.2.1", "eth_sendRawTransaction")
+		require.Equal(t, 403, code)
+		require.Equal(t, proxyd.ErrGeoBlocked.Code, res.Error.Code)
+
+		// the rest of the country isn't in the asn
+		code, _ = send(t, "public_secret", "2.2.2.200", "eth_sendRawTransaction")
+		require.Equal(t, 200, code)
+	})
+
+	t.Run("rate limited countries", func(t *testing.T) {
+		// start at the beginning of a rate limit window
+		time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+		codes := make(map[int]int)
+		for i := 0; i < 4; i++ {
+			code, _ := send(t, "public_secret", "3.3.3.3", "eth_chainId")
+			codes[code]++
+		}
+		require.Equal(t, map[int]int{200: 2, 429: 2}, codes)
+		require.Equal(t, float64(2), geoIPDecisions(t, proxyd.GeoIPDecisionRateLimited, "FR", "public"))
+
+		// the limit is per client IP
+		code, _ := send(t, "public_secret", "3.3.3.4", "eth_chainId")
+		require.Equal(t, 200, code)
+	})
+
+	t.Run("auth key overrides", func(t *testing.T) {
+		code, _ := send(t, "partner_secret", "1.1.1.1", "eth_chainId")
+		require.Equal(t, 200, code)
+
+		code, _ = send(t, "eu_secret", "1.1.1.1", "eth_chainId")
+		require.Equal(t, 200, code)
+		code, _ = send(t, "eu_secret", "2.2.2.200", "eth_chainId")
+		require.Equal(t, 403, code)
+		require.Equal(t, float64(1), geoIPDecisions(t, proxyd.GeoIPDecisionBlocked, "US", "eu"))
+	})
+
+	t.Run("ws", func(t *testing.T) {
+		call := func(t *testing.T, ip string) map[string]interface{} {
+			h := make(http.Header)
+			h.Set("X-Forwarded-For", ip)
+			conn, _, err := websocket.DefaultDialer.Dial("ws://127.0.0.1:8546/public_secret", h) // nolint:bodyclose
+			require.NoError(t, err)
+			defer conn.Close()
+			require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(`{"jsonrpc":"2.0","id":1,"method":"eth_chainId"}`)))
+			require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+			var res map[string]interface{}
+			require.NoError(t, conn.ReadJSON(&res))
+			return res
+		}
+
+		res := call(t, "1.1.1.1")
+		require.Equal(t, float64(proxyd.ErrGeoBlocked.Code), res["error"].(map[string]interface{})["code"])
+		res = call(t, "4.4.4.4")
+		require.Equal(t, "0x1", res["result"])
+	})
+}
@@ -0,0 +1,136 @@
+package integration_tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetLogsLimits(t *testing.T) {
+	logsRes := `{"jsonrpc":"2.0","result":[{"logIndex":"0x0"},{"logIndex":"0x1"},{"logIndex":"0x2"}],"id":999}`
+	goodBackend := NewMockBackend(SingleResponseHandler(200, logsRes))
+	defer goodBackend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+
+	config := ReadConfig("get_logs_limits")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	tests := []struct {
+		name      string
+		path      string
+		filter    map[string]interface{}
+		res       string
+		code      int
+		forwarded bool
+	}{
+		{
+			name:   "block range",
+			path:   "default_secret",
+			filter: map[string]interface{}{"fromBlock": "0x0", "toBlock": "0x65"},
+			res:    `{"jsonrpc":"2.0","error":{"code":-32602,"message":"block range of 101 blocks, maximum 100"},"id":999}`,
+			code:   400,
+		},
+		{
+			name:   "addresses",
+			path:   "default_secret",
+			filter: map[string]interface{}{"fromBlock": "0x0", "toBlock": "0x1", "address": []string{"0x1", "0x2", "0x3"}},
+			res:    `{"jsonrpc":"2.0","error":{"code":-32602,"message":"filter has 3 addresses, maximum 2"},"id":999}`,
+			code:   400,
+		},
+		{
+			name:   "topics",
+			path:   "default_secret",
+			filter: map[string]interface{}{"fromBlock": "0x0", "toBlock": "0x1", "topics": []interface{}{[]string{"0x1", "0x2"}, nil, []string{"0x3", "0x4"}}},
+			res:    `{"jsonrpc":"2.0","error":{"code":-32602,"message":"filter has 4 topics, maximum 3"},"id":999}`,
+			code:   400,
+		},
+		{
+			name:      "logs",
+			path:      "default_secret",
+			filter:    map[string]interface{}{"fromBlock": "0x0", "toBlock": "0x10"},
+			res:       `{"jsonrpc":"2.0","error":{"code":-32029,"message":"query returned more than 2 logs, narrow your query: query a smaller block range, or filter by address and topics"},"id":999}`,
+			code:      400,
+			forwarded: true,
+		},
+		{
+			name:      "auth key override",
+			path:      "archive_secret",
+			filter:    map[string]interface{}{"fromBlock": "0x0", "toBlock": "0x3e8"},
+			res:       logsRes,
+			code:      200,
+			forwarded: true,
+		},
+		{
+			name:   "auth key block range",
+			path:   "archive_secret",
+			filter: map[string]interface{}{"fromBlock": "0x0", "toBlock": "0x3e9"},
+			res:    `{"jsonrpc":"2.0","error":{"code":-32602,"message":"block range of 1001 blocks, maximum 1000"},"id":999}`,
+			code:   400,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			goodBackend.Reset()
+			client := NewProxydClient("http://127.0.0.1:8545/" + tt.path)
+			res, code, err := client.SendRPC("eth_getLogs", []interface{}{tt.filter})
+			require.NoError(t, err)
+			require.Equal(t, tt.code, code)
+			RequireEqualJSON(t, []byte(tt.res), res)
+			require.Equal(t, tt.forwarded, len(goodBackend.Requests()) == 1)
+		})
+	}
+}
+
+func TestGetLogsRangeSplitting(t *testing.T) {
+	// each sub-range has a single log, at its first block
+	goodBackend := NewMockBackend(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		var req struct {
+			Params []map[string]string `json:"params"`
+			ID     json.RawMessage     `json:"id"`
+		}
+		require.NoError(t, json.Unmarshal(body, &req))
+		_, _ = fmt.Fprintf(w, `{"jsonrpc":"2.0","result":[{"blockNumber":%q}],"id":%s}`, req.Params[0]["fromBlock"], req.ID)
+	}))
+	defer goodBackend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+
+	config := ReadConfig("get_logs_limits")
+	config.GetLogsLimits.SplitRanges = true
+	config.GetLogsLimits.MaxSplits = 3
+	config.GetLogsLimits.MaxLogs = 0
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	client := NewProxydClient("http://127.0.0.1:8545/default_secret")
+
+	t.Run("merges sub-ranges in order", func(t *testing.T) {
+		goodBackend.Reset()
+		res, code, err := client.SendRPC("eth_getLogs", []interface{}{map[string]interface{}{"fromBlock": "0x32", "toBlock": "0xfa", "address": "0x1"}})
+		require.NoError(t, err)
+		require.Equal(t, 200, code)
+		RequireEqualJSON(t, []byte(`{"jsonrpc":"2.0","result":[{"blockNumber":"0x32"},{"blockNumber":"0x64"},{"blockNumber":"0xc8"}],"id":999}`), res)
+		require.Equal(t, 3, len(goodBackend.Requests()))
+	})
+
+	t.Run("rejects ranges over the maximum splits", func(t *testing.T) {
+		goodBackend.Reset()
+		res, code, err := client.SendRPC("eth_getLogs", []interface{}{map[string]interface{}{"fromBlock": "0x0", "toBlock": "0x12c"}})
+		require.NoError(t, err)
+		require.Equal(t, 400, code)
+		RequireEqualJSON(t, []byte(`{"jsonrpc":"2.0","error":{"code":-32602,"message":"block range of 300 blocks, maximum 100"},"id":999}`), res)
+		require.Equal(t, 0, len(goodBackend.Requests()))
+	})
+}
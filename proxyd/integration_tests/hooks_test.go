@@ -0,0 +1,135 @@
+package integration_tests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHooks(t *testing.T) {
+	goodBackend := NewMockBackend(BatchedResponseHandler(200, goodResponse))
+	defer goodBackend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+
+	var responses atomic.Int64
+	config := ReadConfig("hooks")
+	_, shutdown, err := proxyd.Start(config,
+		proxyd.WithHTTPMiddleware(func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodPost && r.Header.Get("X-Tenant") == "" {
+					http.Error(w, "missing tenant", http.StatusUnauthorized)
+					return
+				}
+				next.ServeHTTP(w, r)
+			})
+		}),
+		proxyd.WithRequestHook(func(ctx context.Context, req *proxyd.RPCReq) *proxyd.RPCRes {
+			if req.Method == "eth_blockNumber" {
+				return proxyd.NewRPCErrorRes(req.ID, proxyd.ErrMethodNotWhitelisted)
+			}
+			return nil
+		}),
+		proxyd.WithRequestHook(func(ctx context.Context, req *proxyd.RPCReq) *proxyd.RPCRes {
+			if req.Method == "eth_getChainId" {
+				req.Method = "eth_chainId"
+			}
+			return nil
+		}),
+		proxyd.WithResponseHook(func(ctx context.Context, req *proxyd.RPCReq, res *proxyd.RPCRes) *proxyd.RPCRes {
+			responses.Add(1)
+			return res
+		}),
+	)
+	require.NoError(t, err)
+	defer shutdown()
+
+	t.Run("HTTP middleware", func(t *testing.T) {
+		client := NewProxydClient("http://127.0.0.1:8545")
+		_, code, err := client.SendRPC("eth_chainId", nil)
+		require.NoError(t, err)
+		require.Equal(t, 401, code)
+	})
+
+	client := NewProxydClientWithHeaders("http://127.0.0.1:8545", http.Header{"X-Tenant": {"a"}})
+
+	t.Run("request hooks", func(t *testing.T) {
+		goodBackend.Reset()
+		res, code, err := client.SendRPC("eth_blockNumber", nil)
+		require.NoError(t, err)
+		require.Equal(t, 403, code)
+		RequireEqualJSON(t, []byte(`{"jsonrpc":"2.0","error":{"code":-32001,"message":"rpc method is not whitelisted"},"id":999}`), res)
+		require.Equal(t, 0, len(goodBackend.Requests()))
+
+		res, code, err = client.SendRPC("eth_getChainId", nil)
+		require.NoError(t, err)
+		require.Equal(t, 200, code)
+		RequireEqualJSON(t, []byte(goodResponse), res)
+		require.Equal(t, 1, len(goodBackend.Requests()))
+	})
+
+	t.Run("response hooks", func(t *testing.T) {
+		before := responses.Load()
+		_, _, err := client.SendBatchRPC(
+			NewRPCReq("1", "eth_chainId", nil),
+			NewRPCReq("2", "eth_blockNumber", nil),
+		)
+		require.NoError(t, err)
+		require.Equal(t, before+2, responses.Load())
+	})
+}
+
+func TestRegisteredMethods(t *testing.T) {
+	goodBackend := NewMockBackend(BatchedResponseHandler(200, goodResponse))
+	defer goodBackend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+
+	config := ReadConfig("hooks")
+	_, shutdown, err := proxyd.Start(config,
+		proxyd.WithMethod("internal_health", func(ctx context.Context, req *proxyd.RPCReq) (interface{}, error) {
+			return map[string]interface{}{"healthy": true}, nil
+		}),
+		proxyd.WithMethod("internal_invalid", func(ctx context.Context, req *proxyd.RPCReq) (interface{}, error) {
+			return nil, proxyd.ErrInvalidParams("bad tenant")
+		}),
+		proxyd.WithMethod("internal_broken", func(ctx context.Context, req *proxyd.RPCReq) (interface{}, error) {
+			return nil, errors.New("broken")
+		}),
+	)
+	require.NoError(t, err)
+	defer shutdown()
+
+	client := NewProxydClientWithHeaders("http://127.0.0.1:8545", http.Header{"X-Tenant": {"a"}})
+
+	res, code, err := client.SendRPC("internal_health", nil)
+	require.NoError(t, err)
+	require.Equal(t, 200, code)
+	RequireEqualJSON(t, []byte(`{"jsonrpc":"2.0","result":{"healthy":true},"id":999}`), res)
+
+	res, code, err = client.SendRPC("internal_invalid", nil)
+	require.NoError(t, err)
+	require.Equal(t, 400, code)
+	RequireEqualJSON(t, []byte(`{"jsonrpc":"2.0","error":{"code":-32602,"message":"bad tenant"},"id":999}`), res)
+
+	res, code, err = client.SendRPC("internal_broken", nil)
+	require.NoError(t, err)
+	require.Equal(t, 500, code)
+	RequireEqualJSON(t, []byte(`{"jsonrpc":"2.0","error":{"code":-32000,"message":"internal error"},"id":999}`), res)
+
+	// registered methods are rate limited like other methods
+	_, code, err = client.SendRPC("internal_health", nil)
+	require.NoError(t, err)
+	require.Equal(t, 200, code)
+	_, code, err = client.SendRPC("internal_health", nil)
+	require.NoError(t, err)
+	require.Equal(t, 429, code)
+
+	require.Equal(t, 0, len(goodBackend.Requests()))
+}
@@ -0,0 +1,123 @@
+package integration_tests
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHotReload(t *testing.T) {
+	goodBackend := NewMockBackend(BatchedResponseHandler(200, goodResponse))
+	defer goodBackend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+
+	config := ReadConfig("hot_reload")
+	client := NewProxydClient("http://127.0.0.1:8545")
+	srv, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	sendN := func(n int, method string) {
+		for i := 0; i < n; i++ {
+			_, _, err := client.SendRPC(method, nil)
+			require.NoError(t, err)
+		}
+	}
+	isWhitelisted := func(method string) bool {
+		res, _, err := client.SendRPC(method, nil)
+		require.NoError(t, err)
+		var parsed struct {
+			Error *proxyd.RPCErr `json:"error"`
+		}
+		require.NoError(t, json.Unmarshal(res, &parsed))
+		return parsed.Error == nil || parsed.Error.Code != proxyd.ErrMethodNotWhitelisted.Code
+	}
+
+	t.Run("rate limits are kept across reloads", func(t *testing.T) {
+		_, code, err := client.SendRPC("eth_gasPrice", nil)
+		require.NoError(t, err)
+		require.Equal(t, 200, code)
+
+		require.NoError(t, srv.ReloadConfig(ReadConfig("hot_reload")))
+		_, code, err = client.SendRPC("eth_gasPrice", nil)
+		require.NoError(t, err)
+		require.Equal(t, 429, code)
+
+		// changed limits start over
+		reloaded := ReadConfig("hot_reload")
+		reloaded.RateLimit.MethodOverrides["eth_gasPrice"].Limit = 2
+		require.Eventually(t, func() bool {
+			return srv.ReloadConfig(reloaded) == nil
+		}, 5*time.Second, 100*time.Millisecond)
+		_, code, err = client.SendRPC("eth_gasPrice", nil)
+		require.NoError(t, err)
+		require.Equal(t, 200, code)
+		time.Sleep(time.Second)
+	})
+
+	t.Run("reload is applied", func(t *testing.T) {
+		sendN(10, "eth_chainId")
+
+		reloaded := ReadConfig("hot_reload")
+		reloaded.RPCMethodMappings["eth_blockNumber"] = "main"
+		require.NoError(t, srv.ReloadConfig(reloaded))
+		require.True(t, isWhitelisted("eth_blockNumber"))
+		sendN(10, "eth_chainId")
+
+		// the reloaded config is kept once the evaluation window has passed
+		time.Sleep(time.Second)
+		require.True(t, isWhitelisted("eth_blockNumber"))
+	})
+
+	t.Run("reload is rolled back on regression", func(t *testing.T) {
+		sendN(10, "eth_chainId")
+
+		reloaded := ReadConfig("hot_reload")
+		delete(reloaded.RPCMethodMappings, "eth_chainId")
+		reloaded.RPCMethodMappings["eth_blockNumber"] = "main"
+		require.NoError(t, srv.ReloadConfig(reloaded))
+		require.False(t, isWhitelisted("eth_chainId"))
+		sendN(10, "eth_chainId")
+
+		require.Eventually(t, func() bool {
+			return isWhitelisted("eth_chainId")
+		}, 5*time.Second, 100*time.Millisecond)
+		require.True(t, isWhitelisted("eth_blockNumber"))
+	})
+
+	t.Run("past errors don't mask a regression", func(t *testing.T) {
+		// an error burst long before the reload
+		sendN(200, "eth_syncing")
+		time.Sleep(time.Second)
+		sendN(10, "eth_chainId")
+
+		reloaded := ReadConfig("hot_reload")
+		delete(reloaded.RPCMethodMappings, "eth_chainId")
+		reloaded.RPCMethodMappings["eth_blockNumber"] = "main"
+		require.NoError(t, srv.ReloadConfig(reloaded))
+		require.False(t, isWhitelisted("eth_chainId"))
+		sendN(10, "eth_chainId")
+
+		require.Eventually(t, func() bool {
+			return isWhitelisted("eth_chainId")
+		}, 5*time.Second, 100*time.Millisecond)
+	})
+
+	t.Run("invalid reload is refused", func(t *testing.T) {
+		reloaded := ReadConfig("hot_reload")
+		reloaded.RPCMethodMappings["eth_blockNumber"] = "missing"
+		require.Error(t, srv.ReloadConfig(reloaded))
+	})
+
+	t.Run("reload is rejected during evaluation", func(t *testing.T) {
+		require.Eventually(t, func() bool {
+			return srv.ReloadConfig(ReadConfig("hot_reload")) == nil
+		}, 5*time.Second, 100*time.Millisecond)
+		require.ErrorIs(t, srv.ReloadConfig(ReadConfig("hot_reload")), proxyd.ErrReloadInProgress)
+	})
+}
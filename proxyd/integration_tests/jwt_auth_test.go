@@ -0,0 +1,166 @@
+package integration_tests
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/stretchr/testify/require"
+)
+
+const jwtSecret = "jwt-secret"
+
+// signJWT returns a token of claims signed with key, a secret for HS256 or a
+// private key for RS256 and ES256.
+func signJWT(t *testing.T, alg string, kid string, key interface{}, claims map[string]interface{}) string {
+	header, err := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	require.NoError(t, err)
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+	switch key := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		sig, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		require.NoError(t, err)
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		require.NoError(t, err)
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestJWTAuth(t *testing.T) {
+	goodBackend := NewMockBackend(BatchedResponseHandler(200, goodResponse))
+	defer goodBackend.Close()
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b64 := base64.RawURLEncoding.EncodeToString
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{
+				{"kty": "EC", "kid": "ec", "crv": "P-256", "x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32)))},
+				{"kty": "RSA", "kid": "rsa", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+			},
+		})
+	}))
+	defer jwks.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+	require.NoError(t, os.Setenv("JWT_SECRET", jwtSecret))
+	require.NoError(t, os.Setenv("JWKS_URL", jwks.URL))
+
+	config := ReadConfig("jwt_auth")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	claims := func(sub string, overrides map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"sub": sub,
+			"iss": "https://auth.example.com/",
+			"aud": []string{"proxyd"},
+			"exp": time.Now().Add(time.Hour).Unix(),
+		}
+		for k, v := range overrides {
+			c[k] = v
+		}
+		return c
+	}
+	// call calls method at path with the bearer token, if any, returning the
+	// status and RPC error code of the response.
+	call := func(t *testing.T, token string, path string, method string) (int, int) {
+		req, err := http.NewRequest(http.MethodPost, "http://127.0.0.1:8545"+path, strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"`+method+`"}`))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		var out struct {
+			Error *proxyd.RPCErr `json:"error"`
+		}
+		if res.StatusCode != http.StatusUnauthorized {
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&out))
+		}
+		if out.Error != nil {
+			return res.StatusCode, out.Error.Code
+		}
+		return res.StatusCode, 0
+	}
+
+	t.Run("valid tokens authenticate as their alias", func(t *testing.T) {
+		indexer := signJWT(t, "HS256", "", []byte(jwtSecret), claims("client-1", nil))
+		status, code := call(t, indexer, "/", "eth_chainId")
+		require.Equal(t, http.StatusOK, status)
+		require.Zero(t, code)
+		_, code = call(t, indexer, "/", "eth_blockNumber")
+		require.Equal(t, proxyd.ErrMethodNotWhitelisted.Code, code)
+
+		for _, token := range []string{
+			signJWT(t, "ES256", "ec", ecKey, claims("client-2", nil)),
+			signJWT(t, "RS256", "rsa", rsaKey, claims("client-2", nil)),
+		} {
+			status, code = call(t, token, "/", "eth_blockNumber")
+			require.Equal(t, http.StatusOK, status)
+			require.Zero(t, code)
+		}
+	})
+
+	t.Run("invalid tokens are rejected", func(t *testing.T) {
+		valid := signJWT(t, "HS256", "", []byte(jwtSecret), claims("client-1", nil))
+		for name, token := range map[string]string{
+			"expired":         signJWT(t, "HS256", "", []byte(jwtSecret), claims("client-1", map[string]interface{}{"exp": time.Now().Add(-time.Minute).Unix()})),
+			"wrong audience":  signJWT(t, "HS256", "", []byte(jwtSecret), claims("client-1", map[string]interface{}{"aud": "other"})),
+			"wrong issuer":    signJWT(t, "HS256", "", []byte(jwtSecret), claims("client-1", map[string]interface{}{"iss": "other"})),
+			"unmapped":        signJWT(t, "HS256", "", []byte(jwtSecret), claims("client-3", nil)),
+			"wrong secret":    signJWT(t, "HS256", "", []byte("other"), claims("client-1", nil)),
+			"unknown key":     signJWT(t, "ES256", "ec", otherKey, claims("client-1", nil)),
+			"tampered":        valid[:len(valid)-4] + "AAAA",
+			"unsigned":        strings.Split(valid, ".")[0] + "." + strings.Split(valid, ".")[1] + ".",
+			"malformed token": "garbage",
+		} {
+			status, _ := call(t, token, "/secret", "eth_chainId")
+			require.Equal(t, http.StatusUnauthorized, status, name)
+		}
+	})
+
+	t.Run("requests without tokens need the secret", func(t *testing.T) {
+		status, _ := call(t, "", "/", "eth_chainId")
+		require.Equal(t, http.StatusUnauthorized, status)
+		status, code := call(t, "", "/secret", "eth_blockNumber")
+		require.Equal(t, http.StatusOK, status)
+		require.Zero(t, code)
+	})
+}
@@ -0,0 +1,62 @@
+package integration_tests
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeepalive(t *testing.T) {
+	var fail atomic.Bool
+	goodBackend := NewMockBackend(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		if fail.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		BatchedResponseHandler(200, goodResponse)(w, r)
+	}))
+	defer goodBackend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+
+	config := ReadConfig("keepalive")
+	client := NewProxydClient("http://127.0.0.1:8545")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	res, code, err := client.SendRPC("debug_traceTransaction", []interface{}{"0x1"})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, code)
+	require.True(t, strings.HasPrefix(string(res), " "), "response starts with keepalives")
+	RequireEqualJSON(t, []byte(goodResponse), []byte(strings.TrimSpace(string(res))))
+
+	res, _, err = client.SendBatchRPC(
+		NewRPCReq("1", "eth_chainId", nil),
+		NewRPCReq("2", "debug_traceTransaction", []interface{}{"0x1"}),
+	)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(string(res), " "), "batches with keepalive methods start with keepalives")
+
+	res, code, err = client.SendRPC("eth_chainId", nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, code)
+	require.False(t, strings.HasPrefix(string(res), " "))
+
+	// the status of errors can't be sent once keepalives started
+	fail.Store(true)
+	res, code, err = client.SendRPC("debug_traceTransaction", []interface{}{"0x1"})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, code)
+	require.Contains(t, string(res), `"error"`)
+	_, code, err = client.SendRPC("eth_chainId", nil)
+	require.NoError(t, err)
+	require.NotEqual(t, http.StatusOK, code)
+}
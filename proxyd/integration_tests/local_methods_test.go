@@ -0,0 +1,65 @@
+package integration_tests
+
+import (
+	"os"
+	"testing"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalMethods(t *testing.T) {
+	goodBackend := NewMockBackend(SingleResponseHandler(200, dummyRes))
+	defer goodBackend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+
+	client := NewProxydClient("http://127.0.0.1:8545")
+
+	t.Run("answers locally", func(t *testing.T) {
+		goodBackend.Reset()
+		config := ReadConfig("local_methods")
+		_, shutdown, err := proxyd.Start(config)
+		require.NoError(t, err)
+		defer shutdown()
+
+		tests := []struct {
+			method string
+			res    string
+		}{
+			{"eth_chainId", `{"jsonrpc":"2.0","result":"0x1a4","id":999}`},
+			{"net_version", `{"jsonrpc":"2.0","result":"420","id":999}`},
+			{"web3_clientVersion", `{"jsonrpc":"2.0","result":"proxyd/test","id":999}`},
+		}
+		for _, tt := range tests {
+			res, code, err := client.SendRPC(tt.method, nil)
+			require.NoError(t, err)
+			require.Equal(t, 200, code)
+			RequireEqualJSON(t, []byte(tt.res), res)
+		}
+
+		res, code, err := client.SendBatchRPC(
+			NewRPCReq("1", "eth_chainId", nil),
+			NewRPCReq("2", "net_version", nil),
+		)
+		require.NoError(t, err)
+		require.Equal(t, 200, code)
+		RequireEqualJSON(t, []byte(`[{"jsonrpc":"2.0","result":"0x1a4","id":1},{"jsonrpc":"2.0","result":"420","id":2}]`), res)
+		require.Equal(t, 0, len(goodBackend.Requests()))
+	})
+
+	t.Run("disabled methods are forwarded", func(t *testing.T) {
+		goodBackend.Reset()
+		config := ReadConfig("local_methods")
+		config.LocalMethods.DisabledMethods = []string{"web3_clientVersion"}
+		_, shutdown, err := proxyd.Start(config)
+		require.NoError(t, err)
+		defer shutdown()
+
+		res, code, err := client.SendRPC("web3_clientVersion", nil)
+		require.NoError(t, err)
+		require.Equal(t, 200, code)
+		RequireEqualJSON(t, []byte(dummyRes), res)
+		require.Equal(t, 1, len(goodBackend.Requests()))
+	})
+}
@@ -77,3 +77,47 @@ func TestMaxConcurrentRPCs(t *testing.T) {
 
 	require.EqualValues(t, 2, maxConcurrentRPCs)
 }
+
+func TestLoadShedding(t *testing.T) {
+	arrived := make(chan struct{}, 2)
+	release := make(chan struct{})
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		arrived <- struct{}{}
+		<-release
+		BatchedResponseHandler(200, goodResponse)(w, r)
+	}
+	slowBackend := httptest.NewServer(http.HandlerFunc(handler))
+	defer slowBackend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", slowBackend.URL))
+
+	config := ReadConfig("max_rpc_conns")
+	config.Server.MaxConcurrentRPCs = 1
+	config.Server.EnableLoadShedding = true
+	config.Server.MaxQueuedRPCs = 1
+	client := NewProxydClient("http://127.0.0.1:8545")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	codes := make(chan int, 2)
+	send := func() {
+		_, code, err := client.SendRPC("eth_chainId", nil)
+		require.NoError(t, err)
+		codes <- code
+	}
+
+	// one request is served and one waits, so the queue is full
+	go send()
+	<-arrived
+	go send()
+	time.Sleep(100 * time.Millisecond)
+	res, code, err := client.SendRPC("eth_chainId", nil)
+	require.NoError(t, err)
+	require.Equal(t, 429, code)
+	RequireEqualJSON(t, []byte(`{"error":{"code":-32025,"message":"server is overloaded"},"id":999,"jsonrpc":"2.0"}`), res)
+
+	close(release)
+	require.Equal(t, 200, <-codes)
+	require.Equal(t, 200, <-codes)
+}
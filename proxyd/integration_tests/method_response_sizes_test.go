@@ -0,0 +1,44 @@
+package integration_tests
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMethodMaxResponseSizes(t *testing.T) {
+	goodBackend := NewMockBackend(BatchedResponseHandler(200, goodResponse))
+	defer goodBackend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+
+	config := ReadConfig("method_response_sizes")
+	client := NewProxydClient("http://127.0.0.1:8545")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	t.Run("default size", func(t *testing.T) {
+		out, code, err := client.SendRequest([]byte(`{"jsonrpc": "2.0", "method": "eth_chainId", "params": [], "id": 1}`))
+		require.NoError(t, err)
+		require.Equal(t, `{"jsonrpc":"2.0","error":{"code":-32020,"message":"backend response too large"},"id":1}`, strings.TrimSpace(string(out)))
+		require.Equal(t, 500, code)
+	})
+
+	t.Run("log queries are asked to narrow their query", func(t *testing.T) {
+		out, code, err := client.SendRequest([]byte(`{"jsonrpc": "2.0", "method": "eth_getLogs", "params": [], "id": 1}`))
+		require.NoError(t, err)
+		require.Equal(t, `{"jsonrpc":"2.0","error":{"code":-32020,"message":"backend response too large, narrow your query: query a smaller block range, or filter by address and topics"},"id":1}`, strings.TrimSpace(string(out)))
+		require.Equal(t, 500, code)
+	})
+
+	t.Run("method override", func(t *testing.T) {
+		out, code, err := client.SendRequest([]byte(`{"jsonrpc": "2.0", "method": "net_version", "params": [], "id": 1}`))
+		require.NoError(t, err)
+		RequireEqualJSON(t, []byte(goodResponse), out)
+		require.Equal(t, 200, code)
+	})
+}
@@ -0,0 +1,64 @@
+package integration_tests
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParamValidation(t *testing.T) {
+	goodBackend := NewMockBackend(SingleResponseHandler(200, dummyRes))
+	defer goodBackend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+
+	config := ReadConfig("param_validation")
+	client := NewProxydClient("http://127.0.0.1:8545")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	tests := []struct {
+		name    string
+		method  string
+		params  []interface{}
+		message string
+	}{
+		{"valid balance", "eth_getBalance", []interface{}{"0x000000000000000000000000000000000000dEaD", "latest"}, ""},
+		{"valid block", "eth_getBlockByNumber", []interface{}{"0x10", false}, ""},
+		{"valid storage key", "eth_getStorageAt", []interface{}{"0x000000000000000000000000000000000000dEaD", "0x1", "0x10"}, ""},
+		{"valid call", "eth_call", []interface{}{map[string]interface{}{"to": "0x000000000000000000000000000000000000dEaD", "data": "0x1234", "custom": true}}, ""},
+		{"valid filter", "eth_getLogs", []interface{}{map[string]interface{}{"fromBlock": "earliest", "address": []string{"0x000000000000000000000000000000000000dEaD"}, "topics": []interface{}{nil, []interface{}{"0x" + strings.Repeat("00", 32), nil}}}}, ""},
+		{"disabled method", "eth_sendRawTransaction", []interface{}{"not hex"}, ""},
+		{"no params", "eth_chainId", nil, ""},
+
+		{"short address", "eth_getBalance", []interface{}{"0xdead", "latest"}, "invalid argument 0: address must be 20 bytes, have 2"},
+		{"missing prefix", "eth_getBalance", []interface{}{"000000000000000000000000000000000000dEaD"}, "invalid argument 0: hex string without 0x prefix"},
+		{"unknown block tag", "eth_getBalance", []interface{}{"0x000000000000000000000000000000000000dEaD", "newest"}, "invalid argument 1: hex string without 0x prefix"},
+		{"leading zeros", "eth_getBlockByNumber", []interface{}{"0x010", false}, "invalid argument 0: hex number with leading zero digits"},
+		{"missing argument", "eth_getBlockByNumber", []interface{}{"latest"}, "missing value for required argument 1"},
+		{"too many arguments", "eth_chainId", []interface{}{"0x1"}, "too many arguments, want at most 0"},
+		{"invalid call field", "eth_call", []interface{}{map[string]interface{}{"value": "10"}}, "invalid argument 0: invalid value: hex string without 0x prefix"},
+		{"invalid topic", "eth_getLogs", []interface{}{map[string]interface{}{"topics": []interface{}{"0x1234"}}}, "invalid argument 0: invalid topics: element 0: hash must be 32 bytes, have 2"},
+		{"block hash and range", "eth_getLogs", []interface{}{map[string]interface{}{"blockHash": "0x" + strings.Repeat("00", 32), "fromBlock": "0x1"}}, "invalid argument 0: cannot specify both blockHash and fromBlock/toBlock"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			goodBackend.Reset()
+			res, code, err := client.SendRPC(tt.method, tt.params)
+			require.NoError(t, err)
+			if tt.message == "" {
+				require.Equal(t, 200, code)
+				RequireEqualJSON(t, []byte(dummyRes), res)
+				require.Equal(t, 1, len(goodBackend.Requests()))
+				return
+			}
+			require.Equal(t, 400, code)
+			RequireEqualJSON(t, []byte(`{"jsonrpc":"2.0","error":{"code":-32602,"message":"`+tt.message+`"},"id":999}`), res)
+			require.Equal(t, 0, len(goodBackend.Requests()))
+		})
+	}
+}
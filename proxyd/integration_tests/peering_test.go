@@ -0,0 +1,133 @@
+package integration_tests
+
+import (
+	"net/http"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPeering(t *testing.T) {
+	peerBackend := NewMockBackend(BatchedResponseHandler(200, goodResponse))
+	defer peerBackend.Close()
+	nodeBackend := NewMockBackend(BatchedResponseHandler(200, goodResponse))
+	defer nodeBackend.Close()
+
+	require.NoError(t, os.Setenv("PEER_BACKEND_RPC_URL", peerBackend.URL()))
+	require.NoError(t, os.Setenv("NODE_BACKEND_RPC_URL", nodeBackend.URL()))
+
+	config := ReadConfig("peering")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	peerHeaders := func(hops string, origin string, reqID string) http.Header {
+		h := make(http.Header)
+		h.Set(proxyd.PeeringHopsHeader, hops)
+		h.Set(proxyd.PeeringOriginHeader, origin)
+		h.Set(proxyd.PeeringRequestIDHeader, reqID)
+		h.Set(proxyd.PeeringSecretHeader, "peer-secret")
+		return h
+	}
+
+	t.Run("headers are sent to peers", func(t *testing.T) {
+		peerBackend.Reset()
+		client := NewProxydClient("http://127.0.0.1:8545")
+		_, code, err := client.SendRPC("eth_chainId", nil)
+		require.NoError(t, err)
+		require.Equal(t, 200, code)
+
+		require.Len(t, peerBackend.Requests(), 1)
+		h := peerBackend.Requests()[0].Headers
+		require.Equal(t, "1", h.Get(proxyd.PeeringHopsHeader))
+		require.Equal(t, "proxyd-a", h.Get(proxyd.PeeringOriginHeader))
+		require.NotEmpty(t, h.Get(proxyd.PeeringRequestIDHeader))
+		require.Equal(t, "peer-secret", h.Get(proxyd.PeeringSecretHeader))
+	})
+
+	t.Run("headers are forwarded by peers", func(t *testing.T) {
+		peerBackend.Reset()
+		client := NewProxydClientWithHeaders("http://127.0.0.1:8545", peerHeaders("1", "proxyd-b", "abc"))
+		_, code, err := client.SendRPC("eth_chainId", nil)
+		require.NoError(t, err)
+		require.Equal(t, 200, code)
+
+		require.Len(t, peerBackend.Requests(), 1)
+		h := peerBackend.Requests()[0].Headers
+		require.Equal(t, "2", h.Get(proxyd.PeeringHopsHeader))
+		require.Equal(t, "proxyd-b", h.Get(proxyd.PeeringOriginHeader))
+		require.Equal(t, "abc", h.Get(proxyd.PeeringRequestIDHeader))
+	})
+
+	t.Run("headers of clients are ignored", func(t *testing.T) {
+		for _, secret := range []string{"", "wrong"} {
+			peerBackend.Reset()
+			h := peerHeaders("1", "proxyd-a", "abc")
+			h.Set(proxyd.PeeringSecretHeader, secret)
+			client := NewProxydClientWithHeaders("http://127.0.0.1:8545", h)
+			_, code, err := client.SendRPC("eth_chainId", nil)
+			require.NoError(t, err)
+			require.Equal(t, 200, code)
+
+			require.Len(t, peerBackend.Requests(), 1)
+			h = peerBackend.Requests()[0].Headers
+			require.Equal(t, "1", h.Get(proxyd.PeeringHopsHeader))
+			require.Equal(t, "proxyd-a", h.Get(proxyd.PeeringOriginHeader))
+			require.NotEqual(t, "abc", h.Get(proxyd.PeeringRequestIDHeader))
+		}
+	})
+
+	t.Run("headers are not sent to other backends", func(t *testing.T) {
+		nodeBackend.Reset()
+		client := NewProxydClient("http://127.0.0.1:8545")
+		_, code, err := client.SendRPC("eth_blockNumber", nil)
+		require.NoError(t, err)
+		require.Equal(t, 200, code)
+
+		require.Len(t, nodeBackend.Requests(), 1)
+		require.Empty(t, nodeBackend.Requests()[0].Headers.Get(proxyd.PeeringHopsHeader))
+		require.Empty(t, nodeBackend.Requests()[0].Headers.Get(proxyd.PeeringOriginHeader))
+		require.Empty(t, nodeBackend.Requests()[0].Headers.Get(proxyd.PeeringSecretHeader))
+	})
+
+	t.Run("loops are rejected", func(t *testing.T) {
+		client := NewProxydClientWithHeaders("http://127.0.0.1:8545", peerHeaders("1", "proxyd-a", "abc"))
+		_, code, err := client.SendRPC("eth_chainId", nil)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusLoopDetected, code)
+	})
+
+	t.Run("max hops are rejected", func(t *testing.T) {
+		client := NewProxydClientWithHeaders("http://127.0.0.1:8545", peerHeaders("2", "proxyd-b", "abc"))
+		_, code, err := client.SendRPC("eth_chainId", nil)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusLoopDetected, code)
+	})
+
+	t.Run("requests with the same request ID are deduplicated", func(t *testing.T) {
+		peerBackend.Reset()
+		peerBackend.SetHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(200 * time.Millisecond)
+			BatchedResponseHandler(200, goodResponse)(w, r)
+		}))
+		defer peerBackend.SetHandler(BatchedResponseHandler(200, goodResponse))
+
+		var wg sync.WaitGroup
+		for _, reqID := range []string{"dup", "dup", "dup", "other"} {
+			wg.Add(1)
+			go func(reqID string) {
+				defer wg.Done()
+				client := NewProxydClientWithHeaders("http://127.0.0.1:8545", peerHeaders("1", "proxyd-b", reqID))
+				_, code, err := client.SendRPC("eth_sendRawTransaction", []interface{}{"0x1234"})
+				require.NoError(t, err)
+				require.Equal(t, 200, code)
+			}(reqID)
+		}
+		wg.Wait()
+		require.Len(t, peerBackend.Requests(), 2)
+	})
+}
@@ -0,0 +1,118 @@
+package integration_tests
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+const relayRes = `{"id":1,"jsonrpc":"2.0","result":"0x5a1b"}`
+
+func TestPrivateTx(t *testing.T) {
+	goodBackend := NewMockBackend(SingleResponseHandler(200, dummyRes))
+	defer goodBackend.Close()
+	relay := NewMockBackend(SingleResponseHandler(200, relayRes))
+	defer relay.Close()
+
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+	require.NoError(t, os.Setenv("PRIVATE_RELAY_URL", relay.URL()))
+	require.NoError(t, os.Setenv("PRIVATE_TX_SIGNING_KEY", hexutil.Encode(crypto.FromECDSA(key))))
+
+	client := NewProxydClient("http://127.0.0.1:8545")
+	sendPrivateTx := func() ([]byte, int) {
+		res, code, err := client.SendRequest([]byte(`{"jsonrpc":"2.0","method":"eth_sendPrivateTransaction","params":[{"tx":"0x01","maxBlockNumber":"0x10"}],"id":1}`))
+		require.NoError(t, err)
+		return res, code
+	}
+
+	t.Run("relays private transactions", func(t *testing.T) {
+		config := ReadConfig("private_tx")
+		_, shutdown, err := proxyd.Start(config)
+		require.NoError(t, err)
+		defer shutdown()
+
+		res, code := sendPrivateTx()
+		require.Equal(t, 200, code)
+		RequireEqualJSON(t, []byte(relayRes), res)
+		require.Equal(t, 0, len(goodBackend.Requests()))
+		require.Equal(t, 1, len(relay.Requests()))
+
+		req := relay.Requests()[0]
+		var rpcReq proxyd.RPCReq
+		require.NoError(t, json.Unmarshal(req.Body, &rpcReq))
+		require.Equal(t, "eth_sendPrivateTransaction", rpcReq.Method)
+
+		addr, sig, ok := strings.Cut(req.Headers.Get("X-Flashbots-Signature"), ":")
+		require.True(t, ok)
+		hash := accounts.TextHash([]byte(hexutil.Encode(crypto.Keccak256(req.Body))))
+		pub, err := crypto.SigToPub(hash, hexutil.MustDecode(sig))
+		require.NoError(t, err)
+		require.Equal(t, crypto.PubkeyToAddress(key.PublicKey), common.HexToAddress(addr))
+		require.Equal(t, common.HexToAddress(addr), crypto.PubkeyToAddress(*pub))
+	})
+
+	t.Run("relays raw transactions", func(t *testing.T) {
+		goodBackend.Reset()
+		relay.Reset()
+		config := ReadConfig("private_tx")
+		config.PrivateTx.RelayRawTransactions = true
+		_, shutdown, err := proxyd.Start(config)
+		require.NoError(t, err)
+		defer shutdown()
+
+		res, code, err := client.SendRequest(makeSendRawTransaction("0x01"))
+		require.NoError(t, err)
+		require.Equal(t, 200, code)
+		RequireEqualJSON(t, []byte(relayRes), res)
+		require.Equal(t, 0, len(goodBackend.Requests()))
+		require.Equal(t, 1, len(relay.Requests()))
+		var rpcReq proxyd.RPCReq
+		require.NoError(t, json.Unmarshal(relay.Requests()[0].Body, &rpcReq))
+		require.Equal(t, "eth_sendPrivateTransaction", rpcReq.Method)
+		RequireEqualJSON(t, []byte(`[{"tx":"0x01"}]`), rpcReq.Params)
+	})
+
+	t.Run("falls back to the public path", func(t *testing.T) {
+		goodBackend.Reset()
+		relay.Reset()
+		relay.SetHandler(SingleResponseHandler(503, "unavailable"))
+		config := ReadConfig("private_tx")
+		_, shutdown, err := proxyd.Start(config)
+		require.NoError(t, err)
+		defer shutdown()
+
+		res, code := sendPrivateTx()
+		require.Equal(t, 200, code)
+		RequireEqualJSON(t, []byte(dummyRes), res)
+		require.Equal(t, 1, len(relay.Requests()))
+		require.Equal(t, 1, len(goodBackend.Requests()))
+		var rpcReq proxyd.RPCReq
+		require.NoError(t, json.Unmarshal(goodBackend.Requests()[0].Body, &rpcReq))
+		require.Equal(t, "eth_sendRawTransaction", rpcReq.Method)
+	})
+
+	t.Run("fails without fallback", func(t *testing.T) {
+		goodBackend.Reset()
+		relay.Reset()
+		config := ReadConfig("private_tx")
+		config.PrivateTx.Fallback = false
+		_, shutdown, err := proxyd.Start(config)
+		require.NoError(t, err)
+		defer shutdown()
+
+		res, code := sendPrivateTx()
+		require.Equal(t, 503, code)
+		RequireEqualJSON(t, []byte(`{"error":{"code":-32028,"message":"private transaction relay unavailable"},"id":1,"jsonrpc":"2.0"}`), res)
+		require.Equal(t, 0, len(goodBackend.Requests()))
+	})
+}
@@ -0,0 +1,106 @@
+package integration_tests
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+// proxyProtocolV2Header returns a v2 header of a TCP connection from src to
+// dst, both IPv6.
+func proxyProtocolV2Header(src, dst string, srcPort, dstPort uint16) []byte {
+	hdr := []byte("\r\n\r\n\x00\r\nQUIT\n")
+	hdr = append(hdr, 0x21, 0x21)
+	hdr = binary.BigEndian.AppendUint16(hdr, 36)
+	hdr = append(hdr, net.ParseIP(src).To16()...)
+	hdr = append(hdr, net.ParseIP(dst).To16()...)
+	hdr = binary.BigEndian.AppendUint16(hdr, srcPort)
+	return binary.BigEndian.AppendUint16(hdr, dstPort)
+}
+
+// dialWithHeader returns a dial func sending header ahead of the connection,
+// as load balancers do.
+func dialWithHeader(header []byte) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := new(net.Dialer).DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := conn.Write(header); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return conn, nil
+	}
+}
+
+func TestProxyProtocol(t *testing.T) {
+	goodBackend := NewMockBackend(BatchedResponseHandler(200, goodResponse))
+	defer goodBackend.Close()
+	wsBackend := NewMockWSBackend(nil, nil, nil)
+	defer wsBackend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+	require.NoError(t, os.Setenv("GOOD_BACKEND_WS_URL", wsBackend.URL()))
+
+	config := ReadConfig("proxy_protocol")
+	config.Backends["good"].WSURL = "$GOOD_BACKEND_WS_URL"
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	post := func(t *testing.T, header []byte) (int, error) {
+		client := &http.Client{Transport: &http.Transport{
+			DialContext:       dialWithHeader(header),
+			DisableKeepAlives: true,
+		}}
+		res, err := client.Post("http://127.0.0.1:8545/client_secret", "application/json", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"eth_chainId"}`))
+		if err != nil {
+			return 0, err
+		}
+		defer res.Body.Close()
+		return res.StatusCode, nil
+	}
+
+	t.Run("client addresses are read from headers", func(t *testing.T) {
+		code, err := post(t, []byte("PROXY TCP4 203.0.113.7 127.0.0.1 51234 8545\r\n"))
+		require.NoError(t, err)
+		require.Equal(t, 200, code)
+
+		code, err = post(t, proxyProtocolV2Header("2001:db8::1", "::1", 51234, 8545))
+		require.NoError(t, err)
+		require.Equal(t, 200, code)
+	})
+
+	t.Run("connections without a client address keep the peer address", func(t *testing.T) {
+		for _, header := range []string{"", "PROXY UNKNOWN\r\n"} {
+			code, err := post(t, []byte(header))
+			require.NoError(t, err)
+			require.Equal(t, 403, code, header)
+		}
+	})
+
+	t.Run("invalid headers close the connection", func(t *testing.T) {
+		_, err := post(t, []byte("PROXY TCP4 not-an-ip 127.0.0.1 51234 8545\r\n"))
+		require.Error(t, err)
+	})
+
+	t.Run("ws", func(t *testing.T) {
+		dialer := &websocket.Dialer{NetDialContext: dialWithHeader([]byte("PROXY TCP4 203.0.113.7 127.0.0.1 51234 8546\r\n"))}
+		conn, _, err := dialer.Dial("ws://127.0.0.1:8546/client_secret", nil) // nolint:bodyclose
+		require.NoError(t, err)
+		conn.Close()
+
+		_, res, err := websocket.DefaultDialer.Dial("ws://127.0.0.1:8546/client_secret", nil) // nolint:bodyclose
+		require.Error(t, err)
+		require.Equal(t, 403, res.StatusCode)
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"os"
+	"strconv"
 	"testing"
 	"time"
 
@@ -75,6 +76,32 @@ func TestFrontendMaxRPSLimit(t *testing.T) {
 		require.NoError(t, err)
 	})
 
+	t.Run("rate limit headers", func(t *testing.T) {
+		h := make(http.Header)
+		h.Set("X-Forwarded-For", "2.2.2.2")
+		client := NewProxydClientWithHeaders("http://127.0.0.1:8545", h)
+
+		// start at the beginning of a rate limit window
+		time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+		reset := strconv.FormatInt(time.Now().Truncate(time.Second).Add(time.Second).Unix(), 10)
+
+		for _, remaining := range []string{"1", "0"} {
+			_, code, headers, err := client.SendRPCWithHeaders(ethChainID, nil)
+			require.NoError(t, err)
+			require.Equal(t, 200, code)
+			require.Equal(t, "2", headers.Get("X-RateLimit-Limit"))
+			require.Equal(t, remaining, headers.Get("X-RateLimit-Remaining"))
+			require.Equal(t, reset, headers.Get("X-RateLimit-Reset"))
+			require.Empty(t, headers.Get("Retry-After"))
+		}
+
+		_, code, headers, err := client.SendRPCWithHeaders(ethChainID, nil)
+		require.NoError(t, err)
+		require.Equal(t, 429, code)
+		require.Equal(t, "0", headers.Get("X-RateLimit-Remaining"))
+		require.Equal(t, "1", headers.Get("Retry-After"))
+	})
+
 	time.Sleep(time.Second)
 
 	t.Run("RPC override", func(t *testing.T) {
@@ -88,6 +115,26 @@ func TestFrontendMaxRPSLimit(t *testing.T) {
 
 	time.Sleep(time.Second)
 
+	t.Run("rate limit headers of RPC overrides", func(t *testing.T) {
+		h := make(http.Header)
+		h.Set("X-Forwarded-For", "3.3.3.3")
+		client := NewProxydClientWithHeaders("http://127.0.0.1:8545", h)
+		_, code, headers, err := client.SendRPCWithHeaders("eth_foobar", nil)
+		require.NoError(t, err)
+		require.Equal(t, 200, code)
+		require.Equal(t, "2", headers.Get("X-RateLimit-Limit"))
+
+		// the headers are those of the limit rejecting the request
+		_, code, headers, err = client.SendRPCWithHeaders("eth_foobar", nil)
+		require.NoError(t, err)
+		require.Equal(t, 429, code)
+		require.Equal(t, "1", headers.Get("X-RateLimit-Limit"))
+		require.Equal(t, "0", headers.Get("X-RateLimit-Remaining"))
+		require.Equal(t, "1", headers.Get("Retry-After"))
+	})
+
+	time.Sleep(time.Second)
+
 	t.Run("RPC override in batch", func(t *testing.T) {
 		client := NewProxydClient("http://127.0.0.1:8545")
 		req := NewRPCReq("123", "eth_foobar", nil)
@@ -168,3 +215,30 @@ func spamReqs(t *testing.T, client *ProxydHTTPClient, method string, limCode int
 
 	return limitedRes, codes
 }
+
+func TestMethodRateLimitByAuthKey(t *testing.T) {
+	goodBackend := NewMockBackend(BatchedResponseHandler(200, goodResponse))
+	defer goodBackend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+
+	config := ReadConfig("method_rate_limit")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	alice := NewProxydClient("http://127.0.0.1:8545/alice_secret")
+	bob := NewProxydClient("http://127.0.0.1:8545/bob_secret")
+
+	limitedRes, codes := spamReqs(t, alice, "eth_getLogs", 429, 2)
+	require.Equal(t, 1, codes[429])
+	require.Equal(t, 1, codes[200])
+	RequireEqualJSON(t, []byte(frontendOverLimitResponseWithID), limitedRes)
+
+	// keys sharing an IP have their own limit
+	_, codes = spamReqs(t, bob, "eth_getLogs", 429, 1)
+	require.Equal(t, 1, codes[200])
+
+	_, codes = spamReqs(t, alice, "eth_chainId", 429, 2)
+	require.Equal(t, 2, codes[200])
+}
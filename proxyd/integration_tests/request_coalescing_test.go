@@ -0,0 +1,81 @@
+package integration_tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestCoalescing(t *testing.T) {
+	router := NewBatchRPCResponseRouter()
+	router.SetFallbackRoute("eth_getBlockByNumber", "0x123")
+	router.SetFallbackRoute("eth_chainId", "0x420")
+	goodBackend := NewMockBackend(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		router.ServeHTTP(w, r)
+	}))
+	defer goodBackend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+
+	config := ReadConfig("request_coalescing")
+	client := NewProxydClient("http://127.0.0.1:8545")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	sendConcurrently := func(t *testing.T, n int, method string, params []interface{}) {
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func(id int) {
+				defer wg.Done()
+				req := NewRPCReq(fmt.Sprintf("%d", id), method, params)
+				body, err := json.Marshal(req)
+				require.NoError(t, err)
+				res, code, err := client.SendRequest(body)
+				require.NoError(t, err)
+				require.Equal(t, 200, code)
+				var parsed struct {
+					ID json.RawMessage `json:"id"`
+				}
+				require.NoError(t, json.Unmarshal(res, &parsed))
+				require.Equal(t, string(req.ID), string(parsed.ID))
+			}(i)
+		}
+		wg.Wait()
+	}
+
+	t.Run("identical requests are coalesced", func(t *testing.T) {
+		goodBackend.Reset()
+		sendConcurrently(t, 10, "eth_getBlockByNumber", []interface{}{"latest", false})
+		require.Equal(t, 1, len(goodBackend.Requests()))
+	})
+
+	t.Run("requests with different params are not coalesced", func(t *testing.T) {
+		goodBackend.Reset()
+		var wg sync.WaitGroup
+		for _, tag := range []string{"latest", "safe"} {
+			wg.Add(1)
+			go func(tag string) {
+				defer wg.Done()
+				sendConcurrently(t, 5, "eth_getBlockByNumber", []interface{}{tag, false})
+			}(tag)
+		}
+		wg.Wait()
+		require.Equal(t, 2, len(goodBackend.Requests()))
+	})
+
+	t.Run("methods not configured are not coalesced", func(t *testing.T) {
+		goodBackend.Reset()
+		sendConcurrently(t, 3, "eth_chainId", nil)
+		require.Equal(t, 3, len(goodBackend.Requests()))
+	})
+}
@@ -0,0 +1,36 @@
+package integration_tests
+
+import (
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRPCDiscover(t *testing.T) {
+	goodBackend := NewMockBackend(BatchedResponseHandler(200, goodResponse))
+	defer goodBackend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+
+	config := ReadConfig("rpc_discover")
+	client := NewProxydClient("http://127.0.0.1:8545")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	res, code, err := client.SendRPC(proxyd.RPCDiscoverMethod, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, code)
+	expected := `{"jsonrpc":"2.0","id":999,"result":{"openrpc":"1.2.6","info":{"title":"proxyd","version":"1.0.0"},"methods":[
+		{"name":"eth_accounts","description":"Always returns an empty list.","params":[],"result":{"name":"result","schema":{}},"x-proxyd-cached":false},
+		{"name":"eth_call","params":[],"result":{"name":"result","schema":{}},"x-proxyd-backend-group":"main","x-proxyd-cached":false,"x-proxyd-rate-limit":{"limit":5,"interval":"1s","global":false}},
+		{"name":"eth_chainId","params":[],"result":{"name":"result","schema":{}},"x-proxyd-backend-group":"main","x-proxyd-cached":true},
+		{"name":"proxyd_healthz","description":"Returns OK if proxyd is up. Can't be batched.","params":[],"result":{"name":"result","schema":{}},"x-proxyd-cached":false},
+		{"name":"rpc_discover","description":"Returns this document.","params":[],"result":{"name":"result","schema":{}},"x-proxyd-cached":false}
+	]}}`
+	RequireEqualJSON(t, []byte(expected), res)
+	require.Equal(t, 0, len(goodBackend.Requests()))
+}
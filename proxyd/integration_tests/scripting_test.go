@@ -0,0 +1,125 @@
+package integration_tests
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScripting(t *testing.T) {
+	goodBackend := NewMockBackend(BatchedResponseHandler(200, goodResponse))
+	defer goodBackend.Close()
+	archiveBackend := NewMockBackend(BatchedResponseHandler(200, goodResponse))
+	defer archiveBackend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+	require.NoError(t, os.Setenv("ARCHIVE_BACKEND_RPC_URL", archiveBackend.URL()))
+
+	config := ReadConfig("scripting")
+	client := NewProxydClient("http://127.0.0.1:8545")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	reset := func() {
+		goodBackend.Reset()
+		archiveBackend.Reset()
+	}
+
+	t.Run("continue", func(t *testing.T) {
+		reset()
+		res, code, err := client.SendRPC("eth_getBalance", []interface{}{"0x0000000000000000000000000000000000000001", "latest"})
+		require.NoError(t, err)
+		require.Equal(t, 200, code)
+		RequireEqualJSON(t, []byte(goodResponse), res)
+		require.Equal(t, 1, len(goodBackend.Requests()))
+		require.Equal(t, 0, len(archiveBackend.Requests()))
+	})
+
+	t.Run("reject", func(t *testing.T) {
+		reset()
+		res, code, err := client.SendRPC("eth_sign", nil)
+		require.NoError(t, err)
+		require.Equal(t, 403, code)
+		RequireEqualJSON(t, []byte(`{"jsonrpc":"2.0","error":{"code":-32000,"message":"signing is not supported"},"id":999}`), res)
+		require.Equal(t, 0, len(goodBackend.Requests()))
+	})
+
+	t.Run("route", func(t *testing.T) {
+		reset()
+		res, code, err := client.SendRPC("eth_getBalance", []interface{}{"0x0000000000000000000000000000000000000001", "earliest"})
+		require.NoError(t, err)
+		require.Equal(t, 200, code)
+		RequireEqualJSON(t, []byte(goodResponse), res)
+		require.Equal(t, 0, len(goodBackend.Requests()))
+		require.Equal(t, 1, len(archiveBackend.Requests()))
+
+		var req proxyd.RPCReq
+		require.NoError(t, json.Unmarshal(archiveBackend.Requests()[0].Body, &req))
+		require.JSONEq(t, `["0x0000000000000000000000000000000000000001","0x0"]`, string(req.Params))
+	})
+
+	t.Run("rewrite", func(t *testing.T) {
+		reset()
+		res, code, err := client.SendRPC("eth_getChainId", []interface{}{"ignored"})
+		require.NoError(t, err)
+		require.Equal(t, 200, code)
+		RequireEqualJSON(t, []byte(goodResponse), res)
+		require.Equal(t, 1, len(goodBackend.Requests()))
+
+		var req proxyd.RPCReq
+		require.NoError(t, json.Unmarshal(goodBackend.Requests()[0].Body, &req))
+		require.Equal(t, "eth_chainId", req.Method)
+		require.JSONEq(t, `[]`, string(req.Params))
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		reset()
+		res, code, err := client.SendRPC("eth_spin", nil)
+		require.NoError(t, err)
+		require.Equal(t, 500, code)
+		RequireEqualJSON(t, []byte(`{"jsonrpc":"2.0","error":{"code":-32000,"message":"internal error"},"id":999}`), res)
+		require.Equal(t, 0, len(goodBackend.Requests()))
+
+		// the script still runs after timing out
+		_, code, err = client.SendRPC("eth_chainId", nil)
+		require.NoError(t, err)
+		require.Equal(t, 200, code)
+	})
+
+	t.Run("state is not kept across requests", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			res, code, err := client.SendRPC("eth_count", nil)
+			require.NoError(t, err)
+			require.Equal(t, 403, code)
+			RequireEqualJSON(t, []byte(`{"jsonrpc":"2.0","error":{"code":-32030,"message":"1"},"id":999}`), res)
+		}
+	})
+
+	t.Run("unsafe functions are not reachable", func(t *testing.T) {
+		res, code, err := client.SendRPC("eth_unsafe", nil)
+		require.NoError(t, err)
+		require.Equal(t, 403, code)
+		RequireEqualJSON(t, []byte(`{"jsonrpc":"2.0","error":{"code":-32030,"message":"reachable: "},"id":999}`), res)
+	})
+
+	t.Run("params too large", func(t *testing.T) {
+		reset()
+		_, code, err := client.SendRPC("eth_getBalance", []interface{}{strings.Repeat("0", 2048), "latest"})
+		require.NoError(t, err)
+		require.Equal(t, 500, code)
+		require.Equal(t, 0, len(goodBackend.Requests()))
+	})
+
+	t.Run("unknown group", func(t *testing.T) {
+		reset()
+		_, code, err := client.SendRPC("eth_unknownGroup", nil)
+		require.NoError(t, err)
+		require.Equal(t, 500, code)
+		require.Equal(t, 0, len(goodBackend.Requests()))
+	})
+}
@@ -0,0 +1,155 @@
+package integration_tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/stretchr/testify/require"
+)
+
+// mockSecrets serves the secrets of values through the APIs of Vault and AWS
+// Secrets Manager.
+type mockSecrets struct {
+	t      *testing.T
+	mtx    sync.Mutex
+	values map[string]string
+}
+
+func (m *mockSecrets) set(name, value string) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.values[name] = value
+}
+
+func (m *mockSecrets) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if strings.HasPrefix(r.URL.Path, "/v1/") {
+		if r.Header.Get("X-Vault-Token") != "vault-token" {
+			w.WriteHeader(403)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/proxyd":
+			fmt.Fprintf(w, `{"data":{"data":{"backend_password":%q},"metadata":{"version":1}}}`, m.values["backend_password"])
+		case "/v1/secret/legacy":
+			fmt.Fprintf(w, `{"data":{"key":%q}}`, m.values["legacy_key"])
+		default:
+			w.WriteHeader(404)
+		}
+		return
+	}
+
+	var req struct {
+		SecretId string
+	}
+	require.NoError(m.t, json.NewDecoder(r.Body).Decode(&req))
+	require.Equal(m.t, "secretsmanager.GetSecretValue", r.Header.Get("X-Amz-Target"))
+	auth := r.Header.Get("Authorization")
+	require.True(m.t, strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/"), auth)
+	require.Equal(m.t, "session-token", r.Header.Get("X-Amz-Security-Token"))
+	var value string
+	switch req.SecretId {
+	case "proxyd/backend":
+		require.Contains(m.t, auth, "/eu-west-1/secretsmanager/aws4_request")
+		value = fmt.Sprintf(`{"api_key":%q}`, m.values["api_key"])
+	case "arn:aws:secretsmanager:us-east-1:123456789012:secret:proxyd/auth":
+		require.Contains(m.t, auth, "/us-east-1/secretsmanager/aws4_request")
+		value = m.values["auth_key"]
+	default:
+		w.WriteHeader(400)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]string{"SecretString": value})
+}
+
+func TestSecrets(t *testing.T) {
+	goodBackend := NewMockBackend(BatchedResponseHandler(200, goodResponse))
+	defer goodBackend.Close()
+	secrets := &mockSecrets{t: t, values: map[string]string{
+		"backend_password": "password-1",
+		"api_key":          "api-key-1",
+		"auth_key":         "auth-key-1",
+		"legacy_key":       "legacy-key-1",
+	}}
+	secretsServer := httptest.NewServer(secrets)
+	defer secretsServer.Close()
+	// AWS credentials are exchanged for a web identity token
+	sts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		require.Equal(t, "AssumeRoleWithWebIdentity", r.Form.Get("Action"))
+		require.Equal(t, "arn:aws:iam::123456789012:role/proxyd", r.Form.Get("RoleArn"))
+		require.Equal(t, "web-identity-token", r.Form.Get("WebIdentityToken"))
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprint(w, `<AssumeRoleWithWebIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/"><AssumeRoleWithWebIdentityResult><Credentials><AccessKeyId>AKIDEXAMPLE</AccessKeyId><SecretAccessKey>secret-access-key</SecretAccessKey><SessionToken>session-token</SessionToken><Expiration>2100-01-01T00:00:00Z</Expiration></Credentials></AssumeRoleWithWebIdentityResult></AssumeRoleWithWebIdentityResponse>`)
+	}))
+	defer sts.Close()
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("web-identity-token"), 0o600))
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+	t.Setenv("VAULT_TOKEN", "vault-token")
+	t.Setenv("AWS_REGION", "eu-west-1")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "credentials"))
+	t.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", tokenFile)
+	t.Setenv("AWS_ROLE_ARN", "arn:aws:iam::123456789012:role/proxyd")
+	t.Setenv("AWS_ENDPOINT_URL_STS", sts.URL)
+
+	config := ReadConfig("secrets")
+	config.Secrets.Vault.Address = secretsServer.URL
+	config.Secrets.AWS.Endpoint = secretsServer.URL
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	send := func(secret string) int {
+		_, code, err := NewProxydClient("http://127.0.0.1:8545/"+secret).SendRPC("eth_chainId", nil)
+		require.NoError(t, err)
+		return code
+	}
+	lastRequest := func() *http.Request {
+		reqs := goodBackend.Requests()
+		require.NotEmpty(t, reqs)
+		return &http.Request{Header: reqs[len(reqs)-1].Headers}
+	}
+
+	t.Run("secrets are resolved", func(t *testing.T) {
+		require.Equal(t, 200, send("auth-key-1"))
+		require.Equal(t, 200, send("legacy-key-1"))
+		require.Equal(t, 401, send("auth-key-2"))
+
+		username, password, ok := lastRequest().BasicAuth()
+		require.True(t, ok)
+		require.Equal(t, "proxyd", username)
+		require.Equal(t, "password-1", password)
+		require.Equal(t, "api-key-1", lastRequest().Header.Get("X-Api-Key"))
+	})
+
+	t.Run("rotated secrets apply", func(t *testing.T) {
+		secrets.set("backend_password", "password-2")
+		secrets.set("api_key", "api-key-2")
+		secrets.set("auth_key", "auth-key-2")
+
+		require.Eventually(t, func() bool {
+			return send("auth-key-2") == 200
+		}, 5*time.Second, 50*time.Millisecond)
+		require.Equal(t, 401, send("auth-key-1"))
+		require.Equal(t, 200, send("legacy-key-1"))
+
+		require.Eventually(t, func() bool {
+			require.Equal(t, 200, send("auth-key-2"))
+			_, password, _ := lastRequest().BasicAuth()
+			return password == "password-2" && lastRequest().Header.Get("X-Api-Key") == "api-key-2"
+		}, 5*time.Second, 50*time.Millisecond)
+	})
+}
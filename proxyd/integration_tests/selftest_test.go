@@ -0,0 +1,83 @@
+package integration_tests
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/alicebob/miniredis"
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelfTest(t *testing.T) {
+	redis, err := miniredis.Run()
+	require.NoError(t, err)
+	defer redis.Close()
+
+	newBackend := func(chainID string) *MockBackend {
+		hdlr := NewBatchRPCResponseRouter()
+		hdlr.SetFallbackRoute("eth_chainId", chainID)
+		hdlr.SetFallbackRoute("net_version", "10")
+		hdlr.SetFallbackRoute("eth_blockNumber", "0x64")
+		hdlr.SetFallbackRoute("eth_getBlockByNumber", "block")
+		return NewMockBackend(hdlr)
+	}
+	good := newBackend("0xa")
+	defer good.Close()
+	other := newBackend("0x1")
+	defer other.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", good.URL()))
+	require.NoError(t, os.Setenv("OTHER_BACKEND_RPC_URL", other.URL()))
+	require.NoError(t, os.Setenv("REDIS_URL", fmt.Sprintf("redis://127.0.0.1:%s", redis.Port())))
+	config := ReadConfig("selftest")
+
+	checks := func(report *proxyd.SelfTestReport) map[string]*proxyd.SelfTestCheck {
+		m := make(map[string]*proxyd.SelfTestCheck)
+		for _, check := range report.Checks {
+			m[check.Name] = check
+		}
+		return m
+	}
+
+	t.Run("reports incoherent config and chain ids", func(t *testing.T) {
+		report := proxyd.SelfTest(context.Background(), config)
+		require.False(t, report.Passed)
+
+		results := checks(report)
+		require.True(t, results["method_mappings"].Passed)
+		require.False(t, results["backend_group:main"].Passed)
+		require.Contains(t, results["backend_group:main"].Error, "consensus_ban_period")
+		require.True(t, results["good"].Passed)
+		require.Equal(t, "10", results["good"].Details["chain_id"])
+		require.Equal(t, "0x64", results["good"].Details["block_number"])
+		require.True(t, results["other"].Passed)
+		require.False(t, results["chain_id:main"].Passed)
+		require.True(t, results["redis"].Passed)
+		require.Empty(t, redis.Keys())
+	})
+
+	t.Run("passes a coherent config", func(t *testing.T) {
+		config.BackendGroups["main"].ConsensusBanPeriod = proxyd.TOMLDuration(0)
+		require.NoError(t, os.Setenv("OTHER_BACKEND_RPC_URL", good.URL()))
+
+		report := proxyd.SelfTest(context.Background(), config)
+		require.True(t, report.Passed, "%+v", checks(report))
+	})
+
+	t.Run("reports unreachable backends and redis", func(t *testing.T) {
+		require.NoError(t, os.Setenv("OTHER_BACKEND_RPC_URL", "http://127.0.0.1:1"))
+		redis.Close()
+
+		report := proxyd.SelfTest(context.Background(), config)
+		require.False(t, report.Passed)
+
+		results := checks(report)
+		require.True(t, results["good"].Passed)
+		require.False(t, results["other"].Passed)
+		require.NotEmpty(t, results["other"].Error)
+		require.False(t, results["redis"].Passed)
+	})
+}
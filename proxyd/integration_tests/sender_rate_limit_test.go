@@ -2,14 +2,21 @@ package integration_tests
 
 import (
 	"bufio"
+	"crypto/ecdsa"
 	"fmt"
 	"math"
+	"math/big"
 	"os"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/holiman/uint256"
 	"github.com/stretchr/testify/require"
 )
 
@@ -124,3 +131,148 @@ func TestSenderRateLimitLimiting(t *testing.T) {
 func makeSendRawTransaction(dataHex string) []byte {
 	return []byte(`{"jsonrpc":"2.0","method":"eth_sendRawTransaction","params":["` + dataHex + `"],"id":1}`)
 }
+
+func TestSenderRateLimitBlobs(t *testing.T) {
+	goodBackend := NewMockBackend(SingleResponseHandler(200, dummyRes))
+	defer goodBackend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+
+	config := ReadConfig("sender_rate_limit")
+	config.SenderRateLimit.Limit = math.MaxInt
+	config.TxValidation.Enabled = true
+	config.TxValidation.MaxBlobsPerTx = 2
+	config.TxValidation.MinBlobFeeCap = big.NewInt(10)
+	config.SenderRateLimit.BlobLimit = 1
+	config.SenderRateLimit.BlobInterval = proxyd.TOMLDuration(time.Minute)
+	client := NewProxydClient("http://127.0.0.1:8545")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	signer := types.LatestSignerForChainID(big.NewInt(420))
+	sign := func(txData types.TxData) string {
+		tx, err := types.SignNewTx(key, signer, txData)
+		require.NoError(t, err)
+		data, err := tx.MarshalBinary()
+		require.NoError(t, err)
+		return hexutil.Encode(data)
+	}
+	blobTx := func(nonce uint64, blobs int, blobFeeCap uint64) string {
+		hashes := make([]common.Hash, blobs)
+		for i := range hashes {
+			hashes[i] = common.Hash{0x01, byte(i)}
+		}
+		return sign(&types.BlobTx{
+			ChainID:    uint256.NewInt(420),
+			Nonce:      nonce,
+			GasTipCap:  uint256.NewInt(1),
+			GasFeeCap:  uint256.NewInt(1),
+			Gas:        21000,
+			Value:      uint256.NewInt(0),
+			BlobFeeCap: uint256.NewInt(blobFeeCap),
+			BlobHashes: hashes,
+		})
+	}
+
+	res, code, err := client.SendRequest(makeSendRawTransaction(blobTx(0, 3, 10)))
+	require.NoError(t, err)
+	require.Equal(t, 400, code)
+	RequireEqualJSON(t, []byte(`{"error":{"code":-32602,"message":"too many blobs in transaction: have 3, permitted 2"},"id":1,"jsonrpc":"2.0"}`), res)
+
+	res, code, err = client.SendRequest(makeSendRawTransaction(blobTx(0, 1, 9)))
+	require.NoError(t, err)
+	require.Equal(t, 400, code)
+	RequireEqualJSON(t, []byte(`{"error":{"code":-32602,"message":"max fee per blob gas too low: have 9, minimum 10"},"id":1,"jsonrpc":"2.0"}`), res)
+
+	// blob transactions are limited per sender across nonces
+	res, code, err = client.SendRequest(makeSendRawTransaction(blobTx(0, 2, 10)))
+	require.NoError(t, err)
+	require.Equal(t, 200, code)
+	RequireEqualJSON(t, []byte(dummyRes), res)
+	res, code, err = client.SendRequest(makeSendRawTransaction(blobTx(1, 1, 10)))
+	require.NoError(t, err)
+	require.Equal(t, 429, code)
+	RequireEqualJSON(t, []byte(limRes), res)
+
+	// other transactions of the sender are not
+	to := common.HexToAddress("0x1234")
+	res, code, err = client.SendRequest(makeSendRawTransaction(sign(&types.DynamicFeeTx{
+		ChainID:   big.NewInt(420),
+		Nonce:     1,
+		GasTipCap: big.NewInt(1),
+		GasFeeCap: big.NewInt(1),
+		Gas:       21000,
+		To:        &to,
+	})))
+	require.NoError(t, err)
+	require.Equal(t, 200, code)
+	RequireEqualJSON(t, []byte(dummyRes), res)
+}
+
+func TestSenderRateLimitAllowlistAndContracts(t *testing.T) {
+	goodBackend := NewMockBackend(SingleResponseHandler(200, dummyRes))
+	defer goodBackend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+
+	relayerKey, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	spamContract := common.HexToAddress("0x5555")
+	otherContract := common.HexToAddress("0x1234")
+
+	config := ReadConfig("sender_rate_limit")
+	config.SenderRateLimit.Limit = math.MaxInt
+	config.SenderRateLimit.Allowlist = []string{crypto.PubkeyToAddress(relayerKey.PublicKey).Hex()}
+	config.SenderRateLimit.ContractLimits = map[string]*proxyd.SenderContractLimitConfig{
+		spamContract.Hex(): {Limit: 1, Interval: proxyd.TOMLDuration(time.Minute)},
+	}
+	client := NewProxydClient("http://127.0.0.1:8545")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	signer := types.LatestSignerForChainID(big.NewInt(420))
+	tx := func(key *ecdsa.PrivateKey, nonce uint64, to common.Address) []byte {
+		tx, err := types.SignNewTx(key, signer, &types.DynamicFeeTx{
+			ChainID:   big.NewInt(420),
+			Nonce:     nonce,
+			GasTipCap: big.NewInt(1),
+			GasFeeCap: big.NewInt(1),
+			Gas:       21000,
+			To:        &to,
+		})
+		require.NoError(t, err)
+		data, err := tx.MarshalBinary()
+		require.NoError(t, err)
+		return makeSendRawTransaction(hexutil.Encode(data))
+	}
+
+	// transactions to the contract are limited per sender across nonces
+	res, code, err := client.SendRequest(tx(key, 0, spamContract))
+	require.NoError(t, err)
+	require.Equal(t, 200, code)
+	RequireEqualJSON(t, []byte(dummyRes), res)
+	res, code, err = client.SendRequest(tx(key, 1, spamContract))
+	require.NoError(t, err)
+	require.Equal(t, 429, code)
+	RequireEqualJSON(t, []byte(limRes), res)
+
+	// transactions to other contracts are not
+	res, code, err = client.SendRequest(tx(key, 1, otherContract))
+	require.NoError(t, err)
+	require.Equal(t, 200, code)
+	RequireEqualJSON(t, []byte(dummyRes), res)
+
+	// allowlisted senders bypass the sender limits
+	for i := 0; i < 3; i++ {
+		res, code, err = client.SendRequest(tx(relayerKey, 0, spamContract))
+		require.NoError(t, err)
+		require.Equal(t, 200, code)
+		RequireEqualJSON(t, []byte(dummyRes), res)
+	}
+}
@@ -0,0 +1,72 @@
+package integration_tests
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeFromLVC(t *testing.T) {
+	goodBackend := NewMockBackend(SingleResponseHandler(200, dummyRes))
+	defer goodBackend.Close()
+
+	syncRouter := NewBatchRPCResponseRouter()
+	syncRouter.SetFallbackRoute("eth_blockNumber", "0x10")
+	syncRouter.SetFallbackRoute("eth_gasPrice", "0x3b9aca00")
+	syncRouter.SetFallbackRoute("eth_maxPriorityFeePerGas", "0x1")
+	syncBackend := NewMockBackend(syncRouter)
+	defer syncBackend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+	require.NoError(t, os.Setenv("SYNC_BACKEND_RPC_URL", syncBackend.URL()))
+
+	client := NewProxydClient("http://127.0.0.1:8545")
+
+	t.Run("serves fresh values", func(t *testing.T) {
+		goodBackend.Reset()
+		config := ReadConfig("serve_from_lvc")
+		_, shutdown, err := proxyd.Start(config)
+		require.NoError(t, err)
+		defer shutdown()
+
+		// wait for the LVCs to be polled
+		time.Sleep(1500 * time.Millisecond)
+
+		tests := []struct {
+			method string
+			res    string
+		}{
+			{"eth_blockNumber", `{"jsonrpc":"2.0","result":"0x10","id":999}`},
+			{"eth_gasPrice", `{"jsonrpc":"2.0","result":"0x3b9aca00","id":999}`},
+			{"eth_maxPriorityFeePerGas", `{"jsonrpc":"2.0","result":"0x1","id":999}`},
+		}
+		for _, tt := range tests {
+			res, code, err := client.SendRPC(tt.method, nil)
+			require.NoError(t, err)
+			require.Equal(t, 200, code)
+			RequireEqualJSON(t, []byte(tt.res), res)
+		}
+		require.Equal(t, 0, len(goodBackend.Requests()))
+	})
+
+	t.Run("forwards stale values", func(t *testing.T) {
+		goodBackend.Reset()
+		config := ReadConfig("serve_from_lvc")
+		config.Cache.ServeFromLVC.MaxStaleness = proxyd.TOMLDuration(time.Nanosecond)
+		config.Cache.ServeFromLVC.Methods = []string{"eth_gasPrice"}
+		_, shutdown, err := proxyd.Start(config)
+		require.NoError(t, err)
+		defer shutdown()
+
+		time.Sleep(1500 * time.Millisecond)
+
+		res, code, err := client.SendRPC("eth_gasPrice", nil)
+		require.NoError(t, err)
+		require.Equal(t, 200, code)
+		RequireEqualJSON(t, []byte(dummyRes), res)
+		require.Equal(t, 1, len(goodBackend.Requests()))
+	})
+}
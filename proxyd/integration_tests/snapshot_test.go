@@ -0,0 +1,98 @@
+package integration_tests
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotBatches(t *testing.T) {
+	router := NewBatchRPCResponseRouter()
+	router.SetFallbackRoute("eth_blockNumber", "0x10")
+	router.SetFallbackRoute("eth_chainId", "0x1")
+	router.SetFallbackRoute("eth_getBalance", "0x2")
+	router.SetFallbackRoute("eth_call", "0x3")
+	router.SetFallbackRoute("eth_getTransactionReceipt", nil)
+	goodBackend := NewMockBackend(router)
+	defer goodBackend.Close()
+	badBackend := NewMockBackend(SingleResponseHandler(503, "unavailable"))
+	defer badBackend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+	require.NoError(t, os.Setenv("BAD_BACKEND_RPC_URL", badBackend.URL()))
+
+	config := ReadConfig("snapshot")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	headers := http.Header{}
+	headers.Set(proxyd.SnapshotHeader, "true")
+	client := NewProxydClientWithHeaders("http://127.0.0.1:8545", headers)
+
+	// cached responses are not used by snapshots
+	_, _, err = client.SendRPC("eth_chainId", nil)
+	require.NoError(t, err)
+	goodBackend.Reset()
+
+	res, code, err := client.SendBatchRPC(
+		NewRPCReq("1", "eth_chainId", nil),
+		NewRPCReq("2", "eth_getBalance", []interface{}{"0xabc", "latest"}),
+		NewRPCReq("3", "eth_call", []interface{}{map[string]string{"to": "0xabc"}}),
+		NewRPCReq("4", "eth_getBalance", []interface{}{"0xabc", "0x5"}),
+		NewRPCReq("5", "eth_getTransactionReceipt", []interface{}{"0xdef"}),
+	)
+	require.NoError(t, err)
+	require.Equal(t, 200, code)
+	RequireEqualJSON(t, []byte(asArray(
+		`{"jsonrpc":"2.0","result":"0x1","id":1}`,
+		`{"jsonrpc":"2.0","result":"0x2","id":2}`,
+		`{"jsonrpc":"2.0","result":"0x3","id":3}`,
+		`{"jsonrpc":"2.0","result":"0x2","id":4}`,
+		`{"jsonrpc":"2.0","result":null,"id":5}`,
+	)), res)
+
+	// the block number, then the pinned batch, were sent to the good backend
+	require.Len(t, goodBackend.Requests(), 2)
+	RequireEqualJSON(t, []byte(asArray(
+		`{"jsonrpc":"2.0","method":"eth_chainId","params":null,"id":1}`,
+		`{"jsonrpc":"2.0","method":"eth_getBalance","params":["0xabc","0x10"],"id":2}`,
+		`{"jsonrpc":"2.0","method":"eth_call","params":[{"to":"0xabc"},"0x10"],"id":3}`,
+		`{"jsonrpc":"2.0","method":"eth_getBalance","params":["0xabc","0x5"],"id":4}`,
+		`{"jsonrpc":"2.0","method":"eth_getTransactionReceipt","params":["0xdef"],"id":5}`,
+	)), goodBackend.Requests()[1].Body)
+
+	t.Run("reports the snapshot block", func(t *testing.T) {
+		req, err := http.NewRequest("POST", "http://127.0.0.1:8545", strings.NewReader(asArray(
+			`{"jsonrpc":"2.0","method":"eth_getBalance","params":["0xabc","latest"],"id":1}`,
+			`{"jsonrpc":"2.0","method":"eth_chainId","params":[],"id":2}`,
+		)))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(proxyd.SnapshotHeader, "true")
+		httpRes, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer httpRes.Body.Close()
+		require.Equal(t, 200, httpRes.StatusCode)
+		require.Equal(t, "0x10", httpRes.Header.Get(proxyd.SnapshotBlockHeader))
+	})
+
+	t.Run("batches spanning backend groups are rejected", func(t *testing.T) {
+		goodBackend.Reset()
+		res, code, err := client.SendBatchRPC(
+			NewRPCReq("1", "eth_chainId", nil),
+			NewRPCReq("2", "net_version", nil),
+		)
+		require.NoError(t, err)
+		require.Equal(t, 200, code)
+		RequireEqualJSON(t, []byte(asArray(
+			`{"jsonrpc":"2.0","error":{"code":-32600,"message":"snapshot batches must have unique IDs and methods of a single backend group"},"id":1}`,
+			`{"jsonrpc":"2.0","error":{"code":-32600,"message":"snapshot batches must have unique IDs and methods of a single backend group"},"id":2}`,
+		)), res)
+		require.Len(t, goodBackend.Requests(), 0)
+	})
+}
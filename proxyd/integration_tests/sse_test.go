@@ -0,0 +1,200 @@
+package integration_tests
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSSE(t *testing.T) {
+	var mtx sync.Mutex
+	subConns := make(map[string]*websocket.Conn)
+	subscribed := make(chan string, 8)
+	unsubscribed := make(chan string, 8)
+
+	backend := NewMockWSBackend(nil, func(conn *websocket.Conn, msgType int, data []byte) {
+		req, err := proxyd.ParseRPCReq(data)
+		require.NoError(t, err)
+
+		switch req.Method {
+		case "eth_subscribe":
+			var params []json.RawMessage
+			require.NoError(t, json.Unmarshal(req.Params, &params))
+			var typ string
+			require.NoError(t, json.Unmarshal(params[0], &typ))
+			mtx.Lock()
+			subConns[typ] = conn
+			mtx.Unlock()
+			require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":%s,"result":"0x%s"}`, req.ID, typ))))
+			subscribed <- string(req.Params)
+		case "eth_unsubscribe":
+			var params []string
+			require.NoError(t, json.Unmarshal(req.Params, &params))
+			unsubscribed <- params[0]
+			require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":%s,"result":true}`, req.ID))))
+		}
+	}, nil)
+	defer backend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", backend.URL()))
+
+	config := ReadConfig("sse")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	notify := func(typ string, result string) {
+		mtx.Lock()
+		conn := subConns[typ]
+		mtx.Unlock()
+		require.NotNil(t, conn)
+		msg := fmt.Sprintf(`{"jsonrpc":"2.0","method":"eth_subscription","params":{"subscription":"0x%s","result":%s}}`, typ, result)
+		require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(msg)))
+	}
+
+	type stream struct {
+		res    *http.Response
+		events chan string
+	}
+	open := func(t *testing.T, path string) *http.Response {
+		res, err := http.Get("http://127.0.0.1:8545" + path)
+		require.NoError(t, err)
+		t.Cleanup(func() { res.Body.Close() })
+		return res
+	}
+	subscribe := func(t *testing.T, path string) *stream {
+		res := open(t, path)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+		s := &stream{res: res, events: make(chan string, 16)}
+		go func() {
+			defer close(s.events)
+			scanner := bufio.NewScanner(res.Body)
+			for scanner.Scan() {
+				if line := scanner.Text(); line != "" {
+					s.events <- line
+				}
+			}
+		}()
+		return s
+	}
+	// next returns the data of the next event of s, skipping keepalives.
+	next := func(t *testing.T, s *stream) map[string]interface{} {
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case line, ok := <-s.events:
+				require.True(t, ok, "stream closed")
+				if strings.HasPrefix(line, ":") {
+					continue
+				}
+				require.True(t, strings.HasPrefix(line, "data: "), line)
+				var out map[string]interface{}
+				require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &out))
+				return out
+			case <-timeout:
+				t.Fatal("no event received")
+				return nil
+			}
+		}
+	}
+	readErr := func(t *testing.T, res *http.Response) map[string]interface{} {
+		var out map[string]interface{}
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&out))
+		require.NotNil(t, out["error"])
+		return out["error"].(map[string]interface{})
+	}
+
+	t.Run("newHeads", func(t *testing.T) {
+		a := subscribe(t, "/open_secret/subscribe/newHeads")
+		require.Equal(t, `["newHeads"]`, <-subscribed)
+		b := subscribe(t, "/open_secret/subscribe/newHeads")
+
+		notify("newHeads", `{"number":"0x1"}`)
+		for _, s := range []*stream{a, b} {
+			notification := next(t, s)
+			require.Equal(t, "eth_subscription", notification["method"])
+			params := notification["params"].(map[string]interface{})
+			require.Equal(t, map[string]interface{}{"number": "0x1"}, params["result"])
+		}
+
+		// the upstream subscription is removed with its last stream
+		a.res.Body.Close()
+		b.res.Body.Close()
+		select {
+		case id := <-unsubscribed:
+			require.Equal(t, "0xnewHeads", id)
+		case <-time.After(5 * time.Second):
+			t.Fatal("upstream subscription wasn't removed")
+		}
+	})
+
+	t.Run("logs", func(t *testing.T) {
+		filter := `{"address":"0x0000000000000000000000000000000000000001"}`
+		s := subscribe(t, "/open_secret/subscribe/logs?filter="+url.QueryEscape(filter))
+		require.JSONEq(t, `["logs",`+filter+`]`, <-subscribed)
+		notify("logs", `{"address":"0x0000000000000000000000000000000000000001","topics":[]}`)
+		params := next(t, s)["params"].(map[string]interface{})
+		require.Equal(t, "0x0000000000000000000000000000000000000001", params["result"].(map[string]interface{})["address"])
+	})
+
+	t.Run("keepalive", func(t *testing.T) {
+		s := subscribe(t, "/open_secret/subscribe/newHeads")
+		select {
+		case line := <-s.events:
+			require.Equal(t, ": keepalive", line)
+		case <-time.After(5 * time.Second):
+			t.Fatal("no keepalive received")
+		}
+	})
+
+	t.Run("unsupported subscription", func(t *testing.T) {
+		res := open(t, "/open_secret/subscribe/newPendingTransactions")
+		require.Equal(t, http.StatusBadRequest, res.StatusCode)
+		require.Equal(t, float64(proxyd.ErrInvalidParams("").Code), readErr(t, res)["code"])
+	})
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		res := open(t, "/subscribe/newHeads")
+		require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	})
+
+	t.Run("method not allowed for key", func(t *testing.T) {
+		res := open(t, "/rpc_secret/subscribe/newHeads")
+		require.Equal(t, float64(proxyd.ErrMethodNotWhitelisted.Code), readErr(t, res)["code"])
+	})
+
+	t.Run("rate limited", func(t *testing.T) {
+		subscribe(t, "/limited_secret/subscribe/newHeads")
+		res := open(t, "/limited_secret/subscribe/newHeads")
+		require.Equal(t, http.StatusTooManyRequests, res.StatusCode)
+		require.Equal(t, float64(proxyd.ErrOverRateLimit.Code), readErr(t, res)["code"])
+	})
+
+	t.Run("shutdown ends streams", func(t *testing.T) {
+		s := subscribe(t, "/open_secret/subscribe/newHeads")
+		shutdown()
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case _, ok := <-s.events:
+				if !ok {
+					return
+				}
+			case <-timeout:
+				t.Fatal("stream wasn't ended")
+			}
+		}
+	})
+}
@@ -0,0 +1,37 @@
+-- rejects eth_sign, routes historical balances to the archive group, renames
+-- eth_getChainId, spins forever on eth_spin, counts eth_count calls and
+-- reports the unsafe functions it can reach on eth_unsafe
+function handle(req)
+  if req.method == "eth_sign" then
+    return { reject = "signing is not supported", code = -32000 }
+  end
+  if req.method == "eth_getBalance" and req.params[2] == "earliest" then
+    return { group = "archive", params = { req.params[1], "0x0" } }
+  end
+  if req.method == "eth_getChainId" then
+    return { method = "eth_chainId", params = {} }
+  end
+  if req.method == "eth_spin" then
+    while true do end
+  end
+  if req.method == "eth_count" then
+    calls = (calls or 0) + 1
+    return { reject = tostring(calls) }
+  end
+  if req.method == "eth_unsafe" then
+    local reachable = {
+      load = load, loadstring = loadstring, print = print,
+      collectgarbage = collectgarbage, setfenv = setfenv, _G = _G,
+      rep = string.rep, format = string.format,
+    }
+    local found = {}
+    for name in pairs(reachable) do
+      table.insert(found, name)
+    end
+    return { reject = "reachable: " .. table.concat(found, ",") }
+  end
+  if req.method == "eth_unknownGroup" then
+    return { group = "missing" }
+  end
+  return nil
+end
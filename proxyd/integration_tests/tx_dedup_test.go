@@ -0,0 +1,85 @@
+package integration_tests
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/stretchr/testify/require"
+)
+
+const txHashRes = `{"id":1,"jsonrpc":"2.0","result":"0x5a1b"}`
+
+func TestTxDedup(t *testing.T) {
+	goodBackend := NewMockBackend(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		SingleResponseHandler(200, txHashRes)(w, r)
+	}))
+	defer goodBackend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+
+	config := ReadConfig("tx_dedup")
+	client := NewProxydClient("http://127.0.0.1:8545")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	sendTx := func(t *testing.T, id int, data string) {
+		res, code, err := client.SendRequest([]byte(fmt.Sprintf(`{"jsonrpc":"2.0","method":"eth_sendRawTransaction","params":["%s"],"id":%d}`, data, id)))
+		require.NoError(t, err)
+		require.Equal(t, 200, code)
+		RequireEqualJSON(t, []byte(fmt.Sprintf(`{"id":%d,"jsonrpc":"2.0","result":"0x5a1b"}`, id)), res)
+	}
+
+	t.Run("re-submissions are not forwarded", func(t *testing.T) {
+		goodBackend.Reset()
+		for i := 1; i <= 5; i++ {
+			sendTx(t, i, "0x01")
+		}
+		require.Equal(t, 1, len(goodBackend.Requests()))
+	})
+
+	t.Run("concurrent submissions share a single call", func(t *testing.T) {
+		goodBackend.Reset()
+		var wg sync.WaitGroup
+		for i := 1; i <= 10; i++ {
+			wg.Add(1)
+			go func(id int) {
+				defer wg.Done()
+				sendTx(t, id, "0x02")
+			}(i)
+		}
+		wg.Wait()
+		require.Equal(t, 1, len(goodBackend.Requests()))
+	})
+
+	t.Run("different transactions are forwarded", func(t *testing.T) {
+		goodBackend.Reset()
+		sendTx(t, 1, "0x03")
+		sendTx(t, 1, "0x04")
+		require.Equal(t, 2, len(goodBackend.Requests()))
+	})
+
+	t.Run("error responses are not kept", func(t *testing.T) {
+		goodBackend.Reset()
+		goodBackend.SetHandler(SingleResponseHandler(200, `{"id":1,"jsonrpc":"2.0","error":{"code":-32000,"message":"nonce too low"}}`))
+		_, _, err := client.SendRequest([]byte(`{"jsonrpc":"2.0","method":"eth_sendRawTransaction","params":["0x06"],"id":1}`))
+		require.NoError(t, err)
+		goodBackend.SetHandler(SingleResponseHandler(200, txHashRes))
+		sendTx(t, 1, "0x06")
+		require.Equal(t, 2, len(goodBackend.Requests()))
+	})
+
+	t.Run("re-submissions after the window are forwarded", func(t *testing.T) {
+		goodBackend.Reset()
+		sendTx(t, 1, "0x05")
+		time.Sleep(600 * time.Millisecond)
+		sendTx(t, 1, "0x05")
+		require.Equal(t, 2, len(goodBackend.Requests()))
+	})
+}
@@ -0,0 +1,98 @@
+package integration_tests
+
+import (
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTxNonce(t *testing.T) {
+	var nonceCalls atomic.Int32
+	goodBackend := NewMockBackend(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		if !proxyd.IsBatch(body) {
+			_, _ = w.Write([]byte(dummyRes))
+			return
+		}
+		var reqs []*proxyd.RPCReq
+		require.NoError(t, json.Unmarshal(body, &reqs))
+		nonceCalls.Add(1)
+		out := make([]*proxyd.RPCRes, len(reqs))
+		for i, req := range reqs {
+			var params []string
+			require.NoError(t, json.Unmarshal(req.Params, &params))
+			// the sender has 5 included and 2 pending transactions
+			nonce := "0x5"
+			if params[1] == "pending" {
+				nonce = "0x7"
+			}
+			out[i] = &proxyd.RPCRes{JSONRPC: proxyd.JSONRPCVersion, Result: nonce, ID: req.ID}
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(out))
+	}))
+	defer goodBackend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+
+	config := ReadConfig("tx_nonce")
+	client := NewProxydClient("http://127.0.0.1:8545")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	to := common.HexToAddress("0x1234")
+	sendTx := func(nonce uint64) ([]byte, int) {
+		tx, err := types.SignNewTx(key, types.LatestSignerForChainID(big.NewInt(420)), &types.DynamicFeeTx{
+			ChainID:   big.NewInt(420),
+			Nonce:     nonce,
+			GasTipCap: big.NewInt(1),
+			GasFeeCap: big.NewInt(1),
+			Gas:       21000,
+			To:        &to,
+		})
+		require.NoError(t, err)
+		data, err := tx.MarshalBinary()
+		require.NoError(t, err)
+		res, code, err := client.SendRequest(makeSendRawTransaction(hexutil.Encode(data)))
+		require.NoError(t, err)
+		return res, code
+	}
+
+	res, code := sendTx(4)
+	require.Equal(t, 400, code)
+	RequireEqualJSON(t, []byte(`{"error":{"code":-32000,"message":"nonce too low: next nonce 5, tx nonce 4"},"id":1,"jsonrpc":"2.0"}`), res)
+
+	// replacements of pending transactions are accepted
+	res, code = sendTx(5)
+	require.Equal(t, 200, code)
+	RequireEqualJSON(t, []byte(dummyRes), res)
+
+	res, code = sendTx(10)
+	require.Equal(t, 400, code)
+	RequireEqualJSON(t, []byte(`{"error":{"code":-32000,"message":"nonce too high: pending nonce 7, tx nonce 10, maximum gap 2"},"id":1,"jsonrpc":"2.0"}`), res)
+
+	// accepted transactions advance the pending nonce
+	res, code = sendTx(9)
+	require.Equal(t, 200, code)
+	RequireEqualJSON(t, []byte(dummyRes), res)
+	res, code = sendTx(12)
+	require.Equal(t, 200, code)
+	RequireEqualJSON(t, []byte(dummyRes), res)
+
+	// nonces are only fetched once
+	require.Equal(t, int32(1), nonceCalls.Load())
+}
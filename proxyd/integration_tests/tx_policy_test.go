@@ -0,0 +1,128 @@
+package integration_tests
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis"
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+const policyRes = `{"error":{"code":-32026,"message":"transaction rejected by policy"},"id":1,"jsonrpc":"2.0"}`
+
+func TestTxPolicy(t *testing.T) {
+	redis, err := miniredis.Run()
+	require.NoError(t, err)
+	defer redis.Close()
+
+	goodBackend := NewMockBackend(SingleResponseHandler(200, dummyRes))
+	defer goodBackend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+	require.NoError(t, os.Setenv("REDIS_URL", fmt.Sprintf("redis://127.0.0.1:%s", redis.Port())))
+
+	newKey := func() (*ecdsa.PrivateKey, common.Address) {
+		key, err := crypto.GenerateKey()
+		require.NoError(t, err)
+		return key, crypto.PubkeyToAddress(key.PublicKey)
+	}
+	goodKey, goodAddr := newKey()
+	fileKey, fileAddr := newKey()
+	urlKey, urlAddr := newKey()
+	redisKey, redisAddr := newKey()
+
+	file := filepath.Join(t.TempDir(), "blocklist.txt")
+	require.NoError(t, os.WriteFile(file, []byte("# sanctioned\n"+fileAddr.Hex()+"\n"), 0o644))
+	list := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(urlAddr.Hex() + "\n"))
+	}))
+	defer list.Close()
+
+	client := NewProxydClient("http://127.0.0.1:8545")
+	sendTx := func(key *ecdsa.PrivateKey, to common.Address) ([]byte, int) {
+		tx, err := types.SignNewTx(key, types.LatestSignerForChainID(big.NewInt(420)), &types.DynamicFeeTx{
+			ChainID:   big.NewInt(420),
+			GasTipCap: big.NewInt(1),
+			GasFeeCap: big.NewInt(1),
+			Gas:       21000,
+			To:        &to,
+		})
+		require.NoError(t, err)
+		data, err := tx.MarshalBinary()
+		require.NoError(t, err)
+		res, code, err := client.SendRequest(makeSendRawTransaction(hexutil.Encode(data)))
+		require.NoError(t, err)
+		return res, code
+	}
+	to := common.HexToAddress("0x1234")
+
+	t.Run("blocklist", func(t *testing.T) {
+		config := ReadConfig("tx_policy")
+		config.TxPolicy.Blocklist.File = file
+		config.TxPolicy.Blocklist.URL = list.URL
+		_, shutdown, err := proxyd.Start(config)
+		require.NoError(t, err)
+		defer shutdown()
+
+		res, code := sendTx(goodKey, to)
+		require.Equal(t, 200, code)
+		RequireEqualJSON(t, []byte(dummyRes), res)
+
+		// blocked recipient
+		res, code = sendTx(goodKey, common.HexToAddress("0x000000000000000000000000000000000000dEaD"))
+		require.Equal(t, 403, code)
+		RequireEqualJSON(t, []byte(policyRes), res)
+
+		// blocked senders, from the file and the URL
+		for _, key := range []*ecdsa.PrivateKey{fileKey, urlKey} {
+			res, code = sendTx(key, to)
+			require.Equal(t, 403, code)
+			RequireEqualJSON(t, []byte(policyRes), res)
+		}
+
+		// the lists are refreshed
+		res, code = sendTx(redisKey, to)
+		require.Equal(t, 200, code)
+		_, err = redis.SetAdd("tx_policy:blocklist", redisAddr.Hex())
+		require.NoError(t, err)
+		require.Eventually(t, func() bool {
+			_, code := sendTx(redisKey, to)
+			return code == 403
+		}, 5*time.Second, 50*time.Millisecond)
+	})
+
+	t.Run("allowlist", func(t *testing.T) {
+		config := ReadConfig("tx_policy")
+		config.TxPolicy.Allowlist.Addresses = []string{goodAddr.Hex()}
+		_, shutdown, err := proxyd.Start(config)
+		require.NoError(t, err)
+		defer shutdown()
+
+		res, code := sendTx(goodKey, to)
+		require.Equal(t, 200, code)
+		RequireEqualJSON(t, []byte(dummyRes), res)
+
+		res, code = sendTx(urlKey, to)
+		require.Equal(t, 403, code)
+		RequireEqualJSON(t, []byte(policyRes), res)
+	})
+
+	t.Run("unreadable lists prevent startup", func(t *testing.T) {
+		config := ReadConfig("tx_policy")
+		config.TxPolicy.Blocklist.File = filepath.Join(t.TempDir(), "missing.txt")
+		_, _, err := proxyd.Start(config)
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,98 @@
+package integration_tests
+
+import (
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTxValidation(t *testing.T) {
+	goodBackend := NewMockBackend(SingleResponseHandler(200, dummyRes))
+	defer goodBackend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+
+	config := ReadConfig("tx_validation")
+	client := NewProxydClient("http://127.0.0.1:8545")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	to := common.HexToAddress("0x1234")
+	tx := func(chainID int64, gas uint64, gasFeeCap int64) *types.DynamicFeeTx {
+		return &types.DynamicFeeTx{
+			ChainID:   big.NewInt(chainID),
+			GasTipCap: big.NewInt(1),
+			GasFeeCap: big.NewInt(gasFeeCap),
+			Gas:       gas,
+			To:        &to,
+		}
+	}
+	sign := func(txData *types.DynamicFeeTx) string {
+		tx, err := types.SignNewTx(key, types.LatestSignerForChainID(txData.ChainID), txData)
+		require.NoError(t, err)
+		data, err := tx.MarshalBinary()
+		require.NoError(t, err)
+		return hexutil.Encode(data)
+	}
+	blobTx := func(blobs int, blobFeeCap uint64) string {
+		hashes := make([]common.Hash, blobs)
+		for i := range hashes {
+			hashes[i] = common.Hash{0x01, byte(i)}
+		}
+		tx, err := types.SignNewTx(key, types.LatestSignerForChainID(big.NewInt(420)), &types.BlobTx{
+			ChainID:    uint256.NewInt(420),
+			GasTipCap:  uint256.NewInt(1),
+			GasFeeCap:  uint256.NewInt(100),
+			Gas:        21000,
+			To:         to,
+			BlobFeeCap: uint256.NewInt(blobFeeCap),
+			BlobHashes: hashes,
+		})
+		require.NoError(t, err)
+		data, err := tx.MarshalBinary()
+		require.NoError(t, err)
+		return hexutil.Encode(data)
+	}
+	unsigned := func(txData *types.DynamicFeeTx) string {
+		txData.V, txData.R, txData.S = big.NewInt(0), big.NewInt(0), big.NewInt(0)
+		data, err := types.NewTx(txData).MarshalBinary()
+		require.NoError(t, err)
+		return hexutil.Encode(data)
+	}
+
+	tests := []struct {
+		name string
+		tx   string
+		code int
+		res  string
+	}{
+		{"valid", sign(tx(420, 21000, 100)), 200, dummyRes},
+		{"wrong chain id", sign(tx(10, 21000, 100)), 400, `{"error":{"code":-32602,"message":"transaction chain id not allowed: 10"},"id":1,"jsonrpc":"2.0"}`},
+		{"gas limit too high", sign(tx(420, 1000001, 100)), 400, `{"error":{"code":-32602,"message":"transaction gas limit too high: have 1000001, maximum 1000000"},"id":1,"jsonrpc":"2.0"}`},
+		{"fee cap too low", sign(tx(420, 21000, 99)), 400, `{"error":{"code":-32602,"message":"max fee per gas too low: have 99, minimum 100"},"id":1,"jsonrpc":"2.0"}`},
+		{"blob tx", blobTx(2, 10), 200, dummyRes},
+		{"too many blobs", blobTx(3, 10), 400, `{"error":{"code":-32602,"message":"too many blobs in transaction: have 3, permitted 2"},"id":1,"jsonrpc":"2.0"}`},
+		{"blob fee cap too low", blobTx(1, 9), 400, `{"error":{"code":-32602,"message":"max fee per blob gas too low: have 9, minimum 10"},"id":1,"jsonrpc":"2.0"}`},
+		{"invalid signature", unsigned(tx(420, 21000, 100)), 400, `{"error":{"code":-32602,"message":"invalid transaction v, r, s values"},"id":1,"jsonrpc":"2.0"}`},
+		{"malformed", "0x02c0", 400, `{"error":{"code":-32602,"message":"rlp: too few elements for types.DynamicFeeTx"},"id":1,"jsonrpc":"2.0"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, code, err := client.SendRequest(makeSendRawTransaction(tt.tx))
+			require.NoError(t, err)
+			require.Equal(t, tt.code, code)
+			RequireEqualJSON(t, []byte(tt.res), res)
+		})
+	}
+}
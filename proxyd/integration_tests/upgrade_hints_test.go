@@ -0,0 +1,57 @@
+package integration_tests
+
+import (
+	"os"
+	"testing"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/stretchr/testify/require"
+)
+
+const upgradeRequiredResponse = `{"error":{"code":-32022,"message":"polling limit exceeded, use a websocket subscription instead"},"id":999,"jsonrpc":"2.0"}`
+
+func TestUpgradeHints(t *testing.T) {
+	goodBackend := NewMockBackend(BatchedResponseHandler(200, goodResponse))
+	defer goodBackend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", goodBackend.URL()))
+
+	config := ReadConfig("upgrade_hints")
+	client := NewProxydClient("http://127.0.0.1:8545")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	t.Run("non-polling methods are never hinted", func(t *testing.T) {
+		for i := 0; i < 5; i++ {
+			_, code, headers, err := client.SendRPCWithHeaders("eth_chainId", nil)
+			require.NoError(t, err)
+			require.Equal(t, 200, code)
+			require.Empty(t, headers.Get("X-Proxyd-Subscription-Available"))
+		}
+	})
+
+	t.Run("polling clients are hinted then required to upgrade", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			_, code, headers, err := client.SendRPCWithHeaders("eth_blockNumber", nil)
+			require.NoError(t, err)
+			require.Equal(t, 200, code)
+			require.Empty(t, headers.Get("X-Proxyd-Subscription-Available"))
+		}
+
+		for i := 0; i < 2; i++ {
+			res, code, headers, err := client.SendRPCWithHeaders("eth_blockNumber", nil)
+			require.NoError(t, err)
+			require.Equal(t, 200, code)
+			RequireEqualJSON(t, []byte(goodResponse), res)
+			require.Equal(t, "wss://example.com/ws", headers.Get("X-Proxyd-Subscription-Available"))
+			require.Equal(t, "h2=\":443\"", headers.Get("Alt-Svc"))
+		}
+
+		res, code, headers, err := client.SendRPCWithHeaders("eth_blockNumber", nil)
+		require.NoError(t, err)
+		require.Equal(t, 426, code)
+		require.Equal(t, "websocket", headers.Get("Upgrade"))
+		RequireEqualJSON(t, []byte(upgradeRequiredResponse), res)
+	})
+}
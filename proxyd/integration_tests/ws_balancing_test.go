@@ -0,0 +1,109 @@
+package integration_tests
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWSBalancing(t *testing.T) {
+	connected := make(chan string, 16)
+	closed := make(chan string, 16)
+	newBackend := func(name string) *MockWSBackend {
+		return NewMockWSBackend(func(conn *websocket.Conn) {
+			connected <- name
+		}, func(conn *websocket.Conn, msgType int, data []byte) {
+			require.NoError(t, conn.WriteMessage(msgType, []byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`)))
+		}, func(conn *websocket.Conn, err error) {
+			closed <- name
+		})
+	}
+	first := newBackend("first")
+	defer first.Close()
+	second := newBackend("second")
+	defer second.Close()
+
+	require.NoError(t, os.Setenv("FIRST_BACKEND_RPC_URL", first.URL()))
+	require.NoError(t, os.Setenv("SECOND_BACKEND_RPC_URL", second.URL()))
+
+	start := func(t *testing.T, sticky bool) {
+		config := ReadConfig("ws_balancing")
+		config.WSBalancing.Sticky = sticky
+		_, shutdown, err := proxyd.Start(config)
+		require.NoError(t, err)
+		t.Cleanup(shutdown)
+	}
+	// dial connects a client with the auth key secret, and returns the
+	// backend it was proxied to once proxied.
+	dial := func(t *testing.T, secret string) (*websocket.Conn, string) {
+		conn, _, err := websocket.DefaultDialer.Dial("ws://127.0.0.1:8546/"+secret, nil) // nolint:bodyclose
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+		var name string
+		select {
+		case name = <-connected:
+		case <-time.After(5 * time.Second):
+			t.Fatal("no backend connection")
+		}
+		require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(`{"jsonrpc":"2.0","id":1,"method":"eth_chainId"}`)))
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		_, _, err = conn.ReadMessage()
+		require.NoError(t, err)
+		return conn, name
+	}
+	// drainClosed forgets the backend conns closed by previous subtests.
+	drainClosed := func() {
+		for {
+			select {
+			case <-closed:
+			case <-time.After(100 * time.Millisecond):
+				return
+			}
+		}
+	}
+	awaitClosed := func(t *testing.T, backend string) {
+		select {
+		case name := <-closed:
+			require.Equal(t, backend, name)
+		case <-time.After(5 * time.Second):
+			t.Fatal("backend connection wasn't closed")
+		}
+	}
+
+	t.Run("least connections", func(t *testing.T) {
+		start(t, false)
+		a, backendA := dial(t, "alice_secret")
+		require.Equal(t, "first", backendA)
+		_, backendB := dial(t, "alice_secret")
+		require.Equal(t, "second", backendB)
+		_, backendC := dial(t, "bob_secret")
+		require.Equal(t, "first", backendC)
+
+		// the first backend has the fewest clients once a is closed
+		require.NoError(t, a.Close())
+		awaitClosed(t, "first")
+		_, backendD := dial(t, "bob_secret")
+		require.Equal(t, "first", backendD)
+	})
+
+	t.Run("sticky", func(t *testing.T) {
+		drainClosed()
+		start(t, true)
+		_, backendA := dial(t, "alice_secret")
+		require.Equal(t, "first", backendA)
+		_, backendB := dial(t, "bob_secret")
+		require.Equal(t, "second", backendB)
+
+		// clients of the same key stick to its backend
+		a, backendA2 := dial(t, "alice_secret")
+		require.Equal(t, "first", backendA2)
+		require.NoError(t, a.Close())
+		awaitClosed(t, "first")
+		_, backendA3 := dial(t, "alice_secret")
+		require.Equal(t, "first", backendA3)
+	})
+}
@@ -0,0 +1,97 @@
+package integration_tests
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+// countingConn counts the bytes read from a connection.
+type countingConn struct {
+	net.Conn
+	read *atomic.Int64
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.read.Add(int64(n))
+	return n, err
+}
+
+func TestWSCompression(t *testing.T) {
+	result := strings.Repeat("0x00", 4096)
+	backend := NewMockWSBackend(nil, func(conn *websocket.Conn, msgType int, data []byte) {
+		req, err := proxyd.ParseRPCReq(data)
+		require.NoError(t, err)
+		require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":%s,"result":"%s"}`, req.ID, result))))
+	}, nil)
+	defer backend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", backend.URL()))
+
+	_, shutdown, err := proxyd.Start(ReadConfig("ws_compression"))
+	require.NoError(t, err)
+	defer shutdown()
+
+	// dial returns a connection, whether it negotiated compression, and the
+	// bytes read from it
+	dial := func(compress bool) (*websocket.Conn, bool, *atomic.Int64) {
+		read := new(atomic.Int64)
+		dialer := &websocket.Dialer{
+			EnableCompression: compress,
+			NetDial: func(network, addr string) (net.Conn, error) {
+				conn, err := net.Dial(network, addr)
+				if err != nil {
+					return nil, err
+				}
+				return &countingConn{Conn: conn, read: read}, nil
+			},
+		}
+		conn, res, err := dialer.Dial("ws://127.0.0.1:8546", nil) // nolint:bodyclose
+		require.NoError(t, err)
+		return conn, strings.Contains(res.Header.Get("Sec-WebSocket-Extensions"), "permessage-deflate"), read
+	}
+	// call returns the bytes read for the response of a request
+	call := func(conn *websocket.Conn, read *atomic.Int64) int64 {
+		before := read.Load()
+		require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(`{"jsonrpc":"2.0","id":1,"method":"eth_subscribe","params":["newHeads"]}`)))
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		_, msg, err := conn.ReadMessage()
+		require.NoError(t, err)
+		RequireEqualJSON(t, []byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"result":"%s"}`, result)), msg)
+		return read.Load() - before
+	}
+
+	plain, negotiated, plainRead := dial(false)
+	defer plain.Close()
+	require.False(t, negotiated)
+	require.Greater(t, call(plain, plainRead), int64(len(result)))
+
+	compressed, negotiated, compressedRead := dial(true)
+	defer compressed.Close()
+	require.True(t, negotiated)
+	require.Less(t, call(compressed, compressedRead), int64(len(result)/10))
+
+	// over max_conns, compression is negotiated but messages aren't
+	// compressed
+	overLimit, negotiated, overLimitRead := dial(true)
+	defer overLimit.Close()
+	require.True(t, negotiated)
+	require.Greater(t, call(overLimit, overLimitRead), int64(len(result)))
+
+	// closed connections release their slot
+	require.NoError(t, compressed.Close())
+	require.Eventually(t, func() bool {
+		conn, _, read := dial(true)
+		defer conn.Close()
+		return call(conn, read) < int64(len(result)/10)
+	}, 5*time.Second, 100*time.Millisecond)
+}
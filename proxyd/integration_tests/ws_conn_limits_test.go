@@ -0,0 +1,69 @@
+package integration_tests
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWSConnLimits(t *testing.T) {
+	backend := NewMockWSBackend(nil, nil, nil)
+	defer backend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", backend.URL()))
+
+	config := ReadConfig("ws_conn_limits")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	dial := func(ip string) (*websocket.Conn, int, string) {
+		conn, res, err := websocket.DefaultDialer.Dial("ws://127.0.0.1:8546", http.Header{"X-Forwarded-For": []string{ip}})
+		if err != nil {
+			require.NotNil(t, res)
+			defer res.Body.Close()
+			body, err := io.ReadAll(res.Body)
+			require.NoError(t, err)
+			return nil, res.StatusCode, string(body)
+		}
+		return conn, res.StatusCode, ""
+	}
+	const limRes = `{"error":{"code":-32024,"message":"too many websocket connections"},"id":null,"jsonrpc":"2.0"}`
+
+	conn1, code, _ := dial("1.1.1.1")
+	require.Equal(t, 101, code)
+	defer conn1.Close()
+	conn2, code, _ := dial("1.1.1.1")
+	require.Equal(t, 101, code)
+	defer conn2.Close()
+
+	// per IP limit
+	_, code, body := dial("1.1.1.1")
+	require.Equal(t, 429, code)
+	RequireEqualJSON(t, []byte(limRes), []byte(body))
+
+	conn3, code, _ := dial("2.2.2.2")
+	require.Equal(t, 101, code)
+	defer conn3.Close()
+
+	// global limit
+	_, code, body = dial("3.3.3.3")
+	require.Equal(t, 429, code)
+	RequireEqualJSON(t, []byte(limRes), []byte(body))
+
+	// closed connections are released
+	require.NoError(t, conn1.Close())
+	require.Eventually(t, func() bool {
+		conn, code, _ := dial("1.1.1.1")
+		if conn != nil {
+			conn.Close()
+		}
+		return code == 101
+	}, 5*time.Second, 50*time.Millisecond)
+}
@@ -0,0 +1,104 @@
+package integration_tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	ms "github.com/ethereum-optimism/optimism/proxyd/tools/mockserver/handler"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWSConsensusHeads(t *testing.T) {
+	dir, err := os.Getwd()
+	require.NoError(t, err)
+	responses := path.Join(dir, "testdata/consensus_responses.yml")
+
+	handlers := make([]*ms.MockedHandler, 2)
+	for i := range handlers {
+		handlers[i] = &ms.MockedHandler{
+			Overrides:    []*ms.MethodTemplate{},
+			Autoload:     true,
+			AutoloadFile: responses,
+		}
+		node := NewMockBackend(http.HandlerFunc(handlers[i].Handler))
+		defer node.Close()
+		require.NoError(t, os.Setenv(fmt.Sprintf("NODE%d_URL", i+1), node.URL()))
+	}
+
+	// the backends aren't subscribed to
+	var wsConns atomic.Int32
+	wsBackend := NewMockWSBackend(func(*websocket.Conn) {
+		wsConns.Add(1)
+	}, nil, nil)
+	defer wsBackend.Close()
+	require.NoError(t, os.Setenv("NODE_WS_URL", wsBackend.URL()))
+
+	config := ReadConfig("ws_consensus_heads")
+	svr, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	bg := svr.BackendGroups["node"]
+	update := func() {
+		for _, be := range bg.Backends {
+			bg.Consensus.UpdateBackend(context.Background(), be)
+		}
+		bg.Consensus.UpdateBackendGroupConsensus(context.Background())
+	}
+	setLatest := func(number string) {
+		for _, h := range handlers {
+			h.ResetOverrides()
+			h.AddOverride(&ms.MethodTemplate{
+				Method:   "eth_getBlockByNumber",
+				Block:    "latest",
+				Response: buildResponse(map[string]string{"number": number, "hash": "hash_" + number}),
+			})
+		}
+	}
+
+	client, _, err := websocket.DefaultDialer.Dial("ws://127.0.0.1:8546", nil) // nolint:bodyclose
+	require.NoError(t, err)
+	defer client.Close()
+
+	read := func() map[string]interface{} {
+		require.NoError(t, client.SetReadDeadline(time.Now().Add(5*time.Second)))
+		_, msg, err := client.ReadMessage()
+		require.NoError(t, err)
+		var out map[string]interface{}
+		require.NoError(t, json.Unmarshal(msg, &out))
+		return out
+	}
+	readHead := func(id string) string {
+		params := read()["params"].(map[string]interface{})
+		require.Equal(t, id, params["subscription"])
+		return params["result"].(map[string]interface{})["number"].(string)
+	}
+
+	require.NoError(t, client.WriteMessage(websocket.TextMessage, []byte(`{"jsonrpc":"2.0","id":1,"method":"eth_subscribe","params":["newHeads"]}`)))
+	id := read()["result"].(string)
+
+	update()
+	require.Equal(t, "0x101", readHead(id))
+
+	// blocks skipped between two polls are published too
+	setLatest("0x103")
+	update()
+	require.Equal(t, "0x102", readHead(id))
+	require.Equal(t, "0x103", readHead(id))
+
+	// unchanged heads aren't published again
+	update()
+	require.NoError(t, client.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":2,"method":"eth_unsubscribe","params":["%s"]}`, id))))
+	require.Equal(t, true, read()["result"])
+
+	require.Equal(t, int32(0), wsConns.Load())
+}
@@ -0,0 +1,88 @@
+package integration_tests
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWSDrain(t *testing.T) {
+	backend := NewMockWSBackend(nil, nil, nil)
+	defer backend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", backend.URL()))
+
+	dial := func() *websocket.Conn {
+		conn, _, err := websocket.DefaultDialer.Dial("ws://127.0.0.1:8546", nil) // nolint:bodyclose
+		require.NoError(t, err)
+		// the connection is tracked once proxied, shortly after the upgrade
+		time.Sleep(100 * time.Millisecond)
+		return conn
+	}
+	shutdownAsync := func(shutdown func()) chan struct{} {
+		done := make(chan struct{})
+		go func() {
+			shutdown()
+			close(done)
+		}()
+		return done
+	}
+
+	t.Run("clients are notified and waited for", func(t *testing.T) {
+		_, shutdown, err := proxyd.Start(ReadConfig("ws_drain"))
+		require.NoError(t, err)
+
+		conn := dial()
+		defer conn.Close()
+
+		start := time.Now()
+		done := shutdownAsync(shutdown)
+
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		_, msg, err := conn.ReadMessage()
+		require.NoError(t, err)
+		RequireEqualJSON(t, []byte(`{"jsonrpc":"2.0","method":"proxyd_shutdown","params":[{"retryAfter":5}],"id":null}`), msg)
+
+		// reading the close frame answers it, which closes the connection
+		_, _, err = conn.ReadMessage()
+		var closeErr *websocket.CloseError
+		require.ErrorAs(t, err, &closeErr)
+		require.Equal(t, websocket.CloseServiceRestart, closeErr.Code)
+		require.Equal(t, "shutting down, retry after 5s", closeErr.Text)
+
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("shutdown didn't return")
+		}
+		require.Less(t, time.Since(start), 2*time.Second)
+	})
+
+	t.Run("clients are closed after the drain timeout", func(t *testing.T) {
+		_, shutdown, err := proxyd.Start(ReadConfig("ws_drain"))
+		require.NoError(t, err)
+
+		// the client doesn't read, so never answers the close frame
+		conn := dial()
+		defer conn.Close()
+
+		start := time.Now()
+		select {
+		case <-shutdownAsync(shutdown):
+		case <-time.After(5 * time.Second):
+			t.Fatal("shutdown didn't return")
+		}
+		require.GreaterOrEqual(t, time.Since(start), 2*time.Second)
+
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				break
+			}
+		}
+	})
+}
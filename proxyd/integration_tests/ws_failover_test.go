@@ -0,0 +1,130 @@
+package integration_tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+// subscriptionBackend is a WS backend answering eth_subscribe requests with
+// subscription IDs prefixed with its name. It doesn't answer other requests.
+type subscriptionBackend struct {
+	*MockWSBackend
+	mtx  sync.Mutex
+	next int
+	// subs are the connections and IDs of subscriptions, by their type.
+	subs map[string]*websocket.Conn
+	ids  map[string]string
+}
+
+func newSubscriptionBackend(t *testing.T, name string) *subscriptionBackend {
+	b := &subscriptionBackend{
+		subs: make(map[string]*websocket.Conn),
+		ids:  make(map[string]string),
+	}
+	b.MockWSBackend = NewMockWSBackend(nil, func(conn *websocket.Conn, msgType int, data []byte) {
+		req, err := proxyd.ParseRPCReq(data)
+		require.NoError(t, err)
+		if req.Method != "eth_subscribe" {
+			return
+		}
+		var params []json.RawMessage
+		require.NoError(t, json.Unmarshal(req.Params, &params))
+		var typ string
+		require.NoError(t, json.Unmarshal(params[0], &typ))
+
+		b.mtx.Lock()
+		defer b.mtx.Unlock()
+		b.next++
+		id := fmt.Sprintf("0x%s%d", name, b.next)
+		b.subs[typ] = conn
+		b.ids[typ] = id
+		require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":%s,"result":"%s"}`, req.ID, id))))
+	}, nil)
+	return b
+}
+
+// notify sends a notification of the subscription of type typ, reporting
+// whether it exists.
+func (b *subscriptionBackend) notify(t *testing.T, typ string) bool {
+	return b.notifyResult(t, typ, fmt.Sprintf(`"%s"`, typ))
+}
+
+// notifyResult sends a notification of the subscription of type typ with the
+// JSON result, reporting whether it exists.
+func (b *subscriptionBackend) notifyResult(t *testing.T, typ string, result string) bool {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	conn := b.subs[typ]
+	if conn == nil {
+		return false
+	}
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"jsonrpc":"2.0","method":"eth_subscription","params":{"subscription":"%s","result":%s}}`, b.ids[typ], result))))
+	return true
+}
+
+func TestWSFailover(t *testing.T) {
+	first := newSubscriptionBackend(t, "a")
+	second := newSubscriptionBackend(t, "b")
+	defer second.Close()
+
+	require.NoError(t, os.Setenv("FIRST_BACKEND_RPC_URL", first.URL()))
+	require.NoError(t, os.Setenv("SECOND_BACKEND_RPC_URL", second.URL()))
+
+	config := ReadConfig("ws_failover")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	client, _, err := websocket.DefaultDialer.Dial("ws://127.0.0.1:8546", nil) // nolint:bodyclose
+	require.NoError(t, err)
+	defer client.Close()
+
+	read := func() map[string]interface{} {
+		require.NoError(t, client.SetReadDeadline(time.Now().Add(5*time.Second)))
+		_, msg, err := client.ReadMessage()
+		require.NoError(t, err)
+		var out map[string]interface{}
+		require.NoError(t, json.Unmarshal(msg, &out))
+		return out
+	}
+	send := func(id int, method string, params string) {
+		require.NoError(t, client.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"%s","params":%s}`, id, method, params))))
+	}
+
+	// logs are proxied, newHeads multiplexed
+	send(1, "eth_subscribe", `["logs"]`)
+	require.Equal(t, "0xa1", read()["result"])
+	send(2, "eth_subscribe", `["newHeads"]`)
+	headsID := read()["result"].(string)
+	send(3, "eth_chainId", `[]`)
+
+	first.Close()
+
+	// the request in flight is answered with an error
+	res := read()
+	require.Equal(t, float64(3), res["id"])
+	require.NotNil(t, res["error"])
+
+	require.Eventually(t, func() bool {
+		second.mtx.Lock()
+		defer second.mtx.Unlock()
+		return len(second.subs) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// notifications are delivered under the IDs known to the client
+	got := make(map[string]string)
+	for _, typ := range []string{"logs", "newHeads"} {
+		require.True(t, second.notify(t, typ))
+		notif := read()["params"].(map[string]interface{})
+		got[notif["result"].(string)] = notif["subscription"].(string)
+	}
+	require.Equal(t, map[string]string{"logs": "0xa1", "newHeads": headsID}, got)
+}
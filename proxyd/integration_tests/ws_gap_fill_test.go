@@ -0,0 +1,154 @@
+package integration_tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func gapFillHead(n int) string {
+	return fmt.Sprintf(`{"number":"0x%x","hash":"0xh%d"}`, n, n)
+}
+
+func gapFillLog(n int) string {
+	return fmt.Sprintf(`{"blockNumber":"0x%x","blockHash":"0xh%d","logIndex":"0x0","removed":false}`, n, n)
+}
+
+// gapFillHandler serves the blocks and logs of the chain, a block having
+// one log.
+func gapFillHandler(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		req, err := proxyd.ParseRPCReq(body)
+		require.NoError(t, err)
+		var result string
+		switch req.Method {
+		case "eth_getBlockByNumber":
+			var params []interface{}
+			require.NoError(t, json.Unmarshal(req.Params, &params))
+			n, err := strconv.ParseInt(strings.TrimPrefix(params[0].(string), "0x"), 16, 64)
+			require.NoError(t, err)
+			result = strings.TrimSuffix(gapFillHead(int(n)), "}") + `,"transactions":[]}`
+		case "eth_getLogs":
+			var params []map[string]string
+			require.NoError(t, json.Unmarshal(req.Params, &params))
+			from, err := strconv.ParseInt(strings.TrimPrefix(params[0]["fromBlock"], "0x"), 16, 64)
+			require.NoError(t, err)
+			to, err := strconv.ParseInt(strings.TrimPrefix(params[0]["toBlock"], "0x"), 16, 64)
+			require.NoError(t, err)
+			var logs []string
+			for n := from; n <= to; n++ {
+				logs = append(logs, gapFillLog(int(n)))
+			}
+			result = "[" + strings.Join(logs, ",") + "]"
+		default:
+			t.Fatalf("unexpected method %s", req.Method)
+		}
+		_, _ = w.Write([]byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":%s,"result":%s}`, req.ID, result)))
+	}
+}
+
+func TestWSGapFill(t *testing.T) {
+	first := newSubscriptionBackend(t, "a")
+	second := newSubscriptionBackend(t, "b")
+	defer second.Close()
+	secondHTTP := NewMockBackend(gapFillHandler(t))
+	defer secondHTTP.Close()
+
+	require.NoError(t, os.Setenv("FIRST_BACKEND_RPC_URL", first.URL()))
+	require.NoError(t, os.Setenv("SECOND_BACKEND_RPC_URL", second.URL()))
+	require.NoError(t, os.Setenv("SECOND_BACKEND_HTTP_URL", secondHTTP.URL()))
+
+	config := ReadConfig("ws_gap_fill")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	client, _, err := websocket.DefaultDialer.Dial("ws://127.0.0.1:8546", nil) // nolint:bodyclose
+	require.NoError(t, err)
+	defer client.Close()
+
+	read := func() map[string]interface{} {
+		require.NoError(t, client.SetReadDeadline(time.Now().Add(5*time.Second)))
+		_, msg, err := client.ReadMessage()
+		require.NoError(t, err)
+		var out map[string]interface{}
+		require.NoError(t, json.Unmarshal(msg, &out))
+		return out
+	}
+	send := func(id int, method string, params string) {
+		require.NoError(t, client.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"%s","params":%s}`, id, method, params))))
+	}
+	// readBlocks reads n notifications, returning the block numbers of the
+	// notifications of each subscription in order. Backfilled heads must be
+	// headers rather than blocks.
+	readBlocks := func(n int) map[string][]string {
+		out := make(map[string][]string)
+		for i := 0; i < n; i++ {
+			params := read()["params"].(map[string]interface{})
+			result := params["result"].(map[string]interface{})
+			require.NotContains(t, result, "transactions")
+			number, ok := result["number"]
+			if !ok {
+				number = result["blockNumber"]
+			}
+			sub := params["subscription"].(string)
+			out[sub] = append(out[sub], number.(string))
+		}
+		return out
+	}
+
+	// logs are proxied, newHeads multiplexed
+	send(1, "eth_subscribe", `["logs",{"address":"0x0000000000000000000000000000000000000001"}]`)
+	logsID := read()["result"].(string)
+	send(2, "eth_subscribe", `["newHeads"]`)
+	headsID := read()["result"].(string)
+
+	require.True(t, first.notifyResult(t, "newHeads", gapFillHead(1)))
+	require.True(t, first.notifyResult(t, "logs", gapFillLog(1)))
+	require.Equal(t, map[string][]string{
+		headsID: {"0x1"},
+		logsID:  {"0x1"},
+	}, readBlocks(2))
+
+	first.Close()
+	require.Eventually(t, func() bool {
+		second.mtx.Lock()
+		defer second.mtx.Unlock()
+		return len(second.subs) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// blocks 2 and 3 were missed, and are backfilled before block 4
+	require.True(t, second.notifyResult(t, "newHeads", gapFillHead(4)))
+	require.True(t, second.notifyResult(t, "logs", gapFillLog(4)))
+	require.Equal(t, map[string][]string{
+		headsID: {"0x2", "0x3", "0x4"},
+		logsID:  {"0x2", "0x3", "0x4"},
+	}, readBlocks(6))
+
+	// later notifications are forwarded as is
+	require.True(t, second.notifyResult(t, "newHeads", gapFillHead(5)))
+	require.Equal(t, map[string][]string{headsID: {"0x5"}}, readBlocks(1))
+
+	logsReq := 0
+	for _, req := range secondHTTP.Requests() {
+		rpcReq, err := proxyd.ParseRPCReq(req.Body)
+		require.NoError(t, err)
+		if rpcReq.Method == "eth_getLogs" {
+			logsReq++
+			require.Contains(t, string(rpcReq.Params), `"address":"0x0000000000000000000000000000000000000001"`)
+		}
+	}
+	require.Equal(t, 1, logsReq)
+}
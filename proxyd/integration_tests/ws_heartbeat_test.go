@@ -0,0 +1,174 @@
+package integration_tests
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+// readUntilClosed reads from conn until it fails, and returns the error.
+func readUntilClosed(t *testing.T, conn *websocket.Conn, timeout time.Duration) error {
+	errC := make(chan error, 1)
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				errC <- err
+				return
+			}
+		}
+	}()
+	select {
+	case err := <-errC:
+		return err
+	case <-time.After(timeout):
+		t.Fatal("ws conn wasn't closed")
+		return nil
+	}
+}
+
+// wsFloodMessages of wsFloodMessageSize bytes are sent to slow consumers, far
+// more than the socket buffers and the send queue of a client can hold.
+const (
+	wsFloodMessages    = 32
+	wsFloodMessageSize = 1024 * 1024
+)
+
+func TestWSHeartbeat(t *testing.T) {
+	var ignorePings, flood atomic.Bool
+	backendClosed := make(chan struct{}, 8)
+	backend := NewMockWSBackend(func(conn *websocket.Conn) {
+		if ignorePings.Load() {
+			conn.SetPingHandler(func(string) error { return nil })
+		}
+		if flood.Load() {
+			go func() {
+				msg := fmt.Sprintf(`{"jsonrpc":"2.0","method":"eth_subscription","params":{"subscription":"0x1","result":"%s"}}`, strings.Repeat("a", wsFloodMessageSize))
+				for i := 0; i < wsFloodMessages; i++ {
+					if err := conn.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}, nil, func(conn *websocket.Conn, err error) {
+		backendClosed <- struct{}{}
+	})
+	defer backend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", backend.URL()))
+
+	start := func(t *testing.T, configure func(config *proxyd.Config)) *websocket.Conn {
+		config := ReadConfig("ws_heartbeat")
+		if configure != nil {
+			configure(config)
+		}
+		_, shutdown, err := proxyd.Start(config)
+		require.NoError(t, err)
+		t.Cleanup(shutdown)
+
+		conn, _, err := websocket.DefaultDialer.Dial("ws://127.0.0.1:8546", nil)
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	}
+
+	// drainClosed forgets the backend conns closed by previous subtests.
+	drainClosed := func() {
+		for {
+			select {
+			case <-backendClosed:
+			case <-time.After(100 * time.Millisecond):
+				return
+			}
+		}
+	}
+
+	requireClosed := func(t *testing.T, err error, code int, text string) {
+		var closeErr *websocket.CloseError
+		require.ErrorAs(t, err, &closeErr)
+		require.Equal(t, code, closeErr.Code)
+		if text != "" {
+			require.Equal(t, text, closeErr.Text)
+		}
+	}
+
+	t.Run("client pong timeout", func(t *testing.T) {
+		conn := start(t, nil)
+		conn.SetPingHandler(func(string) error { return nil })
+		requireClosed(t, readUntilClosed(t, conn, 5*time.Second), websocket.CloseGoingAway, "pong timeout")
+	})
+
+	t.Run("pinged clients are kept", func(t *testing.T) {
+		conn := start(t, nil)
+		errC := make(chan error, 1)
+		go func() {
+			_, _, err := conn.ReadMessage()
+			errC <- err
+		}()
+		select {
+		case err := <-errC:
+			t.Fatalf("ws conn closed: %v", err)
+		case <-time.After(time.Second):
+		}
+	})
+
+	t.Run("idle timeout", func(t *testing.T) {
+		conn := start(t, func(config *proxyd.Config) {
+			config.WSConns.Client.IdleTimeout = proxyd.TOMLDuration(300 * time.Millisecond)
+		})
+		requireClosed(t, readUntilClosed(t, conn, 5*time.Second), websocket.CloseGoingAway, "idle timeout")
+	})
+
+	t.Run("backend pong timeout", func(t *testing.T) {
+		drainClosed()
+		ignorePings.Store(true)
+		defer ignorePings.Store(false)
+		conn := start(t, nil)
+		err := readUntilClosed(t, conn, 5*time.Second)
+		var closeErr *websocket.CloseError
+		require.ErrorAs(t, err, &closeErr)
+		select {
+		case <-backendClosed:
+		case <-time.After(5 * time.Second):
+			t.Fatal("backend conn wasn't closed")
+		}
+	})
+
+	t.Run("max message size", func(t *testing.T) {
+		conn := start(t, nil)
+		require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(strings.Repeat("a", 2048))))
+		requireClosed(t, readUntilClosed(t, conn, 5*time.Second), websocket.CloseMessageTooBig, "")
+	})
+
+	t.Run("slow consumer", func(t *testing.T) {
+		drainClosed()
+		flood.Store(true)
+		defer flood.Store(false)
+		slowConsumerLabels := map[string]string{"source": "client", "reason": "slow_consumer"}
+		closed := metricValue(t, "proxyd_ws_conns_closed_total", slowConsumerLabels)
+		conn := start(t, func(config *proxyd.Config) {
+			config.WSConns.Client.PingInterval = 0
+			config.WSConns.Backend.PingInterval = 0
+			config.WSConns.Client.WriteTimeout = proxyd.TOMLDuration(time.Minute)
+		})
+		// the client doesn't read until its queue of one message overflowed,
+		// after which the close frame is written once the pending write is
+		// read
+		require.Eventually(t, func() bool {
+			return metricValue(t, "proxyd_ws_conns_closed_total", slowConsumerLabels) == closed+1
+		}, 30*time.Second, 50*time.Millisecond)
+		requireClosed(t, readUntilClosed(t, conn, 30*time.Second), websocket.ClosePolicyViolation, "slow consumer")
+		select {
+		case <-backendClosed:
+		case <-time.After(5 * time.Second):
+			t.Fatal("backend conn wasn't closed")
+		}
+	})
+}
@@ -0,0 +1,92 @@
+package integration_tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	filterAddrA  = "0x000000000000000000000000000000000000000a"
+	filterAddrB  = "0x000000000000000000000000000000000000000b"
+	filterTopicX = "0x1111111111111111111111111111111111111111111111111111111111111111"
+	filterTopicY = "0x2222222222222222222222222222222222222222222222222222222222222222"
+)
+
+func TestWSLogFilter(t *testing.T) {
+	backend := newSubscriptionBackend(t, "a")
+	defer backend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", backend.URL()))
+
+	config := ReadConfig("ws_log_filter")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	dial := func() *websocket.Conn {
+		client, _, err := websocket.DefaultDialer.Dial("ws://127.0.0.1:8546", nil) // nolint:bodyclose
+		require.NoError(t, err)
+		return client
+	}
+	read := func(client *websocket.Conn) map[string]interface{} {
+		require.NoError(t, client.SetReadDeadline(time.Now().Add(5*time.Second)))
+		_, msg, err := client.ReadMessage()
+		require.NoError(t, err)
+		var out map[string]interface{}
+		require.NoError(t, json.Unmarshal(msg, &out))
+		return out
+	}
+	subscribe := func(client *websocket.Conn, filter string) string {
+		require.NoError(t, client.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":"eth_subscribe","params":["logs",%s]}`, filter))))
+		return read(client)["result"].(string)
+	}
+	notify := func(address string, topics ...string) {
+		result, err := json.Marshal(map[string]interface{}{
+			"address": address,
+			"topics":  topics,
+		})
+		require.NoError(t, err)
+		require.True(t, backend.notifyResult(t, "logs", string(result)))
+	}
+	readLog := func(client *websocket.Conn, id string) (string, []interface{}) {
+		params := read(client)["params"].(map[string]interface{})
+		require.Equal(t, id, params["subscription"])
+		result := params["result"].(map[string]interface{})
+		return result["address"].(string), result["topics"].([]interface{})
+	}
+
+	byAddress := dial()
+	defer byAddress.Close()
+	byTopic := dial()
+	defer byTopic.Close()
+
+	addressID := subscribe(byAddress, fmt.Sprintf(`{"address":["%s"]}`, filterAddrA))
+	topicID := subscribe(byTopic, fmt.Sprintf(`{"topics":[null,["%s","%s"]]}`, filterTopicX, filterTopicY))
+
+	// both subscriptions share a single upstream subscription without filter
+	backend.mtx.Lock()
+	require.Equal(t, 1, backend.next)
+	backend.mtx.Unlock()
+
+	notify(filterAddrB, filterTopicX)
+	notify(filterAddrB, filterTopicX, filterTopicY)
+	notify(filterAddrA, filterTopicY)
+
+	address, _ := readLog(byAddress, addressID)
+	require.Equal(t, filterAddrA, address)
+
+	address, topics := readLog(byTopic, topicID)
+	require.Equal(t, filterAddrB, address)
+	require.Len(t, topics, 2)
+
+	// invalid filters are rejected
+	require.NoError(t, byTopic.WriteMessage(websocket.TextMessage, []byte(`{"jsonrpc":"2.0","id":2,"method":"eth_subscribe","params":["logs",{"address":1}]}`)))
+	require.NotNil(t, read(byTopic)["error"])
+}
@@ -0,0 +1,130 @@
+package integration_tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWSMessagePolicy(t *testing.T) {
+	backend := NewMockWSBackend(nil, func(conn *websocket.Conn, msgType int, data []byte) {
+		if proxyd.IsBatch(data) {
+			var reqs []*proxyd.RPCReq
+			require.NoError(t, json.Unmarshal(data, &reqs))
+			res := make([]*proxyd.RPCRes, len(reqs))
+			for i, req := range reqs {
+				res[i] = proxyd.NewRPCRes(req.ID, "0x1")
+			}
+			require.NoError(t, conn.WriteJSON(res))
+			return
+		}
+		req, err := proxyd.ParseRPCReq(data)
+		require.NoError(t, err)
+		require.NoError(t, conn.WriteJSON(proxyd.NewRPCRes(req.ID, "0x1")))
+	}, nil)
+	defer backend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", backend.URL()))
+
+	dial := func() *websocket.Conn {
+		conn, _, err := websocket.DefaultDialer.Dial("ws://127.0.0.1:8546", nil) // nolint:bodyclose
+		require.NoError(t, err)
+		return conn
+	}
+	send := func(conn *websocket.Conn, msg string) ([]byte, error) {
+		require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(msg)))
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		_, res, err := conn.ReadMessage()
+		return res, err
+	}
+	marshal := func(v interface{}) []byte {
+		out, err := json.Marshal(v)
+		require.NoError(t, err)
+		return out
+	}
+	req := func(id int, method string, params ...string) string {
+		return fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"%s","params":%s}`, id, method, marshal(params))
+	}
+	okRes := func(id int) string {
+		return fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"result":"0x1"}`, id)
+	}
+	errRes := func(id interface{}, err *proxyd.RPCErr) string {
+		return string(marshal(proxyd.NewRPCErrorRes(marshal(id), err)))
+	}
+
+	t.Run("messages are checked as on the HTTP path", func(t *testing.T) {
+		_, shutdown, err := proxyd.Start(ReadConfig("ws_message_policy"))
+		require.NoError(t, err)
+		defer shutdown()
+
+		conn := dial()
+		defer conn.Close()
+
+		res, err := send(conn, req(1, "eth_chainId"))
+		require.NoError(t, err)
+		RequireEqualJSON(t, []byte(okRes(1)), res)
+
+		// whitelisted over WS, but not mapped
+		res, err = send(conn, req(2, "eth_blockNumber"))
+		require.NoError(t, err)
+		RequireEqualJSON(t, []byte(errRes(2, proxyd.ErrMethodNotWhitelisted)), res)
+
+		res, err = send(conn, req(3, "eth_sendRawTransaction", txHex1))
+		require.NoError(t, err)
+		RequireEqualJSON(t, []byte(okRes(3)), res)
+		res, err = send(conn, req(4, "eth_sendRawTransaction", txHex1))
+		require.NoError(t, err)
+		RequireEqualJSON(t, []byte(errRes(4, proxyd.ErrOverSenderRateLimit)), res)
+	})
+
+	t.Run("batches are checked as a whole", func(t *testing.T) {
+		_, shutdown, err := proxyd.Start(ReadConfig("ws_message_policy"))
+		require.NoError(t, err)
+		defer shutdown()
+
+		conn := dial()
+		defer conn.Close()
+
+		res, err := send(conn, fmt.Sprintf("[%s,%s]", req(1, "eth_chainId"), req(2, "eth_chainId")))
+		require.NoError(t, err)
+		RequireEqualJSON(t, []byte(fmt.Sprintf("[%s,%s]", okRes(1), okRes(2))), res)
+
+		res, err = send(conn, fmt.Sprintf("[%s,%s,%s]", req(1, "eth_chainId"), req(2, "eth_chainId"), req(3, "eth_chainId")))
+		require.NoError(t, err)
+		RequireEqualJSON(t, []byte(errRes(nil, proxyd.ErrTooManyBatchRequests)), res)
+
+		res, err = send(conn, fmt.Sprintf("[%s,%s]", req(1, "eth_chainId"), req(2, "eth_blockNumber")))
+		require.NoError(t, err)
+		RequireEqualJSON(t, []byte(errRes(nil, proxyd.ErrMethodNotWhitelisted)), res)
+
+		res, err = send(conn, fmt.Sprintf("[%s]", req(1, "eth_subscribe", "newHeads")))
+		require.NoError(t, err)
+		RequireEqualJSON(t, []byte(errRes(nil, proxyd.ErrInvalidRequest("subscriptions can't be batched"))), res)
+	})
+
+	t.Run("close policy closes the connection", func(t *testing.T) {
+		config := ReadConfig("ws_message_policy")
+		config.WSMessagePolicy.Policy = proxyd.WSMessageRateLimitPolicyClose
+		_, shutdown, err := proxyd.Start(config)
+		require.NoError(t, err)
+		defer shutdown()
+
+		conn := dial()
+		defer conn.Close()
+
+		res, err := send(conn, req(1, "eth_chainId"))
+		require.NoError(t, err)
+		RequireEqualJSON(t, []byte(okRes(1)), res)
+
+		_, err = send(conn, req(2, "eth_blockNumber"))
+		var closeErr *websocket.CloseError
+		require.ErrorAs(t, err, &closeErr)
+		require.Equal(t, websocket.ClosePolicyViolation, closeErr.Code)
+	})
+}
@@ -0,0 +1,99 @@
+package integration_tests
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWSMessageRateLimit(t *testing.T) {
+	backend := NewMockWSBackend(nil, func(conn *websocket.Conn, msgType int, data []byte) {
+		req, err := proxyd.ParseRPCReq(data)
+		require.NoError(t, err)
+		require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":%s,"result":"0x1"}`, req.ID))))
+	}, nil)
+	defer backend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", backend.URL()))
+
+	dial := func() *websocket.Conn {
+		conn, _, err := websocket.DefaultDialer.Dial("ws://127.0.0.1:8546", nil) // nolint:bodyclose
+		require.NoError(t, err)
+		return conn
+	}
+	send := func(conn *websocket.Conn, id int) (string, error) {
+		require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"eth_subscribe","params":["newHeads"]}`, id))))
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		_, msg, err := conn.ReadMessage()
+		return string(msg), err
+	}
+	okRes := func(id int) []byte {
+		return []byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"result":"0x1"}`, id))
+	}
+	// the message of rate limit errors is configurable, so only compare codes
+	requireLimited := func(id int, res string) {
+		rpcRes, err := proxyd.ParseRPCRes(strings.NewReader(res))
+		require.NoError(t, err)
+		require.Equal(t, fmt.Sprint(id), string(rpcRes.ID))
+		require.NotNil(t, rpcRes.Error)
+		require.Equal(t, proxyd.ErrOverRateLimit.Code, rpcRes.Error.Code)
+	}
+	alignWindow := func() {
+		time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+	}
+
+	t.Run("limited messages are answered with an error", func(t *testing.T) {
+		_, shutdown, err := proxyd.Start(ReadConfig("ws_message_rate_limit"))
+		require.NoError(t, err)
+		defer shutdown()
+
+		conn1, conn2 := dial(), dial()
+		defer conn1.Close()
+		defer conn2.Close()
+
+		alignWindow()
+		for id := 1; id <= 2; id++ {
+			res, err := send(conn1, id)
+			require.NoError(t, err)
+			RequireEqualJSON(t, okRes(id), []byte(res))
+		}
+		// per connection limit
+		res, err := send(conn1, 3)
+		require.NoError(t, err)
+		requireLimited(3, res)
+
+		// the key limit is shared by the connections of the client
+		res, err = send(conn2, 4)
+		require.NoError(t, err)
+		RequireEqualJSON(t, okRes(4), []byte(res))
+		res, err = send(conn2, 5)
+		require.NoError(t, err)
+		requireLimited(5, res)
+	})
+
+	t.Run("close policy closes the connection", func(t *testing.T) {
+		config := ReadConfig("ws_message_rate_limit")
+		config.WSMessageRateLimit.Policy = proxyd.WSMessageRateLimitPolicyClose
+		_, shutdown, err := proxyd.Start(config)
+		require.NoError(t, err)
+		defer shutdown()
+
+		conn := dial()
+		defer conn.Close()
+
+		alignWindow()
+		for id := 1; id <= 2; id++ {
+			res, err := send(conn, id)
+			require.NoError(t, err)
+			RequireEqualJSON(t, okRes(id), []byte(res))
+		}
+		_, err = send(conn, 3)
+		require.True(t, websocket.IsCloseError(err, websocket.ClosePolicyViolation))
+	})
+}
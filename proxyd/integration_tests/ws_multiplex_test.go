@@ -0,0 +1,112 @@
+package integration_tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWSMultiplex(t *testing.T) {
+	var mtx sync.Mutex
+	var conns, subscribes int
+	var subConn *websocket.Conn
+	unsubscribed := make(chan string, 8)
+
+	backend := NewMockWSBackend(func(conn *websocket.Conn) {
+		mtx.Lock()
+		conns++
+		mtx.Unlock()
+	}, func(conn *websocket.Conn, msgType int, data []byte) {
+		req, err := proxyd.ParseRPCReq(data)
+		require.NoError(t, err)
+
+		mtx.Lock()
+		defer mtx.Unlock()
+		switch req.Method {
+		case "eth_subscribe":
+			subscribes++
+			subConn = conn
+			require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":%s,"result":"0xsub%d"}`, req.ID, subscribes))))
+		case "eth_unsubscribe":
+			var params []string
+			require.NoError(t, json.Unmarshal(req.Params, &params))
+			unsubscribed <- params[0]
+			require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":%s,"result":true}`, req.ID))))
+		}
+	}, nil)
+	defer backend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", backend.URL()))
+
+	config := ReadConfig("ws_multiplex")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	read := func(conn *websocket.Conn) map[string]interface{} {
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		_, msg, err := conn.ReadMessage()
+		require.NoError(t, err)
+		var out map[string]interface{}
+		require.NoError(t, json.Unmarshal(msg, &out))
+		return out
+	}
+	subscribe := func(conn *websocket.Conn, params string) string {
+		require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(`{"jsonrpc":"2.0","id":1,"method":"eth_subscribe","params":`+params+`}`)))
+		res := read(conn)
+		require.Nil(t, res["error"])
+		return res["result"].(string)
+	}
+
+	clientA, _, err := websocket.DefaultDialer.Dial("ws://127.0.0.1:8546", nil) // nolint:bodyclose
+	require.NoError(t, err)
+	defer clientA.Close()
+	clientB, _, err := websocket.DefaultDialer.Dial("ws://127.0.0.1:8546", nil) // nolint:bodyclose
+	require.NoError(t, err)
+	defer clientB.Close()
+
+	subA := subscribe(clientA, `["newHeads"]`)
+	subB := subscribe(clientB, `[ "newHeads" ]`)
+	require.NotEqual(t, subA, subB)
+
+	mtx.Lock()
+	// a single connection and subscription, shared by the clients
+	require.Equal(t, 1, conns)
+	require.Equal(t, 1, subscribes)
+	require.NoError(t, subConn.WriteMessage(websocket.TextMessage, []byte(`{"jsonrpc":"2.0","method":"eth_subscription","params":{"subscription":"0xsub1","result":{"number":"0x1"}}}`)))
+	mtx.Unlock()
+
+	for conn, sub := range map[*websocket.Conn]string{clientA: subA, clientB: subB} {
+		notif := read(conn)
+		require.Equal(t, "eth_subscription", notif["method"])
+		require.Equal(t, sub, notif["params"].(map[string]interface{})["subscription"])
+		require.Equal(t, map[string]interface{}{"number": "0x1"}, notif["params"].(map[string]interface{})["result"])
+	}
+
+	t.Run("other subscriptions are forwarded", func(t *testing.T) {
+		require.Equal(t, "0xsub2", subscribe(clientA, `["logs"]`))
+		mtx.Lock()
+		require.Equal(t, 2, conns)
+		mtx.Unlock()
+	})
+
+	t.Run("the upstream subscription ends with its last subscriber", func(t *testing.T) {
+		require.NoError(t, clientA.WriteMessage(websocket.TextMessage, []byte(`{"jsonrpc":"2.0","id":2,"method":"eth_unsubscribe","params":["`+subA+`"]}`)))
+		require.Equal(t, true, read(clientA)["result"])
+		select {
+		case <-unsubscribed:
+			t.Fatal("unsubscribed with a subscriber left")
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		require.NoError(t, clientB.Close())
+		require.Equal(t, "0xsub1", <-unsubscribed)
+	})
+}
@@ -0,0 +1,105 @@
+package integration_tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWSPool(t *testing.T) {
+	var mtx sync.Mutex
+	conns := make(map[*websocket.Conn]bool)
+
+	backend := NewMockWSBackend(func(conn *websocket.Conn) {
+		mtx.Lock()
+		conns[conn] = true
+		mtx.Unlock()
+	}, func(conn *websocket.Conn, msgType int, data []byte) {
+		req, err := proxyd.ParseRPCReq(data)
+		require.NoError(t, err)
+		switch req.Method {
+		case "eth_chainId":
+			// answers with the params, to tell the clients apart
+			_ = conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":%s,"result":%s}`, req.ID, req.Params)))
+		case "eth_subscribe":
+			_ = conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":%s,"result":"0x1"}`, req.ID)))
+		case "eth_call":
+			// fails the connection with the request in flight
+			conn.Close()
+		}
+	}, func(conn *websocket.Conn, err error) {
+		mtx.Lock()
+		delete(conns, conn)
+		mtx.Unlock()
+	})
+	defer backend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", backend.URL()))
+
+	config := ReadConfig("ws_pool")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	backendConns := func() int {
+		mtx.Lock()
+		defer mtx.Unlock()
+		return len(conns)
+	}
+	dial := func(t *testing.T) *websocket.Conn {
+		conn, _, err := websocket.DefaultDialer.Dial("ws://127.0.0.1:8546", nil) // nolint:bodyclose
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	}
+	call := func(t *testing.T, conn *websocket.Conn, id string, method string, params string) map[string]interface{} {
+		req := fmt.Sprintf(`{"jsonrpc":"2.0","id":%s,"method":"%s","params":%s}`, id, method, params)
+		require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(req)))
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		_, msg, err := conn.ReadMessage()
+		require.NoError(t, err)
+		var res map[string]interface{}
+		require.NoError(t, json.Unmarshal(msg, &res))
+		return res
+	}
+
+	clients := make([]*websocket.Conn, 8)
+	for i := range clients {
+		clients[i] = dial(t)
+	}
+	var wg sync.WaitGroup
+	for i, client := range clients {
+		wg.Add(1)
+		go func(i int, client *websocket.Conn) {
+			defer wg.Done()
+			for j := 0; j < 4; j++ {
+				id := fmt.Sprintf(`"client-%d-%d"`, i, j)
+				res := call(t, client, id, "eth_chainId", fmt.Sprintf(`[%d]`, i))
+				require.Equal(t, fmt.Sprintf("client-%d-%d", i, j), res["id"])
+				require.Equal(t, []interface{}{float64(i)}, res["result"])
+			}
+		}(i, client)
+	}
+	wg.Wait()
+	// the clients share the connections of the pool
+	require.Equal(t, 2, backendConns())
+
+	// subscribing clients get a connection of their own
+	res := call(t, clients[0], "1", "eth_subscribe", `["newHeads"]`)
+	require.Equal(t, "0x1", res["result"])
+	require.Equal(t, 3, backendConns())
+
+	// requests in flight on a failed connection are answered with errors
+	res = call(t, clients[1], "7", "eth_call", `[]`)
+	require.Equal(t, float64(7), res["id"])
+	require.Equal(t, float64(proxyd.ErrBackendOffline.Code), res["error"].(map[string]interface{})["code"])
+	res = call(t, clients[1], "8", "eth_chainId", `[1]`)
+	require.Equal(t, []interface{}{float64(1)}, res["result"])
+}
@@ -0,0 +1,103 @@
+package integration_tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWSSessions(t *testing.T) {
+	var mtx sync.Mutex
+	var nextSub int
+	var unsubscribed []string
+	closed := make(chan struct{}, 8)
+
+	backend := NewMockWSBackend(nil, func(conn *websocket.Conn, msgType int, data []byte) {
+		req, err := proxyd.ParseRPCReq(data)
+		require.NoError(t, err)
+
+		mtx.Lock()
+		defer mtx.Unlock()
+		switch req.Method {
+		case "eth_subscribe":
+			nextSub++
+			subID := fmt.Sprintf("0xsub%d", nextSub)
+			require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":%s,"result":"%s"}`, req.ID, subID))))
+			require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"jsonrpc":"2.0","method":"eth_subscription","params":{"subscription":"%s","result":"0x1"}}`, subID))))
+		case "eth_unsubscribe":
+			var params []string
+			require.NoError(t, json.Unmarshal(req.Params, &params))
+			unsubscribed = append(unsubscribed, params...)
+			require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":%s,"result":true}`, req.ID))))
+		}
+	}, func(conn *websocket.Conn, err error) {
+		closed <- struct{}{}
+	})
+	defer backend.Close()
+
+	require.NoError(t, os.Setenv("GOOD_BACKEND_RPC_URL", backend.URL()))
+
+	config := ReadConfig("ws_sessions")
+	_, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	defer shutdown()
+
+	dial := func(url string, header http.Header) (*websocket.Conn, string) {
+		conn, res, err := websocket.DefaultDialer.Dial(url, header) // nolint:bodyclose
+		require.NoError(t, err)
+		token := res.Header.Get(proxyd.WSSessionHeader)
+		require.NotEmpty(t, token)
+		return conn, token
+	}
+	read := func(conn *websocket.Conn) string {
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		_, msg, err := conn.ReadMessage()
+		require.NoError(t, err)
+		return string(msg)
+	}
+
+	conn, token := dial("ws://127.0.0.1:8546", nil)
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(`{"jsonrpc":"2.0","id":1,"method":"eth_subscribe","params":["newHeads"]}`)))
+	RequireEqualJSON(t, []byte(`{"jsonrpc":"2.0","id":1,"result":"0xsub1"}`), []byte(read(conn)))
+	RequireEqualJSON(t, []byte(`{"jsonrpc":"2.0","method":"eth_subscription","params":{"subscription":"0xsub1","result":"0x1"}}`), []byte(read(conn)))
+	require.NoError(t, conn.Close())
+	<-closed
+
+	t.Run("resumed sessions restore subscriptions", func(t *testing.T) {
+		conn, resumedToken := dial("ws://127.0.0.1:8546/?session="+token, nil)
+		defer conn.Close()
+		require.Equal(t, token, resumedToken)
+
+		// the backend assigned 0xsub2 to the restored subscription
+		RequireEqualJSON(t, []byte(`{"jsonrpc":"2.0","method":"eth_subscription","params":{"subscription":"0xsub1","result":"0x1"}}`), []byte(read(conn)))
+
+		require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(`{"jsonrpc":"2.0","id":2,"method":"eth_unsubscribe","params":["0xsub1"]}`)))
+		RequireEqualJSON(t, []byte(`{"jsonrpc":"2.0","id":2,"result":true}`), []byte(read(conn)))
+		mtx.Lock()
+		require.Equal(t, []string{"0xsub2"}, unsubscribed)
+		mtx.Unlock()
+	})
+
+	t.Run("unsubscribed subscriptions are not restored", func(t *testing.T) {
+		<-closed
+		conn, _ := dial("ws://127.0.0.1:8546", http.Header{proxyd.WSSessionHeader: []string{token}})
+		defer conn.Close()
+		require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(`{"jsonrpc":"2.0","id":3,"method":"eth_subscribe","params":["logs"]}`)))
+		RequireEqualJSON(t, []byte(`{"jsonrpc":"2.0","id":3,"result":"0xsub3"}`), []byte(read(conn)))
+	})
+
+	t.Run("unknown sessions are replaced", func(t *testing.T) {
+		conn, newToken := dial("ws://127.0.0.1:8546/?session=unknown", nil)
+		defer conn.Close()
+		require.NotEqual(t, "unknown", newToken)
+		require.NotEqual(t, token, newToken)
+	})
+}
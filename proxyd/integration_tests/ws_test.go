@@ -219,8 +219,8 @@ func TestWSClientExceedReadLimit(t *testing.T) {
 	require.NoError(t, err)
 
 	closed := false
-	originalHandler := client.conn.CloseHandler()
-	client.conn.SetCloseHandler(func(code int, text string) error {
+	originalHandler := client.Conn().CloseHandler()
+	client.Conn().SetCloseHandler(func(code int, text string) error {
 		closed = true
 		return originalHandler(code, text)
 	})
@@ -0,0 +1,452 @@
+package proxyd
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	defaultJWKSRefreshInterval = 5 * time.Minute
+	defaultJWTAliasClaim       = "sub"
+
+	// jwksMinRefreshInterval bounds how often tokens signed with unknown
+	// keys cause the JWKS to be fetched again.
+	jwksMinRefreshInterval = 30 * time.Second
+	jwksFetchTimeout       = 10 * time.Second
+	maxJWKSBytes           = 1 << 20
+)
+
+// jwtAuthError is an authentication failure, with the reason it is counted
+// under.
+type jwtAuthError struct {
+	reason string
+	err    error
+}
+
+func (e *jwtAuthError) Error() string {
+	return e.err.Error()
+}
+
+func jwtAuthErr(reason string, format string, args ...interface{}) error {
+	return &jwtAuthError{reason: reason, err: fmt.Errorf(format, args...)}
+}
+
+// jwtAuthFailureReason returns the reason err is counted under.
+func jwtAuthFailureReason(err error) string {
+	var authErr *jwtAuthError
+	if errors.As(err, &authErr) {
+		return authErr.reason
+	}
+	return "invalid"
+}
+
+// jwtAuth authenticates requests by the JWT bearer token of their
+// Authorization header, signed with a shared HS256 secret or with the RS256
+// or ES256 keys of a JWKS, mapping one of its claims to an auth alias.
+type jwtAuth struct {
+	secret     []byte
+	jwks       *jwksCache
+	issuer     string
+	audience   string
+	aliasClaim string
+	aliases    map[string]string
+	known      map[string]bool
+	leeway     time.Duration
+	required   bool
+}
+
+func newJWTAuth(config JWTAuthConfig, authKeys map[string]*AuthKeyConfig) (*jwtAuth, error) {
+	if !config.Enabled {
+		return nil, nil
+	}
+	a := &jwtAuth{
+		issuer:     config.Issuer,
+		audience:   config.Audience,
+		aliasClaim: config.AliasClaim,
+		aliases:    config.Aliases,
+		known:      make(map[string]bool),
+		leeway:     time.Duration(config.Leeway),
+		required:   config.Required,
+	}
+	if a.aliasClaim == "" {
+		a.aliasClaim = defaultJWTAliasClaim
+	}
+	if config.HS256Secret != "" {
+		secret, err := ReadFromEnvOrConfig(config.HS256Secret)
+		if err != nil {
+			return nil, err
+		}
+		a.secret = []byte(secret)
+	}
+	if config.JWKSURL != "" {
+		url, err := ReadFromEnvOrConfig(config.JWKSURL)
+		if err != nil {
+			return nil, err
+		}
+		interval := defaultJWKSRefreshInterval
+		if config.JWKSRefreshInterval != 0 {
+			interval = time.Duration(config.JWKSRefreshInterval)
+		}
+		a.jwks = newJWKSCache(url, interval)
+	}
+	if a.secret == nil && a.jwks == nil {
+		return nil, errors.New("jwt_auth requires hs256_secret or jwks_url")
+	}
+	for _, alias := range config.Aliases {
+		a.known[alias] = true
+	}
+	for alias := range authKeys {
+		a.known[alias] = true
+	}
+	return a, nil
+}
+
+// bearerToken returns the bearer token of the Authorization header of r, if
+// any.
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+		return "", false
+	}
+	return strings.TrimSpace(header[7:]), true
+}
+
+// alias verifies token and returns the alias its claims map to.
+func (a *jwtAuth) alias(ctx context.Context, token string) (string, error) {
+	claims, err := a.verify(ctx, token)
+	if err != nil {
+		return "", err
+	}
+	if err := a.checkClaims(claims); err != nil {
+		return "", err
+	}
+	value, ok := claims[a.aliasClaim].(string)
+	if !ok || value == "" {
+		return "", jwtAuthErr("unknown_alias", "missing %s claim", a.aliasClaim)
+	}
+	alias := value
+	if len(a.aliases) > 0 {
+		if alias, ok = a.aliases[value]; !ok {
+			return "", jwtAuthErr("unknown_alias", "unmapped %s claim %s", a.aliasClaim, value)
+		}
+	}
+	// the claim could be anything the issuer put in it, so only aliases of
+	// the config are accepted
+	if !a.known[alias] {
+		return "", jwtAuthErr("unknown_alias", "unknown alias %s", alias)
+	}
+	return alias, nil
+}
+
+// requiresToken reports whether requests must be authenticated by token.
+func (a *jwtAuth) requiresToken() bool {
+	return a != nil && a.required
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// verify checks the signature of token, returning its claims.
+func (a *jwtAuth) verify(ctx context.Context, token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, jwtAuthErr("malformed", "token must have 3 parts")
+	}
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, jwtAuthErr("malformed", "invalid header encoding: %v", err)
+	}
+	var header jwtHeader
+	if err := json.Unmarshal(rawHeader, &header); err != nil {
+		return nil, jwtAuthErr("malformed", "invalid header: %v", err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, jwtAuthErr("malformed", "invalid signature encoding: %v", err)
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+
+	switch header.Alg {
+	case "HS256":
+		if a.secret == nil {
+			return nil, jwtAuthErr("signature", "unsupported alg HS256")
+		}
+		mac := hmac.New(sha256.New, a.secret)
+		mac.Write(signed)
+		if subtle.ConstantTimeCompare(mac.Sum(nil), sig) != 1 {
+			return nil, jwtAuthErr("signature", "invalid signature")
+		}
+	case "RS256", "ES256":
+		if a.jwks == nil {
+			return nil, jwtAuthErr("signature", "unsupported alg %s", header.Alg)
+		}
+		keys, err := a.jwks.keys(ctx, header.Kid)
+		if err != nil {
+			return nil, jwtAuthErr("jwks", "error fetching JWKS: %v", err)
+		}
+		if !verifyJWTSignature(header, keys, signed, sig) {
+			return nil, jwtAuthErr("signature", "invalid signature")
+		}
+	default:
+		return nil, jwtAuthErr("signature", "unsupported alg %q", header.Alg)
+	}
+
+	rawClaims, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, jwtAuthErr("malformed", "invalid claims encoding: %v", err)
+	}
+	var claims map[string]interface{}
+	if err := json.Unmarshal(rawClaims, &claims); err != nil {
+		return nil, jwtAuthErr("malformed", "invalid claims: %v", err)
+	}
+	return claims, nil
+}
+
+// verifyJWTSignature reports whether sig is a signature of signed by one of
+// keys, those with the kid of header if it has one.
+func verifyJWTSignature(header jwtHeader, keys map[string]crypto.PublicKey, signed []byte, sig []byte) bool {
+	digest := sha256.Sum256(signed)
+	for kid, key := range keys {
+		if header.Kid != "" && kid != header.Kid {
+			continue
+		}
+		switch key := key.(type) {
+		case *rsa.PublicKey:
+			if header.Alg == "RS256" && rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) == nil {
+				return true
+			}
+		case *ecdsa.PublicKey:
+			if header.Alg != "ES256" || key.Curve != elliptic.P256() || len(sig) != 64 {
+				continue
+			}
+			r := new(big.Int).SetBytes(sig[:32])
+			s := new(big.Int).SetBytes(sig[32:])
+			if ecdsa.Verify(key, digest[:], r, s) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (a *jwtAuth) checkClaims(claims map[string]interface{}) error {
+	now := time.Now()
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return jwtAuthErr("claims", "missing exp claim")
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(a.leeway)) {
+		return jwtAuthErr("expired", "token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(a.leeway).Before(time.Unix(int64(nbf), 0)) {
+		return jwtAuthErr("claims", "token not valid yet")
+	}
+	if a.issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != a.issuer {
+			return jwtAuthErr("claims", "invalid issuer %q", iss)
+		}
+	}
+	if a.audience != "" && !jwtHasAudience(claims["aud"], a.audience) {
+		return jwtAuthErr("claims", "invalid audience")
+	}
+	return nil
+}
+
+// jwtHasAudience reports whether the aud claim, a string or an array of
+// strings, contains audience.
+func jwtHasAudience(aud interface{}, audience string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == audience
+	case []interface{}:
+		for _, a := range aud {
+			if a == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// jwksCache caches the keys of a JWKS, fetching them again once per
+// interval, or sooner for tokens signed with keys it doesn't have yet, as
+// happens once keys are rotated. Fetches are shared by concurrent callers and
+// don't block the callers that can be served the cached keys.
+type jwksCache struct {
+	url      string
+	interval time.Duration
+	client   *http.Client
+	group    singleflight.Group
+
+	mtx       sync.Mutex
+	cached    map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+func newJWKSCache(url string, interval time.Duration) *jwksCache {
+	return &jwksCache{
+		url:      url,
+		interval: interval,
+		client:   &http.Client{Timeout: jwksFetchTimeout},
+	}
+}
+
+// keys returns the cached keys, fetching them if they are stale or lack
+// kid. Stale keys are returned while they are refreshed, and if the fetch
+// fails, until they expire.
+func (c *jwksCache) keys(ctx context.Context, kid string) (map[string]crypto.PublicKey, error) {
+	c.mtx.Lock()
+	cached, age := c.cached, time.Since(c.fetchedAt)
+	c.mtx.Unlock()
+	_, known := cached[kid]
+	stale := cached == nil || age >= c.interval
+	if !stale && (known || kid == "" || age < jwksMinRefreshInterval) {
+		return cached, nil
+	}
+	usable := cached != nil && age < 2*c.interval
+	refresh := c.refresh()
+	if usable && (known || kid == "") {
+		return cached, nil
+	}
+
+	select {
+	case res := <-refresh:
+		if res.Err != nil {
+			if usable {
+				return cached, nil
+			}
+			return nil, res.Err
+		}
+		return res.Val.(map[string]crypto.PublicKey), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// refresh fetches the keys, unless a fetch is already in flight.
+func (c *jwksCache) refresh() <-chan singleflight.Result {
+	return c.group.DoChan(c.url, func() (interface{}, error) {
+		// the fetch is shared, so it isn't bound to the context of a caller
+		keys, err := c.fetch(context.Background())
+		if err != nil {
+			log.Warn("error refreshing JWKS", "url", c.url, "err", err)
+			return nil, err
+		}
+		c.mtx.Lock()
+		c.cached = keys
+		c.fetchedAt = time.Now()
+		c.mtx.Unlock()
+		return keys, nil
+	})
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (c *jwksCache) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(nil, res.Body, maxJWKSBytes)).Decode(&set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for i, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			log.Warn("skipping invalid JWK", "url", c.url, "kid", k.Kid, "err", err)
+			continue
+		}
+		kid := k.Kid
+		if kid == "" {
+			kid = fmt.Sprintf("#%d", i)
+		}
+		keys[kid] = key
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		exp := new(big.Int).SetBytes(e)
+		if !exp.IsInt64() || exp.Int64() < 3 || exp.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != 32 || len(y) != 32 {
+			return nil, errors.New("invalid P-256 coordinates")
+		}
+		// rejects points not on the curve
+		if _, err := ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+	}
+}
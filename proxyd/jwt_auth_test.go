@@ -0,0 +1,61 @@
+package proxyd
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWKSCacheRefresh(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	release := make(chan struct{})
+	var fetches atomic.Int32
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fetches.Add(1) > 1 {
+			<-release
+		}
+		b64 := base64.RawURLEncoding.EncodeToString
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{
+				{"kty": "EC", "kid": "ec", "crv": "P-256", "x": b64(key.X.FillBytes(make([]byte, 32))), "y": b64(key.Y.FillBytes(make([]byte, 32)))},
+			},
+		})
+	}))
+	defer jwks.Close()
+
+	ctx := context.Background()
+	cache := newJWKSCache(jwks.URL, 50*time.Millisecond)
+	keys, err := cache.keys(ctx, "ec")
+	require.NoError(t, err)
+	require.Contains(t, keys, "ec")
+
+	// stale keys are served while they are refreshed
+	time.Sleep(60 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		start := time.Now()
+		keys, err = cache.keys(ctx, "ec")
+		require.NoError(t, err)
+		require.Contains(t, keys, "ec")
+		require.Less(t, time.Since(start), 20*time.Millisecond)
+	}
+
+	close(release)
+	require.Eventually(t, func() bool {
+		cache.mtx.Lock()
+		defer cache.mtx.Unlock()
+		return time.Since(cache.fetchedAt) < 50*time.Millisecond
+	}, time.Second, 5*time.Millisecond)
+	require.Equal(t, int32(2), fetches.Load())
+}
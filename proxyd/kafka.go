@@ -0,0 +1,112 @@
+package proxyd
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+)
+
+const kafkaClientID = "proxyd"
+
+// kafkaSink produces access log lines to a Kafka topic. Lines are produced
+// without keys, so that batches are spread across the partitions of the
+// topic.
+type kafkaSink struct {
+	client *kgo.Client
+}
+
+func newKafkaSink(config AccessLogSinkConfig) (*kafkaSink, error) {
+	if len(config.Brokers) == 0 || config.Topic == "" {
+		return nil, errors.New("kafka access log sinks require brokers and a topic")
+	}
+	opts := []kgo.Opt{
+		kgo.SeedBrokers(config.Brokers...),
+		kgo.DefaultProduceTopic(config.Topic),
+		kgo.ClientID(kafkaClientID),
+	}
+
+	switch config.Acks {
+	case "", "leader":
+		// idempotent writes require the acks of all in-sync replicas
+		opts = append(opts, kgo.RequiredAcks(kgo.LeaderAck()), kgo.DisableIdempotentWrite())
+	case "all":
+		opts = append(opts, kgo.RequiredAcks(kgo.AllISRAcks()))
+	default:
+		return nil, errors.New("kafka acks must be leader or all")
+	}
+
+	switch config.Compression {
+	case "":
+	case "none":
+		opts = append(opts, kgo.ProducerBatchCompression(kgo.NoCompression()))
+	case "gzip":
+		opts = append(opts, kgo.ProducerBatchCompression(kgo.GzipCompression()))
+	case "snappy":
+		opts = append(opts, kgo.ProducerBatchCompression(kgo.SnappyCompression()))
+	case "lz4":
+		opts = append(opts, kgo.ProducerBatchCompression(kgo.Lz4Compression()))
+	case "zstd":
+		opts = append(opts, kgo.ProducerBatchCompression(kgo.ZstdCompression()))
+	default:
+		return nil, errors.New("kafka compression must be none, gzip, snappy, lz4 or zstd")
+	}
+
+	if config.SASLMechanism != "" {
+		mechanism, err := newKafkaSASLMechanism(config)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, kgo.SASL(mechanism))
+	}
+	if config.TLS {
+		opts = append(opts, kgo.DialTLSConfig(&tls.Config{MinVersion: tls.VersionTLS12}))
+	}
+
+	client, err := kgo.NewClient(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating kafka client: %w", err)
+	}
+	return &kafkaSink{client: client}, nil
+}
+
+func newKafkaSASLMechanism(config AccessLogSinkConfig) (sasl.Mechanism, error) {
+	username, err := ReadFromEnvOrConfig(config.SASLUsername)
+	if err != nil {
+		return nil, err
+	}
+	password, err := ReadFromEnvOrConfig(config.SASLPassword)
+	if err != nil {
+		return nil, err
+	}
+	switch config.SASLMechanism {
+	case "plain":
+		return plain.Auth{User: username, Pass: password}.AsMechanism(), nil
+	case "scram-sha-256":
+		return scram.Auth{User: username, Pass: password}.AsSha256Mechanism(), nil
+	case "scram-sha-512":
+		return scram.Auth{User: username, Pass: password}.AsSha512Mechanism(), nil
+	default:
+		return nil, errors.New("kafka sasl mechanism must be plain, scram-sha-256 or scram-sha-512")
+	}
+}
+
+// write produces lines, returning once all of them are acknowledged or one of
+// them failed, so that the client doesn't retain them.
+func (s *kafkaSink) write(ctx context.Context, lines [][]byte) error {
+	records := make([]*kgo.Record, len(lines))
+	for i, line := range lines {
+		records[i] = &kgo.Record{Value: line}
+	}
+	return s.client.ProduceSync(ctx, records...).FirstErr()
+}
+
+func (s *kafkaSink) close() error {
+	s.client.Close()
+	return nil
+}
@@ -0,0 +1,129 @@
+package proxyd
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// keepaliveWriter writes a space to the client every interval until the
+// response is written, so that proxies and clients with idle timeouts don't
+// close the connection of slow requests. Leading whitespace is valid JSON.
+// Once the first space is written the status is 200, and the status of the
+// response is ignored.
+type keepaliveWriter struct {
+	http.ResponseWriter
+	flusher http.Flusher
+
+	mtx     sync.Mutex
+	started bool
+	done    bool
+	stopCh  chan struct{}
+	wg      sync.WaitGroup
+}
+
+// newKeepaliveWriter wraps w, or returns nil if w can't be flushed.
+func newKeepaliveWriter(w http.ResponseWriter, interval time.Duration) *keepaliveWriter {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil
+	}
+	kw := &keepaliveWriter{
+		ResponseWriter: w,
+		flusher:        flusher,
+		stopCh:         make(chan struct{}),
+	}
+	kw.wg.Add(1)
+	go func() {
+		defer kw.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if !kw.keepalive() {
+					return
+				}
+			case <-kw.stopCh:
+				return
+			}
+		}
+	}()
+	return kw
+}
+
+func (kw *keepaliveWriter) keepalive() bool {
+	kw.mtx.Lock()
+	defer kw.mtx.Unlock()
+	if kw.done {
+		return false
+	}
+	if !kw.started {
+		kw.started = true
+		kw.ResponseWriter.Header().Set("content-type", "application/json")
+		kw.ResponseWriter.WriteHeader(http.StatusOK)
+		RecordKeepaliveResponse()
+	}
+	if _, err := kw.ResponseWriter.Write([]byte(" ")); err != nil {
+		return false
+	}
+	kw.flusher.Flush()
+	return true
+}
+
+// finish stops the keepalives before the response is written.
+func (kw *keepaliveWriter) finish() {
+	kw.mtx.Lock()
+	defer kw.mtx.Unlock()
+	if !kw.done {
+		kw.done = true
+		close(kw.stopCh)
+	}
+}
+
+// Stop stops the keepalives and waits for them to return.
+func (kw *keepaliveWriter) Stop() {
+	kw.finish()
+	kw.wg.Wait()
+}
+
+// Started reports whether a keepalive was written, after which the status
+// can't be changed.
+func (kw *keepaliveWriter) Started() bool {
+	kw.mtx.Lock()
+	defer kw.mtx.Unlock()
+	return kw.started
+}
+
+func (kw *keepaliveWriter) WriteHeader(statusCode int) {
+	kw.finish()
+	if kw.Started() {
+		return
+	}
+	kw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (kw *keepaliveWriter) Write(b []byte) (int, error) {
+	kw.finish()
+	return kw.ResponseWriter.Write(b)
+}
+
+// needsKeepalive reports whether reqs contain a method served with
+// keepalives.
+func (s *Server) needsKeepalive(reqs []json.RawMessage) bool {
+	if s.keepaliveInterval == 0 {
+		return false
+	}
+	for _, raw := range reqs {
+		if req, err := ParseRPCReq(raw); err == nil && s.keepaliveMethods.Has(req.Method) {
+			return true
+		}
+	}
+	return false
+}
+
+func keepaliveStarted(w http.ResponseWriter) bool {
+	kw, ok := w.(*keepaliveWriter)
+	return ok && kw.Started()
+}
@@ -0,0 +1,102 @@
+package proxyd
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	LoadShedReasonQueueFull = "queue_full"
+	LoadShedReasonDeadline  = "deadline"
+
+	// loadShedEWMAWeight is the weight of the last interval between two slot
+	// releases in their moving average.
+	loadShedEWMAWeight = 0.1
+)
+
+// AdmissionQueue sheds the requests waiting for a slot of an RPCSemaphore
+// once it is saturated: requests are rejected with ErrServerOverloaded rather
+// than queued if maxQueued requests already wait, or if their projected wait
+// exceeds their deadline. The wait is projected from the rate at which slots
+// were released while requests were waiting.
+type AdmissionQueue struct {
+	sem       RPCSemaphore
+	size      int64
+	maxQueued int64
+
+	mu              sync.Mutex
+	inFlight        int64
+	queued          int64
+	lastRelease     time.Time
+	releaseInterval time.Duration
+}
+
+func NewAdmissionQueue(sem RPCSemaphore, size int64, maxQueued int64) *AdmissionQueue {
+	return &AdmissionQueue{
+		sem:       sem,
+		size:      size,
+		maxQueued: maxQueued,
+	}
+}
+
+func (q *AdmissionQueue) Acquire(ctx context.Context, n int64) error {
+	q.mu.Lock()
+	if q.inFlight+n > q.size {
+		if reason := q.shedReason(ctx); reason != "" {
+			q.mu.Unlock()
+			RecordLoadShed(reason)
+			return ErrServerOverloaded
+		}
+	}
+	q.queued++
+	RecordAdmissionQueueDepth(q.queued)
+	q.mu.Unlock()
+
+	err := q.sem.Acquire(ctx, n)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.queued--
+	RecordAdmissionQueueDepth(q.queued)
+	if err == nil {
+		q.inFlight += n
+	}
+	return err
+}
+
+func (q *AdmissionQueue) Release(n int64) {
+	q.mu.Lock()
+	q.inFlight -= n
+	now := time.Now()
+	// Only intervals while requests wait measure the service rate.
+	if q.queued > 0 && !q.lastRelease.IsZero() {
+		interval := now.Sub(q.lastRelease)
+		if q.releaseInterval == 0 {
+			q.releaseInterval = interval
+		} else {
+			q.releaseInterval = time.Duration(loadShedEWMAWeight*float64(interval) + (1-loadShedEWMAWeight)*float64(q.releaseInterval))
+		}
+	}
+	q.lastRelease = now
+	q.mu.Unlock()
+
+	q.sem.Release(n)
+}
+
+// shedReason returns why a request of ctx can't be queued, if it can't. It
+// must be called with mu held.
+func (q *AdmissionQueue) shedReason(ctx context.Context) string {
+	if q.maxQueued > 0 && q.queued >= q.maxQueued {
+		return LoadShedReasonQueueFull
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok || q.releaseInterval == 0 {
+		return ""
+	}
+	projectedWait := time.Duration(q.queued+1) * q.releaseInterval
+	if time.Now().Add(projectedWait).After(deadline) {
+		return LoadShedReasonDeadline
+	}
+	return ""
+}
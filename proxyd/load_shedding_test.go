@@ -0,0 +1,58 @@
+package proxyd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/semaphore"
+)
+
+func TestAdmissionQueue(t *testing.T) {
+	q := NewAdmissionQueue(semaphore.NewWeighted(1), 1, 1)
+	ctx := context.Background()
+	waitQueued := func(n int64) {
+		require.Eventually(t, func() bool {
+			q.mu.Lock()
+			defer q.mu.Unlock()
+			return q.queued == n
+		}, time.Second, time.Millisecond)
+	}
+
+	require.NoError(t, q.Acquire(ctx, 1))
+	errC := make(chan error)
+	go func() {
+		errC <- q.Acquire(ctx, 1)
+	}()
+	waitQueued(1)
+
+	// the queue is full
+	require.Equal(t, ErrServerOverloaded, q.Acquire(ctx, 1))
+
+	// releases while requests wait measure the release interval
+	time.Sleep(50 * time.Millisecond)
+	q.Release(1)
+	require.NoError(t, <-errC)
+	time.Sleep(50 * time.Millisecond)
+	go func() {
+		errC <- q.Acquire(ctx, 1)
+	}()
+	waitQueued(1)
+	q.Release(1)
+	require.NoError(t, <-errC)
+	q.mu.Lock()
+	require.GreaterOrEqual(t, q.releaseInterval, 50*time.Millisecond)
+	q.releaseInterval = time.Second
+	q.mu.Unlock()
+
+	// the projected wait exceeds the deadline
+	deadlineCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	require.Equal(t, ErrServerOverloaded, q.Acquire(deadlineCtx, 1))
+
+	// requests are not shed while slots are free
+	q.Release(1)
+	require.NoError(t, q.Acquire(deadlineCtx, 1))
+	q.Release(1)
+}
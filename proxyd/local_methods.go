@@ -0,0 +1,38 @@
+package proxyd
+
+import (
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// LocalResponder answers the methods whose result never changes for a chain,
+// like eth_chainId, without forwarding them.
+type LocalResponder struct {
+	results map[string]interface{}
+}
+
+func NewLocalResponder(config LocalMethodsConfig) *LocalResponder {
+	results := make(map[string]interface{})
+	if config.ChainID != 0 {
+		results["eth_chainId"] = hexutil.EncodeUint64(config.ChainID)
+		results["net_version"] = strconv.FormatUint(config.ChainID, 10)
+	}
+	if config.ClientVersion != "" {
+		results["web3_clientVersion"] = config.ClientVersion
+	}
+	for _, method := range config.DisabledMethods {
+		delete(results, method)
+	}
+	return &LocalResponder{results: results}
+}
+
+// Respond returns the local response to req, if its method is answered
+// locally.
+func (r *LocalResponder) Respond(req *RPCReq) (*RPCRes, bool) {
+	result, ok := r.results[req.Method]
+	if !ok {
+		return nil, false
+	}
+	return NewRPCRes(req.ID, result), true
+}
@@ -0,0 +1,175 @@
+package proxyd
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const cacheSyncRate = 1 * time.Second
+
+var errNoBlockNumber = errors.New("block number is not known yet")
+
+type lvcUpdateFn func(context.Context, *ethclient.Client) (string, error)
+
+// EthLastValueCache periodically polls a value from an RPC endpoint and keeps
+// the last seen value in the cache. The value is also kept in memory, so that
+// reads don't require a round trip to the cache.
+type EthLastValueCache struct {
+	client  *ethclient.Client
+	cache   Cache
+	key     string
+	updater lvcUpdateFn
+	last    atomic.Pointer[string]
+	// updatedAt is the unix time in nanoseconds at which last was polled.
+	updatedAt atomic.Int64
+	quit      chan struct{}
+}
+
+func newLVC(client *ethclient.Client, cache Cache, cacheKey string, updater lvcUpdateFn) *EthLastValueCache {
+	return &EthLastValueCache{
+		client:  client,
+		cache:   cache,
+		key:     cacheKey,
+		updater: updater,
+		quit:    make(chan struct{}),
+	}
+}
+
+func (h *EthLastValueCache) Start() {
+	go func() {
+		ticker := time.NewTicker(cacheSyncRate)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				lvcPollTimeGauge.WithLabelValues(h.key).SetToCurrentTime()
+
+				value, err := h.getUpdate()
+				if err != nil {
+					log.Error("error retrieving latest value", "key", h.key, "err", err)
+					continue
+				}
+				log.Trace("polling latest value", "value", value)
+				h.last.Store(&value)
+				h.updatedAt.Store(time.Now().UnixNano())
+
+				if err := h.cache.Put(context.Background(), h.key, value); err != nil {
+					log.Error("error writing last value to cache", "key", h.key, "err", err)
+				}
+
+			case <-h.quit:
+				return
+			}
+		}
+	}()
+}
+
+func (h *EthLastValueCache) getUpdate() (string, error) {
+	const maxRetries = 5
+	var err error
+
+	for i := 0; i <= maxRetries; i++ {
+		var value string
+		value, err = h.updater(context.Background(), h.client)
+		if err != nil {
+			backoff := calcBackoff(i)
+			log.Warn("http operation failed. retrying...", "err", err, "backoff", backoff)
+			lvcErrorsTotal.WithLabelValues(h.key).Inc()
+			time.Sleep(backoff)
+			continue
+		}
+		return value, nil
+	}
+
+	return "", wrapErr(err, "exceeded retries")
+}
+
+func (h *EthLastValueCache) Stop() {
+	close(h.quit)
+}
+
+func (h *EthLastValueCache) Read(ctx context.Context) (string, error) {
+	if last := h.last.Load(); last != nil {
+		return *last, nil
+	}
+	return h.cache.Get(ctx, h.key)
+}
+
+// ReadFresh returns the value polled by this instance, if it was polled less
+// than maxStaleness ago.
+func (h *EthLastValueCache) ReadFresh(maxStaleness time.Duration) (string, bool) {
+	last := h.last.Load()
+	if last == nil || time.Since(time.Unix(0, h.updatedAt.Load())) > maxStaleness {
+		return "", false
+	}
+	return *last, true
+}
+
+func makeGetBlockNumFn(lvc *EthLastValueCache) GetBlockNumFn {
+	return func(ctx context.Context) (uint64, error) {
+		value, err := lvc.Read(ctx)
+		if err != nil {
+			return 0, err
+		}
+		if value == "" {
+			return 0, errNoBlockNumber
+		}
+		return strconv.ParseUint(value, 10, 64)
+	}
+}
+
+func makeLatestBlockNumLVC(client *ethclient.Client, cache Cache) *EthLastValueCache {
+	return newLVC(client, cache, "lvc:block_number", func(ctx context.Context, c *ethclient.Client) (string, error) {
+		blockNum, err := c.BlockNumber(ctx)
+		return strconv.FormatUint(blockNum, 10), err
+	})
+}
+
+func makeSafeBlockNumLVC(client *ethclient.Client, cache Cache) *EthLastValueCache {
+	return newLVC(client, cache, "lvc:safe_block_number", func(ctx context.Context, c *ethclient.Client) (string, error) {
+		header, err := c.HeaderByNumber(ctx, big.NewInt(int64(rpc.SafeBlockNumber)))
+		if err != nil {
+			return "", err
+		}
+		return header.Number.String(), nil
+	})
+}
+
+func makeFinalizedBlockNumLVC(client *ethclient.Client, cache Cache) *EthLastValueCache {
+	return newLVC(client, cache, "lvc:finalized_block_number", func(ctx context.Context, c *ethclient.Client) (string, error) {
+		header, err := c.HeaderByNumber(ctx, big.NewInt(int64(rpc.FinalizedBlockNumber)))
+		if err != nil {
+			return "", err
+		}
+		return header.Number.String(), nil
+	})
+}
+
+func makeGasPriceLVC(client *ethclient.Client, cache Cache) *EthLastValueCache {
+	return newLVC(client, cache, "lvc:gas_price", func(ctx context.Context, c *ethclient.Client) (string, error) {
+		gasPrice, err := c.SuggestGasPrice(ctx)
+		if err != nil {
+			return "", err
+		}
+		return gasPrice.String(), nil
+	})
+}
+
+func makeMaxPriorityFeeLVC(client *ethclient.Client, cache Cache) *EthLastValueCache {
+	return newLVC(client, cache, "lvc:max_priority_fee_per_gas", func(ctx context.Context, c *ethclient.Client) (string, error) {
+		tip, err := c.SuggestGasTipCap(ctx)
+		if err != nil {
+			return "", err
+		}
+		return tip.String(), nil
+	})
+}
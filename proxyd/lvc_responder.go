@@ -0,0 +1,55 @@
+package proxyd
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+const (
+	LVCResponseServed = "served"
+	LVCResponseStale  = "stale"
+
+	defaultLVCMaxStaleness = 5 * time.Second
+)
+
+// LVCResponder answers eth_blockNumber, eth_gasPrice and
+// eth_maxPriorityFeePerGas with the values polled by the last-value caches,
+// as long as they are fresh enough. Requests are forwarded otherwise.
+type LVCResponder struct {
+	lvcs         map[string]*EthLastValueCache
+	maxStaleness time.Duration
+}
+
+// NewLVCResponder answers methods from the LVCs mapped to them.
+func NewLVCResponder(lvcs map[string]*EthLastValueCache, maxStaleness time.Duration) *LVCResponder {
+	if maxStaleness == 0 {
+		maxStaleness = defaultLVCMaxStaleness
+	}
+	return &LVCResponder{
+		lvcs:         lvcs,
+		maxStaleness: maxStaleness,
+	}
+}
+
+// Respond returns the response to req from its LVC, if its method is served
+// from an LVC and the polled value is fresh enough.
+func (r *LVCResponder) Respond(req *RPCReq) (*RPCRes, bool) {
+	lvc, ok := r.lvcs[req.Method]
+	if !ok {
+		return nil, false
+	}
+	value, ok := lvc.ReadFresh(r.maxStaleness)
+	if !ok {
+		RecordLVCResponse(req.Method, LVCResponseStale)
+		return nil, false
+	}
+	// LVC values are decimal
+	num, ok := new(big.Int).SetString(value, 10)
+	if !ok {
+		return nil, false
+	}
+	RecordLVCResponse(req.Method, LVCResponseServed)
+	return NewRPCRes(req.ID, hexutil.EncodeBig(num)), true
+}
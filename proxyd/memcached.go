@@ -0,0 +1,136 @@
+package proxyd
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+const (
+	defaultMemcachedTimeout      = 500 * time.Millisecond
+	defaultMemcachedMaxIdleConns = 16
+	maxMemcachedKeyLength        = 250
+	// expiration times above 30 days are interpreted by memcached as unix
+	// timestamps
+	maxMemcachedRelativeExpiration = 30 * 24 * time.Hour
+)
+
+// NewMemcachedClient returns a client distributing keys across servers by
+// hash, pooling maxIdleConns idle connections per server.
+func NewMemcachedClient(servers []string, timeout time.Duration, maxIdleConns int) (*memcache.Client, error) {
+	if len(servers) == 0 {
+		return nil, errors.New("must define at least one memcached server")
+	}
+	if timeout == 0 {
+		timeout = defaultMemcachedTimeout
+	}
+	if maxIdleConns == 0 {
+		maxIdleConns = defaultMemcachedMaxIdleConns
+	}
+	selector := new(memcache.ServerList)
+	if err := selector.SetServers(servers...); err != nil {
+		return nil, fmt.Errorf("invalid memcached servers: %w", err)
+	}
+	client := memcache.NewFromSelector(selector)
+	client.Timeout = timeout
+	client.MaxIdleConns = maxIdleConns
+	return client, nil
+}
+
+// memcachedExpiration returns the expiration of items expiring after ttl.
+func memcachedExpiration(ttl time.Duration) int32 {
+	if ttl > maxMemcachedRelativeExpiration {
+		return int32(time.Now().Add(ttl).Unix())
+	}
+	exp := int32(ttl.Seconds())
+	// 0 never expires, round sub-second ttls up
+	if ttl > 0 && exp == 0 {
+		exp = 1
+	}
+	return exp
+}
+
+// memcachedCache stores values in memcached. The memcached client has no
+// contexts, commands are bounded by its timeout instead.
+type memcachedCache struct {
+	client *memcache.Client
+	prefix string
+	ttl    time.Duration
+}
+
+func newMemcachedCache(client *memcache.Client, prefix string, ttl time.Duration) *memcachedCache {
+	return &memcachedCache{client, prefix, ttl}
+}
+
+// namespaced returns the memcached key of key. Keys that memcached would
+// reject are hashed.
+func (c *memcachedCache) namespaced(key string) string {
+	if c.prefix != "" {
+		key = strings.Join([]string{c.prefix, key}, ":")
+	}
+	if len(key) > maxMemcachedKeyLength || strings.ContainsFunc(key, func(r rune) bool {
+		return r <= ' ' || r == 0x7f
+	}) {
+		return fmt.Sprintf("%x", sha256.Sum256([]byte(key)))
+	}
+	return key
+}
+
+func (c *memcachedCache) Get(ctx context.Context, key string) (string, error) {
+	start := time.Now()
+	item, err := c.client.Get(c.namespaced(key))
+	memcachedCacheDurationSumm.WithLabelValues("GET").Observe(float64(time.Since(start).Milliseconds()))
+
+	if err == memcache.ErrCacheMiss {
+		return "", nil
+	}
+	if err != nil {
+		RecordMemcachedError("CacheGet")
+		return "", err
+	}
+	return string(item.Value), nil
+}
+
+func (c *memcachedCache) Put(ctx context.Context, key string, value string) error {
+	return c.PutWithTTL(ctx, key, value, c.ttl)
+}
+
+func (c *memcachedCache) PutWithTTL(ctx context.Context, key string, value string, ttl time.Duration) error {
+	start := time.Now()
+	err := c.client.Set(&memcache.Item{
+		Key:        c.namespaced(key),
+		Value:      []byte(value),
+		Expiration: memcachedExpiration(ttl),
+	})
+	memcachedCacheDurationSumm.WithLabelValues("SET").Observe(float64(time.Since(start).Milliseconds()))
+
+	if err != nil {
+		RecordMemcachedError("CacheSet")
+	}
+	return err
+}
+
+func (c *memcachedCache) Delete(ctx context.Context, key string) (bool, error) {
+	start := time.Now()
+	err := c.client.Delete(c.namespaced(key))
+	memcachedCacheDurationSumm.WithLabelValues("DELETE").Observe(float64(time.Since(start).Milliseconds()))
+
+	if err == memcache.ErrCacheMiss {
+		return false, nil
+	}
+	if err != nil {
+		RecordMemcachedError("CacheDelete")
+		return false, err
+	}
+	return true, nil
+}
+
+// Purge is not supported, as memcached can't enumerate keys.
+func (c *memcachedCache) Purge(ctx context.Context, prefix string) (int, error) {
+	return 0, ErrCachePurgeNotSupported
+}
@@ -0,0 +1,164 @@
+package proxyd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeMemcached serves the gets, set and delete commands of the memcached text
+// protocol used by the client.
+type fakeMemcached struct {
+	l     net.Listener
+	mtx   sync.Mutex
+	items map[string][]byte
+	exps  map[string]int64
+}
+
+func startFakeMemcached(t *testing.T) *fakeMemcached {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	m := &fakeMemcached{
+		l:     l,
+		items: make(map[string][]byte),
+		exps:  make(map[string]int64),
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go m.serve(conn)
+		}
+	}()
+	return m
+}
+
+func (m *fakeMemcached) expiration(key string) int64 {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return m.exps[key]
+}
+
+func (m *fakeMemcached) serve(conn net.Conn) {
+	defer conn.Close()
+	rw := bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+	for {
+		line, err := rw.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		m.mtx.Lock()
+		switch fields[0] {
+		case "gets":
+			if val, ok := m.items[fields[1]]; ok {
+				fmt.Fprintf(rw, "VALUE %s 0 %d 1\r\n%s\r\n", fields[1], len(val), val)
+			}
+			rw.WriteString("END\r\n")
+		case "set":
+			exp, _ := strconv.ParseInt(fields[3], 10, 64)
+			size, _ := strconv.Atoi(fields[4])
+			val := make([]byte, size+2)
+			if _, err := io.ReadFull(rw, val); err != nil {
+				m.mtx.Unlock()
+				return
+			}
+			m.items[fields[1]] = val[:size]
+			m.exps[fields[1]] = exp
+			rw.WriteString("STORED\r\n")
+		case "delete":
+			if _, ok := m.items[fields[1]]; ok {
+				delete(m.items, fields[1])
+				rw.WriteString("DELETED\r\n")
+			} else {
+				rw.WriteString("NOT_FOUND\r\n")
+			}
+		}
+		m.mtx.Unlock()
+		if err := rw.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func TestMemcachedCache(t *testing.T) {
+	ctx := context.Background()
+	m := startFakeMemcached(t)
+
+	client, err := NewMemcachedClient([]string{m.l.Addr().String()}, time.Second, 2)
+	require.NoError(t, err)
+	cache := newMemcachedCache(client, "proxyd", time.Hour)
+
+	t.Run("get missing", func(t *testing.T) {
+		val, err := cache.Get(ctx, "missing")
+		require.NoError(t, err)
+		require.Empty(t, val)
+	})
+
+	t.Run("put and get", func(t *testing.T) {
+		require.NoError(t, cache.Put(ctx, "foo", "bar"))
+		val, err := cache.Get(ctx, "foo")
+		require.NoError(t, err)
+		require.Equal(t, "bar", val)
+		require.Equal(t, int64(3600), m.expiration("proxyd:foo"))
+	})
+
+	t.Run("binary values", func(t *testing.T) {
+		compressed := newCacheWithCompression(cache, snappyCodec{})
+		value := strings.Repeat("\r\nEND\r\n\x00", 100)
+		require.NoError(t, compressed.Put(ctx, "bin", value))
+		val, err := compressed.Get(ctx, "bin")
+		require.NoError(t, err)
+		require.Equal(t, value, val)
+	})
+
+	t.Run("long ttls are absolute", func(t *testing.T) {
+		require.NoError(t, cache.PutWithTTL(ctx, "long", "ttl", 60*24*time.Hour))
+		require.Greater(t, m.expiration("proxyd:long"), time.Now().Unix())
+	})
+
+	t.Run("invalid keys are hashed", func(t *testing.T) {
+		key := strings.Repeat("k", 300) + " with spaces"
+		require.NoError(t, cache.Put(ctx, key, "val"))
+		val, err := cache.Get(ctx, key)
+		require.NoError(t, err)
+		require.Equal(t, "val", val)
+		require.Len(t, cache.namespaced(key), 64)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		require.NoError(t, cache.Put(ctx, "del", "val"))
+		deleted, err := cache.Delete(ctx, "del")
+		require.NoError(t, err)
+		require.True(t, deleted)
+		val, err := cache.Get(ctx, "del")
+		require.NoError(t, err)
+		require.Empty(t, val)
+
+		deleted, err = cache.Delete(ctx, "del")
+		require.NoError(t, err)
+		require.False(t, deleted)
+
+		_, err = cache.Purge(ctx, "")
+		require.ErrorIs(t, err, ErrCachePurgeNotSupported)
+	})
+
+	t.Run("server down", func(t *testing.T) {
+		client, err := NewMemcachedClient([]string{"127.0.0.1:1"}, 100*time.Millisecond, 0)
+		require.NoError(t, err)
+		_, err = newMemcachedCache(client, "", time.Hour).Get(ctx, "foo")
+		require.Error(t, err)
+	})
+}
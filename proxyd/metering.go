@@ -0,0 +1,193 @@
+package proxyd
+
+import (
+	"context"
+	"math/rand"
+	"regexp"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMeteringSampleRate = 0.01
+	defaultMeteringWindow     = 10 * time.Minute
+	maxProfileClients         = 1000
+	maxProfileUnmappedMethods = 500
+)
+
+// unmappedMethodPattern matches plausible RPC method names, so that arbitrary
+// method names sent by clients don't end up in profiles.
+var unmappedMethodPattern = regexp.MustCompile(`^[a-z][a-z0-9]*_[a-zA-Z0-9]{1,64}$`)
+
+// TrafficProfile is a sampled record of the requests served by proxyd.
+// Request counts are sampled, and need to be divided by the sample rate to
+// estimate the actual traffic.
+type TrafficProfile struct {
+	Start      time.Time                 `json:"start"`
+	End        time.Time                 `json:"end"`
+	SampleRate float64                   `json:"sample_rate"`
+	Methods    map[string]*MethodTraffic `json:"methods"`
+	// UnmappedMethods counts the requests for methods without a mapping.
+	UnmappedMethods map[string]uint64 `json:"unmapped_methods"`
+}
+
+type MethodTraffic struct {
+	Requests uint64                    `json:"requests"`
+	Clients  map[string]*ClientTraffic `json:"clients"`
+}
+
+type ClientTraffic struct {
+	Requests  uint64 `json:"requests"`
+	Origin    string `json:"origin,omitempty"`
+	UserAgent string `json:"user_agent,omitempty"`
+}
+
+func newTrafficProfile(start time.Time, sampleRate float64) *TrafficProfile {
+	return &TrafficProfile{
+		Start:      start,
+		End:        start,
+		SampleRate: sampleRate,
+		Methods:    make(map[string]*MethodTraffic),
+
+		UnmappedMethods: make(map[string]uint64),
+	}
+}
+
+func (p *TrafficProfile) recordUnmapped(method string) {
+	if _, ok := p.UnmappedMethods[method]; !ok && len(p.UnmappedMethods) >= maxProfileUnmappedMethods {
+		return
+	}
+	p.UnmappedMethods[method]++
+}
+
+func (p *TrafficProfile) record(method string, remoteIP string, origin string, userAgent string) {
+	mt := p.Methods[method]
+	if mt == nil {
+		mt = &MethodTraffic{Clients: make(map[string]*ClientTraffic)}
+		p.Methods[method] = mt
+	}
+	mt.Requests++
+
+	ct := mt.Clients[remoteIP]
+	if ct == nil {
+		if len(mt.Clients) >= maxProfileClients {
+			return
+		}
+		ct = &ClientTraffic{}
+		mt.Clients[remoteIP] = ct
+	}
+	ct.Requests++
+	ct.Origin = origin
+	ct.UserAgent = userAgent
+}
+
+func (p *TrafficProfile) merge(other *TrafficProfile) {
+	if other.Start.Before(p.Start) {
+		p.Start = other.Start
+	}
+	if other.End.After(p.End) {
+		p.End = other.End
+	}
+	for method, omt := range other.Methods {
+		mt := p.Methods[method]
+		if mt == nil {
+			mt = &MethodTraffic{Clients: make(map[string]*ClientTraffic)}
+			p.Methods[method] = mt
+		}
+		mt.Requests += omt.Requests
+
+		for remoteIP, oct := range omt.Clients {
+			ct := mt.Clients[remoteIP]
+			if ct == nil {
+				if len(mt.Clients) >= maxProfileClients {
+					continue
+				}
+				ct = &ClientTraffic{}
+				mt.Clients[remoteIP] = ct
+			}
+			ct.Requests += oct.Requests
+			ct.Origin = oct.Origin
+			ct.UserAgent = oct.UserAgent
+		}
+	}
+	for method, requests := range other.UnmappedMethods {
+		if _, ok := p.UnmappedMethods[method]; !ok && len(p.UnmappedMethods) >= maxProfileUnmappedMethods {
+			continue
+		}
+		p.UnmappedMethods[method] += requests
+	}
+}
+
+// Duration returns the time span covered by the profile.
+func (p *TrafficProfile) Duration() time.Duration {
+	return p.End.Sub(p.Start)
+}
+
+// TrafficRecorder samples served requests into traffic profiles. Profiles are
+// rotated every window, and the recent profile covers the current and the
+// previous window.
+type TrafficRecorder struct {
+	sampleRate float64
+	window     time.Duration
+	mtx        sync.Mutex
+	current    *TrafficProfile
+	previous   *TrafficProfile
+}
+
+func NewTrafficRecorder(sampleRate float64, window time.Duration) *TrafficRecorder {
+	return &TrafficRecorder{
+		sampleRate: sampleRate,
+		window:     window,
+		current:    newTrafficProfile(time.Now(), sampleRate),
+	}
+}
+
+// Record samples a request for method served to the client in ctx.
+func (t *TrafficRecorder) Record(ctx context.Context, method string) {
+	if rand.Float64() >= t.sampleRate {
+		return
+	}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.rotate(time.Now())
+	t.current.record(method, stripXFF(GetXForwardedFor(ctx)), GetOrigin(ctx), GetUserAgent(ctx))
+}
+
+// RecordUnmapped samples a request for method, which has no mapping.
+func (t *TrafficRecorder) RecordUnmapped(method string) {
+	if !unmappedMethodPattern.MatchString(method) || rand.Float64() >= t.sampleRate {
+		return
+	}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.rotate(time.Now())
+	t.current.recordUnmapped(method)
+}
+
+// Profile returns a copy of the recent traffic profile.
+func (t *TrafficRecorder) Profile() *TrafficProfile {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	now := time.Now()
+	t.rotate(now)
+	t.current.End = now
+
+	profile := newTrafficProfile(t.current.Start, t.sampleRate)
+	if t.previous != nil {
+		profile.merge(t.previous)
+	}
+	profile.merge(t.current)
+	return profile
+}
+
+func (t *TrafficRecorder) rotate(now time.Time) {
+	if now.Sub(t.current.Start) < t.window {
+		return
+	}
+	t.current.End = now
+	t.previous = t.current
+	t.current = newTrafficProfile(now, t.sampleRate)
+}
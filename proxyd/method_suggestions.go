@@ -0,0 +1,123 @@
+package proxyd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MethodMappingSuggestions suggests mappings for the unmapped methods
+// requested in a traffic profile. Request counts are estimates of the actual
+// requests over the profile duration.
+type MethodMappingSuggestions struct {
+	ProfileStart time.Time                  `json:"profile_start"`
+	ProfileEnd   time.Time                  `json:"profile_end"`
+	Suggestions  []*MethodMappingSuggestion `json:"suggestions"`
+	// Unused lists the mapped methods which were not requested.
+	Unused []string `json:"unused"`
+	// Diff applies the suggestions to the rpc_method_mappings config.
+	Diff string `json:"diff"`
+}
+
+type MethodMappingSuggestion struct {
+	Method   string  `json:"method"`
+	Requests float64 `json:"requests"`
+	Group    string  `json:"group"`
+	// Reason is "namespace" if the group serves most of the traffic of the
+	// namespace of the method, "default" if it serves most of the traffic.
+	Reason string `json:"reason"`
+}
+
+// SuggestMethodMappings suggests a backend group for the unmapped methods with
+// at least minRequests estimated requests in profile, based on where mappings
+// route the traffic of other methods of the same namespace.
+func SuggestMethodMappings(mappings map[string]string, profile *TrafficProfile, minRequests float64) *MethodMappingSuggestions {
+	res := &MethodMappingSuggestions{
+		ProfileStart: profile.Start,
+		ProfileEnd:   profile.End,
+		Suggestions:  make([]*MethodMappingSuggestion, 0),
+		Unused:       make([]string, 0),
+	}
+	if profile.SampleRate <= 0 || len(mappings) == 0 {
+		return res
+	}
+	scale := 1 / profile.SampleRate
+
+	// each mapping weighs one request, so that untrafficked mappings still
+	// count towards their group
+	namespaceWeights := make(map[string]map[string]float64)
+	groupWeights := make(map[string]float64)
+	for method, group := range mappings {
+		weight := 1.0
+		if mt, ok := profile.Methods[method]; ok {
+			weight += float64(mt.Requests) * scale
+		} else {
+			res.Unused = append(res.Unused, method)
+		}
+		ns := methodNamespace(method)
+		if namespaceWeights[ns] == nil {
+			namespaceWeights[ns] = make(map[string]float64)
+		}
+		namespaceWeights[ns][group] += weight
+		groupWeights[group] += weight
+	}
+	defaultGroup := heaviestGroup(groupWeights)
+
+	for method, count := range profile.UnmappedMethods {
+		requests := float64(count) * scale
+		if requests < minRequests {
+			continue
+		}
+		// the method may have been mapped since it was recorded
+		if _, ok := mappings[method]; ok {
+			continue
+		}
+		suggestion := &MethodMappingSuggestion{
+			Method:   method,
+			Requests: requests,
+			Group:    defaultGroup,
+			Reason:   "default",
+		}
+		if weights, ok := namespaceWeights[methodNamespace(method)]; ok {
+			suggestion.Group = heaviestGroup(weights)
+			suggestion.Reason = "namespace"
+		}
+		res.Suggestions = append(res.Suggestions, suggestion)
+	}
+
+	sort.Slice(res.Suggestions, func(i, j int) bool {
+		if res.Suggestions[i].Requests != res.Suggestions[j].Requests {
+			return res.Suggestions[i].Requests > res.Suggestions[j].Requests
+		}
+		return res.Suggestions[i].Method < res.Suggestions[j].Method
+	})
+	sort.Strings(res.Unused)
+
+	var diff strings.Builder
+	if len(res.Suggestions) > 0 {
+		diff.WriteString(" [rpc_method_mappings]\n")
+		for _, suggestion := range res.Suggestions {
+			fmt.Fprintf(&diff, "+%s = %q\n", suggestion.Method, suggestion.Group)
+		}
+	}
+	res.Diff = diff.String()
+	return res
+}
+
+func methodNamespace(method string) string {
+	ns, _, _ := strings.Cut(method, "_")
+	return ns
+}
+
+// heaviestGroup returns the group with the highest weight, ties are broken by
+// name for stable suggestions.
+func heaviestGroup(weights map[string]float64) string {
+	var group string
+	for g, w := range weights {
+		if group == "" || w > weights[group] || (w == weights[group] && g < group) {
+			group = g
+		}
+	}
+	return group
+}
@@ -5,25 +5,60 @@ import (
 	"crypto/sha256"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rpc"
 )
 
+// blockParamPositions maps methods to the position of their block parameter.
+var blockParamPositions = map[string]int{
+	"eth_getBalance":                          1,
+	"eth_getCode":                             1,
+	"eth_getTransactionCount":                 1,
+	"eth_call":                                1,
+	"eth_getStorageAt":                        2,
+	"eth_getProof":                            2,
+	"eth_getBlockTransactionCountByNumber":    0,
+	"eth_getUncleCountByBlockNumber":          0,
+	"eth_getBlockByNumber":                    0,
+	"eth_getTransactionByBlockNumberAndIndex": 0,
+	"eth_getUncleByBlockNumberAndIndex":       0,
+	"debug_getRawReceipts":                    0,
+}
+
 type RPCMethodHandler interface {
 	GetRPCMethod(context.Context, *RPCReq) (*RPCRes, error)
 	PutRPCMethod(context.Context, *RPCReq, *RPCRes) error
+	DeleteRPCMethod(context.Context, *RPCReq) (bool, error)
+	// PurgeRPCMethod removes all cached responses of a method.
+	PurgeRPCMethod(ctx context.Context, method string) (int, error)
+	// CacheKey returns the key req is cached at, and whether it is cacheable.
+	CacheKey(*RPCReq) (string, bool)
+	Cache() Cache
 }
 
 type StaticMethodHandler struct {
-	cache     Cache
-	m         sync.RWMutex
-	filterGet func(*RPCReq) bool
-	filterPut func(*RPCReq, *RPCRes) bool
+	cache       Cache
+	m           sync.RWMutex
+	ttl         time.Duration
+	negativeTTL time.Duration
+	filterGet   func(*RPCReq) bool
+	filterPut   func(*RPCReq, *RPCRes) bool
+	keyFn       func(*RPCReq) string
+	// ttlFn overrides the TTL of a response, if it returns true. A zero TTL
+	// doesn't expire.
+	ttlFn func(*RPCReq, *RPCRes) (time.Duration, bool)
 }
 
 func (e *StaticMethodHandler) key(req *RPCReq) string {
+	if e.keyFn != nil {
+		return e.keyFn(req)
+	}
 	// signature is the hashed json.RawMessage param contents
 	h := sha256.New()
 	h.Write(req.Params)
@@ -31,6 +66,41 @@ func (e *StaticMethodHandler) key(req *RPCReq) string {
 	return strings.Join([]string{"cache", req.Method, signature}, ":")
 }
 
+func (e *StaticMethodHandler) CacheKey(req *RPCReq) (string, bool) {
+	if e.cache == nil || (e.filterGet != nil && !e.filterGet(req)) {
+		return "", false
+	}
+	return e.key(req), true
+}
+
+func (e *StaticMethodHandler) Cache() Cache {
+	return e.cache
+}
+
+func (e *StaticMethodHandler) DeleteRPCMethod(ctx context.Context, req *RPCReq) (bool, error) {
+	key, ok := e.CacheKey(req)
+	if !ok {
+		return false, nil
+	}
+
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	return e.cache.Delete(ctx, key)
+}
+
+func (e *StaticMethodHandler) PurgeRPCMethod(ctx context.Context, method string) (int, error) {
+	if e.cache == nil {
+		return 0, nil
+	}
+
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	// keys of all methods are prefixed alike, see key
+	return e.cache.Purge(ctx, strings.Join([]string{"cache", method, ""}, ":"))
+}
+
 func (e *StaticMethodHandler) GetRPCMethod(ctx context.Context, req *RPCReq) (*RPCRes, error) {
 	if e.cache == nil {
 		return nil, nil
@@ -51,6 +121,7 @@ func (e *StaticMethodHandler) GetRPCMethod(ctx context.Context, req *RPCReq) (*R
 	if val == "" {
 		return nil, nil
 	}
+	setCacheLookupBytes(ctx, len(val))
 
 	var result interface{}
 	if err := json.Unmarshal([]byte(val), &result); err != nil {
@@ -72,8 +143,13 @@ func (e *StaticMethodHandler) PutRPCMethod(ctx context.Context, req *RPCReq, res
 	if e.filterGet != nil && !e.filterGet(req) {
 		return nil
 	}
+	// null results, e.g. of unknown transactions, are only cached briefly
+	negative := res.Result == nil
+	if negative && e.negativeTTL == 0 {
+		return nil
+	}
 	// response filter
-	if e.filterPut != nil && !e.filterPut(req, res) {
+	if !negative && e.filterPut != nil && !e.filterPut(req, res) {
 		return nil
 	}
 
@@ -83,10 +159,324 @@ func (e *StaticMethodHandler) PutRPCMethod(ctx context.Context, req *RPCReq, res
 	key := e.key(req)
 	value := mustMarshalJSON(res.Result)
 
-	err := e.cache.Put(ctx, key, string(value))
+	var err error
+	ttl, ttlOverridden := time.Duration(0), false
+	if !negative && e.ttlFn != nil {
+		ttl, ttlOverridden = e.ttlFn(req, res)
+	}
+	if negative {
+		err = e.cache.PutWithTTL(ctx, key, string(value), e.negativeTTL)
+	} else if ttlOverridden {
+		err = e.cache.PutWithTTL(ctx, key, string(value), ttl)
+	} else if e.ttl > 0 {
+		err = e.cache.PutWithTTL(ctx, key, string(value), e.ttl)
+	} else {
+		err = e.cache.Put(ctx, key, string(value))
+	}
 	if err != nil {
 		log.Error("error putting into cache", "key", key, "method", req.Method, "err", err)
 		return err
 	}
 	return nil
 }
+
+// newMethodPolicyHandler creates a handler that caches method according to the
+// operator defined policy in cfg. Responses of finalized blocks are considered
+// confirmed whatever the required confirmations.
+func newMethodPolicyHandler(cache Cache, method string, cfg *CacheMethodConfig, opts rpcCacheOptions) *StaticMethodHandler {
+	// the block of the response takes precedence, as it is the only one known
+	// for lookups by hash
+	blockOf := func(req *RPCReq, res *RPCRes) *uint64 {
+		blockNum, ok := resultBlockNumber(res)
+		if !ok {
+			blockNum, _ = pinnedBlock(req)
+		}
+		return blockNum
+	}
+	isAtOrBelow := func(getBlockNumFn GetBlockNumFn, blockNum uint64) bool {
+		if getBlockNumFn == nil {
+			return false
+		}
+		height, err := getBlockNumFn(context.Background())
+		return err == nil && height >= blockNum
+	}
+
+	h := &StaticMethodHandler{
+		cache:       cache,
+		ttl:         time.Duration(cfg.TTL),
+		negativeTTL: time.Duration(cfg.NegativeTTL),
+		filterGet: func(req *RPCReq) bool {
+			if !cfg.PinnedBlock {
+				return true
+			}
+			_, pinned := pinnedBlock(req)
+			return pinned
+		},
+		filterPut: func(req *RPCReq, res *RPCRes) bool {
+			if res.Result == nil {
+				return false
+			}
+			if cfg.MaxSizeBytes > 0 && len(mustMarshalJSON(res.Result)) > cfg.MaxSizeBytes {
+				return false
+			}
+			minConfirmations := uint64(cfg.MinConfirmations)
+			if cfg.AutoConfirmations {
+				if opts.autoConfirmations == nil {
+					return false
+				}
+				if c := opts.autoConfirmations.Confirmations(); c > minConfirmations {
+					minConfirmations = c
+				}
+			}
+			if minConfirmations == 0 && !cfg.Safe && !cfg.Finalized {
+				return true
+			}
+
+			blockNum := blockOf(req, res)
+			if blockNum == nil {
+				return false
+			}
+			if isAtOrBelow(opts.getFinalizedBlockNumFn, *blockNum) {
+				return true
+			}
+			if cfg.Finalized {
+				return false
+			}
+			if cfg.Safe && !isAtOrBelow(opts.getSafeBlockNumFn, *blockNum) {
+				return false
+			}
+			if minConfirmations > 0 {
+				if opts.getLatestBlockNumFn == nil {
+					return false
+				}
+				latest, err := opts.getLatestBlockNumFn(context.Background())
+				if err != nil || latest < *blockNum || latest-*blockNum < minConfirmations {
+					return false
+				}
+			}
+			return true
+		},
+	}
+	if cfg.FinalizedNoExpiry {
+		h.ttlFn = func(req *RPCReq, res *RPCRes) (time.Duration, bool) {
+			blockNum := blockOf(req, res)
+			return 0, blockNum != nil && isAtOrBelow(opts.getFinalizedBlockNumFn, *blockNum)
+		}
+	}
+	return h
+}
+
+// newEthCallHandler returns a handler caching eth_call results at a specific
+// block, keyed by the normalized call object and the block. Calls at a block
+// number are only cached once the block has cfg.MinConfirmations.
+func newEthCallHandler(cache Cache, cfg EthCallCacheConfig, getLatestBlockNumFn GetBlockNumFn) *StaticMethodHandler {
+	return &StaticMethodHandler{
+		cache: cache,
+		ttl:   time.Duration(cfg.TTL),
+		keyFn: func(req *RPCReq) string {
+			call, block, _ := parseEthCall(req)
+			return strings.Join([]string{"cache", req.Method, call, block}, ":")
+		},
+		filterGet: func(req *RPCReq) bool {
+			_, _, ok := parseEthCall(req)
+			return ok
+		},
+		filterPut: func(req *RPCReq, res *RPCRes) bool {
+			if res.Result == nil {
+				return false
+			}
+			if cfg.MaxEntryBytes > 0 && len(mustMarshalJSON(res.Result)) > cfg.MaxEntryBytes {
+				return false
+			}
+			blockNum, _ := pinnedBlock(req)
+			if blockNum == nil || cfg.MinConfirmations == 0 {
+				return true
+			}
+			if getLatestBlockNumFn == nil {
+				return false
+			}
+			latest, err := getLatestBlockNumFn(context.Background())
+			return err == nil && latest >= *blockNum && latest-*blockNum >= uint64(cfg.MinConfirmations)
+		},
+	}
+}
+
+// parseEthCall returns the signature of the normalized call object of an
+// eth_call request, and the block it is made at, if it is made at a specific
+// block without state overrides.
+func parseEthCall(req *RPCReq) (string, string, bool) {
+	var p []json.RawMessage
+	if err := json.Unmarshal(req.Params, &p); err != nil || len(p) != 2 {
+		return "", "", false
+	}
+	blockNum, pinned := pinnedBlock(req)
+	if !pinned {
+		return "", "", false
+	}
+	var block string
+	if blockNum != nil {
+		block = hexutil.EncodeUint64(*blockNum)
+	} else {
+		var bnh rpc.BlockNumberOrHash
+		if err := json.Unmarshal(p[1], &bnh); err != nil || bnh.BlockHash == nil {
+			return "", "", false
+		}
+		block = bnh.BlockHash.Hex()
+	}
+
+	// hex values are case insensitive, and the order of fields is irrelevant
+	var call map[string]interface{}
+	if err := json.Unmarshal(p[0], &call); err != nil || call == nil {
+		return "", "", false
+	}
+	for k, v := range call {
+		if s, ok := v.(string); ok {
+			call[k] = strings.ToLower(s)
+		}
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(mustMarshalJSON(call))), block, true
+}
+
+// newEthGetLogsHandler returns a handler caching eth_getLogs results for block
+// number ranges that are finalized, or have cfg.MinConfirmations if set. Keys
+// are normalized, so that equivalent filters share cache entries.
+func newEthGetLogsHandler(cache Cache, cfg EthGetLogsCacheConfig, getLatestBlockNumFn, getFinalizedBlockNumFn GetBlockNumFn) *StaticMethodHandler {
+	return &StaticMethodHandler{
+		cache: cache,
+		ttl:   time.Duration(cfg.TTL),
+		keyFn: func(req *RPCReq) string {
+			filter, from, to, _ := parseLogsFilter(req)
+			return strings.Join([]string{"cache", req.Method, filter, hexutil.EncodeUint64(from), hexutil.EncodeUint64(to)}, ":")
+		},
+		filterGet: func(req *RPCReq) bool {
+			_, _, _, ok := parseLogsFilter(req)
+			return ok
+		},
+		filterPut: func(req *RPCReq, res *RPCRes) bool {
+			if res.Result == nil {
+				return false
+			}
+			if cfg.MaxEntryBytes > 0 && len(mustMarshalJSON(res.Result)) > cfg.MaxEntryBytes {
+				return false
+			}
+			_, _, to, _ := parseLogsFilter(req)
+			ctx := context.Background()
+			if cfg.MinConfirmations > 0 {
+				latest, err := getLatestBlockNumFn(ctx)
+				return err == nil && latest >= to && latest-to >= uint64(cfg.MinConfirmations)
+			}
+			if getFinalizedBlockNumFn == nil {
+				return false
+			}
+			finalized, err := getFinalizedBlockNumFn(ctx)
+			return err == nil && finalized >= to
+		},
+	}
+}
+
+type logsFilter struct {
+	FromBlock *rpc.BlockNumber  `json:"fromBlock"`
+	ToBlock   *rpc.BlockNumber  `json:"toBlock"`
+	BlockHash *string           `json:"blockHash"`
+	Address   json.RawMessage   `json:"address"`
+	Topics    []json.RawMessage `json:"topics"`
+}
+
+// parseLogsFilter returns the signature of the normalized address and topics
+// of an eth_getLogs request, and its block range, if it queries a range of
+// block numbers.
+func parseLogsFilter(req *RPCReq) (string, uint64, uint64, bool) {
+	var p []logsFilter
+	if err := json.Unmarshal(req.Params, &p); err != nil || len(p) != 1 {
+		return "", 0, 0, false
+	}
+	f := p[0]
+	if f.BlockHash != nil || f.FromBlock == nil || f.ToBlock == nil ||
+		*f.FromBlock < 0 || *f.ToBlock < 0 || *f.FromBlock > *f.ToBlock {
+		return "", 0, 0, false
+	}
+
+	addresses, ok := normalizeHexList(f.Address)
+	if !ok {
+		return "", 0, 0, false
+	}
+	// topics are positional, only the alternatives of a position are unordered
+	topics := make([][]string, len(f.Topics))
+	for i, t := range f.Topics {
+		if topics[i], ok = normalizeHexList(t); !ok {
+			return "", 0, 0, false
+		}
+	}
+	// trailing wildcards match the same logs as no topics at these positions
+	for len(topics) > 0 && len(topics[len(topics)-1]) == 0 {
+		topics = topics[:len(topics)-1]
+	}
+
+	signature := sha256.Sum256(mustMarshalJSON([]interface{}{addresses, topics}))
+	return fmt.Sprintf("%x", signature), uint64(*f.FromBlock), uint64(*f.ToBlock), true
+}
+
+// normalizeHexList returns the sorted and lowercased hex strings of a filter
+// field that is either null, a string or a list of strings.
+func normalizeHexList(raw json.RawMessage) ([]string, bool) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return []string{}, true
+	}
+	var list []string
+	if err := json.Unmarshal(raw, &list); err != nil {
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, false
+		}
+		list = []string{s}
+	}
+	for i, s := range list {
+		list[i] = strings.ToLower(s)
+	}
+	sort.Strings(list)
+	return list, true
+}
+
+// pinnedBlock returns whether req targets a specific block rather than a block
+// tag, along with its number if the block is not referenced by hash.
+func pinnedBlock(req *RPCReq) (*uint64, bool) {
+	pos, ok := blockParamPositions[req.Method]
+	if !ok {
+		return nil, false
+	}
+	var p []json.RawMessage
+	if err := json.Unmarshal(req.Params, &p); err != nil || len(p) <= pos {
+		return nil, false
+	}
+	var bnh rpc.BlockNumberOrHash
+	if err := json.Unmarshal(p[pos], &bnh); err != nil {
+		return nil, false
+	}
+	if bnh.BlockHash != nil {
+		return nil, true
+	}
+	if bnh.BlockNumber == nil || *bnh.BlockNumber < 0 {
+		return nil, false
+	}
+	num := uint64(*bnh.BlockNumber)
+	return &num, true
+}
+
+// resultBlockNumber returns the block number embedded in results like blocks,
+// transactions and receipts.
+func resultBlockNumber(res *RPCRes) (*uint64, bool) {
+	obj, ok := res.Result.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	for _, field := range []string{"blockNumber", "number"} {
+		if val, ok := obj[field].(string); ok {
+			num, err := hexutil.DecodeUint64(val)
+			if err != nil {
+				return nil, false
+			}
+			return &num, true
+		}
+	}
+	return nil, false
+}
@@ -24,6 +24,10 @@ const (
 	SourceClient  = "client"
 	SourceBackend = "backend"
 	MethodUnknown = "unknown"
+
+	AuthRejectionRateLimit       = "rate_limit"
+	AuthRejectionMethodRateLimit = "method_rate_limit"
+	AuthRejectionQuota           = "quota"
 )
 
 var PayloadSizeBuckets = []float64{10, 50, 100, 500, 1000, 5000, 10000, 100000, 1000000}
@@ -150,6 +154,18 @@ var (
 		"source",
 	})
 
+	redisUp = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: MetricsNamespace,
+		Name:      "redis_up",
+		Help:      "1 if Redis is available, 0 while the circuit breaker is open.",
+	})
+
+	redisBreakerTripsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "redis_circuit_breaker_trips_total",
+		Help:      "Count of times the Redis circuit breaker opened.",
+	})
+
 	requestPayloadSizesGauge = promauto.NewHistogramVec(prometheus.HistogramOpts{
 		Namespace: MetricsNamespace,
 		Name:      "request_payload_sizes",
@@ -192,12 +208,101 @@ var (
 		"method",
 	})
 
+	cacheStaleTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "cache_stale_total",
+		Help:      "Number of cache lookups finding an expired entry, which are not counted as misses.",
+	}, []string{
+		"method",
+	})
+
+	cacheSavedBytesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "cache_saved_bytes_total",
+		Help:      "Size of the cached results served instead of forwarding requests.",
+	}, []string{
+		"method",
+	})
+
 	batchRPCShortCircuitsTotal = promauto.NewCounter(prometheus.CounterOpts{
 		Namespace: MetricsNamespace,
 		Name:      "batch_rpc_short_circuits_total",
 		Help:      "Count of total batch RPC short-circuits.",
 	})
 
+	coalescedRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "coalesced_requests_total",
+		Help:      "Count of requests served by sharing the response of an identical in-flight request.",
+	}, []string{
+		"auth",
+		"method",
+	})
+
+	localCacheRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "local_cache_requests_total",
+		Help:      "Count of lookups in the in-process cache tier by result.",
+	}, []string{
+		"result",
+	})
+
+	memoryCacheEvictionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "memory_cache_evictions_total",
+		Help:      "Count of entries evicted from the in-memory cache by reason.",
+	}, []string{
+		"reason",
+	})
+
+	memoryCacheSizeBytes = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: MetricsNamespace,
+		Name:      "memory_cache_size_bytes",
+		Help:      "Total size of the keys and values held in the in-memory caches.",
+	})
+
+	lvcErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "lvc_errors_total",
+		Help:      "Count of lvc errors.",
+	}, []string{
+		"key",
+	})
+
+	lvcPollTimeGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: MetricsNamespace,
+		Name:      "lvc_poll_time_gauge",
+		Help:      "Gauge of lvc poll time.",
+	}, []string{
+		"key",
+	})
+
+	configReloadsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "config_reloads_total",
+		Help:      "Count of config reloads by result.",
+	}, []string{
+		"result",
+	})
+
+	upgradeHintsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "upgrade_hints_total",
+		Help:      "Count of responses to polling clients that advertised or required a WS upgrade.",
+	}, []string{
+		"auth",
+		"method",
+		"action",
+	})
+
+	upgradeHintTopClientsGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: MetricsNamespace,
+		Name:      "upgrade_hint_top_clients",
+		Help:      "Hinted polls of the clients hinted the most over the last upgrade hint interval.",
+	}, []string{
+		"client",
+	})
+
 	rpcSpecialErrors = []string{
 		"nonce too low",
 		"gas price too high",
@@ -212,6 +317,561 @@ var (
 		Buckets:   MillisecondDurationBuckets,
 	}, []string{"command"})
 
+	memcachedCacheDurationSumm = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: MetricsNamespace,
+		Name:      "memcached_cache_duration_milliseconds",
+		Help:      "Histogram of memcached command durations, in milliseconds.",
+		Buckets:   MillisecondDurationBuckets,
+	}, []string{"command"})
+
+	peeringRejectionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "peering_rejections_total",
+		Help:      "Count of requests from peers rejected for looping or reaching the maximum number of hops.",
+	}, []string{
+		"reason",
+	})
+
+	peeringDeduplicatedRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "peering_deduplicated_requests_total",
+		Help:      "Count of requests from peers served by sharing the response of an in-flight request with the same request ID.",
+	}, []string{
+		"method",
+	})
+
+	blobTxRejectionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "blob_tx_rejections_total",
+		Help:      "Count of blob transactions rejected by the blob sender rate limit.",
+	}, []string{
+		"reason",
+	})
+
+	txValidationRejectionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "tx_validation_rejections_total",
+		Help:      "Count of raw transactions rejected before forwarding, by reason.",
+	}, []string{
+		"reason",
+	})
+
+	txPolicyRejectionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "tx_policy_rejections_total",
+		Help:      "Count of raw transactions rejected by the blocklist or allowlist of the transaction policy.",
+	}, []string{
+		"list",
+	})
+
+	txPolicyListSize = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: MetricsNamespace,
+		Name:      "tx_policy_list_size",
+		Help:      "Gauge of the number of addresses of the transaction policy lists.",
+	}, []string{
+		"list",
+	})
+
+	txPolicyRefreshErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "tx_policy_refresh_errors_total",
+		Help:      "Count of errors loading a source of the transaction policy lists.",
+	}, []string{
+		"list",
+		"source",
+	})
+
+	wsSessionAcquiresTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "ws_session_acquires_total",
+		Help:      "Count of WS sessions created, resumed, or presented but unknown or expired.",
+	}, []string{
+		"result",
+	})
+
+	wsSubscriptionsRestoredTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "ws_subscriptions_restored_total",
+		Help:      "Count of WS subscriptions restored on a resumed session.",
+	})
+
+	wsMuxUpstreamSubscriptionsGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: MetricsNamespace,
+		Name:      "ws_mux_upstream_subscriptions",
+		Help:      "Gauge of the multiplexed WS subscriptions to backends.",
+	}, []string{
+		"backend_name",
+	})
+
+	wsMuxClientSubscriptionsGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: MetricsNamespace,
+		Name:      "ws_mux_client_subscriptions",
+		Help:      "Gauge of the client subscriptions to multiplexed WS subscriptions.",
+	})
+
+	wsMuxDroppedNotificationsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "ws_mux_dropped_notifications_total",
+		Help:      "Count of multiplexed WS notifications dropped for slow clients.",
+	})
+
+	wsFailoversTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "ws_failovers_total",
+		Help:      "Count of WS connections and multiplexed subscriptions failed over to another backend.",
+	}, []string{
+		"from_backend",
+		"to_backend",
+	})
+
+	filtersInstalledTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "emulated_filters_installed_total",
+		Help:      "Count of filters installed by the filter emulation, by type.",
+	}, []string{
+		"type",
+	})
+
+	wsGapFillsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "ws_gap_fills_total",
+		Help:      "Count of gaps in WS subscriptions failed over, by subscription type and result.",
+	}, []string{
+		"type",
+		"result",
+	})
+
+	wsGapFilledNotificationsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "ws_gap_filled_notifications_total",
+		Help:      "Count of WS subscription notifications backfilled after failovers.",
+	}, []string{
+		"type",
+	})
+
+	wsConnLimitRejectionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "ws_conn_limit_rejections_total",
+		Help:      "Count of client WS connections rejected by the global or per IP connection limit.",
+	}, []string{
+		"limit",
+	})
+
+	wsMessagesRateLimitedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "ws_messages_rate_limited_total",
+		Help:      "Count of client WS messages over the connection or key message rate limit.",
+	}, []string{
+		"limit",
+	})
+
+	wsConnsClosedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "ws_conns_closed_total",
+		Help:      "Count of WS connections closed by proxyd for being idle, missing pongs, or consuming their messages too slowly.",
+	}, []string{
+		"source",
+		"reason",
+	})
+
+	wsSlowConsumerDroppedNotificationsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "ws_slow_consumer_dropped_notifications_total",
+		Help:      "Count of WS notifications dropped for clients whose send queue is full.",
+	})
+
+	wsDrainedConnsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "ws_drained_conns_total",
+		Help:      "Count of WS connections drained on shutdown, closed by their clients or forced after the drain timeout.",
+	}, []string{
+		"result",
+	})
+
+	wsCompressionRejectionsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "ws_compression_rejections_total",
+		Help:      "Count of client WS connections left uncompressed over the ws_compression.max_conns limit.",
+	})
+
+	wsPoolPendingGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: MetricsNamespace,
+		Name:      "ws_pool_pending_requests",
+		Help:      "Gauge of requests in flight on pooled WS backend connections.",
+	}, []string{
+		"backend_name",
+	})
+
+	activeSSEStreamsGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: MetricsNamespace,
+		Name:      "active_sse_streams",
+		Help:      "Gauge of active server-sent event subscription streams.",
+	}, []string{
+		"auth",
+	})
+
+	authKeyMethodDenialsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "auth_key_method_denials_total",
+		Help:      "Count of requests for methods the auth key may not call.",
+	}, []string{
+		"auth",
+		"method",
+		"source",
+	})
+
+	authKeyRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "auth_key_requests_total",
+		Help:      "Count of RPC calls accepted past the quotas, by auth key alias.",
+	}, []string{
+		"auth",
+	})
+
+	authKeyComputeUnitsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "auth_key_compute_units_total",
+		Help:      "Count of compute units of the RPC calls accepted past the quotas, by auth key alias.",
+	}, []string{
+		"auth",
+	})
+
+	authKeyRejectionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "auth_key_rejections_total",
+		Help:      "Count of requests rejected by rate limits and quotas, by auth key alias and reason: rate_limit, method_rate_limit or quota.",
+	}, []string{
+		"auth",
+		"reason",
+	})
+
+	jwtAuthFailuresTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "jwt_auth_failures_total",
+		Help:      "Count of requests rejected for an invalid JWT bearer token.",
+	}, []string{
+		"reason",
+	})
+
+	proxyProtocolErrorsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "proxy_protocol_errors_total",
+		Help:      "Count of connections of trusted load balancers closed for an invalid PROXY protocol header.",
+	})
+
+	abuseBansTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "abuse_bans_total",
+		Help:      "Count of clients penalized for abuse, by kind of client (ip or key).",
+	}, []string{
+		"kind",
+		"action",
+		"reason",
+	})
+
+	abuseActiveBans = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: MetricsNamespace,
+		Name:      "abuse_active_bans",
+		Help:      "Number of clients currently penalized for abuse.",
+	})
+
+	abuseRejectionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "abuse_rejections_total",
+		Help:      "Count of requests of penalized clients rejected.",
+	}, []string{
+		"action",
+	})
+
+	geoIPDecisionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "geoip_decisions_total",
+		Help:      "Count of requests matching a GeoIP rule, by decision and client country.",
+	}, []string{
+		"decision",
+		"country",
+		"auth",
+	})
+
+	secretRefreshesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "secret_refreshes_total",
+		Help:      "Count of background refreshes of secrets, by scheme and result.",
+	}, []string{
+		"scheme",
+		"result",
+	})
+
+	auditEventsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "audit_events_total",
+		Help:      "Count of audit events recorded, by event and whether they were queued or dropped.",
+	}, []string{
+		"event",
+		"result",
+	})
+
+	auditDeliveryErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "audit_delivery_errors_total",
+		Help:      "Count of audit events or batches which couldn't be written, by sink.",
+	}, []string{
+		"sink",
+	})
+
+	backendMethodLatencySeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: MetricsNamespace,
+		Name:      "backend_method_latency_seconds",
+		Help:      "Histogram of backend response times by backend and method, of batches labeled <batch>.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{
+		"backend_name",
+		"method_name",
+	})
+
+	backendMethodErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "backend_method_errors_total",
+		Help:      "Count of failed backend requests and RPC errors answered by backends, by backend, method and error class.",
+	}, []string{
+		"backend_name",
+		"method_name",
+		"error_class",
+	})
+
+	accessLogSinkLinesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "access_log_sink_lines_total",
+		Help:      "Count of access log lines exported, by sink and result: written, dropped while the buffer was full, or failed.",
+	}, []string{
+		"sink",
+		"result",
+	})
+
+	accessLogSinkBufferedLines = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: MetricsNamespace,
+		Name:      "access_log_sink_buffered_lines",
+		Help:      "Number of access log lines waiting to be exported, by sink.",
+	}, []string{
+		"sink",
+	})
+
+	priorityWaitSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: MetricsNamespace,
+		Name:      "priority_wait_seconds",
+		Help:      "Histogram of the time requests waited for a backend request slot, by priority class.",
+		Buckets:   []float64{0, .005, .01, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{
+		"class",
+	})
+
+	priorityQueuedRequests = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: MetricsNamespace,
+		Name:      "priority_queued_requests",
+		Help:      "Gauge of the requests waiting for a backend request slot, by priority class.",
+	}, []string{
+		"class",
+	})
+
+	admissionQueueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: MetricsNamespace,
+		Name:      "admission_queue_depth",
+		Help:      "Gauge of the requests waiting for one of the max_concurrent_rpcs slots.",
+	})
+
+	loadShedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "load_shed_total",
+		Help:      "Count of requests rejected by the admission queue, because it was full or their deadline would pass.",
+	}, []string{
+		"reason",
+	})
+
+	txNonceRejectionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "tx_nonce_rejections_total",
+		Help:      "Count of raw transactions rejected for their nonce, by reason.",
+	}, []string{
+		"reason",
+	})
+
+	conditionalTxsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "conditional_txs_total",
+		Help:      "Count of eth_sendRawTransactionConditional requests, by outcome.",
+	}, []string{
+		"outcome",
+	})
+
+	userOperationRejectionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "user_operation_rejections_total",
+		Help:      "Count of invalid bundler requests rejected before forwarding, by method.",
+	}, []string{
+		"method",
+	})
+
+	paramValidationRejectionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "param_validation_rejections_total",
+		Help:      "Count of requests rejected for malformed params, by method.",
+	}, []string{
+		"method",
+	})
+
+	getLogsLimitRejectionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "get_logs_limit_rejections_total",
+		Help:      "Count of eth_getLogs requests rejected for exceeding a limit, by limit.",
+	}, []string{
+		"limit",
+	})
+
+	getLogsSplitsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "get_logs_splits_total",
+		Help:      "Count of eth_getLogs requests split into sub-range requests.",
+	})
+
+	getLogsSubRangesTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "get_logs_sub_ranges_total",
+		Help:      "Count of sub-range requests of split eth_getLogs requests.",
+	})
+
+	privateTxsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "private_txs_total",
+		Help:      "Count of transactions sent to the private relay, by outcome.",
+	}, []string{
+		"outcome",
+	})
+
+	lvcResponsesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "lvc_responses_total",
+		Help:      "Count of requests answerable from the last-value caches, by method and whether they were served or stale.",
+	}, []string{
+		"method",
+		"outcome",
+	})
+
+	duplicateRawTxsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "duplicate_raw_txs_total",
+		Help:      "Count of eth_sendRawTransaction re-submissions answered without forwarding them.",
+	})
+
+	finalityTagRewritesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "finality_tag_rewrites_total",
+		Help:      "Count of safe and finalized block tags rewritten to block numbers.",
+	}, []string{
+		"tag",
+	})
+
+	backendHealthScore = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: MetricsNamespace,
+		Name:      "backend_health_score",
+		Help:      "Health score of the backend, from 0 to 1, combining its latency, error rate and block lag.",
+	}, []string{
+		"backend_name",
+	})
+
+	backendResponseSizes = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: MetricsNamespace,
+		Name:      "backend_response_sizes",
+		Help:      "Histogram of backend response sizes, by method.",
+		Buckets:   PayloadSizeBuckets,
+	}, []string{
+		"backend_name",
+		"method",
+	})
+
+	cacheWarmupsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "cache_warmups_total",
+		Help:      "Count of cache warm-ups on startup, by result.",
+	}, []string{
+		"result",
+	})
+
+	cacheWarmupRequestsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "cache_warmup_requests_total",
+		Help:      "Count of requests sent to warm the cache on startup.",
+	})
+
+	etagResponsesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "etag_responses_total",
+		Help:      "Count of cached responses served with an ETag, by whether the client already had them.",
+	}, []string{
+		"result",
+	})
+
+	keepaliveResponsesTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "keepalive_responses_total",
+		Help:      "Count of slow responses preceded by keepalives.",
+	})
+
+	responseTransformsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "response_transforms_total",
+		Help:      "Count of responses whose result was transformed.",
+	}, []string{
+		"method",
+	})
+
+	scriptDecisionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "script_decisions_total",
+		Help:      "Count of the decisions of the request script.",
+	}, []string{
+		"decision",
+	})
+
+	responseProjectionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "response_projections_total",
+		Help:      "Count of responses whose result was projected for the tier of the client.",
+	}, []string{
+		"method",
+	})
+
+	etagSavedBytesTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "etag_saved_bytes_total",
+		Help:      "Count of response bytes not sent to clients presenting a matching ETag.",
+	})
+
+	quotaExceededTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "quota_exceeded_total",
+		Help:      "Count of requests rejected for exceeding the quota of their auth key.",
+	}, []string{
+		"auth",
+		"period",
+	})
+
+	authOriginViolationsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "auth_origin_violations_total",
+		Help:      "Count of requests blocked for using an auth key from a disallowed origin or IP.",
+	}, []string{
+		"auth",
+		"reason",
+	})
+
+	memcachedErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "memcached_errors_total",
+		Help:      "Count of total memcached errors.",
+	}, []string{
+		"source",
+	})
+
 	tooManyRequestErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
 		Namespace: MetricsNamespace,
 		Name:      "too_many_request_errors_total",
@@ -240,6 +900,14 @@ var (
 		Help:      "Count of errors taking frontend rate limits",
 	})
 
+	rateLimitDryRunRejectionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "rate_limit_dry_run_rejections_total",
+		Help:      "Count of requests which dry run rate limits would have rejected.",
+	}, []string{
+		"limit",
+	})
+
 	consensusLatestBlock = promauto.NewGaugeVec(prometheus.GaugeOpts{
 		Namespace: MetricsNamespace,
 		Name:      "group_consensus_latest_block",
@@ -264,6 +932,14 @@ var (
 		"backend_group_name",
 	})
 
+	cacheAutoConfirmations = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: MetricsNamespace,
+		Name:      "cache_auto_confirmations",
+		Help:      "Effective number of confirmations required to cache responses, derived from the consensus of a backend group.",
+	}, []string{
+		"backend_group_name",
+	})
+
 	consensusHAError = promauto.NewCounterVec(prometheus.CounterOpts{
 		Namespace: MetricsNamespace,
 		Name:      "group_consensus_ha_error",
@@ -416,6 +1092,34 @@ func RecordRedisError(source string) {
 	redisErrorsTotal.WithLabelValues(source).Inc()
 }
 
+func RecordRedisUp(up bool) {
+	if up {
+		redisUp.Set(1)
+	} else {
+		redisUp.Set(0)
+	}
+}
+
+func RecordRedisBreakerTrip() {
+	redisBreakerTripsTotal.Inc()
+}
+
+func RecordRateLimitDryRunRejection(limit string) {
+	rateLimitDryRunRejectionsTotal.WithLabelValues(limit).Inc()
+}
+
+func RecordQuotaExceeded(auth string, period string) {
+	quotaExceededTotal.WithLabelValues(auth, period).Inc()
+}
+
+func RecordAuthOriginViolation(auth string, reason string) {
+	authOriginViolationsTotal.WithLabelValues(auth, reason).Inc()
+}
+
+func RecordMemcachedError(source string) {
+	memcachedErrorsTotal.WithLabelValues(source).Inc()
+}
+
 func RecordRPCError(ctx context.Context, backendName, method string, err error) {
 	rpcErr, ok := err.(*RPCErr)
 	var code int
@@ -471,6 +1175,272 @@ func RecordCacheError(method string) {
 	cacheErrorsTotal.WithLabelValues(method).Inc()
 }
 
+func RecordCacheStale(method string) {
+	cacheStaleTotal.WithLabelValues(method).Inc()
+}
+
+func RecordCacheSavedBytes(method string, bytes int) {
+	cacheSavedBytesTotal.WithLabelValues(method).Add(float64(bytes))
+}
+
+func RecordMemoryCacheEviction(reason string) {
+	memoryCacheEvictionsTotal.WithLabelValues(reason).Inc()
+}
+
+func RecordUpgradeHint(ctx context.Context, method string, action string) {
+	upgradeHintsTotal.WithLabelValues(GetAuthCtx(ctx), method, action).Inc()
+}
+
+func RecordCoalescedRequest(ctx context.Context, method string) {
+	coalescedRequestsTotal.WithLabelValues(GetAuthCtx(ctx), method).Inc()
+}
+
+func RecordPeeringRejection(reason string) {
+	peeringRejectionsTotal.WithLabelValues(reason).Inc()
+}
+
+func RecordPeeringDeduplicatedRequest(method string) {
+	peeringDeduplicatedRequestsTotal.WithLabelValues(method).Inc()
+}
+
+func RecordBlobTxRejection(reason string) {
+	blobTxRejectionsTotal.WithLabelValues(reason).Inc()
+}
+
+func RecordTxValidationRejection(reason string) {
+	txValidationRejectionsTotal.WithLabelValues(reason).Inc()
+}
+
+func RecordTxPolicyRejection(list string) {
+	txPolicyRejectionsTotal.WithLabelValues(list).Inc()
+}
+
+func RecordTxPolicyListSize(list string, size int) {
+	txPolicyListSize.WithLabelValues(list).Set(float64(size))
+}
+
+func RecordTxPolicyRefreshError(list string, source string) {
+	txPolicyRefreshErrorsTotal.WithLabelValues(list, source).Inc()
+}
+
+func RecordWSSessionAcquire(result string) {
+	wsSessionAcquiresTotal.WithLabelValues(result).Inc()
+}
+
+func RecordWSSubscriptionRestored() {
+	wsSubscriptionsRestoredTotal.Inc()
+}
+
+func RecordWSMuxUpstream(backendName string, delta float64) {
+	wsMuxUpstreamSubscriptionsGauge.WithLabelValues(backendName).Add(delta)
+}
+
+func RecordWSMuxSubscriber(delta float64) {
+	wsMuxClientSubscriptionsGauge.Add(delta)
+}
+
+func RecordWSMuxDroppedNotification() {
+	wsMuxDroppedNotificationsTotal.Inc()
+}
+
+func RecordWSFailover(from, to string) {
+	wsFailoversTotal.WithLabelValues(from, to).Inc()
+}
+
+func RecordFilterInstalled(typ string) {
+	filtersInstalledTotal.WithLabelValues(typ).Inc()
+}
+
+func RecordWSGapFill(typ, result string) {
+	wsGapFillsTotal.WithLabelValues(typ, result).Inc()
+}
+
+func RecordWSGapFilledNotifications(typ string, n int) {
+	wsGapFilledNotificationsTotal.WithLabelValues(typ).Add(float64(n))
+}
+
+func RecordWSConnLimitRejection(limit string) {
+	wsConnLimitRejectionsTotal.WithLabelValues(limit).Inc()
+}
+
+func RecordWSMessageRateLimited(limit string) {
+	wsMessagesRateLimitedTotal.WithLabelValues(limit).Inc()
+}
+
+func RecordWSConnClosed(source, reason string) {
+	wsConnsClosedTotal.WithLabelValues(source, reason).Inc()
+}
+
+func RecordWSSlowConsumerDrop() {
+	wsSlowConsumerDroppedNotificationsTotal.Inc()
+}
+
+func RecordWSDrainedConns(result string, n int) {
+	wsDrainedConnsTotal.WithLabelValues(result).Add(float64(n))
+}
+
+func RecordWSCompressionRejection() {
+	wsCompressionRejectionsTotal.Inc()
+}
+
+func RecordAuthKeyMethodDenial(auth string, method string, source string) {
+	authKeyMethodDenialsTotal.WithLabelValues(auth, method, source).Inc()
+}
+
+func RecordAuthUsage(auth string, calls int, units int) {
+	authKeyRequestsTotal.WithLabelValues(auth).Add(float64(calls))
+	authKeyComputeUnitsTotal.WithLabelValues(auth).Add(float64(units))
+}
+
+func RecordAuthRejection(auth string, reason string) {
+	authKeyRejectionsTotal.WithLabelValues(auth, reason).Inc()
+}
+
+func RecordJWTAuthFailure(reason string) {
+	jwtAuthFailuresTotal.WithLabelValues(reason).Inc()
+}
+
+func RecordProxyProtocolError() {
+	proxyProtocolErrorsTotal.Inc()
+}
+
+func RecordAbuseBan(kind string, action string, reason string) {
+	abuseBansTotal.WithLabelValues(kind, action, reason).Inc()
+}
+
+func RecordAbuseActiveBans(n int) {
+	abuseActiveBans.Set(float64(n))
+}
+
+func RecordAbuseRejection(action string) {
+	abuseRejectionsTotal.WithLabelValues(action).Inc()
+}
+
+func RecordGeoIPDecision(decision string, country string, auth string) {
+	geoIPDecisionsTotal.WithLabelValues(decision, country, auth).Inc()
+}
+
+func RecordSecretRefresh(scheme string, result string) {
+	secretRefreshesTotal.WithLabelValues(scheme, result).Inc()
+}
+
+func RecordAuditEventRecorded(event string, result string) {
+	auditEventsTotal.WithLabelValues(event, result).Inc()
+}
+
+func RecordAuditDeliveryError(sink string) {
+	auditDeliveryErrorsTotal.WithLabelValues(sink).Inc()
+}
+
+func RecordBackendMethodLatency(backendName, method string, latency time.Duration) {
+	backendMethodLatencySeconds.WithLabelValues(backendName, method).Observe(latency.Seconds())
+}
+
+func RecordBackendMethodError(backendName, method, class string) {
+	backendMethodErrorsTotal.WithLabelValues(backendName, method, class).Inc()
+}
+
+func RecordAccessLogSinkLines(sink, result string, n int) {
+	accessLogSinkLinesTotal.WithLabelValues(sink, result).Add(float64(n))
+}
+
+func RecordAccessLogSinkBuffered(sink string, n int) {
+	accessLogSinkBufferedLines.WithLabelValues(sink).Set(float64(n))
+}
+
+func RecordPriorityWait(class string, wait time.Duration) {
+	priorityWaitSeconds.WithLabelValues(class).Observe(wait.Seconds())
+}
+
+func RecordPriorityQueued(class string, delta float64) {
+	priorityQueuedRequests.WithLabelValues(class).Add(delta)
+}
+
+func RecordAdmissionQueueDepth(depth int64) {
+	admissionQueueDepth.Set(float64(depth))
+}
+
+func RecordLoadShed(reason string) {
+	loadShedTotal.WithLabelValues(reason).Inc()
+}
+
+func RecordTxNonceRejection(reason string) {
+	txNonceRejectionsTotal.WithLabelValues(reason).Inc()
+}
+
+func RecordConditionalTx(outcome string) {
+	conditionalTxsTotal.WithLabelValues(outcome).Inc()
+}
+
+func RecordUserOperationRejection(method string) {
+	userOperationRejectionsTotal.WithLabelValues(method).Inc()
+}
+
+func RecordParamValidationRejection(method string) {
+	paramValidationRejectionsTotal.WithLabelValues(method).Inc()
+}
+
+func RecordGetLogsLimitRejection(limit string) {
+	getLogsLimitRejectionsTotal.WithLabelValues(limit).Inc()
+}
+
+func RecordGetLogsSplit(subRanges int) {
+	getLogsSplitsTotal.Inc()
+	getLogsSubRangesTotal.Add(float64(subRanges))
+}
+
+func RecordPrivateTx(outcome string) {
+	privateTxsTotal.WithLabelValues(outcome).Inc()
+}
+
+func RecordLVCResponse(method string, outcome string) {
+	lvcResponsesTotal.WithLabelValues(method, outcome).Inc()
+}
+
+func RecordDuplicateRawTx() {
+	duplicateRawTxsTotal.Inc()
+}
+
+func RecordFinalityTagRewrite(tag string) {
+	finalityTagRewritesTotal.WithLabelValues(tag).Inc()
+}
+
+func RecordBackendResponseSize(backendName string, method string, size int) {
+	backendResponseSizes.WithLabelValues(backendName, method).Observe(float64(size))
+}
+
+func RecordCacheWarmup(result string, requests int) {
+	cacheWarmupsTotal.WithLabelValues(result).Inc()
+	cacheWarmupRequestsTotal.Add(float64(requests))
+}
+
+func RecordETagResponse(result string, size int) {
+	etagResponsesTotal.WithLabelValues(result).Inc()
+	if result == "not_modified" {
+		etagSavedBytesTotal.Add(float64(size))
+	}
+}
+
+func RecordKeepaliveResponse() {
+	keepaliveResponsesTotal.Inc()
+}
+
+func RecordResponseTransform(method string) {
+	responseTransformsTotal.WithLabelValues(method).Inc()
+}
+
+func RecordScriptDecision(decision string) {
+	scriptDecisionsTotal.WithLabelValues(decision).Inc()
+}
+
+func RecordResponseProjection(method string) {
+	responseProjectionsTotal.WithLabelValues(method).Inc()
+}
+
+func RecordConfigReload(result string) {
+	configReloadsTotal.WithLabelValues(result).Inc()
+}
+
 func RecordBatchSize(size int) {
 	batchSizeHistogram.Observe(float64(size))
 }
@@ -509,6 +1479,10 @@ func RecordGroupConsensusFinalizedBlock(group *BackendGroup, blockNumber hexutil
 	consensusFinalizedBlock.WithLabelValues(group.Name).Set(float64(blockNumber))
 }
 
+func RecordAutoConfirmations(groupName string, confirmations uint64) {
+	cacheAutoConfirmations.WithLabelValues(groupName).Set(float64(confirmations))
+}
+
 func RecordGroupConsensusCount(group *BackendGroup, count int) {
 	consensusGroupCount.WithLabelValues(group.Name).Set(float64(count))
 }
@@ -565,6 +1539,7 @@ func RecordBackendNetworkLatencyAverageSlidingWindow(b *Backend, avgLatency time
 
 func RecordBackendNetworkErrorRateSlidingWindow(b *Backend, rate float64) {
 	networkErrorRateBackend.WithLabelValues(b.Name).Set(rate)
+	backendHealthScore.WithLabelValues(b.Name).Set(b.HealthScore().Score)
 }
 
 func boolToFloat64(b bool) float64 {
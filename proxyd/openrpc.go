@@ -0,0 +1,105 @@
+package proxyd
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	RPCDiscoverMethod = "rpc_discover"
+
+	openRPCVersion = "1.2.6"
+)
+
+// OpenRPCDocument describes the methods served by proxyd, in the OpenRPC
+// format. Methods carry x-proxyd extensions telling how they are served.
+type OpenRPCDocument struct {
+	OpenRPC string          `json:"openrpc"`
+	Info    OpenRPCInfo     `json:"info"`
+	Methods []OpenRPCMethod `json:"methods"`
+}
+
+type OpenRPCInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type OpenRPCMethod struct {
+	Name        string                `json:"name"`
+	Description string                `json:"description,omitempty"`
+	Params      []interface{}         `json:"params"`
+	Result      OpenRPCContent        `json:"result"`
+	Group       string                `json:"x-proxyd-backend-group,omitempty"`
+	Cached      bool                  `json:"x-proxyd-cached"`
+	RateLimit   *OpenRPCRateLimitInfo `json:"x-proxyd-rate-limit,omitempty"`
+}
+
+// OpenRPCContent describes a param or result. Since proxyd doesn't know the
+// schemas of the methods it forwards, it accepts any value.
+type OpenRPCContent struct {
+	Name   string                 `json:"name"`
+	Schema map[string]interface{} `json:"schema"`
+}
+
+// OpenRPCRateLimitInfo is the rate limit of a method overriding the base rate
+// limit.
+type OpenRPCRateLimitInfo struct {
+	Limit    int    `json:"limit"`
+	Interval string `json:"interval"`
+	Global   bool   `json:"global"`
+}
+
+// proxydMethods are the methods served by proxyd itself.
+var proxydMethods = map[string]string{
+	"eth_accounts":      "Always returns an empty list.",
+	proxydHealthzMethod: "Returns OK if proxyd is up. Can't be batched.",
+	RPCDiscoverMethod:   "Returns this document.",
+}
+
+// openRPCDocument generates the OpenRPC document of the methods mapped by
+// routing, and of the methods served by proxyd.
+func (s *Server) openRPCDocument(routing *routingConfig) *OpenRPCDocument {
+	doc := &OpenRPCDocument{
+		OpenRPC: openRPCVersion,
+		Info:    OpenRPCInfo{Title: "proxyd", Version: "1.0.0"},
+		Methods: make([]OpenRPCMethod, 0, len(routing.rpcMethodMappings)+len(proxydMethods)),
+	}
+
+	rc, _ := s.cache.(*rpcCache)
+	for method, group := range routing.rpcMethodMappings {
+		if _, ok := proxydMethods[method]; ok {
+			continue
+		}
+		m := newOpenRPCMethod(method)
+		m.Group = group
+		if rc != nil {
+			_, m.Cached = rc.handlers[method]
+		}
+		if override := routing.rateLimitConfig.MethodOverrides[method]; override != nil {
+			m.RateLimit = &OpenRPCRateLimitInfo{
+				Limit:    override.Limit,
+				Interval: time.Duration(override.Interval).String(),
+				Global:   override.Global,
+			}
+		}
+		doc.Methods = append(doc.Methods, m)
+	}
+	for method, description := range proxydMethods {
+		m := newOpenRPCMethod(method)
+		m.Description = description
+		doc.Methods = append(doc.Methods, m)
+	}
+
+	sort.Slice(doc.Methods, func(i, j int) bool {
+		return doc.Methods[i].Name < doc.Methods[j].Name
+	})
+	return doc
+}
+
+func newOpenRPCMethod(name string) OpenRPCMethod {
+	return OpenRPCMethod{
+		Name:   name,
+		Params: []interface{}{},
+		Result: OpenRPCContent{Name: "result", Schema: map[string]interface{}{}},
+	}
+}
@@ -0,0 +1,330 @@
+package proxyd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// paramCheck checks the format of a single param.
+type paramCheck func(json.RawMessage) error
+
+type paramSpec struct {
+	validate paramCheck
+	optional bool
+}
+
+func requiredParam(validate paramCheck) paramSpec {
+	return paramSpec{validate: validate}
+}
+
+func optionalParam(validate paramCheck) paramSpec {
+	return paramSpec{validate: validate, optional: true}
+}
+
+// paramSchemas are the params of the methods whose requests are validated.
+var paramSchemas = map[string][]paramSpec{
+	"eth_chainId":              {},
+	"eth_blockNumber":          {},
+	"eth_gasPrice":             {},
+	"eth_maxPriorityFeePerGas": {},
+	"eth_syncing":              {},
+	"net_version":              {},
+	"web3_clientVersion":       {},
+
+	"eth_getBalance":          {requiredParam(validateAddress), optionalParam(validateBlockNumberOrHash)},
+	"eth_getCode":             {requiredParam(validateAddress), optionalParam(validateBlockNumberOrHash)},
+	"eth_getTransactionCount": {requiredParam(validateAddress), optionalParam(validateBlockNumberOrHash)},
+	"eth_getStorageAt":        {requiredParam(validateAddress), requiredParam(validateStorageKey), optionalParam(validateBlockNumberOrHash)},
+	"eth_getProof":            {requiredParam(validateAddress), requiredParam(listOf(validateStorageKey)), requiredParam(validateBlockNumberOrHash)},
+	"eth_call":                {requiredParam(validateCallObject), optionalParam(validateBlockNumberOrHash), optionalParam(validateObject), optionalParam(validateObject)},
+	"eth_estimateGas":         {requiredParam(validateCallObject), optionalParam(validateBlockNumberOrHash), optionalParam(validateObject)},
+	"eth_createAccessList":    {requiredParam(validateCallObject), optionalParam(validateBlockNumberOrHash)},
+
+	"eth_getBlockByNumber":                    {requiredParam(validateBlockTag), requiredParam(validateBool)},
+	"eth_getBlockByHash":                      {requiredParam(validateHash), requiredParam(validateBool)},
+	"eth_getBlockReceipts":                    {requiredParam(validateBlockNumberOrHash)},
+	"eth_getBlockTransactionCountByNumber":    {requiredParam(validateBlockTag)},
+	"eth_getBlockTransactionCountByHash":      {requiredParam(validateHash)},
+	"eth_getTransactionByHash":                {requiredParam(validateHash)},
+	"eth_getTransactionReceipt":               {requiredParam(validateHash)},
+	"eth_getTransactionByBlockNumberAndIndex": {requiredParam(validateBlockTag), requiredParam(validateQuantity)},
+	"eth_getTransactionByBlockHashAndIndex":   {requiredParam(validateHash), requiredParam(validateQuantity)},
+
+	"eth_getLogs":            {requiredParam(validateFilter)},
+	"eth_feeHistory":         {requiredParam(validateCount), requiredParam(validateBlockTag), optionalParam(listOf(validateNumber))},
+	"eth_sendRawTransaction": {requiredParam(validateData)},
+}
+
+// ParamValidator validates the params of requests against the schemas of their
+// methods, so that malformed requests are rejected consistently rather than
+// with the errors of whichever backend serves them. Methods without a schema
+// aren't validated.
+type ParamValidator struct {
+	schemas map[string][]paramSpec
+}
+
+func NewParamValidator(config ParamValidationConfig) *ParamValidator {
+	schemas := make(map[string][]paramSpec, len(paramSchemas))
+	for method, schema := range paramSchemas {
+		schemas[method] = schema
+	}
+	for _, method := range config.DisabledMethods {
+		delete(schemas, method)
+	}
+	return &ParamValidator{schemas: schemas}
+}
+
+// Validate returns an error describing the first invalid param of req, in the
+// format of geth.
+func (v *ParamValidator) Validate(req *RPCReq) *RPCErr {
+	schema, ok := v.schemas[req.Method]
+	if !ok {
+		return nil
+	}
+	var params []json.RawMessage
+	if len(req.Params) > 0 && !isNull(req.Params) {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return ErrInvalidParams("non-array args")
+		}
+	}
+	if len(params) > len(schema) {
+		return ErrInvalidParams(fmt.Sprintf("too many arguments, want at most %d", len(schema)))
+	}
+	for i, spec := range schema {
+		if i >= len(params) || isNull(params[i]) {
+			if !spec.optional {
+				return ErrInvalidParams(fmt.Sprintf("missing value for required argument %d", i))
+			}
+			continue
+		}
+		if err := spec.validate(params[i]); err != nil {
+			return ErrInvalidParams(fmt.Sprintf("invalid argument %d: %s", i, err))
+		}
+	}
+	return nil
+}
+
+func isNull(raw json.RawMessage) bool {
+	return string(bytes.TrimSpace(raw)) == "null"
+}
+
+func unmarshalString(raw json.RawMessage) (string, error) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return "", errors.New("expected a hex string")
+	}
+	return s, nil
+}
+
+func validateQuantity(raw json.RawMessage) error {
+	s, err := unmarshalString(raw)
+	if err != nil {
+		return err
+	}
+	_, err = hexutil.DecodeBig(s)
+	return err
+}
+
+// validateCount accepts hex quantities and decimal numbers, as block counts.
+func validateCount(raw json.RawMessage) error {
+	var count math.HexOrDecimal64
+	return json.Unmarshal(raw, &count)
+}
+
+func validateNumber(raw json.RawMessage) error {
+	var n float64
+	if err := json.Unmarshal(raw, &n); err != nil {
+		return errors.New("expected a number")
+	}
+	return nil
+}
+
+func validateBool(raw json.RawMessage) error {
+	var b bool
+	if err := json.Unmarshal(raw, &b); err != nil {
+		return errors.New("expected a boolean")
+	}
+	return nil
+}
+
+func validateObject(raw json.RawMessage) error {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return errors.New("expected an object")
+	}
+	return nil
+}
+
+func validateData(raw json.RawMessage) error {
+	s, err := unmarshalString(raw)
+	if err != nil {
+		return err
+	}
+	_, err = hexutil.Decode(s)
+	return err
+}
+
+func validateFixedData(size int, name string) paramCheck {
+	return func(raw json.RawMessage) error {
+		s, err := unmarshalString(raw)
+		if err != nil {
+			return err
+		}
+		b, err := hexutil.Decode(s)
+		if err != nil {
+			return err
+		}
+		if len(b) != size {
+			return fmt.Errorf("%s must be %d bytes, have %d", name, size, len(b))
+		}
+		return nil
+	}
+}
+
+var (
+	validateAddress = validateFixedData(20, "address")
+	validateHash    = validateFixedData(32, "hash")
+)
+
+// validateStorageKey accepts hex strings of up to 32 bytes, of any length, as
+// geth does.
+func validateStorageKey(raw json.RawMessage) error {
+	s, err := unmarshalString(raw)
+	if err != nil {
+		return err
+	}
+	if !has0xPrefix(s) {
+		return errors.New("hex string without 0x prefix")
+	}
+	digits := s[2:]
+	if len(digits) > 64 {
+		return errors.New("storage key longer than 32 bytes")
+	}
+	for _, c := range digits {
+		if !isHexDigit(c) {
+			return errors.New("invalid hex string")
+		}
+	}
+	return nil
+}
+
+func has0xPrefix(s string) bool {
+	return len(s) >= 2 && s[0] == '0' && (s[1] == 'x' || s[1] == 'X')
+}
+
+func isHexDigit(c rune) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
+
+func validateBlockTag(raw json.RawMessage) error {
+	var bn rpc.BlockNumber
+	return json.Unmarshal(raw, &bn)
+}
+
+func validateBlockNumberOrHash(raw json.RawMessage) error {
+	var bnh rpc.BlockNumberOrHash
+	return json.Unmarshal(raw, &bnh)
+}
+
+func listOf(validate paramCheck) paramCheck {
+	return func(raw json.RawMessage) error {
+		var list []json.RawMessage
+		if err := json.Unmarshal(raw, &list); err != nil {
+			return errors.New("expected an array")
+		}
+		for i, elem := range list {
+			if err := validate(elem); err != nil {
+				return fmt.Errorf("element %d: %w", i, err)
+			}
+		}
+		return nil
+	}
+}
+
+// oneOrListOf accepts a single value, or an array of values.
+func oneOrListOf(validate paramCheck) paramCheck {
+	return func(raw json.RawMessage) error {
+		if len(bytes.TrimSpace(raw)) > 0 && bytes.TrimSpace(raw)[0] == '[' {
+			return listOf(validate)(raw)
+		}
+		return validate(raw)
+	}
+}
+
+func nullOr(validate paramCheck) paramCheck {
+	return func(raw json.RawMessage) error {
+		if isNull(raw) {
+			return nil
+		}
+		return validate(raw)
+	}
+}
+
+// validateFields checks the fields of an object with the validators of fields.
+// Other fields are left to the backends.
+func validateFields(raw json.RawMessage, fields map[string]paramCheck) (map[string]json.RawMessage, error) {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return nil, errors.New("expected an object")
+	}
+	for name, validate := range fields {
+		value, ok := obj[name]
+		if !ok || isNull(value) {
+			continue
+		}
+		if err := validate(value); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", name, err)
+		}
+	}
+	return obj, nil
+}
+
+var callObjectFields = map[string]paramCheck{
+	"from":                 validateAddress,
+	"to":                   validateAddress,
+	"gas":                  validateQuantity,
+	"gasPrice":             validateQuantity,
+	"maxFeePerGas":         validateQuantity,
+	"maxPriorityFeePerGas": validateQuantity,
+	"maxFeePerBlobGas":     validateQuantity,
+	"value":                validateQuantity,
+	"nonce":                validateQuantity,
+	"chainId":              validateQuantity,
+	"data":                 validateData,
+	"input":                validateData,
+	"blobVersionedHashes":  listOf(validateHash),
+}
+
+func validateCallObject(raw json.RawMessage) error {
+	_, err := validateFields(raw, callObjectFields)
+	return err
+}
+
+var filterFields = map[string]paramCheck{
+	"fromBlock": validateBlockTag,
+	"toBlock":   validateBlockTag,
+	"blockHash": validateHash,
+	"address":   oneOrListOf(validateAddress),
+	"topics":    listOf(nullOr(oneOrListOf(nullOr(validateHash)))),
+}
+
+func validateFilter(raw json.RawMessage) error {
+	obj, err := validateFields(raw, filterFields)
+	if err != nil {
+		return err
+	}
+	has := func(name string) bool {
+		value, ok := obj[name]
+		return ok && !isNull(value)
+	}
+	if has("blockHash") && (has("fromBlock") || has("toBlock")) {
+		return errors.New("cannot specify both blockHash and fromBlock/toBlock")
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package proxyd
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// PeeringHopsHeader is the number of proxyd instances a request went through.
+	PeeringHopsHeader = "X-Proxyd-Hops"
+	// PeeringOriginHeader is the instance ID of the proxyd that first received a
+	// request.
+	PeeringOriginHeader = "X-Proxyd-Origin"
+	// PeeringRequestIDHeader identifies a request across proxyd instances.
+	PeeringRequestIDHeader = "X-Proxyd-Request-Id"
+	// PeeringSecretHeader carries the shared secret authenticating peers.
+	PeeringSecretHeader = "X-Proxyd-Peer-Secret"
+
+	ContextKeyPeering      = "peering"
+	defaultPeeringMaxHops  = 3
+	maxPeeringRequestIDLen = 64
+)
+
+var (
+	ErrPeeringLoop           = errors.New("request looped back to its origin")
+	ErrPeeringMaxHopsReached = errors.New("request reached the maximum number of hops")
+)
+
+// PeeringInfo describes the path of a request through chained proxyd
+// instances.
+type PeeringInfo struct {
+	Hops      int
+	Origin    string
+	RequestID string
+	secret    string
+}
+
+// Peering implements the header protocol of proxyd instances forwarding
+// requests to each other. It rejects requests that loop or go through too
+// many instances, and deduplicates the requests received from peers that
+// carry the same request ID. The peering headers are only honored on requests
+// from peers, which are identified by their address or by a shared secret.
+type Peering struct {
+	instanceID string
+	maxHops    int
+	timeout    time.Duration
+	peerNets   []*net.IPNet
+	secret     string
+	group      singleflight.Group
+}
+
+func NewPeering(cfg PeeringConfig, timeout time.Duration) (*Peering, error) {
+	instanceID := cfg.InstanceID
+	if instanceID == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, wrapErr(err, "error reading hostname for the peering instance ID")
+		}
+		instanceID = hostname
+	}
+	maxHops := cfg.MaxHops
+	if maxHops == 0 {
+		maxHops = defaultPeeringMaxHops
+	}
+	peerNets, err := parseCIDRs(cfg.PeerCIDRs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid peer CIDRs: %w", err)
+	}
+	secret, err := ReadFromEnvOrConfig(cfg.SharedSecret)
+	if err != nil {
+		return nil, err
+	}
+	if len(peerNets) == 0 && secret == "" {
+		return nil, errors.New("peering requires peer_cidrs or a shared_secret")
+	}
+	return &Peering{
+		instanceID: instanceID,
+		maxHops:    maxHops,
+		timeout:    timeout,
+		peerNets:   peerNets,
+		secret:     secret,
+	}, nil
+}
+
+// isPeer returns whether r, whose client is clientIP, was sent by a peer.
+func (p *Peering) isPeer(r *http.Request, clientIP net.IP) bool {
+	if p.secret != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get(PeeringSecretHeader)), []byte(p.secret)) == 1 {
+		return true
+	}
+	return clientIP != nil && containsIP(p.peerNets, clientIP)
+}
+
+// Receive returns the peering info of r, whose client is clientIP. Requests
+// not received from a peer originate from this instance, under reqID, and
+// their peering headers are ignored.
+func (p *Peering) Receive(r *http.Request, clientIP net.IP, reqID string) (*PeeringInfo, error) {
+	hops, err := strconv.Atoi(r.Header.Get(PeeringHopsHeader))
+	if err != nil || hops <= 0 || !p.isPeer(r, clientIP) {
+		return &PeeringInfo{
+			Origin:    p.instanceID,
+			RequestID: reqID,
+			secret:    p.secret,
+		}, nil
+	}
+
+	info := &PeeringInfo{
+		Hops:      hops,
+		Origin:    r.Header.Get(PeeringOriginHeader),
+		RequestID: r.Header.Get(PeeringRequestIDHeader),
+		secret:    p.secret,
+	}
+	if info.Origin == p.instanceID {
+		return nil, ErrPeeringLoop
+	}
+	if hops >= p.maxHops {
+		return nil, ErrPeeringMaxHopsReached
+	}
+	if info.RequestID == "" || len(info.RequestID) > maxPeeringRequestIDLen {
+		info.RequestID = reqID
+	}
+	return info, nil
+}
+
+// SetHeaders sets the peering headers of a request forwarded to a peer.
+func (info *PeeringInfo) SetHeaders(h http.Header) {
+	h.Set(PeeringHopsHeader, strconv.Itoa(info.Hops+1))
+	h.Set(PeeringOriginHeader, info.Origin)
+	h.Set(PeeringRequestIDHeader, info.RequestID)
+	if info.secret != "" {
+		h.Set(PeeringSecretHeader, info.secret)
+	}
+}
+
+// Dedup forwards req through fn, unless a request with the same request ID,
+// method and params is already in flight, in which case it waits for and
+// shares that request's response. This is the case of requests retried by
+// several peers, e.g. when they share a load balancer.
+func (p *Peering) Dedup(
+	ctx context.Context,
+	info *PeeringInfo,
+	req *RPCReq,
+	fn func(ctx context.Context) (*RPCRes, string, error),
+) (*RPCRes, string, error) {
+	h := sha256.Sum256(req.Params)
+	key := info.RequestID + ":" + req.Method + ":" + hex.EncodeToString(h[:])
+	var leader bool
+	v, err, _ := p.group.Do(key, func() (interface{}, error) {
+		leader = true
+		// as with the coalescer, the upstream call must outlive the client
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), p.timeout)
+		defer cancel()
+		res, servedBy, err := fn(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return &coalescedResult{res: res, servedBy: servedBy}, nil
+	})
+	if !leader {
+		RecordPeeringDeduplicatedRequest(req.Method)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	result := v.(*coalescedResult)
+	res := *result.res
+	res.ID = req.ID
+	return &res, result.servedBy, nil
+}
+
+func peeringRejectionReason(err error) string {
+	if errors.Is(err, ErrPeeringLoop) {
+		return "loop"
+	}
+	return "max_hops"
+}
+
+func GetPeeringInfo(ctx context.Context) *PeeringInfo {
+	info, _ := ctx.Value(ContextKeyPeering).(*PeeringInfo)
+	return info
+}
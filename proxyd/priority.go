@@ -0,0 +1,238 @@
+package proxyd
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	ContextKeyPriorityClass = "priority_class"
+	defaultPriorityClass    = "default"
+)
+
+// RPCSemaphore bounds the concurrent requests to backends. It is satisfied by
+// *semaphore.Weighted and *PrioritySemaphore.
+type RPCSemaphore interface {
+	Acquire(ctx context.Context, n int64) error
+	Release(n int64)
+}
+
+func GetPriorityClass(ctx context.Context) string {
+	class, _ := ctx.Value(ContextKeyPriorityClass).(string)
+	return class
+}
+
+// PriorityClassifier assigns forwarded requests to a priority class, by
+// method or by auth key.
+type PriorityClassifier struct {
+	methods      map[string]string
+	authKeys     map[string]string
+	weights      map[string]int
+	defaultClass string
+}
+
+func NewPriorityClassifier(config PriorityConfig, authKeys map[string]*AuthKeyConfig) (*PriorityClassifier, error) {
+	if err := validatePriorityConfig(config); err != nil {
+		return nil, err
+	}
+	c := &PriorityClassifier{
+		methods:      config.Methods,
+		authKeys:     make(map[string]string),
+		weights:      make(map[string]int, len(config.Classes)),
+		defaultClass: priorityDefaultClass(config),
+	}
+	for name, class := range config.Classes {
+		c.weights[name] = class.Weight
+	}
+	for alias, key := range authKeys {
+		if key.PriorityClass == "" {
+			continue
+		}
+		if config.Classes[key.PriorityClass] == nil {
+			return nil, fmt.Errorf("auth key %s has undefined priority class %s", alias, key.PriorityClass)
+		}
+		c.authKeys[alias] = key.PriorityClass
+	}
+	return c, nil
+}
+
+// Classify returns the class of requests forwarded together. Classes of
+// methods take precedence over the class of the auth key. A batch mixing
+// classes gets the one of lowest weight, so that low priority requests can't
+// be upgraded by batching them with high priority ones.
+func (c *PriorityClassifier) Classify(ctx context.Context, reqs []*RPCReq) string {
+	class := ""
+	for _, req := range reqs {
+		methodClass, ok := c.methods[req.Method]
+		if ok && (class == "" || c.weights[methodClass] < c.weights[class]) {
+			class = methodClass
+		}
+	}
+	if class != "" {
+		return class
+	}
+	if class, ok := c.authKeys[GetAuthCtx(ctx)]; ok {
+		return class
+	}
+	return c.defaultClass
+}
+
+func validatePriorityConfig(config PriorityConfig) error {
+	if len(config.Classes) == 0 {
+		return fmt.Errorf("priority requires at least one class")
+	}
+	for name, class := range config.Classes {
+		if class.Weight <= 0 {
+			return fmt.Errorf("priority class %s must have a positive weight", name)
+		}
+	}
+	if config.Classes[priorityDefaultClass(config)] == nil {
+		return fmt.Errorf("undefined default priority class %s", priorityDefaultClass(config))
+	}
+	for method, class := range config.Methods {
+		if config.Classes[class] == nil {
+			return fmt.Errorf("method %s has undefined priority class %s", method, class)
+		}
+	}
+	return nil
+}
+
+func priorityDefaultClass(config PriorityConfig) string {
+	if config.DefaultClass == "" {
+		return defaultPriorityClass
+	}
+	return config.DefaultClass
+}
+
+// PrioritySemaphore is a weighted semaphore whose waiters are served by a
+// stride scheduler across priority classes: under saturation, each class gets
+// a share of the released slots proportional to its weight, and waiters of a
+// class are served in FIFO order.
+type PrioritySemaphore struct {
+	size         int64
+	defaultClass string
+
+	mu      sync.Mutex
+	cur     int64
+	waiting int
+	vtime   float64
+	classes map[string]*priorityQueue
+}
+
+type priorityQueue struct {
+	name    string
+	stride  float64
+	pass    float64
+	waiters list.List
+}
+
+type priorityWaiter struct {
+	n     int64
+	ready chan struct{}
+}
+
+func NewPrioritySemaphore(size int64, config PriorityConfig) (*PrioritySemaphore, error) {
+	if err := validatePriorityConfig(config); err != nil {
+		return nil, err
+	}
+	s := &PrioritySemaphore{
+		size:         size,
+		defaultClass: priorityDefaultClass(config),
+		classes:      make(map[string]*priorityQueue, len(config.Classes)),
+	}
+	for name, class := range config.Classes {
+		s.classes[name] = &priorityQueue{name: name, stride: 1 / float64(class.Weight)}
+	}
+	return s, nil
+}
+
+// Acquire acquires n slots for the priority class of ctx, blocking until they
+// are available or ctx is done.
+func (s *PrioritySemaphore) Acquire(ctx context.Context, n int64) error {
+	queue := s.classes[GetPriorityClass(ctx)]
+	if queue == nil {
+		queue = s.classes[s.defaultClass]
+	}
+
+	s.mu.Lock()
+	if s.size-s.cur >= n && s.waiting == 0 {
+		s.cur += n
+		s.mu.Unlock()
+		RecordPriorityWait(queue.name, 0)
+		return nil
+	}
+
+	start := time.Now()
+	w := &priorityWaiter{n: n, ready: make(chan struct{})}
+	if queue.waiters.Len() == 0 {
+		// Classes don't accumulate credit while they are idle.
+		queue.pass = math.Max(queue.pass, s.vtime)
+	}
+	elem := queue.waiters.PushBack(w)
+	s.waiting++
+	RecordPriorityQueued(queue.name, 1)
+	s.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		RecordPriorityWait(queue.name, time.Since(start))
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		select {
+		case <-w.ready:
+			// Acquired after ctx was done, give the slots back.
+			s.cur -= n
+		default:
+			queue.waiters.Remove(elem)
+			s.waiting--
+			RecordPriorityQueued(queue.name, -1)
+		}
+		s.notifyWaiters()
+		s.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+func (s *PrioritySemaphore) Release(n int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cur -= n
+	if s.cur < 0 {
+		panic("priority semaphore: released more than held")
+	}
+	s.notifyWaiters()
+}
+
+// notifyWaiters hands the free slots to the waiters of the classes with the
+// lowest pass. It must be called with mu held.
+func (s *PrioritySemaphore) notifyWaiters() {
+	for s.waiting > 0 {
+		var next *priorityQueue
+		for _, queue := range s.classes {
+			if queue.waiters.Len() == 0 {
+				continue
+			}
+			if next == nil || queue.pass < next.pass || (queue.pass == next.pass && queue.stride < next.stride) {
+				next = queue
+			}
+		}
+		front := next.waiters.Front()
+		w := front.Value.(*priorityWaiter)
+		if s.size-s.cur < w.n {
+			// Don't let smaller requests of other classes starve this one.
+			return
+		}
+		s.cur += w.n
+		next.waiters.Remove(front)
+		s.waiting--
+		s.vtime = next.pass
+		next.pass += next.stride
+		RecordPriorityQueued(next.name, -1)
+		close(w.ready)
+	}
+}
@@ -0,0 +1,125 @@
+package proxyd
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testPriorityConfig() PriorityConfig {
+	return PriorityConfig{
+		Enabled:      true,
+		DefaultClass: "interactive",
+		Classes: map[string]*PriorityClassConfig{
+			"tx":          {Weight: 4},
+			"interactive": {Weight: 2},
+			"batch":       {Weight: 1},
+		},
+		Methods: map[string]string{
+			"eth_sendRawTransaction": "tx",
+			"eth_getLogs":            "batch",
+		},
+	}
+}
+
+func TestPriorityClassifier(t *testing.T) {
+	c, err := NewPriorityClassifier(testPriorityConfig(), map[string]*AuthKeyConfig{
+		"indexer": {PriorityClass: "batch"},
+	})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	indexerCtx := context.WithValue(ctx, ContextKeyAuth, "indexer") // nolint:staticcheck
+	reqs := func(methods ...string) []*RPCReq {
+		var reqs []*RPCReq
+		for _, method := range methods {
+			reqs = append(reqs, &RPCReq{Method: method})
+		}
+		return reqs
+	}
+	require.Equal(t, "tx", c.Classify(ctx, reqs("eth_sendRawTransaction")))
+	require.Equal(t, "interactive", c.Classify(ctx, reqs("eth_call")))
+	require.Equal(t, "batch", c.Classify(ctx, reqs("eth_sendRawTransaction", "eth_getLogs")))
+	require.Equal(t, "batch", c.Classify(indexerCtx, reqs("eth_call")))
+	require.Equal(t, "tx", c.Classify(indexerCtx, reqs("eth_sendRawTransaction")))
+
+	_, err = NewPriorityClassifier(testPriorityConfig(), map[string]*AuthKeyConfig{
+		"indexer": {PriorityClass: "unknown"},
+	})
+	require.Error(t, err)
+}
+
+func TestPrioritySemaphore(t *testing.T) {
+	sem, err := NewPrioritySemaphore(1, testPriorityConfig())
+	require.NoError(t, err)
+	ctx := func(class string) context.Context {
+		return context.WithValue(context.Background(), ContextKeyPriorityClass, class) // nolint:staticcheck
+	}
+	waitQueued := func(n int) {
+		require.Eventually(t, func() bool {
+			sem.mu.Lock()
+			defer sem.mu.Unlock()
+			return sem.waiting == n
+		}, time.Second, time.Millisecond)
+	}
+
+	t.Run("classes share slots by weight", func(t *testing.T) {
+		require.NoError(t, sem.Acquire(ctx("batch"), 1))
+
+		var mtx sync.Mutex
+		var order []string
+		var wg sync.WaitGroup
+		queue := func(class string, n int) {
+			for i := 0; i < n; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					require.NoError(t, sem.Acquire(ctx(class), 1))
+					mtx.Lock()
+					order = append(order, class)
+					mtx.Unlock()
+					sem.Release(1)
+				}()
+			}
+		}
+		queue("batch", 10)
+		waitQueued(10)
+		queue("tx", 10)
+		waitQueued(20)
+		sem.Release(1)
+		wg.Wait()
+
+		// the first 5 slots go to 4 tx for 1 batch, despite queuing later
+		counts := make(map[string]int)
+		for _, class := range order[:5] {
+			counts[class]++
+		}
+		require.Equal(t, map[string]int{"tx": 4, "batch": 1}, counts)
+		require.Len(t, order, 20)
+	})
+
+	t.Run("canceled waiters leave the queue", func(t *testing.T) {
+		require.NoError(t, sem.Acquire(ctx("tx"), 1))
+		cctx, cancel := context.WithCancel(ctx("tx"))
+		errC := make(chan error)
+		go func() {
+			errC <- sem.Acquire(cctx, 1)
+		}()
+		waitQueued(1)
+		cancel()
+		require.ErrorIs(t, <-errC, context.Canceled)
+		waitQueued(0)
+
+		sem.Release(1)
+		require.NoError(t, sem.Acquire(ctx("batch"), 1))
+		sem.Release(1)
+	})
+
+	t.Run("unknown classes use the default class", func(t *testing.T) {
+		require.NoError(t, sem.Acquire(ctx("unknown"), 1))
+		sem.Release(1)
+	})
+}
@@ -0,0 +1,204 @@
+package proxyd
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	PrivateTxMethod = "eth_sendPrivateTransaction"
+
+	PrivateTxOutcomeRelayed  = "relayed"
+	PrivateTxOutcomeFallback = "fallback"
+	PrivateTxOutcomeFailed   = "failed"
+
+	defaultPrivateTxSignatureHeader = "X-Flashbots-Signature"
+	defaultPrivateTxTimeout         = 5 * time.Second
+	maxPrivateTxResponseSize        = 1024 * 1024
+)
+
+var ErrPrivateRelayUnavailable = &RPCErr{
+	Code:          JSONRPCErrorInternal - 28,
+	Message:       "private transaction relay unavailable",
+	HTTPErrorCode: 503,
+}
+
+// privateTxParams are the params of eth_sendPrivateTransaction.
+type privateTxParams struct {
+	Tx string `json:"tx"`
+}
+
+// PrivateTxRelay forwards transactions to a private relay, such as Flashbots
+// Protect, instead of the public mempool. Requests are signed with a key whose
+// address identifies proxyd to the relay, as
+// "<address>:<signature of the keccak256 hash of the body>". If the relay
+// can't be reached, transactions optionally fall back to the public path.
+type PrivateTxRelay struct {
+	url             string
+	key             *ecdsa.PrivateKey
+	signatureHeader string
+	relayRawTxs     bool
+	fallback        bool
+	client          *http.Client
+}
+
+func NewPrivateTxRelay(config PrivateTxConfig) (*PrivateTxRelay, error) {
+	relayURL, err := ReadFromEnvOrConfig(config.URL)
+	if err != nil {
+		return nil, err
+	}
+	if relayURL == "" {
+		return nil, fmt.Errorf("private_tx requires a url")
+	}
+	var key *ecdsa.PrivateKey
+	if config.SigningKey != "" {
+		hexKey, err := ReadFromEnvOrConfig(config.SigningKey)
+		if err != nil {
+			return nil, err
+		}
+		if key, err = crypto.HexToECDSA(strings.TrimPrefix(hexKey, "0x")); err != nil {
+			return nil, fmt.Errorf("invalid private_tx signing key: %w", err)
+		}
+	}
+	signatureHeader := defaultPrivateTxSignatureHeader
+	if config.SignatureHeader != "" {
+		signatureHeader = config.SignatureHeader
+	}
+	timeout := defaultPrivateTxTimeout
+	if config.Timeout != 0 {
+		timeout = time.Duration(config.Timeout)
+	}
+	return &PrivateTxRelay{
+		url:             relayURL,
+		key:             key,
+		signatureHeader: signatureHeader,
+		relayRawTxs:     config.RelayRawTransactions,
+		fallback:        config.Fallback,
+		client:          &http.Client{Timeout: timeout},
+	}, nil
+}
+
+// Handles returns whether requests of method are relayed.
+func (r *PrivateTxRelay) Handles(method string) bool {
+	return method == PrivateTxMethod || (r.relayRawTxs && method == "eth_sendRawTransaction")
+}
+
+// Fallback returns whether transactions are sent through the public path when
+// the relay fails.
+func (r *PrivateTxRelay) Fallback() bool {
+	return r.fallback
+}
+
+// RawTxReq returns the eth_sendRawTransaction request of the transaction of an
+// eth_sendPrivateTransaction request, which is used for its checks and to
+// fall back to the public path.
+func (r *PrivateTxRelay) RawTxReq(req *RPCReq) (*RPCReq, error) {
+	var params []privateTxParams
+	if err := json.Unmarshal(req.Params, &params); err != nil || len(params) != 1 {
+		return nil, ErrInvalidParams("invalid private transaction params")
+	}
+	if params[0].Tx == "" {
+		return nil, ErrInvalidParams("missing private transaction tx")
+	}
+	return &RPCReq{
+		JSONRPC: req.JSONRPC,
+		Method:  "eth_sendRawTransaction",
+		Params:  mustMarshalJSON([]string{params[0].Tx}),
+		ID:      req.ID,
+	}, nil
+}
+
+// Send relays req, eth_sendRawTransaction requests being sent as
+// eth_sendPrivateTransaction. JSON-RPC errors of the relay are returned as
+// responses, other failures as errors.
+func (r *PrivateTxRelay) Send(ctx context.Context, req *RPCReq) (*RPCRes, error) {
+	relayReq := req
+	if req.Method == "eth_sendRawTransaction" {
+		var params []string
+		if err := json.Unmarshal(req.Params, &params); err != nil || len(params) != 1 {
+			return nil, ErrInvalidParams("invalid raw transaction params")
+		}
+		relayReq = &RPCReq{
+			JSONRPC: req.JSONRPC,
+			Method:  PrivateTxMethod,
+			Params:  mustMarshalJSON([]privateTxParams{{Tx: params[0]}}),
+			ID:      req.ID,
+		}
+	}
+	body := mustMarshalJSON(relayReq)
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, r.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if r.key != nil {
+		signature, err := r.sign(body)
+		if err != nil {
+			return nil, err
+		}
+		httpReq.Header.Set(r.signatureHeader, signature)
+	}
+
+	httpRes, err := r.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer httpRes.Body.Close()
+	if httpRes.StatusCode >= 500 {
+		return nil, fmt.Errorf("private relay responded with status %d", httpRes.StatusCode)
+	}
+	res, err := ParseRPCRes(io.LimitReader(httpRes.Body, maxPrivateTxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+	if res.Result == nil && res.Error == nil {
+		return nil, ErrBackendUnexpectedJSONRPC
+	}
+	res.ID = req.ID
+	return res, nil
+}
+
+func (r *PrivateTxRelay) sign(body []byte) (string, error) {
+	hash := hexutil.Encode(crypto.Keccak256(body))
+	sig, err := crypto.Sign(accounts.TextHash([]byte(hash)), r.key)
+	if err != nil {
+		return "", err
+	}
+	return crypto.PubkeyToAddress(r.key.PublicKey).Hex() + ":" + hexutil.Encode(sig), nil
+}
+
+// relayPrivateTx relays req to the private relay. It returns the response to
+// send to the client, or nil if req should take the public path instead.
+func (s *Server) relayPrivateTx(ctx context.Context, req *RPCReq) *RPCRes {
+	res, err := s.privateTx.Send(ctx, req)
+	if err == nil {
+		RecordPrivateTx(PrivateTxOutcomeRelayed)
+		RecordRPCForward(ctx, "private_relay", req.Method, RPCRequestSourceHTTP)
+		return res
+	}
+	if rpcErr, ok := err.(*RPCErr); ok {
+		return NewRPCErrorRes(req.ID, rpcErr)
+	}
+	if s.privateTx.Fallback() {
+		log.Warn("error relaying private transaction, falling back to the public path", "err", err, "req_id", GetReqID(ctx))
+		RecordPrivateTx(PrivateTxOutcomeFallback)
+		return nil
+	}
+	log.Error("error relaying private transaction", "err", err, "req_id", GetReqID(ctx))
+	RecordPrivateTx(PrivateTxOutcomeFailed)
+	RecordRPCError(ctx, BackendProxyd, req.Method, ErrPrivateRelayUnavailable)
+	return NewRPCErrorRes(req.ID, ErrPrivateRelayUnavailable)
+}
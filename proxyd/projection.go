@@ -0,0 +1,129 @@
+package proxyd
+
+import (
+	"context"
+	"strings"
+)
+
+// ResponseProjector strips fields from the results of methods served to a
+// tier of clients, to reduce the egress of responses they don't need in full.
+// Tiers are auth key aliases, "none" being the tier of unauthenticated
+// clients.
+type ResponseProjector struct {
+	tiers map[string]map[string]*responseProjection
+}
+
+type responseProjection struct {
+	strip    [][]string
+	collapse []fieldCollapse
+}
+
+type fieldCollapse struct {
+	path     []string
+	subfield string
+}
+
+func NewResponseProjector(config map[string]map[string]*ResponseProjectionConfig) *ResponseProjector {
+	if len(config) == 0 {
+		return nil
+	}
+	p := &ResponseProjector{tiers: make(map[string]map[string]*responseProjection, len(config))}
+	for tier, methods := range config {
+		p.tiers[tier] = make(map[string]*responseProjection, len(methods))
+		for method, cfg := range methods {
+			projection := &responseProjection{}
+			for _, field := range cfg.StripFields {
+				projection.strip = append(projection.strip, strings.Split(field, "."))
+			}
+			for field, subfield := range cfg.CollapseFields {
+				projection.collapse = append(projection.collapse, fieldCollapse{strings.Split(field, "."), subfield})
+			}
+			p.tiers[tier][method] = projection
+		}
+	}
+	return p
+}
+
+// Project replaces the results of responses whose method, methods being the
+// methods of their requests, is projected for the tier of the client. Results
+// are copied rather than modified, since they may be shared with other
+// requests.
+func (p *ResponseProjector) Project(ctx context.Context, methods []string, responses []*RPCRes) {
+	if p == nil {
+		return
+	}
+	projections := p.tiers[GetAuthCtx(ctx)]
+	if projections == nil {
+		return
+	}
+	for i, res := range responses {
+		projection := projections[methods[i]]
+		if projection == nil || res == nil || res.IsError() || res.Result == nil {
+			continue
+		}
+		result := res.Result
+		for _, path := range projection.strip {
+			result = projectPath(result, path, func(m map[string]interface{}, key string) {
+				delete(m, key)
+			})
+		}
+		for _, c := range projection.collapse {
+			result = projectPath(result, c.path, func(m map[string]interface{}, key string) {
+				if v, ok := m[key]; ok {
+					m[key] = collapseValue(v, c.subfield)
+				}
+			})
+		}
+		responses[i] = &RPCRes{
+			JSONRPC: res.JSONRPC,
+			Result:  result,
+			ID:      res.ID,
+		}
+		RecordResponseProjection(methods[i])
+	}
+}
+
+// projectPath returns a copy of v in which fn is applied to the objects
+// holding the last key of path. Arrays apply the path to each of their
+// elements. Only the objects on the path are copied.
+func projectPath(v interface{}, path []string, fn func(m map[string]interface{}, key string)) interface{} {
+	switch v := v.(type) {
+	case []interface{}:
+		projected := make([]interface{}, len(v))
+		for i, elem := range v {
+			projected[i] = projectPath(elem, path, fn)
+		}
+		return projected
+	case map[string]interface{}:
+		projected := make(map[string]interface{}, len(v))
+		for key, val := range v {
+			projected[key] = val
+		}
+		if len(path) == 1 {
+			fn(projected, path[0])
+		} else if val, ok := projected[path[0]]; ok {
+			projected[path[0]] = projectPath(val, path[1:], fn)
+		}
+		return projected
+	default:
+		return v
+	}
+}
+
+// collapseValue replaces the objects of v, or v itself, by their subfield.
+// Other values are left as is, e.g. the hashes of a block fetched without its
+// full transactions.
+func collapseValue(v interface{}, subfield string) interface{} {
+	switch v := v.(type) {
+	case []interface{}:
+		collapsed := make([]interface{}, len(v))
+		for i, elem := range v {
+			collapsed[i] = collapseValue(elem, subfield)
+		}
+		return collapsed
+	case map[string]interface{}:
+		return v[subfield]
+	default:
+		return v
+	}
+}
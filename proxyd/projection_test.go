@@ -0,0 +1,66 @@
+package proxyd
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponseProjector(t *testing.T) {
+	p := NewResponseProjector(map[string]map[string]*ResponseProjectionConfig{
+		"none": {
+			"eth_getBlockByNumber": {
+				StripFields:    []string{"logsBloom", "withdrawals.amount"},
+				CollapseFields: map[string]string{"transactions": "hash"},
+			},
+			"eth_getLogs": {
+				StripFields: []string{"data"},
+			},
+		},
+	})
+
+	var block, logs interface{}
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"number": "0x1",
+		"logsBloom": "0x00",
+		"transactions": [{"hash": "0xa", "input": "0x"}, {"hash": "0xb", "input": "0x"}],
+		"withdrawals": [{"index": "0x0", "amount": "0x1"}]
+	}`), &block))
+	require.NoError(t, json.Unmarshal([]byte(`[{"address": "0x1", "data": "0x"}]`), &logs))
+	blockRes := &RPCRes{JSONRPC: JSONRPCVersion, Result: block, ID: json.RawMessage("1")}
+	responses := []*RPCRes{
+		blockRes,
+		{JSONRPC: JSONRPCVersion, Result: logs, ID: json.RawMessage("2")},
+		{JSONRPC: JSONRPCVersion, Result: "0x1", ID: json.RawMessage("3")},
+		NewRPCErrorRes(json.RawMessage("4"), ErrInternal),
+		nil,
+	}
+	methods := []string{"eth_getBlockByNumber", "eth_getLogs", "eth_chainId", "eth_getLogs", ""}
+
+	authenticated := context.WithValue(context.Background(), ContextKeyAuth, "key") // nolint:staticcheck
+	p.Project(authenticated, methods, responses)
+	require.Same(t, blockRes, responses[0])
+
+	p.Project(context.Background(), methods, responses)
+	require.JSONEq(t, `{"jsonrpc":"2.0","id":1,"result":{
+		"number": "0x1",
+		"transactions": ["0xa", "0xb"],
+		"withdrawals": [{"index": "0x0"}]
+	}}`, string(mustMarshalJSON(responses[0])))
+	require.JSONEq(t, `{"jsonrpc":"2.0","id":2,"result":[{"address":"0x1"}]}`, string(mustMarshalJSON(responses[1])))
+	require.JSONEq(t, `{"jsonrpc":"2.0","id":3,"result":"0x1"}`, string(mustMarshalJSON(responses[2])))
+	require.True(t, responses[3].IsError())
+	require.Nil(t, responses[4])
+
+	// results may be shared, so they must not be modified
+	require.JSONEq(t, `{"jsonrpc":"2.0","id":1,"result":{
+		"number": "0x1",
+		"logsBloom": "0x00",
+		"transactions": [{"hash": "0xa", "input": "0x"}, {"hash": "0xb", "input": "0x"}],
+		"withdrawals": [{"index": "0x0", "amount": "0x1"}]
+	}}`, string(mustMarshalJSON(blockRes)))
+
+	require.Nil(t, NewResponseProjector(nil))
+}
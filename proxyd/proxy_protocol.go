@@ -0,0 +1,231 @@
+package proxyd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	defaultProxyProtocolHeaderTimeout = 5 * time.Second
+
+	// proxyProtocolV1MaxLen is the maximum length of a v1 header, CRLF
+	// included.
+	proxyProtocolV1MaxLen = 107
+)
+
+// proxyProtocolV2Signature starts the headers of version 2.
+var proxyProtocolV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+var errProxyProtocolHeader = errors.New("invalid PROXY protocol header")
+
+// proxyProtocol reads the client address of the connections accepted from
+// trusted load balancers from their PROXY protocol header.
+type proxyProtocol struct {
+	trustedNets   []*net.IPNet
+	headerTimeout time.Duration
+}
+
+func newProxyProtocol(config ProxyProtocolConfig) (*proxyProtocol, error) {
+	if !config.Enabled {
+		return nil, nil
+	}
+	nets, err := parseCIDRs(config.TrustedCIDRs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy_protocol trusted CIDRs: %w", err)
+	}
+	if len(nets) == 0 {
+		return nil, errors.New("proxy_protocol requires trusted_cidrs")
+	}
+	headerTimeout := defaultProxyProtocolHeaderTimeout
+	if config.HeaderTimeout != 0 {
+		headerTimeout = time.Duration(config.HeaderTimeout)
+	}
+	return &proxyProtocol{
+		trustedNets:   nets,
+		headerTimeout: headerTimeout,
+	}, nil
+}
+
+// listen listens on addr, reading the PROXY protocol headers of the
+// connections if p is set.
+func (p *proxyProtocol) listen(addr string) (net.Listener, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil || p == nil {
+		return ln, err
+	}
+	return &proxyProtocolListener{Listener: ln, p: p}, nil
+}
+
+type proxyProtocolListener struct {
+	net.Listener
+	p *proxyProtocol
+}
+
+// Accept returns the connections of untrusted peers as is. Those of trusted
+// peers have their header read on first use, so that slow peers don't hold
+// up the accept loop.
+func (l *proxyProtocolListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	addr, ok := conn.RemoteAddr().(*net.TCPAddr)
+	if !ok || !containsIP(l.p.trustedNets, addr.IP) {
+		return conn, nil
+	}
+	return &proxyProtocolConn{
+		Conn:          conn,
+		r:             bufio.NewReader(conn),
+		headerTimeout: l.p.headerTimeout,
+	}, nil
+}
+
+// proxyProtocolConn is a connection from a trusted peer, whose remote address
+// is the client address of its header. Connections without a header keep
+// the address of the peer, e.g. for its health checks.
+type proxyProtocolConn struct {
+	net.Conn
+	r             *bufio.Reader
+	headerTimeout time.Duration
+
+	once       sync.Once
+	remoteAddr net.Addr
+	err        error
+}
+
+func (c *proxyProtocolConn) readHeader() {
+	c.once.Do(func() {
+		if err := c.Conn.SetReadDeadline(time.Now().Add(c.headerTimeout)); err != nil {
+			c.err = err
+			return
+		}
+		c.remoteAddr, c.err = readProxyProtocolHeader(c.r)
+		if c.err != nil {
+			log.Warn("error reading PROXY protocol header", "peer", c.Conn.RemoteAddr(), "err", c.err)
+			RecordProxyProtocolError()
+			_ = c.Conn.Close()
+			return
+		}
+		c.err = c.Conn.SetReadDeadline(time.Time{})
+	})
+}
+
+func (c *proxyProtocolConn) Read(b []byte) (int, error) {
+	c.readHeader()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.r.Read(b)
+}
+
+func (c *proxyProtocolConn) RemoteAddr() net.Addr {
+	c.readHeader()
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// readProxyProtocolHeader reads the v1 or v2 header at the start of r, if
+// any, and returns the client address it holds. The address is nil for
+// connections without a header, and for the LOCAL connections of v2 and the
+// UNKNOWN ones of v1, made by the peer itself.
+func readProxyProtocolHeader(r *bufio.Reader) (net.Addr, error) {
+	b, err := r.Peek(1)
+	if err != nil {
+		return nil, nil
+	}
+	if b[0] == proxyProtocolV2Signature[0] {
+		if b, err := r.Peek(len(proxyProtocolV2Signature)); err == nil && bytes.Equal(b, proxyProtocolV2Signature) {
+			return readProxyProtocolV2(r)
+		}
+		return nil, nil
+	}
+	if b, err := r.Peek(6); err == nil && string(b) == "PROXY " {
+		return readProxyProtocolV1(r)
+	}
+	return nil, nil
+}
+
+// readProxyProtocolV1 reads a header such as
+// "PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n".
+func readProxyProtocolV1(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for !bytes.HasSuffix(line, []byte("\r\n")) {
+		c, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if line = append(line, c); len(line) > proxyProtocolV1MaxLen {
+			return nil, fmt.Errorf("%w: v1 header too long", errProxyProtocolHeader)
+		}
+	}
+	fields := strings.Split(strings.TrimSuffix(string(line), "\r\n"), " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("%w: malformed v1 header", errProxyProtocolHeader)
+	}
+	ip := net.ParseIP(fields[2])
+	if ip == nil || (ip.To4() != nil) != (fields[1] == "TCP4") {
+		return nil, fmt.Errorf("%w: invalid v1 source address %s", errProxyProtocolHeader, fields[2])
+	}
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid v1 source port %s", errProxyProtocolHeader, fields[4])
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// readProxyProtocolV2 reads a binary header. Its TLVs are skipped.
+func readProxyProtocolV2(r *bufio.Reader) (net.Addr, error) {
+	var hdr [16]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	if hdr[12]>>4 != 2 {
+		return nil, fmt.Errorf("%w: unsupported version %d", errProxyProtocolHeader, hdr[12]>>4)
+	}
+	payload := make([]byte, binary.BigEndian.Uint16(hdr[14:]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+	switch hdr[12] & 0x0f {
+	case 0x0:
+		// LOCAL
+		return nil, nil
+	case 0x1:
+		// PROXY
+	default:
+		return nil, fmt.Errorf("%w: unsupported command %d", errProxyProtocolHeader, hdr[12]&0x0f)
+	}
+	var ipLen int
+	switch hdr[13] >> 4 {
+	case 0x1:
+		ipLen = net.IPv4len
+	case 0x2:
+		ipLen = net.IPv6len
+	default:
+		// AF_UNSPEC and AF_UNIX carry no client IP
+		return nil, nil
+	}
+	// source and destination addresses, then ports
+	if len(payload) < 2*ipLen+4 {
+		return nil, fmt.Errorf("%w: v2 addresses truncated", errProxyProtocolHeader)
+	}
+	ip := net.IP(append([]byte{}, payload[:ipLen]...))
+	port := binary.BigEndian.Uint16(payload[2*ipLen:])
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
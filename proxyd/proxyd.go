@@ -10,13 +10,14 @@ import (
 	"time"
 
 	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/redis/go-redis/v9"
 	"golang.org/x/sync/semaphore"
 )
 
-func Start(config *Config) (*Server, func(), error) {
+func Start(config *Config, opts ...StartOption) (*Server, func(), error) {
 	if len(config.Backends) == 0 {
 		return nil, nil, errors.New("must define at least one backend")
 	}
@@ -33,13 +34,31 @@ func Start(config *Config) (*Server, func(), error) {
 		}
 	}
 
-	var redisClient *redis.Client
-	if config.Redis.URL != "" {
+	// vault:// and awssm:// values are resolved from here on
+	secretStore, err := newSecretStore(config.Secrets)
+	if err != nil {
+		return nil, nil, err
+	}
+	secrets.Store(secretStore)
+
+	// the admin API manages keys, bans and outages, it never runs unauthenticated
+	var adminToken string
+	if config.Admin.Port != 0 {
+		if adminToken, err = ReadFromEnvOrConfig(config.Admin.Token); err != nil {
+			return nil, nil, err
+		}
+		if adminToken == "" {
+			return nil, nil, errors.New("must specify a token to enable the admin server")
+		}
+	}
+
+	var redisClient redis.UniversalClient
+	if config.Redis.URL != "" || config.Redis.Sentinel.MasterName != "" {
 		rURL, err := ReadFromEnvOrConfig(config.Redis.URL)
 		if err != nil {
 			return nil, nil, err
 		}
-		redisClient, err = NewRedisClient(rURL)
+		redisClient, err = NewRedisClient(rURL, config.Redis)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -76,7 +95,17 @@ func Start(config *Config) (*Server, func(), error) {
 	if maxConcurrentRPCs == 0 {
 		maxConcurrentRPCs = math.MaxInt64
 	}
-	rpcRequestSemaphore := semaphore.NewWeighted(maxConcurrentRPCs)
+	var rpcRequestSemaphore RPCSemaphore = semaphore.NewWeighted(maxConcurrentRPCs)
+	if config.Priority.Enabled {
+		sem, err := NewPrioritySemaphore(maxConcurrentRPCs, config.Priority)
+		if err != nil {
+			return nil, nil, err
+		}
+		rpcRequestSemaphore = sem
+	}
+	if config.Server.EnableLoadShedding {
+		rpcRequestSemaphore = NewAdmissionQueue(rpcRequestSemaphore, maxConcurrentRPCs, config.Server.MaxQueuedRPCs)
+	}
 
 	backendNames := make([]string, 0)
 	backendsByName := make(map[string]*Backend)
@@ -105,6 +134,9 @@ func Start(config *Config) (*Server, func(), error) {
 		if config.BackendOptions.MaxResponseSizeBytes != 0 {
 			opts = append(opts, WithMaxResponseSize(config.BackendOptions.MaxResponseSizeBytes))
 		}
+		if len(config.BackendOptions.MethodMaxResponseSizeBytes) != 0 {
+			opts = append(opts, WithMethodMaxResponseSizes(config.BackendOptions.MethodMaxResponseSizeBytes))
+		}
 		if config.BackendOptions.OutOfServiceSeconds != 0 {
 			opts = append(opts, WithOutOfServiceDuration(secondsToDuration(config.BackendOptions.OutOfServiceSeconds)))
 		}
@@ -117,12 +149,34 @@ func Start(config *Config) (*Server, func(), error) {
 		if config.BackendOptions.MaxErrorRateThreshold > 0 {
 			opts = append(opts, WithMaxErrorRateThreshold(config.BackendOptions.MaxErrorRateThreshold))
 		}
+		if hcfg := config.BackendOptions.HealthScore; hcfg.LatencyWeight > 0 || hcfg.ErrorRateWeight > 0 || hcfg.BlockLagWeight > 0 {
+			opts = append(opts, WithHealthWeights(HealthWeights{
+				Latency:   hcfg.LatencyWeight,
+				ErrorRate: hcfg.ErrorRateWeight,
+				BlockLag:  hcfg.BlockLagWeight,
+			}))
+		}
+		opts = append(opts, WithMinHealthScore(config.BackendOptions.HealthScore.MinScore, config.BackendOptions.HealthScore.DegradedScore))
 		if cfg.MaxRPS != 0 {
 			opts = append(opts, WithMaxRPS(cfg.MaxRPS))
 		}
 		if cfg.MaxWSConns != 0 {
 			opts = append(opts, WithMaxWSConns(cfg.MaxWSConns))
 		}
+		opts = append(opts, WithWSConnConfig(config.WSConns.Backend))
+		if config.WSCompression.Backends {
+			level, err := config.WSCompression.level()
+			if err != nil {
+				return nil, nil, err
+			}
+			opts = append(opts, WithWSCompression(level))
+		}
+		if config.WSPool.Enabled {
+			if config.WSPool.Size < 0 {
+				return nil, nil, fmt.Errorf("ws_pool.size must not be negative")
+			}
+			opts = append(opts, WithWSPool(config.WSPool.Size))
+		}
 		if cfg.Password != "" {
 			passwordVal, err := ReadFromEnvOrConfig(cfg.Password)
 			if err != nil {
@@ -153,6 +207,16 @@ func Start(config *Config) (*Server, func(), error) {
 		if cfg.StripTrailingXFF {
 			opts = append(opts, WithStrippedTrailingXFF())
 		}
+		if cfg.Peer {
+			opts = append(opts, WithPeer())
+		}
+		engineJWTSecret, err := readEngineJWTSecret(cfg)
+		if err != nil {
+			return nil, nil, fmt.Errorf("backend %s: %w", name, err)
+		}
+		if engineJWTSecret != nil {
+			opts = append(opts, WithEngineJWTSecret(engineJWTSecret))
+		}
 		opts = append(opts, WithProxydIP(os.Getenv("PROXYD_IP")))
 		opts = append(opts, WithConsensusSkipPeerCountCheck(cfg.ConsensusSkipPeerCountCheck))
 		opts = append(opts, WithConsensusForcedCandidate(cfg.ConsensusForcedCandidate))
@@ -169,6 +233,13 @@ func Start(config *Config) (*Server, func(), error) {
 		opts = append(opts, WithConsensusReceiptTarget(receiptsTarget))
 
 		back := NewBackend(name, rpcURL, wsURL, rpcRequestSemaphore, opts...)
+		watchSecret(cfg.Password, back.SetBasicAuthPassword)
+		for headerName, headerValue := range cfg.Headers {
+			headerName := headerName
+			watchSecret(headerValue, func(rotated string) {
+				back.SetHeader(headerName, rotated)
+			})
+		}
 		backendNames = append(backendNames, name)
 		backendsByName[name] = back
 		log.Info("configured backend",
@@ -187,11 +258,15 @@ func Start(config *Config) (*Server, func(), error) {
 			}
 			backends = append(backends, backendsByName[bName])
 		}
+		if len(bg.ConsensusLagBudgets) > 0 && !bg.ConsensusAware {
+			return nil, nil, fmt.Errorf("backend group %s must be consensus_aware to set consensus_lag_budgets", bgName)
+		}
 
 		backendGroups[bgName] = &BackendGroup{
 			Name:            bgName,
 			Backends:        backends,
 			WeightedRouting: bg.WeightedRouting,
+			LagBudgets:      bg.ConsensusLagBudgets,
 		}
 	}
 
@@ -203,17 +278,41 @@ func Start(config *Config) (*Server, func(), error) {
 		}
 	}
 
+	if wsBackendGroup != nil {
+		wsBalancer, err := NewWSBalancer(config.WSBalancing)
+		if err != nil {
+			return nil, nil, err
+		}
+		wsBackendGroup.WSBalancer = wsBalancer
+	}
 	if wsBackendGroup == nil && config.Server.WSPort != 0 {
 		return nil, nil, fmt.Errorf("a ws port was defined, but no ws group was defined")
 	}
+	if config.WSMultiplex.Enabled && config.WSMultiplex.ConsensusHeads &&
+		(wsBackendGroup == nil || !config.BackendGroups[config.WSBackendGroup].ConsensusAware) {
+		return nil, nil, fmt.Errorf("ws_multiplex.consensus_heads requires the ws backend group to be consensus aware")
+	}
+	if config.SSE.Enabled && (wsBackendGroup == nil || !config.WSMultiplex.Enabled) {
+		return nil, nil, fmt.Errorf("sse requires a ws backend group and ws_multiplex")
+	}
 
-	for _, bg := range config.RPCMethodMappings {
+	for method, bg := range config.RPCMethodMappings {
 		if backendGroups[bg] == nil {
 			return nil, nil, fmt.Errorf("undefined backend group %s", bg)
 		}
+		if !isEngineMethod(method) {
+			continue
+		}
+		for _, b := range backendGroups[bg].Backends {
+			if b.engineJWTSecret == nil {
+				return nil, nil, fmt.Errorf("backend %s serving %s requires an engine_jwt_secret", b.Name, method)
+			}
+		}
 	}
 
 	var resolvedAuth map[string]string
+	// authSecrets are the values of the vault:// and awssm:// auth secrets
+	authSecrets := make(map[string]string)
 
 	if config.Authentication != nil {
 		resolvedAuth = make(map[string]string)
@@ -223,49 +322,302 @@ func Start(config *Config) (*Server, func(), error) {
 				return nil, nil, err
 			}
 			resolvedAuth[resolvedSecret] = alias
+			if isSecretRef(secret) {
+				authSecrets[secret] = resolvedSecret
+			}
+		}
+	}
+
+	for alias := range config.AuthKeys {
+		found := false
+		for _, a := range config.Authentication {
+			found = found || a == alias
+		}
+		for _, a := range config.Server.TLS.ClientAuth.Aliases {
+			found = found || a == alias
+		}
+		// bearer tokens and keys managed at runtime can have any alias
+		found = found || config.JWTAuth.Enabled || config.APIKeys.Enabled
+		if !found {
+			return nil, nil, fmt.Errorf("auth key config defined for unknown alias %s", alias)
 		}
 	}
 
 	var (
 		cache    Cache
 		rpcCache RPCCache
+		lvcs     []*EthLastValueCache
+
+		getLatestBlockNumFn    GetBlockNumFn
+		getSafeBlockNumFn      GetBlockNumFn
+		getFinalizedBlockNumFn GetBlockNumFn
+
+		finalityTags *FinalityTags
+		lvcResponder *LVCResponder
+
+		autoConfirmations *AutoConfirmations
 	)
 	if config.Cache.Enabled {
-		if redisClient == nil {
-			log.Warn("redis is not configured, using in-memory cache")
-			cache = newMemoryCache()
+		if groupName := config.Cache.AutoConfirmationsGroup; groupName != "" {
+			bgcfg := config.BackendGroups[groupName]
+			if bgcfg == nil || !bgcfg.ConsensusAware {
+				return nil, nil, fmt.Errorf("auto confirmations group %s must be a consensus aware backend group", groupName)
+			}
+			autoConfirmations = NewAutoConfirmations(groupName, 0, time.Duration(config.Cache.AutoConfirmationsWindow))
 		} else {
-			ttl := defaultCacheTtl
-			if config.Cache.TTL != 0 {
-				ttl = time.Duration(config.Cache.TTL)
-			}
-			cache = newRedisCache(redisClient, config.Redis.Namespace, ttl)
-		}
-		rpcCache = newRPCCache(newCacheWithCompression(cache))
-	}
-
-	srv, err := NewServer(
-		backendGroups,
-		wsBackendGroup,
-		NewStringSetFromStrings(config.WSMethodWhitelist),
-		config.RPCMethodMappings,
-		config.Server.MaxBodySizeBytes,
-		resolvedAuth,
-		secondsToDuration(config.Server.TimeoutSeconds),
-		config.Server.MaxUpstreamBatchSize,
-		config.Server.EnableXServedByHeader,
-		rpcCache,
-		config.RateLimit,
-		config.SenderRateLimit,
-		config.Server.EnableRequestLog,
-		config.Server.MaxRequestBodyLogLen,
-		config.BatchConfig.MaxSize,
-		redisClient,
-	)
+			for method, cfg := range config.Cache.Methods {
+				if cfg.AutoConfirmations {
+					return nil, nil, fmt.Errorf("cache policy of %s requires auto_confirmations_group to be set", method)
+				}
+			}
+		}
+
+		ttl := defaultCacheTtl
+		if config.Cache.TTL != 0 {
+			ttl = time.Duration(config.Cache.TTL)
+		}
+		backend := config.Cache.Backend
+		if backend == "" {
+			backend = "redis"
+			if redisClient == nil {
+				log.Warn("redis is not configured, using in-memory cache")
+				backend = "memory"
+			}
+		}
+		switch backend {
+		case "redis":
+			if redisClient == nil {
+				return nil, nil, errors.New("redis cache backend requires redis to be configured")
+			}
+			cache = newRedisCache(redisClient, config.keyNamespace(config.Redis.Namespace), ttl)
+		case "memcached":
+			memcachedClient, err := NewMemcachedClient(
+				config.Memcached.Servers,
+				time.Duration(config.Memcached.Timeout),
+				config.Memcached.MaxIdleConns,
+			)
+			if err != nil {
+				return nil, nil, err
+			}
+			cache = newMemcachedCache(memcachedClient, config.keyNamespace(config.Memcached.Namespace), ttl)
+		case "memory":
+			cache = newMemoryCache(config.Cache.MemoryMaxEntries, config.Cache.MemoryMaxBytes)
+		default:
+			return nil, nil, fmt.Errorf("unknown cache backend %s", backend)
+		}
+
+		var feeHistoryWindow *EthLastValueCache
+		if config.Cache.BlockSyncRPCURL != "" {
+			blockSyncRPCURL, err := ReadFromEnvOrConfig(config.Cache.BlockSyncRPCURL)
+			if err != nil {
+				return nil, nil, err
+			}
+			ethClient, err := ethclient.Dial(blockSyncRPCURL)
+			if err != nil {
+				return nil, nil, err
+			}
+			lvcs = append(lvcs,
+				makeLatestBlockNumLVC(ethClient, cache),
+				makeSafeBlockNumLVC(ethClient, cache),
+				makeFinalizedBlockNumLVC(ethClient, cache),
+			)
+			getLatestBlockNumFn = makeGetBlockNumFn(lvcs[0])
+			getSafeBlockNumFn = makeGetBlockNumFn(lvcs[1])
+			getFinalizedBlockNumFn = makeGetBlockNumFn(lvcs[2])
+			if config.Cache.RewriteFinalityTags {
+				finalityTags = NewFinalityTags(getSafeBlockNumFn, getFinalizedBlockNumFn)
+			}
+			if config.Cache.ServeFromLVC.Enabled {
+				lvcMethods := config.Cache.ServeFromLVC.Methods
+				if len(lvcMethods) == 0 {
+					lvcMethods = []string{"eth_blockNumber", "eth_gasPrice", "eth_maxPriorityFeePerGas"}
+				}
+				served := make(map[string]*EthLastValueCache, len(lvcMethods))
+				for _, method := range lvcMethods {
+					switch method {
+					case "eth_blockNumber":
+						served[method] = lvcs[0]
+					case "eth_gasPrice":
+						served[method] = makeGasPriceLVC(ethClient, cache)
+					case "eth_maxPriorityFeePerGas":
+						served[method] = makeMaxPriorityFeeLVC(ethClient, cache)
+					default:
+						return nil, nil, fmt.Errorf("method %s can't be served from the LVC", method)
+					}
+					if method != "eth_blockNumber" {
+						lvcs = append(lvcs, served[method])
+					}
+				}
+				lvcResponder = NewLVCResponder(served, time.Duration(config.Cache.ServeFromLVC.MaxStaleness))
+			}
+			if feeHistoryCfg := config.Cache.EthFeeHistory; feeHistoryCfg.Enabled && feeHistoryCfg.SynthesizeBlocks > 0 {
+				percentiles := feeHistoryCfg.SynthesizePercentiles
+				for i, p := range percentiles {
+					if p < 0 || p > 100 || (i > 0 && p <= percentiles[i-1]) {
+						return nil, nil, errors.New("eth_feeHistory synthesize_percentiles must be increasing and between 0 and 100")
+					}
+				}
+				feeHistoryWindow = makeFeeHistoryLVC(ethClient, cache, feeHistoryCfg.SynthesizeBlocks, percentiles)
+				lvcs = append(lvcs, feeHistoryWindow)
+			}
+		} else {
+			for method, cfg := range config.Cache.Methods {
+				if cfg.MinConfirmations > 0 || cfg.AutoConfirmations || cfg.Safe || cfg.Finalized || cfg.FinalizedNoExpiry {
+					return nil, nil, fmt.Errorf("cache policy of %s requires block_sync_rpc_url to be set", method)
+				}
+			}
+			if config.Cache.RewriteFinalityTags {
+				return nil, nil, errors.New("rewrite_finality_tags requires block_sync_rpc_url to be set")
+			}
+			if config.Cache.ServeFromLVC.Enabled {
+				return nil, nil, errors.New("serve_from_lvc requires block_sync_rpc_url to be set")
+			}
+		}
+
+		codec, err := NewCacheCodec(config.Cache.Compression)
+		if err != nil {
+			return nil, nil, wrapErr(err, "error configuring cache compression")
+		}
+		var rpcCacheBackend Cache = newCacheWithCompression(cache, codec)
+		if config.Cache.LocalSize > 0 && backend != "memory" {
+			localTTL := defaultLocalCacheTTL
+			if config.Cache.LocalTTL != 0 {
+				localTTL = time.Duration(config.Cache.LocalTTL)
+			}
+			rpcCacheBackend = newTieredCache(rpcCacheBackend, config.Cache.LocalSize, localTTL, getLatestBlockNumFn)
+		}
+		extraHandlers := make(map[string]RPCMethodHandler)
+		if config.Cache.EthCall.Enabled {
+			if _, ok := config.Cache.Methods["eth_call"]; ok {
+				return nil, nil, errors.New("eth_call caching can't be combined with an eth_call cache policy")
+			}
+			if config.Cache.EthCall.MinConfirmations > 0 && getLatestBlockNumFn == nil {
+				return nil, nil, errors.New("eth_call caching with min_confirmations requires block_sync_rpc_url to be set")
+			}
+			ethCallCache := rpcCacheBackend
+			if config.Cache.EthCall.MaxBytes > 0 {
+				ethCallCache = newCacheWithCompression(newMemoryCache(config.Cache.EthCall.MaxEntries, config.Cache.EthCall.MaxBytes), codec)
+			}
+			extraHandlers["eth_call"] = newEthCallHandler(ethCallCache, config.Cache.EthCall, getLatestBlockNumFn)
+		}
+		if config.Cache.EthGetLogs.Enabled {
+			if _, ok := config.Cache.Methods["eth_getLogs"]; ok {
+				return nil, nil, errors.New("eth_getLogs caching can't be combined with an eth_getLogs cache policy")
+			}
+			if getLatestBlockNumFn == nil {
+				return nil, nil, errors.New("eth_getLogs caching requires block_sync_rpc_url to be set")
+			}
+			extraHandlers["eth_getLogs"] = newEthGetLogsHandler(rpcCacheBackend, config.Cache.EthGetLogs, getLatestBlockNumFn, getFinalizedBlockNumFn)
+		}
+		if config.Cache.EthFeeHistory.Enabled {
+			if _, ok := config.Cache.Methods["eth_feeHistory"]; ok {
+				return nil, nil, errors.New("eth_feeHistory caching can't be combined with an eth_feeHistory cache policy")
+			}
+			if getLatestBlockNumFn == nil {
+				return nil, nil, errors.New("eth_feeHistory caching requires block_sync_rpc_url to be set")
+			}
+			extraHandlers["eth_feeHistory"] = newEthFeeHistoryHandler(rpcCacheBackend, config.Cache.EthFeeHistory, getLatestBlockNumFn, feeHistoryWindow)
+		}
+		rpcCache = newRPCCache(rpcCacheBackend, rpcCacheOptions{
+			methods:                config.Cache.Methods,
+			getLatestBlockNumFn:    getLatestBlockNumFn,
+			getSafeBlockNumFn:      getSafeBlockNumFn,
+			getFinalizedBlockNumFn: getFinalizedBlockNumFn,
+			autoConfirmations:      autoConfirmations,
+			extraHandlers:          extraHandlers,
+		})
+	}
+
+	srv, err := NewServer(ServerOptions{
+		BackendGroups:        backendGroups,
+		WSBackendGroup:       wsBackendGroup,
+		WSMethodWhitelist:    NewStringSetFromStrings(config.WSMethodWhitelist),
+		RPCMethodMappings:    config.RPCMethodMappings,
+		MaxBodySize:          config.Server.MaxBodySizeBytes,
+		AuthenticatedPaths:   resolvedAuth,
+		Timeout:              secondsToDuration(config.Server.TimeoutSeconds),
+		MaxUpstreamBatchSize: config.Server.MaxUpstreamBatchSize,
+		EnableServedByHeader: config.Server.EnableXServedByHeader,
+		Cache:                rpcCache,
+		RateLimit:            config.RateLimit,
+		SenderRateLimit:      config.SenderRateLimit,
+		TxValidation:         config.TxValidation,
+		TxPolicy:             config.TxPolicy,
+		TxDedup:              config.TxDedup,
+		TxNonce:              config.TxNonce,
+		ConditionalTx:        config.ConditionalTx,
+		Bundler:              config.Bundler,
+		PrivateTx:            config.PrivateTx,
+		LocalMethods:         config.LocalMethods,
+		EnableRequestLog:     config.Server.EnableRequestLog,
+		MaxRequestBodyLogLen: config.Server.MaxRequestBodyLogLen,
+		MaxBatchSize:         config.BatchConfig.MaxSize,
+		RedisClient:          redisClient,
+		UpgradeHints:         config.UpgradeHints,
+		RequestCoalescing:    config.RequestCoalescing,
+		HotReload:            config.HotReload,
+		Metering:             config.Metering,
+		AuthKeys:             config.AuthKeys,
+		Peering:              config.Peering,
+		KeyNamespace:         config.keyNamespace(config.Redis.Namespace),
+		WSSessions:           config.WSSessions,
+		WSMultiplex:          config.WSMultiplex,
+		WSFailover:           config.WSFailover,
+		WSConnLimits:         config.WSConnLimits,
+		WSMessageRateLimit:   config.WSMessageRateLimit,
+		WSConns:              config.WSConns,
+		WSMessagePolicy:      config.WSMessagePolicy,
+		WSDrain:              config.WSDrain,
+		WSCompression:        config.WSCompression,
+		SSE:                  config.SSE,
+		TLS:                  config.Server.TLS,
+		JWTAuth:              config.JWTAuth,
+		APIKeys:              config.APIKeys,
+		CORS:                 config.CORS,
+		GeoIP:                config.GeoIP,
+		ProxyProtocol:        config.Server.ProxyProtocol,
+		Abuse:                config.Abuse,
+		AccessLog:            config.AccessLog,
+		ComputeUnits:         config.ComputeUnits,
+		Priority:             config.Priority,
+		ETag:                 config.Cache.ETag,
+		CacheDebugHeader:     config.Cache.DebugHeader,
+		TrustedProxyCIDRs:    config.Server.TrustedProxyCIDRs,
+		FinalityTags:         finalityTags,
+		LVCResponder:         lvcResponder,
+		GetLogsLimits:        config.GetLogsLimits,
+		ParamValidation:      config.ParamValidation,
+		Scripting:            config.Scripting,
+		FilterEmulation:      config.FilterEmulation,
+		GetLatestBlockNumFn:  getLatestBlockNumFn,
+		EnableRPCDiscover:    config.Server.EnableRPCDiscover,
+		ResponseProjections:  config.ResponseProjections,
+		ResponseTransforms:   config.ResponseTransforms,
+		KeepaliveInterval:    time.Duration(config.Server.KeepaliveInterval),
+		KeepaliveMethods:     config.Server.KeepaliveMethods,
+	})
 	if err != nil {
 		return nil, nil, fmt.Errorf("error creating server: %w", err)
 	}
+	audit, err := NewAuditLog(config.AuditLog)
+	if err != nil {
+		return nil, nil, err
+	}
+	if audit != nil {
+		audit.Start()
+	}
+	for _, opt := range opts {
+		opt(srv)
+	}
+	for secret, current := range authSecrets {
+		current := current
+		watchSecret(secret, func(rotated string) {
+			srv.RotateAuthSecret(current, rotated)
+			current = rotated
+		})
+	}
 
+	ConfigureBackendMethodMetrics(config.Metrics.BackendMethods)
 	if config.Metrics.Enabled {
 		addr := fmt.Sprintf("%s:%d", config.Metrics.Host, config.Metrics.Port)
 		log.Info("starting metrics server", "addr", addr)
@@ -276,6 +628,11 @@ func Start(config *Config) (*Server, func(), error) {
 		}()
 	}
 
+	if config.Cache.Enabled && config.Cache.Warmup.Enabled {
+		log.Info("warming cache")
+		srv.WarmCache(context.Background(), config.Cache.Warmup)
+	}
+
 	// To allow integration tests to cleanly come up, wait
 	// 10ms to give the below goroutines enough time to
 	// encounter an error creating their servers
@@ -293,6 +650,18 @@ func Start(config *Config) (*Server, func(), error) {
 		}()
 	}
 
+	if config.Admin.Port != 0 {
+		go func() {
+			if err := srv.AdminListenAndServe(config.Admin.Host, config.Admin.Port, adminToken); err != nil {
+				if errors.Is(err, http.ErrServerClosed) {
+					log.Info("admin server shut down")
+					return
+				}
+				log.Crit("error starting admin server", "err", err)
+			}
+		}()
+	}
+
 	if config.Server.WSPort != 0 {
 		go func() {
 			if err := srv.WSListenAndServe(config.Server.WSHost, config.Server.WSPort); err != nil {
@@ -333,6 +702,13 @@ func Start(config *Config) (*Server, func(), error) {
 				copts = append(copts, WithMaxBlockRange(bgcfg.ConsensusMaxBlockRange))
 			}
 
+			if autoConfirmations != nil && bgName == config.Cache.AutoConfirmationsGroup {
+				copts = append(copts, WithAutoConfirmations(autoConfirmations))
+			}
+			if bg == wsBackendGroup && srv.wsMux != nil && config.WSMultiplex.ConsensusHeads {
+				copts = append(copts, WithHeadListener(srv.wsMux.serveConsensusHeads(bg)))
+			}
+
 			var tracker ConsensusTracker
 			if bgcfg.ConsensusHA {
 				if redisClient == nil {
@@ -361,9 +737,21 @@ func Start(config *Config) (*Server, func(), error) {
 	<-errTimer.C
 	log.Info("started proxyd")
 
+	for _, lvc := range lvcs {
+		lvc.Start()
+	}
+	secretStore.Start()
+
 	shutdownFunc := func() {
 		log.Info("shutting down proxyd")
+		for _, lvc := range lvcs {
+			lvc.Stop()
+		}
+		secretStore.Stop()
 		srv.Shutdown()
+		if audit != nil {
+			audit.Stop()
+		}
 		log.Info("goodbye")
 	}
 
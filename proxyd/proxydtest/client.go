@@ -0,0 +1,204 @@
+package proxydtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+)
+
+// HTTPClient sends RPC requests to proxyd over HTTP.
+type HTTPClient struct {
+	url     string
+	headers http.Header
+}
+
+func NewHTTPClient(url string) *HTTPClient {
+	return NewHTTPClientWithHeaders(url, make(http.Header))
+}
+
+func NewHTTPClientWithHeaders(url string, headers http.Header) *HTTPClient {
+	clonedHeaders := headers.Clone()
+	clonedHeaders.Set("Content-Type", "application/json")
+	return &HTTPClient{
+		url:     url,
+		headers: clonedHeaders,
+	}
+}
+
+func (p *HTTPClient) SendRPC(method string, params []interface{}) ([]byte, int, error) {
+	rpcReq := NewRPCReq("999", method, params)
+	body, err := json.Marshal(rpcReq)
+	if err != nil {
+		panic(err)
+	}
+	return p.SendRequest(body)
+}
+
+func (p *HTTPClient) SendBatchRPC(reqs ...*proxyd.RPCReq) ([]byte, int, error) {
+	body, err := json.Marshal(reqs)
+	if err != nil {
+		panic(err)
+	}
+	return p.SendRequest(body)
+}
+
+func (p *HTTPClient) SendRequest(body []byte) ([]byte, int, error) {
+	resBody, code, _, err := p.SendRequestWithHeaders(body)
+	return resBody, code, err
+}
+
+func (p *HTTPClient) SendRPCWithHeaders(method string, params []interface{}) ([]byte, int, http.Header, error) {
+	rpcReq := NewRPCReq("999", method, params)
+	body, err := json.Marshal(rpcReq)
+	if err != nil {
+		panic(err)
+	}
+	return p.SendRequestWithHeaders(body)
+}
+
+func (p *HTTPClient) SendRequestWithHeaders(body []byte) ([]byte, int, http.Header, error) {
+	req, err := http.NewRequest("POST", p.url, bytes.NewReader(body))
+	if err != nil {
+		panic(err)
+	}
+	req.Header = p.headers
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, -1, nil, err
+	}
+	defer res.Body.Close()
+	code := res.StatusCode
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		panic(err)
+	}
+	return resBody, code, res.Header, nil
+}
+
+// RequireEqualJSON asserts that expected and actual are equivalent JSON documents.
+func RequireEqualJSON(t testing.TB, expected []byte, actual []byte) {
+	expJSON := canonicalizeJSON(t, expected)
+	actJSON := canonicalizeJSON(t, actual)
+	require.Equal(t, string(expJSON), string(actJSON))
+}
+
+func canonicalizeJSON(t testing.TB, in []byte) []byte {
+	var any interface{}
+	if in[0] == '[' {
+		any = make([]interface{}, 0)
+	} else {
+		any = make(map[string]interface{})
+	}
+
+	err := json.Unmarshal(in, &any)
+	require.NoError(t, err)
+	out, err := json.Marshal(any)
+	require.NoError(t, err)
+	return out
+}
+
+// ReadConfig reads the proxyd config at path.
+func ReadConfig(path string) (*proxyd.Config, error) {
+	config := new(proxyd.Config)
+	if _, err := toml.DecodeFile(path, config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// NewRPCReq creates an RPC request with the given ID, method and params.
+func NewRPCReq(id string, method string, params []interface{}) *proxyd.RPCReq {
+	jsonParams, err := json.Marshal(params)
+	if err != nil {
+		panic(err)
+	}
+
+	return &proxyd.RPCReq{
+		JSONRPC: proxyd.JSONRPCVersion,
+		Method:  method,
+		Params:  jsonParams,
+		ID:      []byte(id),
+	}
+}
+
+// WSClient is a WS connection to proxyd that reports received messages to callbacks.
+type WSClient struct {
+	conn    *websocket.Conn
+	msgCB   WSClientOnMessage
+	closeCB WSClientOnClose
+}
+
+type WSMessage struct {
+	Type int
+	Body []byte
+}
+
+type (
+	WSClientOnMessage func(msgType int, data []byte)
+	WSClientOnClose   func(err error)
+)
+
+func NewWSClient(
+	url string,
+	msgCB WSClientOnMessage,
+	closeCB WSClientOnClose,
+) (*WSClient, error) {
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil) // nolint:bodyclose
+	if err != nil {
+		return nil, err
+	}
+
+	c := &WSClient{
+		conn:    conn,
+		msgCB:   msgCB,
+		closeCB: closeCB,
+	}
+	go c.readPump()
+	return c, nil
+}
+
+func (h *WSClient) readPump() {
+	for {
+		mType, msg, err := h.conn.ReadMessage()
+		if err != nil {
+			if h.closeCB != nil {
+				h.closeCB(err)
+			}
+			return
+		}
+		if h.msgCB != nil {
+			h.msgCB(mType, msg)
+		}
+	}
+}
+
+// Conn returns the underlying WS connection.
+func (h *WSClient) Conn() *websocket.Conn {
+	return h.conn
+}
+
+func (h *WSClient) HardClose() {
+	h.conn.Close()
+}
+
+func (h *WSClient) SoftClose() error {
+	return h.WriteMessage(websocket.CloseMessage, nil)
+}
+
+func (h *WSClient) WriteMessage(msgType int, msg []byte) error {
+	return h.conn.WriteMessage(msgType, msg)
+}
+
+func (h *WSClient) WriteControlMessage(msgType int, msg []byte) error {
+	return h.conn.WriteControl(msgType, msg, time.Now().Add(time.Minute))
+}
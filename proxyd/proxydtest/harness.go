@@ -0,0 +1,97 @@
+package proxydtest
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/alicebob/miniredis"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+)
+
+// Harness is an in-process proxyd instance serving a config under test.
+type Harness struct {
+	Server *proxyd.Server
+	Config *proxyd.Config
+	RPCURL string
+	WSURL  string
+}
+
+// Start runs proxyd with config until the end of the test. Unset RPC and WS
+// ports are replaced with free ones, the WS server is only started if the
+// config defines a WS backend group.
+func Start(t testing.TB, config *proxyd.Config) *Harness {
+	t.Helper()
+
+	if config.Server.RPCHost == "" {
+		config.Server.RPCHost = "127.0.0.1"
+	}
+	if config.Server.RPCPort == 0 {
+		config.Server.RPCPort = freePort(t)
+	}
+	if config.WSBackendGroup != "" {
+		if config.Server.WSHost == "" {
+			config.Server.WSHost = "127.0.0.1"
+		}
+		if config.Server.WSPort == 0 {
+			config.Server.WSPort = freePort(t)
+		}
+	}
+
+	srv, shutdown, err := proxyd.Start(config)
+	require.NoError(t, err)
+	t.Cleanup(shutdown)
+
+	h := &Harness{
+		Server: srv,
+		Config: config,
+		RPCURL: fmt.Sprintf("http://%s", net.JoinHostPort(config.Server.RPCHost, fmt.Sprint(config.Server.RPCPort))),
+	}
+	if config.Server.WSPort != 0 {
+		h.WSURL = fmt.Sprintf("ws://%s", net.JoinHostPort(config.Server.WSHost, fmt.Sprint(config.Server.WSPort)))
+	}
+	return h
+}
+
+// HTTPClient returns a client sending requests to the RPC server of the harness.
+func (h *Harness) HTTPClient() *HTTPClient {
+	return NewHTTPClient(h.RPCURL)
+}
+
+// WSClient connects to the WS server of the harness.
+func (h *Harness) WSClient(msgCB WSClientOnMessage, closeCB WSClientOnClose) (*WSClient, error) {
+	return NewWSClient(h.WSURL, msgCB, closeCB)
+}
+
+// StartRedis runs an in-process Redis until the end of the test, and points
+// config at it.
+func StartRedis(t testing.TB, config *proxyd.Config) *miniredis.Miniredis {
+	t.Helper()
+
+	redis, err := miniredis.Run()
+	require.NoError(t, err)
+	t.Cleanup(redis.Close)
+
+	config.Redis.URL = fmt.Sprintf("redis://%s", redis.Addr())
+	return redis
+}
+
+// StartMockBackend runs a mock backend served by handler until the end of the
+// test.
+func StartMockBackend(t testing.TB, handler http.Handler) *MockBackend {
+	t.Helper()
+
+	mb := NewMockBackend(handler)
+	t.Cleanup(mb.Close)
+	return mb
+}
+
+func freePort(t testing.TB) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
@@ -0,0 +1,42 @@
+package proxydtest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ethereum-optimism/optimism/proxyd"
+)
+
+func TestHarness(t *testing.T) {
+	router := NewBatchRPCResponseRouter()
+	router.SetFallbackRoute("eth_chainId", "0x420")
+	backend := StartMockBackend(t, router)
+
+	config := &proxyd.Config{
+		Backends: proxyd.BackendsConfig{
+			"good": {RPCURL: backend.URL()},
+		},
+		BackendGroups: proxyd.BackendGroupsConfig{
+			"main": {Backends: []string{"good"}},
+		},
+		RPCMethodMappings: map[string]string{
+			"eth_chainId": "main",
+		},
+		Cache: proxyd.CacheConfig{Enabled: true},
+	}
+	redis := StartRedis(t, config)
+	h := Start(t, config)
+
+	client := h.HTTPClient()
+	for i := 0; i < 2; i++ {
+		res, code, err := client.SendRPC("eth_chainId", nil)
+		require.NoError(t, err)
+		require.Equal(t, 200, code)
+		RequireEqualJSON(t, []byte(`{"jsonrpc":"2.0","result":"0x420","id":999}`), res)
+	}
+
+	// the second request is served from the Redis cache
+	require.Equal(t, 1, len(backend.Requests()))
+	require.NotEmpty(t, redis.Keys())
+}
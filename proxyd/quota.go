@@ -0,0 +1,230 @@
+package proxyd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/gorilla/mux"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	QuotaPeriodDaily   = "daily"
+	QuotaPeriodMonthly = "monthly"
+
+	QuotaUnitRequests     = "requests"
+	QuotaUnitComputeUnits = "compute_units"
+)
+
+// ErrQuotaExceeded is returned once the quota of an auth key is used up. Its
+// data is the time at which the quota resets.
+func ErrQuotaExceeded(period string, reset time.Time) *RPCErr {
+	return &RPCErr{
+		Code:          JSONRPCErrorInternal - 23,
+		Message:       fmt.Sprintf("%s quota exceeded", period),
+		Data:          reset.UTC().Format(time.RFC3339),
+		HTTPErrorCode: 429,
+	}
+}
+
+// quota is a number of RPC calls, or compute units, allowed per period.
+type quota struct {
+	period string
+	unit   string
+	limit  int64
+}
+
+// QuotaUsage is the usage of a quota of an auth key in its current window.
+type QuotaUsage struct {
+	Period    string    `json:"period"`
+	Unit      string    `json:"unit"`
+	Limit     int64     `json:"limit"`
+	Used      int64     `json:"used"`
+	Remaining int64     `json:"remaining"`
+	ResetsAt  time.Time `json:"resets_at"`
+}
+
+// quotaWindow returns the name of the window of period holding now, and the
+// time at which it ends. Windows are aligned on UTC days and months.
+func quotaWindow(period string, now time.Time) (string, time.Time) {
+	now = now.UTC()
+	if period == QuotaPeriodMonthly {
+		start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return start.Format("2006-01"), start.AddDate(0, 1, 0)
+	}
+	start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	return start.Format("2006-01-02"), start.AddDate(0, 0, 1)
+}
+
+// QuotaTracker counts the RPC calls of auth keys against their quotas. Counts
+// are shared by proxyd instances through Redis, one key per auth key and
+// window, expiring at the end of the window.
+type QuotaTracker struct {
+	r         redis.UniversalClient
+	namespace string
+}
+
+func NewQuotaTracker(r redis.UniversalClient, namespace string) *QuotaTracker {
+	return &QuotaTracker{r: r, namespace: namespace}
+}
+
+// Take counts calls RPC calls costing units compute units of the auth key
+// alias. If a quota is exceeded, it returns the error to send to the client
+// and the time the quota resets.
+func (q *QuotaTracker) Take(ctx context.Context, alias string, quotas []quota, calls int, units int) (*RPCErr, time.Time, error) {
+	now := time.Now()
+	resets := make([]time.Time, len(quotas))
+	incrs := make([]*redis.IntCmd, len(quotas))
+	_, err := q.r.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, qu := range quotas {
+			window, reset := quotaWindow(qu.period, now)
+			key := q.key(alias, qu, window)
+			resets[i] = reset
+			n := calls
+			if qu.unit == QuotaUnitComputeUnits {
+				n = units
+			}
+			incrs[i] = pipe.IncrBy(ctx, key, int64(n))
+			pipe.ExpireAt(ctx, key, reset)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	for i, qu := range quotas {
+		if incrs[i].Val() > qu.limit {
+			RecordQuotaExceeded(alias, qu.period)
+			return ErrQuotaExceeded(qu.period, resets[i]), resets[i], nil
+		}
+	}
+	return nil, time.Time{}, nil
+}
+
+// Usage returns the usage of the quotas of the auth key alias in their
+// current windows.
+func (q *QuotaTracker) Usage(ctx context.Context, alias string, quotas []quota) ([]*QuotaUsage, error) {
+	now := time.Now()
+	usages := make([]*QuotaUsage, len(quotas))
+	gets := make([]*redis.StringCmd, len(quotas))
+	_, err := q.r.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, qu := range quotas {
+			window, reset := quotaWindow(qu.period, now)
+			usages[i] = &QuotaUsage{
+				Period:   qu.period,
+				Unit:     qu.unit,
+				Limit:    qu.limit,
+				ResetsAt: reset,
+			}
+			gets[i] = pipe.Get(ctx, q.key(alias, qu, window))
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	for i, usage := range usages {
+		used, err := gets[i].Int64()
+		if err != nil && err != redis.Nil {
+			return nil, err
+		}
+		usage.Used = used
+		if usage.Remaining = usage.Limit - used; usage.Remaining < 0 {
+			usage.Remaining = 0
+		}
+	}
+	return usages, nil
+}
+
+// key returns the Redis key of the count of qu in window. Compute unit
+// quotas are counted apart, so that changing the unit of a key starts afresh.
+func (q *QuotaTracker) key(alias string, qu quota, window string) string {
+	prefix := "quota"
+	if qu.unit == QuotaUnitComputeUnits {
+		prefix = "cu_quota"
+	}
+	key := fmt.Sprintf("%s:%s:%s:%s", prefix, alias, qu.period, window)
+	if q.namespace != "" {
+		key = q.namespace + ":" + key
+	}
+	return key
+}
+
+// takeQuota counts the RPC calls of reqs against the quotas of the auth key
+// of ctx, and writes the error response if one is exceeded. It returns
+// whether the request can be served, and records the usage of the key if so.
+func (s *Server) takeQuota(ctx context.Context, w http.ResponseWriter, routing *routingConfig, policy *authKeyPolicy, reqs []json.RawMessage) bool {
+	units := s.computeUnits.cost(reqs)
+	if policy == nil || len(policy.quotas) == 0 {
+		RecordAuthUsage(GetAuthCtx(ctx), len(reqs), units)
+		return true
+	}
+	rpcErr, reset, err := s.quotaTracker.Take(ctx, GetAuthCtx(ctx), policy.quotas, len(reqs), units)
+	if err != nil {
+		log.Warn("error taking quota", "auth", GetAuthCtx(ctx), "req_id", GetReqID(ctx), "err", err)
+		switch routing.rateLimitConfig.RedisFailureMode {
+		case RedisFailureModeOpen, RedisFailureModeLocal:
+			RecordAuthUsage(GetAuthCtx(ctx), len(reqs), units)
+			return true
+		}
+		writeRPCError(ctx, w, nil, ErrInternal)
+		return false
+	}
+	if rpcErr != nil {
+		w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(reset).Seconds())+1))
+		RecordAuthRejection(GetAuthCtx(ctx), AuthRejectionQuota)
+		RecordRPCError(ctx, BackendProxyd, MethodUnknown, rpcErr)
+		writeRPCError(ctx, w, nil, rpcErr)
+		return false
+	}
+	RecordAuthUsage(GetAuthCtx(ctx), len(reqs), units)
+	return true
+}
+
+// AuthKeyUsage is the usage of an auth key in the current windows of its
+// quotas.
+type AuthKeyUsage struct {
+	Alias  string        `json:"alias"`
+	Quotas []*QuotaUsage `json:"quotas"`
+}
+
+// HandleUsage responds with the usage of the auth key of the request.
+func (s *Server) HandleUsage(w http.ResponseWriter, r *http.Request) {
+	ctx := s.populateContext(w, r)
+	if ctx == nil {
+		return
+	}
+	alias, ok := ctx.Value(ContextKeyAuth).(string)
+	if !ok {
+		http.Error(w, "authentication is not enabled", http.StatusNotFound)
+		return
+	}
+	s.writeUsage(w, r, alias)
+}
+
+// HandleAuthKeyUsage responds with the usage of the auth key of the alias
+// path variable.
+func (s *Server) HandleAuthKeyUsage(w http.ResponseWriter, r *http.Request) {
+	s.writeUsage(w, r, mux.Vars(r)["alias"])
+}
+
+func (s *Server) writeUsage(w http.ResponseWriter, r *http.Request, alias string) {
+	usage := &AuthKeyUsage{Alias: alias, Quotas: []*QuotaUsage{}}
+	if policy := s.authKeyPolicies[alias]; policy != nil && len(policy.quotas) > 0 {
+		quotas, err := s.quotaTracker.Usage(r.Context(), alias, policy.quotas)
+		if err != nil {
+			log.Error("error reading quota usage", "auth", alias, "err", err)
+			http.Error(w, "error reading usage", http.StatusServiceUnavailable)
+			return
+		}
+		usage.Quotas = quotas
+	}
+	writeAdminJSON(w, usage)
+}
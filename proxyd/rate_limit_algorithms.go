@@ -0,0 +1,340 @@
+package proxyd
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// RateLimitAlgorithmFixedWindow allows max requests per interval aligned
+	// window. Clients can send up to twice max requests around the boundary of
+	// two windows.
+	RateLimitAlgorithmFixedWindow = "fixed_window"
+	// RateLimitAlgorithmSlidingWindow allows max requests per interval ending
+	// now. The requests of the previous window are weighted by how much it
+	// overlaps this interval, as the sliding window counter pattern.
+	RateLimitAlgorithmSlidingWindow = "sliding_window"
+	// RateLimitAlgorithmTokenBucket refills max tokens per interval in a
+	// bucket of max tokens, each request taking one. Clients can burst up to
+	// max requests, and then send max requests per interval evenly.
+	RateLimitAlgorithmTokenBucket = "token_bucket"
+)
+
+func validateRateLimitAlgorithm(algorithm string) error {
+	switch algorithm {
+	case "", RateLimitAlgorithmFixedWindow, RateLimitAlgorithmSlidingWindow, RateLimitAlgorithmTokenBucket:
+		return nil
+	default:
+		return fmt.Errorf("invalid rate limit algorithm %s", algorithm)
+	}
+}
+
+func newMemoryRateLimiter(algorithm string, dur time.Duration, max int) FrontendRateLimiter {
+	switch algorithm {
+	case RateLimitAlgorithmSlidingWindow:
+		return NewMemorySlidingWindowRateLimiter(dur, max)
+	case RateLimitAlgorithmTokenBucket:
+		return NewMemoryTokenBucketRateLimiter(dur, max)
+	default:
+		return NewMemoryFrontendRateLimit(dur, max)
+	}
+}
+
+func newRedisRateLimiter(algorithm string, r redis.UniversalClient, dur time.Duration, max int, prefix string) FrontendRateLimiter {
+	switch algorithm {
+	case RateLimitAlgorithmSlidingWindow:
+		return NewRedisSlidingWindowRateLimiter(r, dur, max, prefix)
+	case RateLimitAlgorithmTokenBucket:
+		return NewRedisTokenBucketRateLimiter(r, dur, max, prefix)
+	default:
+		return NewRedisFrontendRateLimiter(r, dur, max, prefix)
+	}
+}
+
+// slidingWindowCount returns the estimated number of requests in the interval
+// ending at now, from the counts of the current and previous windows.
+func slidingWindowCount(prev, curr int64, now time.Time, dur time.Duration) float64 {
+	elapsed := now.Sub(now.Truncate(dur))
+	weight := 1 - float64(elapsed)/float64(dur)
+	return float64(prev)*weight + float64(curr)
+}
+
+func slidingWindowStatus(max int, count float64, now time.Time, dur time.Duration) *RateLimitStatus {
+	remaining := max - int(math.Ceil(count))
+	if remaining < 0 {
+		remaining = 0
+	}
+	return &RateLimitStatus{
+		Limit:     max,
+		Remaining: remaining,
+		Reset:     now.Truncate(dur).Add(dur),
+	}
+}
+
+// MemorySlidingWindowRateLimiter is a sliding window rate limiter storing the
+// counts of the current and previous windows in local memory. Unlike the fixed
+// window limiters, rejected requests are not counted.
+type MemorySlidingWindowRateLimiter struct {
+	dur time.Duration
+	max int
+
+	mtx    sync.Mutex
+	currTS time.Time
+	curr   map[string]int64
+	prev   map[string]int64
+}
+
+func NewMemorySlidingWindowRateLimiter(dur time.Duration, max int) FrontendRateLimiter {
+	return &MemorySlidingWindowRateLimiter{
+		dur:  dur,
+		max:  max,
+		curr: make(map[string]int64),
+		prev: make(map[string]int64),
+	}
+}
+
+func (m *MemorySlidingWindowRateLimiter) Take(ctx context.Context, key string) (bool, error) {
+	ok, _, err := m.TakeStatus(ctx, key)
+	return ok, err
+}
+
+func (m *MemorySlidingWindowRateLimiter) TakeStatus(ctx context.Context, key string) (bool, *RateLimitStatus, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	now := time.Now()
+	ts := now.Truncate(m.dur)
+	if !ts.Equal(m.currTS) {
+		if ts.Sub(m.currTS) == m.dur {
+			m.prev = m.curr
+		} else {
+			m.prev = make(map[string]int64)
+		}
+		m.curr = make(map[string]int64)
+		m.currTS = ts
+	}
+
+	count := slidingWindowCount(m.prev[key], m.curr[key], now, m.dur)
+	if count+1 > float64(m.max) {
+		return false, slidingWindowStatus(m.max, count, now, m.dur), nil
+	}
+	m.curr[key]++
+	return true, slidingWindowStatus(m.max, count+1, now, m.dur), nil
+}
+
+// slidingWindowScript takes a request from the sliding window of the current
+// and previous window keys, unless it is over the limit.
+var slidingWindowScript = redis.NewScript(`
+local prev = tonumber(redis.call('GET', KEYS[1]) or '0')
+local curr = tonumber(redis.call('GET', KEYS[2]) or '0')
+local count = prev * tonumber(ARGV[2]) + curr
+if count + 1 > tonumber(ARGV[1]) then
+	return {0, tostring(count)}
+end
+redis.call('INCR', KEYS[2])
+redis.call('PEXPIRE', KEYS[2], ARGV[3])
+return {1, tostring(count + 1)}
+`)
+
+// RedisSlidingWindowRateLimiter is a sliding window rate limiter storing the
+// counts of windows in Redis. The keys of a rate limit key share a hash tag,
+// so that they are stored on the same node of a Redis Cluster.
+type RedisSlidingWindowRateLimiter struct {
+	r      redis.UniversalClient
+	dur    time.Duration
+	max    int
+	prefix string
+}
+
+func NewRedisSlidingWindowRateLimiter(r redis.UniversalClient, dur time.Duration, max int, prefix string) FrontendRateLimiter {
+	return &RedisSlidingWindowRateLimiter{
+		r:      r,
+		dur:    dur,
+		max:    max,
+		prefix: prefix,
+	}
+}
+
+func (r *RedisSlidingWindowRateLimiter) Take(ctx context.Context, key string) (bool, error) {
+	ok, _, err := r.TakeStatus(ctx, key)
+	return ok, err
+}
+
+func (r *RedisSlidingWindowRateLimiter) TakeStatus(ctx context.Context, key string) (bool, *RateLimitStatus, error) {
+	now := time.Now()
+	ts := now.Truncate(r.dur)
+	weight := 1 - float64(now.Sub(ts))/float64(r.dur)
+	keys := []string{
+		fmt.Sprintf("rate_limit:{%s:%s}:%d", r.prefix, key, ts.Add(-r.dur).Unix()),
+		fmt.Sprintf("rate_limit:{%s:%s}:%d", r.prefix, key, ts.Unix()),
+	}
+	res, err := slidingWindowScript.Run(ctx, r.r, keys, r.max, weight, (2 * r.dur).Milliseconds()).Slice()
+	if err != nil {
+		frontendRateLimitTakeErrors.Inc()
+		return false, nil, err
+	}
+	ok, count, err := parseRateLimitScriptResult(res)
+	if err != nil {
+		return false, nil, err
+	}
+	return ok, slidingWindowStatus(r.max, count, now, r.dur), nil
+}
+
+// tokenBucket holds tokens refilled at a constant rate up to its capacity.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func tokenBucketStatus(max int, tokens float64, now time.Time, dur time.Duration) *RateLimitStatus {
+	// the time at which the next token is added, which is when a rejected
+	// request can be retried
+	var missing float64
+	if tokens < float64(max) {
+		missing = math.Floor(tokens) + 1 - tokens
+	}
+	return &RateLimitStatus{
+		Limit:     max,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     now.Add(time.Duration(missing / float64(max) * float64(dur))),
+	}
+}
+
+// MemoryTokenBucketRateLimiter is a token bucket rate limiter storing buckets
+// in local memory. Full buckets are evicted every interval.
+type MemoryTokenBucketRateLimiter struct {
+	dur time.Duration
+	max int
+
+	mtx       sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+func NewMemoryTokenBucketRateLimiter(dur time.Duration, max int) FrontendRateLimiter {
+	return &MemoryTokenBucketRateLimiter{
+		dur:       dur,
+		max:       max,
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+func (m *MemoryTokenBucketRateLimiter) Take(ctx context.Context, key string) (bool, error) {
+	ok, _, err := m.TakeStatus(ctx, key)
+	return ok, err
+}
+
+func (m *MemoryTokenBucketRateLimiter) TakeStatus(ctx context.Context, key string) (bool, *RateLimitStatus, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	now := time.Now()
+	if now.Sub(m.lastSweep) > m.dur {
+		for k, b := range m.buckets {
+			if now.Sub(b.last) >= m.dur {
+				delete(m.buckets, k)
+			}
+		}
+		m.lastSweep = now
+	}
+
+	b := m.buckets[key]
+	if b == nil {
+		b = &tokenBucket{tokens: float64(m.max), last: now}
+		m.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(m.max), b.tokens+float64(m.max)*float64(now.Sub(b.last))/float64(m.dur))
+	b.last = now
+	if b.tokens < 1 {
+		return false, tokenBucketStatus(m.max, b.tokens, now, m.dur), nil
+	}
+	b.tokens--
+	return true, tokenBucketStatus(m.max, b.tokens, now, m.dur), nil
+}
+
+// tokenBucketScript refills the bucket of a key and takes a token from it.
+// The time is passed by the caller, so that the script is deterministic.
+var tokenBucketScript = redis.NewScript(`
+local max = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(bucket[1]) or max
+local ts = tonumber(bucket[2]) or now
+if now > ts then
+	tokens = math.min(max, tokens + (now - ts) * rate)
+else
+	now = ts
+end
+local ok = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	ok = 1
+end
+redis.call('HMSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(now))
+redis.call('PEXPIRE', KEYS[1], ARGV[4])
+return {ok, tostring(tokens)}
+`)
+
+// RedisTokenBucketRateLimiter is a token bucket rate limiter storing buckets
+// in Redis. Buckets expire once full.
+type RedisTokenBucketRateLimiter struct {
+	r      redis.UniversalClient
+	dur    time.Duration
+	max    int
+	prefix string
+}
+
+func NewRedisTokenBucketRateLimiter(r redis.UniversalClient, dur time.Duration, max int, prefix string) FrontendRateLimiter {
+	return &RedisTokenBucketRateLimiter{
+		r:      r,
+		dur:    dur,
+		max:    max,
+		prefix: prefix,
+	}
+}
+
+func (r *RedisTokenBucketRateLimiter) Take(ctx context.Context, key string) (bool, error) {
+	ok, _, err := r.TakeStatus(ctx, key)
+	return ok, err
+}
+
+func (r *RedisTokenBucketRateLimiter) TakeStatus(ctx context.Context, key string) (bool, *RateLimitStatus, error) {
+	now := time.Now()
+	// tokens per millisecond
+	rate := float64(r.max) / float64(r.dur.Milliseconds())
+	fullKey := fmt.Sprintf("rate_limit:%s:%s:bucket", r.prefix, key)
+	res, err := tokenBucketScript.Run(ctx, r.r, []string{fullKey}, r.max, rate, now.UnixMilli(), r.dur.Milliseconds()).Slice()
+	if err != nil {
+		frontendRateLimitTakeErrors.Inc()
+		return false, nil, err
+	}
+	ok, tokens, err := parseRateLimitScriptResult(res)
+	if err != nil {
+		return false, nil, err
+	}
+	return ok, tokenBucketStatus(r.max, tokens, now, r.dur), nil
+}
+
+// parseRateLimitScriptResult parses the {ok, value} result of a rate limit
+// script. Values are returned as strings since Redis truncates Lua numbers to
+// integers.
+func parseRateLimitScriptResult(res []interface{}) (bool, float64, error) {
+	if len(res) != 2 {
+		return false, 0, fmt.Errorf("unexpected rate limit script result %v", res)
+	}
+	ok, _ := res[0].(int64)
+	str, _ := res[1].(string)
+	value, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return false, 0, fmt.Errorf("unexpected rate limit script result %v: %w", res, err)
+	}
+	return ok == 1, value, nil
+}
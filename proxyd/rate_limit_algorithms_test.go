@@ -0,0 +1,98 @@
+package proxyd
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlidingWindowCount(t *testing.T) {
+	start := time.Unix(0, 0).Add(10 * time.Second)
+	require.Equal(t, 10.0, slidingWindowCount(10, 0, start, 10*time.Second))
+	require.Equal(t, 7.5+2, slidingWindowCount(10, 2, start.Add(2500*time.Millisecond), 10*time.Second))
+	require.Equal(t, 1.0+2, slidingWindowCount(10, 2, start.Add(9*time.Second), 10*time.Second))
+}
+
+func TestRateLimitAlgorithms(t *testing.T) {
+	redisServer, err := miniredis.Run()
+	require.NoError(t, err)
+	defer redisServer.Close()
+	redisClient := redis.NewClient(&redis.Options{
+		Addr: fmt.Sprintf("127.0.0.1:%s", redisServer.Port()),
+	})
+
+	max := 3
+	ctx := context.Background()
+	limiters := map[string]FrontendRateLimiter{
+		"memory sliding window": NewMemorySlidingWindowRateLimiter(time.Hour, max),
+		"redis sliding window":  NewRedisSlidingWindowRateLimiter(redisClient, time.Hour, max, "sliding"),
+		"memory token bucket":   NewMemoryTokenBucketRateLimiter(time.Hour, max),
+		"redis token bucket":    NewRedisTokenBucketRateLimiter(redisClient, time.Hour, max, "bucket"),
+	}
+	for name, lim := range limiters {
+		t.Run(name, func(t *testing.T) {
+			for i := 0; i < max; i++ {
+				ok, status, err := takeRateLimit(ctx, lim, "foo")
+				require.NoError(t, err)
+				require.True(t, ok)
+				require.Equal(t, max, status.Limit)
+				require.Equal(t, max-i-1, status.Remaining)
+			}
+			ok, status, err := takeRateLimit(ctx, lim, "foo")
+			require.NoError(t, err)
+			require.False(t, ok)
+			require.Equal(t, 0, status.Remaining)
+			require.True(t, status.Reset.After(time.Now()))
+
+			ok, err = lim.Take(ctx, "bar")
+			require.NoError(t, err)
+			require.True(t, ok)
+		})
+	}
+
+	t.Run("sliding window weighs the previous window", func(t *testing.T) {
+		lim := NewMemorySlidingWindowRateLimiter(time.Hour, max).(*MemorySlidingWindowRateLimiter)
+		now := time.Now()
+		lim.currTS = now.Truncate(time.Hour).Add(-time.Hour)
+		// large enough for the weighted count to be over the limit until the
+		// last nanosecond of the window
+		lim.curr["foo"] = 1 << 50
+
+		// the previous window is over the limit for the whole window
+		ok, err := lim.Take(ctx, "foo")
+		require.NoError(t, err)
+		require.False(t, ok)
+		require.Equal(t, int64(1<<50), lim.prev["foo"])
+	})
+
+	t.Run("token buckets refill", func(t *testing.T) {
+		lim := NewMemoryTokenBucketRateLimiter(time.Hour, max).(*MemoryTokenBucketRateLimiter)
+		lim.buckets["foo"] = &tokenBucket{tokens: 0, last: time.Now().Add(-20 * time.Minute)}
+		ok, err := lim.Take(ctx, "foo")
+		require.NoError(t, err)
+		require.True(t, ok)
+		ok, status, err := lim.TakeStatus(ctx, "foo")
+		require.NoError(t, err)
+		require.False(t, ok)
+		// the next token is added in 20 minutes, rather than when the bucket
+		// is full again
+		require.WithinDuration(t, time.Now().Add(20*time.Minute), status.Reset, time.Minute)
+
+		key := "rate_limit:bucket:refill:bucket"
+		redisServer.HSet(key, "tokens", "0")
+		redisServer.HSet(key, "ts", strconv.FormatInt(time.Now().Add(-20*time.Minute).UnixMilli(), 10))
+		redisLim := NewRedisTokenBucketRateLimiter(redisClient, time.Hour, max, "bucket")
+		ok, err = redisLim.Take(ctx, "refill")
+		require.NoError(t, err)
+		require.True(t, ok)
+		ok, err = redisLim.Take(ctx, "refill")
+		require.NoError(t, err)
+		require.False(t, ok)
+	})
+}
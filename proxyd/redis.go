@@ -2,17 +2,76 @@ package proxyd
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
+	"sync"
 	"time"
 
+	"github.com/ethereum/go-ethereum/log"
 	"github.com/redis/go-redis/v9"
 )
 
-func NewRedisClient(url string) (*redis.Client, error) {
-	opts, err := redis.ParseURL(url)
-	if err != nil {
-		return nil, err
+// NewRedisClient connects to Redis as configured by config, url being the
+// URL of config read from the environment.
+//
+// In cluster mode, url is one of the seed nodes of a Redis Cluster, and more
+// seed nodes can be set with addr query parameters. With Sentinel, the client
+// asks the sentinels for the address of the master and follows failovers;
+// url, if set, only provides the credentials, database and TLS settings of
+// the master.
+func NewRedisClient(url string, config RedisConfig) (redis.UniversalClient, error) {
+	var client redis.UniversalClient
+	switch {
+	case config.Sentinel.MasterName != "":
+		if config.Cluster {
+			return nil, errors.New("redis sentinel cannot be used in cluster mode")
+		}
+		opts, err := newRedisFailoverOptions(url, config.Sentinel)
+		if err != nil {
+			return nil, err
+		}
+		err = configureRedisConn(config, redisConnOptions{
+			&opts.Username, &opts.Password, &opts.DB, &opts.TLSConfig,
+			&opts.PoolSize, &opts.ReadTimeout, &opts.WriteTimeout,
+		})
+		if err != nil {
+			return nil, err
+		}
+		client = redis.NewFailoverClient(opts)
+	case config.Cluster:
+		if config.Database != 0 {
+			return nil, errors.New("redis database cannot be set in cluster mode")
+		}
+		opts, err := redis.ParseClusterURL(url)
+		if err != nil {
+			return nil, err
+		}
+		err = configureRedisConn(config, redisConnOptions{
+			&opts.Username, &opts.Password, nil, &opts.TLSConfig,
+			&opts.PoolSize, &opts.ReadTimeout, &opts.WriteTimeout,
+		})
+		if err != nil {
+			return nil, err
+		}
+		client = redis.NewClusterClient(opts)
+	default:
+		opts, err := redis.ParseURL(url)
+		if err != nil {
+			return nil, err
+		}
+		err = configureRedisConn(config, redisConnOptions{
+			&opts.Username, &opts.Password, &opts.DB, &opts.TLSConfig,
+			&opts.PoolSize, &opts.ReadTimeout, &opts.WriteTimeout,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if isSecretRef(config.URL) || isSecretRef(config.Password) {
+			opts.CredentialsProvider = watchRedisCredentials(config, opts)
+		}
+		client = redis.NewClient(opts)
 	}
-	client := redis.NewClient(opts)
+	client.AddHook(newRedisBreaker(config.CircuitBreaker))
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	if err := client.Ping(ctx).Err(); err != nil {
@@ -20,3 +79,130 @@ func NewRedisClient(url string) (*redis.Client, error) {
 	}
 	return client, nil
 }
+
+func newRedisFailoverOptions(url string, config RedisSentinelConfig) (*redis.FailoverOptions, error) {
+	if len(config.Addrs) == 0 {
+		return nil, errors.New("redis sentinel requires at least one sentinel address")
+	}
+	password, err := ReadFromEnvOrConfig(config.Password)
+	if err != nil {
+		return nil, err
+	}
+	opts := &redis.FailoverOptions{
+		MasterName:       config.MasterName,
+		SentinelAddrs:    config.Addrs,
+		SentinelUsername: config.Username,
+		SentinelPassword: password,
+	}
+	if url == "" {
+		return opts, nil
+	}
+	master, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	opts.Username = master.Username
+	opts.Password = master.Password
+	opts.DB = master.DB
+	opts.TLSConfig = master.TLSConfig
+	return opts, nil
+}
+
+// redisConnOptions points to the connection options of the client of any
+// mode.
+type redisConnOptions struct {
+	username     *string
+	password     *string
+	db           *int
+	tlsConfig    **tls.Config
+	poolSize     *int
+	readTimeout  *time.Duration
+	writeTimeout *time.Duration
+}
+
+// configureRedisConn overrides the connection options parsed from the URL by
+// the ones set in config.
+func configureRedisConn(config RedisConfig, opts redisConnOptions) error {
+	if config.Username != "" {
+		*opts.username = config.Username
+	}
+	if config.Password != "" {
+		password, err := ReadFromEnvOrConfig(config.Password)
+		if err != nil {
+			return err
+		}
+		*opts.password = password
+	}
+	if config.Database != 0 && opts.db != nil {
+		*opts.db = config.Database
+	}
+	if config.PoolSize != 0 {
+		*opts.poolSize = config.PoolSize
+	}
+	if config.ReadTimeout != 0 {
+		*opts.readTimeout = time.Duration(config.ReadTimeout)
+	}
+	if config.WriteTimeout != 0 {
+		*opts.writeTimeout = time.Duration(config.WriteTimeout)
+	}
+
+	tlsCfg := config.TLS
+	if !tlsCfg.Enabled {
+		return nil
+	}
+	if *opts.tlsConfig == nil {
+		*opts.tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	if tlsCfg.CAFile != "" {
+		caConfig, err := CreateTLSClient(tlsCfg.CAFile)
+		if err != nil {
+			return err
+		}
+		(*opts.tlsConfig).RootCAs = caConfig.RootCAs
+	}
+	if tlsCfg.ClientCertFile != "" && tlsCfg.ClientKeyFile != "" {
+		cert, err := ParseKeyPair(tlsCfg.ClientCertFile, tlsCfg.ClientKeyFile)
+		if err != nil {
+			return err
+		}
+		(*opts.tlsConfig).Certificates = []tls.Certificate{cert}
+	}
+	return nil
+}
+
+// watchRedisCredentials returns the credentials provider of the standalone
+// client of opts, following the rotations of the URL and password secrets
+// of config. Addresses read from a rotated URL apply on restart.
+func watchRedisCredentials(config RedisConfig, opts *redis.Options) func() (string, string) {
+	var mtx sync.Mutex
+	username, password := opts.Username, opts.Password
+	watchSecret(config.URL, func(url string) {
+		rotated, err := redis.ParseURL(url)
+		if err != nil {
+			log.Error("error parsing rotated redis URL", "err", err)
+			return
+		}
+		if rotated.Addr != opts.Addr {
+			log.Warn("redis address changed, restart to apply it", "addr", rotated.Addr)
+		}
+		mtx.Lock()
+		defer mtx.Unlock()
+		// the username and password of the config override the URL ones
+		if config.Username == "" {
+			username = rotated.Username
+		}
+		if config.Password == "" {
+			password = rotated.Password
+		}
+	})
+	watchSecret(config.Password, func(rotated string) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		password = rotated
+	})
+	return func() (string, string) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		return username, password
+	}
+}
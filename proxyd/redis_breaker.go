@@ -0,0 +1,120 @@
+package proxyd
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultRedisBreakerThreshold = 5
+	defaultRedisBreakerCooldown  = 5 * time.Second
+)
+
+// ErrRedisUnavailable is returned by Redis commands while the circuit breaker
+// is open.
+var ErrRedisUnavailable = errors.New("redis is unavailable")
+
+// redisBreaker is a circuit breaker hooked into the Redis client. After
+// threshold consecutive failures, commands fail fast with ErrRedisUnavailable
+// instead of stalling requests, until cooldown elapsed. Commands are then let
+// through again, and the next failure opens the breaker for another cooldown.
+type redisBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mtx       sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+func newRedisBreaker(config RedisCircuitBreakerConfig) *redisBreaker {
+	b := &redisBreaker{
+		threshold: config.Threshold,
+		cooldown:  time.Duration(config.Cooldown),
+	}
+	if b.threshold == 0 {
+		b.threshold = defaultRedisBreakerThreshold
+	}
+	if b.cooldown == 0 {
+		b.cooldown = defaultRedisBreakerCooldown
+	}
+	RecordRedisUp(true)
+	return b
+}
+
+func (b *redisBreaker) allow() bool {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	return !time.Now().Before(b.openUntil)
+}
+
+func (b *redisBreaker) record(err error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if !isRedisUnavailable(err) {
+		if b.failures >= b.threshold {
+			log.Info("redis is available again")
+			RecordRedisUp(true)
+		}
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	now := time.Now()
+	if b.failures >= b.threshold && !now.Before(b.openUntil) {
+		log.Warn("redis is unavailable, opening the circuit breaker", "err", err, "cooldown", b.cooldown)
+		b.openUntil = now.Add(b.cooldown)
+		RecordRedisUp(false)
+		RecordRedisBreakerTrip()
+	}
+}
+
+// isRedisUnavailable reports whether err means Redis couldn't be reached, as
+// opposed to a missing key or an error returned by Redis.
+func isRedisUnavailable(err error) bool {
+	if err == nil || errors.Is(err, redis.Nil) {
+		return false
+	}
+	var redisErr redis.Error
+	return !errors.As(err, &redisErr)
+}
+
+func (b *redisBreaker) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+func (b *redisBreaker) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if !b.allow() {
+			cmd.SetErr(ErrRedisUnavailable)
+			return ErrRedisUnavailable
+		}
+		err := next(ctx, cmd)
+		b.record(err)
+		return err
+	}
+}
+
+func (b *redisBreaker) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		if !b.allow() {
+			for _, cmd := range cmds {
+				cmd.SetErr(ErrRedisUnavailable)
+			}
+			return ErrRedisUnavailable
+		}
+		err := next(ctx, cmds)
+		b.record(err)
+		return err
+	}
+}
@@ -0,0 +1,253 @@
+package proxyd
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	sw "github.com/ethereum-optimism/optimism/proxyd/pkg/avg-sliding-window"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	defaultReloadMaxErrorRateIncrease = 0.05
+	defaultReloadMinRequests          = 100
+	reloadErrorWindowBuckets          = 10
+)
+
+var ErrReloadInProgress = errors.New("a previous config reload is still being evaluated")
+
+// ConfigReloader applies reloaded method mappings and rate limits to a running
+// server in a red/black manner. The new config serves all traffic for an
+// evaluation window, after which its error rate is compared against the one
+// of the config it replaced. If the error rate increased by more than the
+// configured threshold, the previous config is restored. The baseline error
+// rate is measured over a window of the same length just before the swap, so
+// that past incidents don't mask a regression.
+type ConfigReloader struct {
+	srv                  *Server
+	evaluationWindow     time.Duration
+	maxErrorRateIncrease float64
+	minRequests          uint64
+	totalResponses       atomic.Uint64
+	errorResponses       atomic.Uint64
+	baseline             atomic.Pointer[reloadErrorWindow]
+	mtx                  sync.Mutex
+	evaluating           bool
+}
+
+// reloadErrorWindow tracks the recent requests and errors of the active
+// config.
+type reloadErrorWindow struct {
+	requests *sw.AvgSlidingWindow
+	errors   *sw.AvgSlidingWindow
+}
+
+func newReloadErrorWindow(length time.Duration) *reloadErrorWindow {
+	if length == 0 {
+		return &reloadErrorWindow{
+			requests: sw.NewSlidingWindow(),
+			errors:   sw.NewSlidingWindow(),
+		}
+	}
+	opts := []sw.SlidingWindowOpts{
+		sw.WithWindowLength(length),
+		sw.WithBucketSize(max(length/reloadErrorWindowBuckets, time.Millisecond)),
+	}
+	return &reloadErrorWindow{
+		requests: sw.NewSlidingWindow(opts...),
+		errors:   sw.NewSlidingWindow(opts...),
+	}
+}
+
+func (w *reloadErrorWindow) rate() float64 {
+	return errorRate(uint64(w.requests.Sum()), uint64(w.errors.Sum()))
+}
+
+func NewConfigReloader(srv *Server, config HotReloadConfig) *ConfigReloader {
+	maxErrorRateIncrease := defaultReloadMaxErrorRateIncrease
+	if config.MaxErrorRateIncrease > 0 {
+		maxErrorRateIncrease = config.MaxErrorRateIncrease
+	}
+	minRequests := uint64(defaultReloadMinRequests)
+	if config.MinRequests > 0 {
+		minRequests = uint64(config.MinRequests)
+	}
+	r := &ConfigReloader{
+		srv:                  srv,
+		evaluationWindow:     time.Duration(config.EvaluationWindow),
+		maxErrorRateIncrease: maxErrorRateIncrease,
+		minRequests:          minRequests,
+	}
+	r.baseline.Store(newReloadErrorWindow(r.evaluationWindow))
+	return r
+}
+
+// RecordResponses accounts the outcome of n requests towards the error rate of
+// the active config.
+func (r *ConfigReloader) RecordResponses(res []*RPCRes, n int, err error) {
+	errs := n
+	if err == nil {
+		errs = 0
+		for _, rr := range res {
+			if rr != nil && rr.IsError() {
+				errs++
+			}
+		}
+	}
+	r.totalResponses.Add(uint64(n))
+	r.errorResponses.Add(uint64(errs))
+	baseline := r.baseline.Load()
+	baseline.requests.Add(float64(n))
+	if errs > 0 {
+		baseline.errors.Add(float64(errs))
+	}
+}
+
+// Reload swaps the method mappings and rate limits of the server for the ones
+// in config. Other settings require a restart to take effect.
+func (r *ConfigReloader) Reload(config *Config) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if r.evaluating {
+		RecordConfigReload("rejected")
+		RecordAuditEvent(AuditEventConfigReload, "result", "rejected")
+		return ErrReloadInProgress
+	}
+
+	candidate, err := r.buildRoutingConfig(config)
+	if err != nil {
+		RecordConfigReload("failed")
+		RecordAuditEvent(AuditEventConfigReload, "result", "failed", "err", err.Error())
+		return err
+	}
+
+	total, errs := r.totalResponses.Load(), r.errorResponses.Load()
+	baselineRate := r.baseline.Load().rate()
+	previous := r.srv.routing.Swap(candidate)
+
+	if r.evaluationWindow == 0 {
+		RecordConfigReload("applied")
+		RecordAuditEvent(AuditEventConfigReload, "result", "applied")
+		log.Info("applied reloaded config")
+		return nil
+	}
+
+	log.Info(
+		"evaluating reloaded config",
+		"window", r.evaluationWindow,
+		"baseline_error_rate", baselineRate,
+	)
+	r.evaluating = true
+	time.AfterFunc(r.evaluationWindow, func() {
+		r.evaluate(candidate, previous, baselineRate, total, errs)
+	})
+	return nil
+}
+
+func (r *ConfigReloader) evaluate(candidate, previous *routingConfig, baselineRate float64, startTotal, startErrors uint64) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.evaluating = false
+
+	total, errs := r.totalResponses.Load(), r.errorResponses.Load()
+	candidateTotal := total - startTotal
+	candidateRate := errorRate(candidateTotal, errs-startErrors)
+
+	if candidateTotal >= r.minRequests && candidateRate-baselineRate > r.maxErrorRateIncrease {
+		r.srv.routing.CompareAndSwap(candidate, previous)
+		// the window covers the candidate, which must not become the baseline
+		r.baseline.Store(newReloadErrorWindow(r.evaluationWindow))
+		RecordConfigReload("rolled_back")
+		RecordAuditEvent(AuditEventConfigReload, "result", "rolled_back",
+			"baseline_error_rate", strconv.FormatFloat(baselineRate, 'f', 4, 64),
+			"error_rate", strconv.FormatFloat(candidateRate, 'f', 4, 64))
+		log.Warn(
+			"rolled back reloaded config",
+			"baseline_error_rate", baselineRate,
+			"error_rate", candidateRate,
+			"requests", candidateTotal,
+		)
+	} else {
+		RecordConfigReload("applied")
+		RecordAuditEvent(AuditEventConfigReload, "result", "applied")
+		log.Info(
+			"applied reloaded config",
+			"baseline_error_rate", baselineRate,
+			"error_rate", candidateRate,
+			"requests", candidateTotal,
+		)
+	}
+}
+
+func (r *ConfigReloader) buildRoutingConfig(config *Config) (*routingConfig, error) {
+	if len(config.RPCMethodMappings) == 0 {
+		return nil, errors.New("must define at least one RPC method mapping")
+	}
+	for _, bg := range config.RPCMethodMappings {
+		if r.srv.BackendGroups[bg] == nil {
+			return nil, fmt.Errorf("undefined backend group %s", bg)
+		}
+	}
+	if config.RateLimit.UseRedis && r.srv.redisClient == nil {
+		return nil, errors.New("must specify a Redis URL if UseRedis is true in rate limit config")
+	}
+
+	routing, err := newRoutingConfig(
+		config.RPCMethodMappings,
+		config.RateLimit,
+		newLimiterFactory(config.RateLimit, r.srv.redisClient, config.keyNamespace(config.Redis.Namespace)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if previous := r.srv.routing.Load(); previous != nil {
+		routing.carryOverLimiters(previous)
+	}
+	return routing, nil
+}
+
+// carryOverLimiters replaces the limiters of r by the ones of previous whose
+// config didn't change, so that reloads don't reset the counts of clients.
+func (r *routingConfig) carryOverLimiters(previous *routingConfig) {
+	cur, prev := r.rateLimitConfig, previous.rateLimitConfig
+	if cur.UseRedis != prev.UseRedis || cur.Algorithm != prev.Algorithm || cur.RedisFailureMode != prev.RedisFailureMode {
+		return
+	}
+	if cur.BaseRate == prev.BaseRate && cur.BaseInterval == prev.BaseInterval && cur.DryRun == prev.DryRun {
+		r.mainLim = previous.mainLim
+	}
+	for method, override := range cur.MethodOverrides {
+		if reflect.DeepEqual(override, prev.MethodOverrides[method]) {
+			r.overrideLims[method] = previous.overrideLims[method]
+		}
+	}
+	if cur.BaseInterval != prev.BaseInterval {
+		return
+	}
+	for _, o := range r.cidrOverrides {
+		for _, p := range previous.cidrOverrides {
+			if o.name == p.name && reflect.DeepEqual(cur.CIDROverrides[o.name], prev.CIDROverrides[p.name]) {
+				o.lim = p.lim
+			}
+		}
+	}
+}
+
+func errorRate(total, errs uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(errs) / float64(total)
+}
+
+// ReloadConfig applies the method mappings and rate limits of config to the
+// running server.
+func (s *Server) ReloadConfig(config *Config) error {
+	return s.reloader.Reload(config)
+}
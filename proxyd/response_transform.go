@@ -0,0 +1,176 @@
+package proxyd
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	ResponseTransformStrip      = "strip"
+	ResponseTransformKeep       = "keep"
+	ResponseTransformRename     = "rename"
+	ResponseTransformDefault    = "default"
+	ResponseTransformStripNulls = "strip_nulls"
+)
+
+// responseTransformFn returns the transformed copy of a result.
+type responseTransformFn func(result interface{}) interface{}
+
+// ResponseTransformer applies an ordered pipeline of transformations to the
+// results of methods served to all clients, e.g. so that the results of
+// heterogeneous backends are uniform. Unlike projections, they don't depend on
+// the client.
+type ResponseTransformer struct {
+	pipelines map[string][]responseTransformFn
+}
+
+func NewResponseTransformer(config map[string][]ResponseTransformConfig) (*ResponseTransformer, error) {
+	if len(config) == 0 {
+		return nil, nil
+	}
+	t := &ResponseTransformer{pipelines: make(map[string][]responseTransformFn, len(config))}
+	for method, steps := range config {
+		for i, step := range steps {
+			fn, err := newResponseTransformFn(step)
+			if err != nil {
+				return nil, fmt.Errorf("invalid response transform %d of %s: %w", i, method, err)
+			}
+			t.pipelines[method] = append(t.pipelines[method], fn)
+		}
+	}
+	return t, nil
+}
+
+func newResponseTransformFn(cfg ResponseTransformConfig) (responseTransformFn, error) {
+	switch cfg.Op {
+	case ResponseTransformStrip:
+		if len(cfg.Fields) == 0 {
+			return nil, fmt.Errorf("%s requires fields", cfg.Op)
+		}
+		var paths [][]string
+		for _, field := range cfg.Fields {
+			paths = append(paths, strings.Split(field, "."))
+		}
+		return func(result interface{}) interface{} {
+			for _, path := range paths {
+				result = projectPath(result, path, func(m map[string]interface{}, key string) {
+					delete(m, key)
+				})
+			}
+			return result
+		}, nil
+	case ResponseTransformKeep:
+		if len(cfg.Fields) == 0 {
+			return nil, fmt.Errorf("%s requires fields", cfg.Op)
+		}
+		kept := NewStringSetFromStrings(cfg.Fields)
+		return transformObjectsAt(cfg.Path, func(m map[string]interface{}) {
+			for key := range m {
+				if !kept.Has(key) {
+					delete(m, key)
+				}
+			}
+		}), nil
+	case ResponseTransformRename:
+		if cfg.Field == "" || cfg.To == "" {
+			return nil, fmt.Errorf("%s requires field and to", cfg.Op)
+		}
+		path := strings.Split(cfg.Field, ".")
+		return func(result interface{}) interface{} {
+			return projectPath(result, path, func(m map[string]interface{}, key string) {
+				if v, ok := m[key]; ok {
+					delete(m, key)
+					m[cfg.To] = v
+				}
+			})
+		}, nil
+	case ResponseTransformDefault:
+		if cfg.Field == "" || cfg.Value == nil {
+			return nil, fmt.Errorf("%s requires field and value", cfg.Op)
+		}
+		path := strings.Split(cfg.Field, ".")
+		return func(result interface{}) interface{} {
+			return projectPath(result, path, func(m map[string]interface{}, key string) {
+				if v, ok := m[key]; !ok || v == nil {
+					m[key] = cfg.Value
+				}
+			})
+		}, nil
+	case ResponseTransformStripNulls:
+		return transformObjectsAt(cfg.Path, func(m map[string]interface{}) {
+			for key, v := range m {
+				if v == nil {
+					delete(m, key)
+				}
+			}
+		}), nil
+	default:
+		return nil, fmt.Errorf("unknown op %q", cfg.Op)
+	}
+}
+
+// transformObjectsAt returns a transformation applying fn to copies of the
+// objects at path, the result itself if path is empty.
+func transformObjectsAt(path string, fn func(m map[string]interface{})) responseTransformFn {
+	apply := func(v interface{}) interface{} {
+		return mapObjects(v, fn)
+	}
+	if path == "" {
+		return apply
+	}
+	keys := strings.Split(path, ".")
+	return func(result interface{}) interface{} {
+		return projectPath(result, keys, func(m map[string]interface{}, key string) {
+			if v, ok := m[key]; ok {
+				m[key] = apply(v)
+			}
+		})
+	}
+}
+
+// mapObjects returns a copy of v, or of each element of v, to which fn is
+// applied. Other values are left as is.
+func mapObjects(v interface{}, fn func(m map[string]interface{})) interface{} {
+	switch v := v.(type) {
+	case []interface{}:
+		mapped := make([]interface{}, len(v))
+		for i, elem := range v {
+			mapped[i] = mapObjects(elem, fn)
+		}
+		return mapped
+	case map[string]interface{}:
+		mapped := make(map[string]interface{}, len(v))
+		for key, val := range v {
+			mapped[key] = val
+		}
+		fn(mapped)
+		return mapped
+	default:
+		return v
+	}
+}
+
+// Transform replaces the results of responses whose method, methods being the
+// methods of their requests, has transformations. As with projections,
+// results are copied rather than modified.
+func (t *ResponseTransformer) Transform(methods []string, responses []*RPCRes) {
+	if t == nil {
+		return
+	}
+	for i, res := range responses {
+		pipeline := t.pipelines[methods[i]]
+		if len(pipeline) == 0 || res == nil || res.IsError() || res.Result == nil {
+			continue
+		}
+		result := res.Result
+		for _, fn := range pipeline {
+			result = fn(result)
+		}
+		responses[i] = &RPCRes{
+			JSONRPC: res.JSONRPC,
+			Result:  result,
+			ID:      res.ID,
+		}
+		RecordResponseTransform(methods[i])
+	}
+}
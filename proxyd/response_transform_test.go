@@ -0,0 +1,58 @@
+package proxyd
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponseTransformer(t *testing.T) {
+	tr, err := NewResponseTransformer(map[string][]ResponseTransformConfig{
+		"eth_getBlockByNumber": {
+			{Op: ResponseTransformStrip, Fields: []string{"transactions.accessList"}},
+			{Op: ResponseTransformStripNulls, Path: "transactions"},
+			{Op: ResponseTransformRename, Field: "transactions.input", To: "data"},
+			{Op: ResponseTransformDefault, Field: "withdrawals", Value: []interface{}{}},
+			{Op: ResponseTransformKeep, Fields: []string{"number", "transactions", "withdrawals"}},
+		},
+	})
+	require.NoError(t, err)
+
+	var block interface{}
+	original := `{
+		"number": "0x1",
+		"l1BlockNumber": "0x2",
+		"transactions": [
+			{"hash": "0xa", "input": "0x", "accessList": [], "yParity": null},
+			{"hash": "0xb", "input": "0x01"}
+		]
+	}`
+	require.NoError(t, json.Unmarshal([]byte(original), &block))
+	blockRes := &RPCRes{JSONRPC: JSONRPCVersion, Result: block, ID: json.RawMessage("1")}
+	responses := []*RPCRes{
+		blockRes,
+		{JSONRPC: JSONRPCVersion, Result: "0x1", ID: json.RawMessage("2")},
+		NewRPCErrorRes(json.RawMessage("3"), ErrInternal),
+		nil,
+	}
+	methods := []string{"eth_getBlockByNumber", "eth_chainId", "eth_getBlockByNumber", ""}
+
+	tr.Transform(methods, responses)
+	require.JSONEq(t, `{"jsonrpc":"2.0","id":1,"result":{
+		"number": "0x1",
+		"transactions": [{"hash": "0xa", "data": "0x"}, {"hash": "0xb", "data": "0x01"}],
+		"withdrawals": []
+	}}`, string(mustMarshalJSON(responses[0])))
+	require.JSONEq(t, `{"jsonrpc":"2.0","id":2,"result":"0x1"}`, string(mustMarshalJSON(responses[1])))
+	require.True(t, responses[2].IsError())
+	require.Nil(t, responses[3])
+
+	// results may be shared, so they must not be modified
+	require.JSONEq(t, original, string(mustMarshalJSON(blockRes.Result)))
+
+	_, err = NewResponseTransformer(map[string][]ResponseTransformConfig{
+		"eth_getBlockByNumber": {{Op: "uppercase"}},
+	})
+	require.ErrorContains(t, err, `invalid response transform 0 of eth_getBlockByNumber: unknown op "uppercase"`)
+}
@@ -1,6 +1,7 @@
 package proxyd
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 
@@ -308,3 +309,54 @@ func rewriteTagBlockNumberOrHash(rctx RewriteContext, current *rpc.BlockNumberOr
 
 	return current, false, nil
 }
+
+// FinalityTags rewrites the safe and finalized tags of requests to the block
+// numbers tracked by last value caches, so that requests for these tags get
+// the same block from all backends, and are cacheable as pinned blocks.
+type FinalityTags struct {
+	getSafeBlockNumFn      GetBlockNumFn
+	getFinalizedBlockNumFn GetBlockNumFn
+}
+
+func NewFinalityTags(getSafeBlockNumFn, getFinalizedBlockNumFn GetBlockNumFn) *FinalityTags {
+	return &FinalityTags{
+		getSafeBlockNumFn:      getSafeBlockNumFn,
+		getFinalizedBlockNumFn: getFinalizedBlockNumFn,
+	}
+}
+
+// Rewrite replaces the safe or finalized tag of the block parameter of req
+// with its block number, if it is known. It reports whether req was modified.
+func (f *FinalityTags) Rewrite(ctx context.Context, req *RPCReq) bool {
+	pos, ok := blockParamPositions[req.Method]
+	if !ok {
+		return false
+	}
+	var p []json.RawMessage
+	if err := json.Unmarshal(req.Params, &p); err != nil || len(p) <= pos {
+		return false
+	}
+	var tag string
+	if err := json.Unmarshal(p[pos], &tag); err != nil {
+		return false
+	}
+
+	var getBlockNumFn GetBlockNumFn
+	switch tag {
+	case "safe":
+		getBlockNumFn = f.getSafeBlockNumFn
+	case "finalized":
+		getBlockNumFn = f.getFinalizedBlockNumFn
+	default:
+		return false
+	}
+	blockNum, err := getBlockNumFn(ctx)
+	if err != nil {
+		return false
+	}
+
+	p[pos] = mustMarshalJSON(hexutil.EncodeUint64(blockNum))
+	req.Params = mustMarshalJSON(p)
+	RecordFinalityTagRewrite(tag)
+	return true
+}
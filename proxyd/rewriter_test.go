@@ -1,6 +1,7 @@
 package proxyd
 
 import (
+	"context"
 	"encoding/json"
 	"strings"
 	"testing"
@@ -715,3 +716,34 @@ func TestRewriteResponse(t *testing.T) {
 		})
 	}
 }
+
+func TestFinalityTags(t *testing.T) {
+	ctx := context.Background()
+	getSafe := func(ctx context.Context) (uint64, error) { return 95, nil }
+	getFinalized := func(ctx context.Context) (uint64, error) { return 90, nil }
+	tags := NewFinalityTags(getSafe, getFinalized)
+
+	req := &RPCReq{Method: "eth_getBlockByNumber", Params: mustMarshalJSON([]interface{}{"finalized", false})}
+	require.True(t, tags.Rewrite(ctx, req))
+	require.Equal(t, `["0x5a",false]`, string(req.Params))
+
+	req = &RPCReq{Method: "eth_getBalance", Params: mustMarshalJSON([]string{"0x1", "safe"})}
+	require.True(t, tags.Rewrite(ctx, req))
+	require.Equal(t, `["0x1","0x5f"]`, string(req.Params))
+
+	for _, params := range []interface{}{
+		[]string{"0x1", "latest"},
+		[]string{"0x1", "0x10"},
+		[]interface{}{"0x1", map[string]string{"blockHash": "0xabc"}},
+		[]string{"0x1"},
+	} {
+		req = &RPCReq{Method: "eth_getBalance", Params: mustMarshalJSON(params)}
+		require.False(t, tags.Rewrite(ctx, req))
+		require.Equal(t, string(mustMarshalJSON(params)), string(req.Params))
+	}
+
+	// unknown heights are left to the backends
+	tags = NewFinalityTags(getSafe, func(ctx context.Context) (uint64, error) { return 0, errNoBlockNumber })
+	req = &RPCReq{Method: "eth_getBlockByNumber", Params: mustMarshalJSON([]interface{}{"finalized", false})}
+	require.False(t, tags.Rewrite(ctx, req))
+}
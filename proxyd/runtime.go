@@ -0,0 +1,129 @@
+package proxyd
+
+import (
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	defaultMemoryLimitRatio = 0.9
+	cgroupRoot              = "/sys/fs/cgroup"
+)
+
+// ConfigureRuntime applies the Go runtime settings of the server config. Settings
+// given through the GOMAXPROCS, GOGC and GOMEMLIMIT environment variables take
+// precedence over the defaults derived from the container limits, but not over
+// explicitly configured values.
+func ConfigureRuntime(config ServerConfig) {
+	if config.GOMAXPROCS > 0 {
+		runtime.GOMAXPROCS(config.GOMAXPROCS)
+	} else if os.Getenv("GOMAXPROCS") == "" {
+		if quota, err := cgroupCPUQuota(cgroupRoot); err == nil {
+			procs := int(math.Ceil(quota))
+			if procs < 1 {
+				procs = 1
+			}
+			if procs < runtime.NumCPU() {
+				runtime.GOMAXPROCS(procs)
+			}
+		}
+	}
+
+	if config.GCPercent != 0 {
+		debug.SetGCPercent(config.GCPercent)
+	}
+
+	if config.MemoryLimitBytes > 0 {
+		debug.SetMemoryLimit(config.MemoryLimitBytes)
+	} else if os.Getenv("GOMEMLIMIT") == "" {
+		ratio := defaultMemoryLimitRatio
+		if config.MemoryLimitRatio > 0 {
+			ratio = config.MemoryLimitRatio
+		}
+		if limit, err := cgroupMemoryLimit(cgroupRoot); err == nil {
+			debug.SetMemoryLimit(int64(float64(limit) * ratio))
+		}
+	}
+
+	log.Info(
+		"configured go runtime",
+		"gomaxprocs", runtime.GOMAXPROCS(0),
+		"gc_percent", config.GCPercent,
+		"memory_limit", debug.SetMemoryLimit(-1),
+	)
+}
+
+var errNoCgroupLimit = errors.New("no cgroup limit")
+
+// cgroupCPUQuota returns the number of CPUs the container is limited to.
+func cgroupCPUQuota(root string) (float64, error) {
+	// cgroup v2
+	if b, err := os.ReadFile(filepath.Join(root, "cpu.max")); err == nil {
+		fields := strings.Fields(string(b))
+		if len(fields) != 2 || fields[0] == "max" {
+			return 0, errNoCgroupLimit
+		}
+		return parseCPUQuota(fields[0], fields[1])
+	}
+
+	// cgroup v1
+	quota, err := os.ReadFile(filepath.Join(root, "cpu", "cpu.cfs_quota_us"))
+	if err != nil {
+		return 0, err
+	}
+	period, err := os.ReadFile(filepath.Join(root, "cpu", "cpu.cfs_period_us"))
+	if err != nil {
+		return 0, err
+	}
+	return parseCPUQuota(strings.TrimSpace(string(quota)), strings.TrimSpace(string(period)))
+}
+
+func parseCPUQuota(quota, period string) (float64, error) {
+	q, err := strconv.ParseFloat(quota, 64)
+	if err != nil {
+		return 0, err
+	}
+	p, err := strconv.ParseFloat(period, 64)
+	if err != nil {
+		return 0, err
+	}
+	if q <= 0 || p <= 0 {
+		return 0, errNoCgroupLimit
+	}
+	return q / p, nil
+}
+
+// cgroupMemoryLimit returns the memory limit of the container in bytes.
+func cgroupMemoryLimit(root string) (int64, error) {
+	// cgroup v2
+	b, err := os.ReadFile(filepath.Join(root, "memory.max"))
+	if err != nil {
+		// cgroup v1
+		b, err = os.ReadFile(filepath.Join(root, "memory", "memory.limit_in_bytes"))
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	val := strings.TrimSpace(string(b))
+	if val == "max" {
+		return 0, errNoCgroupLimit
+	}
+	limit, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	// cgroup v1 reports a near max int64 value when unlimited
+	if limit <= 0 || limit >= math.MaxInt64/2 {
+		return 0, errNoCgroupLimit
+	}
+	return limit, nil
+}
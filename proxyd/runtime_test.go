@@ -0,0 +1,75 @@
+package proxyd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCgroupLimits(t *testing.T) {
+	write := func(t *testing.T, root string, name string, content string) {
+		path := filepath.Join(root, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+
+	t.Run("cgroup v2", func(t *testing.T) {
+		root := t.TempDir()
+		write(t, root, "cpu.max", "250000 100000\n")
+		write(t, root, "memory.max", "1073741824\n")
+
+		quota, err := cgroupCPUQuota(root)
+		require.NoError(t, err)
+		require.Equal(t, 2.5, quota)
+		limit, err := cgroupMemoryLimit(root)
+		require.NoError(t, err)
+		require.EqualValues(t, 1073741824, limit)
+	})
+
+	t.Run("cgroup v2 unlimited", func(t *testing.T) {
+		root := t.TempDir()
+		write(t, root, "cpu.max", "max 100000\n")
+		write(t, root, "memory.max", "max\n")
+
+		_, err := cgroupCPUQuota(root)
+		require.ErrorIs(t, err, errNoCgroupLimit)
+		_, err = cgroupMemoryLimit(root)
+		require.ErrorIs(t, err, errNoCgroupLimit)
+	})
+
+	t.Run("cgroup v1", func(t *testing.T) {
+		root := t.TempDir()
+		write(t, root, "cpu/cpu.cfs_quota_us", "50000\n")
+		write(t, root, "cpu/cpu.cfs_period_us", "100000\n")
+		write(t, root, "memory/memory.limit_in_bytes", "536870912\n")
+
+		quota, err := cgroupCPUQuota(root)
+		require.NoError(t, err)
+		require.Equal(t, 0.5, quota)
+		limit, err := cgroupMemoryLimit(root)
+		require.NoError(t, err)
+		require.EqualValues(t, 536870912, limit)
+	})
+
+	t.Run("cgroup v1 unlimited", func(t *testing.T) {
+		root := t.TempDir()
+		write(t, root, "cpu/cpu.cfs_quota_us", "-1\n")
+		write(t, root, "cpu/cpu.cfs_period_us", "100000\n")
+		write(t, root, "memory/memory.limit_in_bytes", "9223372036854771712\n")
+
+		_, err := cgroupCPUQuota(root)
+		require.ErrorIs(t, err, errNoCgroupLimit)
+		_, err = cgroupMemoryLimit(root)
+		require.ErrorIs(t, err, errNoCgroupLimit)
+	})
+
+	t.Run("no cgroup", func(t *testing.T) {
+		root := t.TempDir()
+		_, err := cgroupCPUQuota(root)
+		require.Error(t, err)
+		_, err = cgroupMemoryLimit(root)
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,376 @@
+package proxyd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+const (
+	ScriptDecisionContinue = "continue"
+	ScriptDecisionReject   = "reject"
+	ScriptDecisionRoute    = "route"
+	ScriptDecisionRewrite  = "rewrite"
+	ScriptDecisionError    = "error"
+
+	scriptHandleFn = "handle"
+
+	defaultScriptTimeout         = 10 * time.Millisecond
+	defaultScriptCallStackSize   = 64
+	defaultScriptRegistryMaxSize = 64 * 1024
+	defaultScriptMaxParamsSize   = 64 * 1024
+)
+
+var ErrRejectedByScript = &RPCErr{
+	Code:          JSONRPCErrorInternal - 30,
+	Message:       "request rejected",
+	HTTPErrorCode: 403,
+}
+
+// scriptGlobals are the functions of the base library available to scripts,
+// along with the table, string and math libraries. The others give access to
+// the file system, the output or the garbage collector, or load code.
+var scriptGlobals = map[string]bool{
+	"assert":          true,
+	"error":           true,
+	"ipairs":          true,
+	"next":            true,
+	"pairs":           true,
+	"pcall":           true,
+	"rawequal":        true,
+	"rawget":          true,
+	"rawset":          true,
+	"select":          true,
+	"tonumber":        true,
+	"tostring":        true,
+	"type":            true,
+	"unpack":          true,
+	"xpcall":          true,
+	lua.TabLibName:    true,
+	lua.StringLibName: true,
+	lua.MathLibName:   true,
+}
+
+// scriptUnsafeStringFuncs are removed from the string library, as they can
+// allocate strings of any size in a single call.
+var scriptUnsafeStringFuncs = []string{"format", "rep"}
+
+// ScriptDecision is the decision of a script about a request.
+type ScriptDecision struct {
+	// Reject is the error rejecting the request, if it is rejected.
+	Reject *RPCErr
+	// Group is the backend group the request is routed to, if overridden.
+	Group string
+	// Rewritten is whether the method or params of the request were replaced.
+	Rewritten bool
+}
+
+// ScriptEngine runs a Lua script on requests, which may reject them, route
+// them to a backend group or rewrite their method and params. The script
+// defines a global handle(req) function, req being a table with the method,
+// params, id and auth alias of the request, which returns nil to let the
+// request through unchanged, or a table with any of:
+//
+//   - reject: the message of the error rejecting the request, and optionally
+//     code, its JSON-RPC error code
+//   - group: the backend group the request is routed to
+//   - method and params: the method and params replacing those of the request
+//
+// Scripts run in a sandbox with a subset of the base, table, string and math
+// libraries. Each call runs in a fresh state, so that nothing is kept across
+// requests, and is bounded by a timeout, by the size of the Lua call stack
+// and registry, and by the size of the params passed to and returned by the
+// script.
+type ScriptEngine struct {
+	proto         *lua.FunctionProto
+	timeout       time.Duration
+	failOpen      bool
+	options       lua.Options
+	maxParamsSize int
+	groups        *StringSet
+}
+
+// NewScriptEngine compiles the script of config, which may route requests to
+// groups.
+func NewScriptEngine(config ScriptingConfig, groups []string) (*ScriptEngine, error) {
+	source := config.Script
+	if config.File != "" {
+		b, err := os.ReadFile(config.File)
+		if err != nil {
+			return nil, fmt.Errorf("error reading script: %w", err)
+		}
+		source = string(b)
+	}
+	if source == "" {
+		return nil, fmt.Errorf("scripting requires a script or a file")
+	}
+	chunk, err := parse.Parse(strings.NewReader(source), "script")
+	if err != nil {
+		return nil, fmt.Errorf("error parsing script: %w", err)
+	}
+	proto, err := lua.Compile(chunk, "script")
+	if err != nil {
+		return nil, fmt.Errorf("error compiling script: %w", err)
+	}
+
+	e := &ScriptEngine{
+		proto:         proto,
+		timeout:       defaultScriptTimeout,
+		failOpen:      config.FailOpen,
+		maxParamsSize: defaultScriptMaxParamsSize,
+		groups:        NewStringSetFromStrings(groups),
+		options: lua.Options{
+			CallStackSize:   defaultScriptCallStackSize,
+			RegistryMaxSize: defaultScriptRegistryMaxSize,
+			SkipOpenLibs:    true,
+		},
+	}
+	if config.Timeout != 0 {
+		e.timeout = time.Duration(config.Timeout)
+	}
+	if config.MaxCallStackSize != 0 {
+		e.options.CallStackSize = config.MaxCallStackSize
+	}
+	if config.MaxRegistrySize != 0 {
+		e.options.RegistryMaxSize = config.MaxRegistrySize
+	}
+	if config.MaxParamsSize != 0 {
+		e.maxParamsSize = config.MaxParamsSize
+	}
+
+	// load the script once, so that its errors are reported at startup
+	L, err := e.newState()
+	if err != nil {
+		return nil, err
+	}
+	L.Close()
+	return e, nil
+}
+
+// newState returns a sandboxed state in which the script is loaded.
+func (e *ScriptEngine) newState() (*lua.LState, error) {
+	L := lua.NewState(e.options)
+	for _, lib := range []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		if err := L.CallByParam(lua.P{Fn: L.NewFunction(lib.open), NRet: 0, Protect: true}, lua.LString(lib.name)); err != nil {
+			L.Close()
+			return nil, err
+		}
+	}
+	globals := L.Get(lua.GlobalsIndex).(*lua.LTable)
+	var unsafe []lua.LValue
+	globals.ForEach(func(key, _ lua.LValue) {
+		if !scriptGlobals[key.String()] {
+			unsafe = append(unsafe, key)
+		}
+	})
+	for _, key := range unsafe {
+		globals.RawSet(key, lua.LNil)
+	}
+	strlib := L.GetGlobal(lua.StringLibName).(*lua.LTable)
+	for _, name := range scriptUnsafeStringFuncs {
+		strlib.RawSetString(name, lua.LNil)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+	L.SetContext(ctx)
+	defer L.RemoveContext()
+	if err := L.CallByParam(lua.P{Fn: L.NewFunctionFromProto(e.proto), NRet: 0, Protect: true}); err != nil {
+		L.Close()
+		return nil, fmt.Errorf("error loading script: %w", err)
+	}
+	if _, ok := L.GetGlobal(scriptHandleFn).(*lua.LFunction); !ok {
+		L.Close()
+		return nil, fmt.Errorf("script must define a %s function", scriptHandleFn)
+	}
+	return L, nil
+}
+
+// Run runs the script on req, whose method and params are replaced if the
+// script rewrites them. If the script fails and requests fail open, an empty
+// decision is returned along with the error.
+func (e *ScriptEngine) Run(ctx context.Context, req *RPCReq) (*ScriptDecision, error) {
+	decision, err := e.run(ctx, req)
+	if err != nil {
+		RecordScriptDecision(ScriptDecisionError)
+		if e.failOpen {
+			return &ScriptDecision{}, err
+		}
+		return nil, err
+	}
+	switch {
+	case decision.Reject != nil:
+		RecordScriptDecision(ScriptDecisionReject)
+	case decision.Group != "":
+		RecordScriptDecision(ScriptDecisionRoute)
+	case decision.Rewritten:
+		RecordScriptDecision(ScriptDecisionRewrite)
+	default:
+		RecordScriptDecision(ScriptDecisionContinue)
+	}
+	return decision, nil
+}
+
+func (e *ScriptEngine) run(ctx context.Context, req *RPCReq) (*ScriptDecision, error) {
+	if len(req.Params) > e.maxParamsSize {
+		return nil, fmt.Errorf("params of %d bytes exceed the %d bytes scripts accept", len(req.Params), e.maxParamsSize)
+	}
+	L, err := e.newState()
+	if err != nil {
+		return nil, err
+	}
+	defer L.Close()
+
+	var params interface{}
+	if len(req.Params) > 0 {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			params = nil
+		}
+	}
+	luaReq := L.NewTable()
+	luaReq.RawSetString("method", lua.LString(req.Method))
+	luaReq.RawSetString("params", toLuaValue(L, params))
+	luaReq.RawSetString("id", lua.LString(req.ID))
+	if alias := GetAuthCtx(ctx); alias != "" {
+		luaReq.RawSetString("auth", lua.LString(alias))
+	}
+
+	callCtx, cancel := context.WithTimeout(ctx, e.timeout)
+	defer cancel()
+	L.SetContext(callCtx)
+	err = L.CallByParam(lua.P{Fn: L.GetGlobal(scriptHandleFn), NRet: 1, Protect: true}, luaReq)
+	L.RemoveContext()
+	if err != nil {
+		return nil, err
+	}
+	ret := L.Get(-1)
+	L.Pop(1)
+
+	decision := &ScriptDecision{}
+	if ret == lua.LNil {
+		return decision, nil
+	}
+	table, ok := ret.(*lua.LTable)
+	if !ok {
+		return nil, fmt.Errorf("%s returned a %s rather than a table", scriptHandleFn, ret.Type())
+	}
+	if reject := table.RawGetString("reject"); reject != lua.LNil {
+		rpcErr := *ErrRejectedByScript
+		rpcErr.Message = reject.String()
+		if len(rpcErr.Message) > e.maxParamsSize {
+			return nil, fmt.Errorf("%s returned a reject message of %d bytes", scriptHandleFn, len(rpcErr.Message))
+		}
+		if code, ok := table.RawGetString("code").(lua.LNumber); ok {
+			rpcErr.Code = int(code)
+		}
+		decision.Reject = &rpcErr
+		return decision, nil
+	}
+	if group, ok := table.RawGetString("group").(lua.LString); ok {
+		if !e.groups.Has(string(group)) {
+			return nil, fmt.Errorf("%s routed to unknown backend group %s", scriptHandleFn, group)
+		}
+		decision.Group = string(group)
+	}
+	if method, ok := table.RawGetString("method").(lua.LString); ok {
+		req.Method = string(method)
+		decision.Rewritten = true
+	}
+	if params := table.RawGetString("params"); params != lua.LNil {
+		rewritten := mustMarshalJSON(fromLuaValue(params))
+		if len(rewritten) > e.maxParamsSize {
+			return nil, fmt.Errorf("%s returned params of %d bytes", scriptHandleFn, len(rewritten))
+		}
+		req.Params = rewritten
+		decision.Rewritten = true
+	}
+	return decision, nil
+}
+
+// toLuaValue converts a decoded JSON value to Lua. JSON nulls are lost in
+// arrays and objects, as in any Lua table.
+func toLuaValue(L *lua.LState, v interface{}) lua.LValue {
+	switch v := v.(type) {
+	case nil:
+		return lua.LNil
+	case bool:
+		return lua.LBool(v)
+	case float64:
+		return lua.LNumber(v)
+	case string:
+		return lua.LString(v)
+	case []interface{}:
+		t := L.CreateTable(len(v), 0)
+		for i, elem := range v {
+			t.RawSetInt(i+1, toLuaValue(L, elem))
+		}
+		return t
+	case map[string]interface{}:
+		t := L.CreateTable(0, len(v))
+		for key, elem := range v {
+			t.RawSetString(key, toLuaValue(L, elem))
+		}
+		return t
+	default:
+		return lua.LNil
+	}
+}
+
+// fromLuaValue converts a Lua value to a JSON value. Tables whose keys are
+// 1..n are arrays, empty tables included, other tables are objects.
+func fromLuaValue(v lua.LValue) interface{} {
+	switch v := v.(type) {
+	case lua.LBool:
+		return bool(v)
+	case lua.LNumber:
+		if f := float64(v); f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+			return int64(f)
+		}
+		return float64(v)
+	case lua.LString:
+		return string(v)
+	case *lua.LTable:
+		if n := v.MaxN(); n > 0 || isEmptyTable(v) {
+			arr := make([]interface{}, n)
+			for i := 1; i <= n; i++ {
+				arr[i-1] = fromLuaValue(v.RawGetInt(i))
+			}
+			if countTable(v) == n {
+				return arr
+			}
+		}
+		obj := make(map[string]interface{})
+		v.ForEach(func(key, value lua.LValue) {
+			obj[key.String()] = fromLuaValue(value)
+		})
+		return obj
+	default:
+		return nil
+	}
+}
+
+func isEmptyTable(t *lua.LTable) bool {
+	key, _ := t.Next(lua.LNil)
+	return key == lua.LNil
+}
+
+func countTable(t *lua.LTable) int {
+	n := 0
+	t.ForEach(func(lua.LValue, lua.LValue) { n++ })
+	return n
+}
@@ -0,0 +1,409 @@
+package proxyd
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	secretSchemeVault = "vault"
+	secretSchemeAWSSM = "awssm"
+
+	defaultSecretsRefreshInterval = 5 * time.Minute
+	secretsRequestTimeout         = 10 * time.Second
+	maxSecretResponseSize         = 1 << 20
+)
+
+// secrets resolves the vault:// and awssm:// values of the config. It is
+// replaced by Start, and otherwise configured from the environment.
+var secrets atomic.Pointer[secretStore]
+
+// currentSecrets returns the store resolving the secrets of the config.
+func currentSecrets() *secretStore {
+	if s := secrets.Load(); s != nil {
+		return s
+	}
+	s, _ := newSecretStore(SecretsConfig{})
+	secrets.CompareAndSwap(nil, s)
+	return secrets.Load()
+}
+
+// isSecretRef returns whether value refers to a secret of Vault or AWS
+// Secrets Manager.
+func isSecretRef(value string) bool {
+	return strings.HasPrefix(value, secretSchemeVault+"://") || strings.HasPrefix(value, secretSchemeAWSSM+"://")
+}
+
+// watchSecret calls fn with the new value of value whenever it rotates, if it
+// refers to a secret.
+func watchSecret(value string, fn func(string)) {
+	if isSecretRef(value) {
+		currentSecrets().watch(value, fn)
+	}
+}
+
+// secretStore fetches secrets from Vault and AWS Secrets Manager. Secrets
+// are cached, and refetched in the background to pick up rotations.
+//
+// Vault secrets are referred to as vault://<path>#<field>, path being the
+// API path of the secret such as secret/data/proxyd for a KV v2 engine
+// mounted at secret. AWS secrets are referred to as
+// awssm://<secret id or ARN>#<field>, the field of JSON secrets. The field
+// can be omitted for secrets holding a single field, or a plain string.
+type secretStore struct {
+	client          *http.Client
+	refreshInterval time.Duration
+
+	vaultAddr      string
+	vaultToken     string
+	vaultNamespace string
+
+	awsRegion   string
+	awsEndpoint string
+	awsOnce     sync.Once
+	awsConfig   aws.Config
+	awsErr      error
+
+	mtx      sync.Mutex
+	values   map[string]string
+	watchers map[string][]func(string)
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// newSecretStore returns a store configured by config, defaulting to the
+// usual VAULT_* and AWS_* environment variables. AWS credentials are resolved
+// by the default chain of the AWS SDK.
+func newSecretStore(config SecretsConfig) (*secretStore, error) {
+	if isSecretRef(config.Vault.Token) {
+		return nil, errors.New("secrets.vault.token can't be a secret")
+	}
+	token, err := ReadFromEnvOrConfig(config.Vault.Token)
+	if err != nil {
+		return nil, err
+	}
+	s := &secretStore{
+		client:          &http.Client{Timeout: secretsRequestTimeout},
+		refreshInterval: defaultSecretsRefreshInterval,
+		vaultAddr:       strings.TrimSuffix(firstNonEmpty(config.Vault.Address, os.Getenv("VAULT_ADDR")), "/"),
+		vaultToken:      firstNonEmpty(token, os.Getenv("VAULT_TOKEN")),
+		vaultNamespace:  firstNonEmpty(config.Vault.Namespace, os.Getenv("VAULT_NAMESPACE")),
+		awsRegion:       firstNonEmpty(config.AWS.Region, os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION")),
+		awsEndpoint:     strings.TrimSuffix(config.AWS.Endpoint, "/"),
+		values:          make(map[string]string),
+		watchers:        make(map[string][]func(string)),
+		stop:            make(chan struct{}),
+	}
+	if config.RefreshInterval != 0 {
+		s.refreshInterval = time.Duration(config.RefreshInterval)
+	}
+	return s, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// resolve returns the value of the secret ref, fetching it on first use.
+func (s *secretStore) resolve(ref string) (string, error) {
+	s.mtx.Lock()
+	value, ok := s.values[ref]
+	s.mtx.Unlock()
+	if ok {
+		return value, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), secretsRequestTimeout)
+	defer cancel()
+	value, err := s.fetch(ctx, ref)
+	if err != nil {
+		return "", fmt.Errorf("error resolving secret %s: %w", ref, err)
+	}
+	s.mtx.Lock()
+	s.values[ref] = value
+	s.mtx.Unlock()
+	return value, nil
+}
+
+func (s *secretStore) watch(ref string, fn func(string)) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.watchers[ref] = append(s.watchers[ref], fn)
+}
+
+// Start refreshes the secrets in the background until Stop.
+func (s *secretStore) Start() {
+	go func() {
+		ticker := time.NewTicker(s.refreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.refresh()
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (s *secretStore) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+}
+
+// refresh refetches the secrets, notifying the watchers of those that
+// rotated. Secrets failing to fetch keep their value.
+func (s *secretStore) refresh() {
+	s.mtx.Lock()
+	refs := make([]string, 0, len(s.values))
+	for ref := range s.values {
+		refs = append(refs, ref)
+	}
+	s.mtx.Unlock()
+	sort.Strings(refs)
+
+	for _, ref := range refs {
+		scheme, _, _ := strings.Cut(ref, "://")
+		ctx, cancel := context.WithTimeout(context.Background(), secretsRequestTimeout)
+		value, err := s.fetch(ctx, ref)
+		cancel()
+		if err != nil {
+			log.Error("error refreshing secret", "secret", ref, "err", err)
+			RecordSecretRefresh(scheme, "error")
+			continue
+		}
+		s.mtx.Lock()
+		rotated := s.values[ref] != value
+		s.values[ref] = value
+		watchers := s.watchers[ref]
+		s.mtx.Unlock()
+		if !rotated {
+			RecordSecretRefresh(scheme, "unchanged")
+			continue
+		}
+		log.Info("secret rotated", "secret", ref)
+		RecordSecretRefresh(scheme, "rotated")
+		for _, fn := range watchers {
+			fn(value)
+		}
+	}
+}
+
+func (s *secretStore) fetch(ctx context.Context, ref string) (string, error) {
+	scheme, rest, _ := strings.Cut(ref, "://")
+	path, field, _ := strings.Cut(rest, "#")
+	if path == "" {
+		return "", errors.New("missing secret path")
+	}
+	switch scheme {
+	case secretSchemeVault:
+		return s.fetchVault(ctx, path, field)
+	case secretSchemeAWSSM:
+		return s.fetchAWSSM(ctx, path, field)
+	default:
+		return "", fmt.Errorf("unsupported secret scheme %s", scheme)
+	}
+}
+
+func (s *secretStore) fetchVault(ctx context.Context, path, field string) (string, error) {
+	if s.vaultAddr == "" {
+		return "", errors.New("vault address not configured")
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", s.vaultAddr+"/v1/"+strings.TrimPrefix(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", s.vaultToken)
+	if s.vaultNamespace != "" {
+		req.Header.Set("X-Vault-Namespace", s.vaultNamespace)
+	}
+	body, err := s.do(req)
+	if err != nil {
+		return "", err
+	}
+	var res struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return "", fmt.Errorf("error decoding vault response: %w", err)
+	}
+	data := res.Data
+	// KV v2 engines nest the fields of the secret along with its metadata
+	if _, ok := data["metadata"]; ok && data["data"] != nil {
+		data = nil
+		if err := json.Unmarshal(res.Data["data"], &data); err != nil {
+			return "", fmt.Errorf("error decoding vault response: %w", err)
+		}
+	}
+	return secretField(data, field)
+}
+
+func (s *secretStore) fetchAWSSM(ctx context.Context, secretID, field string) (string, error) {
+	client, err := s.awsClient(secretID)
+	if err != nil {
+		return "", err
+	}
+	res, err := client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(secretID),
+	})
+	if err != nil {
+		return "", err
+	}
+	value := string(res.SecretBinary)
+	if res.SecretString != nil {
+		value = *res.SecretString
+	}
+	var data map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(value), &data); err != nil {
+		if field != "" {
+			return "", fmt.Errorf("secret %s isn't JSON, it has no field %s", secretID, field)
+		}
+		return value, nil
+	}
+	return secretField(data, field)
+}
+
+// awsClient returns the Secrets Manager client of the region of secretID. The
+// AWS config is loaded once, so that credentials are cached across secrets and
+// refreshed by the SDK, e.g. web identity tokens and instance roles.
+func (s *secretStore) awsClient(secretID string) (*secretsmanager.Client, error) {
+	s.awsOnce.Do(func() {
+		s.awsConfig, s.awsErr = awsconfig.LoadDefaultConfig(
+			context.Background(),
+			awsconfig.WithHTTPClient(awshttp.NewBuildableClient().WithTimeout(secretsRequestTimeout)),
+		)
+	})
+	if s.awsErr != nil {
+		return nil, fmt.Errorf("error loading aws config: %w", s.awsErr)
+	}
+	region := firstNonEmpty(s.awsRegion, s.awsConfig.Region)
+	// ARNs hold the region of the secret
+	if arn := strings.Split(secretID, ":"); len(arn) > 3 && arn[0] == "arn" {
+		region = arn[3]
+	}
+	if region == "" {
+		return nil, errors.New("aws region not configured")
+	}
+	return secretsmanager.NewFromConfig(s.awsConfig, func(o *secretsmanager.Options) {
+		o.Region = region
+		if s.awsEndpoint != "" {
+			o.BaseEndpoint = aws.String(s.awsEndpoint)
+		}
+	}), nil
+}
+
+func (s *secretStore) do(req *http.Request) ([]byte, error) {
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxSecretResponseSize))
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != 200 {
+		return nil, fmt.Errorf("unexpected status code %d: %s", res.StatusCode, truncate(string(body), 200))
+	}
+	return body, nil
+}
+
+// secretField returns field of the fields of a secret, or its only field if
+// field is empty.
+func secretField(data map[string]json.RawMessage, field string) (string, error) {
+	if field == "" {
+		if len(data) != 1 {
+			return "", fmt.Errorf("secret has %d fields, one must be selected", len(data))
+		}
+		for f := range data {
+			field = f
+		}
+	}
+	raw, ok := data[field]
+	if !ok {
+		return "", fmt.Errorf("secret has no field %s", field)
+	}
+	var value string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		// numbers and booleans are used as is
+		return string(raw), nil
+	}
+	return value, nil
+}
+
+// secretCertificate serves a certificate whose PEM encoded certificate and
+// key are secrets, replacing it once either rotates.
+type secretCertificate struct {
+	certRef string
+	keyRef  string
+
+	mtx  sync.Mutex
+	cert atomic.Pointer[tls.Certificate]
+}
+
+func newSecretCertificate(certRef, keyRef string) (*secretCertificate, error) {
+	c := &secretCertificate{certRef: certRef, keyRef: keyRef}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	watchSecret(certRef, func(string) { c.reload() })
+	watchSecret(keyRef, func(string) { c.reload() })
+	return c, nil
+}
+
+func (c *secretCertificate) load() error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	certPEM, err := ReadFromEnvOrConfig(c.certRef)
+	if err != nil {
+		return err
+	}
+	keyPEM, err := ReadFromEnvOrConfig(c.keyRef)
+	if err != nil {
+		return err
+	}
+	cert, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+	if err != nil {
+		return fmt.Errorf("error loading TLS certificate: %w", err)
+	}
+	c.cert.Store(&cert)
+	return nil
+}
+
+// reload loads the rotated certificate. While the certificate and the key
+// rotate one after the other, they don't match and the current certificate
+// keeps being served.
+func (c *secretCertificate) reload() {
+	if err := c.load(); err != nil {
+		log.Warn("error reloading TLS certificate from secrets", "err", err)
+		return
+	}
+	log.Info("reloaded TLS certificate from secrets", "cert", c.certRef)
+}
+
+func (c *secretCertificate) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return c.cert.Load(), nil
+}
@@ -0,0 +1,316 @@
+package proxyd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"golang.org/x/sync/semaphore"
+)
+
+const (
+	SelfTestKindBackend = "backend"
+	SelfTestKindRedis   = "redis"
+	SelfTestKindConfig  = "config"
+)
+
+// SelfTestReport is the machine-readable outcome of a self-test.
+type SelfTestReport struct {
+	Passed bool             `json:"passed"`
+	Checks []*SelfTestCheck `json:"checks"`
+}
+
+type SelfTestCheck struct {
+	Kind     string            `json:"kind"`
+	Name     string            `json:"name"`
+	Passed   bool              `json:"passed"`
+	Error    string            `json:"error,omitempty"`
+	Duration string            `json:"duration,omitempty"`
+	Details  map[string]string `json:"details,omitempty"`
+}
+
+// selfTestProbes are sent to every backend, in order.
+var selfTestProbes = []struct {
+	method string
+	params []interface{}
+}{
+	{"eth_chainId", nil},
+	{"net_version", nil},
+	{"eth_blockNumber", nil},
+	{"eth_getBlockByNumber", []interface{}{"latest", false}},
+}
+
+// SelfTest checks the coherence of config, probes each of its backends and
+// verifies that Redis can be written and read, without starting proxyd. It is
+// meant to gate deploys.
+func SelfTest(ctx context.Context, config *Config) *SelfTestReport {
+	report := &SelfTestReport{Passed: true}
+	add := func(check *SelfTestCheck) {
+		report.Checks = append(report.Checks, check)
+		if !check.Passed {
+			report.Passed = false
+		}
+	}
+
+	for _, check := range selfTestConfig(config) {
+		add(check)
+	}
+
+	names := make([]string, 0, len(config.Backends))
+	for name := range config.Backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	chainIDs := make(map[string]string)
+	for _, name := range names {
+		check := selfTestBackend(ctx, config, name)
+		chainIDs[name] = check.Details["chain_id"]
+		add(check)
+	}
+	for _, check := range selfTestChainIDs(config, chainIDs) {
+		add(check)
+	}
+
+	if config.Redis.URL != "" || config.Redis.Sentinel.MasterName != "" {
+		add(selfTestRedis(ctx, config))
+	}
+	return report
+}
+
+func selfTestConfig(config *Config) []*SelfTestCheck {
+	var checks []*SelfTestCheck
+	check := func(name string, err error) {
+		c := &SelfTestCheck{Kind: SelfTestKindConfig, Name: name, Passed: err == nil}
+		if err != nil {
+			c.Error = err.Error()
+		}
+		checks = append(checks, c)
+	}
+
+	var mappingsErr error
+	for method, group := range config.RPCMethodMappings {
+		if config.BackendGroups[group] == nil {
+			mappingsErr = fmt.Errorf("method %s is mapped to undefined backend group %s", method, group)
+			break
+		}
+	}
+	if config.WSBackendGroup != "" && config.BackendGroups[config.WSBackendGroup] == nil {
+		mappingsErr = fmt.Errorf("undefined ws_backend_group %s", config.WSBackendGroup)
+	}
+	check("method_mappings", mappingsErr)
+
+	groups := make([]string, 0, len(config.BackendGroups))
+	for name := range config.BackendGroups {
+		groups = append(groups, name)
+	}
+	sort.Strings(groups)
+	for _, name := range groups {
+		check("backend_group:"+name, selfTestBackendGroup(config, config.BackendGroups[name]))
+	}
+	return checks
+}
+
+// selfTestBackendGroup checks that the backends of bg exist, and that its
+// consensus settings are consistent with each other and with the poller.
+func selfTestBackendGroup(config *Config, bg *BackendGroupConfig) error {
+	if len(bg.Backends) == 0 {
+		return fmt.Errorf("no backends")
+	}
+	for _, name := range bg.Backends {
+		if config.Backends[name] == nil {
+			return fmt.Errorf("undefined backend %s", name)
+		}
+	}
+	if !bg.ConsensusAware {
+		if len(bg.ConsensusLagBudgets) > 0 {
+			return fmt.Errorf("consensus_lag_budgets requires consensus_aware")
+		}
+		return nil
+	}
+
+	if bg.ConsensusBanPeriod != 0 && time.Duration(bg.ConsensusBanPeriod) <= PollerInterval {
+		return fmt.Errorf("consensus_ban_period %s must be longer than the poller interval %s",
+			time.Duration(bg.ConsensusBanPeriod), PollerInterval)
+	}
+	if bg.ConsensusMaxUpdateThreshold != 0 && time.Duration(bg.ConsensusMaxUpdateThreshold) <= PollerInterval {
+		return fmt.Errorf("consensus_max_update_threshold %s must be longer than the poller interval %s",
+			time.Duration(bg.ConsensusMaxUpdateThreshold), PollerInterval)
+	}
+	if bg.ConsensusMinPeerCount > 0 && bg.ConsensusMinPeerCount > len(bg.Backends) {
+		return fmt.Errorf("consensus_min_peer_count %d is more than the %d backends of the group",
+			bg.ConsensusMinPeerCount, len(bg.Backends))
+	}
+	for method, budget := range bg.ConsensusLagBudgets {
+		if bg.ConsensusMaxBlockLag > 0 && budget > bg.ConsensusMaxBlockLag {
+			return fmt.Errorf("lag budget %d of %s is more than consensus_max_block_lag %d",
+				budget, method, bg.ConsensusMaxBlockLag)
+		}
+	}
+	if bg.ConsensusHA {
+		if config.Redis.URL == "" && config.Redis.Sentinel.MasterName == "" {
+			return fmt.Errorf("consensus_ha requires redis")
+		}
+		if bg.ConsensusHAHeartbeatInterval != 0 && bg.ConsensusHALockPeriod != 0 &&
+			bg.ConsensusHAHeartbeatInterval >= bg.ConsensusHALockPeriod {
+			return fmt.Errorf("consensus_ha_heartbeat_interval %s must be shorter than consensus_ha_lock_period %s",
+				time.Duration(bg.ConsensusHAHeartbeatInterval), time.Duration(bg.ConsensusHALockPeriod))
+		}
+	}
+	return nil
+}
+
+// selfTestBackend sends the probes to a backend, with its credentials,
+// headers and TLS config.
+func selfTestBackend(ctx context.Context, config *Config, name string) *SelfTestCheck {
+	check := &SelfTestCheck{Kind: SelfTestKindBackend, Name: name, Details: make(map[string]string)}
+	start := time.Now()
+	err := func() error {
+		back, err := newSelfTestBackend(config, name)
+		if err != nil {
+			return err
+		}
+		for i, probe := range selfTestProbes {
+			res := new(RPCRes)
+			if err := back.ForwardRPC(ctx, res, fmt.Sprint(i), probe.method, probe.params...); err != nil {
+				return fmt.Errorf("%s: %w", probe.method, err)
+			}
+			if res.IsError() {
+				return fmt.Errorf("%s: %w", probe.method, res.Error)
+			}
+			if res.Result == nil {
+				return fmt.Errorf("%s: no result", probe.method)
+			}
+			switch probe.method {
+			case "eth_chainId":
+				var chainID hexutil.Big
+				if err := json.Unmarshal(mustMarshalJSON(res.Result), &chainID); err != nil {
+					return fmt.Errorf("%s: %w", probe.method, err)
+				}
+				check.Details["chain_id"] = chainID.ToInt().String()
+			case "eth_blockNumber":
+				check.Details["block_number"] = fmt.Sprint(res.Result)
+			}
+		}
+		return nil
+	}()
+	check.Duration = time.Since(start).String()
+	check.Passed = err == nil
+	if err != nil {
+		check.Error = err.Error()
+	}
+	return check
+}
+
+func newSelfTestBackend(config *Config, name string) (*Backend, error) {
+	cfg := config.Backends[name]
+	rpcURL, err := ReadFromEnvOrConfig(cfg.RPCURL)
+	if err != nil {
+		return nil, err
+	}
+	if rpcURL == "" {
+		return nil, fmt.Errorf("must define an RPC URL for backend %s", name)
+	}
+
+	opts := []BackendOpt{WithMaxRetries(0), WithProxydIP("127.0.0.1")}
+	if config.BackendOptions.ResponseTimeoutSeconds != 0 {
+		opts = append(opts, WithTimeout(secondsToDuration(config.BackendOptions.ResponseTimeoutSeconds)))
+	}
+	if cfg.Password != "" {
+		password, err := ReadFromEnvOrConfig(cfg.Password)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithBasicAuth(cfg.Username, password))
+	}
+	headers := make(map[string]string, len(cfg.Headers))
+	for headerName, headerValue := range cfg.Headers {
+		headerValue, err := ReadFromEnvOrConfig(headerValue)
+		if err != nil {
+			return nil, err
+		}
+		headers[headerName] = headerValue
+	}
+	opts = append(opts, WithHeaders(headers))
+	tlsConfig, err := configureBackendTLS(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		opts = append(opts, WithTLSConfig(tlsConfig))
+	}
+	return NewBackend(name, rpcURL, "", semaphore.NewWeighted(1), opts...), nil
+}
+
+// selfTestChainIDs checks that the backends of each group, and the chain_id
+// of the config if set, agree on the chain.
+func selfTestChainIDs(config *Config, chainIDs map[string]string) []*SelfTestCheck {
+	groups := make([]string, 0, len(config.BackendGroups))
+	for name := range config.BackendGroups {
+		groups = append(groups, name)
+	}
+	sort.Strings(groups)
+
+	var checks []*SelfTestCheck
+	for _, group := range groups {
+		check := &SelfTestCheck{Kind: SelfTestKindConfig, Name: "chain_id:" + group, Passed: true}
+		expected := ""
+		if config.ChainID != 0 {
+			expected = fmt.Sprint(config.ChainID)
+		}
+		for _, name := range config.BackendGroups[group].Backends {
+			chainID := chainIDs[name]
+			if chainID == "" {
+				continue
+			}
+			if expected == "" {
+				expected = chainID
+			}
+			if chainID != expected {
+				check.Passed = false
+				check.Error = fmt.Sprintf("backend %s serves chain %s, expected %s", name, chainID, expected)
+				break
+			}
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+// selfTestRedis writes, reads and deletes a key.
+func selfTestRedis(ctx context.Context, config *Config) *SelfTestCheck {
+	check := &SelfTestCheck{Kind: SelfTestKindRedis, Name: "redis"}
+	start := time.Now()
+	err := func() error {
+		url, err := ReadFromEnvOrConfig(config.Redis.URL)
+		if err != nil {
+			return err
+		}
+		client, err := NewRedisClient(url, config.Redis)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		key := fmt.Sprintf("selftest:%s:%d", config.keyNamespace(config.Redis.Namespace), time.Now().UnixNano())
+		if err := client.Set(ctx, key, "ok", time.Minute).Err(); err != nil {
+			return wrapErr(err, "error writing to redis")
+		}
+		val, err := client.Get(ctx, key).Result()
+		if err != nil {
+			return wrapErr(err, "error reading from redis")
+		}
+		if val != "ok" {
+			return fmt.Errorf("read %q from redis, expected %q", val, "ok")
+		}
+		return client.Del(ctx, key).Err()
+	}()
+	check.Duration = time.Since(start).String()
+	check.Passed = err == nil
+	if err != nil {
+		check.Error = err.Error()
+	}
+	return check
+}
@@ -0,0 +1,198 @@
+package proxyd
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+const (
+	// SetCodeTxType is the EIP-7702 transaction type.
+	SetCodeTxType = 0x04
+	// DepositTxType is the OP Stack deposit transaction type. Deposits are
+	// derived from L1 and can't be submitted with eth_sendRawTransaction.
+	DepositTxType = 0x7e
+)
+
+// ErrUnsupportedTxType is identical to the error Geth responds with.
+var ErrUnsupportedTxType = types.ErrTxTypeNotSupported
+
+// TxSender identifies the sender of a transaction, as used by the sender rate
+// limiter.
+type TxSender struct {
+	From  common.Address
+	Nonce uint64
+	// To is nil for contract creations.
+	To *common.Address
+	// ChainID is nil for transactions that are not bound to a chain.
+	ChainID *big.Int
+	// Gas is the gas limit of the transaction.
+	Gas uint64
+	// GasFeeCap is the max fee per gas, or the gas price of legacy
+	// transactions.
+	GasFeeCap *big.Int
+	// BlobCount is the number of EIP-4844 blobs carried by the transaction.
+	BlobCount int
+	// BlobFeeCap is the max fee per blob gas, nil for transactions without
+	// blobs.
+	BlobFeeCap *big.Int
+}
+
+// SenderExtractor derives the sender of raw transactions.
+type SenderExtractor interface {
+	ExtractSender(data []byte) (*TxSender, error)
+}
+
+type SenderExtractorFunc func(data []byte) (*TxSender, error)
+
+// TxTypeSenderExtractor dispatches raw transactions to the extractor
+// registered for their EIP-2718 type. Transactions of unregistered types are
+// rejected, so that new formats can't bypass sender rate limits.
+type TxTypeSenderExtractor struct {
+	extractors map[byte]SenderExtractorFunc
+}
+
+// NewTxTypeSenderExtractor returns an extractor supporting legacy, access
+// list, dynamic fee, blob and set code transactions. Deposit transactions
+// are unsigned, so their sender can't be trusted and they are rejected.
+func NewTxTypeSenderExtractor() *TxTypeSenderExtractor {
+	e := &TxTypeSenderExtractor{
+		extractors: make(map[byte]SenderExtractorFunc),
+	}
+	e.Register(types.LegacyTxType, extractSignedTxSender)
+	e.Register(types.AccessListTxType, extractSignedTxSender)
+	e.Register(types.DynamicFeeTxType, extractSignedTxSender)
+	e.Register(types.BlobTxType, extractSignedTxSender)
+	e.Register(SetCodeTxType, extractSetCodeTxSender)
+	return e
+}
+
+// Register sets the extractor of transactions of txType, replacing any
+// previous one.
+func (e *TxTypeSenderExtractor) Register(txType byte, fn SenderExtractorFunc) {
+	e.extractors[txType] = fn
+}
+
+func (e *TxTypeSenderExtractor) ExtractSender(data []byte) (*TxSender, error) {
+	if len(data) == 0 {
+		return nil, errors.New("typed transaction too short")
+	}
+	txType := data[0]
+	// legacy transactions are RLP lists
+	if txType >= 0xc0 {
+		txType = types.LegacyTxType
+	}
+	fn, ok := e.extractors[txType]
+	if !ok {
+		return nil, ErrUnsupportedTxType
+	}
+	return fn(data)
+}
+
+// extractSignedTxSender supports the transaction types known to go-ethereum.
+// It performs an ecrecover, which can be expensive.
+func extractSignedTxSender(data []byte) (*TxSender, error) {
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	from, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+	if err != nil {
+		return nil, err
+	}
+	sender := &TxSender{
+		From:      from,
+		Nonce:     tx.Nonce(),
+		To:        tx.To(),
+		ChainID:   tx.ChainId(),
+		Gas:       tx.Gas(),
+		GasFeeCap: tx.GasFeeCap(),
+	}
+	if tx.Type() == types.BlobTxType {
+		sender.BlobCount = len(tx.BlobHashes())
+		sender.BlobFeeCap = tx.BlobGasFeeCap()
+	}
+	return sender, nil
+}
+
+type setCodeAuthorization struct {
+	ChainID *big.Int
+	Address common.Address
+	Nonce   uint64
+	V       uint8
+	R       *big.Int
+	S       *big.Int
+}
+
+type setCodeTx struct {
+	ChainID    *big.Int
+	Nonce      uint64
+	GasTipCap  *big.Int
+	GasFeeCap  *big.Int
+	Gas        uint64
+	To         common.Address
+	Value      *big.Int
+	Data       []byte
+	AccessList types.AccessList
+	AuthList   []setCodeAuthorization
+	V          *big.Int
+	R          *big.Int
+	S          *big.Int
+}
+
+func (tx *setCodeTx) sigHash() (common.Hash, error) {
+	payload, err := rlp.EncodeToBytes([]interface{}{
+		tx.ChainID,
+		tx.Nonce,
+		tx.GasTipCap,
+		tx.GasFeeCap,
+		tx.Gas,
+		tx.To,
+		tx.Value,
+		tx.Data,
+		tx.AccessList,
+		tx.AuthList,
+	})
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return crypto.Keccak256Hash([]byte{SetCodeTxType}, payload), nil
+}
+
+// extractSetCodeTxSender supports EIP-7702 set code transactions.
+func extractSetCodeTxSender(data []byte) (*TxSender, error) {
+	var tx setCodeTx
+	if err := rlp.DecodeBytes(data[1:], &tx); err != nil {
+		return nil, err
+	}
+	if !tx.V.IsUint64() || tx.V.Uint64() > 1 || !crypto.ValidateSignatureValues(byte(tx.V.Uint64()), tx.R, tx.S, true) {
+		return nil, types.ErrInvalidSig
+	}
+	hash, err := tx.sigHash()
+	if err != nil {
+		return nil, err
+	}
+
+	sig := make([]byte, crypto.SignatureLength)
+	tx.R.FillBytes(sig[:32])
+	tx.S.FillBytes(sig[32:64])
+	sig[64] = byte(tx.V.Uint64())
+	pub, err := crypto.Ecrecover(hash[:], sig)
+	if err != nil {
+		return nil, err
+	}
+	var from common.Address
+	copy(from[:], crypto.Keccak256(pub[1:])[12:])
+	return &TxSender{
+		From:      from,
+		Nonce:     tx.Nonce,
+		To:        &tx.To,
+		ChainID:   tx.ChainID,
+		Gas:       tx.Gas,
+		GasFeeCap: tx.GasFeeCap,
+	}, nil
+}
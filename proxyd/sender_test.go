@@ -0,0 +1,141 @@
+package proxyd
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTxTypeSenderExtractor(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	chainID := big.NewInt(10)
+	to := common.HexToAddress("0x1234")
+	extractor := NewTxTypeSenderExtractor()
+
+	signed := func(t *testing.T, txData types.TxData) []byte {
+		tx, err := types.SignNewTx(key, types.LatestSignerForChainID(chainID), txData)
+		require.NoError(t, err)
+		data, err := tx.MarshalBinary()
+		require.NoError(t, err)
+		return data
+	}
+	requireSender := func(t *testing.T, data []byte, nonce uint64, chainID *big.Int) {
+		sender, err := extractor.ExtractSender(data)
+		require.NoError(t, err)
+		require.Equal(t, from, sender.From)
+		require.Equal(t, nonce, sender.Nonce)
+		require.Equal(t, chainID, sender.ChainID)
+	}
+
+	t.Run("legacy", func(t *testing.T) {
+		data := signed(t, &types.LegacyTx{Nonce: 1, GasPrice: big.NewInt(1), Gas: 21000, To: &to, Value: big.NewInt(0)})
+		requireSender(t, data, 1, chainID)
+	})
+
+	t.Run("dynamic fee", func(t *testing.T) {
+		data := signed(t, &types.DynamicFeeTx{ChainID: chainID, Nonce: 2, GasTipCap: big.NewInt(1), GasFeeCap: big.NewInt(1), Gas: 21000, To: &to})
+		requireSender(t, data, 2, chainID)
+		sender, err := extractor.ExtractSender(data)
+		require.NoError(t, err)
+		require.Zero(t, sender.BlobCount)
+		require.Nil(t, sender.BlobFeeCap)
+	})
+
+	t.Run("blob", func(t *testing.T) {
+		data := signed(t, &types.BlobTx{
+			ChainID:    uint256.MustFromBig(chainID),
+			Nonce:      3,
+			GasTipCap:  uint256.NewInt(1),
+			GasFeeCap:  uint256.NewInt(1),
+			Gas:        21000,
+			To:         to,
+			Value:      uint256.NewInt(0),
+			BlobFeeCap: uint256.NewInt(1),
+			BlobHashes: []common.Hash{{0x01}, {0x02}},
+		})
+		requireSender(t, data, 3, chainID)
+		sender, err := extractor.ExtractSender(data)
+		require.NoError(t, err)
+		require.Equal(t, 2, sender.BlobCount)
+		require.Equal(t, big.NewInt(1), sender.BlobFeeCap)
+	})
+
+	t.Run("set code", func(t *testing.T) {
+		tx := &setCodeTx{
+			ChainID:   chainID,
+			Nonce:     4,
+			GasTipCap: big.NewInt(1),
+			GasFeeCap: big.NewInt(1),
+			Gas:       50000,
+			To:        to,
+			Value:     big.NewInt(0),
+			AuthList: []setCodeAuthorization{{
+				ChainID: chainID,
+				Address: to,
+				Nonce:   5,
+				R:       big.NewInt(1),
+				S:       big.NewInt(1),
+			}},
+		}
+		hash, err := tx.sigHash()
+		require.NoError(t, err)
+		sig, err := crypto.Sign(hash[:], key)
+		require.NoError(t, err)
+		tx.R = new(big.Int).SetBytes(sig[:32])
+		tx.S = new(big.Int).SetBytes(sig[32:64])
+		tx.V = big.NewInt(int64(sig[64]))
+		payload, err := rlp.EncodeToBytes(tx)
+		require.NoError(t, err)
+		data := append([]byte{SetCodeTxType}, payload...)
+		requireSender(t, data, 4, chainID)
+
+		// tampering with the transaction changes the recovered sender
+		tx.Nonce = 5
+		payload, err = rlp.EncodeToBytes(tx)
+		require.NoError(t, err)
+		sender, err := extractor.ExtractSender(append([]byte{SetCodeTxType}, payload...))
+		if err == nil {
+			require.NotEqual(t, from, sender.From)
+		}
+	})
+
+	t.Run("deposit", func(t *testing.T) {
+		// the sender of deposits is claimed, not signed
+		payload, err := rlp.EncodeToBytes([]interface{}{
+			common.Hash{0, 0, 0, 0, 0, 0, 0, 7},
+			from,
+			&to,
+			big.NewInt(0),
+			big.NewInt(0),
+			uint64(21000),
+			false,
+			[]byte{},
+		})
+		require.NoError(t, err)
+		_, err = extractor.ExtractSender(append([]byte{DepositTxType}, payload...))
+		require.ErrorIs(t, err, ErrUnsupportedTxType)
+	})
+
+	t.Run("unsupported type", func(t *testing.T) {
+		_, err := extractor.ExtractSender([]byte{0x05, 0xc0})
+		require.ErrorIs(t, err, ErrUnsupportedTxType)
+	})
+
+	t.Run("registered type", func(t *testing.T) {
+		custom := NewTxTypeSenderExtractor()
+		custom.Register(0x05, func(data []byte) (*TxSender, error) {
+			return &TxSender{From: from, Nonce: 9, ChainID: chainID}, nil
+		})
+		sender, err := custom.ExtractSender([]byte{0x05})
+		require.NoError(t, err)
+		require.Equal(t, uint64(9), sender.Nonce)
+	})
+}
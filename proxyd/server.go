@@ -3,6 +3,7 @@ package proxyd
 import (
 	"context"
 	"crypto/rand"
+	"crypto/tls"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
@@ -10,17 +11,17 @@ import (
 	"io"
 	"math"
 	"math/big"
+	"net"
 	"net/http"
 	"regexp"
 	"strconv"
-	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
-	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/txpool"
-	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
@@ -34,6 +35,8 @@ const (
 	ContextKeyAuth               = "authorization"
 	ContextKeyReqID              = "req_id"
 	ContextKeyXForwardedFor      = "x_forwarded_for"
+	ContextKeyOrigin             = "origin"
+	ContextKeyUserAgent          = "user_agent"
 	DefaultMaxBatchRPCCallsLimit = 100
 	MaxBatchRPCCallsHardLimit    = 1000
 	cacheStatusHdr               = "X-Proxyd-Cache-Status"
@@ -43,6 +46,7 @@ const (
 	defaultWSReadTimeout         = 2 * time.Minute
 	defaultWSWriteTimeout        = 10 * time.Second
 	defaultCacheTtl              = 1 * time.Hour
+	defaultLocalCacheTTL         = 2 * time.Second
 	maxRequestBodyLogLen         = 2000
 	defaultMaxUpstreamBatchSize  = 10
 	defaultRateLimitHeader       = "X-Forwarded-For"
@@ -51,90 +55,176 @@ const (
 var emptyArrayResponse = json.RawMessage("[]")
 
 type Server struct {
-	BackendGroups          map[string]*BackendGroup
-	wsBackendGroup         *BackendGroup
-	wsMethodWhitelist      *StringSet
+	BackendGroups        map[string]*BackendGroup
+	wsBackendGroup       *BackendGroup
+	wsMethodWhitelist    *StringSet
+	maxBodySize          int64
+	enableRequestLog     bool
+	maxRequestBodyLogLen int
+	authMtx              sync.RWMutex
+	authenticatedPaths   map[string]string
+	authKeyPolicies      map[string]*authKeyPolicy
+	timeout              time.Duration
+	maxUpstreamBatchSize int
+	maxBatchSize         int
+	enableServedByHeader bool
+	upgrader             *websocket.Upgrader
+	routing              atomic.Pointer[routingConfig]
+	senderLim            FrontendRateLimiter
+	blobSenderLim        FrontendRateLimiter
+	senderAllowlist      map[common.Address]bool
+	contractSenderLims   map[common.Address]FrontendRateLimiter
+	txValidator          *TxValidator
+	txPolicy             *TxPolicy
+	txDedup              *RawTxDeduplicator
+	txNonce              *TxNonceTracker
+	conditionalTx        *ConditionalTxRouter
+	bundler              *BundlerRouter
+	privateTx            *PrivateTxRelay
+	localResponder       *LocalResponder
+	lvcResponder         *LVCResponder
+	getLogsLimiter       *GetLogsLimiter
+	paramValidator       *ParamValidator
+	scriptEngine         *ScriptEngine
+	getLatestBlockNumFn  GetBlockNumFn
+	senderExtractor      SenderExtractor
+	allowedChainIds      []*big.Int
+	rpcServer            *http.Server
+	wsServer             *http.Server
+	adminServer          *http.Server
+	cache                RPCCache
+	srvMu                sync.Mutex
+	upgradeHinter        *UpgradeHinter
+	coalescer            *RequestCoalescer
+	peering              *Peering
+	wsSessions           *WSSessionStore
+	wsMux                *WSSubscriptionMux
+	wsFailover           WSFailoverConfig
+	wsClientConn         WSClientConnConfig
+	wsConnLimiter        *WSConnLimiter
+	wsMessageLimiter     *WSMessageRateLimiter
+	wsMessagePolicy      *WSMessagePolicy
+	wsDrainer            *wsDrainer
+	wsCompression        *WSCompression
+	sse                  *sseStreams
+	tlsConfig            *tls.Config
+	clientCertAuth       *clientCertAuth
+	jwtAuth              *jwtAuth
+	apiKeys              *APIKeyStore
+	geoip                *GeoIP
+	proxyProtocol        *proxyProtocol
+	clientIP             *clientIPResolver
+	abuse                *AbuseDetector
+	accessLog            *AccessLog
+	cors                 *cors.Cors
+	priorities           *PriorityClassifier
+	enableETags          bool
+	cacheDebugHdr        bool
+	etagMinBytes         int
+	finalityTags         *FinalityTags
+	enableRPCDiscover    bool
+	projector            *ResponseProjector
+	transformer          *ResponseTransformer
+	requestHooks         []RequestHook
+	responseHooks        []ResponseHook
+	httpMiddlewares      []HTTPMiddleware
+	methodHandlers       map[string]MethodHandlerFunc
+	keepaliveInterval    time.Duration
+	keepaliveMethods     *StringSet
+	redisClient          redis.UniversalClient
+	quotaTracker         *QuotaTracker
+	computeUnits         *computeUnits
+	reloader             *ConfigReloader
+	trafficRecorder      *TrafficRecorder
+}
+
+type limiterFunc func(method string) bool
+
+type limiterFactoryFunc func(dur time.Duration, max int, prefix string) FrontendRateLimiter
+
+// routingConfig holds the method mappings and rate limits of the server, which
+// can be swapped at runtime by a config reload.
+type routingConfig struct {
 	rpcMethodMappings      map[string]string
-	maxBodySize            int64
-	enableRequestLog       bool
-	maxRequestBodyLogLen   int
-	authenticatedPaths     map[string]string
-	timeout                time.Duration
-	maxUpstreamBatchSize   int
-	maxBatchSize           int
-	enableServedByHeader   bool
-	upgrader               *websocket.Upgrader
+	rateLimitConfig        RateLimitConfig
 	mainLim                FrontendRateLimiter
 	overrideLims           map[string]FrontendRateLimiter
-	senderLim              FrontendRateLimiter
-	allowedChainIds        []*big.Int
+	globallyLimitedMethods map[string]bool
+	authKeyLimitedMethods  map[string]bool
 	limExemptOrigins       []*regexp.Regexp
 	limExemptUserAgents    []*regexp.Regexp
-	globallyLimitedMethods map[string]bool
-	rpcServer              *http.Server
-	wsServer               *http.Server
-	cache                  RPCCache
-	srvMu                  sync.Mutex
-	rateLimitHeader        string
+	limExemptCIDRs         []*net.IPNet
+	cidrOverrides          []*cidrRateLimit
 }
 
-type limiterFunc func(method string) bool
+// cidrRateLimit is the base rate limiter of the IPs of nets.
+type cidrRateLimit struct {
+	name string
+	nets []*net.IPNet
+	lim  FrontendRateLimiter
+}
 
-func NewServer(
-	backendGroups map[string]*BackendGroup,
-	wsBackendGroup *BackendGroup,
-	wsMethodWhitelist *StringSet,
-	rpcMethodMappings map[string]string,
-	maxBodySize int64,
-	authenticatedPaths map[string]string,
-	timeout time.Duration,
-	maxUpstreamBatchSize int,
-	enableServedByHeader bool,
-	cache RPCCache,
-	rateLimitConfig RateLimitConfig,
-	senderRateLimitConfig SenderRateLimitConfig,
-	enableRequestLog bool,
-	maxRequestBodyLogLen int,
-	maxBatchSize int,
-	redisClient *redis.Client,
-) (*Server, error) {
-	if cache == nil {
-		cache = &NoopRPCCache{}
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %s: %w", cidr, err)
+		}
+		nets = append(nets, ipNet)
 	}
+	return nets, nil
+}
 
-	if maxBodySize == 0 {
-		maxBodySize = defaultBodySizeLimit
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, ipNet := range nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
 	}
+	return false
+}
 
-	if timeout == 0 {
-		timeout = defaultRPCTimeout
-	}
+func newLimiterFactory(rateLimitConfig RateLimitConfig, redisClient redis.UniversalClient, namespace string) limiterFactoryFunc {
+	return func(dur time.Duration, max int, prefix string) FrontendRateLimiter {
+		if rateLimitConfig.UseRedis {
+			if namespace != "" {
+				prefix = namespace + ":" + prefix
+			}
+			lim := newRedisRateLimiter(rateLimitConfig.Algorithm, redisClient, dur, max, prefix)
+			fallback := newMemoryRateLimiter(rateLimitConfig.Algorithm, dur, max)
+			return newFailSafeFrontendRateLimiter(lim, rateLimitConfig.RedisFailureMode, fallback)
+		}
 
-	if maxUpstreamBatchSize == 0 {
-		maxUpstreamBatchSize = defaultMaxUpstreamBatchSize
+		return newMemoryRateLimiter(rateLimitConfig.Algorithm, dur, max)
 	}
+}
 
-	if maxBatchSize == 0 {
-		maxBatchSize = DefaultMaxBatchRPCCallsLimit
+func newRoutingConfig(rpcMethodMappings map[string]string, rateLimitConfig RateLimitConfig, limiterFactory limiterFactoryFunc) (*routingConfig, error) {
+	switch rateLimitConfig.RedisFailureMode {
+	case "", RedisFailureModeClosed, RedisFailureModeOpen, RedisFailureModeLocal:
+	default:
+		return nil, fmt.Errorf("invalid redis_failure_mode %s", rateLimitConfig.RedisFailureMode)
 	}
-
-	if maxBatchSize > MaxBatchRPCCallsHardLimit {
-		maxBatchSize = MaxBatchRPCCallsHardLimit
+	if err := validateRateLimitAlgorithm(rateLimitConfig.Algorithm); err != nil {
+		return nil, err
 	}
 
-	limiterFactory := func(dur time.Duration, max int, prefix string) FrontendRateLimiter {
-		if rateLimitConfig.UseRedis {
-			return NewRedisFrontendRateLimiter(redisClient, dur, max, prefix)
-		}
-
-		return NewMemoryFrontendRateLimit(dur, max)
+	limExemptCIDRs, err := parseCIDRs(rateLimitConfig.ExemptCIDRs)
+	if err != nil {
+		return nil, err
 	}
 
 	var mainLim FrontendRateLimiter
+	var cidrOverrides []*cidrRateLimit
 	limExemptOrigins := make([]*regexp.Regexp, 0)
 	limExemptUserAgents := make([]*regexp.Regexp, 0)
 	if rateLimitConfig.BaseRate > 0 {
-		mainLim = limiterFactory(time.Duration(rateLimitConfig.BaseInterval), rateLimitConfig.BaseRate, "main")
+		mainLim = newDryRunFrontendRateLimiter(
+			limiterFactory(time.Duration(rateLimitConfig.BaseInterval), rateLimitConfig.BaseRate, "main"),
+			"main",
+			rateLimitConfig.DryRun,
+		)
 		for _, origin := range rateLimitConfig.ExemptOrigins {
 			pattern, err := regexp.Compile(origin)
 			if err != nil {
@@ -149,78 +239,579 @@ func NewServer(
 			}
 			limExemptUserAgents = append(limExemptUserAgents, pattern)
 		}
+		for name, override := range rateLimitConfig.CIDROverrides {
+			nets, err := parseCIDRs(override.CIDRs)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CIDR override %s: %w", name, err)
+			}
+			cidrOverrides = append(cidrOverrides, &cidrRateLimit{
+				name: name,
+				nets: nets,
+				lim: newDryRunFrontendRateLimiter(
+					limiterFactory(time.Duration(rateLimitConfig.BaseInterval), override.BaseRate, "cidr:"+name),
+					"cidr:"+name,
+					override.DryRun,
+				),
+			})
+		}
 	} else {
 		mainLim = NoopFrontendRateLimiter
 	}
 
 	overrideLims := make(map[string]FrontendRateLimiter)
 	globalMethodLims := make(map[string]bool)
+	authKeyMethodLims := make(map[string]bool)
 	for method, override := range rateLimitConfig.MethodOverrides {
-		var err error
-		overrideLims[method] = limiterFactory(time.Duration(override.Interval), override.Limit, method)
-		if err != nil {
-			return nil, err
-		}
+		overrideLims[method] = newDryRunFrontendRateLimiter(
+			limiterFactory(time.Duration(override.Interval), override.Limit, method),
+			method,
+			override.DryRun,
+		)
 
 		if override.Global {
 			globalMethodLims[method] = true
 		}
-	}
-	var senderLim FrontendRateLimiter
-	if senderRateLimitConfig.Enabled {
-		senderLim = limiterFactory(time.Duration(senderRateLimitConfig.Interval), senderRateLimitConfig.Limit, "senders")
+		if override.ByAuthKey {
+			authKeyMethodLims[method] = true
+		}
 	}
 
-	rateLimitHeader := defaultRateLimitHeader
-	if rateLimitConfig.IPHeaderOverride != "" {
-		rateLimitHeader = rateLimitConfig.IPHeaderOverride
-	}
-
-	return &Server{
-		BackendGroups:        backendGroups,
-		wsBackendGroup:       wsBackendGroup,
-		wsMethodWhitelist:    wsMethodWhitelist,
-		rpcMethodMappings:    rpcMethodMappings,
-		maxBodySize:          maxBodySize,
-		authenticatedPaths:   authenticatedPaths,
-		timeout:              timeout,
-		maxUpstreamBatchSize: maxUpstreamBatchSize,
-		enableServedByHeader: enableServedByHeader,
-		cache:                cache,
-		enableRequestLog:     enableRequestLog,
-		maxRequestBodyLogLen: maxRequestBodyLogLen,
-		maxBatchSize:         maxBatchSize,
-		upgrader: &websocket.Upgrader{
-			HandshakeTimeout: defaultWSHandshakeTimeout,
-		},
+	return &routingConfig{
+		rpcMethodMappings:      rpcMethodMappings,
+		rateLimitConfig:        rateLimitConfig,
 		mainLim:                mainLim,
 		overrideLims:           overrideLims,
 		globallyLimitedMethods: globalMethodLims,
-		senderLim:              senderLim,
-		allowedChainIds:        senderRateLimitConfig.AllowedChainIds,
+		authKeyLimitedMethods:  authKeyMethodLims,
 		limExemptOrigins:       limExemptOrigins,
 		limExemptUserAgents:    limExemptUserAgents,
-		rateLimitHeader:        rateLimitHeader,
+		limExemptCIDRs:         limExemptCIDRs,
+		cidrOverrides:          cidrOverrides,
 	}, nil
 }
 
+// ServerOptions holds the settings and dependencies of a Server.
+type ServerOptions struct {
+	BackendGroups        map[string]*BackendGroup
+	WSBackendGroup       *BackendGroup
+	WSMethodWhitelist    *StringSet
+	RPCMethodMappings    map[string]string
+	MaxBodySize          int64
+	AuthenticatedPaths   map[string]string
+	Timeout              time.Duration
+	MaxUpstreamBatchSize int
+	EnableServedByHeader bool
+	Cache                RPCCache
+	RateLimit            RateLimitConfig
+	SenderRateLimit      SenderRateLimitConfig
+	TxValidation         TxValidationConfig
+	TxPolicy             TxPolicyConfig
+	TxDedup              TxDedupConfig
+	TxNonce              TxNonceConfig
+	ConditionalTx        ConditionalTxConfig
+	Bundler              BundlerConfig
+	PrivateTx            PrivateTxConfig
+	LocalMethods         LocalMethodsConfig
+	EnableRequestLog     bool
+	MaxRequestBodyLogLen int
+	MaxBatchSize         int
+	RedisClient          redis.UniversalClient
+	UpgradeHints         UpgradeHintsConfig
+	RequestCoalescing    RequestCoalescingConfig
+	HotReload            HotReloadConfig
+	Metering             MeteringConfig
+	AuthKeys             map[string]*AuthKeyConfig
+	Peering              PeeringConfig
+	KeyNamespace         string
+	WSSessions           WSSessionsConfig
+	WSMultiplex          WSMultiplexConfig
+	WSFailover           WSFailoverConfig
+	WSConnLimits         WSConnLimitsConfig
+	WSMessageRateLimit   WSMessageRateLimitConfig
+	WSConns              WSConnsConfig
+	WSMessagePolicy      WSMessagePolicyConfig
+	WSDrain              WSDrainConfig
+	WSCompression        WSCompressionConfig
+	SSE                  SSEConfig
+	TLS                  ServerTLSConfig
+	JWTAuth              JWTAuthConfig
+	APIKeys              APIKeysConfig
+	CORS                 CORSConfig
+	GeoIP                GeoIPConfig
+	ProxyProtocol        ProxyProtocolConfig
+	Abuse                AbuseConfig
+	AccessLog            AccessLogConfig
+	ComputeUnits         ComputeUnitsConfig
+	Priority             PriorityConfig
+	ETag                 CacheETagConfig
+	CacheDebugHeader     bool
+	TrustedProxyCIDRs    []string
+	FinalityTags         *FinalityTags
+	LVCResponder         *LVCResponder
+	GetLogsLimits        GetLogsLimitsConfig
+	ParamValidation      ParamValidationConfig
+	Scripting            ScriptingConfig
+	FilterEmulation      FilterEmulationConfig
+	GetLatestBlockNumFn  GetBlockNumFn
+	EnableRPCDiscover    bool
+	ResponseProjections  map[string]map[string]*ResponseProjectionConfig
+	ResponseTransforms   map[string][]ResponseTransformConfig
+	KeepaliveInterval    time.Duration
+	KeepaliveMethods     []string
+}
+
+func NewServer(opts ServerOptions) (*Server, error) {
+	if opts.Cache == nil {
+		opts.Cache = &NoopRPCCache{}
+	}
+
+	if opts.MaxBodySize == 0 {
+		opts.MaxBodySize = defaultBodySizeLimit
+	}
+
+	if opts.Timeout == 0 {
+		opts.Timeout = defaultRPCTimeout
+	}
+
+	if opts.MaxUpstreamBatchSize == 0 {
+		opts.MaxUpstreamBatchSize = defaultMaxUpstreamBatchSize
+	}
+
+	if opts.MaxBatchSize == 0 {
+		opts.MaxBatchSize = DefaultMaxBatchRPCCallsLimit
+	}
+
+	if opts.MaxBatchSize > MaxBatchRPCCallsHardLimit {
+		opts.MaxBatchSize = MaxBatchRPCCallsHardLimit
+	}
+
+	limiterFactory := newLimiterFactory(opts.RateLimit, opts.RedisClient, opts.KeyNamespace)
+	routing, err := newRoutingConfig(opts.RPCMethodMappings, opts.RateLimit, limiterFactory)
+	if err != nil {
+		return nil, err
+	}
+
+	authKeyPolicies, err := newAuthKeyPolicies(opts.AuthKeys, limiterFactory)
+	if err != nil {
+		return nil, err
+	}
+
+	var quotaTracker *QuotaTracker
+	for alias, policy := range authKeyPolicies {
+		if len(policy.quotas) == 0 {
+			continue
+		}
+		if opts.RedisClient == nil {
+			return nil, fmt.Errorf("quotas of auth key %s require redis", alias)
+		}
+		quotaTracker = NewQuotaTracker(opts.RedisClient, opts.KeyNamespace)
+	}
+	computeUnits, err := newComputeUnits(opts.ComputeUnits)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateRateLimitAlgorithm(opts.SenderRateLimit.Algorithm); err != nil {
+		return nil, err
+	}
+	senderLimitConfig := opts.RateLimit
+	senderLimitConfig.Algorithm = opts.SenderRateLimit.Algorithm
+	senderLimiterFactory := newLimiterFactory(senderLimitConfig, opts.RedisClient, opts.KeyNamespace)
+
+	var senderLim FrontendRateLimiter
+	if opts.SenderRateLimit.Enabled {
+		senderLim = newDryRunFrontendRateLimiter(
+			senderLimiterFactory(time.Duration(opts.SenderRateLimit.Interval), opts.SenderRateLimit.Limit, "senders"),
+			"senders",
+			opts.SenderRateLimit.DryRun,
+		)
+	}
+
+	var blobSenderLim FrontendRateLimiter
+	if opts.SenderRateLimit.Enabled && opts.SenderRateLimit.BlobLimit > 0 {
+		interval := opts.SenderRateLimit.BlobInterval
+		if interval == 0 {
+			interval = opts.SenderRateLimit.Interval
+		}
+		blobSenderLim = newDryRunFrontendRateLimiter(
+			senderLimiterFactory(time.Duration(interval), opts.SenderRateLimit.BlobLimit, "blob_senders"),
+			"blob_senders",
+			opts.SenderRateLimit.DryRun,
+		)
+	}
+
+	senderAllowlist := make(map[common.Address]bool, len(opts.SenderRateLimit.Allowlist))
+	for _, addr := range opts.SenderRateLimit.Allowlist {
+		if !common.IsHexAddress(addr) {
+			return nil, fmt.Errorf("invalid sender_rate_limit.allowlist address %s", addr)
+		}
+		senderAllowlist[common.HexToAddress(addr)] = true
+	}
+	contractSenderLims := make(map[common.Address]FrontendRateLimiter)
+	if opts.SenderRateLimit.Enabled {
+		for addr, cfg := range opts.SenderRateLimit.ContractLimits {
+			if !common.IsHexAddress(addr) {
+				return nil, fmt.Errorf("invalid sender_rate_limit.contract_limits address %s", addr)
+			}
+			contract := common.HexToAddress(addr)
+			name := "contract_senders:" + contract.Hex()
+			contractSenderLims[contract] = newDryRunFrontendRateLimiter(
+				senderLimiterFactory(time.Duration(cfg.Interval), cfg.Limit, name),
+				name,
+				opts.SenderRateLimit.DryRun,
+			)
+		}
+	}
+
+	var txValidator *TxValidator
+	if opts.TxValidation.Enabled {
+		txValidator = NewTxValidator(opts.TxValidation)
+	}
+
+	var txPolicy *TxPolicy
+	if opts.TxPolicy.Enabled {
+		if txPolicy, err = NewTxPolicy(opts.TxPolicy, opts.RedisClient); err != nil {
+			return nil, err
+		}
+	}
+
+	var txDedup *RawTxDeduplicator
+	if opts.TxDedup.Enabled {
+		txDedup = NewRawTxDeduplicator(opts.TxDedup, opts.Timeout)
+	}
+
+	var txNonce *TxNonceTracker
+	if opts.TxNonce.Enabled {
+		groupName := opts.TxNonce.BackendGroup
+		if groupName == "" {
+			groupName = opts.RPCMethodMappings["eth_getTransactionCount"]
+		}
+		group := opts.BackendGroups[groupName]
+		if group == nil {
+			return nil, fmt.Errorf("tx_nonce backend group %q does not exist", groupName)
+		}
+		txNonce = NewTxNonceTracker(opts.TxNonce, group, opts.RedisClient, opts.KeyNamespace)
+	}
+
+	var conditionalTx *ConditionalTxRouter
+	if opts.ConditionalTx.Enabled {
+		if opts.BackendGroups[opts.ConditionalTx.BackendGroup] == nil {
+			return nil, fmt.Errorf("conditional_tx backend group %q does not exist", opts.ConditionalTx.BackendGroup)
+		}
+		conditionalTx = NewConditionalTxRouter(opts.ConditionalTx)
+	}
+
+	var bundler *BundlerRouter
+	if opts.Bundler.Enabled {
+		if opts.BackendGroups[opts.Bundler.BackendGroup] == nil {
+			return nil, fmt.Errorf("bundler backend group %q does not exist", opts.Bundler.BackendGroup)
+		}
+		if bundler, err = NewBundlerRouter(opts.Bundler); err != nil {
+			return nil, err
+		}
+	}
+
+	var localResponder *LocalResponder
+	if opts.LocalMethods.Enabled {
+		localResponder = NewLocalResponder(opts.LocalMethods)
+	}
+
+	transformer, err := NewResponseTransformer(opts.ResponseTransforms)
+	if err != nil {
+		return nil, err
+	}
+
+	var paramValidator *ParamValidator
+	if opts.ParamValidation.Enabled {
+		paramValidator = NewParamValidator(opts.ParamValidation)
+	}
+
+	var scriptEngine *ScriptEngine
+	if opts.Scripting.Enabled {
+		groups := make([]string, 0, len(opts.BackendGroups))
+		for name := range opts.BackendGroups {
+			groups = append(groups, name)
+		}
+		if scriptEngine, err = NewScriptEngine(opts.Scripting, groups); err != nil {
+			return nil, err
+		}
+	}
+
+	var privateTx *PrivateTxRelay
+	if opts.PrivateTx.Enabled {
+		if privateTx, err = NewPrivateTxRelay(opts.PrivateTx); err != nil {
+			return nil, err
+		}
+	}
+
+	rateLimitHeader := defaultRateLimitHeader
+	if opts.RateLimit.IPHeaderOverride != "" {
+		rateLimitHeader = opts.RateLimit.IPHeaderOverride
+	}
+
+	var upgradeHinter *UpgradeHinter
+	if opts.UpgradeHints.Enabled {
+		interval := defaultUpgradeHintsInterval
+		if opts.UpgradeHints.Interval != 0 {
+			interval = time.Duration(opts.UpgradeHints.Interval)
+		}
+		threshold := defaultUpgradeHintsThreshold
+		if opts.UpgradeHints.Threshold != 0 {
+			threshold = opts.UpgradeHints.Threshold
+		}
+		var rejectLim FrontendRateLimiter
+		if opts.UpgradeHints.RejectThreshold > 0 {
+			rejectLim = limiterFactory(interval, opts.UpgradeHints.RejectThreshold, "upgrade_reject")
+		}
+		upgradeHinter = NewUpgradeHinter(
+			opts.UpgradeHints.Methods,
+			limiterFactory(interval, threshold, "upgrade_hint"),
+			rejectLim,
+			opts.UpgradeHints.WSURL,
+			opts.UpgradeHints.AltSvc,
+			interval,
+		)
+	}
+
+	var coalescer *RequestCoalescer
+	if opts.RequestCoalescing.Enabled {
+		if coalescer, err = NewRequestCoalescer(opts.RequestCoalescing.Methods, opts.Timeout); err != nil {
+			return nil, err
+		}
+	}
+
+	var peering *Peering
+	if opts.Peering.Enabled {
+		if peering, err = NewPeering(opts.Peering, opts.Timeout); err != nil {
+			return nil, err
+		}
+	}
+
+	wsMessageLimiter, err := NewWSMessageRateLimiter(opts.WSMessageRateLimit, limiterFactory)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateWSConnsConfig(opts.WSConns); err != nil {
+		return nil, err
+	}
+	wsCompression, err := NewWSCompression(opts.WSCompression)
+	if err != nil {
+		return nil, err
+	}
+
+	var priorities *PriorityClassifier
+	if opts.Priority.Enabled {
+		if priorities, err = NewPriorityClassifier(opts.Priority, opts.AuthKeys); err != nil {
+			return nil, err
+		}
+	}
+
+	var wsSessions *WSSessionStore
+	if opts.WSSessions.Enabled {
+		wsSessions = NewWSSessionStore(opts.WSSessions)
+	}
+
+	frontendTLS, err := NewFrontendTLSConfig(opts.TLS)
+	if err != nil {
+		return nil, err
+	}
+	clientCertAuth, err := newClientCertAuth(opts.TLS.ClientAuth)
+	if err != nil {
+		return nil, err
+	}
+	jwtAuth, err := newJWTAuth(opts.JWTAuth, opts.AuthKeys)
+	if err != nil {
+		return nil, err
+	}
+	var apiKeys *APIKeyStore
+	if opts.APIKeys.Enabled {
+		if opts.RedisClient == nil {
+			return nil, errors.New("api_keys requires redis")
+		}
+		apiKeys = NewAPIKeyStore(opts.RedisClient, opts.KeyNamespace, opts.APIKeys)
+	}
+	geoip, err := NewGeoIP(opts.GeoIP, opts.AuthKeys, limiterFactory)
+	if err != nil {
+		return nil, err
+	}
+	proxyProtocol, err := newProxyProtocol(opts.ProxyProtocol)
+	if err != nil {
+		return nil, err
+	}
+	clientIP, err := newClientIPResolver(rateLimitHeader, opts.TrustedProxyCIDRs, proxyProtocol != nil)
+	if err != nil {
+		return nil, err
+	}
+	abuse, err := NewAbuseDetector(opts.Abuse, limiterFactory)
+	if err != nil {
+		return nil, err
+	}
+	accessLog, err := NewAccessLog(opts.AccessLog)
+	if err != nil {
+		return nil, err
+	}
+
+	var sse *sseStreams
+	if opts.SSE.Enabled {
+		sse = newSSEStreams(opts.SSE)
+	}
+
+	var wsMux *WSSubscriptionMux
+	if opts.WSMultiplex.Enabled {
+		wsMux = NewWSSubscriptionMux(opts.WSMultiplex)
+		if opts.WSFailover.Enabled && opts.WSFailover.GapFill {
+			wsMux.enableGapFill(opts.WSFailover.maxGapBlocks())
+		}
+	}
+
+	etagMinBytes := defaultETagMinBytes
+	if opts.ETag.MinBytes > 0 {
+		etagMinBytes = opts.ETag.MinBytes
+	}
+
+	var trafficRecorder *TrafficRecorder
+	if opts.Metering.Enabled {
+		sampleRate := defaultMeteringSampleRate
+		if opts.Metering.SampleRate > 0 {
+			sampleRate = opts.Metering.SampleRate
+		}
+		window := defaultMeteringWindow
+		if opts.Metering.Window != 0 {
+			window = time.Duration(opts.Metering.Window)
+		}
+		trafficRecorder = NewTrafficRecorder(sampleRate, window)
+	}
+
+	srv := &Server{
+		BackendGroups:        opts.BackendGroups,
+		wsBackendGroup:       opts.WSBackendGroup,
+		wsMethodWhitelist:    opts.WSMethodWhitelist,
+		maxBodySize:          opts.MaxBodySize,
+		authenticatedPaths:   opts.AuthenticatedPaths,
+		authKeyPolicies:      authKeyPolicies,
+		timeout:              opts.Timeout,
+		maxUpstreamBatchSize: opts.MaxUpstreamBatchSize,
+		enableServedByHeader: opts.EnableServedByHeader,
+		cache:                opts.Cache,
+		enableRequestLog:     opts.EnableRequestLog,
+		maxRequestBodyLogLen: opts.MaxRequestBodyLogLen,
+		maxBatchSize:         opts.MaxBatchSize,
+		upgrader: &websocket.Upgrader{
+			HandshakeTimeout:  defaultWSHandshakeTimeout,
+			WriteBufferSize:   opts.WSConns.Client.MaxFrameSize,
+			EnableCompression: wsCompression != nil,
+		},
+		senderLim:       senderLim,
+		blobSenderLim:   blobSenderLim,
+		senderExtractor: NewTxTypeSenderExtractor(),
+		allowedChainIds: opts.SenderRateLimit.AllowedChainIds,
+		upgradeHinter:   upgradeHinter,
+		coalescer:       coalescer,
+		redisClient:     opts.RedisClient,
+		quotaTracker:    quotaTracker,
+		computeUnits:    computeUnits,
+		trafficRecorder: trafficRecorder,
+		peering:         peering,
+		wsSessions:      wsSessions,
+		wsMux:           wsMux,
+		wsFailover:      opts.WSFailover,
+		wsClientConn:    opts.WSConns.Client,
+		wsCompression:   wsCompression,
+		sse:             sse,
+		tlsConfig:       frontendTLS,
+		clientCertAuth:  clientCertAuth,
+		jwtAuth:         jwtAuth,
+		apiKeys:         apiKeys,
+		geoip:           geoip,
+		proxyProtocol:   proxyProtocol,
+		clientIP:        clientIP,
+		abuse:           abuse,
+		accessLog:       accessLog,
+		enableETags:     opts.ETag.Enabled,
+		cacheDebugHdr:   opts.CacheDebugHeader,
+		etagMinBytes:    etagMinBytes,
+		finalityTags:    opts.FinalityTags,
+
+		senderAllowlist:     senderAllowlist,
+		contractSenderLims:  contractSenderLims,
+		txValidator:         txValidator,
+		txPolicy:            txPolicy,
+		txDedup:             txDedup,
+		txNonce:             txNonce,
+		conditionalTx:       conditionalTx,
+		bundler:             bundler,
+		privateTx:           privateTx,
+		localResponder:      localResponder,
+		lvcResponder:        opts.LVCResponder,
+		getLogsLimiter:      NewGetLogsLimiter(opts.GetLogsLimits, opts.AuthKeys),
+		paramValidator:      paramValidator,
+		scriptEngine:        scriptEngine,
+		getLatestBlockNumFn: opts.GetLatestBlockNumFn,
+		wsConnLimiter:       NewWSConnLimiter(opts.WSConnLimits),
+		wsMessageLimiter:    wsMessageLimiter,
+		priorities:          priorities,
+
+		enableRPCDiscover: opts.EnableRPCDiscover,
+		projector:         NewResponseProjector(opts.ResponseProjections),
+		transformer:       transformer,
+		keepaliveInterval: opts.KeepaliveInterval,
+		keepaliveMethods:  NewStringSetFromStrings(opts.KeepaliveMethods),
+	}
+	srv.routing.Store(routing)
+	srv.reloader = NewConfigReloader(srv, opts.HotReload)
+	if srv.cors, err = srv.newCORS(opts.CORS); err != nil {
+		return nil, err
+	}
+	if srv.wsMessagePolicy, err = NewWSMessagePolicy(opts.WSMessagePolicy, srv); err != nil {
+		return nil, err
+	}
+	if opts.WSDrain.Enabled {
+		srv.wsDrainer = newWSDrainer(opts.WSDrain)
+	}
+	if opts.FilterEmulation.Enabled {
+		filters := NewFilterEmulator(opts.FilterEmulation, opts.RedisClient, opts.KeyNamespace, func(ctx context.Context, reqs []*RPCReq) ([]*RPCRes, error) {
+			return srv.callInternal(ctx, srv.routing.Load(), reqs)
+		})
+		for method, handler := range filters.Handlers() {
+			srv.RegisterMethod(method, handler)
+		}
+	}
+	if txPolicy != nil {
+		if err := txPolicy.Start(context.Background()); err != nil {
+			return nil, err
+		}
+	}
+	return srv, nil
+}
+
 func (s *Server) RPCListenAndServe(host string, port int) error {
 	s.srvMu.Lock()
 	hdlr := mux.NewRouter()
 	hdlr.HandleFunc("/healthz", s.HandleHealthz).Methods("GET")
 	hdlr.HandleFunc("/", s.HandleRPC).Methods("POST")
 	hdlr.HandleFunc("/{authorization}", s.HandleRPC).Methods("POST")
-	c := cors.New(cors.Options{
-		AllowedOrigins: []string{"*"},
-	})
+	hdlr.HandleFunc("/usage", s.HandleUsage).Methods("GET")
+	hdlr.HandleFunc("/{authorization}/usage", s.HandleUsage).Methods("GET")
+	if s.sse != nil {
+		hdlr.HandleFunc("/subscribe/{type}", s.HandleSSE).Methods("GET")
+		hdlr.HandleFunc("/{authorization}/subscribe/{type}", s.HandleSSE).Methods("GET")
+	}
 	addr := fmt.Sprintf("%s:%d", host, port)
 	s.rpcServer = &http.Server{
-		Handler: instrumentedHdlr(c.Handler(hdlr)),
-		Addr:    addr,
+		Handler:   instrumentedHdlr(s.withHTTPMiddlewares(s.cors.Handler(hdlr))),
+		Addr:      addr,
+		TLSConfig: s.tlsConfig,
 	}
-	log.Info("starting HTTP server", "addr", addr)
+	log.Info("starting HTTP server", "addr", addr, "tls", s.tlsConfig != nil, "proxy_protocol", s.proxyProtocol != nil)
 	s.srvMu.Unlock()
-	return s.rpcServer.ListenAndServe()
+	ln, err := s.proxyProtocol.listen(addr)
+	if err != nil {
+		return err
+	}
+	if s.tlsConfig != nil {
+		return s.rpcServer.ServeTLS(ln, "", "")
+	}
+	return s.rpcServer.Serve(ln)
 }
 
 func (s *Server) WSListenAndServe(host string, port int) error {
@@ -233,26 +824,80 @@ func (s *Server) WSListenAndServe(host string, port int) error {
 	})
 	addr := fmt.Sprintf("%s:%d", host, port)
 	s.wsServer = &http.Server{
-		Handler: instrumentedHdlr(c.Handler(hdlr)),
-		Addr:    addr,
+		Handler:   instrumentedHdlr(s.withHTTPMiddlewares(c.Handler(hdlr))),
+		Addr:      addr,
+		TLSConfig: s.tlsConfig,
 	}
-	log.Info("starting WS server", "addr", addr)
+	log.Info("starting WS server", "addr", addr, "tls", s.tlsConfig != nil, "proxy_protocol", s.proxyProtocol != nil)
 	s.srvMu.Unlock()
-	return s.wsServer.ListenAndServe()
+	ln, err := s.proxyProtocol.listen(addr)
+	if err != nil {
+		return err
+	}
+	if s.tlsConfig != nil {
+		return s.wsServer.ServeTLS(ln, "", "")
+	}
+	return s.wsServer.Serve(ln)
+}
+
+// authPaths returns the aliases of the auth secrets of the config, by secret.
+func (s *Server) authPaths() map[string]string {
+	s.authMtx.RLock()
+	defer s.authMtx.RUnlock()
+	return s.authenticatedPaths
+}
+
+// RotateAuthSecret replaces the auth secret old by new, keeping its alias.
+func (s *Server) RotateAuthSecret(old, new string) {
+	s.authMtx.Lock()
+	defer s.authMtx.Unlock()
+	alias, ok := s.authenticatedPaths[old]
+	if !ok {
+		return
+	}
+	paths := make(map[string]string, len(s.authenticatedPaths))
+	for secret, a := range s.authenticatedPaths {
+		if secret != old {
+			paths[secret] = a
+		}
+	}
+	paths[new] = alias
+	s.authenticatedPaths = paths
+	log.Info("rotated auth secret", "alias", alias)
 }
 
 func (s *Server) Shutdown() {
 	s.srvMu.Lock()
 	defer s.srvMu.Unlock()
+	// streams would hold up the shutdown of the RPC server
+	if s.sse != nil {
+		s.sse.stop()
+	}
 	if s.rpcServer != nil {
 		_ = s.rpcServer.Shutdown(context.Background())
 	}
 	if s.wsServer != nil {
 		_ = s.wsServer.Shutdown(context.Background())
 	}
+	// the WS server doesn't track upgraded connections
+	if s.wsDrainer != nil {
+		s.wsDrainer.drain()
+	}
+	if s.adminServer != nil {
+		_ = s.adminServer.Shutdown(context.Background())
+	}
 	for _, bg := range s.BackendGroups {
 		bg.Shutdown()
 	}
+	if s.wsMux != nil {
+		s.wsMux.Stop()
+	}
+	if s.txPolicy != nil {
+		s.txPolicy.Stop()
+	}
+	if s.accessLog != nil {
+		s.accessLog.Close()
+	}
 }
 
 func (s *Server) HandleHealthz(w http.ResponseWriter, r *http.Request) {
@@ -260,7 +905,15 @@ func (s *Server) HandleHealthz(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) HandleRPC(w http.ResponseWriter, r *http.Request) {
-	ctx := s.populateContext(w, r)
+	var ctx context.Context
+	if s.accessLog != nil {
+		var logAccess func(context.Context)
+		w, r, logAccess = s.accessLog.begin(w, r)
+		defer func() {
+			logAccess(ctx)
+		}()
+	}
+	ctx = s.populateContext(w, r)
 	if ctx == nil {
 		return
 	}
@@ -270,10 +923,14 @@ func (s *Server) HandleRPC(w http.ResponseWriter, r *http.Request) {
 
 	origin := r.Header.Get("Origin")
 	userAgent := r.Header.Get("User-Agent")
-	// Use XFF in context since it will automatically be replaced by the remote IP
-	xff := stripXFF(GetXForwardedFor(ctx))
-	isUnlimitedOrigin := s.isUnlimitedOrigin(origin)
-	isUnlimitedUserAgent := s.isUnlimitedUserAgent(userAgent)
+	// the client IP in context is the trusted address, see clientIPResolver
+	xff := GetXForwardedFor(ctx)
+	routing := s.routing.Load()
+	isUnlimitedOrigin := routing.isUnlimitedOrigin(origin)
+	isUnlimitedUserAgent := routing.isUnlimitedUserAgent(userAgent)
+	ip := GetClientIP(ctx)
+	isUnlimitedIP := routing.isUnlimitedIP(ip)
+	policy := s.authKeyPolicy(ctx)
 
 	if xff == "" {
 		writeRPCError(ctx, w, nil, ErrInvalidRequest("request does not include a remote IP"))
@@ -281,27 +938,48 @@ func (s *Server) HandleRPC(w http.ResponseWriter, r *http.Request) {
 	}
 
 	isLimited := func(method string) bool {
-		isGloballyLimitedMethod := s.isGlobalLimit(method)
-		if !isGloballyLimitedMethod && (isUnlimitedOrigin || isUnlimitedUserAgent) {
+		isGloballyLimitedMethod := routing.isGlobalLimit(method)
+		if !isGloballyLimitedMethod && (isUnlimitedOrigin || isUnlimitedUserAgent || isUnlimitedIP) {
 			return false
 		}
 
 		var lim FrontendRateLimiter
+		key := xff
 		if method == "" {
-			lim = s.mainLim
+			lim = routing.baseLimiter(ip)
+			if policy != nil && policy.rateLim != nil {
+				// the clients of a key share its limit
+				lim = policy.rateLim
+				key = "auth:" + GetAuthCtx(ctx)
+			}
 		} else {
-			lim = s.overrideLims[method]
+			lim = routing.overrideLims[method]
 		}
 
 		if lim == nil {
 			return false
 		}
 
-		ok, err := lim.Take(ctx, xff)
+		if auth, ok := ctx.Value(ContextKeyAuth).(string); ok && routing.authKeyLimitedMethods[method] {
+			key = "auth:" + auth
+		}
+		ok, status, err := takeRateLimit(ctx, lim, key)
 		if err != nil {
 			log.Warn("error taking rate limit", "err", err)
 			return true
 		}
+		// clients get the status of the base limit, or of the limit that
+		// rejected their request
+		if status != nil && (method == "" || !ok) {
+			setRateLimitHeaders(w, status, !ok)
+		}
+		if !ok {
+			reason := AuthRejectionRateLimit
+			if method != "" {
+				reason = AuthRejectionMethodRateLimit
+			}
+			RecordAuthRejection(GetAuthCtx(ctx), reason)
+		}
 		return !ok
 	}
 
@@ -355,13 +1033,18 @@ func (s *Server) HandleRPC(w http.ResponseWriter, r *http.Request) {
 		if err != nil {
 			log.Error("error parsing batch RPC request", "err", err)
 			RecordRPCError(ctx, BackendProxyd, MethodUnknown, err)
+			s.abuse.Observe(ctx, []string{""}, []*RPCRes{nil})
 			writeRPCError(ctx, w, nil, ErrParseErr)
 			return
 		}
 
 		RecordBatchSize(len(reqs))
 
-		if len(reqs) > s.maxBatchSize {
+		maxBatchSize := s.maxBatchSize
+		if policy != nil && policy.maxBatchSize > 0 {
+			maxBatchSize = policy.maxBatchSize
+		}
+		if len(reqs) > maxBatchSize {
 			RecordRPCError(ctx, BackendProxyd, MethodUnknown, ErrTooManyBatchRequests)
 			writeRPCError(ctx, w, nil, ErrTooManyBatchRequests)
 			return
@@ -372,7 +1055,26 @@ func (s *Server) HandleRPC(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		batchRes, batchContainsCached, servedBy, err := s.handleBatchRPC(ctx, reqs, isLimited, true)
+		if !s.takeQuota(ctx, w, routing, policy, reqs) {
+			return
+		}
+
+		if r.Header.Get(SnapshotHeader) == "true" {
+			ctx = context.WithValue(ctx, ContextKeySnapshot, &Snapshot{}) // nolint:staticcheck
+		}
+
+		if s.needsKeepalive(reqs) {
+			if kw := newKeepaliveWriter(w, s.keepaliveInterval); kw != nil {
+				defer kw.Stop()
+				w = kw
+			}
+		}
+
+		batchRes, cacheResult, servedBy, err := s.handleBatchRPC(ctx, routing, reqs, isLimited, true)
+		if kw, ok := w.(*keepaliveWriter); ok {
+			kw.Stop()
+		}
+		s.reloader.RecordResponses(batchRes, len(reqs), err)
 		if err == context.DeadlineExceeded {
 			writeRPCError(ctx, w, nil, ErrGatewayTimeout)
 			return
@@ -386,16 +1088,53 @@ func (s *Server) HandleRPC(w http.ResponseWriter, r *http.Request) {
 			writeRPCError(ctx, w, nil, ErrInternal)
 			return
 		}
+		setAccessLogBackend(ctx, servedBy)
 		if s.enableServedByHeader {
 			w.Header().Set("x-served-by", servedBy)
 		}
-		setCacheHeader(w, batchContainsCached)
+		if snapshot := GetSnapshot(ctx); snapshot != nil && snapshot.Block != 0 {
+			w.Header().Set(SnapshotBlockHeader, snapshot.Block.String())
+		}
+		s.setCacheHeaders(w, cacheResult)
+		if cacheResult == CacheResultHit && s.enableETags && !keepaliveStarted(w) {
+			s.writeETagRes(ctx, w, r, batchRes)
+			return
+		}
 		writeBatchRPCRes(ctx, w, batchRes)
 		return
 	}
 
 	rawBody := json.RawMessage(body)
-	backendRes, cached, servedBy, err := s.handleBatchRPC(ctx, []json.RawMessage{rawBody}, isLimited, false)
+
+	if !s.takeQuota(ctx, w, routing, policy, []json.RawMessage{rawBody}) {
+		return
+	}
+
+	upgradeHint := UpgradeHintNone
+	if s.upgradeHinter != nil {
+		if req, err := ParseRPCReq(rawBody); err == nil {
+			upgradeHint = s.upgradeHinter.Check(ctx, xff, req.Method)
+			s.upgradeHinter.SetHeaders(w, upgradeHint)
+			if upgradeHint == UpgradeHintRequire {
+				RecordRPCError(ctx, BackendProxyd, req.Method, ErrUpgradeRequired)
+				writeRPCError(ctx, w, req.ID, ErrUpgradeRequired)
+				return
+			}
+		}
+	}
+
+	if s.needsKeepalive([]json.RawMessage{rawBody}) {
+		if kw := newKeepaliveWriter(w, s.keepaliveInterval); kw != nil {
+			defer kw.Stop()
+			w = kw
+		}
+	}
+
+	backendRes, cacheResult, servedBy, err := s.handleBatchRPC(ctx, routing, []json.RawMessage{rawBody}, isLimited, false)
+	if kw, ok := w.(*keepaliveWriter); ok {
+		kw.Stop()
+	}
+	s.reloader.RecordResponses(backendRes, 1, err)
 	if err != nil {
 		if errors.Is(err, ErrConsensusGetReceiptsCantBeBatched) ||
 			errors.Is(err, ErrConsensusGetReceiptsInvalidTarget) {
@@ -405,14 +1144,19 @@ func (s *Server) HandleRPC(w http.ResponseWriter, r *http.Request) {
 		writeRPCError(ctx, w, nil, ErrInternal)
 		return
 	}
+	setAccessLogBackend(ctx, servedBy)
 	if s.enableServedByHeader {
 		w.Header().Set("x-served-by", servedBy)
 	}
-	setCacheHeader(w, cached)
+	s.setCacheHeaders(w, cacheResult)
+	if cacheResult == CacheResultHit && s.enableETags && !backendRes[0].IsError() && !keepaliveStarted(w) {
+		s.writeETagRes(ctx, w, r, backendRes[0])
+		return
+	}
 	writeRPCRes(ctx, w, backendRes[0])
 }
 
-func (s *Server) handleBatchRPC(ctx context.Context, reqs []json.RawMessage, isLimited limiterFunc, isBatch bool) ([]*RPCRes, bool, string, error) {
+func (s *Server) handleBatchRPC(ctx context.Context, routing *routingConfig, reqs []json.RawMessage, isLimited limiterFunc, isBatch bool) ([]*RPCRes, string, string, error) {
 	// A request set is transformed into groups of batches.
 	// Each batch group maps to a forwarded JSON-RPC batch request (subject to maxUpstreamBatchSize constraints)
 	// A groupID is used to decouple Requests that have duplicate ID so they're not part of the same batch that's
@@ -425,8 +1169,13 @@ func (s *Server) handleBatchRPC(ctx context.Context, reqs []json.RawMessage, isL
 	}
 
 	responses := make([]*RPCRes, len(reqs))
+	methods := make([]string, len(reqs))
+	parsedReqs := make([]*RPCReq, len(reqs))
 	batches := make(map[batchGroup][]batchElem)
 	ids := make(map[string]int, len(reqs))
+	// senders of the raw transactions accepted for forwarding, by index, whose
+	// nonces are tracked
+	var txSenders map[int]*TxSender
 
 	for i := range reqs {
 		parsedReq, err := ParseRPCReq(reqs[i])
@@ -435,31 +1184,138 @@ func (s *Server) handleBatchRPC(ctx context.Context, reqs []json.RawMessage, isL
 			responses[i] = NewRPCErrorRes(nil, err)
 			continue
 		}
+		methods[i] = parsedReq.Method
+
+		// Simple health check
+		if len(reqs) == 1 && parsedReq.Method == proxydHealthzMethod {
+			res := &RPCRes{
+				ID:      parsedReq.ID,
+				JSONRPC: JSONRPCVersion,
+				Result:  "OK",
+			}
+			return []*RPCRes{res}, CacheResultMiss, "", nil
+		}
+
+		if err := ValidateRPCReq(parsedReq); err != nil {
+			RecordRPCError(ctx, BackendProxyd, MethodUnknown, err)
+			responses[i] = NewRPCErrorRes(nil, err)
+			continue
+		}
+		parsedReqs[i] = parsedReq
+
+		if res := s.runRequestHooks(ctx, parsedReq); res != nil {
+			responses[i] = res
+			continue
+		}
+		// hooks may have rewritten the request
+		methods[i] = parsedReq.Method
+
+		var scriptGroup string
+		if s.scriptEngine != nil {
+			decision, err := s.scriptEngine.Run(ctx, parsedReq)
+			if err != nil {
+				log.Warn("error running request script", "method", parsedReq.Method, "err", err, "req_id", GetReqID(ctx))
+			}
+			if decision == nil {
+				RecordRPCError(ctx, BackendProxyd, parsedReq.Method, ErrInternal)
+				responses[i] = NewRPCErrorRes(parsedReq.ID, ErrInternal)
+				continue
+			}
+			if decision.Reject != nil {
+				log.Info("request rejected by script", "method", parsedReq.Method, "req_id", GetReqID(ctx), "auth", GetAuthCtx(ctx))
+				RecordRPCError(ctx, BackendProxyd, parsedReq.Method, decision.Reject)
+				responses[i] = NewRPCErrorRes(parsedReq.ID, decision.Reject)
+				continue
+			}
+			scriptGroup = decision.Group
+			methods[i] = parsedReq.Method
+		}
+
+		if parsedReq.Method == "eth_accounts" {
+			RecordRPCForward(ctx, BackendProxyd, "eth_accounts", RPCRequestSourceHTTP)
+			responses[i] = NewRPCRes(parsedReq.ID, emptyArrayResponse)
+			continue
+		}
+
+		if s.localResponder != nil {
+			if res, ok := s.localResponder.Respond(parsedReq); ok {
+				RecordRPCForward(ctx, BackendProxyd, parsedReq.Method, RPCRequestSourceHTTP)
+				responses[i] = res
+				continue
+			}
+		}
+
+		if s.lvcResponder != nil {
+			if res, ok := s.lvcResponder.Respond(parsedReq); ok {
+				RecordRPCForward(ctx, BackendProxyd, parsedReq.Method, RPCRequestSourceHTTP)
+				responses[i] = res
+				continue
+			}
+		}
+
+		if parsedReq.Method == RPCDiscoverMethod && s.enableRPCDiscover {
+			RecordRPCForward(ctx, BackendProxyd, RPCDiscoverMethod, RPCRequestSourceHTTP)
+			responses[i] = NewRPCRes(parsedReq.ID, s.openRPCDocument(routing))
+			continue
+		}
+
+		if isEngineMethod(parsedReq.Method) && !s.authKeyPolicy(ctx).allowsEngineAPI() {
+			log.Info(
+				"blocked engine API request for auth key",
+				"source", "rpc",
+				"req_id", GetReqID(ctx),
+				"auth", GetAuthCtx(ctx),
+				"method", parsedReq.Method,
+			)
+			RecordRPCError(ctx, BackendProxyd, MethodUnknown, ErrMethodNotWhitelisted)
+			responses[i] = NewRPCErrorRes(parsedReq.ID, ErrMethodNotWhitelisted)
+			continue
+		}
+
+		if policy := s.authKeyPolicy(ctx); policy != nil && !policy.allowsMethod(parsedReq.Method) {
+			log.Info(
+				"blocked request for method not allowed for auth key",
+				"source", "rpc",
+				"req_id", GetReqID(ctx),
+				"auth", GetAuthCtx(ctx),
+				"method", parsedReq.Method,
+			)
+			// only mapped methods are labeled, to bound the cardinality
+			deniedMethod := MethodUnknown
+			if _, ok := routing.rpcMethodMappings[parsedReq.Method]; ok {
+				deniedMethod = parsedReq.Method
+			}
+			RecordAuthKeyMethodDenial(GetAuthCtx(ctx), deniedMethod, RPCRequestSourceHTTP)
+			RecordRPCError(ctx, BackendProxyd, MethodUnknown, ErrMethodNotWhitelisted)
+			responses[i] = NewRPCErrorRes(parsedReq.ID, ErrMethodNotWhitelisted)
+			continue
+		}
 
-		// Simple health check
-		if len(reqs) == 1 && parsedReq.Method == proxydHealthzMethod {
-			res := &RPCRes{
-				ID:      parsedReq.ID,
-				JSONRPC: JSONRPCVersion,
-				Result:  "OK",
+		if s.geoip != nil {
+			if err := s.geoip.check(ctx, parsedReq.Method); err != nil {
+				RecordRPCError(ctx, BackendProxyd, MethodUnknown, err)
+				responses[i] = NewRPCErrorRes(parsedReq.ID, err)
+				continue
 			}
-			return []*RPCRes{res}, false, "", nil
 		}
 
-		if err := ValidateRPCReq(parsedReq); err != nil {
-			RecordRPCError(ctx, BackendProxyd, MethodUnknown, err)
-			responses[i] = NewRPCErrorRes(nil, err)
-			continue
+		group := routing.rpcMethodMappings[parsedReq.Method]
+		if parsedReq.Method == ConditionalTxMethod && s.conditionalTx != nil {
+			group = s.conditionalTx.Group()
 		}
-
-		if parsedReq.Method == "eth_accounts" {
-			RecordRPCForward(ctx, BackendProxyd, "eth_accounts", RPCRequestSourceHTTP)
-			responses[i] = NewRPCRes(parsedReq.ID, emptyArrayResponse)
-			continue
+		if s.bundler != nil && s.bundler.Handles(parsedReq.Method) {
+			group = s.bundler.Group()
 		}
-
-		group := s.rpcMethodMappings[parsedReq.Method]
-		if group == "" {
+		// private transactions fall back to the public path of raw
+		// transactions
+		if parsedReq.Method == PrivateTxMethod && s.privateTx != nil {
+			group = routing.rpcMethodMappings["eth_sendRawTransaction"]
+		}
+		if scriptGroup != "" {
+			group = scriptGroup
+		}
+		methodHandler := s.methodHandlers[parsedReq.Method]
+		if group == "" && methodHandler == nil {
 			// use unknown below to prevent DOS vector that fills up memory
 			// with arbitrary method names.
 			log.Info(
@@ -469,15 +1325,32 @@ func (s *Server) handleBatchRPC(ctx context.Context, reqs []json.RawMessage, isL
 				"method", parsedReq.Method,
 			)
 			RecordRPCError(ctx, BackendProxyd, MethodUnknown, ErrMethodNotWhitelisted)
+			if s.trafficRecorder != nil {
+				s.trafficRecorder.RecordUnmapped(parsedReq.Method)
+			}
 			responses[i] = NewRPCErrorRes(parsedReq.ID, ErrMethodNotWhitelisted)
 			continue
 		}
 
+		if s.paramValidator != nil {
+			if err := s.paramValidator.Validate(parsedReq); err != nil {
+				log.Debug("invalid request params", "method", parsedReq.Method, "err", err, "req_id", GetReqID(ctx))
+				RecordParamValidationRejection(parsedReq.Method)
+				RecordRPCError(ctx, BackendProxyd, parsedReq.Method, err)
+				responses[i] = NewRPCErrorRes(parsedReq.ID, err)
+				continue
+			}
+		}
+
+		if s.trafficRecorder != nil {
+			s.trafficRecorder.Record(ctx, parsedReq.Method)
+		}
+
 		// Take rate limit for specific methods.
 		// NOTE: eventually, this should apply to all batch requests. However,
 		// since we don't have data right now on the size of each batch, we
 		// only apply this to the methods that have an additional rate limit.
-		if _, ok := s.overrideLims[parsedReq.Method]; ok && isLimited(parsedReq.Method) {
+		if _, ok := routing.overrideLims[parsedReq.Method]; ok && isLimited(parsedReq.Method) {
 			log.Info(
 				"rate limited specific RPC",
 				"source", "rpc",
@@ -489,15 +1362,97 @@ func (s *Server) handleBatchRPC(ctx context.Context, reqs []json.RawMessage, isL
 			continue
 		}
 
-		// Apply a sender-based rate limit if it is enabled. Note that sender-based rate
-		// limits apply regardless of origin or user-agent. As such, they don't use the
-		// isLimited method.
-		if parsedReq.Method == "eth_sendRawTransaction" && s.senderLim != nil {
-			if err := s.rateLimitSender(ctx, parsedReq); err != nil {
+		if methodHandler != nil {
+			responses[i] = s.serveMethod(ctx, methodHandler, parsedReq)
+			continue
+		}
+
+		if parsedReq.Method == "eth_getLogs" && s.getLogsLimiter != nil {
+			if limit, err := s.getLogsLimiter.Check(ctx, parsedReq, s.latestBlockNumber(group)); err != nil {
+				if limit == GetLogsLimitBlockRange {
+					if subReqs, ok := s.getLogsLimiter.Split(ctx, parsedReq, s.latestBlockNumber(group)); ok {
+						responses[i] = s.forwardSplitLogs(ctx, group, parsedReq, subReqs)
+						continue
+					}
+				}
+				log.Debug("eth_getLogs request over limit", "limit", limit, "err", err, "req_id", GetReqID(ctx))
+				RecordGetLogsLimitRejection(limit)
+				RecordRPCError(ctx, BackendProxyd, parsedReq.Method, err)
+				responses[i] = NewRPCErrorRes(parsedReq.ID, err)
+				continue
+			}
+		}
+
+		// Answer re-submissions of a raw transaction with the response of the
+		// first one, before they count against the sender rate limits.
+		if s.txDedup != nil {
+			if res, ok := s.txDedup.Get(parsedReq); ok {
+				responses[i] = res
+				continue
+			}
+		}
+
+		if s.bundler != nil && s.bundler.Handles(parsedReq.Method) {
+			if err := s.bundler.Validate(parsedReq); err != nil {
+				log.Debug("invalid bundler request", "method", parsedReq.Method, "err", err, "req_id", GetReqID(ctx))
+				RecordUserOperationRejection(parsedReq.Method)
+				RecordRPCError(ctx, BackendProxyd, parsedReq.Method, err)
+				responses[i] = NewRPCErrorRes(parsedReq.ID, err)
+				continue
+			}
+		}
+
+		// Conditional transactions are checked as raw transactions once their
+		// conditions are validated.
+		txReq := parsedReq
+		if parsedReq.Method == ConditionalTxMethod && s.conditionalTx != nil {
+			if txReq, err = s.checkConditionalTx(ctx, parsedReq); err != nil {
+				RecordRPCError(ctx, BackendProxyd, parsedReq.Method, err)
+				responses[i] = NewRPCErrorRes(parsedReq.ID, err)
+				continue
+			}
+		}
+		if parsedReq.Method == PrivateTxMethod && s.privateTx != nil {
+			if txReq, err = s.privateTx.RawTxReq(parsedReq); err != nil {
+				RecordRPCError(ctx, BackendProxyd, parsedReq.Method, err)
+				responses[i] = NewRPCErrorRes(parsedReq.ID, err)
+				continue
+			}
+		}
+
+		// Validate raw transactions, check them against the transaction policy and
+		// apply a sender-based rate limit if they are enabled. Note that sender-based rate limits apply regardless of origin or
+		// user-agent. As such, they don't use the isLimited method.
+		if txReq.Method == "eth_sendRawTransaction" && (s.senderLim != nil || s.txValidator != nil || s.txPolicy != nil || s.txNonce != nil) {
+			sender, err := s.checkRawTx(ctx, txReq)
+			if err != nil {
 				RecordRPCError(ctx, BackendProxyd, parsedReq.Method, err)
 				responses[i] = NewRPCErrorRes(parsedReq.ID, err)
 				continue
 			}
+			if s.txNonce != nil {
+				if txSenders == nil {
+					txSenders = make(map[int]*TxSender)
+				}
+				txSenders[i] = sender
+			}
+		}
+
+		// Relay private transactions, falling back to the public path as raw
+		// transactions if the relay fails.
+		if s.privateTx != nil && s.privateTx.Handles(parsedReq.Method) {
+			if res := s.relayPrivateTx(ctx, parsedReq); res != nil {
+				responses[i] = res
+				if sender := txSenders[i]; sender != nil && res.Error == nil {
+					s.txNonce.Track(ctx, sender)
+				}
+				continue
+			}
+			parsedReq = txReq
+		}
+
+		if s.finalityTags != nil {
+			s.finalityTags.Rewrite(ctx, parsedReq)
 		}
 
 		id := string(parsedReq.ID)
@@ -508,17 +1463,55 @@ func (s *Server) handleBatchRPC(ctx context.Context, reqs []json.RawMessage, isL
 		batches[batchGroup] = append(batches[batchGroup], batchElem{parsedReq, i})
 	}
 
+	// snapshots are served by a single backend, bypassing the cache
+	if snapshot := GetSnapshot(ctx); snapshot != nil && len(batches) > 0 {
+		var group string
+		var elems []batchElem
+		for bg, batch := range batches {
+			if len(batches) > 1 {
+				for _, elem := range batch {
+					responses[elem.Index] = NewRPCErrorRes(elem.Req.ID, ErrSnapshotNotServable)
+				}
+				continue
+			}
+			group, elems = bg.backendGroup, batch
+		}
+		var servedBy string
+		if elems != nil {
+			servedBy = s.forwardSnapshot(ctx, snapshot, group, elems, responses)
+		}
+		s.transformer.Transform(methods, responses)
+		s.projector.Project(ctx, methods, responses)
+		s.runResponseHooks(ctx, parsedReqs, responses)
+		s.abuse.Observe(ctx, methods, responses)
+		setAccessLogMethods(ctx, methods)
+		return responses, CacheResultMiss, servedBy, nil
+	}
+
 	servedBy := make(map[string]bool, 0)
-	var cached bool
+	// batches are hits if any request is served from the cache
+	cacheResult := CacheResultMiss
+	cacheDirectives := GetCacheDirectives(ctx)
 	for group, batch := range batches {
 		var cacheMisses []batchElem
 
 		for _, req := range batch {
-			backendRes, _ := s.cache.GetRPC(ctx, req.Req)
-			if backendRes != nil {
+			if cacheDirectives.NoCache {
+				cacheMisses = append(cacheMisses, req)
+				continue
+			}
+			lookupCtx, lookup := withCacheLookup(ctx)
+			backendRes, _ := s.cache.GetRPC(lookupCtx, req.Req)
+			switch lookup.result(backendRes) {
+			case CacheResultHit:
 				responses[req.Index] = backendRes
-				cached = true
-			} else {
+				cacheResult = CacheResultHit
+			case CacheResultStale:
+				if cacheResult != CacheResultHit {
+					cacheResult = CacheResultStale
+				}
+				cacheMisses = append(cacheMisses, req)
+			default:
 				cacheMisses = append(cacheMisses, req)
 			}
 		}
@@ -533,18 +1526,18 @@ func (s *Server) handleBatchRPC(ctx context.Context, reqs []json.RawMessage, isL
 					"batch_index", i,
 				)
 				batchRPCShortCircuitsTotal.Inc()
-				return nil, false, "", context.DeadlineExceeded
+				return nil, CacheResultMiss, "", context.DeadlineExceeded
 			}
 
 			start := i * s.maxUpstreamBatchSize
 			end := int(math.Min(float64(start+s.maxUpstreamBatchSize), float64(len(cacheMisses))))
 			elems := cacheMisses[start:end]
-			res, sb, err := s.BackendGroups[group.backendGroup].Forward(ctx, createBatchRequest(elems), isBatch)
+			res, sb, err := s.forward(ctx, group.backendGroup, elems, isBatch)
 			servedBy[sb] = true
 			if err != nil {
 				if errors.Is(err, ErrConsensusGetReceiptsCantBeBatched) ||
 					errors.Is(err, ErrConsensusGetReceiptsInvalidTarget) {
-					return nil, false, "", err
+					return nil, CacheResultMiss, "", err
 				}
 				log.Error(
 					"error forwarding RPC batch",
@@ -555,6 +1548,10 @@ func (s *Server) handleBatchRPC(ctx context.Context, reqs []json.RawMessage, isL
 				)
 				res = nil
 				for _, elem := range elems {
+					if errors.Is(err, ErrBackendResponseTooLarge) {
+						res = append(res, NewRPCErrorRes(elem.Req.ID, ErrResponseTooLarge(elem.Req.Method)))
+						continue
+					}
 					res = append(res, NewRPCErrorRes(elem.Req.ID, err))
 				}
 			}
@@ -562,8 +1559,16 @@ func (s *Server) handleBatchRPC(ctx context.Context, reqs []json.RawMessage, isL
 			for i := range elems {
 				responses[elems[i].Index] = res[i]
 
+				// failed submissions may be retried
+				if err == nil && res[i].Error == nil && s.txDedup != nil {
+					s.txDedup.Put(elems[i].Req, res[i])
+				}
+				if sender := txSenders[elems[i].Index]; sender != nil && err == nil && res[i].Error == nil {
+					s.txNonce.Track(ctx, sender)
+				}
+
 				// TODO(inphi): batch put these
-				if res[i].Error == nil && res[i].Result != nil {
+				if res[i].Error == nil && !cacheDirectives.NoStore {
 					if err := s.cache.PutRPC(ctx, elems[i].Req, res[i]); err != nil {
 						log.Warn(
 							"cache put error",
@@ -584,7 +1589,157 @@ func (s *Server) handleBatchRPC(ctx context.Context, reqs []json.RawMessage, isL
 		servedByString += sb
 	}
 
-	return responses, cached, servedByString, nil
+	// results are cached whole, as the limits depend on the auth key
+	if s.getLogsLimiter != nil {
+		for i, method := range methods {
+			if method != "eth_getLogs" || responses[i] == nil {
+				continue
+			}
+			if err := s.getLogsLimiter.CheckResult(ctx, responses[i]); err != nil {
+				RecordGetLogsLimitRejection(GetLogsLimitLogs)
+				RecordRPCError(ctx, BackendProxyd, method, err)
+				responses[i] = NewRPCErrorRes(responses[i].ID, err)
+			}
+		}
+	}
+
+	s.transformer.Transform(methods, responses)
+	s.projector.Project(ctx, methods, responses)
+	s.runResponseHooks(ctx, parsedReqs, responses)
+	s.abuse.Observe(ctx, methods, responses)
+	setAccessLogMethods(ctx, methods)
+	return responses, cacheResult, servedByString, nil
+}
+
+// forwardSplitLogs forwards the sub-range requests of the eth_getLogs request
+// req concurrently, serving them from the cache when possible, and merges
+// their logs in block order.
+func (s *Server) forwardSplitLogs(ctx context.Context, group string, req *RPCReq, subReqs []*RPCReq) *RPCRes {
+	RecordGetLogsSplit(len(subReqs))
+	cacheDirectives := GetCacheDirectives(ctx)
+	results := make([]*RPCRes, len(subReqs))
+	sem := make(chan struct{}, s.getLogsLimiter.SplitConcurrency())
+	var wg sync.WaitGroup
+	for i, subReq := range subReqs {
+		wg.Add(1)
+		go func(i int, subReq *RPCReq) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			if !cacheDirectives.NoCache {
+				if res, _ := s.cache.GetRPC(ctx, subReq); res != nil {
+					results[i] = res
+					return
+				}
+			}
+			res, _, err := s.forward(ctx, group, []batchElem{{subReq, 0}}, false)
+			if err != nil {
+				log.Error("error forwarding eth_getLogs sub-range", "params", string(subReq.Params), "req_id", GetReqID(ctx), "err", err)
+				if errors.Is(err, ErrBackendResponseTooLarge) {
+					err = ErrResponseTooLarge(req.Method)
+				}
+				results[i] = NewRPCErrorRes(req.ID, err)
+				return
+			}
+			results[i] = res[0]
+			if res[0].Error == nil && !cacheDirectives.NoStore {
+				if err := s.cache.PutRPC(ctx, subReq, res[0]); err != nil {
+					log.Warn("cache put error", "req_id", GetReqID(ctx), "err", err)
+				}
+			}
+		}(i, subReq)
+	}
+	wg.Wait()
+
+	logs := make([]interface{}, 0)
+	for _, res := range results {
+		if res.Error != nil {
+			return NewRPCErrorRes(req.ID, res.Error)
+		}
+		subLogs, ok := res.Result.([]interface{})
+		if !ok && res.Result != nil {
+			return NewRPCErrorRes(req.ID, ErrBackendBadResponse)
+		}
+		logs = append(logs, subLogs...)
+	}
+	return NewRPCRes(req.ID, logs)
+}
+
+// latestBlockNumber returns a function returning the latest block of the
+// consensus of group, or the latest block synced for the cache.
+func (s *Server) latestBlockNumber(group string) func() (uint64, bool) {
+	return func() (uint64, bool) {
+		if bg := s.BackendGroups[group]; bg != nil && bg.Consensus != nil {
+			if latest := bg.Consensus.GetLatestBlockNumber(); latest > 0 {
+				return uint64(latest), true
+			}
+		}
+		if s.getLatestBlockNumFn != nil {
+			latest, err := s.getLatestBlockNumFn(context.Background())
+			return latest, err == nil
+		}
+		return 0, false
+	}
+}
+
+// forward sends elems to the backend group. Single non-batch requests are
+// deduplicated with in-flight requests of the same peered request, and
+// coalesced with identical in-flight requests when coalescing is enabled.
+func (s *Server) forward(ctx context.Context, group string, elems []batchElem, isBatch bool) ([]*RPCRes, string, error) {
+	if s.priorities != nil {
+		ctx = context.WithValue(ctx, ContextKeyPriorityClass, s.priorities.Classify(ctx, createBatchRequest(elems))) // nolint:staticcheck
+	}
+	if info := GetPeeringInfo(ctx); s.peering != nil && info != nil && info.Hops > 0 && !isBatch && len(elems) == 1 {
+		res, sb, err := s.peering.Dedup(ctx, info, elems[0].Req, func(ctx context.Context) (*RPCRes, string, error) {
+			res, sb, err := s.coalesce(ctx, group, elems, isBatch)
+			if err != nil {
+				return nil, sb, err
+			}
+			return res[0], sb, nil
+		})
+		if err != nil {
+			return nil, sb, err
+		}
+		return []*RPCRes{res}, sb, nil
+	}
+	return s.coalesce(ctx, group, elems, isBatch)
+}
+
+func (s *Server) coalesce(ctx context.Context, group string, elems []batchElem, isBatch bool) ([]*RPCRes, string, error) {
+	bg := s.BackendGroups[group]
+	if s.txDedup != nil && !isBatch && len(elems) == 1 && elems[0].Req.Method == "eth_sendRawTransaction" {
+		res, sb, err := s.txDedup.Do(ctx, elems[0].Req, func(ctx context.Context) (*RPCRes, string, error) {
+			res, sb, err := bg.Forward(ctx, createBatchRequest(elems), isBatch)
+			if err != nil {
+				return nil, sb, err
+			}
+			return res[0], sb, nil
+		})
+		if err != nil {
+			return nil, sb, err
+		}
+		return []*RPCRes{res}, sb, nil
+	}
+	if s.coalescer == nil || isBatch || len(elems) != 1 || !s.coalescer.Coalescable(elems[0].Req.Method) {
+		return bg.Forward(ctx, createBatchRequest(elems), isBatch)
+	}
+
+	var block uint64
+	if bg.Consensus != nil {
+		block = uint64(bg.Consensus.GetLatestBlockNumber())
+	}
+	res, sb, err := s.coalescer.Do(ctx, group, block, elems[0].Req, func(ctx context.Context) (*RPCRes, string, error) {
+		res, sb, err := bg.Forward(ctx, createBatchRequest(elems), isBatch)
+		if err != nil {
+			return nil, sb, err
+		}
+		return res[0], sb, nil
+	})
+	if err != nil {
+		return nil, sb, err
+	}
+	return []*RPCRes{res}, sb, nil
 }
 
 func (s *Server) HandleWS(w http.ResponseWriter, r *http.Request) {
@@ -595,20 +1750,94 @@ func (s *Server) HandleWS(w http.ResponseWriter, r *http.Request) {
 
 	log.Info("received WS connection", "req_id", GetReqID(ctx))
 
-	clientConn, err := s.upgrader.Upgrade(w, r, nil)
+	if s.wsDrainer != nil && s.wsDrainer.isDraining() {
+		writeRPCError(ctx, w, nil, ErrShuttingDown)
+		return
+	}
+
+	ip := GetXForwardedFor(ctx)
+	if limit, ok := s.wsConnLimiter.Acquire(ip); !ok {
+		log.Info("rejected WS connection over limit", "limit", limit, "auth", GetAuthCtx(ctx), "req_id", GetReqID(ctx))
+		RecordWSConnLimitRejection(limit)
+		writeRPCError(ctx, w, nil, s.wsConnLimiter.err)
+		return
+	}
+
+	var session *WSSession
+	var respHeader http.Header
+	if s.wsSessions != nil {
+		token := r.Header.Get(WSSessionHeader)
+		if token == "" {
+			token = r.URL.Query().Get(wsSessionQueryParam)
+		}
+		var resumed bool
+		session, resumed = s.wsSessions.Acquire(token, GetAuthCtx(ctx))
+		if resumed {
+			log.Info("resumed WS session", "req_id", GetReqID(ctx), "backend", session.Backend())
+		}
+		respHeader = http.Header{WSSessionHeader: []string{session.Token}}
+	}
+
+	clientConn, err := s.upgrader.Upgrade(w, r, respHeader)
 	if err != nil {
 		log.Error("error upgrading client conn", "auth", GetAuthCtx(ctx), "req_id", GetReqID(ctx), "err", err)
+		s.wsConnLimiter.Release(ip)
+		if session != nil {
+			s.wsSessions.Release(session)
+		}
 		return
 	}
-	clientConn.SetReadLimit(s.maxBodySize)
+	readLimit := s.maxBodySize
+	if s.wsClientConn.MaxMessageSize > 0 {
+		readLimit = s.wsClientConn.MaxMessageSize
+	}
+	clientConn.SetReadLimit(readLimit)
 
-	proxier, err := s.wsBackendGroup.ProxyWS(ctx, clientConn, s.wsMethodWhitelist)
+	methodWhitelist := s.wsMethodWhitelist
+	var deniedMethods *StringSet
+	if policy := s.authKeyPolicy(ctx); policy != nil {
+		methodWhitelist, deniedMethods = policy.wsMethodWhitelist(methodWhitelist)
+	}
+	if !s.authKeyPolicy(ctx).allowsEngineAPI() {
+		methodWhitelist = withoutEngineMethods(methodWhitelist)
+	}
+	proxier, err := s.wsBackendGroup.ProxyWS(ctx, clientConn, methodWhitelist, session, s.wsMux)
 	if err != nil {
+		if session != nil {
+			s.wsSessions.Release(session)
+		}
 		if errors.Is(err, ErrNoBackends) {
 			RecordUnserviceableRequest(ctx, RPCRequestSourceWS)
 		}
 		log.Error("error dialing ws backend", "auth", GetAuthCtx(ctx), "req_id", GetReqID(ctx), "err", err)
 		clientConn.Close()
+		s.wsConnLimiter.Release(ip)
+		return
+	}
+
+	proxier.msgLimiter = s.wsMessageLimiter
+	proxier.policy = s.wsMessagePolicy
+	proxier.deniedMethods = deniedMethods
+	proxier.geoip = s.geoip
+	proxier.configureClientConn(s.wsClientConn)
+	if s.wsCompression != nil {
+		proxier.configureCompression(s.wsCompression, wsOffersCompression(r.Header))
+	}
+	if s.wsFailover.Enabled {
+		proxier.enableFailover(s.wsBackendGroup, s.wsFailover)
+	}
+
+	if s.wsDrainer != nil && !s.wsDrainer.add(proxier) {
+		// shutting down since the upgrade
+		closeMsg := websocket.FormatCloseMessage(websocket.CloseServiceRestart, ErrShuttingDown.Message)
+		if err := proxier.writeClientConn(websocket.CloseMessage, closeMsg); err != nil {
+			log.Debug("error writing clientConn message", "err", err)
+		}
+		proxier.close()
+		if session != nil {
+			s.wsSessions.Release(session)
+		}
+		s.wsConnLimiter.Release(ip)
 		return
 	}
 
@@ -618,6 +1847,13 @@ func (s *Server) HandleWS(w http.ResponseWriter, r *http.Request) {
 		if err := proxier.Proxy(ctx); err != nil {
 			log.Error("error proxying websocket", "auth", GetAuthCtx(ctx), "req_id", GetReqID(ctx), "err", err)
 		}
+		if s.wsDrainer != nil {
+			s.wsDrainer.remove(proxier)
+		}
+		if session != nil {
+			s.wsSessions.Release(session)
+		}
+		s.wsConnLimiter.Release(ip)
 		activeClientWsConnsGauge.WithLabelValues(GetAuthCtx(ctx)).Dec()
 	}()
 
@@ -627,30 +1863,119 @@ func (s *Server) HandleWS(w http.ResponseWriter, r *http.Request) {
 func (s *Server) populateContext(w http.ResponseWriter, r *http.Request) context.Context {
 	vars := mux.Vars(r)
 	authorization := vars["authorization"]
-	xff := r.Header.Get(s.rateLimitHeader)
-	if xff == "" {
-		ipPort := strings.Split(r.RemoteAddr, ":")
-		if len(ipPort) == 2 {
-			xff = ipPort[0]
+	xff := s.clientIP.resolve(r)
+	setAccessLogClientIP(r.Context(), xff)
+	ctx := context.WithValue(r.Context(), ContextKeyXForwardedFor, xff)           // nolint:staticcheck
+	ctx = context.WithValue(ctx, ContextKeyOrigin, r.Header.Get("Origin"))        // nolint:staticcheck
+	ctx = context.WithValue(ctx, ContextKeyUserAgent, r.Header.Get("User-Agent")) // nolint:staticcheck
+	if s.geoip != nil {
+		if ip := GetClientIP(ctx); ip != nil {
+			ctx = context.WithValue(ctx, ContextKeyGeoLocation, s.geoip.Locate(ip)) // nolint:staticcheck
 		}
 	}
-	ctx := context.WithValue(r.Context(), ContextKeyXForwardedFor, xff) // nolint:staticcheck
 
-	if len(s.authenticatedPaths) > 0 {
-		if authorization == "" || s.authenticatedPaths[authorization] == "" {
+	alias, authenticated := s.clientCertAuth.alias(r)
+	if !authenticated && s.clientCertAuth.replacesSecrets() {
+		log.Info("blocked request without mapped client certificate")
+		RecordAuditEvent(AuditEventAuthFailure, "reason", "client_cert", "remote_ip", xff)
+		httpResponseCodesTotal.WithLabelValues("401").Inc()
+		w.WriteHeader(401)
+		return nil
+	}
+	if token, ok := bearerToken(r); !authenticated && ok && s.jwtAuth != nil {
+		var err error
+		if alias, err = s.jwtAuth.alias(ctx, token); err != nil {
+			log.Info("blocked request with invalid bearer token", "err", err)
+			RecordJWTAuthFailure(jwtAuthFailureReason(err))
+			RecordAuditEvent(AuditEventAuthFailure, "reason", "jwt_"+jwtAuthFailureReason(err), "remote_ip", xff)
+			httpResponseCodesTotal.WithLabelValues("401").Inc()
+			w.WriteHeader(401)
+			return nil
+		}
+		authenticated = true
+	}
+	if !authenticated && s.jwtAuth.requiresToken() {
+		log.Info("blocked request without bearer token")
+		RecordAuditEvent(AuditEventAuthFailure, "reason", "missing_token", "remote_ip", xff)
+		httpResponseCodesTotal.WithLabelValues("401").Inc()
+		w.WriteHeader(401)
+		return nil
+	}
+	if authPaths := s.authPaths(); !authenticated && (len(authPaths) > 0 || s.apiKeys != nil) {
+		alias = authPaths[authorization]
+		if alias == "" && authorization != "" && s.apiKeys != nil {
+			var err error
+			if alias, err = s.apiKeys.Lookup(ctx, authorization); err != nil {
+				log.Error("error looking up api key", "err", err)
+			}
+		}
+		if alias == "" {
 			log.Info("blocked unauthorized request", "authorization", authorization)
+			RecordAuditEvent(AuditEventAuthFailure, "reason", "invalid_key", "remote_ip", xff)
 			httpResponseCodesTotal.WithLabelValues("401").Inc()
 			w.WriteHeader(401)
 			return nil
 		}
+		authenticated = true
+	}
+
+	if authenticated {
+		if policy := s.authKeyPolicies[alias]; policy != nil {
+			if reason, ok := policy.checkOrigin(r); !ok {
+				log.Info("blocked request with disallowed origin",
+					"auth", alias,
+					"reason", reason,
+					"origin", r.Header.Get("Origin"),
+					"referer", r.Header.Get("Referer"))
+				RecordAuthOriginViolation(alias, reason)
+				RecordAuditEvent(AuditEventAuthFailure, "reason", "origin", "origin_source", reason, "auth", alias, "remote_ip", xff, "origin", r.Header.Get("Origin"))
+				httpResponseCodesTotal.WithLabelValues("403").Inc()
+				w.WriteHeader(403)
+				return nil
+			}
+			if !policy.allowsIP(GetClientIP(ctx)) {
+				log.Info("blocked request from disallowed IP", "auth", alias, "remote_ip", xff)
+				RecordAuthOriginViolation(alias, "ip")
+				RecordAuditEvent(AuditEventAuthFailure, "reason", "ip", "auth", alias, "remote_ip", xff)
+				httpResponseCodesTotal.WithLabelValues("403").Inc()
+				w.WriteHeader(403)
+				return nil
+			}
+			ctx = context.WithValue(ctx, ContextKeyCacheDirectives, policy.cacheDirectives(r)) // nolint:staticcheck
+		}
+
+		ctx = context.WithValue(ctx, ContextKeyAuth, alias) // nolint:staticcheck
+	}
+
+	if err := s.abuse.Check(ctx); err != nil {
+		log.Info("blocked request of penalized client", "auth", GetAuthCtx(ctx), "remote_ip", xff, "err", err)
+		writeRPCError(ctx, w, nil, err)
+		return nil
+	}
 
-		ctx = context.WithValue(ctx, ContextKeyAuth, s.authenticatedPaths[authorization]) // nolint:staticcheck
+	reqID := randStr(10)
+	if s.peering != nil {
+		info, err := s.peering.Receive(r, GetClientIP(ctx), reqID)
+		if err != nil {
+			log.Warn("blocked peered request",
+				"err", err,
+				"hops", r.Header.Get(PeeringHopsHeader),
+				"origin", r.Header.Get(PeeringOriginHeader),
+				"peer_req_id", r.Header.Get(PeeringRequestIDHeader))
+			RecordPeeringRejection(peeringRejectionReason(err))
+			httpResponseCodesTotal.WithLabelValues("508").Inc()
+			w.WriteHeader(http.StatusLoopDetected)
+			return nil
+		}
+		// requests are logged under the same ID by all instances
+		reqID = info.RequestID
+		ctx = context.WithValue(ctx, ContextKeyPeering, info) // nolint:staticcheck
 	}
 
 	return context.WithValue(
 		ctx,
 		ContextKeyReqID, // nolint:staticcheck
-		randStr(10),
+		reqID,
 	)
 }
 
@@ -662,8 +1987,8 @@ func randStr(l int) string {
 	return hex.EncodeToString(b)
 }
 
-func (s *Server) isUnlimitedOrigin(origin string) bool {
-	for _, pat := range s.limExemptOrigins {
+func (r *routingConfig) isUnlimitedOrigin(origin string) bool {
+	for _, pat := range r.limExemptOrigins {
 		if pat.MatchString(origin) {
 			return true
 		}
@@ -672,8 +1997,8 @@ func (s *Server) isUnlimitedOrigin(origin string) bool {
 	return false
 }
 
-func (s *Server) isUnlimitedUserAgent(origin string) bool {
-	for _, pat := range s.limExemptUserAgents {
+func (r *routingConfig) isUnlimitedUserAgent(origin string) bool {
+	for _, pat := range r.limExemptUserAgents {
 		if pat.MatchString(origin) {
 			return true
 		}
@@ -681,81 +2006,208 @@ func (s *Server) isUnlimitedUserAgent(origin string) bool {
 	return false
 }
 
-func (s *Server) isGlobalLimit(method string) bool {
-	return s.globallyLimitedMethods[method]
+func (r *routingConfig) isUnlimitedIP(ip net.IP) bool {
+	return ip != nil && containsIP(r.limExemptCIDRs, ip)
+}
+
+// baseLimiter returns the base rate limiter of ip, overridden for the ranges
+// of CIDR overrides.
+func (r *routingConfig) baseLimiter(ip net.IP) FrontendRateLimiter {
+	if ip != nil {
+		for _, override := range r.cidrOverrides {
+			if containsIP(override.nets, ip) {
+				return override.lim
+			}
+		}
+	}
+	return r.mainLim
+}
+
+func (r *routingConfig) isGlobalLimit(method string) bool {
+	return r.globallyLimitedMethods[method]
+}
+
+// checkRawTx decodes the raw transaction of req, validates it, checks it
+// against the transaction policy and the nonces of its sender, and takes it
+// from the sender rate limits. It returns the sender of the transaction.
+func (s *Server) checkRawTx(ctx context.Context, req *RPCReq) (*TxSender, error) {
+	sender, err := s.extractTxSender(ctx, req)
+	if err != nil {
+		if s.txValidator != nil {
+			RecordTxValidationRejection(TxValidationReasonMalformed)
+		}
+		return nil, err
+	}
+
+	if s.txValidator != nil {
+		if reason, err := s.txValidator.Validate(sender); err != nil {
+			log.Debug("invalid raw transaction", "sender", sender.From.Hex(), "reason", reason, "req_id", GetReqID(ctx))
+			RecordTxValidationRejection(reason)
+			return nil, err
+		}
+	}
+
+	if s.txPolicy != nil {
+		if list, ok := s.txPolicy.Check(sender); !ok {
+			log.Info("raw transaction rejected by policy", "sender", sender.From.Hex(), "list", list, "req_id", GetReqID(ctx))
+			RecordTxPolicyRejection(list)
+			return nil, ErrTxPolicyRejected
+		}
+	}
+
+	if s.txNonce != nil {
+		if reason, err := s.txNonce.Check(ctx, sender); err != nil {
+			log.Debug("raw transaction rejected for its nonce", "sender", sender.From.Hex(), "nonce", sender.Nonce, "reason", reason, "req_id", GetReqID(ctx))
+			RecordTxNonceRejection(reason)
+			return nil, err
+		}
+	}
+
+	if s.senderLim == nil {
+		return sender, nil
+	}
+	if err := s.rateLimitSender(ctx, sender); err != nil {
+		return nil, err
+	}
+	return sender, nil
+}
+
+// checkConditionalTx checks that the auth key of ctx may send conditional
+// transactions and validates the conditions of req. It returns the request of
+// the raw transaction of req.
+func (s *Server) checkConditionalTx(ctx context.Context, req *RPCReq) (*RPCReq, error) {
+	if !s.conditionalTx.Allowed(ctx) {
+		log.Info("conditional transaction not allowed", "auth", GetAuthCtx(ctx), "req_id", GetReqID(ctx))
+		RecordConditionalTx(ConditionalTxReasonUnauthorized)
+		return nil, ErrConditionalTxNotAllowed
+	}
+	txReq, err := s.conditionalTx.Validate(req)
+	if err != nil {
+		log.Debug("invalid conditional transaction", "err", err, "req_id", GetReqID(ctx))
+		RecordConditionalTx(ConditionalTxReasonInvalid)
+		return nil, err
+	}
+	RecordConditionalTx(ConditionalTxOutcomeAccepted)
+	return txReq, nil
 }
 
-func (s *Server) rateLimitSender(ctx context.Context, req *RPCReq) error {
+// extractTxSender decodes the raw transaction of req.
+func (s *Server) extractTxSender(ctx context.Context, req *RPCReq) (*TxSender, error) {
 	var params []string
 	if err := json.Unmarshal(req.Params, &params); err != nil {
 		log.Debug("error unmarshalling raw transaction params", "err", err, "req_Id", GetReqID(ctx))
-		return ErrParseErr
+		return nil, ErrParseErr
 	}
 
 	if len(params) != 1 {
 		log.Debug("raw transaction request has invalid number of params", "req_id", GetReqID(ctx))
 		// The error below is identical to the one Geth responds with.
-		return ErrInvalidParams("missing value for required argument 0")
+		return nil, ErrInvalidParams("missing value for required argument 0")
 	}
 
 	var data hexutil.Bytes
 	if err := data.UnmarshalText([]byte(params[0])); err != nil {
 		log.Debug("error decoding raw tx data", "err", err, "req_id", GetReqID(ctx))
 		// Geth returns the raw error from UnmarshalText.
-		return ErrInvalidParams(err.Error())
+		return nil, ErrInvalidParams(err.Error())
 	}
 
-	// Inflates a types.Transaction object from the transaction's raw bytes.
-	tx := new(types.Transaction)
-	if err := tx.UnmarshalBinary(data); err != nil {
-		log.Debug("could not unmarshal transaction", "err", err, "req_id", GetReqID(ctx))
-		return ErrInvalidParams(err.Error())
+	sender, err := s.senderExtractor.ExtractSender(data)
+	if err != nil {
+		log.Debug("could not get sender from transaction", "err", err, "req_id", GetReqID(ctx))
+		return nil, ErrInvalidParams(err.Error())
 	}
+	return sender, nil
+}
 
+func (s *Server) rateLimitSender(ctx context.Context, sender *TxSender) error {
 	// Check if the transaction is for the expected chain,
 	// otherwise reject before rate limiting to avoid replay attacks.
-	if !s.isAllowedChainId(tx.ChainId()) {
+	if !s.isAllowedChainId(sender.ChainID) {
 		log.Debug("chain id is not allowed", "req_id", GetReqID(ctx))
 		return txpool.ErrInvalidSender
 	}
 
-	// Convert the transaction into a Message object so that we can get the
-	// sender. This method performs an ecrecover, which can be expensive.
-	msg, err := core.TransactionToMessage(tx, types.LatestSignerForChainID(tx.ChainId()), nil)
-	if err != nil {
-		log.Debug("could not get message from transaction", "err", err, "req_id", GetReqID(ctx))
-		return ErrInvalidParams(err.Error())
+	if s.senderAllowlist[sender.From] {
+		return nil
 	}
-	ok, err := s.senderLim.Take(ctx, fmt.Sprintf("%s:%d", msg.From.Hex(), tx.Nonce()))
+
+	ok, err := s.senderLim.Take(ctx, fmt.Sprintf("%s:%d", sender.From.Hex(), sender.Nonce))
 	if err != nil {
 		log.Error("error taking from sender limiter", "err", err, "req_id", GetReqID(ctx))
 		return ErrInternal
 	}
 	if !ok {
-		log.Debug("sender rate limit exceeded", "sender", msg.From.Hex(), "req_id", GetReqID(ctx))
+		log.Debug("sender rate limit exceeded", "sender", sender.From.Hex(), "req_id", GetReqID(ctx))
 		return ErrOverSenderRateLimit
 	}
 
+	if sender.BlobCount > 0 && s.blobSenderLim != nil {
+		ok, err := s.blobSenderLim.Take(ctx, sender.From.Hex())
+		if err != nil {
+			log.Error("error taking from blob sender limiter", "err", err, "req_id", GetReqID(ctx))
+			return ErrInternal
+		}
+		if !ok {
+			log.Debug("blob sender rate limit exceeded", "sender", sender.From.Hex(), "req_id", GetReqID(ctx))
+			RecordBlobTxRejection("rate_limit")
+			return ErrOverSenderRateLimit
+		}
+	}
+
+	if sender.To != nil {
+		if lim := s.contractSenderLims[*sender.To]; lim != nil {
+			ok, err := lim.Take(ctx, sender.From.Hex())
+			if err != nil {
+				log.Error("error taking from contract sender limiter", "err", err, "req_id", GetReqID(ctx))
+				return ErrInternal
+			}
+			if !ok {
+				log.Debug("contract sender rate limit exceeded", "sender", sender.From.Hex(), "to", sender.To.Hex(), "req_id", GetReqID(ctx))
+				return ErrOverSenderRateLimit
+			}
+		}
+	}
+
 	return nil
 }
 
+// SetSenderExtractor replaces the extractor deriving the sender of raw
+// transactions for sender rate limiting.
+func (s *Server) SetSenderExtractor(extractor SenderExtractor) {
+	s.senderExtractor = extractor
+}
+
 func (s *Server) isAllowedChainId(chainId *big.Int) bool {
-	if s.allowedChainIds == nil || len(s.allowedChainIds) == 0 {
-		return true
+	return isAllowedChainID(s.allowedChainIds, chainId)
+}
+
+// setCacheHeaders sets the cache status header, HIT or MISS, and the debug
+// header telling stale entries apart, if enabled.
+func (s *Server) setCacheHeaders(w http.ResponseWriter, cacheResult string) {
+	if cacheResult == CacheResultHit {
+		w.Header().Set(cacheStatusHdr, CacheResultHit)
+	} else {
+		w.Header().Set(cacheStatusHdr, CacheResultMiss)
 	}
-	for _, id := range s.allowedChainIds {
-		if chainId.Cmp(id) == 0 {
-			return true
-		}
+	if s.cacheDebugHdr {
+		w.Header().Set(CacheDebugHeader, cacheResult)
 	}
-	return false
 }
 
-func setCacheHeader(w http.ResponseWriter, cached bool) {
-	if cached {
-		w.Header().Set(cacheStatusHdr, "HIT")
-	} else {
-		w.Header().Set(cacheStatusHdr, "MISS")
+// setRateLimitHeaders sets the X-RateLimit headers of a rate limit of a
+// request, so that clients can throttle themselves, and Retry-After if it is
+// limited.
+func setRateLimitHeaders(w http.ResponseWriter, status *RateLimitStatus, limited bool) {
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(status.Limit))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(status.Remaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(status.Reset.Unix(), 10))
+	if limited {
+		retryAfter := int(math.Ceil(time.Until(status.Reset).Seconds()))
+		if retryAfter < 1 {
+			retryAfter = 1
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
 	}
 }
 
@@ -770,6 +2222,7 @@ func writeRPCError(ctx context.Context, w http.ResponseWriter, id json.RawMessag
 }
 
 func writeRPCRes(ctx context.Context, w http.ResponseWriter, res *RPCRes) {
+	setAccessLogError(ctx, []*RPCRes{res})
 	statusCode := 200
 	if res.IsError() && res.Error.HTTPErrorCode != 0 {
 		statusCode = res.Error.HTTPErrorCode
@@ -789,6 +2242,7 @@ func writeRPCRes(ctx context.Context, w http.ResponseWriter, res *RPCRes) {
 }
 
 func writeBatchRPCRes(ctx context.Context, w http.ResponseWriter, res []*RPCRes) {
+	setAccessLogError(ctx, res)
 	w.Header().Set("content-type", "application/json")
 	w.WriteHeader(200)
 	ww := &recordLenWriter{Writer: w}
@@ -834,6 +2288,16 @@ func GetXForwardedFor(ctx context.Context) string {
 	return xff
 }
 
+func GetOrigin(ctx context.Context) string {
+	origin, _ := ctx.Value(ContextKeyOrigin).(string)
+	return origin
+}
+
+func GetUserAgent(ctx context.Context) string {
+	userAgent, _ := ctx.Value(ContextKeyUserAgent).(string)
+	return userAgent
+}
+
 type recordLenWriter struct {
 	io.Writer
 	Len int
@@ -855,6 +2319,22 @@ func (n *NoopRPCCache) PutRPC(context.Context, *RPCReq, *RPCRes) error {
 	return nil
 }
 
+func (n *NoopRPCCache) InspectRPC(_ context.Context, req *RPCReq) (*RPCCacheInspection, error) {
+	return &RPCCacheInspection{Method: req.Method}, nil
+}
+
+func (n *NoopRPCCache) DeleteRPC(context.Context, *RPCReq) (bool, error) {
+	return false, nil
+}
+
+func (n *NoopRPCCache) PurgeRPC(context.Context, string) (int, error) {
+	return 0, nil
+}
+
+func (n *NoopRPCCache) Stats() *RPCCacheStats {
+	return &RPCCacheStats{Methods: map[string]*RPCCacheMethodStats{}}
+}
+
 func truncate(str string, maxLen int) string {
 	if maxLen == 0 {
 		maxLen = maxRequestBodyLogLen
@@ -0,0 +1,171 @@
+package proxyd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	// SnapshotHeader requests a batch to be served as a snapshot: all of its
+	// requests are forwarded to the same backend at the same block, which is
+	// returned in SnapshotBlockHeader.
+	SnapshotHeader      = "X-Proxyd-Snapshot"
+	SnapshotBlockHeader = "X-Proxyd-Snapshot-Block"
+
+	ContextKeySnapshot = "snapshot"
+)
+
+var (
+	ErrSnapshotNotServable = ErrInvalidRequest("snapshot batches must have unique IDs and methods of a single backend group")
+
+	errSnapshotBlockUnknown = errors.New("snapshot block is unknown")
+)
+
+// Snapshot is the block a snapshot batch was served at.
+type Snapshot struct {
+	Block hexutil.Uint64
+}
+
+func GetSnapshot(ctx context.Context) *Snapshot {
+	snapshot, _ := ctx.Value(ContextKeySnapshot).(*Snapshot)
+	return snapshot
+}
+
+// ForwardSnapshot forwards rpcReqs as a single batch to one backend, with the
+// requests at the latest block or without a block pinned to the same block
+// number. For consensus aware groups the block is the consensus latest block,
+// otherwise it is the latest block of the backend. It returns the block the
+// requests were pinned to.
+func (bg *BackendGroup) ForwardSnapshot(ctx context.Context, rpcReqs []*RPCReq) ([]*RPCRes, string, hexutil.Uint64, error) {
+	backends := bg.orderedBackendsForRequest(rpcReqs)
+	rpcRequestsTotal.Inc()
+
+	for _, back := range backends {
+		servedBy := fmt.Sprintf("%s/%s", bg.Name, back.Name)
+
+		block, err := bg.snapshotBlock(ctx, back)
+		if err == nil {
+			var res []*RPCRes
+			res, err = back.Forward(ctx, pinSnapshotReqs(rpcReqs, block), true)
+			if err == nil {
+				return res, servedBy, block, nil
+			}
+		}
+		if errors.Is(err, ErrBackendResponseTooLarge) {
+			return nil, servedBy, 0, err
+		}
+		log.Warn(
+			"error forwarding snapshot to backend",
+			"name", back.Name,
+			"req_id", GetReqID(ctx),
+			"auth", GetAuthCtx(ctx),
+			"err", err,
+		)
+	}
+
+	RecordUnserviceableRequest(ctx, RPCRequestSourceHTTP)
+	return nil, "", 0, ErrNoBackends
+}
+
+func (bg *BackendGroup) snapshotBlock(ctx context.Context, back *Backend) (hexutil.Uint64, error) {
+	if bg.Consensus != nil {
+		block := bg.Consensus.GetLatestBlockNumber()
+		if block == 0 {
+			return 0, errSnapshotBlockUnknown
+		}
+		return block, nil
+	}
+
+	res, err := back.Forward(ctx, []*RPCReq{{
+		JSONRPC: JSONRPCVersion,
+		Method:  "eth_blockNumber",
+		Params:  json.RawMessage("[]"),
+		ID:      json.RawMessage("1"),
+	}}, false)
+	if err != nil {
+		return 0, err
+	}
+	if res[0].IsError() {
+		return 0, res[0].Error
+	}
+	var block hexutil.Uint64
+	if err := json.Unmarshal(mustMarshalJSON(res[0].Result), &block); err != nil {
+		return 0, wrapErr(err, "error reading snapshot block")
+	}
+	return block, nil
+}
+
+// pinSnapshotReqs returns copies of reqs whose block parameter is replaced by
+// block if it is the latest or pending tag, or is omitted.
+func pinSnapshotReqs(reqs []*RPCReq, block hexutil.Uint64) []*RPCReq {
+	pinned := make([]*RPCReq, len(reqs))
+	for i, req := range reqs {
+		pinned[i] = req
+		pos, ok := blockParamPositions[req.Method]
+		if !ok {
+			continue
+		}
+		var p []json.RawMessage
+		if err := json.Unmarshal(req.Params, &p); err != nil || len(p) < pos {
+			continue
+		}
+		if len(p) > pos {
+			var tag string
+			if err := json.Unmarshal(p[pos], &tag); err != nil || (tag != "latest" && tag != "pending") {
+				continue
+			}
+			p[pos] = mustMarshalJSON(block.String())
+		} else {
+			p = append(p, mustMarshalJSON(block.String()))
+		}
+		pinnedReq := *req
+		pinnedReq.Params = mustMarshalJSON(p)
+		pinned[i] = &pinnedReq
+	}
+	return pinned
+}
+
+// forwardSnapshot serves elems as a snapshot of backend group group, and sets
+// their responses.
+func (s *Server) forwardSnapshot(ctx context.Context, snapshot *Snapshot, group string, elems []batchElem, responses []*RPCRes) string {
+	setErr := func(err error) {
+		for _, elem := range elems {
+			if errors.Is(err, ErrBackendResponseTooLarge) {
+				responses[elem.Index] = NewRPCErrorRes(elem.Req.ID, ErrResponseTooLarge(elem.Req.Method))
+				continue
+			}
+			responses[elem.Index] = NewRPCErrorRes(elem.Req.ID, err)
+		}
+	}
+	if len(elems) > s.maxUpstreamBatchSize {
+		setErr(ErrInvalidRequest(fmt.Sprintf("snapshot batches are limited to %d requests", s.maxUpstreamBatchSize)))
+		return ""
+	}
+
+	reqs := make([]*RPCReq, len(elems))
+	for i, elem := range elems {
+		reqs[i] = elem.Req
+	}
+	res, servedBy, block, err := s.BackendGroups[group].ForwardSnapshot(ctx, reqs)
+	if err != nil {
+		log.Error(
+			"error forwarding snapshot",
+			"batch_size", len(elems),
+			"backend_group", group,
+			"req_id", GetReqID(ctx),
+			"err", err,
+		)
+		setErr(err)
+		return servedBy
+	}
+	snapshot.Block = block
+	for i, elem := range elems {
+		responses[elem.Index] = res[i]
+	}
+	return servedBy
+}
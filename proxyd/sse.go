@@ -0,0 +1,227 @@
+package proxyd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/gorilla/mux"
+)
+
+const defaultSSEKeepaliveInterval = 15 * time.Second
+
+var errSSEClosed = errors.New("sse stream closed")
+
+// sseStreams serves the subscriptions multiplexed for WS clients as
+// server-sent event streams, at /subscribe/{type} with an optional filter
+// query parameter holding the logs filter. Each notification is an event
+// whose data is the eth_subscription notification.
+type sseStreams struct {
+	keepalive time.Duration
+	done      chan struct{}
+	stopOnce  sync.Once
+}
+
+func newSSEStreams(config SSEConfig) *sseStreams {
+	keepalive := defaultSSEKeepaliveInterval
+	if config.KeepaliveInterval != 0 {
+		keepalive = time.Duration(config.KeepaliveInterval)
+	}
+	return &sseStreams{
+		keepalive: keepalive,
+		done:      make(chan struct{}),
+	}
+}
+
+// stop ends the streams, which the RPC server waits for on shutdown.
+func (s *sseStreams) stop() {
+	s.stopOnce.Do(func() { close(s.done) })
+}
+
+// sseParams returns the eth_subscribe params of the stream requested by r.
+func sseParams(r *http.Request) (json.RawMessage, error) {
+	params := []json.RawMessage{mustMarshalJSON(mux.Vars(r)["type"])}
+	if filter := r.URL.Query().Get("filter"); filter != "" {
+		if !json.Valid([]byte(filter)) {
+			return nil, ErrInvalidParams("invalid filter")
+		}
+		params = append(params, json.RawMessage(filter))
+	}
+	return mustMarshalJSON(params), nil
+}
+
+func (s *Server) HandleSSE(w http.ResponseWriter, r *http.Request) {
+	ctx := s.populateContext(w, r)
+	if ctx == nil {
+		return
+	}
+
+	xff := stripXFF(GetXForwardedFor(ctx))
+	if xff == "" {
+		writeRPCError(ctx, w, nil, ErrInvalidRequest("request does not include a remote IP"))
+		return
+	}
+	if s.sseLimited(ctx, w, r, xff) {
+		RecordRPCError(ctx, BackendProxyd, "unknown", ErrOverRateLimit)
+		log.Warn("rate limited sse stream", "req_id", GetReqID(ctx), "auth", GetAuthCtx(ctx), "remote_ip", xff)
+		writeRPCError(ctx, w, nil, ErrOverRateLimit)
+		return
+	}
+
+	methodWhitelist := s.wsMethodWhitelist
+	if policy := s.authKeyPolicy(ctx); policy != nil {
+		methodWhitelist, _ = policy.wsMethodWhitelist(methodWhitelist)
+	}
+	if !methodWhitelist.Has("eth_subscribe") {
+		if s.wsMethodWhitelist.Has("eth_subscribe") {
+			RecordAuthKeyMethodDenial(GetAuthCtx(ctx), "eth_subscribe", RPCRequestSourceHTTP)
+		}
+		RecordRPCError(ctx, BackendProxyd, "eth_subscribe", ErrMethodNotWhitelisted)
+		writeRPCError(ctx, w, nil, ErrMethodNotWhitelisted)
+		return
+	}
+	if s.geoip != nil {
+		if err := s.geoip.check(ctx, "eth_subscribe"); err != nil {
+			RecordRPCError(ctx, BackendProxyd, "eth_subscribe", err)
+			writeRPCError(ctx, w, nil, err)
+			return
+		}
+	}
+	params, err := sseParams(r)
+	if err != nil {
+		writeRPCError(ctx, w, nil, err)
+		return
+	}
+	if !s.wsMux.Multiplexes(params) {
+		writeRPCError(ctx, w, nil, ErrInvalidParams(fmt.Sprintf("unsupported subscription %s", mux.Vars(r)["type"])))
+		return
+	}
+
+	ip := GetXForwardedFor(ctx)
+	if limit, ok := s.wsConnLimiter.Acquire(ip); !ok {
+		log.Info("rejected sse stream over limit", "limit", limit, "auth", GetAuthCtx(ctx), "req_id", GetReqID(ctx))
+		RecordWSConnLimitRejection(limit)
+		writeRPCError(ctx, w, nil, s.wsConnLimiter.err)
+		return
+	}
+	defer s.wsConnLimiter.Release(ip)
+
+	var backend *Backend
+	for _, back := range s.wsBackendGroup.Backends {
+		if !back.InSimulatedOutage() {
+			backend = back
+			break
+		}
+	}
+	if backend == nil {
+		RecordUnserviceableRequest(ctx, RPCRequestSourceWS)
+		writeRPCError(ctx, w, nil, ErrNoBackends)
+		return
+	}
+	var fallbacks []*Backend
+	if s.wsFailover.Enabled {
+		fallbacks = s.wsBackendGroup.Backends
+	}
+
+	notifications := make(chan []byte)
+	closed := make(chan struct{})
+	var closeOnce sync.Once
+	id, err := s.wsMux.Subscribe(backend, fallbacks, params, func(msg []byte) error {
+		select {
+		case notifications <- msg:
+			return nil
+		case <-closed:
+			return errSSEClosed
+		}
+	}, func() {
+		closeOnce.Do(func() { close(closed) })
+	})
+	if err != nil {
+		log.Warn("error subscribing sse stream", "auth", GetAuthCtx(ctx), "req_id", GetReqID(ctx), "err", err)
+		var rpcErr *RPCErr
+		if !errors.As(err, &rpcErr) {
+			rpcErr = ErrBackendOffline
+		}
+		RecordRPCError(ctx, BackendProxyd, "eth_subscribe", rpcErr)
+		writeRPCError(ctx, w, nil, rpcErr)
+		return
+	}
+	defer func() {
+		closeOnce.Do(func() { close(closed) })
+		s.wsMux.Unsubscribe(id)
+	}()
+	RecordRPCForward(ctx, BackendProxyd, "eth_subscribe", RPCRequestSourceHTTP)
+
+	activeSSEStreamsGauge.WithLabelValues(GetAuthCtx(ctx)).Inc()
+	defer activeSSEStreamsGauge.WithLabelValues(GetAuthCtx(ctx)).Dec()
+	log.Info("accepted sse stream", "subscription", id, "auth", GetAuthCtx(ctx), "req_id", GetReqID(ctx))
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+	if err := rc.Flush(); err != nil {
+		log.Error("error flushing sse stream", "req_id", GetReqID(ctx), "err", err)
+		return
+	}
+
+	keepalive := time.NewTicker(s.sse.keepalive)
+	defer keepalive.Stop()
+	for {
+		var err error
+		select {
+		case msg := <-notifications:
+			_, err = fmt.Fprintf(w, "data: %s\n\n", msg)
+		case <-keepalive.C:
+			_, err = fmt.Fprint(w, ": keepalive\n\n")
+		case <-closed:
+			return
+		case <-r.Context().Done():
+			return
+		case <-s.sse.done:
+			return
+		}
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			log.Info("error writing sse stream", "req_id", GetReqID(ctx), "err", err)
+			return
+		}
+	}
+}
+
+// sseLimited takes the base rate limit of the client of r, as a request
+// would, and reports whether it is limited.
+func (s *Server) sseLimited(ctx context.Context, w http.ResponseWriter, r *http.Request, xff string) bool {
+	routing := s.routing.Load()
+	ip := net.ParseIP(xff)
+	if routing.isUnlimitedOrigin(r.Header.Get("Origin")) || routing.isUnlimitedUserAgent(r.Header.Get("User-Agent")) || routing.isUnlimitedIP(ip) {
+		return false
+	}
+	lim := routing.baseLimiter(ip)
+	key := xff
+	if policy := s.authKeyPolicy(ctx); policy != nil && policy.rateLim != nil {
+		lim = policy.rateLim
+		key = "auth:" + GetAuthCtx(ctx)
+	}
+	if lim == nil {
+		return false
+	}
+	ok, status, err := takeRateLimit(ctx, lim, key)
+	if err != nil {
+		log.Warn("error taking rate limit", "err", err)
+		return true
+	}
+	if status != nil {
+		setRateLimitHeaders(w, status, !ok)
+	}
+	return !ok
+}
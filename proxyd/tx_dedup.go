@@ -0,0 +1,150 @@
+package proxyd
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	defaultTxDedupWindow     = 30 * time.Second
+	defaultTxDedupMaxEntries = 100000
+)
+
+type txDedupEntry struct {
+	res       *RPCRes
+	expiresAt time.Time
+}
+
+// RawTxDeduplicator answers re-submissions of a raw transaction within a
+// window with the response of its first submission, instead of forwarding the
+// same bytes again. Concurrent submissions share the in-flight call.
+// Transactions are identified by their hash.
+type RawTxDeduplicator struct {
+	window     time.Duration
+	maxEntries int
+	timeout    time.Duration
+	group      singleflight.Group
+
+	mu      sync.Mutex
+	entries map[common.Hash]*txDedupEntry
+}
+
+// NewRawTxDeduplicator returns a deduplicator whose shared calls are bounded
+// by timeout.
+func NewRawTxDeduplicator(config TxDedupConfig, timeout time.Duration) *RawTxDeduplicator {
+	window := defaultTxDedupWindow
+	if config.Window != 0 {
+		window = time.Duration(config.Window)
+	}
+	maxEntries := defaultTxDedupMaxEntries
+	if config.MaxEntries != 0 {
+		maxEntries = config.MaxEntries
+	}
+	return &RawTxDeduplicator{
+		window:     window,
+		maxEntries: maxEntries,
+		timeout:    timeout,
+		entries:    make(map[common.Hash]*txDedupEntry),
+	}
+}
+
+// Get returns the response of an earlier submission of the raw transaction of
+// req, if any, with the ID of req.
+func (d *RawTxDeduplicator) Get(req *RPCReq) (*RPCRes, bool) {
+	hash, ok := rawTxHash(req)
+	if !ok {
+		return nil, false
+	}
+	d.mu.Lock()
+	entry := d.entries[hash]
+	d.mu.Unlock()
+	if entry == nil || time.Now().After(entry.expiresAt) {
+		return nil, false
+	}
+	RecordDuplicateRawTx()
+	res := *entry.res
+	res.ID = req.ID
+	return &res, true
+}
+
+// Put records the response of a submission of the raw transaction of req.
+func (d *RawTxDeduplicator) Put(req *RPCReq, res *RPCRes) {
+	hash, ok := rawTxHash(req)
+	if !ok {
+		return
+	}
+	now := time.Now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.entries) >= d.maxEntries {
+		for h, entry := range d.entries {
+			if now.After(entry.expiresAt) {
+				delete(d.entries, h)
+			}
+		}
+		if len(d.entries) >= d.maxEntries {
+			return
+		}
+	}
+	d.entries[hash] = &txDedupEntry{res: res, expiresAt: now.Add(d.window)}
+}
+
+// Do forwards req through fn, unless the same raw transaction is already in
+// flight in which case it shares that call's response.
+func (d *RawTxDeduplicator) Do(
+	ctx context.Context,
+	req *RPCReq,
+	fn func(ctx context.Context) (*RPCRes, string, error),
+) (*RPCRes, string, error) {
+	hash, ok := rawTxHash(req)
+	if !ok {
+		return fn(ctx)
+	}
+	var leader bool
+	v, err, _ := d.group.Do(hash.Hex(), func() (interface{}, error) {
+		leader = true
+		// Other submissions may wait on the call, see RequestCoalescer.Do.
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), d.timeout)
+		defer cancel()
+		res, servedBy, err := fn(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return &coalescedResult{res: res, servedBy: servedBy}, nil
+	})
+	if !leader {
+		RecordDuplicateRawTx()
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	result := v.(*coalescedResult)
+	res := *result.res
+	res.ID = req.ID
+	return &res, result.servedBy, nil
+}
+
+// rawTxHash returns the hash of the raw transaction of an
+// eth_sendRawTransaction request.
+func rawTxHash(req *RPCReq) (common.Hash, bool) {
+	if req.Method != "eth_sendRawTransaction" {
+		return common.Hash{}, false
+	}
+	var params []string
+	if err := json.Unmarshal(req.Params, &params); err != nil || len(params) != 1 {
+		return common.Hash{}, false
+	}
+	data, err := hexutil.Decode(params[0])
+	if err != nil {
+		return common.Hash{}, false
+	}
+	return crypto.Keccak256Hash(data), true
+}
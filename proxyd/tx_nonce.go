@@ -0,0 +1,185 @@
+package proxyd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	TxNonceReasonTooLow = "too_low"
+	TxNonceReasonGap    = "gap"
+
+	defaultTxNonceTTL = time.Minute
+)
+
+func ErrTxNonceTooLow(have uint64, next uint64) *RPCErr {
+	return &RPCErr{
+		Code:          JSONRPCErrorInternal,
+		Message:       fmt.Sprintf("nonce too low: next nonce %d, tx nonce %d", next, have),
+		HTTPErrorCode: 400,
+	}
+}
+
+func ErrTxNonceGapTooLarge(have uint64, pending uint64, maxGap uint64) *RPCErr {
+	return &RPCErr{
+		Code:          JSONRPCErrorInternal,
+		Message:       fmt.Sprintf("nonce too high: pending nonce %d, tx nonce %d, maximum gap %d", pending, have, maxGap),
+		HTTPErrorCode: 400,
+	}
+}
+
+// senderNonces are the nonces of a sender: the nonce of its next transaction
+// to be included, and the nonce following its pending transactions.
+type senderNonces struct {
+	latest  uint64
+	pending uint64
+}
+
+// TxNonceTracker rejects raw transactions whose nonce was already used by an
+// included transaction, or is too far ahead of the sender's pending nonce to be
+// executable soon. Nonces are fetched from a backend group and kept for a TTL in
+// Redis if it is configured, or in memory, so that they are shared by proxyd
+// instances. Accepted transactions advance the kept pending nonce.
+//
+// Transactions replacing a pending one have a nonce between the latest and
+// pending nonces, and are accepted.
+type TxNonceTracker struct {
+	cache        Cache
+	group        *BackendGroup
+	rejectTooLow bool
+	maxGap       uint64
+}
+
+func NewTxNonceTracker(config TxNonceConfig, group *BackendGroup, r redis.UniversalClient, namespace string) *TxNonceTracker {
+	ttl := defaultTxNonceTTL
+	if config.TTL != 0 {
+		ttl = time.Duration(config.TTL)
+	}
+	var cache Cache
+	if r != nil {
+		cache = newRedisCache(r, namespace, ttl)
+	} else {
+		cache = &ttlCache{cache: newMemoryCache(config.MaxEntries, 0), ttl: ttl}
+	}
+	return &TxNonceTracker{
+		cache:        cache,
+		group:        group,
+		rejectTooLow: config.RejectNonceTooLow,
+		maxGap:       config.MaxNonceGap,
+	}
+}
+
+// Check returns the error to respond with if the nonce of the transaction of
+// sender is rejected, along with the reason of the rejection. Transactions are
+// accepted if the nonces of their sender can't be fetched.
+func (t *TxNonceTracker) Check(ctx context.Context, sender *TxSender) (string, *RPCErr) {
+	nonces, err := t.nonces(ctx, sender.From)
+	if err != nil {
+		log.Warn("error fetching sender nonces", "sender", sender.From.Hex(), "err", err, "req_id", GetReqID(ctx))
+		return "", nil
+	}
+	if t.rejectTooLow && sender.Nonce < nonces.latest {
+		return TxNonceReasonTooLow, ErrTxNonceTooLow(sender.Nonce, nonces.latest)
+	}
+	if t.maxGap > 0 && sender.Nonce > nonces.pending+t.maxGap {
+		return TxNonceReasonGap, ErrTxNonceGapTooLarge(sender.Nonce, nonces.pending, t.maxGap)
+	}
+	return "", nil
+}
+
+// Track advances the kept pending nonce of the sender of an accepted
+// transaction.
+func (t *TxNonceTracker) Track(ctx context.Context, sender *TxSender) {
+	val, err := t.cache.Get(ctx, nonceCacheKey(sender.From))
+	if err != nil || val == "" {
+		return
+	}
+	nonces, err := decodeSenderNonces(val)
+	if err != nil || sender.Nonce < nonces.pending {
+		return
+	}
+	nonces.pending = sender.Nonce + 1
+	if err := t.cache.Put(ctx, nonceCacheKey(sender.From), encodeSenderNonces(nonces)); err != nil {
+		log.Warn("error tracking sender nonce", "sender", sender.From.Hex(), "err", err, "req_id", GetReqID(ctx))
+	}
+}
+
+func (t *TxNonceTracker) nonces(ctx context.Context, addr common.Address) (*senderNonces, error) {
+	key := nonceCacheKey(addr)
+	if val, err := t.cache.Get(ctx, key); err == nil && val != "" {
+		if nonces, err := decodeSenderNonces(val); err == nil {
+			return nonces, nil
+		}
+	}
+
+	reqs := []*RPCReq{
+		newWarmupReq(0, "eth_getTransactionCount", addr.Hex(), "latest"),
+		newWarmupReq(1, "eth_getTransactionCount", addr.Hex(), "pending"),
+	}
+	res, _, err := t.group.Forward(ctx, reqs, true)
+	if err != nil {
+		return nil, err
+	}
+	if len(res) != len(reqs) {
+		return nil, ErrBackendUnexpectedJSONRPC
+	}
+	var latest, pending hexutil.Uint64
+	if err := decodeWarmupResult(res[0], &latest); err != nil {
+		return nil, err
+	}
+	if err := decodeWarmupResult(res[1], &pending); err != nil {
+		return nil, err
+	}
+	nonces := &senderNonces{latest: uint64(latest), pending: uint64(pending)}
+	if nonces.pending < nonces.latest {
+		nonces.pending = nonces.latest
+	}
+	if err := t.cache.Put(ctx, key, encodeSenderNonces(nonces)); err != nil {
+		log.Warn("error caching sender nonces", "sender", addr.Hex(), "err", err, "req_id", GetReqID(ctx))
+	}
+	return nonces, nil
+}
+
+func nonceCacheKey(addr common.Address) string {
+	return "nonce:" + addr.Hex()
+}
+
+func encodeSenderNonces(nonces *senderNonces) string {
+	return fmt.Sprintf("%d:%d", nonces.latest, nonces.pending)
+}
+
+func decodeSenderNonces(val string) (*senderNonces, error) {
+	latestStr, pendingStr, ok := strings.Cut(val, ":")
+	if !ok {
+		return nil, errors.New("invalid sender nonces")
+	}
+	latest, err := strconv.ParseUint(latestStr, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	pending, err := strconv.ParseUint(pendingStr, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &senderNonces{latest: latest, pending: pending}, nil
+}
+
+// ttlCache expires the keys put in an in-memory cache after ttl, like the
+// Redis cache does.
+type ttlCache struct {
+	*cache
+	ttl time.Duration
+}
+
+func (c *ttlCache) Put(ctx context.Context, key string, value string) error {
+	return c.cache.PutWithTTL(ctx, key, value, c.ttl)
+}
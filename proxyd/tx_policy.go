@@ -0,0 +1,242 @@
+package proxyd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	TxPolicyListBlocklist = "blocklist"
+	TxPolicyListAllowlist = "allowlist"
+
+	defaultTxPolicyRefreshInterval = time.Minute
+	txPolicyFetchTimeout           = 10 * time.Second
+)
+
+var ErrTxPolicyRejected = &RPCErr{
+	Code:          JSONRPCErrorInternal - 26,
+	Message:       "transaction rejected by policy",
+	HTTPErrorCode: 403,
+}
+
+// AddressList is a set of addresses merged from inline addresses, a file, a
+// Redis set and a remote URL. Files and URLs hold one address per line, lines
+// starting with # being comments. The list is reloaded periodically; if a
+// source can't be read, the previous addresses are kept.
+type AddressList struct {
+	name   string
+	config AddressListConfig
+	redis  redis.UniversalClient
+	client *http.Client
+
+	addrs atomic.Pointer[map[common.Address]struct{}]
+}
+
+func NewAddressList(name string, config AddressListConfig, r redis.UniversalClient) (*AddressList, error) {
+	if config.RedisSet != "" && r == nil {
+		return nil, fmt.Errorf("%s redis_set requires redis", name)
+	}
+	return &AddressList{
+		name:   name,
+		config: config,
+		redis:  r,
+		client: &http.Client{Timeout: txPolicyFetchTimeout},
+	}, nil
+}
+
+// Configured returns whether the list has any source.
+func (l *AddressList) Configured() bool {
+	return len(l.config.Addresses) > 0 || l.config.File != "" || l.config.RedisSet != "" || l.config.URL != ""
+}
+
+func (l *AddressList) Contains(addr common.Address) bool {
+	addrs := l.addrs.Load()
+	if addrs == nil {
+		return false
+	}
+	_, ok := (*addrs)[addr]
+	return ok
+}
+
+// Refresh reloads the addresses of all sources.
+func (l *AddressList) Refresh(ctx context.Context) error {
+	addrs := make(map[common.Address]struct{})
+	add := func(source string, lines []string) error {
+		for _, line := range lines {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			if !common.IsHexAddress(line) {
+				return fmt.Errorf("invalid address %s in %s of %s", line, source, l.name)
+			}
+			addrs[common.HexToAddress(line)] = struct{}{}
+		}
+		return nil
+	}
+
+	if err := add("addresses", l.config.Addresses); err != nil {
+		return err
+	}
+	if l.config.File != "" {
+		f, err := os.Open(l.config.File)
+		if err != nil {
+			return l.refreshErr("file", err)
+		}
+		lines, err := readLines(f)
+		f.Close()
+		if err != nil {
+			return l.refreshErr("file", err)
+		}
+		if err := add("file", lines); err != nil {
+			return l.refreshErr("file", err)
+		}
+	}
+	if l.config.RedisSet != "" {
+		members, err := l.redis.SMembers(ctx, l.config.RedisSet).Result()
+		if err != nil {
+			return l.refreshErr("redis_set", err)
+		}
+		if err := add("redis_set", members); err != nil {
+			return l.refreshErr("redis_set", err)
+		}
+	}
+	if l.config.URL != "" {
+		lines, err := l.fetch(ctx)
+		if err != nil {
+			return l.refreshErr("url", err)
+		}
+		if err := add("url", lines); err != nil {
+			return l.refreshErr("url", err)
+		}
+	}
+
+	l.addrs.Store(&addrs)
+	RecordTxPolicyListSize(l.name, len(addrs))
+	return nil
+}
+
+func (l *AddressList) fetch(ctx context.Context) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, l.config.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := l.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+	return readLines(res.Body)
+}
+
+func (l *AddressList) refreshErr(source string, err error) error {
+	RecordTxPolicyRefreshError(l.name, source)
+	return fmt.Errorf("error loading %s of %s: %w", source, l.name, err)
+}
+
+func readLines(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines, scanner.Err()
+}
+
+// TxPolicy rejects raw transactions whose sender or recipient is blocklisted,
+// or whose sender is not allowlisted if an allowlist is configured.
+type TxPolicy struct {
+	blocklist       *AddressList
+	allowlist       *AddressList
+	refreshInterval time.Duration
+
+	quit     chan struct{}
+	stopOnce sync.Once
+}
+
+func NewTxPolicy(config TxPolicyConfig, r redis.UniversalClient) (*TxPolicy, error) {
+	blocklist, err := NewAddressList(TxPolicyListBlocklist, config.Blocklist, r)
+	if err != nil {
+		return nil, err
+	}
+	allowlist, err := NewAddressList(TxPolicyListAllowlist, config.Allowlist, r)
+	if err != nil {
+		return nil, err
+	}
+	refreshInterval := defaultTxPolicyRefreshInterval
+	if config.RefreshInterval != 0 {
+		refreshInterval = time.Duration(config.RefreshInterval)
+	}
+	return &TxPolicy{
+		blocklist:       blocklist,
+		allowlist:       allowlist,
+		refreshInterval: refreshInterval,
+		quit:            make(chan struct{}),
+	}, nil
+}
+
+// Start loads the lists, failing if they can't be, and refreshes them
+// periodically until Stop is called.
+func (p *TxPolicy) Start(ctx context.Context) error {
+	if err := p.refresh(ctx); err != nil {
+		return err
+	}
+	go func() {
+		ticker := time.NewTicker(p.refreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := p.refresh(context.Background()); err != nil {
+					log.Error("error refreshing transaction policy lists", "err", err)
+				}
+			case <-p.quit:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (p *TxPolicy) Stop() {
+	p.stopOnce.Do(func() {
+		close(p.quit)
+	})
+}
+
+// refresh reloads both lists, returning the first error.
+func (p *TxPolicy) refresh(ctx context.Context) error {
+	blocklistErr := p.blocklist.Refresh(ctx)
+	allowlistErr := p.allowlist.Refresh(ctx)
+	if blocklistErr != nil {
+		return blocklistErr
+	}
+	return allowlistErr
+}
+
+// Check returns the name of the list rejecting the transaction of sender, if
+// any.
+func (p *TxPolicy) Check(sender *TxSender) (string, bool) {
+	if p.blocklist.Contains(sender.From) || (sender.To != nil && p.blocklist.Contains(*sender.To)) {
+		return TxPolicyListBlocklist, false
+	}
+	if p.allowlist.Configured() && !p.allowlist.Contains(sender.From) {
+		return TxPolicyListAllowlist, false
+	}
+	return "", true
+}
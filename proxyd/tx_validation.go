@@ -0,0 +1,75 @@
+package proxyd
+
+import (
+	"math/big"
+)
+
+const (
+	TxValidationReasonMalformed = "malformed"
+	TxValidationReasonChainID   = "chain_id"
+	TxValidationReasonGasLimit  = "gas_limit"
+	TxValidationReasonFeeCap    = "fee_cap"
+	TxValidationReasonMaxBlobs  = "max_blobs"
+	TxValidationReasonBlobFee   = "blob_fee_cap"
+)
+
+// TxValidator rejects raw transactions that would obviously be rejected
+// upstream, so that sequencers don't have to process the spam and clients get
+// a clearer error sooner.
+type TxValidator struct {
+	allowedChainIDs []*big.Int
+	maxGas          uint64
+	minGasFeeCap    *big.Int
+	maxBlobsPerTx   int
+	minBlobFeeCap   *big.Int
+}
+
+func NewTxValidator(config TxValidationConfig) *TxValidator {
+	return &TxValidator{
+		allowedChainIDs: config.AllowedChainIDs,
+		maxGas:          config.MaxGas,
+		minGasFeeCap:    config.MinGasFeeCap,
+		maxBlobsPerTx:   config.MaxBlobsPerTx,
+		minBlobFeeCap:   config.MinBlobFeeCap,
+	}
+}
+
+// Validate returns the error to respond with if the transaction of sender is
+// invalid, along with the reason of the rejection.
+func (v *TxValidator) Validate(sender *TxSender) (string, *RPCErr) {
+	if !isAllowedChainID(v.allowedChainIDs, sender.ChainID) {
+		return TxValidationReasonChainID, ErrTxChainIDNotAllowed(sender.ChainID)
+	}
+	if v.maxGas > 0 && sender.Gas > v.maxGas {
+		return TxValidationReasonGasLimit, ErrTxGasLimitTooHigh(sender.Gas, v.maxGas)
+	}
+	if v.minGasFeeCap != nil && sender.GasFeeCap != nil && sender.GasFeeCap.Cmp(v.minGasFeeCap) < 0 {
+		return TxValidationReasonFeeCap, ErrTxFeeCapTooLow(sender.GasFeeCap, v.minGasFeeCap)
+	}
+	if sender.BlobCount > 0 {
+		if v.maxBlobsPerTx > 0 && sender.BlobCount > v.maxBlobsPerTx {
+			return TxValidationReasonMaxBlobs, ErrTooManyBlobs(sender.BlobCount, v.maxBlobsPerTx)
+		}
+		if v.minBlobFeeCap != nil && sender.BlobFeeCap != nil && sender.BlobFeeCap.Cmp(v.minBlobFeeCap) < 0 {
+			return TxValidationReasonBlobFee, ErrBlobFeeCapTooLow(sender.BlobFeeCap, v.minBlobFeeCap)
+		}
+	}
+	return "", nil
+}
+
+// isAllowedChainID returns whether chainID is one of allowed, or whether
+// allowed is empty. Pre-EIP-155 transactions have chain ID 0.
+func isAllowedChainID(allowed []*big.Int, chainID *big.Int) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	if chainID == nil {
+		return false
+	}
+	for _, id := range allowed {
+		if chainID.Cmp(id) == 0 {
+			return true
+		}
+	}
+	return false
+}
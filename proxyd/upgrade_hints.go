@@ -0,0 +1,200 @@
+package proxyd
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	defaultUpgradeHintsInterval  = time.Minute
+	defaultUpgradeHintsThreshold = 60
+	subscriptionAvailableHdr     = "X-Proxyd-Subscription-Available"
+
+	// upgradeHintTopClients is the number of clients published as the top
+	// offenders of each interval.
+	upgradeHintTopClients = 10
+	// maxUpgradeHintClients bounds the clients counted over an interval.
+	maxUpgradeHintClients = 10000
+)
+
+var defaultUpgradeHintsMethods = []string{
+	"eth_blockNumber",
+	"eth_getBlockByNumber",
+	"eth_getFilterChanges",
+}
+
+type UpgradeHint int
+
+const (
+	UpgradeHintNone UpgradeHint = iota
+	UpgradeHintAdvertise
+	UpgradeHintRequire
+)
+
+// UpgradeHinter watches for clients that repeatedly poll methods which are
+// better served by a subscription, and steers them towards the WS endpoint.
+// Clients over the hint threshold get response headers advertising the
+// subscription endpoint. Clients over the optional reject threshold are
+// answered with a 426 Upgrade Required instead of being served.
+type UpgradeHinter struct {
+	methods   map[string]bool
+	hintLim   FrontendRateLimiter
+	rejectLim FrontendRateLimiter
+	wsURL     string
+	altSvc    string
+	offenders *upgradeHintOffenders
+}
+
+func NewUpgradeHinter(methods []string, hintLim, rejectLim FrontendRateLimiter, wsURL, altSvc string, interval time.Duration) *UpgradeHinter {
+	if len(methods) == 0 {
+		methods = defaultUpgradeHintsMethods
+	}
+	m := make(map[string]bool, len(methods))
+	for _, method := range methods {
+		m[method] = true
+	}
+	return &UpgradeHinter{
+		methods:   m,
+		hintLim:   hintLim,
+		rejectLim: rejectLim,
+		wsURL:     wsURL,
+		altSvc:    altSvc,
+		offenders: newUpgradeHintOffenders(interval),
+	}
+}
+
+// Check records a poll of method by the client identified by key, and returns
+// how the response to that client should be treated.
+func (u *UpgradeHinter) Check(ctx context.Context, key string, method string) UpgradeHint {
+	if !u.methods[method] {
+		return UpgradeHintNone
+	}
+
+	hint := UpgradeHintNone
+	ok, err := u.hintLim.Take(ctx, key)
+	if err != nil {
+		log.Warn("error taking upgrade hint limit", "err", err, "req_id", GetReqID(ctx))
+		return UpgradeHintNone
+	}
+	if !ok {
+		hint = UpgradeHintAdvertise
+	}
+
+	if u.rejectLim != nil {
+		ok, err := u.rejectLim.Take(ctx, key)
+		if err != nil {
+			log.Warn("error taking upgrade reject limit", "err", err, "req_id", GetReqID(ctx))
+		} else if !ok {
+			hint = UpgradeHintRequire
+		}
+	}
+
+	var action string
+	switch hint {
+	case UpgradeHintAdvertise:
+		action = "advertise"
+	case UpgradeHintRequire:
+		action = "require"
+	default:
+		return hint
+	}
+	RecordUpgradeHint(ctx, method, action)
+	// the heaviest pollers are hinted on every poll, so each client is only
+	// logged once per interval
+	logFn := log.Debug
+	if u.offenders.record(key) {
+		logFn = log.Info
+	}
+	logFn(
+		"polling client hinted to upgrade",
+		"req_id", GetReqID(ctx),
+		"auth", GetAuthCtx(ctx),
+		"method", method,
+		"action", action,
+		"remote_ip", key,
+	)
+	return hint
+}
+
+// upgradeHintOffenders counts the hinted polls of each client over an
+// interval. The metric of upgrade hints has no client label, since clients are
+// unbounded, so the clients hinted the most over the last interval are
+// published as a separate gauge, replaced at the first hint of each interval.
+type upgradeHintOffenders struct {
+	mtx      sync.Mutex
+	interval time.Duration
+	start    time.Time
+	counts   map[string]int
+}
+
+func newUpgradeHintOffenders(interval time.Duration) *upgradeHintOffenders {
+	return &upgradeHintOffenders{
+		interval: interval,
+		start:    time.Now(),
+		counts:   make(map[string]int),
+	}
+}
+
+// record counts a hinted poll of the client identified by key, and returns
+// whether it is the first hint of the client over the interval.
+func (o *upgradeHintOffenders) record(key string) bool {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+
+	if now := time.Now(); now.Sub(o.start) >= o.interval {
+		o.publish()
+		o.start = now
+		o.counts = make(map[string]int)
+	}
+
+	count, ok := o.counts[key]
+	if !ok && len(o.counts) >= maxUpgradeHintClients {
+		return false
+	}
+	o.counts[key] = count + 1
+	return !ok
+}
+
+// publish replaces the top offenders with the ones of the current interval.
+func (o *upgradeHintOffenders) publish() {
+	keys := make([]string, 0, len(o.counts))
+	for key := range o.counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if o.counts[keys[i]] != o.counts[keys[j]] {
+			return o.counts[keys[i]] > o.counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	if len(keys) > upgradeHintTopClients {
+		keys = keys[:upgradeHintTopClients]
+	}
+
+	upgradeHintTopClientsGauge.Reset()
+	for _, key := range keys {
+		upgradeHintTopClientsGauge.WithLabelValues(key).Set(float64(o.counts[key]))
+	}
+}
+
+// SetHeaders advertises the subscription endpoint on the response.
+func (u *UpgradeHinter) SetHeaders(w http.ResponseWriter, hint UpgradeHint) {
+	if hint == UpgradeHintNone {
+		return
+	}
+	if u.wsURL != "" {
+		w.Header().Set(subscriptionAvailableHdr, u.wsURL)
+		w.Header().Set("Link", "<"+u.wsURL+">; rel=\"alternate\"")
+	}
+	if u.altSvc != "" {
+		w.Header().Set("Alt-Svc", u.altSvc)
+	}
+	if hint == UpgradeHintRequire {
+		w.Header().Set("Upgrade", "websocket")
+	}
+}
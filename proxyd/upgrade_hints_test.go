@@ -0,0 +1,35 @@
+package proxyd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpgradeHintOffenders(t *testing.T) {
+	offenders := newUpgradeHintOffenders(50 * time.Millisecond)
+
+	// clients are only reported once per interval
+	require.True(t, offenders.record("1.1.1.1"))
+	require.False(t, offenders.record("1.1.1.1"))
+	require.False(t, offenders.record("1.1.1.1"))
+	require.True(t, offenders.record("2.2.2.2"))
+	require.False(t, offenders.record("2.2.2.2"))
+	for i := 0; i < upgradeHintTopClients; i++ {
+		offenders.record(string(rune('a' + i)))
+	}
+
+	// the top clients of the interval are published when the next starts
+	time.Sleep(60 * time.Millisecond)
+	require.True(t, offenders.record("1.1.1.1"))
+	require.Equal(t, upgradeHintTopClients, testutil.CollectAndCount(upgradeHintTopClientsGauge))
+	require.Equal(t, float64(3), testutil.ToFloat64(upgradeHintTopClientsGauge.WithLabelValues("1.1.1.1")))
+	require.Equal(t, float64(2), testutil.ToFloat64(upgradeHintTopClientsGauge.WithLabelValues("2.2.2.2")))
+
+	time.Sleep(60 * time.Millisecond)
+	offenders.record("2.2.2.2")
+	require.Equal(t, 1, testutil.CollectAndCount(upgradeHintTopClientsGauge))
+	require.Equal(t, float64(1), testutil.ToFloat64(upgradeHintTopClientsGauge.WithLabelValues("1.1.1.1")))
+}
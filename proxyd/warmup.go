@@ -0,0 +1,145 @@
+package proxyd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	defaultCacheWarmupBlocks  = 16
+	defaultCacheWarmupTimeout = 30 * time.Second
+)
+
+// WarmCache prefetches the latest blocks, the receipts of their transactions
+// and the gas price through the regular request path, so that the responses of
+// cacheable methods are stored in the cache. Only methods that are mapped and
+// cacheable at startup are warmed. Failures are logged and don't prevent
+// proxyd from starting.
+func (s *Server) WarmCache(ctx context.Context, cfg CacheWarmupConfig) {
+	numBlocks := cfg.Blocks
+	if numBlocks == 0 {
+		numBlocks = defaultCacheWarmupBlocks
+	}
+	timeout := defaultCacheWarmupTimeout
+	if cfg.Timeout != 0 {
+		timeout = time.Duration(cfg.Timeout)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	ctx = context.WithValue(ctx, ContextKeyReqID, "cache_warmup") // nolint:staticcheck
+
+	start := time.Now()
+	w := &cacheWarmer{srv: s, routing: s.routing.Load()}
+	if err := w.warm(ctx, numBlocks, cfg.Receipts, cfg.GasPrice); err != nil {
+		log.Warn("error warming cache", "err", err, "requests", w.requests, "duration", time.Since(start))
+		RecordCacheWarmup("error", w.requests)
+		return
+	}
+	log.Info("warmed cache", "blocks", numBlocks, "requests", w.requests, "duration", time.Since(start))
+	RecordCacheWarmup("success", w.requests)
+}
+
+type cacheWarmer struct {
+	srv      *Server
+	routing  *routingConfig
+	requests int
+}
+
+type warmupBlock struct {
+	Hash         string   `json:"hash"`
+	Transactions []string `json:"transactions"`
+}
+
+func (w *cacheWarmer) warm(ctx context.Context, numBlocks int, receipts bool, gasPrice bool) error {
+	res, err := w.call(ctx, []*RPCReq{newWarmupReq(0, "eth_blockNumber")})
+	if err != nil {
+		return err
+	}
+	var latest hexutil.Uint64
+	if err := decodeWarmupResult(res[0], &latest); err != nil {
+		return wrapErr(err, "error reading latest block number")
+	}
+
+	var reqs []*RPCReq
+	for num := uint64(latest); num+uint64(numBlocks) > uint64(latest); num-- {
+		reqs = append(reqs, newWarmupReq(len(reqs), "eth_getBlockByNumber", hexutil.EncodeUint64(num), false))
+		if num == 0 {
+			break
+		}
+	}
+	if gasPrice {
+		reqs = append(reqs, newWarmupReq(len(reqs), "eth_gasPrice"))
+	}
+	res, err = w.call(ctx, reqs)
+	if err != nil {
+		return err
+	}
+
+	reqs = reqs[:0]
+	for _, blockRes := range res {
+		var block warmupBlock
+		if decodeWarmupResult(blockRes, &block) != nil || block.Hash == "" {
+			continue
+		}
+		reqs = append(reqs, newWarmupReq(len(reqs), "eth_getBlockByHash", block.Hash, false))
+		if !receipts {
+			continue
+		}
+		for _, txHash := range block.Transactions {
+			reqs = append(reqs, newWarmupReq(len(reqs), "eth_getTransactionReceipt", txHash))
+		}
+	}
+	if len(reqs) == 0 {
+		return nil
+	}
+	_, err = w.call(ctx, reqs)
+	return err
+}
+
+// call sends reqs as a batch through the server, and returns their responses.
+func (w *cacheWarmer) call(ctx context.Context, reqs []*RPCReq) ([]*RPCRes, error) {
+	w.requests += len(reqs)
+	return w.srv.callInternal(ctx, w.routing, reqs)
+}
+
+// callInternal sends reqs as a batch through the request path of the server,
+// without rate limits, and returns their responses. The error of a single
+// request is returned as an error.
+func (s *Server) callInternal(ctx context.Context, routing *routingConfig, reqs []*RPCReq) ([]*RPCRes, error) {
+	raw := make([]json.RawMessage, len(reqs))
+	for i, req := range reqs {
+		raw[i] = mustMarshalJSON(req)
+	}
+	res, _, _, err := s.handleBatchRPC(ctx, routing, raw, func(string) bool { return false }, true)
+	if err != nil {
+		return nil, err
+	}
+	if res[0].IsError() && len(reqs) == 1 {
+		return nil, fmt.Errorf("error calling %s: %w", reqs[0].Method, res[0].Error)
+	}
+	return res, nil
+}
+
+func newWarmupReq(id int, method string, params ...interface{}) *RPCReq {
+	if params == nil {
+		params = []interface{}{}
+	}
+	return &RPCReq{
+		JSONRPC: JSONRPCVersion,
+		Method:  method,
+		Params:  mustMarshalJSON(params),
+		ID:      mustMarshalJSON(id),
+	}
+}
+
+func decodeWarmupResult(res *RPCRes, v interface{}) error {
+	if res.IsError() {
+		return res.Error
+	}
+	return json.Unmarshal(mustMarshalJSON(res.Result), v)
+}
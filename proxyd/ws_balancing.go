@@ -0,0 +1,104 @@
+package proxyd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// WSBalancingOrdered connects WS clients to the first available backend
+	// of the WS backend group.
+	WSBalancingOrdered = "ordered"
+	// WSBalancingLeastConnections connects WS clients to the available
+	// backend with the fewest clients.
+	WSBalancingLeastConnections = "least_connections"
+
+	defaultWSStickyTTL = time.Hour
+)
+
+// WSBalancer orders the backends WS clients connect to, by strategy and, if
+// sticky, preferring the backend the auth key of the client last connected
+// to, so that backend-side state survives reconnects.
+type WSBalancer struct {
+	leastConns bool
+	sticky     bool
+	stickyTTL  time.Duration
+
+	mtx      sync.Mutex
+	bindings map[string]wsBinding
+}
+
+// wsBinding is the backend an auth key last connected to.
+type wsBinding struct {
+	backend string
+	expires time.Time
+}
+
+func NewWSBalancer(config WSBalancingConfig) (*WSBalancer, error) {
+	switch config.Strategy {
+	case "", WSBalancingOrdered, WSBalancingLeastConnections:
+	default:
+		return nil, fmt.Errorf("invalid ws_balancing.strategy %s", config.Strategy)
+	}
+	if config.Strategy != WSBalancingLeastConnections && !config.Sticky {
+		return nil, nil
+	}
+	stickyTTL := defaultWSStickyTTL
+	if config.StickyTTL != 0 {
+		stickyTTL = time.Duration(config.StickyTTL)
+	}
+	return &WSBalancer{
+		leastConns: config.Strategy == WSBalancingLeastConnections,
+		sticky:     config.Sticky,
+		stickyTTL:  stickyTTL,
+		bindings:   make(map[string]wsBinding),
+	}, nil
+}
+
+// order returns backends in the order the client of ctx should try them.
+func (b *WSBalancer) order(ctx context.Context, backends []*Backend) []*Backend {
+	if b.leastConns {
+		backends = append([]*Backend(nil), backends...)
+		// ties keep the order of the group
+		sort.SliceStable(backends, func(i, j int) bool {
+			return backends[i].wsClients.Load() < backends[j].wsClients.Load()
+		})
+	}
+	if name := b.boundBackend(ctx); name != "" {
+		backends = preferBackend(backends, name)
+	}
+	return backends
+}
+
+// boundBackend returns the backend the auth key of ctx is bound to, if any.
+func (b *WSBalancer) boundBackend(ctx context.Context) string {
+	alias, ok := ctx.Value(ContextKeyAuth).(string)
+	if !b.sticky || !ok {
+		return ""
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	binding, ok := b.bindings[alias]
+	if !ok || time.Now().After(binding.expires) {
+		return ""
+	}
+	return binding.backend
+}
+
+// bind binds the auth key of ctx to backend, if sticky.
+func (b *WSBalancer) bind(ctx context.Context, backend *Backend) {
+	alias, ok := ctx.Value(ContextKeyAuth).(string)
+	if b == nil || !b.sticky || !ok {
+		return
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	// auth keys are configured, so the bindings are bounded
+	b.bindings[alias] = wsBinding{
+		backend: backend.Name,
+		expires: time.Now().Add(b.stickyTTL),
+	}
+}
@@ -0,0 +1,108 @@
+package proxyd
+
+import (
+	"compress/flate"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	defaultWSCompressionLevel   = flate.BestSpeed
+	defaultWSCompressionMinSize = 256
+)
+
+// WSCompression compresses the messages written to WS clients which
+// negotiated permessage-deflate. Messages under the minimum size aren't
+// compressed, and the connections compressing their messages are bounded, as
+// each of them holds a compressor while writing.
+type WSCompression struct {
+	level    int
+	minSize  int
+	maxConns int64
+	conns    atomic.Int64
+}
+
+func NewWSCompression(config WSCompressionConfig) (*WSCompression, error) {
+	level, err := config.level()
+	if err != nil {
+		return nil, err
+	}
+	if !config.Enabled {
+		return nil, nil
+	}
+	minSize := defaultWSCompressionMinSize
+	if config.MinSize != 0 {
+		minSize = config.MinSize
+	}
+	return &WSCompression{
+		level:    level,
+		minSize:  minSize,
+		maxConns: int64(config.MaxConns),
+	}, nil
+}
+
+func (c WSCompressionConfig) level() (int, error) {
+	if c.Level == 0 {
+		return defaultWSCompressionLevel, nil
+	}
+	if c.Level < flate.HuffmanOnly || c.Level > flate.BestCompression {
+		return 0, fmt.Errorf("invalid ws_compression.level %d", c.Level)
+	}
+	return c.Level, nil
+}
+
+// acquire reports whether conn may compress its messages, in which case it
+// must be released once closed.
+func (c *WSCompression) acquire(conn *websocket.Conn) bool {
+	if c.conns.Add(1) > c.maxConns && c.maxConns > 0 {
+		c.conns.Add(-1)
+		RecordWSCompressionRejection()
+		return false
+	}
+	if err := conn.SetCompressionLevel(c.level); err != nil {
+		c.conns.Add(-1)
+		return false
+	}
+	return true
+}
+
+func (c *WSCompression) release() {
+	c.conns.Add(-1)
+}
+
+// wsOffersCompression reports whether the upgrade request of a client offers
+// permessage-deflate, which the upgrader accepts when compression is enabled.
+func wsOffersCompression(header http.Header) bool {
+	for _, ext := range header.Values("Sec-WebSocket-Extensions") {
+		if strings.Contains(ext, "permessage-deflate") {
+			return true
+		}
+	}
+	return false
+}
+
+// configureCompression compresses the messages written to the client if it
+// negotiated compression. Connections over the limit still negotiate it, but
+// their messages are left uncompressed.
+func (w *WSProxier) configureCompression(c *WSCompression, negotiated bool) {
+	if !negotiated {
+		return
+	}
+	if !c.acquire(w.clientConn) {
+		w.clientConn.EnableWriteCompression(false)
+		return
+	}
+	w.compression = c
+}
+
+// compressMsg compresses msg when written if it isn't too small to be worth
+// it. It must be called with the client connection locked.
+func (w *WSProxier) compressMsg(msg []byte) {
+	if w.compression != nil {
+		w.clientConn.EnableWriteCompression(len(msg) >= w.compression.minSize)
+	}
+}
@@ -0,0 +1,79 @@
+package proxyd
+
+import (
+	"sync"
+)
+
+const (
+	WSConnLimitGlobal = "global"
+	WSConnLimitPerIP  = "per_ip"
+
+	defaultWSConnLimitErrorMessage = "too many websocket connections"
+)
+
+// ErrTooManyWSConns is returned to WS clients rejected by the connection
+// limits, before the upgrade.
+func ErrTooManyWSConns(message string, httpCode int) *RPCErr {
+	if message == "" {
+		message = defaultWSConnLimitErrorMessage
+	}
+	if httpCode == 0 {
+		httpCode = 429
+	}
+	return &RPCErr{
+		Code:          JSONRPCErrorInternal - 24,
+		Message:       message,
+		HTTPErrorCode: httpCode,
+	}
+}
+
+// WSConnLimiter bounds the concurrent frontend WS connections, in total and
+// per client IP. A zero limit is unlimited.
+type WSConnLimiter struct {
+	maxConns      int
+	maxConnsPerIP int
+	err           *RPCErr
+
+	mu    sync.Mutex
+	conns int
+	perIP map[string]int
+}
+
+func NewWSConnLimiter(config WSConnLimitsConfig) *WSConnLimiter {
+	return &WSConnLimiter{
+		maxConns:      config.MaxConns,
+		maxConnsPerIP: config.MaxConnsPerIP,
+		err:           ErrTooManyWSConns(config.ErrorMessage, config.ErrorCode),
+		perIP:         make(map[string]int),
+	}
+}
+
+// Acquire counts a connection of ip. If a limit is reached it returns the
+// name of the limit, and the connection must be rejected. Otherwise, the
+// connection must be released once closed.
+func (l *WSConnLimiter) Acquire(ip string) (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.maxConns > 0 && l.conns >= l.maxConns {
+		return WSConnLimitGlobal, false
+	}
+	if l.maxConnsPerIP > 0 && l.perIP[ip] >= l.maxConnsPerIP {
+		return WSConnLimitPerIP, false
+	}
+	l.conns++
+	l.perIP[ip]++
+	return "", true
+}
+
+func (l *WSConnLimiter) Release(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.conns--
+	if l.perIP[ip] <= 1 {
+		delete(l.perIP, ip)
+	} else {
+		l.perIP[ip]--
+	}
+}
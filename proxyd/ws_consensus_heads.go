@@ -0,0 +1,104 @@
+package proxyd
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// wsConsensusHeadsKey identifies the upstream subscription of the mux fed by
+// the consensus poller.
+const wsConsensusHeadsKey = "consensus:newHeads"
+
+// wsConsensusHeads feeds the newHeads subscriptions of the mux with the
+// latest blocks of the consensus group of a backend group, rather than with
+// subscriptions to backends. Headers are fetched from the backends of the
+// consensus group as the poller advances, the blocks skipped between two
+// polls included.
+type wsConsensusHeads struct {
+	mux    *WSSubscriptionMux
+	group  *BackendGroup
+	notify chan struct{}
+	done   chan struct{}
+
+	mtx    sync.Mutex
+	number uint64
+	hash   string
+
+	// last and lastHash are the last head published, used by run only.
+	last     uint64
+	lastHash string
+}
+
+// onHead records the latest consensus block, which is published
+// asynchronously so that the poller isn't held up.
+func (h *wsConsensusHeads) onHead(number hexutil.Uint64, hash string) {
+	h.mtx.Lock()
+	h.number, h.hash = uint64(number), hash
+	h.mtx.Unlock()
+	select {
+	case h.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (h *wsConsensusHeads) run() {
+	for {
+		select {
+		case <-h.notify:
+		case <-h.done:
+			return
+		}
+		h.mtx.Lock()
+		number, hash := h.number, h.hash
+		h.mtx.Unlock()
+		h.publish(number, hash)
+	}
+}
+
+// publish publishes the heads up to the block number with hash, reorgs
+// publishing the new head only.
+func (h *wsConsensusHeads) publish(number uint64, hash string) {
+	if hash == h.lastHash {
+		return
+	}
+	from := number
+	if h.last != 0 && number > h.last && number-h.last <= defaultWSMaxGapBlocks {
+		from = h.last + 1
+	}
+	h.last, h.lastHash = number, hash
+	// headers aren't fetched until clients subscribe
+	if !h.mux.hasUpstream(wsConsensusHeadsKey) {
+		return
+	}
+
+	results := make([]json.RawMessage, 0, number-from+1)
+	for n := from; n <= number; n++ {
+		header, err := h.fetchHeader(n)
+		if err != nil {
+			log.Warn("error fetching consensus head", "block", n, "err", err)
+			break
+		}
+		results = append(results, header)
+	}
+	h.mux.publish(wsConsensusHeadsKey, results)
+}
+
+// fetchHeader fetches the header of block number n from the first backend of
+// the consensus group serving it.
+func (h *wsConsensusHeads) fetchHeader(n uint64) (json.RawMessage, error) {
+	var err error
+	for _, be := range h.group.Consensus.GetConsensusGroup() {
+		var header json.RawMessage
+		if header, err = fetchHeader(context.Background(), be, n); err == nil {
+			return header, nil
+		}
+	}
+	if err == nil {
+		err = ErrNoBackends
+	}
+	return nil, err
+}
@@ -0,0 +1,153 @@
+package proxyd
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// WSShutdownNotificationMethod is the method of the notification sent to
+	// WS clients when proxyd shuts down, if enabled.
+	WSShutdownNotificationMethod = "proxyd_shutdown"
+
+	WSDrainResultClosed = "closed"
+	WSDrainResultForced = "forced"
+
+	defaultWSDrainTimeout = 30 * time.Second
+)
+
+var ErrShuttingDown = &RPCErr{
+	Code:          JSONRPCErrorInternal - 31,
+	Message:       "server is shutting down",
+	HTTPErrorCode: 503,
+}
+
+// wsShutdownParams are the params of the shutdown notification.
+type wsShutdownParams struct {
+	// RetryAfter is the number of seconds clients should wait before
+	// reconnecting, if any.
+	RetryAfter int64 `json:"retryAfter,omitempty"`
+}
+
+// wsDrainer tracks the WS connections of clients, which are asked to
+// disconnect on shutdown and waited for up to a deadline.
+type wsDrainer struct {
+	timeout    time.Duration
+	retryAfter time.Duration
+	notify     bool
+
+	mtx      sync.Mutex
+	conns    map[*WSProxier]struct{}
+	draining bool
+	wg       sync.WaitGroup
+}
+
+func newWSDrainer(config WSDrainConfig) *wsDrainer {
+	timeout := defaultWSDrainTimeout
+	if config.Timeout != 0 {
+		timeout = time.Duration(config.Timeout)
+	}
+	return &wsDrainer{
+		timeout:    timeout,
+		retryAfter: time.Duration(config.RetryAfter),
+		notify:     config.Notify,
+		conns:      make(map[*WSProxier]struct{}),
+	}
+}
+
+// add tracks the connection of p, unless the drainer is draining already in
+// which case the connection must be closed. Tracked connections must be
+// removed once closed.
+func (d *wsDrainer) add(p *WSProxier) bool {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	if d.draining {
+		return false
+	}
+	d.conns[p] = struct{}{}
+	d.wg.Add(1)
+	return true
+}
+
+func (d *wsDrainer) remove(p *WSProxier) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	if _, ok := d.conns[p]; ok {
+		delete(d.conns, p)
+		d.wg.Done()
+	}
+}
+
+func (d *wsDrainer) isDraining() bool {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	return d.draining
+}
+
+// drain asks the clients to disconnect, with a close frame carrying the
+// retry hint preceded by the shutdown notification if enabled, and waits up
+// to the timeout for them to. The remaining connections are then closed.
+func (d *wsDrainer) drain() {
+	d.mtx.Lock()
+	d.draining = true
+	conns := make([]*WSProxier, 0, len(d.conns))
+	for p := range d.conns {
+		conns = append(conns, p)
+	}
+	d.mtx.Unlock()
+
+	log.Info("draining ws connections", "conns", len(conns), "timeout", d.timeout)
+	reason := "shutting down"
+	if d.retryAfter > 0 {
+		reason = fmt.Sprintf("shutting down, retry after %s", d.retryAfter)
+	}
+	closeMsg := websocket.FormatCloseMessage(websocket.CloseServiceRestart, reason)
+	var notification []byte
+	if d.notify {
+		notification = mustMarshalJSON(&RPCReq{
+			JSONRPC: JSONRPCVersion,
+			Method:  WSShutdownNotificationMethod,
+			Params:  mustMarshalJSON([]wsShutdownParams{{RetryAfter: int64(d.retryAfter / time.Second)}}),
+		})
+	}
+	for _, p := range conns {
+		if notification != nil {
+			if err := p.writeClientConn(websocket.TextMessage, notification); err != nil {
+				log.Debug("error writing ws shutdown notification", "err", err)
+			}
+		}
+		if err := p.writeClientConn(websocket.CloseMessage, closeMsg); err != nil {
+			log.Debug("error writing ws close message", "err", err)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		RecordWSDrainedConns(WSDrainResultClosed, len(conns))
+		return
+	case <-time.After(d.timeout):
+	}
+
+	d.mtx.Lock()
+	remaining := make([]*WSProxier, 0, len(d.conns))
+	for p := range d.conns {
+		remaining = append(remaining, p)
+	}
+	d.mtx.Unlock()
+	log.Warn("closing ws connections left after drain timeout", "conns", len(remaining))
+	RecordWSDrainedConns(WSDrainResultClosed, len(conns)-len(remaining))
+	RecordWSDrainedConns(WSDrainResultForced, len(remaining))
+	// the proxiers close once their pumps fail reading
+	for _, p := range remaining {
+		p.clientConn.Close()
+	}
+}
@@ -0,0 +1,117 @@
+package proxyd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/gorilla/websocket"
+)
+
+var errWSClosed = errors.New("ws connection closed")
+
+// enableFailover fails the connection over to the other backends of group
+// when its backend fails. The subscriptions of the client are tracked, in its
+// session if it has one, so that they are restored on the new backend under
+// the IDs known to the client.
+func (w *WSProxier) enableFailover(group *BackendGroup, cfg WSFailoverConfig) {
+	w.failoverGroup = group
+	if cfg.GapFill {
+		w.maxGapBlocks = cfg.maxGapBlocks()
+		w.gapFillers = make(map[string]*wsGapFiller)
+	}
+	if w.session == nil {
+		maxSubs := cfg.MaxSubscriptions
+		if maxSubs == 0 {
+			maxSubs = defaultWSSessionSubs
+		}
+		w.session = newWSSessionTracker(&WSSession{
+			subs:    make(map[string]json.RawMessage),
+			maxSubs: maxSubs,
+		})
+	}
+}
+
+// failoverCandidates returns the backends of the failover group, starting
+// after backend, which is tried last.
+func failoverCandidates(backends []*Backend, backend *Backend) []*Backend {
+	for i, back := range backends {
+		if back == backend {
+			out := make([]*Backend, 0, len(backends))
+			out = append(out, backends[i+1:]...)
+			out = append(out, backends[:i+1]...)
+			return out
+		}
+	}
+	return backends
+}
+
+// failover replaces the failed backend connection with a connection to
+// another backend of the group. The requests in flight are answered with
+// errors, and the subscriptions of the client are restored.
+func (w *WSProxier) failover(ctx context.Context, cause error) error {
+	failed := w.backend
+	log.Warn("ws backend failed, failing over", "backend", failed.Name, "auth", GetAuthCtx(ctx), "req_id", GetReqID(ctx), "err", cause)
+
+	for _, back := range failoverCandidates(w.failoverGroup.Backends, failed) {
+		if back.InSimulatedOutage() {
+			continue
+		}
+		conn, err := back.dialWS()
+		if err != nil {
+			log.Warn("error dialing ws backend to fail over to", "backend", back.Name, "req_id", GetReqID(ctx), "err", err)
+			continue
+		}
+
+		w.backendConnMu.Lock()
+		if w.closed {
+			w.backendConnMu.Unlock()
+			conn.Close()
+			activeBackendWsConnsGauge.WithLabelValues(back.Name).Dec()
+			return errWSClosed
+		}
+		old := w.backendConn
+		w.backendConn = conn
+		w.backend = back
+		failed.wsClients.Add(-1)
+		back.wsClients.Add(1)
+		w.backendConnMu.Unlock()
+		old.Close()
+		activeBackendWsConnsGauge.WithLabelValues(failed.Name).Dec()
+		w.failoverGroup.WSBalancer.bind(ctx, back)
+
+		for _, id := range w.session.failPending() {
+			RecordRPCError(ctx, failed.Name, MethodUnknown, ErrBackendOffline)
+			if err := w.writeClientConn(websocket.TextMessage, mustMarshalJSON(NewRPCErrorRes(id, ErrBackendOffline))); err != nil {
+				return err
+			}
+		}
+		w.session.session.setBackend(back.Name)
+		// multiplexed subscriptions fail over on their own
+		for _, msg := range w.session.restoreRequests(w.liveMuxSubs()) {
+			if err := w.writeBackendConn(websocket.TextMessage, msg); err != nil {
+				return err
+			}
+		}
+
+		if w.gapFillers != nil {
+			w.armGapFillers()
+		}
+		RecordWSFailover(failed.Name, back.Name)
+		log.Info("failed ws connection over", "from", failed.Name, "to", back.Name, "auth", GetAuthCtx(ctx), "req_id", GetReqID(ctx))
+		return nil
+	}
+	return ErrNoBackends
+}
+
+// liveMuxSubs returns the multiplexed subscriptions of the client.
+func (w *WSProxier) liveMuxSubs() map[string]struct{} {
+	w.muxMu.Lock()
+	defer w.muxMu.Unlock()
+	out := make(map[string]struct{}, len(w.muxSubs))
+	for id := range w.muxSubs {
+		out[id] = struct{}{}
+	}
+	return out
+}
@@ -0,0 +1,280 @@
+package proxyd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const defaultWSMaxGapBlocks = 32
+
+// blockOnlyFields are the fields of blocks which aren't fields of headers, as
+// sent by newHeads subscriptions.
+var blockOnlyFields = []string{"transactions", "uncles", "withdrawals", "size", "totalDifficulty"}
+
+// wsGapFiller fills the gap in the notifications of a newHeads or logs
+// subscription restored on another backend, with the blocks or logs emitted
+// in between fetched from the new backend. Notifications already delivered
+// before the failover are skipped, so that subscribers get a complete,
+// ordered stream.
+type wsGapFiller struct {
+	typ       string
+	filter    map[string]json.RawMessage
+	maxBlocks uint64
+
+	mtx sync.Mutex
+	// armed is set on failover, the gap being filled on the next
+	// notification.
+	armed    bool
+	seen     bool
+	last     uint64
+	lastHash string
+	// lastLogs are the logs of the last block delivered, by hash and index.
+	lastLogs map[string]bool
+}
+
+func (c WSFailoverConfig) maxGapBlocks() uint64 {
+	if c.MaxGapBlocks > 0 {
+		return uint64(c.MaxGapBlocks)
+	}
+	return defaultWSMaxGapBlocks
+}
+
+type gapFillBlock struct {
+	Number hexutil.Uint64 `json:"number"`
+	Hash   string         `json:"hash"`
+}
+
+type gapFillLog struct {
+	BlockNumber hexutil.Uint64 `json:"blockNumber"`
+	BlockHash   string         `json:"blockHash"`
+	LogIndex    hexutil.Uint64 `json:"logIndex"`
+	Removed     bool           `json:"removed"`
+}
+
+func (l *gapFillLog) key() string {
+	return fmt.Sprintf("%s:%d:%t", l.BlockHash, l.LogIndex, l.Removed)
+}
+
+// newWSGapFiller returns a gap filler for the subscriptions with the
+// eth_subscribe params params, or nil for other types than newHeads and logs.
+func newWSGapFiller(params json.RawMessage, maxBlocks uint64) *wsGapFiller {
+	var p []json.RawMessage
+	if err := json.Unmarshal(params, &p); err != nil || len(p) == 0 {
+		return nil
+	}
+	var typ string
+	if err := json.Unmarshal(p[0], &typ); err != nil {
+		return nil
+	}
+	g := &wsGapFiller{typ: typ, maxBlocks: maxBlocks, lastLogs: make(map[string]bool)}
+	switch typ {
+	case "newHeads":
+	case "logs":
+		g.filter = make(map[string]json.RawMessage)
+		if len(p) > 1 {
+			if err := json.Unmarshal(p[1], &g.filter); err != nil {
+				return nil
+			}
+		}
+	default:
+		return nil
+	}
+	return g
+}
+
+// arm fills the gap on the next notification.
+func (g *wsGapFiller) arm() {
+	g.mtx.Lock()
+	g.armed = true
+	g.mtx.Unlock()
+}
+
+// fill returns the results to deliver in place of the result of a
+// notification: the backfilled results from backend followed by result,
+// without those already delivered.
+func (g *wsGapFiller) fill(ctx context.Context, backend *Backend, result json.RawMessage) []json.RawMessage {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+
+	armed := g.armed
+	g.armed = false
+	if g.typ == "newHeads" {
+		var head gapFillBlock
+		if err := json.Unmarshal(result, &head); err != nil {
+			return []json.RawMessage{result}
+		}
+		number := uint64(head.Number)
+		var out []json.RawMessage
+		if armed && g.seen {
+			if number == g.last && head.Hash == g.lastHash {
+				return nil
+			}
+			if number > g.last+1 {
+				out = g.backfillHeads(ctx, backend, g.last+1, number-1)
+			}
+		}
+		g.seen, g.last, g.lastHash = true, number, head.Hash
+		return append(out, result)
+	}
+
+	var lg gapFillLog
+	if err := json.Unmarshal(result, &lg); err != nil {
+		return []json.RawMessage{result}
+	}
+	number := uint64(lg.BlockNumber)
+	var out []json.RawMessage
+	if armed && g.seen && number >= g.last {
+		to := number
+		if number > g.last {
+			to = number - 1
+		}
+		out = g.backfillLogs(ctx, backend, g.last, to)
+	}
+	if g.deliverLog(&lg) {
+		out = append(out, result)
+	}
+	return out
+}
+
+// deliverLog records a log delivered, and reports whether it wasn't delivered
+// already.
+func (g *wsGapFiller) deliverLog(lg *gapFillLog) bool {
+	number := uint64(lg.BlockNumber)
+	if g.seen && number < g.last && !lg.Removed {
+		return false
+	}
+	if !g.seen || number > g.last {
+		g.seen, g.last = true, number
+		g.lastLogs = make(map[string]bool)
+	}
+	if number == g.last {
+		if g.lastLogs[lg.key()] {
+			return false
+		}
+		g.lastLogs[lg.key()] = true
+	}
+	return true
+}
+
+func (g *wsGapFiller) backfillHeads(ctx context.Context, backend *Backend, from, to uint64) []json.RawMessage {
+	if to-from+1 > g.maxBlocks {
+		log.Warn("ws subscription gap too large to fill", "type", g.typ, "from", from, "to", to)
+		RecordWSGapFill(g.typ, "too_large")
+		return nil
+	}
+	var out []json.RawMessage
+	for n := from; n <= to; n++ {
+		header, err := fetchHeader(ctx, backend, n)
+		if err != nil {
+			log.Warn("error filling ws subscription gap", "type", g.typ, "block", n, "err", err)
+			RecordWSGapFill(g.typ, "error")
+			return out
+		}
+		out = append(out, header)
+	}
+	RecordWSGapFill(g.typ, "filled")
+	RecordWSGapFilledNotifications(g.typ, len(out))
+	return out
+}
+
+// fetchHeader fetches the header of block number n from backend, as sent by
+// newHeads subscriptions.
+func fetchHeader(ctx context.Context, backend *Backend, n uint64) (json.RawMessage, error) {
+	var res RPCRes
+	if err := backend.ForwardRPC(ctx, &res, "67", "eth_getBlockByNumber", hexutil.EncodeUint64(n), false); err != nil {
+		return nil, err
+	}
+	block, ok := res.Result.(map[string]interface{})
+	if !ok {
+		return nil, ErrBackendBadResponse
+	}
+	for _, field := range blockOnlyFields {
+		delete(block, field)
+	}
+	return mustMarshalJSON(block), nil
+}
+
+func (g *wsGapFiller) backfillLogs(ctx context.Context, backend *Backend, from, to uint64) []json.RawMessage {
+	if to-from+1 > g.maxBlocks {
+		log.Warn("ws subscription gap too large to fill", "type", g.typ, "from", from, "to", to)
+		RecordWSGapFill(g.typ, "too_large")
+		return nil
+	}
+	filter := make(map[string]json.RawMessage, len(g.filter)+2)
+	for k, v := range g.filter {
+		filter[k] = v
+	}
+	filter["fromBlock"] = mustMarshalJSON(hexutil.EncodeUint64(from))
+	filter["toBlock"] = mustMarshalJSON(hexutil.EncodeUint64(to))
+
+	var res RPCRes
+	if err := backend.ForwardRPC(ctx, &res, "67", "eth_getLogs", filter); err != nil {
+		log.Warn("error filling ws subscription gap", "type", g.typ, "from", from, "to", to, "err", err)
+		RecordWSGapFill(g.typ, "error")
+		return nil
+	}
+	logs, _ := res.Result.([]interface{})
+	var out []json.RawMessage
+	for _, l := range logs {
+		raw := mustMarshalJSON(l)
+		var lg gapFillLog
+		if err := json.Unmarshal(raw, &lg); err != nil {
+			continue
+		}
+		if g.deliverLog(&lg) {
+			out = append(out, raw)
+		}
+	}
+	RecordWSGapFill(g.typ, "filled")
+	RecordWSGapFilledNotifications(g.typ, len(out))
+	return out
+}
+
+// fillGaps returns the messages to forward to the client in place of msg, a
+// notification of one of its subscriptions, once translated to the client's
+// subscription ID. Gap fillers are kept per subscription of the client, and
+// are only used by the backend pump.
+func (w *WSProxier) fillGaps(ctx context.Context, msg []byte) [][]byte {
+	var notif wsSubscriptionNotification
+	if err := json.Unmarshal(msg, &notif); err != nil || notif.Method != "eth_subscription" {
+		return [][]byte{msg}
+	}
+	id := notif.Params.Subscription
+	g, ok := w.gapFillers[id]
+	if !ok {
+		g = newWSGapFiller(w.session.session.Subscriptions()[id], w.maxGapBlocks)
+		w.gapFillers[id] = g
+	}
+	if g == nil {
+		return [][]byte{msg}
+	}
+	// the context of the client's upgrade request is done once upgraded
+	results := g.fill(context.WithoutCancel(ctx), w.currentBackend(), notif.Params.Result)
+	msgs := make([][]byte, 0, len(results))
+	for _, result := range results {
+		notif.Params.Result = result
+		msgs = append(msgs, mustMarshalJSON(&notif))
+	}
+	return msgs
+}
+
+// armGapFillers fills the gaps of the subscriptions of the client on their
+// next notifications, once failed over. The gap fillers of subscriptions
+// which are gone are dropped.
+func (w *WSProxier) armGapFillers() {
+	subs := w.session.session.Subscriptions()
+	for id, g := range w.gapFillers {
+		if _, ok := subs[id]; !ok {
+			delete(w.gapFillers, id)
+			continue
+		}
+		if g != nil {
+			g.arm()
+		}
+	}
+}
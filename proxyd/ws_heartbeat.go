@@ -0,0 +1,263 @@
+package proxyd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	WSSlowConsumerPolicyClose = "close"
+	WSSlowConsumerPolicyDrop  = "drop"
+
+	WSCloseReasonIdle         = "idle"
+	WSCloseReasonPongTimeout  = "pong_timeout"
+	WSCloseReasonSlowConsumer = "slow_consumer"
+	// WSCloseReasonPolicyViolation closes connections over messages
+	// violating the ws_message_policy.
+	WSCloseReasonPolicyViolation = "policy_violation"
+)
+
+var errWSSlowConsumer = errors.New("ws client too slow")
+
+func validateWSConnsConfig(config WSConnsConfig) error {
+	switch config.Client.SlowConsumerPolicy {
+	case "", WSSlowConsumerPolicyClose, WSSlowConsumerPolicyDrop:
+	default:
+		return fmt.Errorf("invalid ws_conns.client.slow_consumer_policy %s", config.Client.SlowConsumerPolicy)
+	}
+	if config.Client.SendBufferSize < 0 {
+		return errors.New("ws_conns.client.send_buffer_size must not be negative")
+	}
+	return nil
+}
+
+func (c WSConnConfig) writeTimeout() time.Duration {
+	if c.WriteTimeout != 0 {
+		return time.Duration(c.WriteTimeout)
+	}
+	return defaultWSWriteTimeout
+}
+
+func (c WSConnConfig) pongTimeout() time.Duration {
+	if c.PongTimeout != 0 {
+		return time.Duration(c.PongTimeout)
+	}
+	return time.Duration(c.PingInterval)
+}
+
+// wsHeartbeat pings a WS connection, and closes it once a ping goes
+// unanswered for the pong timeout or, with an idle timeout, once no message
+// was sent or received for as long. Pongs are only handled while the
+// connection is read from, which the pumps of proxyd always do.
+type wsHeartbeat struct {
+	conn         *websocket.Conn
+	source       string
+	pingInterval time.Duration
+	pongTimeout  time.Duration
+	idleTimeout  time.Duration
+	writeTimeout time.Duration
+
+	lastActive atomic.Int64
+	lastPong   atomic.Int64
+	done       chan struct{}
+	stopOnce   sync.Once
+}
+
+// startWSHeartbeat starts the heartbeat of conn, if it has one. The heartbeat
+// stops with stop, or once conn is closed and can't be pinged anymore.
+func startWSHeartbeat(conn *websocket.Conn, source string, config WSConnConfig, idleTimeout time.Duration) *wsHeartbeat {
+	if config.PingInterval == 0 && idleTimeout == 0 {
+		return nil
+	}
+	h := &wsHeartbeat{
+		conn:         conn,
+		source:       source,
+		pingInterval: time.Duration(config.PingInterval),
+		pongTimeout:  config.pongTimeout(),
+		idleTimeout:  idleTimeout,
+		writeTimeout: config.writeTimeout(),
+		done:         make(chan struct{}),
+	}
+	now := time.Now().UnixNano()
+	h.lastActive.Store(now)
+	h.lastPong.Store(now)
+	if h.pingInterval > 0 {
+		conn.SetPongHandler(func(string) error {
+			h.lastPong.Store(time.Now().UnixNano())
+			return nil
+		})
+	}
+	go h.run()
+	return h
+}
+
+// touch records a message sent or received.
+func (h *wsHeartbeat) touch() {
+	if h != nil {
+		h.lastActive.Store(time.Now().UnixNano())
+	}
+}
+
+func (h *wsHeartbeat) stop() {
+	if h != nil {
+		h.stopOnce.Do(func() { close(h.done) })
+	}
+}
+
+func (h *wsHeartbeat) run() {
+	ticker := time.NewTicker(h.period())
+	defer ticker.Stop()
+
+	// pinged is when the last ping was sent, if any.
+	var pinged time.Time
+	for {
+		select {
+		case <-ticker.C:
+		case <-h.done:
+			return
+		}
+
+		now := time.Now()
+		if h.idleTimeout > 0 && now.Sub(time.Unix(0, h.lastActive.Load())) >= h.idleTimeout {
+			h.close(WSCloseReasonIdle, "idle timeout")
+			return
+		}
+		if h.pingInterval == 0 {
+			continue
+		}
+		if !pinged.IsZero() && time.Unix(0, h.lastPong.Load()).Before(pinged) {
+			if now.Sub(pinged) >= h.pongTimeout {
+				h.close(WSCloseReasonPongTimeout, "pong timeout")
+				return
+			}
+			continue
+		}
+		if now.Sub(pinged) < h.pingInterval {
+			continue
+		}
+		if err := h.conn.WriteControl(websocket.PingMessage, nil, now.Add(h.writeTimeout)); err != nil {
+			// the connection is closed, or is about to be by its pumps
+			log.Debug("error pinging ws conn", "source", h.source, "err", err)
+			return
+		}
+		pinged = now
+	}
+}
+
+// period is how often the heartbeat checks the connection, a fraction of its
+// shortest interval.
+func (h *wsHeartbeat) period() time.Duration {
+	var period time.Duration
+	for _, d := range []time.Duration{h.pingInterval, h.pongTimeout, h.idleTimeout} {
+		if d > 0 && (period == 0 || d < period) {
+			period = d
+		}
+	}
+	return period / 4
+}
+
+// close closes the connection, whose pumps fail reading from it.
+func (h *wsHeartbeat) close(reason, text string) {
+	log.Info("closing ws conn", "source", h.source, "reason", reason)
+	RecordWSConnClosed(h.source, reason)
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, text)
+	if err := h.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(h.writeTimeout)); err != nil {
+		log.Debug("error writing ws close message", "source", h.source, "err", err)
+	}
+	h.conn.Close()
+}
+
+// wsOutMessage is a message queued to a client.
+type wsOutMessage struct {
+	msgType int
+	data    []byte
+}
+
+// isWSNotification reports whether msg is a subscription notification.
+func isWSNotification(msgType int, msg []byte) bool {
+	if msgType != websocket.TextMessage && msgType != websocket.BinaryMessage {
+		return false
+	}
+	var n struct {
+		Method string `json:"method"`
+	}
+	return json.Unmarshal(msg, &n) == nil && n.Method == "eth_subscription"
+}
+
+// configureClientConn applies the heartbeat and send queue of config to the
+// client connection. It must be called before Proxy.
+func (w *WSProxier) configureClientConn(config WSClientConnConfig) {
+	w.writeTimeout = config.writeTimeout()
+	w.heartbeat = startWSHeartbeat(w.clientConn, SourceClient, config.WSConnConfig, time.Duration(config.IdleTimeout))
+	if config.SendBufferSize > 0 {
+		w.sendQueue = make(chan wsOutMessage, config.SendBufferSize)
+		w.sendStop = make(chan struct{})
+		w.sendDone = make(chan struct{})
+		w.dropSlowNotifications = config.SlowConsumerPolicy == WSSlowConsumerPolicyDrop
+		go w.sendLoop()
+	}
+}
+
+// queueClientMsg queues a message to the client. Once the queue is full, the
+// client is disconnected or, with the drop policy, its notifications are
+// dropped and other messages wait for room up to the write timeout.
+func (w *WSProxier) queueClientMsg(msgType int, msg []byte) error {
+	out := wsOutMessage{msgType: msgType, data: msg}
+	select {
+	case w.sendQueue <- out:
+		return nil
+	case <-w.sendDone:
+		return errWSClosed
+	default:
+	}
+
+	if w.dropSlowNotifications {
+		if isWSNotification(msgType, msg) {
+			RecordWSSlowConsumerDrop()
+			return nil
+		}
+		timer := time.NewTimer(w.writeTimeout)
+		defer timer.Stop()
+		select {
+		case w.sendQueue <- out:
+			return nil
+		case <-w.sendDone:
+			return errWSClosed
+		case <-timer.C:
+		}
+	}
+
+	log.Info("closing slow ws client", "backend", w.currentBackend().Name)
+	RecordWSConnClosed(SourceClient, WSCloseReasonSlowConsumer)
+	closeMsg := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "slow consumer")
+	if err := w.clientConn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(w.writeTimeout)); err != nil {
+		log.Debug("error writing clientConn close message", "err", err)
+	}
+	w.clientConn.Close()
+	return errWSSlowConsumer
+}
+
+// sendLoop writes the messages queued to the client, and closes the client
+// connection if a write fails.
+func (w *WSProxier) sendLoop() {
+	defer close(w.sendDone)
+	for {
+		select {
+		case out := <-w.sendQueue:
+			if err := w.writeClientConnNow(out.msgType, out.data); err != nil {
+				log.Info("error writing queued ws message to client", "err", err)
+				w.clientConn.Close()
+				return
+			}
+		case <-w.sendStop:
+			return
+		}
+	}
+}
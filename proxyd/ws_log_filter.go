@@ -0,0 +1,79 @@
+package proxyd
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// wsBroadLogsParams are the params of the upstream logs subscriptions whose
+// notifications are filtered for each client.
+var wsBroadLogsParams = json.RawMessage(`["logs"]`)
+
+// wsLogFilter matches logs against the address and topics of a logs
+// subscription, as backends do.
+type wsLogFilter struct {
+	addresses map[string]bool
+	topics    []map[string]bool
+}
+
+type wsFilteredLog struct {
+	Address string   `json:"address"`
+	Topics  []string `json:"topics"`
+}
+
+// parseWSLogFilter returns the filter of the eth_subscribe params of a logs
+// subscription.
+func parseWSLogFilter(params json.RawMessage) (*wsLogFilter, error) {
+	var p []json.RawMessage
+	if err := json.Unmarshal(params, &p); err != nil || len(p) == 0 || len(p) > 2 {
+		return nil, ErrInvalidParams("invalid logs subscription params")
+	}
+	var f logsFilter
+	if len(p) == 2 {
+		if err := json.Unmarshal(p[1], &f); err != nil {
+			return nil, ErrInvalidParams(err.Error())
+		}
+	}
+
+	addresses, ok := normalizeHexList(f.Address)
+	if !ok {
+		return nil, ErrInvalidParams("invalid address")
+	}
+	filter := &wsLogFilter{
+		addresses: hexSet(addresses),
+		topics:    make([]map[string]bool, len(f.Topics)),
+	}
+	for i, t := range f.Topics {
+		topics, ok := normalizeHexList(t)
+		if !ok {
+			return nil, ErrInvalidParams("invalid topics")
+		}
+		filter.topics[i] = hexSet(topics)
+	}
+	return filter, nil
+}
+
+func hexSet(list []string) map[string]bool {
+	set := make(map[string]bool, len(list))
+	for _, s := range list {
+		set[s] = true
+	}
+	return set
+}
+
+// matches reports whether lg matches the filter. Empty sets of addresses or
+// topics at a position match any.
+func (f *wsLogFilter) matches(lg *wsFilteredLog) bool {
+	if len(f.addresses) > 0 && !f.addresses[strings.ToLower(lg.Address)] {
+		return false
+	}
+	if len(f.topics) > len(lg.Topics) {
+		return false
+	}
+	for i, topics := range f.topics {
+		if len(topics) > 0 && !topics[strings.ToLower(lg.Topics[i])] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,75 @@
+package proxyd
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	WSMessageRateLimitPolicyError = "error"
+	WSMessageRateLimitPolicyClose = "close"
+
+	defaultWSMessageRateLimitInterval = time.Second
+)
+
+// WSMessageRateLimiter limits the RPC messages clients send over WS, per
+// connection and per auth key, or client IP for unauthenticated clients.
+type WSMessageRateLimiter struct {
+	connLim   FrontendRateLimiter
+	keyLim    FrontendRateLimiter
+	closeConn bool
+}
+
+func NewWSMessageRateLimiter(config WSMessageRateLimitConfig, limiterFactory limiterFactoryFunc) (*WSMessageRateLimiter, error) {
+	switch config.Policy {
+	case "", WSMessageRateLimitPolicyError, WSMessageRateLimitPolicyClose:
+	default:
+		return nil, fmt.Errorf("invalid ws_message_rate_limit.policy %s", config.Policy)
+	}
+	if config.ConnectionLimit <= 0 && config.KeyLimit <= 0 {
+		return nil, nil
+	}
+
+	interval := defaultWSMessageRateLimitInterval
+	if config.Interval != 0 {
+		interval = time.Duration(config.Interval)
+	}
+	l := &WSMessageRateLimiter{closeConn: config.Policy == WSMessageRateLimitPolicyClose}
+	// Connections are local to an instance, so are their limits.
+	if config.ConnectionLimit > 0 {
+		l.connLim = NewMemoryFrontendRateLimit(interval, config.ConnectionLimit)
+	}
+	if config.KeyLimit > 0 {
+		l.keyLim = limiterFactory(interval, config.KeyLimit, "ws_messages")
+	}
+	return l, nil
+}
+
+// Take counts a message of the connection of ctx. It returns the name of the
+// exceeded limit, if any.
+func (l *WSMessageRateLimiter) Take(ctx context.Context) (string, error) {
+	if l.connLim != nil {
+		ok, err := l.connLim.Take(ctx, GetReqID(ctx))
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			return "connection", nil
+		}
+	}
+	if l.keyLim != nil {
+		key := GetAuthCtx(ctx)
+		if key == "" {
+			key = GetXForwardedFor(ctx)
+		}
+		ok, err := l.keyLim.Take(ctx, key)
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			return "key", nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,169 @@
+package proxyd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/gorilla/websocket"
+)
+
+// wsSubscriptionMethods are served over WS only, so they aren't mapped in
+// rpc_method_mappings.
+var wsSubscriptionMethods = map[string]bool{
+	"eth_subscribe":   true,
+	"eth_unsubscribe": true,
+}
+
+// WSMessagePolicy applies the policies of the HTTP path to each WS message:
+// the method mappings, the checks and sender rate limits of raw transactions,
+// and the batch size limits.
+type WSMessagePolicy struct {
+	srv             *Server
+	enforceMappings bool
+	senderLimits    bool
+	batches         bool
+	closeConn       bool
+}
+
+func NewWSMessagePolicy(config WSMessagePolicyConfig, srv *Server) (*WSMessagePolicy, error) {
+	switch config.Policy {
+	case "", WSMessageRateLimitPolicyError, WSMessageRateLimitPolicyClose:
+	default:
+		return nil, fmt.Errorf("invalid ws_message_policy.policy %s", config.Policy)
+	}
+	if !config.EnforceMethodMappings && !config.SenderRateLimits && !config.Batches && config.Policy != WSMessageRateLimitPolicyClose {
+		return nil, nil
+	}
+	return &WSMessagePolicy{
+		srv:             srv,
+		enforceMappings: config.EnforceMethodMappings,
+		senderLimits:    config.SenderRateLimits,
+		batches:         config.Batches,
+		closeConn:       config.Policy == WSMessageRateLimitPolicyClose,
+	}, nil
+}
+
+// checkReq checks a request of the connection of ctx, whose method is
+// whitelisted already.
+func (p *WSMessagePolicy) checkReq(ctx context.Context, req *RPCReq) error {
+	if p.enforceMappings && !wsSubscriptionMethods[req.Method] && req.Method != "eth_accounts" {
+		if _, ok := p.srv.routing.Load().rpcMethodMappings[req.Method]; !ok {
+			log.Info("blocked ws message for unmapped method", "method", req.Method, "auth", GetAuthCtx(ctx), "req_id", GetReqID(ctx))
+			return ErrMethodNotWhitelisted
+		}
+	}
+	s := p.srv
+	if p.senderLimits && req.Method == "eth_sendRawTransaction" && (s.senderLim != nil || s.txValidator != nil || s.txPolicy != nil || s.txNonce != nil) {
+		if _, err := s.checkRawTx(ctx, req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// maxBatchSize returns the batch size limit of the connection of ctx.
+func (p *WSMessagePolicy) maxBatchSize(ctx context.Context) int {
+	if policy := p.srv.authKeyPolicy(ctx); policy != nil && policy.maxBatchSize > 0 {
+		return policy.maxBatchSize
+	}
+	return p.srv.maxBatchSize
+}
+
+// prepareClientBatch checks a batch message of the client. Batches are
+// forwarded as a whole, so a batch with a request violating the policies is
+// rejected with the error of that request.
+func (w *WSProxier) prepareClientBatch(ctx context.Context, msg []byte) ([]*RPCReq, error) {
+	raw, err := ParseBatchRPCReq(msg)
+	if err != nil {
+		return nil, ErrParseErr
+	}
+	if len(raw) == 0 {
+		return nil, ErrInvalidRequest("must specify at least one batch call")
+	}
+	RecordBatchSize(len(raw))
+	if len(raw) > w.policy.maxBatchSize(ctx) {
+		return nil, ErrTooManyBatchRequests
+	}
+	reqs := make([]*RPCReq, len(raw))
+	for i, r := range raw {
+		if reqs[i], err = w.prepareClientMsg(ctx, r); err != nil {
+			return nil, err
+		}
+		// subscriptions are tracked by request, which batches aren't
+		if wsSubscriptionMethods[reqs[i].Method] {
+			return nil, ErrInvalidRequest("subscriptions can't be batched")
+		}
+	}
+	return reqs, nil
+}
+
+// closeForViolation closes the client connection over a message violating
+// the policies, if the policy says so, and reports whether it did.
+func (w *WSProxier) closeForViolation(ctx context.Context, err error) bool {
+	if w.policy == nil || !w.policy.closeConn {
+		return false
+	}
+	rpcErr, ok := err.(*RPCErr)
+	if !ok || rpcErr == ErrParseErr || rpcErr == ErrInternal {
+		return false
+	}
+	log.Info("closing ws conn over policy violation", "err", err, "auth", GetAuthCtx(ctx), "req_id", GetReqID(ctx))
+	RecordWSConnClosed(SourceClient, WSCloseReasonPolicyViolation)
+	closeMsg := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, rpcErr.Message)
+	if err := w.writeClientConn(websocket.CloseMessage, closeMsg); err != nil {
+		log.Error("error writing clientConn message", "err", err)
+	}
+	return true
+}
+
+// recordBatchRes records the errors of a batch response of the backend.
+func (w *WSProxier) recordBatchRes(ctx context.Context, msg []byte) {
+	var batch []*RPCRes
+	if err := json.Unmarshal(msg, &batch); err != nil {
+		log.Warn("error parsing batch RPC response", "source", "ws", "err", err)
+		return
+	}
+	for _, res := range batch {
+		if res.IsError() {
+			RecordRPCError(ctx, w.backend.Name, MethodUnknown, res.Error)
+		}
+	}
+}
+
+// proxyClientBatch forwards a batch message of the client to the backend, or
+// answers it with an error. Unlike single requests, batches in flight aren't
+// answered on failover. The returned error ends the proxying.
+func (w *WSProxier) proxyClientBatch(ctx context.Context, errC chan error, msgType int, msg []byte) error {
+	reqs, err := w.prepareClientBatch(ctx, msg)
+	if err != nil {
+		if w.closeForViolation(ctx, err) {
+			return err
+		}
+		log.Info("error preparing client batch", "auth", GetAuthCtx(ctx), "req_id", GetReqID(ctx), "err", err)
+		RecordRPCError(ctx, BackendProxyd, MethodUnknown, err)
+		return w.writeClientConn(msgType, mustMarshalJSON(NewRPCErrorRes(nil, err)))
+	}
+
+	if connected, err := w.connectBackend(); err != nil {
+		log.Error("error dialing ws backend", "auth", GetAuthCtx(ctx), "req_id", GetReqID(ctx), "err", err)
+		return err
+	} else if connected {
+		go w.backendPump(ctx, errC)
+	}
+
+	backendName := w.currentBackend().Name
+	for _, req := range reqs {
+		RecordRPCForward(ctx, backendName, req.Method, RPCRequestSourceWS)
+	}
+	log.Info("forwarded WS batch to backend", "size", len(reqs), "auth", GetAuthCtx(ctx), "req_id", GetReqID(ctx))
+	if err := w.writeBackendConn(msgType, msg); err != nil {
+		if w.failoverGroup != nil {
+			log.Warn("error writing to failed ws backend", "auth", GetAuthCtx(ctx), "req_id", GetReqID(ctx), "err", err)
+			return nil
+		}
+		return err
+	}
+	return nil
+}
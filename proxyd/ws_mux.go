@@ -0,0 +1,554 @@
+package proxyd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	defaultWSMuxBufferSize = 64
+	wsMuxSubscribeID       = `"proxyd_mux"`
+)
+
+var defaultWSMuxSubscriptions = []string{"newHeads"}
+
+// WSSubscriptionMux multiplexes the eth_subscribe subscriptions of WS clients,
+// so that clients subscribing to the same backend with the same params share a
+// single upstream subscription, on a connection of its own. Notifications are
+// fanned out to the clients under IDs of their own.
+type WSSubscriptionMux struct {
+	types      *StringSet
+	bufferSize int
+	// filterLogs shares an upstream logs subscription without filter among
+	// the logs subscriptions of a backend, filtering its notifications for
+	// each client.
+	filterLogs bool
+	// maxGapBlocks bounds the backfilled blocks on failover, gap filling
+	// being disabled if zero.
+	maxGapBlocks uint64
+	// heads feeds newHeads subscriptions from the consensus poller, if set.
+	heads *wsConsensusHeads
+
+	mtx       sync.Mutex
+	upstreams map[string]*wsMuxUpstream
+	subs      map[string]*wsMuxSubscriber
+}
+
+// wsMuxUpstream is a subscription to a backend shared by clients. It fails
+// over to the fallback backends, if any, when its backend fails.
+type wsMuxUpstream struct {
+	key       string
+	params    json.RawMessage
+	fallbacks []*Backend
+	gaps      *wsGapFiller
+	// ready is closed once the subscription is established, or failed with
+	// err.
+	ready chan struct{}
+	err   error
+
+	connMu  sync.Mutex
+	conn    *websocket.Conn
+	backend *Backend
+	subID   string
+	// subscribers are guarded by the mutex of the mux.
+	subscribers map[string]*wsMuxSubscriber
+}
+
+// wsMuxSubscriber is the subscription of a client to an upstream
+// subscription. Notifications are queued, so that slow clients don't hold up
+// the others.
+type wsMuxSubscriber struct {
+	id       string
+	upstream *wsMuxUpstream
+	// filter filters the notifications of broad logs subscriptions, if set.
+	filter      *wsLogFilter
+	queue       chan []byte
+	done        chan struct{}
+	write       func(msg []byte) error
+	closeClient func()
+}
+
+func NewWSSubscriptionMux(cfg WSMultiplexConfig) *WSSubscriptionMux {
+	types := cfg.Subscriptions
+	if len(types) == 0 {
+		types = defaultWSMuxSubscriptions
+	}
+	bufferSize := cfg.BufferSize
+	if bufferSize == 0 {
+		bufferSize = defaultWSMuxBufferSize
+	}
+	return &WSSubscriptionMux{
+		types:      NewStringSetFromStrings(types),
+		bufferSize: bufferSize,
+		filterLogs: cfg.FilterLogs,
+		upstreams:  make(map[string]*wsMuxUpstream),
+		subs:       make(map[string]*wsMuxSubscriber),
+	}
+}
+
+// enableGapFill backfills the notifications missed by upstream subscriptions
+// failing over, up to maxBlocks blocks.
+func (m *WSSubscriptionMux) enableGapFill(maxBlocks uint64) {
+	m.maxGapBlocks = maxBlocks
+}
+
+// serveConsensusHeads feeds newHeads subscriptions from the consensus poller
+// of group, returning the listener of the poller.
+func (m *WSSubscriptionMux) serveConsensusHeads(group *BackendGroup) OnConsensusHead {
+	m.heads = &wsConsensusHeads{
+		mux:    m,
+		group:  group,
+		notify: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	go m.heads.run()
+	return m.heads.onHead
+}
+
+// Stop stops feeding newHeads subscriptions from the consensus poller.
+func (m *WSSubscriptionMux) Stop() {
+	if m.heads != nil {
+		close(m.heads.done)
+	}
+}
+
+// Multiplexes reports whether subscriptions with the eth_subscribe params
+// params are multiplexed.
+func (m *WSSubscriptionMux) Multiplexes(params json.RawMessage) bool {
+	typ, ok := wsSubscriptionType(params)
+	if !ok {
+		return false
+	}
+	return m.types.Has(typ) || (typ == "newHeads" && m.heads != nil) || (typ == "logs" && m.filterLogs)
+}
+
+// wsSubscriptionType returns the type of subscriptions with the eth_subscribe
+// params params.
+func wsSubscriptionType(params json.RawMessage) (string, bool) {
+	var p []json.RawMessage
+	if err := json.Unmarshal(params, &p); err != nil || len(p) == 0 {
+		return "", false
+	}
+	var typ string
+	if err := json.Unmarshal(p[0], &typ); err != nil {
+		return "", false
+	}
+	return typ, true
+}
+
+// Subscribe subscribes a client to backend with params, returning the ID of
+// its subscription. Notifications are delivered with write. The upstream
+// subscription fails over to fallbacks, if any. The client is closed with
+// closeClient if a notification can't be written, or if the upstream
+// subscription fails for good. newHeads subscriptions are fed by the
+// consensus poller instead, if enabled, and logs subscriptions may share a
+// subscription without filter.
+func (m *WSSubscriptionMux) Subscribe(backend *Backend, fallbacks []*Backend, params json.RawMessage, write func(msg []byte) error, closeClient func()) (string, error) {
+	typ, _ := wsSubscriptionType(params)
+	var filter *wsLogFilter
+	if typ == "logs" && m.filterLogs {
+		var err error
+		if filter, err = parseWSLogFilter(params); err != nil {
+			return "", err
+		}
+		params = wsBroadLogsParams
+	}
+	key, err := wsMuxKey(backend, params)
+	if err != nil {
+		return "", err
+	}
+	local := typ == "newHeads" && m.heads != nil
+	if local {
+		key = wsConsensusHeadsKey
+	}
+
+	for {
+		m.mtx.Lock()
+		up := m.upstreams[key]
+		created := up == nil
+		if created {
+			up = &wsMuxUpstream{
+				key:         key,
+				params:      params,
+				fallbacks:   fallbacks,
+				ready:       make(chan struct{}),
+				subscribers: make(map[string]*wsMuxSubscriber),
+			}
+			if !local && len(fallbacks) > 0 && m.maxGapBlocks > 0 {
+				up.gaps = newWSGapFiller(params, m.maxGapBlocks)
+			}
+			m.upstreams[key] = up
+		}
+		m.mtx.Unlock()
+
+		if created && local {
+			close(up.ready)
+		} else if created {
+			up.err = up.subscribe(backend)
+			close(up.ready)
+			if up.err != nil {
+				m.mtx.Lock()
+				delete(m.upstreams, key)
+				m.mtx.Unlock()
+				return "", up.err
+			}
+			go m.pump(up)
+		}
+		<-up.ready
+		if up.err != nil {
+			return "", up.err
+		}
+
+		m.mtx.Lock()
+		// the upstream subscription may have been torn down in the meantime
+		if m.upstreams[key] != up {
+			m.mtx.Unlock()
+			continue
+		}
+		sub := &wsMuxSubscriber{
+			id:          newSubscriptionID(),
+			upstream:    up,
+			filter:      filter,
+			queue:       make(chan []byte, m.bufferSize),
+			done:        make(chan struct{}),
+			write:       write,
+			closeClient: closeClient,
+		}
+		up.subscribers[sub.id] = sub
+		m.subs[sub.id] = sub
+		m.mtx.Unlock()
+
+		RecordWSMuxSubscriber(1)
+		go sub.deliver()
+		return sub.id, nil
+	}
+}
+
+// Unsubscribe removes the subscription of a client. The upstream subscription
+// is removed along with its last subscriber. It reports whether the
+// subscription existed.
+func (m *WSSubscriptionMux) Unsubscribe(id string) bool {
+	m.mtx.Lock()
+	sub := m.subs[id]
+	if sub == nil {
+		m.mtx.Unlock()
+		return false
+	}
+	delete(m.subs, id)
+	up := sub.upstream
+	delete(up.subscribers, id)
+	last := len(up.subscribers) == 0 && m.upstreams[up.key] == up
+	if last {
+		delete(m.upstreams, up.key)
+	}
+	m.mtx.Unlock()
+
+	close(sub.done)
+	RecordWSMuxSubscriber(-1)
+	if last {
+		up.close(true)
+	}
+	return true
+}
+
+// pump fans out the notifications of up until its connection fails or is
+// closed.
+func (m *WSSubscriptionMux) pump(up *wsMuxUpstream) {
+	for {
+		conn, backend, subID := up.current()
+		if conn == nil {
+			m.fail(up, errWSClosed)
+			return
+		}
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			if m.failover(up, err) {
+				continue
+			}
+			m.fail(up, err)
+			return
+		}
+		RecordWSMessage(context.Background(), backend.Name, SourceBackend)
+
+		var notif wsSubscriptionNotification
+		if err := json.Unmarshal(msg, &notif); err != nil || notif.Params.Subscription != subID {
+			continue
+		}
+
+		results := []json.RawMessage{notif.Params.Result}
+		if up.gaps != nil {
+			results = up.gaps.fill(context.Background(), backend, notif.Params.Result)
+		}
+		m.fanOut(up, results)
+	}
+}
+
+// fanOut queues notifications with results to the subscribers of up.
+func (m *WSSubscriptionMux) fanOut(up *wsMuxUpstream, results []json.RawMessage) {
+	m.mtx.Lock()
+	subs := make([]*wsMuxSubscriber, 0, len(up.subscribers))
+	for _, sub := range up.subscribers {
+		subs = append(subs, sub)
+	}
+	m.mtx.Unlock()
+
+	notif := wsSubscriptionNotification{
+		JSONRPC: JSONRPCVersion,
+		Method:  "eth_subscription",
+	}
+	for _, result := range results {
+		notif.Params.Result = result
+		var lg *wsFilteredLog
+		for _, sub := range subs {
+			if sub.filter != nil {
+				if lg == nil {
+					lg = new(wsFilteredLog)
+					if err := json.Unmarshal(result, lg); err != nil {
+						log.Debug("error decoding multiplexed ws log", "err", err)
+					}
+				}
+				if !sub.filter.matches(lg) {
+					continue
+				}
+			}
+			notif.Params.Subscription = sub.id
+			select {
+			case sub.queue <- mustMarshalJSON(&notif):
+			default:
+				RecordWSMuxDroppedNotification()
+			}
+		}
+	}
+}
+
+// hasUpstream reports whether the upstream subscription key has subscribers.
+func (m *WSSubscriptionMux) hasUpstream(key string) bool {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return m.upstreams[key] != nil
+}
+
+// publish fans out notifications with results to the subscribers of the
+// upstream subscription key, if any.
+func (m *WSSubscriptionMux) publish(key string, results []json.RawMessage) {
+	m.mtx.Lock()
+	up := m.upstreams[key]
+	m.mtx.Unlock()
+	if up != nil {
+		m.fanOut(up, results)
+	}
+}
+
+// failover subscribes up to another backend once its connection failed, and
+// reports whether it did. Subscribers keep their subscription IDs.
+func (m *WSSubscriptionMux) failover(up *wsMuxUpstream, cause error) bool {
+	if len(up.fallbacks) == 0 || !m.live(up) {
+		return false
+	}
+	_, failed, _ := up.current()
+	up.close(false)
+	log.Warn("multiplexed ws subscription failed, failing over", "backend", failed.Name, "err", cause)
+	for _, back := range failoverCandidates(up.fallbacks, failed) {
+		if back.InSimulatedOutage() {
+			continue
+		}
+		if err := up.subscribe(back); err != nil {
+			log.Warn("error failing over multiplexed ws subscription", "backend", back.Name, "err", err)
+			continue
+		}
+		// the last subscriber may have left in the meantime
+		if !m.live(up) {
+			up.close(true)
+			return false
+		}
+		if up.gaps != nil {
+			up.gaps.arm()
+		}
+		RecordWSFailover(failed.Name, back.Name)
+		return true
+	}
+	return false
+}
+
+func (m *WSSubscriptionMux) live(up *wsMuxUpstream) bool {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return m.upstreams[up.key] == up
+}
+
+// fail closes the clients of up once its connection failed, as a backend
+// connection failure closes the clients proxied to it.
+func (m *WSSubscriptionMux) fail(up *wsMuxUpstream, err error) {
+	m.mtx.Lock()
+	if m.upstreams[up.key] != up {
+		// closed along with its last subscriber
+		m.mtx.Unlock()
+		return
+	}
+	delete(m.upstreams, up.key)
+	subs := up.subscribers
+	up.subscribers = make(map[string]*wsMuxSubscriber)
+	for id := range subs {
+		delete(m.subs, id)
+	}
+	m.mtx.Unlock()
+
+	_, backend, _ := up.current()
+	log.Warn("multiplexed ws subscription failed", "backend", backend.Name, "subscribers", len(subs), "err", err)
+	up.close(false)
+	for _, sub := range subs {
+		close(sub.done)
+		RecordWSMuxSubscriber(-1)
+		sub.closeClient()
+	}
+}
+
+func (s *wsMuxSubscriber) deliver() {
+	for {
+		select {
+		case msg := <-s.queue:
+			if err := s.write(msg); err != nil {
+				log.Info("error writing multiplexed ws notification", "subscription", s.id, "err", err)
+				s.closeClient()
+				return
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// subscribe dials backend and subscribes to it.
+func (up *wsMuxUpstream) subscribe(backend *Backend) error {
+	conn, err := backend.dialWS()
+	if err != nil {
+		return err
+	}
+	up.connMu.Lock()
+	up.conn = conn
+	up.backend = backend
+	up.connMu.Unlock()
+
+	req := &RPCReq{
+		JSONRPC: JSONRPCVersion,
+		Method:  "eth_subscribe",
+		Params:  up.params,
+		ID:      json.RawMessage(wsMuxSubscribeID),
+	}
+	if err := up.write(mustMarshalJSON(req)); err != nil {
+		up.close(false)
+		return err
+	}
+	if err := conn.SetReadDeadline(time.Now().Add(backend.client.Timeout)); err != nil {
+		up.close(false)
+		return err
+	}
+	// skip the messages preceding the response, if any
+	var subID string
+	for subID == "" {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			up.close(false)
+			return wrapErr(err, "error reading subscription response")
+		}
+		res, err := ParseRPCRes(bytes.NewReader(msg))
+		if err != nil || string(res.ID) != wsMuxSubscribeID {
+			continue
+		}
+		if res.IsError() {
+			up.close(false)
+			return res.Error
+		}
+		if subID, _ = res.Result.(string); subID == "" {
+			up.close(false)
+			return ErrBackendBadResponse
+		}
+	}
+	if err := conn.SetReadDeadline(time.Time{}); err != nil {
+		up.close(false)
+		return err
+	}
+
+	up.connMu.Lock()
+	defer up.connMu.Unlock()
+	if up.conn != conn {
+		// closed in the meantime
+		return errWSClosed
+	}
+	up.subID = subID
+	RecordWSMuxUpstream(backend.Name, 1)
+	return nil
+}
+
+// current returns the connection of up, its backend and its subscription ID,
+// which change on failover.
+func (up *wsMuxUpstream) current() (*websocket.Conn, *Backend, string) {
+	up.connMu.Lock()
+	defer up.connMu.Unlock()
+	return up.conn, up.backend, up.subID
+}
+
+func (up *wsMuxUpstream) write(msg []byte) error {
+	up.connMu.Lock()
+	defer up.connMu.Unlock()
+	return up.writeLocked(msg)
+}
+
+func (up *wsMuxUpstream) writeLocked(msg []byte) error {
+	if up.conn == nil {
+		return errWSClosed
+	}
+	if err := up.conn.SetWriteDeadline(time.Now().Add(up.backend.wsWriteTimeout)); err != nil {
+		return err
+	}
+	return up.conn.WriteMessage(websocket.TextMessage, msg)
+}
+
+// close closes the connection of up, unsubscribing first if unsubscribe is
+// set. Closed connections are left as is.
+func (up *wsMuxUpstream) close(unsubscribe bool) {
+	up.connMu.Lock()
+	defer up.connMu.Unlock()
+	if up.conn == nil {
+		return
+	}
+	if unsubscribe && up.subID != "" {
+		req := &RPCReq{
+			JSONRPC: JSONRPCVersion,
+			Method:  "eth_unsubscribe",
+			Params:  mustMarshalJSON([]string{up.subID}),
+			ID:      json.RawMessage(wsMuxSubscribeID),
+		}
+		if err := up.writeLocked(mustMarshalJSON(req)); err != nil {
+			log.Debug("error unsubscribing multiplexed ws subscription", "backend", up.backend.Name, "err", err)
+		}
+	}
+	up.conn.Close()
+	up.conn = nil
+	activeBackendWsConnsGauge.WithLabelValues(up.backend.Name).Dec()
+	if up.subID != "" {
+		RecordWSMuxUpstream(up.backend.Name, -1)
+		up.subID = ""
+	}
+}
+
+// wsMuxKey identifies the upstream subscription of a backend and params.
+// Params are re-encoded, so that differently formatted params share it.
+func wsMuxKey(backend *Backend, params json.RawMessage) (string, error) {
+	var p interface{}
+	if err := json.Unmarshal(params, &p); err != nil {
+		return "", ErrInvalidParams(err.Error())
+	}
+	return backend.Name + ":" + string(mustMarshalJSON(p)), nil
+}
+
+// newSubscriptionID returns a random subscription ID in the format of geth.
+func newSubscriptionID() string {
+	return "0x" + randStr(16)
+}
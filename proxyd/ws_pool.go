@@ -0,0 +1,252 @@
+package proxyd
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/gorilla/websocket"
+)
+
+const defaultWSPoolSize = 4
+
+// wsPool carries the requests of the WS clients of a backend over a few shared
+// connections, rather than a connection per client. Requests are sent under
+// IDs of the pool, and their responses are routed back to their clients under
+// their original IDs. Subscriptions need connections of their own, as their
+// notifications aren't routed by ID.
+type wsPool struct {
+	backend *Backend
+	size    int
+	nextID  atomic.Uint64
+
+	mtx    sync.Mutex
+	conns  []*wsPoolConn
+	next   int
+	closed bool
+}
+
+// wsPoolConn is a connection of a pool, with the requests in flight on it.
+type wsPoolConn struct {
+	pool *wsPool
+	conn *websocket.Conn
+
+	writeMu sync.Mutex
+
+	mtx     sync.Mutex
+	pending map[string]*wsPoolReq
+	failed  bool
+}
+
+// wsPoolReq is a request in flight on a pool connection.
+type wsPoolReq struct {
+	id      json.RawMessage
+	deliver func(msg []byte, rpcErr *RPCErr)
+}
+
+// wsPoolRes is a response on a pool connection, whose result and error are
+// left as is.
+type wsPoolRes struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   json.RawMessage `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// rpcErr returns the error of res, if any, without its data.
+func (res *wsPoolRes) rpcErr() *RPCErr {
+	if len(res.Error) == 0 || string(res.Error) == "null" {
+		return nil
+	}
+	var e struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(res.Error, &e); err != nil {
+		return ErrBackendBadResponse
+	}
+	return &RPCErr{Code: e.Code, Message: e.Message}
+}
+
+func newWSPool(backend *Backend, size int) *wsPool {
+	if size == 0 {
+		size = defaultWSPoolSize
+	}
+	return &wsPool{
+		backend: backend,
+		size:    size,
+	}
+}
+
+// forward sends req over a connection of the pool. Its response, or an error
+// response if the connection fails first, is delivered with deliver under
+// the original ID of req, along with its error if any.
+func (p *wsPool) forward(req *RPCReq, deliver func(msg []byte, rpcErr *RPCErr)) error {
+	pc, err := p.acquire()
+	if err != nil {
+		return err
+	}
+	id := strconv.FormatUint(p.nextID.Add(1), 10)
+	pooled := *req
+	pooled.ID = json.RawMessage(id)
+
+	pc.mtx.Lock()
+	if pc.failed {
+		pc.mtx.Unlock()
+		return errWSClosed
+	}
+	pc.pending[id] = &wsPoolReq{id: req.ID, deliver: deliver}
+	pc.mtx.Unlock()
+	wsPoolPendingGauge.WithLabelValues(p.backend.Name).Inc()
+
+	if err := pc.write(mustMarshalJSON(&pooled)); err != nil {
+		pc.fail(err)
+		return nil
+	}
+	return nil
+}
+
+// acquire returns the next connection of the pool, dialing it if the pool
+// isn't full.
+func (p *wsPool) acquire() (*wsPoolConn, error) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if p.closed {
+		return nil, errWSClosed
+	}
+	if len(p.conns) < p.size {
+		conn, err := p.backend.dialWS()
+		if err != nil {
+			if len(p.conns) == 0 {
+				return nil, err
+			}
+			log.Warn("error dialing pooled ws backend conn", "backend", p.backend.Name, "err", err)
+		} else {
+			pc := &wsPoolConn{
+				pool:    p,
+				conn:    conn,
+				pending: make(map[string]*wsPoolReq),
+			}
+			p.conns = append(p.conns, pc)
+			go pc.read()
+			return pc, nil
+		}
+	}
+	p.next = (p.next + 1) % len(p.conns)
+	return p.conns[p.next], nil
+}
+
+// remove removes the failed connection pc from the pool.
+func (p *wsPool) remove(pc *wsPoolConn) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	for i, c := range p.conns {
+		if c == pc {
+			p.conns = append(p.conns[:i], p.conns[i+1:]...)
+			return
+		}
+	}
+}
+
+// close closes the connections of the pool, failing their requests in
+// flight.
+func (p *wsPool) close() {
+	if p == nil {
+		return
+	}
+	p.mtx.Lock()
+	p.closed = true
+	conns := p.conns
+	p.conns = nil
+	p.mtx.Unlock()
+	for _, pc := range conns {
+		pc.fail(errWSClosed)
+	}
+}
+
+func (pc *wsPoolConn) write(msg []byte) error {
+	pc.writeMu.Lock()
+	defer pc.writeMu.Unlock()
+	if err := pc.conn.SetWriteDeadline(time.Now().Add(pc.pool.backend.wsWriteTimeout)); err != nil {
+		return err
+	}
+	return pc.conn.WriteMessage(websocket.TextMessage, msg)
+}
+
+// read routes the responses of pc to their clients until pc fails.
+func (pc *wsPoolConn) read() {
+	name := pc.pool.backend.Name
+	for {
+		_, msg, err := pc.conn.ReadMessage()
+		if err != nil {
+			pc.fail(err)
+			return
+		}
+
+		var res wsPoolRes
+		if err := json.Unmarshal(msg, &res); err != nil {
+			log.Warn("error parsing pooled ws response", "backend", name, "err", err)
+			continue
+		}
+		pc.mtx.Lock()
+		req := pc.pending[string(res.ID)]
+		delete(pc.pending, string(res.ID))
+		pc.mtx.Unlock()
+		if req == nil {
+			log.Warn("dropped pooled ws response to unknown request", "backend", name, "id", string(res.ID))
+			continue
+		}
+		wsPoolPendingGauge.WithLabelValues(name).Dec()
+		res.ID = req.id
+		req.deliver(mustMarshalJSON(&res), res.rpcErr())
+	}
+}
+
+// fail closes pc and answers its requests in flight with errors.
+func (pc *wsPoolConn) fail(err error) {
+	pc.mtx.Lock()
+	if pc.failed {
+		pc.mtx.Unlock()
+		return
+	}
+	pc.failed = true
+	pending := pc.pending
+	pc.pending = nil
+	pc.mtx.Unlock()
+
+	name := pc.pool.backend.Name
+	log.Warn("pooled ws backend conn failed", "backend", name, "pending", len(pending), "err", err)
+	pc.pool.remove(pc)
+	pc.conn.Close()
+	activeBackendWsConnsGauge.WithLabelValues(name).Dec()
+	for _, req := range pending {
+		wsPoolPendingGauge.WithLabelValues(name).Dec()
+		req.deliver(mustMarshalJSON(NewRPCErrorRes(req.id, ErrBackendOffline)), ErrBackendOffline)
+	}
+}
+
+// forwardPooled forwards a request of the client over the pool of its
+// backend. The returned error ends the proxying.
+func (w *WSProxier) forwardPooled(ctx context.Context, pool *wsPool, msgType int, req *RPCReq) error {
+	RecordRPCForward(ctx, pool.backend.Name, req.Method, RPCRequestSourceWS)
+	err := pool.forward(req, func(msg []byte, rpcErr *RPCErr) {
+		RecordWSMessage(ctx, pool.backend.Name, SourceBackend)
+		if rpcErr != nil {
+			RecordRPCError(ctx, pool.backend.Name, req.Method, rpcErr)
+		}
+		if err := w.writeClientConn(msgType, msg); err != nil {
+			log.Debug("error writing pooled ws response to client", "req_id", GetReqID(ctx), "err", err)
+		}
+	})
+	if err != nil {
+		log.Warn("error forwarding ws message over pool", "backend", pool.backend.Name, "auth", GetAuthCtx(ctx), "req_id", GetReqID(ctx), "err", err)
+		RecordRPCError(ctx, pool.backend.Name, req.Method, ErrBackendOffline)
+		return w.writeClientConn(msgType, mustMarshalJSON(NewRPCErrorRes(req.ID, ErrBackendOffline)))
+	}
+	log.Info("forwarded WS message to backend over pool", "method", req.Method, "auth", GetAuthCtx(ctx), "req_id", GetReqID(ctx))
+	return nil
+}
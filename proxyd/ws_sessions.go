@@ -0,0 +1,317 @@
+package proxyd
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	// WSSessionHeader carries the session token of a WS connection. It is set
+	// on the upgrade response, and can be sent back on reconnect instead of
+	// the session query parameter.
+	WSSessionHeader       = "X-Proxyd-Ws-Session"
+	wsSessionQueryParam   = "session"
+	defaultWSSessionTTL   = 5 * time.Minute
+	defaultWSSessionSubs  = 32
+	wsSessionTokenLen     = 16
+	wsRestoredSubIDPrefix = "proxyd_restore_"
+)
+
+// WSSession is the state of a WS client that survives reconnects: the backend
+// it was proxied to and its subscriptions.
+type WSSession struct {
+	Token string
+
+	auth    string
+	mtx     sync.Mutex
+	backend string
+	subs    map[string]json.RawMessage
+	maxSubs int
+	active  int
+	expiry  time.Time
+}
+
+// Backend returns the name of the backend the session was last proxied to.
+func (s *WSSession) Backend() string {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.backend
+}
+
+func (s *WSSession) setBackend(name string) {
+	s.mtx.Lock()
+	s.backend = name
+	s.mtx.Unlock()
+}
+
+// Subscriptions returns the eth_subscribe params of the session's
+// subscriptions, by the subscription ID known to the client.
+func (s *WSSession) Subscriptions() map[string]json.RawMessage {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	out := make(map[string]json.RawMessage, len(s.subs))
+	for id, params := range s.subs {
+		out[id] = params
+	}
+	return out
+}
+
+func (s *WSSession) addSubscription(id string, params json.RawMessage) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if len(s.subs) >= s.maxSubs {
+		return
+	}
+	s.subs[id] = params
+}
+
+func (s *WSSession) removeSubscription(id string) {
+	s.mtx.Lock()
+	delete(s.subs, id)
+	s.mtx.Unlock()
+}
+
+// WSSessionStore keeps the sessions of WS clients in memory, so that clients
+// reconnecting to the same instance within the TTL resume their session.
+type WSSessionStore struct {
+	ttl       time.Duration
+	maxSubs   int
+	mtx       sync.Mutex
+	byToken   map[string]*WSSession
+	lastSweep time.Time
+}
+
+func NewWSSessionStore(cfg WSSessionsConfig) *WSSessionStore {
+	ttl := time.Duration(cfg.TTL)
+	if ttl == 0 {
+		ttl = defaultWSSessionTTL
+	}
+	maxSubs := cfg.MaxSubscriptions
+	if maxSubs == 0 {
+		maxSubs = defaultWSSessionSubs
+	}
+	return &WSSessionStore{
+		ttl:     ttl,
+		maxSubs: maxSubs,
+		byToken: make(map[string]*WSSession),
+	}
+}
+
+// Acquire resumes the session of token if it exists and belongs to auth, or
+// starts a new one otherwise. It reports whether the session was resumed.
+// Sessions must be released once their connection closes.
+func (st *WSSessionStore) Acquire(token string, auth string) (*WSSession, bool) {
+	st.mtx.Lock()
+	defer st.mtx.Unlock()
+
+	now := time.Now()
+	if session := st.byToken[token]; session != nil && session.auth == auth {
+		session.mtx.Lock()
+		live := session.active > 0 || now.Before(session.expiry)
+		if live {
+			session.active++
+		}
+		session.mtx.Unlock()
+		if live {
+			RecordWSSessionAcquire("resumed")
+			return session, true
+		}
+	}
+	if token != "" {
+		RecordWSSessionAcquire("unknown")
+	}
+
+	if now.Sub(st.lastSweep) > st.ttl {
+		st.sweep(now)
+		st.lastSweep = now
+	}
+	session := &WSSession{
+		Token:   randStr(wsSessionTokenLen),
+		auth:    auth,
+		subs:    make(map[string]json.RawMessage),
+		maxSubs: st.maxSubs,
+		active:  1,
+	}
+	st.byToken[session.Token] = session
+	RecordWSSessionAcquire("created")
+	return session, false
+}
+
+// Release starts the TTL of session once none of its connections is open.
+func (st *WSSessionStore) Release(session *WSSession) {
+	session.mtx.Lock()
+	defer session.mtx.Unlock()
+	session.active--
+	if session.active == 0 {
+		session.expiry = time.Now().Add(st.ttl)
+	}
+}
+
+func (st *WSSessionStore) sweep(now time.Time) {
+	for token, session := range st.byToken {
+		session.mtx.Lock()
+		expired := session.active == 0 && now.After(session.expiry)
+		session.mtx.Unlock()
+		if expired {
+			delete(st.byToken, token)
+		}
+	}
+}
+
+// wsSessionTracker records the subscriptions of a WS connection into its
+// session, and restores the subscriptions of a resumed session, or of a
+// connection failed over to another backend. Restored subscriptions get new
+// IDs from the backend, which are translated back to the IDs known to the
+// client.
+type wsSessionTracker struct {
+	session     *WSSession
+	mtx         sync.Mutex
+	pending     map[string]json.RawMessage
+	pendingSubs map[string]json.RawMessage
+	restoring   map[string]string
+	toClient    map[string]string
+	toBackend   map[string]string
+}
+
+type wsSubscriptionNotification struct {
+	JSONRPC string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  struct {
+		Subscription string          `json:"subscription"`
+		Result       json.RawMessage `json:"result"`
+	} `json:"params"`
+}
+
+func newWSSessionTracker(session *WSSession) *wsSessionTracker {
+	return &wsSessionTracker{
+		session:     session,
+		pending:     make(map[string]json.RawMessage),
+		pendingSubs: make(map[string]json.RawMessage),
+		restoring:   make(map[string]string),
+		toClient:    make(map[string]string),
+		toBackend:   make(map[string]string),
+	}
+}
+
+// restoreRequests returns the eth_subscribe requests restoring the session's
+// subscriptions on a new backend connection, but those in skip. The IDs of the
+// subscriptions on the previous connection, if any, are forgotten.
+func (t *wsSessionTracker) restoreRequests(skip map[string]struct{}) [][]byte {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.restoring = make(map[string]string)
+	t.toClient = make(map[string]string)
+	t.toBackend = make(map[string]string)
+	var msgs [][]byte
+	for clientID, params := range t.session.Subscriptions() {
+		if _, ok := skip[clientID]; ok {
+			continue
+		}
+		id := mustMarshalJSON(wsRestoredSubIDPrefix + randStr(4))
+		t.restoring[string(id)] = clientID
+		msgs = append(msgs, mustMarshalJSON(&RPCReq{
+			JSONRPC: JSONRPCVersion,
+			Method:  "eth_subscribe",
+			Params:  params,
+			ID:      id,
+		}))
+	}
+	return msgs
+}
+
+// failPending returns the IDs of the requests forwarded to the backend which
+// weren't answered yet, once the backend connection failed.
+func (t *wsSessionTracker) failPending() []json.RawMessage {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	ids := make([]json.RawMessage, 0, len(t.pending))
+	for _, id := range t.pending {
+		ids = append(ids, id)
+	}
+	t.pending = make(map[string]json.RawMessage)
+	t.pendingSubs = make(map[string]json.RawMessage)
+	return ids
+}
+
+// clientReq records the subscriptions requested by the client, and returns
+// the message to forward to the backend.
+func (t *wsSessionTracker) clientReq(req *RPCReq, msg []byte) []byte {
+	if len(req.ID) > 0 {
+		t.mtx.Lock()
+		t.pending[string(req.ID)] = req.ID
+		t.mtx.Unlock()
+	}
+	switch req.Method {
+	case "eth_subscribe":
+		t.mtx.Lock()
+		t.pendingSubs[string(req.ID)] = req.Params
+		t.mtx.Unlock()
+	case "eth_unsubscribe":
+		var params []string
+		if err := json.Unmarshal(req.Params, &params); err != nil || len(params) != 1 {
+			return msg
+		}
+		clientID := params[0]
+		t.session.removeSubscription(clientID)
+
+		t.mtx.Lock()
+		backendID, ok := t.toBackend[clientID]
+		delete(t.toBackend, clientID)
+		delete(t.toClient, backendID)
+		t.mtx.Unlock()
+		if ok {
+			req.Params = mustMarshalJSON([]string{backendID})
+			return mustMarshalJSON(req)
+		}
+	}
+	return msg
+}
+
+// backendRes records the subscriptions created by the backend, and returns
+// the message to forward to the client, if any.
+func (t *wsSessionTracker) backendRes(res *RPCRes, msg []byte) ([]byte, bool) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if len(res.ID) == 0 {
+		if len(t.toClient) == 0 {
+			return msg, true
+		}
+		var notif wsSubscriptionNotification
+		if err := json.Unmarshal(msg, &notif); err != nil {
+			return msg, true
+		}
+		clientID, ok := t.toClient[notif.Params.Subscription]
+		if !ok {
+			return msg, true
+		}
+		notif.Params.Subscription = clientID
+		return mustMarshalJSON(&notif), true
+	}
+
+	id := string(res.ID)
+	delete(t.pending, id)
+	subID, _ := res.Result.(string)
+	if clientID, ok := t.restoring[id]; ok {
+		delete(t.restoring, id)
+		if res.IsError() || subID == "" {
+			log.Warn("error restoring ws subscription", "subscription", clientID, "err", res.Error)
+			t.session.removeSubscription(clientID)
+			return nil, false
+		}
+		t.toClient[subID] = clientID
+		t.toBackend[clientID] = subID
+		RecordWSSubscriptionRestored()
+		return nil, false
+	}
+	if params, ok := t.pendingSubs[id]; ok {
+		delete(t.pendingSubs, id)
+		if !res.IsError() && subID != "" {
+			t.session.addSubscription(subID, params)
+		}
+	}
+	return msg, true
+}